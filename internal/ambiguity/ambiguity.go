@@ -0,0 +1,105 @@
+// Package ambiguity notices when a symbol has several definitions of the
+// same kind, as with a type Config in internal/config and another in
+// tools/migrate, so def can say that the first one listed may not be the
+// one meant rather than leave it to be read as the answer.
+//
+// Definitions in test files don't count, since def leaves them out unless
+// asked and a test's helper type is rarely the one meant. When all but one
+// of the definitions are in vendored or example code, the one left is named
+// as the likely answer.
+package ambiguity
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Elsewhere are the directories whose code is vendored or only an example,
+// so a definition under one is less likely the one meant than a definition
+// in the project itself.
+var Elsewhere = []string{"vendor", "node_modules", "third_party", "examples", "example", "_examples"}
+
+// Definition is what Check needs to know of one of def's results.
+type Definition struct {
+	Path   string // Relative to the search root; either separator
+	Kind   string // function, type, method, and so on
+	IsTest bool   // In a test file
+}
+
+// Report is what Check found, in the shape of def's JSON summary.
+type Report struct {
+	// Kind is the kind of the definitions that clash, and Count how many
+	// there are; Count is 0 when Ambiguous is false.
+	Kind string `json:"kind,omitempty"`
+	// Preferred is the path of the one definition outside vendored and
+	// example code, when the others are all in it; "" otherwise.
+	Preferred string `json:"preferred,omitempty"`
+	Count     int    `json:"count"`
+	Ambiguous bool   `json:"ambiguous"`
+}
+
+// Check reports whether more than one of defs, leaving out those in test
+// files, is of the same kind. When several kinds clash, the one with the
+// most definitions is reported, or of those the first in defs, which are
+// in ranked order.
+func Check(defs []Definition) Report {
+	var kinds []string
+	counts := make(map[string]int)
+	for _, d := range defs {
+		if d.IsTest {
+			continue
+		}
+		if counts[d.Kind] == 0 {
+			kinds = append(kinds, d.Kind)
+		}
+		counts[d.Kind]++
+	}
+	var r Report
+	for _, kind := range kinds {
+		// Strictly more, so a tie goes to the kind ranked first
+		if counts[kind] > 1 && counts[kind] > r.Count {
+			r.Kind, r.Count = kind, counts[kind]
+		}
+	}
+	if r.Count == 0 {
+		return Report{}
+	}
+	r.Ambiguous = true
+
+	var inProject []string
+	for _, d := range defs {
+		if !d.IsTest && d.Kind == r.Kind && !IsElsewhere(d.Path) {
+			inProject = append(inProject, d.Path)
+		}
+	}
+	if len(inProject) == 1 {
+		r.Preferred = inProject[0]
+	}
+	return r
+}
+
+// IsElsewhere reports whether path is under one of the Elsewhere
+// directories, at any depth.
+func IsElsewhere(path string) bool {
+	dirs := strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '\\' })
+	if len(dirs) == 0 {
+		return false
+	}
+	return slices.ContainsFunc(dirs[:len(dirs)-1], func(dir string) bool {
+		return slices.Contains(Elsewhere, dir)
+	})
+}
+
+// Notice is the line human output shows for r, a report on symbol's
+// definitions, or "" if they aren't ambiguous.
+func (r Report) Notice(symbol string) string {
+	if !r.Ambiguous {
+		return ""
+	}
+	notice := fmt.Sprintf("%d definitions found for %s %s", r.Count, r.Kind, symbol)
+	if r.Preferred != "" {
+		return notice + fmt.Sprintf("; %s is the only one outside vendored and example code", r.Preferred)
+	}
+	return notice + "; run def with --cwd-only from the package you mean, or pass --lang, to narrow"
+}
@@ -0,0 +1,94 @@
+package ambiguity
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		defs []Definition
+		want Report
+	}{
+		{
+			name: "one",
+			defs: []Definition{{Path: "internal/config/config.go", Kind: "type"}},
+		},
+		{
+			name: "same kind twice",
+			defs: []Definition{{Path: "internal/config/config.go", Kind: "type"}, {Path: "tools/migrate/config.go", Kind: "type"}},
+			want: Report{Kind: "type", Count: 2, Ambiguous: true},
+		},
+		{
+			name: "different kinds",
+			defs: []Definition{{Path: "config.go", Kind: "type"}, {Path: "load.go", Kind: "function"}},
+		},
+		{
+			name: "tests don't count",
+			defs: []Definition{{Path: "config.go", Kind: "type"}, {Path: "config_test.go", Kind: "type", IsTest: true}},
+		},
+		{
+			name: "most of one kind",
+			defs: []Definition{
+				{Path: "a.go", Kind: "function"}, {Path: "b.go", Kind: "function"},
+				{Path: "c.go", Kind: "type"}, {Path: "d.go", Kind: "type"}, {Path: "e.go", Kind: "type"},
+			},
+			want: Report{Kind: "type", Count: 3, Ambiguous: true},
+		},
+		{
+			name: "one in the project",
+			defs: []Definition{
+				{Path: "vendor/github.com/x/cfg/config.go", Kind: "type"},
+				{Path: "internal/config/config.go", Kind: "type"},
+				{Path: `examples\basic\config.go`, Kind: "type"},
+			},
+			want: Report{Kind: "type", Count: 3, Preferred: "internal/config/config.go", Ambiguous: true},
+		},
+		{
+			name: "all vendored",
+			defs: []Definition{{Path: "vendor/a/config.go", Kind: "type"}, {Path: "node_modules/b/config.ts", Kind: "type"}},
+			want: Report{Kind: "type", Count: 2, Ambiguous: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Check(tt.defs); got != tt.want {
+				t.Errorf("Check() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsElsewhere(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"vendor/golang.org/x/sync/errgroup.go", true},
+		{`web\node_modules\react\index.js`, true},
+		{"docs/examples/basic/main.go", true},
+		{"internal/vendor.go", false},
+		{"internal/config/config.go", false},
+		{"example", false},
+	}
+	for _, tt := range tests {
+		if got := IsElsewhere(tt.path); got != tt.want {
+			t.Errorf("IsElsewhere(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestReport_Notice(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		r    Report
+	}{
+		{"not ambiguous", "", Report{}},
+		{"ambiguous", "3 definitions found for type Config; run def with --cwd-only from the package you mean, or pass --lang, to narrow", Report{Kind: "type", Count: 3, Ambiguous: true}},
+		{"preferred", "2 definitions found for type Config; internal/config/config.go is the only one outside vendored and example code", Report{Kind: "type", Count: 2, Preferred: "internal/config/config.go", Ambiguous: true}},
+	}
+	for _, tt := range tests {
+		if got := tt.r.Notice("Config"); got != tt.want {
+			t.Errorf("%s: Notice() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Package backend chooses the program that def's text search runs on.
+//
+// cdx can search with ripgrep, with grep, or natively in-process. The
+// backend setting pins one; "auto" takes the first available in a fixed
+// order, ripgrep then grep then native, so the choice only depends on what's
+// installed. A pinned backend that isn't available is an error rather than
+// a silent fallback, since a hermetic build that pins one wants to know; the
+// error, an UnavailableError, says what to install or set instead. Only a
+// program that was found but then can't be started falls back, to native,
+// as Fallback decides.
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Name identifies a backend.
+type Name string
+
+// Backends.
+const (
+	Auto    Name = "auto"
+	Ripgrep Name = "rg"
+	Grep    Name = "grep"
+	Native  Name = "native"
+)
+
+// Names lists the valid backend settings.
+var Names = []Name{Auto, Grep, Ripgrep, Native}
+
+// order is the order auto detection tries backends in.
+var order = []Name{Ripgrep, Grep, Native}
+
+// Parse parses a backend setting. Empty means Auto.
+func Parse(s string) (Name, error) {
+	if s == "" {
+		return Auto, nil
+	}
+	for _, n := range Names {
+		if Name(s) == n {
+			return n, nil
+		}
+	}
+	names := make([]string, len(Names))
+	for i, n := range Names {
+		names[i] = string(n)
+	}
+	return "", fmt.Errorf("invalid backend %q (want one of %s)", s, strings.Join(names, ", "))
+}
+
+// Availability is whether a backend can run here.
+type Availability struct {
+	Err  error // Why it can't, when it can't
+	Name Name
+	Path string // Executable, or "" for the native backend
+}
+
+// Available reports whether the backend can run.
+func (a Availability) Available() bool {
+	return a.Err == nil
+}
+
+// lookPath finds executables; tests replace it.
+var lookPath = exec.LookPath
+
+var (
+	detectOnce sync.Once
+	detected   []Availability
+)
+
+// Detect reports each backend's availability in auto detection order. The
+// PATH lookups happen once per process.
+func Detect() []Availability {
+	detectOnce.Do(func() { detected = detect() })
+	return detected
+}
+
+func detect() []Availability {
+	list := make([]Availability, 0, len(order))
+	for _, n := range order {
+		a := Availability{Name: n}
+		if n != Native {
+			a.Path, a.Err = lookPath(string(n))
+			if a.Err != nil {
+				a.Err = fmt.Errorf("%s not found on PATH", n)
+			}
+		}
+		list = append(list, a)
+	}
+	return list
+}
+
+// Choice is the backend a search runs on and why.
+type Choice struct {
+	Name   Name
+	Path   string // Executable, or "" for the native backend
+	Reason string // e.g. "backend: rg" or "auto: first available"
+}
+
+func (c Choice) String() string {
+	if c.Path == "" {
+		return fmt.Sprintf("%s (%s)", c.Name, c.Reason)
+	}
+	return fmt.Sprintf("%s %s (%s)", c.Name, c.Path, c.Reason)
+}
+
+// Choose picks the backend for want, which came from source (a flag or
+// config key, for messages).
+func Choose(want Name, source string) (Choice, error) {
+	return choose(want, source, Detect())
+}
+
+func choose(want Name, source string, avail []Availability) (Choice, error) {
+	for _, a := range avail {
+		switch {
+		case want == Auto && a.Available():
+			return Choice{Name: a.Name, Path: a.Path, Reason: "auto: first available"}, nil
+		case want == a.Name && a.Available():
+			return Choice{Name: a.Name, Path: a.Path, Reason: fmt.Sprintf("%s %s", source, want)}, nil
+		case want == a.Name:
+			return Choice{}, &UnavailableError{Err: a.Err, Name: want, Source: source}
+		}
+	}
+	// Native is always available, so only an unknown name gets here
+	return Choice{}, fmt.Errorf("%s: unknown backend %q", source, want)
+}
+
+// UnavailableError reports that a pinned backend can't run here because its
+// program isn't installed.
+type UnavailableError struct {
+	Err    error // Why it can't run
+	Name   Name
+	Source string // The flag or config key that pinned it, e.g. "backend:"
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s %s: %v; %s", e.Source, e.Name, e.Err, e.Fix())
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// Fix says how to get a search running: install the missing program, let
+// auto detection pick from what is installed, or search without a program,
+// in the terms of Source.
+func (e *UnavailableError) Fix() string {
+	set := "set backend: "
+	if strings.HasPrefix(e.Source, "--") {
+		set = "pass " + e.Source + " "
+	}
+	return fmt.Sprintf("install %s, or %sauto to use what's installed, or %snative to search without an external program", programs[e.Name], set, set)
+}
+
+// programs names what to install for each backend that runs a program.
+var programs = map[Name]string{Ripgrep: "ripgrep (rg)", Grep: "grep"}
+
+// Fallback returns the native backend to retry a search on when err says
+// c's program couldn't be started at all, as when it's been removed since
+// Detect found it, or what the PATH lookup found won't run. An error the
+// program itself reports, or any other, isn't a reason to fall back.
+func (c Choice) Fallback(err error) (Choice, bool) {
+	if c.Name == Native || err == nil {
+		return c, false
+	}
+	var execErr *exec.Error
+	var pathErr *fs.PathError
+	if !errors.As(err, &execErr) && (!errors.As(err, &pathErr) || pathErr.Op != "fork/exec") {
+		return c, false
+	}
+	return Choice{Name: Native, Reason: fmt.Sprintf("%s couldn't be run", c.Name)}, true
+}
+
+// ForSymbol returns the backend to search for symbol on: c, unless c is grep
+// and symbol has characters beyond ASCII, when it's native. The definition
+// patterns match identifiers with Unicode classes such as \p{L}, which
+// ripgrep and the native matcher read alike, while what grep makes of them
+// and of non-ASCII text depends on its build and locale.
+func (c Choice) ForSymbol(symbol string) Choice {
+	if c.Name != Grep || isASCII(symbol) {
+		return c
+	}
+	return Choice{Name: Native, Reason: "grep can't be relied on for non-ASCII symbols"}
+}
+
+func isASCII(s string) bool {
+	for i := range len(s) {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
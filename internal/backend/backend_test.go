@@ -0,0 +1,186 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestChoose(t *testing.T) {
+	all := []Availability{
+		{Name: Ripgrep, Path: "/usr/bin/rg"},
+		{Name: Grep, Path: "/bin/grep"},
+		{Name: Native},
+	}
+	grepOnly := []Availability{
+		{Name: Ripgrep, Err: errors.New("rg not found on PATH")},
+		{Name: Grep, Path: "/bin/grep"},
+		{Name: Native},
+	}
+	nativeOnly := []Availability{
+		{Name: Ripgrep, Err: errors.New("rg not found on PATH")},
+		{Name: Grep, Err: errors.New("grep not found on PATH")},
+		{Name: Native},
+	}
+
+	tests := []struct {
+		name    string
+		wantErr string
+		backend Name
+		want    Choice
+		avail   []Availability
+	}{
+		{
+			name:    "auto prefers ripgrep",
+			backend: Auto,
+			avail:   all,
+			want:    Choice{Name: Ripgrep, Path: "/usr/bin/rg", Reason: "auto: first available"},
+		},
+		{
+			name:    "auto falls back to grep",
+			backend: Auto,
+			avail:   grepOnly,
+			want:    Choice{Name: Grep, Path: "/bin/grep", Reason: "auto: first available"},
+		},
+		{
+			name:    "auto falls back to native",
+			backend: Auto,
+			avail:   nativeOnly,
+			want:    Choice{Name: Native, Reason: "auto: first available"},
+		},
+		{
+			name:    "pinned grep",
+			backend: Grep,
+			avail:   all,
+			want:    Choice{Name: Grep, Path: "/bin/grep", Reason: "backend: grep"},
+		},
+		{
+			name:    "pinned native",
+			backend: Native,
+			avail:   all,
+			want:    Choice{Name: Native, Reason: "backend: native"},
+		},
+		{
+			name:    "pinned but missing",
+			backend: Ripgrep,
+			avail:   grepOnly,
+			wantErr: "backend: rg: rg not found on PATH; install ripgrep (rg), or set backend: auto to use what's installed, or set backend: native to search without an external program",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := choose(tt.backend, "backend:", tt.avail)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("choose() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("choose() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("choose() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	orig := lookPath
+	t.Cleanup(func() { lookPath = orig })
+	lookPath = func(file string) (string, error) {
+		if file == "grep" {
+			return "/bin/grep", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	got := detect()
+	if len(got) != 3 || got[0].Name != Ripgrep || got[1].Name != Grep || got[2].Name != Native {
+		t.Fatalf("detect() = %+v, want rg, grep, native in order", got)
+	}
+	if got[0].Available() || got[0].Err.Error() != "rg not found on PATH" {
+		t.Errorf("rg = %+v, want unavailable", got[0])
+	}
+	if !got[1].Available() || got[1].Path != "/bin/grep" {
+		t.Errorf("grep = %+v, want /bin/grep", got[1])
+	}
+	if !got[2].Available() {
+		t.Errorf("native = %+v, want always available", got[2])
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{"", "auto", "rg", "grep", "native"} {
+		if _, err := Parse(s); err != nil {
+			t.Errorf("Parse(%q) error = %v", s, err)
+		}
+	}
+	if _, err := Parse("ripgrep"); err == nil || !strings.Contains(err.Error(), "want one of auto, grep, rg, native") {
+		t.Errorf("Parse(ripgrep) error = %v, want the valid backends listed", err)
+	}
+}
+
+func TestForSymbol(t *testing.T) {
+	grep := Choice{Name: Grep, Path: "/bin/grep", Reason: "backend: grep"}
+	rg := Choice{Name: Ripgrep, Path: "/bin/rg", Reason: "auto: first available"}
+	tests := []struct {
+		symbol string
+		choice Choice
+		want   Name
+	}{
+		{"GetUser", grep, Grep},
+		{"Größe", grep, Native},
+		{"数量", grep, Native},
+		{"Größe", rg, Ripgrep},
+	}
+	for _, tt := range tests {
+		if got := tt.choice.ForSymbol(tt.symbol); got.Name != tt.want {
+			t.Errorf("%s.ForSymbol(%q) = %v, want %s", tt.choice.Name, tt.symbol, got, tt.want)
+		}
+	}
+}
+
+func TestUnavailableError(t *testing.T) {
+	_, err := choose(Grep, "--backend", []Availability{{Name: Grep, Err: errors.New("grep not found on PATH")}})
+	var unavailable *UnavailableError
+	if !errors.As(err, &unavailable) {
+		t.Fatalf("choose() error = %v, want an UnavailableError", err)
+	}
+	if want := "install grep, or pass --backend auto to use what's installed, or pass --backend native to search without an external program"; unavailable.Fix() != want {
+		t.Errorf("Fix() = %q, want %q", unavailable.Fix(), want)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	grep := Choice{Name: Grep, Path: "/bin/grep", Reason: "auto: first available"}
+	tests := []struct {
+		err    error
+		choice Choice
+		name   string
+		want   bool
+	}{
+		{name: "not found", choice: grep, err: fmt.Errorf("search: %w", &exec.Error{Name: "grep", Err: exec.ErrNotFound}), want: true},
+		{name: "removed", choice: grep, err: &fs.PathError{Op: "fork/exec", Path: "/bin/grep", Err: fs.ErrNotExist}, want: true},
+		{name: "file missing", choice: grep, err: &fs.PathError{Op: "open", Path: "main.go", Err: fs.ErrNotExist}},
+		{name: "grep failed", choice: grep, err: errors.New("grep: exit status 2")},
+		{name: "no error", choice: grep},
+		{name: "native", choice: Choice{Name: Native}, err: &exec.Error{Name: "grep", Err: exec.ErrNotFound}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.choice.Fallback(tt.err)
+			if ok != tt.want {
+				t.Fatalf("Fallback(%v) ok = %v, want %v", tt.err, ok, tt.want)
+			}
+			if ok && got.Name != Native {
+				t.Errorf("Fallback(%v) = %v, want native", tt.err, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Pattern returns re written in the dialect of the backend's program: POSIX
+// extended syntax, as grep -E reads it, for grep, and Go's own syntax,
+// normalized, for ripgrep and the native matcher, whose regex engines agree
+// on it. The definition patterns escape symbols with regexp.QuoteMeta, so a
+// symbol such as jQuery$ or operator+ comes out escaped the way each
+// program expects.
+//
+// Extended syntax can't say everything Go's can, so for grep Pattern may
+// give a broader pattern: a class mixing ASCII and other characters, such
+// as \p{L}, becomes ".", and word boundaries are dropped. It never matches
+// fewer lines than re, so a searcher confirms grep's hits with re itself.
+func (n Name) Pattern(re *regexp.Regexp) (string, error) {
+	if n != Grep && n != Ripgrep {
+		return re.String(), nil
+	}
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+	if n == Ripgrep {
+		// String spells out Go-only syntax, such as \Q...\E, in forms
+		// ripgrep reads too
+		return parsed.String(), nil
+	}
+	var b strings.Builder
+	if err := writeERE(&b, parsed); err != nil {
+		return "", fmt.Errorf("pattern %q for grep: %w", re, err)
+	}
+	return b.String(), nil
+}
+
+// ereSpecial lists the characters extended syntax gives a meaning outside
+// brackets.
+const ereSpecial = `.[]()*+?{}|^$\`
+
+// writeERE writes re in POSIX extended syntax.
+func writeERE(b *strings.Builder, re *syntax.Regexp) error {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return errors.New("can't write a pattern that matches nothing")
+	case syntax.OpEmptyMatch:
+		b.WriteString("()")
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			writeLiteral(b, r, re.Flags&syntax.FoldCase != 0)
+		}
+	case syntax.OpCharClass:
+		writeClass(b, re.Rune)
+	case syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+		b.WriteByte('.')
+	case syntax.OpBeginLine, syntax.OpBeginText:
+		b.WriteByte('^')
+	case syntax.OpEndLine, syntax.OpEndText:
+		b.WriteByte('$')
+	case syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		// Extended syntax has no word boundaries; leaving them out only
+		// broadens the pattern
+	case syntax.OpCapture:
+		b.WriteByte('(')
+		if err := writeERE(b, re.Sub[0]); err != nil {
+			return err
+		}
+		b.WriteByte(')')
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		// Laziness doesn't change which lines match, so it's dropped
+		if err := writeAtom(b, re.Sub[0]); err != nil {
+			return err
+		}
+		switch re.Op {
+		case syntax.OpStar:
+			b.WriteByte('*')
+		case syntax.OpPlus:
+			b.WriteByte('+')
+		case syntax.OpQuest:
+			b.WriteByte('?')
+		default:
+			if re.Max < 0 {
+				fmt.Fprintf(b, "{%d,}", re.Min)
+			} else {
+				fmt.Fprintf(b, "{%d,%d}", re.Min, re.Max)
+			}
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpAlternate {
+				if err := writeGroup(b, sub); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := writeERE(b, sub); err != nil {
+				return err
+			}
+		}
+	case syntax.OpAlternate:
+		for i, sub := range re.Sub {
+			if i > 0 {
+				b.WriteByte('|')
+			}
+			if err := writeERE(b, sub); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported syntax %v", re.Op)
+	}
+	return nil
+}
+
+// writeAtom writes re so that a repetition operator after it applies to
+// all of it, grouping it unless it's a single character already.
+func writeAtom(b *strings.Builder, re *syntax.Regexp) error {
+	switch {
+	case re.Op == syntax.OpLiteral && len(re.Rune) == 1,
+		re.Op == syntax.OpCharClass, re.Op == syntax.OpAnyChar,
+		re.Op == syntax.OpAnyCharNotNL, re.Op == syntax.OpCapture:
+		return writeERE(b, re)
+	}
+	return writeGroup(b, re)
+}
+
+// writeGroup writes re in parentheses.
+func writeGroup(b *strings.Builder, re *syntax.Regexp) error {
+	b.WriteByte('(')
+	if err := writeERE(b, re); err != nil {
+		return err
+	}
+	b.WriteByte(')')
+	return nil
+}
+
+// writeLiteral writes r, escaped if it's special, or with fold set, as
+// either of its cases.
+func writeLiteral(b *strings.Builder, r rune, fold bool) {
+	if fold && unicode.SimpleFold(r) != r {
+		var orbit []rune
+		for f := r; ; {
+			orbit = append(orbit, f)
+			if f = unicode.SimpleFold(f); f == r {
+				break
+			}
+		}
+		// A bracket only holds characters beyond ASCII in some locales,
+		// while an alternation of literals matches them in every one
+		if slices.Max(orbit) < utf8.RuneSelf {
+			writeClass(b, foldRanges(orbit))
+			return
+		}
+		b.WriteByte('(')
+		for i, f := range orbit {
+			if i > 0 {
+				b.WriteByte('|')
+			}
+			writeLiteral(b, f, false)
+		}
+		b.WriteByte(')')
+		return
+	}
+	if r < utf8.RuneSelf && strings.ContainsRune(ereSpecial, r) {
+		b.WriteByte('\\')
+	}
+	b.WriteRune(r)
+}
+
+// foldRanges returns the ranges of a class holding just runes.
+func foldRanges(runes []rune) []rune {
+	ranges := make([]rune, 0, 2*len(runes))
+	for _, r := range runes {
+		ranges = append(ranges, r, r)
+	}
+	return ranges
+}
+
+// writeClass writes the class with the given ranges, as syntax.Regexp
+// holds them, as a bracket expression. Newlines are left out, since grep
+// reads one as the end of a pattern and lines don't hold them anyway. A
+// class whose members, or whose complement's, are all ASCII is written
+// exactly; any other becomes ".", since brackets can't hold characters
+// beyond ASCII in every locale.
+func writeClass(b *strings.Builder, ranges []rune) {
+	var in [utf8.RuneSelf]bool
+	wide := false
+	for i := 0; i < len(ranges); i += 2 {
+		for r := ranges[i]; r <= ranges[i+1]; r++ {
+			if r >= utf8.RuneSelf {
+				wide = true
+				break
+			}
+			in[r] = true
+		}
+	}
+	negate := false
+	if wide {
+		// Only a complement with no characters beyond ASCII, as of
+		// [^()], is written exactly
+		if !coversWide(ranges) {
+			b.WriteByte('.')
+			return
+		}
+		negate = true
+		for r := range in {
+			in[r] = !in[r]
+		}
+	}
+	in['\n'] = false
+
+	var members []byte
+	for c := range in {
+		if in[c] && c != ']' && c != '[' && c != '^' && c != '-' {
+			members = append(members, byte(c))
+		}
+	}
+	n := len(members)
+	for _, c := range []byte("][^-") {
+		if in[c] {
+			n++
+		}
+	}
+	switch {
+	case n == 0 && negate:
+		b.WriteByte('.')
+		return
+	case n == 1 && !negate:
+		// A lone character, such as ^, can't be bracketed by itself
+		for c := range in {
+			if in[c] {
+				writeLiteral(b, rune(c), false)
+			}
+		}
+		return
+	}
+
+	b.WriteByte('[')
+	if negate {
+		b.WriteByte('^')
+	}
+	// ] only stands for itself first, and ^ anywhere but first; [ goes
+	// late so it can't start [: and the like, and - last, unless ^ would
+	// be first
+	last := "[^-"
+	if !in[']'] && len(members) == 0 && !in['['] && !negate {
+		last = "-^"
+	}
+	if in[']'] {
+		b.WriteByte(']')
+	}
+	for i := 0; i < len(members); {
+		j := i
+		for j+1 < len(members) && members[j+1] == members[j]+1 {
+			j++
+		}
+		if j-i >= 2 {
+			b.WriteByte(members[i])
+			b.WriteByte('-')
+			b.WriteByte(members[j])
+		} else {
+			b.Write(members[i : j+1])
+		}
+		i = j + 1
+	}
+	for _, c := range []byte(last) {
+		if in[c] {
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte(']')
+}
+
+// coversWide reports whether the ranges, sorted as syntax.Regexp holds
+// them, include every character beyond ASCII.
+func coversWide(ranges []rune) bool {
+	next := rune(utf8.RuneSelf)
+	for i := 0; i < len(ranges); i += 2 {
+		if ranges[i+1] < next {
+			continue
+		}
+		if ranges[i] > next {
+			return false
+		}
+		next = ranges[i+1] + 1
+	}
+	return next > unicode.MaxRune
+}
@@ -0,0 +1,179 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+func TestPattern(t *testing.T) {
+	tests := []struct {
+		name, re string
+		backend  Name
+		want     string
+	}{
+		{"native is unchanged", `^func\s+a\.b\s*\(`, Native, `^func\s+a\.b\s*\(`},
+		{"ripgrep normalizes", `^const\s+\Qa$b\E`, Ripgrep, `\Aconst[\t\n\f\r ]+a\$b`},
+		{"escapes", `^func\s+a\.b\$\+\s*\(`, Grep, "^func[\t\f\r ]+a\\.b\\$\\+[\t\f\r ]*\\("},
+		{"groups and alternation", `^(?:export\s+)?(?:class|type)\s+x`, Grep, "^(export[\t\f\r ]+)?(class|type)[\t\f\r ]+x"},
+		{"braces and brackets", `a\{b\}\[c\]\|d`, Grep, `a\{b\}\[c\]\|d`},
+		{"ascii class", `^[A-Za-z_][A-Za-z0-9_]*`, Grep, `^[A-Z_a-z][0-9A-Z_a-z]*`},
+		{"negated ascii class", `\([^()]*\)`, Grep, `\([^()]*\)`},
+		{"class of specials", `[]^\-[]`, Grep, `[][^-]`},
+		{"caret and dash", `[\^-]`, Grep, `[-^]`},
+		{"lone caret", `[\^]`, Grep, `\^`},
+		{"unicode class broadens", `^\t[\p{L}_]+`, Grep, "^\t.+"},
+		{"word boundary dropped", `\bx\b`, Grep, `x`},
+		{"lazy is greedy", `\(.*?\)\s*=>`, Grep, "\\(.*\\)[\t\f\r ]*=>"},
+		{"repeat", `a{2,}b{1,3}`, Grep, `a{2,}b{1,3}`},
+		{"fold", `(?i:ab)`, Grep, `[Aa][Bb]`},
+		{"fold beyond ascii", `(?i:k)`, Grep, "(K|k|\u212a)"}, // K, k, and the Kelvin sign
+		{"end anchor", `x$`, Grep, `x$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.backend.Pattern(regexp.MustCompile(tt.re))
+			if err != nil {
+				t.Fatalf("Pattern(%q) error = %v", tt.re, err)
+			}
+			if got != tt.want {
+				t.Errorf("Pattern(%q) = %q, want %q", tt.re, got, tt.want)
+			}
+		})
+	}
+}
+
+// metaSymbols hold every character regexp.QuoteMeta escapes, and -, as a
+// symbol a user might search for, such as jQuery$ or operator+.
+var metaSymbols = []string{
+	`jQuery$`, `a.b`, `a+b`, `a*b`, `a?b`, `a(b)`, `a|b`, `a[b]`, `a{b}`,
+	`^ab`, `a\b`, `a-b`, `$`, `$$`,
+}
+
+// definitionLines are lines defining %s in each language.
+var definitionLines = map[patterns.Language][]string{
+	patterns.Go:         {"func %s() {}", "type %s struct{}", "var %s = 1"},
+	patterns.JavaScript: {"function %s() {}", "const %s = () => 1", "const %s = (a) => a", "class %s {}", "  %s() {", "const %s = memo((p) => p)", "const %s = styled.div`a`"},
+	patterns.Python:     {"def %s():", "class %s:"},
+	patterns.Rust:       {"fn %s() {}", "pub struct %s {}", "    fn %s(&self) {}"},
+	patterns.C:          {"int %s(void) {", "static char *%s(int n)", "struct %s {", "typedef int %s;", "} %s;", "#define %s 1"},
+	patterns.Ruby:       {"def %s(x)", "  def self.%s", "class %s < Base", "module %s", "%s = 1"},
+	patterns.PHP:        {"function %s() {", "    public static function %s()", "final class %s extends Base", "interface %s", "    const %s = 1;"},
+	patterns.Kotlin:     {"fun %s() {", "    private suspend fun %s()", "data class %s(val x: Int)", "interface %s", "val %s = 1"},
+	patterns.Swift:      {"func %s() {", "    public static func %s<T>(x: T)", "final class %s: Base {", "protocol %s {", "let %s = 1"},
+	patterns.CSharp:     {"public class %s", "    public static void %s(int x)", "    public %s()", "    public int %s { get; set; }", "public interface %s"},
+	patterns.Scala:      {"def %s(x: Int): Int =", "  private def %s: Int = 1", "case class %s(x: Int)", "trait %s {", "val %s = 1"},
+	patterns.Elixir:     {"def %s(x) do", "  defp %s x, do: x", "  defmacro %s(ast) do", "defmodule %s do", "defprotocol %s do"},
+	patterns.Zig:        {"pub fn %s() void {", "    fn %s(self: *Self) void {", "pub const %s = struct {", "const %s = union(enum) {", "var %s: u32 = 0;"},
+	patterns.Lua:        {"function %s(x)", "local function %s()", "function Stack.%s(self)", "function Stack:%s()", "local %s = function(a)"},
+	patterns.Cpp:        {"void %s() {", "void Widget::%s() const {", "class %s : public Base {", "using %s = int;", "namespace %s {"},
+}
+
+// writeFixture writes a file of each language's definition lines for the
+// metaSymbols, with near misses, and returns its path.
+func writeFixture(t *testing.T, lang patterns.Language) string {
+	t.Helper()
+	var lines []string
+	for _, sym := range metaSymbols {
+		variants := []string{sym, strings.ToUpper(sym), sym + sym}
+		for _, c := range sym {
+			if !strings.ContainsRune(`abjQuery`, c) {
+				variants = append(variants, strings.ReplaceAll(sym, string(c), "z"), strings.ReplaceAll(sym, string(c), ""))
+			}
+		}
+		for _, v := range variants {
+			for _, l := range definitionLines[lang] {
+				lines = append(lines, fmt.Sprintf(l, v))
+			}
+		}
+	}
+	path := filepath.Join(t.TempDir(), "defs."+string(lang))
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// searchWith returns the numbers of the lines of file that program, run as
+// backend n, matches with any of res.
+func searchWith(t *testing.T, program string, n Name, res []*regexp.Regexp, file string) []int {
+	t.Helper()
+	args := []string{"-n", "--no-filename"}
+	if n == Grep {
+		args = append(args, "-E")
+	}
+	for _, re := range res {
+		p, err := n.Pattern(re)
+		if err != nil {
+			t.Fatalf("Pattern(%q) error = %v", re, err)
+		}
+		args = append(args, "-e", p)
+	}
+	out, err := exec.Command(program, append(args, file)...).Output() // #nosec G204 -- test runs the backends found on PATH
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("%s %q: %v", program, args, err)
+	}
+	var found []int
+	for line := range strings.Lines(string(out)) {
+		num, _, _ := strings.Cut(line, ":")
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			t.Fatalf("%s printed %q", program, line)
+		}
+		found = append(found, n)
+	}
+	return found
+}
+
+func TestPatternMetaSymbols(t *testing.T) {
+	var programs []Name
+	for _, n := range []Name{Grep, Ripgrep} {
+		if _, err := exec.LookPath(string(n)); err == nil {
+			programs = append(programs, n)
+		}
+	}
+	if len(programs) == 0 {
+		t.Skip("neither grep nor rg is on PATH")
+	}
+
+	for lang := range definitionLines {
+		file := writeFixture(t, lang)
+		data, err := os.ReadFile(file) // #nosec G304 -- the fixture written above
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		for _, sym := range metaSymbols {
+			for _, fold := range []bool{false, true} {
+				defs := patterns.DefinitionsFor(sym, lang, fold)
+				var want []int
+				for i, line := range lines {
+					if slices.ContainsFunc(defs.Patterns, func(re *regexp.Regexp) bool { return re.MatchString(line) }) {
+						want = append(want, i+1)
+					}
+				}
+				if len(want) == 0 {
+					t.Fatalf("%s: no line defines %q natively", lang, sym)
+				}
+				for _, n := range programs {
+					if got := searchWith(t, string(n), n, defs.Patterns, file); !slices.Equal(got, want) {
+						t.Errorf("%s %s %q (fold %v) matched lines %v, native matched %v", n, lang, sym, fold, got, want)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,484 @@
+// Package cache persists extracted definition symbols between cdx invocations.
+//
+// Each repository gets its own directory under ConfigDir()/cache/, keyed by a
+// hash of the repository's absolute path. Entries are keyed by file path and
+// validated against the file's size and modification time, so only files that
+// changed since the last run need to be rescanned.
+package cache
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bashhack/cdx/internal/config"
+	"github.com/bashhack/cdx/internal/symbols"
+)
+
+// DefaultMaxBytes caps the approximate size of a single repository's cache.
+const DefaultMaxBytes = 32 << 20
+
+// indexFile is the name of the per-repository cache file.
+const indexFile = "symbols.json"
+
+// namesFile is the name of the per-repository completion index, which lists
+// the distinct names and kinds in the cache, one "name\tkind" line each, in
+// sorted order so a prefix can be found by binary search.
+const namesFile = "names.txt"
+
+// listingsFile is the name of the per-repository record of the directory
+// listings walks read, kept for walk.Listings.
+const listingsFile = "listings.json"
+
+// entryOverhead approximates the encoded size of an entry's fixed fields.
+const entryOverhead = 64
+
+// Symbol is a definition extracted from a file.
+type Symbol struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	Line int    `json:"line"`
+}
+
+// FromSymbols returns the cache's record of the definitions found, which
+// keeps each one's name, kind, and line.
+func FromSymbols(found []symbols.Symbol) []Symbol {
+	cached := make([]Symbol, len(found))
+	for i, s := range found {
+		cached[i] = Symbol{Name: s.Name, Kind: s.Kind, Line: s.Line}
+	}
+	return cached
+}
+
+// Name is a symbol name in the completion index, with its kind.
+type Name struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// ErrNoIndex is returned by Complete when the repository has no completion
+// index, or one that's out of date with the cache.
+var ErrNoIndex = errors.New("no symbol index")
+
+// entry holds the cached symbols of one file and the metadata used to validate them.
+type entry struct {
+	Symbols  []Symbol `json:"symbols"`
+	Size     int64    `json:"size"`
+	ModTime  int64    `json:"mtime"`
+	LastUsed int64    `json:"last_used"`
+}
+
+// size returns the approximate encoded size of the entry.
+func (e *entry) size(path string) int64 {
+	n := int64(len(path) + entryOverhead)
+	for _, s := range e.Symbols {
+		n += int64(len(s.Name) + len(s.Kind) + entryOverhead)
+	}
+	return n
+}
+
+// Cache is a per-repository symbol cache. It is safe for concurrent use.
+type Cache struct {
+	now     func() time.Time
+	entries map[string]*entry
+	dir     string
+	// index is the completion index of entries, as names.txt lines, built
+	// by Complete; nil when it needs building
+	index    []string
+	maxBytes int64
+	mu       sync.Mutex
+	dirty    bool
+}
+
+// Dir returns the root directory holding all repository caches.
+func Dir() (string, error) {
+	configDir, err := config.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "cache"), nil
+}
+
+// Open returns the cache for the repository rooted at root.
+// A missing or unreadable cache file yields an empty cache rather than an
+// error, since the cache only ever saves work.
+func Open(root string) (*Cache, error) {
+	dir, err := repoDir(root)
+	if err != nil {
+		return nil, err
+	}
+	return New(dir, DefaultMaxBytes), nil
+}
+
+// ListingsFile returns the path of the file recording the directory listings
+// of walks of the repository rooted at root, for walk.LoadListings.
+func ListingsFile(root string) (string, error) {
+	dir, err := repoDir(root)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, listingsFile), nil
+}
+
+// repoDir returns the directory holding the cache of the repository rooted
+// at root.
+func repoDir(root string) (string, error) {
+	base, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, repoKey(abs)), nil
+}
+
+// New returns a cache stored in dir, evicting least recently used entries
+// once the cache grows beyond maxBytes.
+func New(dir string, maxBytes int64) *Cache {
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*entry),
+		now:      time.Now,
+	}
+	c.load()
+	return c
+}
+
+// repoKey derives a stable directory name from a repository path. Windows
+// paths are folded to lower case, as its file systems ignore case, so
+// C:\src\repo and c:\src\repo share a cache.
+func repoKey(abs string) string {
+	if runtime.GOOS == "windows" {
+		abs = strings.ToLower(abs)
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return hex.EncodeToString(sum[:8])
+}
+
+// load reads the cache file, discarding it if it is corrupt.
+func (c *Cache) load() {
+	data, err := os.ReadFile(filepath.Join(c.dir, indexFile))
+	if err != nil {
+		return
+	}
+	var entries map[string]*entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return
+	}
+	for path, e := range entries {
+		if e != nil {
+			c.entries[path] = e
+		}
+	}
+}
+
+// Get returns the cached symbols for path if its size and modification time
+// still match info. A hit updates the entry's recency in memory only; it is
+// written with the next Save that has entries to add, replace or evict, so a
+// run that changes nothing leaves the cache file alone.
+func (c *Cache) Get(path string, info fs.FileInfo) ([]Symbol, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[path]
+	if !ok || e.Size != info.Size() || e.ModTime != info.ModTime().UnixNano() {
+		return nil, false
+	}
+	e.LastUsed = c.now().Unix()
+	return e.Symbols, true
+}
+
+// Lookup is Get guarded by Verify: it returns the cached symbols for path
+// only if each one's line still holds its name, and otherwise drops the
+// entry, so a file changed without its size or modification time changing
+// is rescanned rather than served stale.
+func (c *Cache) Lookup(path string, info fs.FileInfo) ([]Symbol, bool) {
+	cached, ok := c.Get(path, info)
+	if !ok {
+		return nil, false
+	}
+	if !Verify(path, cached) {
+		c.Invalidate(path)
+		return nil, false
+	}
+	return cached, true
+}
+
+// Put records the symbols extracted from path.
+func (c *Cache) Put(path string, info fs.FileInfo, symbols []Symbol) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[path] = &entry{
+		Symbols:  symbols,
+		Size:     info.Size(),
+		ModTime:  info.ModTime().UnixNano(),
+		LastUsed: c.now().Unix(),
+	}
+	c.dirty, c.index = true, nil
+}
+
+// Invalidate drops the entry for path, forcing the next lookup to rescan it.
+func (c *Cache) Invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[path]; ok {
+		delete(c.entries, path)
+		c.dirty, c.index = true, nil
+	}
+}
+
+// Len returns the number of cached files.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Save evicts least recently used entries beyond the size cap and writes the
+// cache to disk. The write goes to a temporary file that is renamed into
+// place, so concurrent readers never observe a partially written cache.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+	c.evict()
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	if err := writeAtomic(c.dir, indexFile, data); err != nil {
+		return err
+	}
+	// Written second, so an index older than the cache file is one whose
+	// write failed
+	if err := writeAtomic(c.dir, namesFile, c.names()); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// evict removes least recently used entries until the cache fits maxBytes.
+// Callers must hold c.mu.
+func (c *Cache) evict() {
+	if c.maxBytes <= 0 {
+		return
+	}
+
+	var total int64
+	paths := make([]string, 0, len(c.entries))
+	for path, e := range c.entries {
+		total += e.size(path)
+		paths = append(paths, path)
+	}
+	if total <= c.maxBytes {
+		return
+	}
+
+	// Oldest first; ties broken by path so eviction is deterministic
+	sort.Slice(paths, func(i, j int) bool {
+		a, b := c.entries[paths[i]], c.entries[paths[j]]
+		if a.LastUsed != b.LastUsed {
+			return a.LastUsed < b.LastUsed
+		}
+		return paths[i] < paths[j]
+	})
+	for _, path := range paths {
+		if total <= c.maxBytes {
+			break
+		}
+		total -= c.entries[path].size(path)
+		delete(c.entries, path)
+		c.index = nil
+	}
+}
+
+// names encodes the completion index of the cache's entries. Callers must
+// hold c.mu.
+func (c *Cache) names() []byte {
+	lines := c.nameLines()
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// nameLines returns the lines of the completion index of the cache's
+// entries, without terminators, in sorted order. Callers must hold c.mu.
+func (c *Cache) nameLines() []string {
+	seen := make(map[Name]bool)
+	for _, e := range c.entries {
+		for _, s := range e.Symbols {
+			seen[Name{Name: s.Name, Kind: s.Kind}] = true
+		}
+	}
+	lines := make([]string, 0, len(seen))
+	for n := range seen {
+		lines = append(lines, n.Name+"\t"+n.Kind)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// Complete is like the package's Complete, but answers from the cache in
+// memory, so a process that keeps the cache open, such as cdx serve, sees
+// the definitions put since it was last saved without rereading the index.
+func (c *Cache) Complete(prefix string, limit int) []Name {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.index == nil {
+		c.index = c.nameLines()
+	}
+	return lookup(c.index, prefix, limit)
+}
+
+// Complete returns up to limit names starting with prefix from the
+// completion index of the repository rooted at root, in sorted order. It
+// reads only the index, never the repository, so it's quick enough to run on
+// every keystroke; the index is as current as the last search that used the
+// cache. It returns ErrNoIndex when there's no index or it's out of date.
+func Complete(root, prefix string, limit int) ([]Name, error) {
+	dir, err := repoDir(root)
+	if err != nil {
+		return nil, err
+	}
+	return complete(dir, prefix, limit)
+}
+
+func complete(dir, prefix string, limit int) ([]Name, error) {
+	if !current(dir) {
+		return nil, ErrNoIndex
+	}
+	data, err := os.ReadFile(filepath.Join(dir, namesFile))
+	if err != nil {
+		return nil, ErrNoIndex
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return lookup(strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), prefix, limit), nil
+}
+
+// Indexed reports whether the repository rooted at root has a completion
+// index that's up to date with its cache, for Complete to answer from.
+func Indexed(root string) bool {
+	dir, err := repoDir(root)
+	return err == nil && current(dir)
+}
+
+// current reports whether the completion index in dir exists and is no
+// older than the cache it lists.
+func current(dir string) bool {
+	index, err := os.Stat(filepath.Join(dir, namesFile))
+	if err != nil {
+		return false
+	}
+	cached, err := os.Stat(filepath.Join(dir, indexFile))
+	return err == nil && !cached.ModTime().After(index.ModTime())
+}
+
+// lookup returns up to limit of the names in lines, a completion index's
+// lines in sorted order, that start with prefix.
+func lookup(lines []string, prefix string, limit int) []Name {
+	var found []Name
+	for i := sort.SearchStrings(lines, prefix); i < len(lines) && len(found) < limit; i++ {
+		name, kind, _ := strings.Cut(lines[i], "\t")
+		if !strings.HasPrefix(name, prefix) {
+			break
+		}
+		found = append(found, Name{Name: name, Kind: kind})
+	}
+	return found
+}
+
+// writeAtomic writes data to dir/name via a temporary file and rename.
+func writeAtomic(dir, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, name+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// Remove is a no-op once the rename has succeeded
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
+
+// Clear removes every repository cache.
+func Clear() error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Verify reports whether every symbol's line in path still contains the
+// symbol's name. It guards against serving a stale location when a file was
+// modified without its size or modification time changing.
+func Verify(path string, symbols []Symbol) bool {
+	if len(symbols) == 0 {
+		return true
+	}
+
+	want := make(map[int][]string, len(symbols))
+	maxLine := 0
+	for _, s := range symbols {
+		want[s.Line] = append(want[s.Line], s.Name)
+		maxLine = max(maxLine, s.Line)
+	}
+
+	f, err := os.Open(path) // #nosec G304 -- path comes from the directory walk
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	verified := 0
+	r := bufio.NewReader(f)
+	for lineNum := 1; lineNum <= maxLine; lineNum++ {
+		line, err := r.ReadString('\n')
+		for _, name := range want[lineNum] {
+			if !strings.Contains(line, name) {
+				return false
+			}
+			verified++
+		}
+		if err != nil {
+			break
+		}
+	}
+	return verified == len(symbols)
+}
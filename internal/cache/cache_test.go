@@ -0,0 +1,405 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bashhack/cdx/internal/symbols"
+)
+
+// writeFile creates a file under dir and returns its path and info.
+func writeFile(t *testing.T, dir, name, content string) (string, os.FileInfo) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, info
+}
+
+func TestCache_RoundTrip(t *testing.T) {
+	src := t.TempDir()
+	cacheDir := filepath.Join(t.TempDir(), "repo")
+
+	path, info := writeFile(t, src, "user.go", "package sample\n\nfunc GetUser() {}\n")
+	symbols := []Symbol{{Name: "GetUser", Kind: "function", Line: 3}}
+
+	c := New(cacheDir, DefaultMaxBytes)
+	c.Put(path, info, symbols)
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	reopened := New(cacheDir, DefaultMaxBytes)
+	got, ok := reopened.Get(path, info)
+	if !ok {
+		t.Fatal("Get() miss after reopen, want hit")
+	}
+	if len(got) != 1 || got[0] != symbols[0] {
+		t.Errorf("Get() = %v, want %v", got, symbols)
+	}
+}
+
+func TestCache_MissOnChangedMetadata(t *testing.T) {
+	src := t.TempDir()
+	path, info := writeFile(t, src, "user.go", "func GetUser() {}\n")
+
+	c := New(t.TempDir(), DefaultMaxBytes)
+	c.Put(path, info, []Symbol{{Name: "GetUser", Kind: "function", Line: 1}})
+
+	// Same size, different mtime
+	later := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get(path, changed); ok {
+		t.Error("Get() hit after mtime change, want miss")
+	}
+
+	// Different size
+	_, grown := writeFile(t, src, "user.go", "func GetUser() {}\n\n")
+	if _, ok := c.Get(path, grown); ok {
+		t.Error("Get() hit after size change, want miss")
+	}
+}
+
+func TestCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	src := t.TempDir()
+	cacheDir := t.TempDir()
+	oldPath, oldInfo := writeFile(t, src, "old.go", "func Old() {}\n")
+	newPath, newInfo := writeFile(t, src, "new.go", "func New() {}\n")
+
+	// Room for exactly one entry
+	oldEntry := &entry{Symbols: []Symbol{{Name: "Old", Kind: "function", Line: 1}}}
+	c := New(cacheDir, oldEntry.size(oldPath))
+
+	clock := time.Unix(1000, 0)
+	c.now = func() time.Time { return clock }
+	c.Put(oldPath, oldInfo, oldEntry.Symbols)
+	clock = clock.Add(time.Minute)
+	c.Put(newPath, newInfo, []Symbol{{Name: "New", Kind: "function", Line: 1}})
+
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	reopened := New(cacheDir, DefaultMaxBytes)
+	if _, ok := reopened.Get(oldPath, oldInfo); ok {
+		t.Error("least recently used entry survived eviction")
+	}
+	if _, ok := reopened.Get(newPath, newInfo); !ok {
+		t.Error("most recently used entry was evicted")
+	}
+}
+
+func TestCache_HitsDoNotRewrite(t *testing.T) {
+	src := t.TempDir()
+	cacheDir := t.TempDir()
+	path, info := writeFile(t, src, "user.go", "func GetUser() {}\n")
+
+	c := New(cacheDir, DefaultMaxBytes)
+	c.Put(path, info, []Symbol{{Name: "GetUser", Kind: "function", Line: 1}})
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	reopened := New(cacheDir, DefaultMaxBytes)
+	if err := os.Remove(filepath.Join(cacheDir, indexFile)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reopened.Get(path, info); !ok {
+		t.Fatal("Get() miss after reopen, want hit")
+	}
+	if err := reopened.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, indexFile)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Save() after only hits wrote the cache file, stat error = %v", err)
+	}
+
+	// A change writes the entries, with the hits' recency
+	reopened.Invalidate(path)
+	if err := reopened.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, indexFile)); err != nil {
+		t.Errorf("Save() after a change didn't write the cache file: %v", err)
+	}
+}
+
+func TestCache_SaveLeavesNoTempFiles(t *testing.T) {
+	src := t.TempDir()
+	cacheDir := t.TempDir()
+	path, info := writeFile(t, src, "user.go", "func GetUser() {}\n")
+
+	c := New(cacheDir, DefaultMaxBytes)
+	c.Put(path, info, nil)
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Errorf("temporary file %q left behind", e.Name())
+		}
+	}
+}
+
+func TestCache_CorruptFileIsIgnored(t *testing.T) {
+	cacheDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(cacheDir, indexFile), []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := New(cacheDir, DefaultMaxBytes).Len(); got != 0 {
+		t.Errorf("Len() = %d, want 0 for corrupt cache", got)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	src := t.TempDir()
+	path, _ := writeFile(t, src, "user.go", "package sample\n\nfunc GetUser() {}\nconst MaxUsers = 10")
+
+	tests := []struct {
+		name    string
+		symbols []Symbol
+		want    bool
+	}{
+		{
+			name:    "all symbols on their lines",
+			symbols: []Symbol{{Name: "GetUser", Line: 3}, {Name: "MaxUsers", Line: 4}},
+			want:    true,
+		},
+		{
+			name:    "symbol moved",
+			symbols: []Symbol{{Name: "GetUser", Line: 2}},
+			want:    false,
+		},
+		{
+			name:    "line past end of file",
+			symbols: []Symbol{{Name: "GetUser", Line: 10}},
+			want:    false,
+		},
+		{
+			name: "no symbols",
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(path, tt.symbols); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCache_Lookup(t *testing.T) {
+	src := t.TempDir()
+	cached := []Symbol{{Name: "GetUser", Kind: "function", Line: 3}}
+
+	tests := []struct {
+		name string
+		// edit rewrites the file after it's cached, keeping its size and
+		// modification time
+		edit string
+		want bool
+	}{
+		{
+			name: "unchanged",
+			want: true,
+		},
+		{
+			name: "edited in place",
+			edit: "package sample\n\nfunc GetUsex() {}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, info := writeFile(t, src, "user.go", "package sample\n\nfunc GetUser() {}\n")
+			c := New(t.TempDir(), DefaultMaxBytes)
+			c.Put(path, info, cached)
+			if tt.edit != "" {
+				if err := os.WriteFile(path, []byte(tt.edit), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, ok := c.Lookup(path, info)
+			if ok != tt.want || ok && !slices.Equal(got, cached) {
+				t.Errorf("Lookup() = %v, %v, want hit %v", got, ok, tt.want)
+			}
+			if _, kept := c.Get(path, info); kept != tt.want {
+				t.Errorf("entry kept = %v, want %v", kept, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromSymbols(t *testing.T) {
+	found := []symbols.Symbol{
+		{Name: "Store", Kind: "type", Line: 3, Column: 6, EndLine: 5},
+		{Name: "Get", Kind: "method", Parent: "Store", Line: 7, Column: 17},
+	}
+	want := []Symbol{{Name: "Store", Kind: "type", Line: 3}, {Name: "Get", Kind: "method", Line: 7}}
+	if got := FromSymbols(found); !slices.Equal(got, want) {
+		t.Errorf("FromSymbols() = %v, want %v", got, want)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	src := t.TempDir()
+	cacheDir := t.TempDir()
+	if _, err := complete(cacheDir, "", 10); !errors.Is(err, ErrNoIndex) {
+		t.Fatalf("complete() before Save error = %v, want ErrNoIndex", err)
+	}
+
+	path, info := writeFile(t, src, "user.go", "")
+	other, otherInfo := writeFile(t, src, "admin.go", "")
+	c := New(cacheDir, DefaultMaxBytes)
+	c.Put(path, info, []Symbol{{Name: "GetUser", Kind: "function"}, {Name: "User", Kind: "type"}, {Name: "GetUsers", Kind: "function"}})
+	c.Put(other, otherInfo, []Symbol{{Name: "GetUser", Kind: "function"}, {Name: "Get", Kind: "method"}})
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		prefix string
+		want   []Name
+		limit  int
+	}{
+		{prefix: "GetU", limit: 10, want: []Name{{"GetUser", "function"}, {"GetUsers", "function"}}},
+		{prefix: "Get", limit: 2, want: []Name{{"Get", "method"}, {"GetUser", "function"}}},
+		{prefix: "", limit: 10, want: []Name{{"Get", "method"}, {"GetUser", "function"}, {"GetUsers", "function"}, {"User", "type"}}},
+		{prefix: "Nope", limit: 10, want: nil},
+	}
+	for _, tt := range tests {
+		got, err := complete(cacheDir, tt.prefix, tt.limit)
+		if err != nil {
+			t.Fatalf("complete(%q) error = %v", tt.prefix, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("complete(%q, %d) = %v, want %v", tt.prefix, tt.limit, got, tt.want)
+		}
+	}
+
+	// A cache file newer than the index means the index is out of date
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(cacheDir, indexFile), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := complete(cacheDir, "Get", 10); !errors.Is(err, ErrNoIndex) {
+		t.Errorf("complete() with a stale index error = %v, want ErrNoIndex", err)
+	}
+}
+
+func TestCache_Complete(t *testing.T) {
+	src := t.TempDir()
+	path, info := writeFile(t, src, "user.go", "")
+	c := New(t.TempDir(), DefaultMaxBytes)
+	c.Put(path, info, []Symbol{{Name: "GetUser", Kind: "function"}, {Name: "User", Kind: "type"}})
+	if got, want := c.Complete("Get", 10), []Name{{"GetUser", "function"}}; !slices.Equal(got, want) {
+		t.Errorf("Complete(Get) = %v, want %v", got, want)
+	}
+
+	// Unsaved changes show up at once
+	c.Put(path, info, []Symbol{{Name: "GetUsers", Kind: "function"}})
+	if got, want := c.Complete("Get", 10), []Name{{"GetUsers", "function"}}; !slices.Equal(got, want) {
+		t.Errorf("Complete(Get) after Put = %v, want %v", got, want)
+	}
+	c.Invalidate(path)
+	if got := c.Complete("", 10); got != nil {
+		t.Errorf("Complete() after Invalidate = %v, want none", got)
+	}
+}
+
+func TestComplete_LargeIndex(t *testing.T) {
+	src := t.TempDir()
+	cacheDir := t.TempDir()
+	c := New(cacheDir, 0)
+	for f := range 100 {
+		path, info := writeFile(t, src, fmt.Sprintf("file%d.go", f), "")
+		symbols := make([]Symbol, 1000)
+		for i := range symbols {
+			symbols[i] = Symbol{Name: fmt.Sprintf("Symbol%03d_%03d", f, i), Kind: "function", Line: i + 1}
+		}
+		c.Put(path, info, symbols)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	got, err := complete(cacheDir, "Symbol042_1", 50)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 50 || got[0].Name != "Symbol042_100" || got[49].Name != "Symbol042_149" {
+		t.Errorf("complete() = %d names from %v, want 50 from Symbol042_100", len(got), got[:min(len(got), 1)])
+	}
+	if elapsed > 100*time.Millisecond {
+		t.Errorf("complete() over 100k symbols took %v, want under 100ms", elapsed)
+	}
+}
+
+func TestClear(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("AppData", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	path, info := writeFile(t, t.TempDir(), "user.go", "func GetUser() {}\n")
+	c.Put(path, info, nil)
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if err := Clear(); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	dir, err := Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("cache directory still exists after Clear(): %v", err)
+	}
+}
+
+func TestRepoKey(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Repo")
+	// Windows file systems ignore case, so one repository could otherwise
+	// get two caches
+	same := repoKey(dir) == repoKey(strings.ToLower(dir))
+	if want := runtime.GOOS == "windows"; same != want {
+		t.Errorf("repoKey(%q) == repoKey(lower case) is %v, want %v", dir, same, want)
+	}
+}
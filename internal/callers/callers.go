@@ -0,0 +1,144 @@
+// Package callers answers "what calls this?" transitively. The callers of a
+// symbol are the definitions enclosing its call sites, as a reference search
+// reports them; the callers of those are found the same way, level by level,
+// into a tree rooted at the symbol.
+//
+// Calls are matched by name, so the tree is only as precise as the search
+// behind it: a call to any function of the same name counts.
+package callers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/refs"
+)
+
+// DefaultMaxNodes is the node cap used when Options.MaxNodes is zero, so a
+// common name doesn't grow a tree spanning most of the codebase.
+const DefaultMaxNodes = 200
+
+// Finder returns the references to symbol, each with its Enclosing
+// definition when it has one; refs.Find with Options.Outline set will do.
+type Finder func(ctx context.Context, symbol string) ([]refs.Ref, error)
+
+// Node is a definition in a call tree. The root is the queried symbol, and
+// every other node calls its parent.
+type Node struct {
+	parent *Node
+	Name   string `json:"name"` // Qualified by its parent, as in User.Save, when known
+	Kind   string `json:"kind,omitempty"`
+	// Path and Line locate the node's first call to its parent; the root
+	// has neither
+	Path    string  `json:"path,omitempty"`
+	Callers []*Node `json:"callers,omitempty"`
+	Line    int     `json:"line,omitempty"`
+	// Cycle marks a node whose name is already on the path to the root, so
+	// its callers, which are that node's, aren't repeated
+	Cycle bool `json:"cycle,omitempty"`
+	// Truncated marks a node whose callers weren't searched, or not all
+	// kept, because the tree reached Options.Depth or Options.MaxNodes
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Options controls how far a call tree grows.
+type Options struct {
+	// Depth is how many levels of callers to find; 1, the minimum, finds
+	// only the symbol's direct callers.
+	Depth int
+	// MaxNodes caps the callers in the tree, not counting the root; zero
+	// means DefaultMaxNodes and a negative value means no limit.
+	MaxNodes int
+}
+
+// Tree returns the callers of symbol up to opts.Depth levels. Levels are
+// filled breadth first, so when MaxNodes cuts the tree short, the nearest
+// callers are the ones kept. Top-level calls, as in a package variable's
+// initializer, have no enclosing definition and aren't callers.
+//
+// If find fails, Tree returns the tree built so far along with the error,
+// which lets an interrupted search still show its partial result.
+func Tree(ctx context.Context, symbol string, find Finder, opts Options) (*Node, error) {
+	depth := max(opts.Depth, 1)
+	limit := opts.MaxNodes
+	if limit == 0 {
+		limit = DefaultMaxNodes
+	}
+
+	root := &Node{Name: symbol}
+	// A name is searched once however many branches it turns up in
+	searched := make(map[string][]refs.Ref)
+	nodes := 0
+	level := []*Node{root}
+	for d := 1; len(level) > 0; d++ {
+		var next []*Node
+		for _, n := range level {
+			if d > depth || (limit > 0 && nodes >= limit) {
+				n.Truncated = true
+				continue
+			}
+			name := searchName(n.Name)
+			found, ok := searched[name]
+			if !ok {
+				var err error
+				if found, err = find(ctx, name); err != nil {
+					return root, err
+				}
+				searched[name] = found
+			}
+			for _, c := range callSites(found) {
+				if limit > 0 && nodes >= limit {
+					n.Truncated = true
+					break
+				}
+				nodes++
+				child := &Node{Name: c.Enclosing.Name, Kind: c.Enclosing.Kind, Path: c.Path, Line: c.Line, parent: n}
+				child.Cycle = onPath(n, searchName(child.Name))
+				n.Callers = append(n.Callers, child)
+				if !child.Cycle {
+					next = append(next, child)
+				}
+			}
+		}
+		level = next
+	}
+	return root, nil
+}
+
+// callSites returns the first call from each distinct enclosing definition
+// among found, in order.
+func callSites(found []refs.Ref) []refs.Ref {
+	type caller struct{ name, path string }
+	seen := make(map[caller]bool)
+	var sites []refs.Ref
+	for _, r := range found {
+		if r.Definition || r.Kind != patterns.RefCall || r.Enclosing == nil {
+			continue
+		}
+		key := caller{r.Enclosing.Name, r.Path}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		sites = append(sites, r)
+	}
+	return sites
+}
+
+// onPath reports whether a node from n up to the root is searched for as
+// name.
+func onPath(n *Node, name string) bool {
+	for ; n != nil; n = n.parent {
+		if searchName(n.Name) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// searchName is the name a definition is called by: User.Save is called as
+// Save.
+func searchName(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
@@ -0,0 +1,149 @@
+package callers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/refs"
+)
+
+// graph is a fake Finder: each name maps to the definitions calling it.
+type graph map[string][]string
+
+func (g graph) find(searches *int) Finder {
+	return func(_ context.Context, symbol string) ([]refs.Ref, error) {
+		*searches++
+		var found []refs.Ref
+		for i, caller := range g[symbol] {
+			found = append(found, refs.Ref{
+				Path:      strings.ToLower(searchName(caller)) + ".go",
+				Line:      i + 1,
+				Kind:      patterns.RefCall,
+				Enclosing: &refs.Enclosing{Name: caller, Kind: "function"},
+			})
+		}
+		return found, nil
+	}
+}
+
+// render flattens a tree to one line per node, indented by depth.
+func render(n *Node, indent string, b *strings.Builder) {
+	fmt.Fprintf(b, "%s%s", indent, n.Name)
+	if n.Cycle {
+		b.WriteString(" (cycle)")
+	}
+	if n.Truncated {
+		b.WriteString(" ...")
+	}
+	b.WriteString("\n")
+	for _, c := range n.Callers {
+		render(c, indent+"  ", b)
+	}
+}
+
+func TestTree(t *testing.T) {
+	g := graph{
+		"Load":   {"Get", "warm"},
+		"Get":    {"handle", "User.Refresh"},
+		"warm":   {"warm"},
+		"handle": {"serve"},
+	}
+	tests := []struct {
+		name     string
+		want     string
+		opts     Options
+		searches int
+	}{
+		{
+			name:     "direct callers",
+			opts:     Options{Depth: 1},
+			want:     "Load\n  Get ...\n  warm ...\n",
+			searches: 1,
+		},
+		{
+			name:     "depth 2 marks the recursion as a cycle",
+			opts:     Options{Depth: 2},
+			want:     "Load\n  Get\n    handle ...\n    User.Refresh ...\n  warm\n    warm (cycle)\n",
+			searches: 3,
+		},
+		{
+			name:     "leaves past the callers found aren't truncated",
+			opts:     Options{Depth: 10},
+			want:     "Load\n  Get\n    handle\n      serve\n    User.Refresh\n  warm\n    warm (cycle)\n",
+			searches: 6,
+		},
+		{
+			name:     "node cap keeps the nearest callers",
+			opts:     Options{Depth: 10, MaxNodes: 3},
+			want:     "Load\n  Get ...\n    handle ...\n  warm ...\n",
+			searches: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searches := 0
+			root, err := Tree(context.Background(), "Load", g.find(&searches), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b strings.Builder
+			render(root, "", &b)
+			if b.String() != tt.want {
+				t.Errorf("Tree() =\n%s\nwant\n%s", b.String(), tt.want)
+			}
+			if searches != tt.searches {
+				t.Errorf("searches = %d, want %d", searches, tt.searches)
+			}
+		})
+	}
+}
+
+func TestTreeCallSites(t *testing.T) {
+	found := []refs.Ref{
+		{Path: "a.go", Line: 1, Kind: patterns.RefCall, Definition: true},
+		{Path: "a.go", Line: 2, Kind: patterns.RefCall},
+		{Path: "a.go", Line: 3, Kind: patterns.RefType, Enclosing: &refs.Enclosing{Name: "typed"}},
+		{Path: "a.go", Line: 4, Kind: patterns.RefCall, Enclosing: &refs.Enclosing{Name: "run"}},
+		{Path: "a.go", Line: 5, Kind: patterns.RefCall, Enclosing: &refs.Enclosing{Name: "run"}},
+		{Path: "b.go", Line: 1, Kind: patterns.RefCall, Enclosing: &refs.Enclosing{Name: "run"}},
+	}
+	find := func(_ context.Context, symbol string) ([]refs.Ref, error) {
+		if symbol == "Load" {
+			return found, nil
+		}
+		return nil, nil
+	}
+	root, err := Tree(context.Background(), "Load", find, Options{Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range root.Callers {
+		got = append(got, fmt.Sprintf("%s %s:%d", c.Name, c.Path, c.Line))
+	}
+	if want := "run a.go:4, run b.go:1"; strings.Join(got, ", ") != want {
+		t.Errorf("callers = %s, want %s", strings.Join(got, ", "), want)
+	}
+}
+
+func TestTreeError(t *testing.T) {
+	boom := errors.New("boom")
+	find := func(_ context.Context, symbol string) ([]refs.Ref, error) {
+		if symbol == "Load" {
+			return []refs.Ref{{Path: "a.go", Kind: patterns.RefCall, Enclosing: &refs.Enclosing{Name: "Get"}}}, nil
+		}
+		return nil, boom
+	}
+	root, err := Tree(context.Background(), "Load", find, Options{Depth: 2})
+	if !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want %v", err, boom)
+	}
+	if root == nil || len(root.Callers) != 1 {
+		t.Errorf("partial tree = %+v, want Load's caller", root)
+	}
+}
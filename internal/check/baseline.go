@@ -0,0 +1,96 @@
+package check
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// BaselineVersion identifies the format of a baseline file.
+const BaselineVersion = 1
+
+// Baseline records the violations known when it was made, so they can be
+// let through while new ones fail. Violations are identified by rule, file,
+// and line text rather than line number, so code moving around doesn't make
+// them new; a file with more of the same line than recorded has new ones.
+type Baseline struct {
+	Violations []Known `json:"violations"`
+	Version    int     `json:"version"`
+}
+
+// Known is a violation in a Baseline, and how many times its line occurs.
+type Known struct {
+	Rule  string `json:"rule"`
+	Path  string `json:"path"`
+	Text  string `json:"text"` // Trimmed of surrounding space
+	Count int    `json:"count"`
+}
+
+type knownKey struct{ rule, path, text string }
+
+func keyOf(v *Violation) knownKey {
+	return knownKey{v.Rule, v.Path, strings.TrimSpace(v.Text)}
+}
+
+// NewBaseline returns the baseline recording violations.
+func NewBaseline(violations []Violation) Baseline {
+	counts := make(map[knownKey]int)
+	for i := range violations {
+		counts[keyOf(&violations[i])]++
+	}
+	b := Baseline{Violations: make([]Known, 0, len(counts)), Version: BaselineVersion}
+	for k, n := range counts {
+		b.Violations = append(b.Violations, Known{Rule: k.rule, Path: k.path, Text: k.text, Count: n})
+	}
+	slices.SortFunc(b.Violations, func(x, y Known) int {
+		return cmp.Or(strings.Compare(x.Path, y.Path), strings.Compare(x.Rule, y.Rule), strings.Compare(x.Text, y.Text))
+	})
+	return b
+}
+
+// ReadBaseline reads the baseline file at path.
+func ReadBaseline(path string) (Baseline, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- the baseline file the user named
+	if err != nil {
+		return Baseline{}, err
+	}
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return Baseline{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if b.Version != BaselineVersion {
+		return Baseline{}, fmt.Errorf("%s: unsupported baseline version %d (want %d)", path, b.Version, BaselineVersion)
+	}
+	return b, nil
+}
+
+// Write writes the baseline to the file at path.
+func (b Baseline) Write(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// Filter returns the violations the baseline doesn't account for, in order,
+// and how many it does.
+func (b Baseline) Filter(violations []Violation) (fresh []Violation, known int) {
+	left := make(map[knownKey]int, len(b.Violations))
+	for _, k := range b.Violations {
+		left[knownKey{k.Rule, k.Path, k.Text}] += k.Count
+	}
+	for i := range violations {
+		k := keyOf(&violations[i])
+		if left[k] > 0 {
+			left[k]--
+			known++
+			continue
+		}
+		fresh = append(fresh, violations[i])
+	}
+	return fresh, known
+}
@@ -0,0 +1,65 @@
+package check
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBaseline(t *testing.T) {
+	recorded := []Violation{
+		{Rule: "OldClient", Path: "a.go", Text: "\tc := OldClient()", Line: 4},
+		{Rule: "OldClient", Path: "a.go", Text: "\tc := OldClient()", Line: 9},
+		{Rule: "OldClient", Path: "b.go", Text: "OldClient()", Line: 2},
+	}
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := NewBaseline(recorded).Write(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Known{
+		{Rule: "OldClient", Path: "a.go", Text: "c := OldClient()", Count: 2},
+		{Rule: "OldClient", Path: "b.go", Text: "OldClient()", Count: 1},
+	}
+	if !reflect.DeepEqual(b.Violations, want) {
+		t.Errorf("ReadBaseline() = %+v, want %+v", b.Violations, want)
+	}
+
+	// The known lines moved, and a.go gained a third of the same line and
+	// c.go a new one
+	current := []Violation{
+		{Rule: "OldClient", Path: "a.go", Text: "\tc := OldClient()", Line: 14},
+		{Rule: "OldClient", Path: "a.go", Text: "\tc := OldClient()", Line: 19},
+		{Rule: "OldClient", Path: "a.go", Text: "\tc := OldClient()", Line: 30},
+		{Rule: "OldClient", Path: "b.go", Text: "OldClient()", Line: 7},
+		{Rule: "OldClient", Path: "c.go", Text: "OldClient()", Line: 1},
+	}
+	fresh, known := b.Filter(current)
+	if known != 3 || len(fresh) != 2 || fresh[0].Line != 30 || fresh[1].Path != "c.go" {
+		t.Errorf("Filter() = %+v, %d known; want a.go:30 and c.go:1 new, 3 known", fresh, known)
+	}
+}
+
+func TestReadBaseline_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]string{
+		"not json":      "{",
+		"wrong version": `{"violations": [], "version": 2}`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(name, " ", "_"))
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ReadBaseline(path); err == nil || !strings.Contains(err.Error(), path) {
+				t.Errorf("ReadBaseline() error = %v, want one naming the file", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Package check finds the references that break a codebase's rules against
+// using some symbols, such as deprecated APIs, and keeps a baseline of the
+// ones already known, so a build can fail on new ones alone.
+package check
+
+import (
+	"context"
+	"path"
+
+	"github.com/bashhack/cdx/internal/config"
+	"github.com/bashhack/cdx/internal/ignore"
+	"github.com/bashhack/cdx/pkg/cdx"
+)
+
+// Rule is a compiled config.CheckRule.
+type Rule struct {
+	allow   *ignore.Matcher
+	Name    string // The symbol, or else the regex, identifying the rule
+	Symbol  string
+	Regex   string
+	Message string
+}
+
+// Violation is a reference that breaks a rule.
+type Violation struct {
+	Rule    string `json:"rule"` // Rule.Name
+	Message string `json:"message,omitempty"`
+	Name    string `json:"name"` // The name referenced
+	Path    string `json:"path"` // Slash-separated
+	Text    string `json:"text"` // The whole line, without its terminator
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+}
+
+// Compile compiles rules, as they're validated when the config loads.
+func Compile(rules []config.CheckRule) ([]Rule, error) {
+	compiled := make([]Rule, 0, len(rules))
+	for _, r := range rules {
+		if _, err := r.Names(); err != nil {
+			return nil, err
+		}
+		allow, err := r.AllowRules()
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, Rule{
+			Name:    r.Name(),
+			Symbol:  r.Symbol,
+			Regex:   r.Regex,
+			Message: r.Message,
+			allow:   ignore.New(allow...),
+		})
+	}
+	return compiled, nil
+}
+
+// Allowed reports whether the rule allows references in the file at rel, a
+// slash-separated path relative to the repository root, because one of its
+// allow patterns matches the file or a directory it's in.
+func (r *Rule) Allowed(rel string) bool {
+	if r.allow == nil {
+		return false
+	}
+	if ok, _ := r.allow.Match(rel, false); ok {
+		return true
+	}
+	for dir := path.Dir(rel); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if ok, _ := r.allow.Match(dir, true); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the references in the files q selects that break rule, in
+// the order cdx.Search returns them, with paths relative to their root.
+// Every file is searched, tests and generated ones included. Mentions in
+// comments and strings aren't uses and don't count, nor do the sites that
+// define the symbol. When the search stops early, Find returns the
+// violations found so far with cdx.Search's error.
+func Find(ctx context.Context, rule *Rule, q cdx.Query) ([]Violation, error) {
+	q.Symbol, q.Regex = rule.Symbol, rule.Regex
+	q.Mode, q.Kinds = cdx.References, nil
+	q.SkipComments, q.SkipStrings, q.InStrings = true, true, false
+	q.IncludeTests, q.OnlyTests, q.IncludeGenerated = true, false, true
+	q.CountByFile = false
+	res, err := cdx.Search(ctx, q)
+
+	var violations []Violation
+	for _, r := range res.Results {
+		if rule.Allowed(r.Path) {
+			continue
+		}
+		violations = append(violations, Violation{
+			Rule:    rule.Name,
+			Message: rule.Message,
+			Name:    r.Name,
+			Path:    r.Path,
+			Text:    r.Text,
+			Line:    r.Line,
+			Column:  r.Column,
+		})
+	}
+	return violations, err
+}
@@ -0,0 +1,80 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/config"
+	"github.com/bashhack/cdx/pkg/cdx"
+)
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"client/old.go": "package client\n\nfunc OldClient() {}\n\nfunc wrap() { OldClient() }\n",
+		"api/api.go":    "package api\n\n// OldClient is gone.\nfunc run() {\n\tOldClient()\n\tLegacyOpen(\"OldClient\")\n}\n",
+		"api/vendor.go": "package api\n\nvar _ = OldClient\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rules, err := Compile([]config.CheckRule{
+		{Symbol: "OldClient", Message: "use NewClient", Allow: []string{"client/", "vendor.go"}},
+		{Regex: `Legacy\w+|Old\w+`, Allow: []string{"api/"}},
+		{Regex: `Legacy\w+`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for i := range rules {
+		found, err := Find(context.Background(), &rules[i], cdx.Query{Roots: []string{root}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range found {
+			got = append(got, fmt.Sprintf("%s:%d:%d %s %s %q", v.Path, v.Line, v.Column, v.Rule, v.Name, v.Message))
+		}
+	}
+	// The comments, the string, the definition, and the allowed files don't
+	// count, even for a regex
+	want := []string{
+		`api/api.go:5:2 OldClient OldClient "use NewClient"`,
+		`client/old.go:5:15 Legacy\w+|Old\w+ OldClient ""`,
+		`api/api.go:6:2 Legacy\w+ LegacyOpen ""`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Find() = %q, want %q", got, want)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	rules, err := Compile([]config.CheckRule{{Symbol: "X", Allow: []string{"internal/legacy/", "*_test.go", "/cmd/tool/main.go"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"internal/legacy/a.go":     true,
+		"internal/legacy/sub/b.go": true,
+		"internal/api/a.go":        false,
+		"pkg/a_test.go":            true,
+		"cmd/tool/main.go":         true,
+		"other/cmd/tool/main.go":   false,
+	}
+	for rel, want := range tests {
+		if got := rules[0].Allowed(rel); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/bashhack/cdx/internal/workspace"
+)
+
+// archiveRoots checks the archives --archive names and returns them as the
+// roots to search, in the order given, each once.
+func archiveRoots(archives []string) ([]workspace.Root, error) {
+	var roots []workspace.Root
+	for _, archive := range archives {
+		info, err := os.Stat(archive)
+		if err != nil {
+			return nil, fmt.Errorf("--archive: %w", err)
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("--archive: %s is a directory; search it as a root instead", archive)
+		}
+		root := workspace.Root{Dir: archive}
+		if !slices.Contains(roots, root) {
+			roots = append(roots, root)
+		}
+	}
+	return roots, nil
+}
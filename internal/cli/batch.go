@@ -0,0 +1,247 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/rpc"
+	"github.com/bashhack/cdx/internal/walk"
+)
+
+var (
+	batchParallel int
+	batchFollow   bool
+)
+
+var batchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "Answer many queries, read as JSON lines from stdin",
+	Long: `Answer many queries in one process, for offline analysis jobs: each line
+of standard input is a query, and each line of standard output the answer
+to one.
+
+  cdx batch < queries.jsonl > answers.jsonl
+
+A query names a command with cmd (def, refs, or outline) and takes the
+params that command takes in cdx serve --json-rpc, the command's flags
+named with underscores, along with an id of any JSON type:
+
+  {"id": 1, "cmd": "def", "symbol": "Config", "lang": "go", "max_results": 3}
+  {"id": 2, "cmd": "refs", "symbol": "Config", "no_comments": true}
+  {"id": "u", "cmd": "outline", "file": "internal/user.go"}
+
+Each answer echoes the query's id with the command's -o json output as
+result, or with an error, {"message": ...}, when the query fails. A query
+that finds nothing has empty results rather than an error. A line that
+isn't a JSON object or has no id gets an error with a null id and its line
+number as line, and the rest are still answered.
+
+The roots are walked once, before the first query, and every query searches
+the files that walk found, which is the point of a batch over a shell loop.
+The walk honors the exclude settings, max_file_size, and --follow; each
+query's own follow has no effect.
+
+With --parallel N, N queries are answered at a time, and the answers come
+in the order they finish rather than the order of the queries; match them
+up by id.
+
+Examples:
+  cdx batch < queries.jsonl > answers.jsonl
+  cdx batch --parallel 8 < queries.jsonl | jq -c 'select(.error)'`,
+	Args: cobra.NoArgs,
+	Annotations: map[string]string{
+		noPagerAnnotation:   "true",
+		exitCodesAnnotation: exitCodes(exitCodePartial),
+	},
+	RunE: runBatch,
+}
+
+func init() {
+	batchCmd.Flags().IntVar(&batchParallel, "parallel", 1, "Answer this many queries at a time, in any order")
+	batchCmd.Flags().BoolVarP(&batchFollow, "follow", "L", false, "Follow symlinks in the walk, searching each file once")
+	rootCmd.AddCommand(batchCmd)
+}
+
+// batchQuery is a line of cdx batch's input, read.
+type batchQuery struct {
+	data []byte
+	line int // 1-based
+}
+
+// batchRecord is a line of cdx batch's output.
+type batchRecord struct {
+	Result any             `json:"result,omitempty"`
+	Error  *batchError     `json:"error,omitempty"`
+	ID     json.RawMessage `json:"id"`
+	// Line is the query's line, given when it has no id to answer with
+	Line int `json:"line,omitempty"`
+}
+
+// batchError is a failed query's error.
+type batchError struct {
+	Message string `json:"message"`
+}
+
+func runBatch(cmd *cobra.Command, args []string) error {
+	if batchParallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1, got %d", batchParallel)
+	}
+	ctx := cmd.Context()
+	s := newServer(cmd)
+	defer s.save()
+	if err := s.walkRoots(ctx, batchFollow); err != nil {
+		if interrupted(err) {
+			return partialError(cmd.ErrOrStderr(), err)
+		}
+		return err
+	}
+
+	var (
+		queries = make(chan batchQuery)
+		mu      sync.Mutex // Serializes the answers
+		wg      sync.WaitGroup
+		failed  error // The first error writing an answer
+	)
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	for range batchParallel {
+		wg.Go(func() {
+			for q := range queries {
+				r := s.answer(ctx, q)
+				mu.Lock()
+				if err := enc.Encode(r); err != nil && failed == nil {
+					failed = err
+				}
+				mu.Unlock()
+			}
+		})
+	}
+
+	readErr := readQueries(ctx, cmd.InOrStdin(), queries)
+	close(queries)
+	wg.Wait()
+	switch {
+	case readErr != nil && interrupted(readErr):
+		return partialError(cmd.ErrOrStderr(), readErr)
+	case readErr != nil:
+		return fmt.Errorf("reading queries: %w", readErr)
+	}
+	return failed
+}
+
+// readQueries sends each non-blank line of r to queries, until r ends or
+// ctx is done.
+func readQueries(ctx context.Context, r io.Reader, queries chan<- batchQuery) error {
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		data, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			select {
+			case queries <- batchQuery{data: data, line: n}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// walkRoots walks each root the configuration selects once, for every
+// query to search the files found.
+func (s *server) walkRoots(ctx context.Context, follow bool) error {
+	roots, _, err := resolveRoots(s.cmd, s.cfg)
+	if err != nil {
+		return err
+	}
+	exclude, err := excludeRules(s.cfg)
+	if err != nil {
+		return err
+	}
+	maxFileSize, err := resolveMaxFileSize(s.cmd, "", s.cfg)
+	if err != nil {
+		return err
+	}
+	s.walks = make(map[string]*rootWalk, len(roots))
+	for _, root := range roots {
+		w := &rootWalk{}
+		opts := walk.Options{Root: root.Dir, Exclude: exclude, MaxFileSize: maxFileSize, FollowSymlinks: follow}
+		opts.Listings = walkListings(s.cfg, root.Dir)
+		if _, err := walk.Walk(ctx, opts, func(f walk.File) error {
+			w.files = append(w.files, f)
+			w.paths = append(w.paths, f.Rel)
+			return nil
+		}); err != nil {
+			return err
+		}
+		saveListings(opts.Listings)
+		s.walks[root.Dir] = w
+	}
+	return nil
+}
+
+// answer answers q, the command it names taking the rest of its fields as
+// params.
+func (s *server) answer(ctx context.Context, q batchQuery) batchRecord {
+	fail := func(id json.RawMessage, err error) batchRecord {
+		r := batchRecord{ID: id, Error: &batchError{Message: err.Error()}}
+		if len(id) == 0 || string(id) == "null" {
+			r.ID, r.Line = json.RawMessage("null"), q.line
+		}
+		return r
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(q.data, &fields); err != nil {
+		return fail(nil, fmt.Errorf("invalid query: %w", err))
+	}
+	id := fields["id"]
+	if len(id) == 0 || string(id) == "null" {
+		return fail(nil, errors.New("id: missing"))
+	}
+	var command string
+	if err := json.Unmarshal(fields["cmd"], &command); err != nil || command == "" {
+		return fail(id, errors.New("cmd: missing (want def, refs, or outline)"))
+	}
+	delete(fields, "id")
+	delete(fields, "cmd")
+	params, err := json.Marshal(fields)
+	if err != nil {
+		return fail(id, err)
+	}
+
+	var result any
+	switch command {
+	case "def":
+		var p definitionParams
+		if err = rpc.DecodeParams(params, &p); err == nil {
+			result, err = s.findDefinition(ctx, p)
+		}
+	case "refs":
+		var p referencesParams
+		if err = rpc.DecodeParams(params, &p); err == nil {
+			result, err = s.findReferences(ctx, p, nil)
+		}
+	case "outline":
+		var p outlineParams
+		if err = rpc.DecodeParams(params, &p); err == nil {
+			result, err = s.outlineFile(p)
+		}
+	default:
+		err = fmt.Errorf("cmd: unknown command %q (want def, refs, or outline)", command)
+	}
+	if err != nil {
+		return fail(id, err)
+	}
+	return batchRecord{ID: id, Result: result}
+}
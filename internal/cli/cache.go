@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/cache"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the persistent symbol cache",
+	Long: `Manage the persistent symbol cache.
+
+cdx caches the definitions extracted from each file, keyed by the file's size
+and modification time, so repeated searches only rescan files that changed.
+It also records the directories each walk read, so the next walk only reads
+those whose modification time changed; walk_cache_ttl bounds how long they're
+trusted. Pass --no-cache to any command to bypass the cache for one invocation.`,
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all cached symbols",
+	Args:  cobra.NoArgs,
+	// The cache lives outside any project, so no config applies to it
+	Annotations: map[string]string{noConfigAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cache.Clear(); err != nil {
+			return err
+		}
+		cmd.Println("Cache cleared")
+		return nil
+	},
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheClearCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
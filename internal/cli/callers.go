@@ -0,0 +1,236 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/callers"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/refs"
+	"github.com/bashhack/cdx/internal/symbols"
+	"github.com/bashhack/cdx/pkg/cdx"
+)
+
+var (
+	callersLang      string
+	callersDepth     int
+	callersMaxNodes  int
+	callersTests     bool
+	callersGenerated bool
+	callersFollow    bool
+)
+
+var callersCmd = &cobra.Command{
+	Use:   "callers <symbol>",
+	Short: "Show what calls a symbol, and what calls those",
+	Long: `Show the functions and methods that call a symbol, as a tree rooted at
+the symbol: what breaks if it changes.
+
+A caller is the definition enclosing a call reference, as cdx refs groups
+them, so the tree shares refs' precision: calls are matched by name, and a
+call to another function of the same name counts too. Calls outside any
+definition, like a package variable's initializer, aren't shown.
+
+--depth finds callers of callers, up to that many levels. A caller already
+on the path to the symbol, as in recursion, is marked (cycle) and not
+followed again. To keep a common name from taking over the codebase, the
+tree stops growing at --max-nodes callers, max_caller_nodes in config,
+keeping the nearest ones. Callers whose own callers weren't searched,
+because of either limit, end in "..." in human output and have truncated
+set in JSON output.
+
+` + pickHelp + ` Each caller's line is where
+it makes the call.
+
+Examples:
+  cdx callers ParseOrder                # Direct callers of ParseOrder
+  cdx callers ParseOrder --depth 3      # Up to three levels of callers
+  cdx callers Save -d 5 --max-nodes 0   # No cap on the tree's size
+  cdx callers ParseOrder -o json        # Output as a nested JSON tree
+  cdx callers ParseOrder --pick         # Choose a caller to jump to`,
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{exitCodesAnnotation: exitCodes(exitCodeNotFound, exitCodePartial)},
+	RunE:        runCallers,
+}
+
+func init() {
+	callersCmd.Flags().StringVarP(&callersLang, "lang", "l", "", "Force language ("+builtinLangs+", or all to ignore default_lang)")
+	callersCmd.Flags().IntVarP(&callersDepth, "depth", "d", 1, "Levels of callers to find")
+	callersCmd.Flags().IntVar(&callersMaxNodes, "max-nodes", callers.DefaultMaxNodes, "Show at most this many callers (0 for no limit)")
+	callersCmd.Flags().BoolVar(&callersTests, "include-tests", true, "Count callers in test files")
+	callersCmd.Flags().BoolVar(&callersGenerated, "generated", false, "Count callers in generated files, such as *.pb.go")
+	callersCmd.Flags().BoolVarP(&callersFollow, "follow", "L", false, "Follow symlinks, searching each file once")
+	callersCmd.Flags().BoolVar(&pickFlag, "pick", false, "Choose a caller with fzf, or from a numbered list, and print or open it")
+
+	rootCmd.AddCommand(callersCmd)
+}
+
+func runCallers(cmd *cobra.Command, args []string) error {
+	symbol := args[0]
+	if callersDepth < 1 {
+		return fmt.Errorf("--depth: must be 1 or more, got %d", callersDepth)
+	}
+	if callersMaxNodes < 0 {
+		return fmt.Errorf("--max-nodes: must be 0 (unlimited) or a positive count, got %d", callersMaxNodes)
+	}
+
+	cfg := commandConfig(cmd)
+	roots, base, err := resolveRoots(cmd, cfg)
+	if err != nil {
+		return err
+	}
+	exclude, err := exclusions(cfg)
+	if err != nil {
+		return err
+	}
+	maxFileSize, err := resolveMaxFileSize(cmd, "", cfg)
+	if err != nil {
+		return err
+	}
+	maxLineLength, err := resolveMaxLineLength(cfg)
+	if err != nil {
+		return err
+	}
+	workers, err := resolveJobs(cmd, cfg)
+	if err != nil {
+		return err
+	}
+	langs, err := resolveLangs(cmd, callersLang, cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := symbols.ForParser(cfg.BackendParser); err != nil {
+		return err
+	}
+
+	ctx, cancel := searchContext(cmd)
+	defer cancel()
+
+	query := cdx.Query{
+		Kinds:             []string{string(patterns.RefCall)},
+		Parser:            cfg.BackendParser,
+		Exclude:           exclude,
+		TestPaths:         cfg.TestPaths,
+		GeneratedPatterns: cfg.GeneratedPatterns,
+		MaxFileSize:       maxFileSize,
+		MaxLineLength:     maxLineLength,
+		Jobs:              workers,
+		IncludeTests:      resolveIncludeTests(cmd, callersTests, cfg, true),
+		IncludeGenerated:  callersGenerated,
+		FollowSymlinks:    callersFollow,
+	}
+	for _, lang := range langs.Langs {
+		query.Languages = append(query.Languages, cdx.Language(lang))
+	}
+	// Every level searches each root in turn, like refs
+	find := func(ctx context.Context, name string) ([]refs.Ref, error) {
+		var found []refs.Ref
+		for _, root := range roots {
+			q := query
+			q.Symbol, q.Roots = name, []string{root.Dir}
+			res, err := cdx.Search(ctx, q)
+			for _, r := range res.Results {
+				ref := refOf(r)
+				ref.Path = showPath(root.RelTo(base, ref.Path))
+				found = append(found, ref)
+			}
+			if err != nil {
+				return found, err
+			}
+		}
+		return found, nil
+	}
+	limit := callersMaxNodes
+	if limit == 0 {
+		limit = -1
+	}
+	tree, err := callers.Tree(ctx, symbol, find, callers.Options{Depth: callersDepth, MaxNodes: limit})
+	partial := err != nil && interrupted(err)
+	if err != nil && !partial {
+		return err
+	}
+
+	w := cmd.OutOrStdout()
+	if wantJSON() {
+		report := callersReport{Tree: tree, Truncated: truncated(tree), Partial: partial}
+		if err := writeJSON(w, report); err != nil {
+			return err
+		}
+	} else if wantFzf() && !pickFlag {
+		writeFzf(w, callerLocations(tree))
+	} else if len(tree.Callers) > 0 && !pickFlag {
+		writeCallers(w, tree, "")
+	}
+
+	if partial {
+		return partialError(cmd.ErrOrStderr(), err)
+	}
+	if len(tree.Callers) == 0 {
+		err := fmt.Errorf("no callers of %s found", symbol)
+		fmt.Fprintf(cmd.ErrOrStderr(), "%v\n", err)
+		warnDefaultLang(cmd, langs)
+		return ExitError{Code: 3, Err: err}
+	}
+	if pickFlag {
+		return pick(cmd, callerLocations(tree))
+	}
+	return nil
+}
+
+// callerLocations lists the callers in the tree under n, each before its
+// own callers, for -o fzf and --pick.
+func callerLocations(n *callers.Node) []location {
+	var locs []location
+	for _, c := range n.Callers {
+		locs = append(locs, location{File: c.Path, Line: c.Line, Kind: c.Kind, Name: c.Name, Text: "calls " + n.Name})
+		locs = append(locs, callerLocations(c)...)
+	}
+	return locs
+}
+
+// callersReport is the JSON representation of a call tree.
+type callersReport struct {
+	Tree *callers.Node `json:"tree"`
+	// Truncated is set when any node's callers were cut off by --depth or
+	// --max-nodes
+	Truncated bool `json:"truncated"`
+	Partial   bool `json:"partial"` // The search was interrupted
+}
+
+// truncated reports whether n or any node under it is truncated.
+func truncated(n *callers.Node) bool {
+	if n.Truncated {
+		return true
+	}
+	for _, c := range n.Callers {
+		if truncated(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCallers prints n and its callers as a tree, each level indented two
+// spaces further than the one it calls, with where each caller makes the
+// call.
+func writeCallers(w io.Writer, n *callers.Node, indent string) {
+	var b strings.Builder
+	b.WriteString(indent + n.Name)
+	if n.Path != "" {
+		fmt.Fprintf(&b, " %s:%d", n.Path, n.Line)
+	}
+	if n.Cycle {
+		b.WriteString(" (cycle)")
+	}
+	if n.Truncated {
+		b.WriteString(" ...")
+	}
+	fmt.Fprintln(w, b.String())
+	for _, c := range n.Callers {
+		writeCallers(w, c, indent+"  ")
+	}
+}
@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/cache"
+	"github.com/bashhack/cdx/internal/gopls"
+	"github.com/bashhack/cdx/internal/outline"
+	"github.com/bashhack/cdx/internal/symbols"
+)
+
+var capabilitiesCmd = &cobra.Command{
+	Use:   "capabilities",
+	Short: "Report what this cdx can do, for integrations",
+	Long: `Report what this cdx can do, for editor plugins and other integrations
+to check once rather than parse --help or try a method and see it fail.
+cdx serve --json-rpc answers cdx/capabilities with the same report.
+
+The JSON output has the version, the schema_version of cdx outline's JSON,
+the methods cdx serve --json-rpc answers, the search backends available,
+the languages supported, plugin languages among them, the symbol parsers
+compiled in, and features, which says whether:
+
+  index        the repository has a current symbol index, so cdx/symbols
+               and completion have names to offer
+  tree_sitter  this cdx was built with tree-sitter (-tags treesitter), so
+               backend_parser can be "tree-sitter"
+  gopls        gopls is installed, so --precise and go_backend can use it
+  cache        the symbol cache is in use, which --no-cache turns off
+
+Examples:
+  cdx capabilities
+  cdx capabilities -o json | jq '.methods'`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{noPagerAnnotation: "true"},
+	RunE:        runCapabilities,
+}
+
+func init() {
+	rootCmd.AddCommand(capabilitiesCmd)
+}
+
+// capabilitiesReport is the JSON representation of cdx capabilities, and
+// cdx/capabilities's result.
+type capabilitiesReport struct {
+	Version       string       `json:"version"`
+	Methods       []string     `json:"methods"`  // cdx serve --json-rpc's, sorted
+	Backends      []string     `json:"backends"` // Available, in auto detection order
+	Languages     []string     `json:"languages"`
+	Parsers       []string     `json:"parsers"` // backend_parser values this build accepts
+	SchemaVersion int          `json:"schema_version"`
+	Features      featureFlags `json:"features"`
+}
+
+// featureFlags are the optional features of capabilitiesReport.
+type featureFlags struct {
+	Index      bool `json:"index"`
+	TreeSitter bool `json:"tree_sitter"`
+	Gopls      bool `json:"gopls"`
+	Cache      bool `json:"cache"`
+}
+
+func runCapabilities(cmd *cobra.Command, args []string) error {
+	report := newServer(cmd).capabilitiesReport()
+	w := cmd.OutOrStdout()
+	if wantJSON() {
+		return writeJSON(w, report)
+	}
+	writeCapabilities(w, report)
+	return nil
+}
+
+// capabilitiesReport returns what the server, and this cdx, can do. The
+// methods are read from the server's handlers, so the report can't list one
+// it doesn't answer.
+func (s *server) capabilitiesReport() capabilitiesReport {
+	version, _, _ := buildInfo()
+	parsers := symbols.Parsers()
+	report := capabilitiesReport{
+		Version:       version,
+		Methods:       slices.Sorted(maps.Keys(s.handlers())),
+		Backends:      availableBackends(),
+		Languages:     languageNames(),
+		Parsers:       parsers,
+		SchemaVersion: outline.SchemaVersion,
+		Features: featureFlags{
+			TreeSitter: slices.Contains(parsers, symbols.ParserTreeSitter),
+			Cache:      !noCache,
+		},
+	}
+	if _, err := gopls.New(""); err == nil {
+		report.Features.Gopls = true
+	}
+	if root, _, err := resolveRoot(s.cmd, s.cfg); err == nil && !noCache {
+		report.Features.Index = cache.Indexed(root.Dir)
+	}
+	return report
+}
+
+// writeCapabilities renders report for a human.
+func writeCapabilities(w io.Writer, report capabilitiesReport) {
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	fmt.Fprintf(w, "version:     %s (schema %d)\n", report.Version, report.SchemaVersion)
+	fmt.Fprintf(w, "methods:     %s\n", strings.Join(report.Methods, " "))
+	fmt.Fprintf(w, "backends:    %s\n", strings.Join(report.Backends, " "))
+	fmt.Fprintf(w, "languages:   %s\n", strings.Join(report.Languages, " "))
+	fmt.Fprintf(w, "parsers:     %s\n", strings.Join(report.Parsers, " "))
+	fmt.Fprintf(w, "index:       %s\n", yesNo(report.Features.Index))
+	fmt.Fprintf(w, "tree-sitter: %s\n", yesNo(report.Features.TreeSitter))
+	fmt.Fprintf(w, "gopls:       %s\n", yesNo(report.Features.Gopls))
+	fmt.Fprintf(w, "cache:       %s\n", yesNo(report.Features.Cache))
+}
@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/check"
+	"github.com/bashhack/cdx/internal/config"
+	"github.com/bashhack/cdx/pkg/cdx"
+)
+
+var (
+	checkRules          string
+	checkBaseline       string
+	checkUpdateBaseline bool
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Fail when code references forbidden symbols",
+	Long: `Fail when code references symbols it shouldn't, such as deprecated APIs,
+for pre-commit hooks and CI.
+
+Each rule names a symbol, or a regex matching whole names, and optionally a
+message saying what to use instead and the paths where references are
+allowed, as gitignore-style patterns relative to the repository root. Rules
+come from the checks setting in .cdx.yaml, or from the checks list of the
+YAML file --rules names:
+
+  checks:
+    - symbol: OldClient
+      message: use NewClient
+      allow: [internal/client/, "*_test.go"]
+    - regex: 'Legacy\w+'
+
+References are found as cdx refs finds them, leaving out the definitions of
+the symbols and mentions in comments and strings. Each one outside its
+rule's allowed paths is a violation, and any violation makes cdx check exit
+with code 1.
+
+--baseline names a file of known violations to let through, so only new ones
+fail: add the file to the repository, and regenerate it with
+--update-baseline as the known ones are fixed. Violations are matched by
+rule, file, and line text, so moving code around doesn't make them new.
+
+Output is one violation per location, or with -o json, a violations array,
+or with -o github, a GitHub Actions error annotation for each.
+
+Examples:
+  cdx check                                      # Check the configured rules
+  cdx check --rules deprecations.yaml            # Check the rules in a file
+  cdx check --baseline .cdx-baseline.json        # Fail only on new violations
+  cdx check --baseline .cdx-baseline.json --update-baseline
+  cdx check -o github                            # Annotate a pull request`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{exitCodesAnnotation: exitCodes(exitCodePartial)},
+	RunE:        runCheck,
+}
+
+func init() {
+	checkCmd.Flags().StringVar(&checkRules, "rules", "", "Read the rules from this YAML file instead of the checks setting")
+	checkCmd.Flags().StringVar(&checkBaseline, "baseline", "", "Let through the violations recorded in this file")
+	checkCmd.Flags().BoolVar(&checkUpdateBaseline, "update-baseline", false, "Record the current violations in the --baseline file")
+	rootCmd.AddCommand(checkCmd)
+}
+
+// checkReport is the JSON representation of cdx check's findings.
+type checkReport struct {
+	Violations []check.Violation `json:"violations"`
+	Count      int               `json:"count"`
+	Baselined  int               `json:"baselined"` // Violations the baseline let through
+}
+
+func runCheck(cmd *cobra.Command, args []string) error {
+	if checkUpdateBaseline && checkBaseline == "" {
+		return errors.New("--update-baseline needs --baseline")
+	}
+	cfg := commandConfig(cmd)
+	list := cfg.Checks
+	if checkRules != "" {
+		var err error
+		if list, err = config.ReadChecks(checkRules); err != nil {
+			return err
+		}
+	}
+	if len(list) == 0 {
+		return errors.New("no rules to check; add checks to .cdx.yaml or pass --rules")
+	}
+	rules, err := check.Compile(list)
+	if err != nil {
+		return err
+	}
+	var baseline check.Baseline
+	if checkBaseline != "" && !checkUpdateBaseline {
+		if baseline, err = check.ReadBaseline(checkBaseline); err != nil {
+			return fmt.Errorf("baseline: %w", err)
+		}
+	}
+
+	roots, base, err := resolveRoots(cmd, cfg)
+	if err != nil {
+		return err
+	}
+	// Paths are relative to the repository root, wherever cdx runs, so a
+	// baseline stays valid
+	if len(roots) == 1 {
+		base = roots[0].Dir
+	}
+	exclude, err := exclusions(cfg)
+	if err != nil {
+		return err
+	}
+	maxFileSize, err := resolveMaxFileSize(cmd, "", cfg)
+	if err != nil {
+		return err
+	}
+	maxLineLength, err := resolveMaxLineLength(cfg)
+	if err != nil {
+		return err
+	}
+	workers, err := resolveJobs(cmd, cfg)
+	if err != nil {
+		return err
+	}
+	langs, err := resolveLangs(cmd, "", cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := searchContext(cmd)
+	defer cancel()
+
+	query := cdx.Query{
+		Exclude:       exclude,
+		MaxFileSize:   maxFileSize,
+		MaxLineLength: maxLineLength,
+		Jobs:          workers,
+	}
+	for _, lang := range langs.Langs {
+		query.Languages = append(query.Languages, cdx.Language(lang))
+	}
+	var violations []check.Violation
+	for _, root := range roots {
+		query.Roots = []string{root.Dir}
+		for i := range rules {
+			found, err := check.Find(ctx, &rules[i], query)
+			if err != nil {
+				// A check that didn't search everything can't pass
+				if interrupted(err) {
+					return partialError(cmd.ErrOrStderr(), err)
+				}
+				return err
+			}
+			for _, v := range found {
+				// Baselines are shared across platforms, so violations keep
+				// forward slashes whatever --slash says
+				v.Path = filepath.ToSlash(root.RelTo(base, v.Path))
+				violations = append(violations, v)
+			}
+		}
+	}
+
+	if checkUpdateBaseline {
+		if err := check.NewBaseline(violations).Write(checkBaseline); err != nil {
+			return fmt.Errorf("baseline: %w", err)
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "recorded %s in %s\n", pluralize(len(violations), "violation"), checkBaseline)
+		return nil
+	}
+	violations, known := baseline.Filter(violations)
+
+	w := cmd.OutOrStdout()
+	switch {
+	case wantJSON():
+		report := checkReport{Violations: violations, Count: len(violations), Baselined: known}
+		if report.Violations == nil {
+			report.Violations = []check.Violation{}
+		}
+		if err := writeJSON(w, report); err != nil {
+			return err
+		}
+	case outputFormat == "github":
+		writeAnnotations(w, violations)
+	default:
+		for _, v := range violations {
+			fmt.Fprintf(w, "%s:%d:%d: %s\n    %s\n", v.Path, v.Line, v.Column, describeViolation(&v), strings.TrimSpace(v.Text))
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	summary := pluralize(len(violations), "violation")
+	if known > 0 {
+		summary += fmt.Sprintf(" (and %d in the baseline)", known)
+	}
+	fmt.Fprintln(cmd.ErrOrStderr(), summary)
+	return ExitError{Code: 1, Err: errors.New(summary)}
+}
+
+// describeViolation says what v uses and, when its rule has a message, what
+// to do instead.
+func describeViolation(v *check.Violation) string {
+	desc := v.Name
+	if v.Rule != v.Name {
+		desc += " (" + v.Rule + ")"
+	}
+	if v.Message == "" {
+		return desc + " isn't allowed here"
+	}
+	return desc + ": " + v.Message
+}
+
+// writeAnnotations prints violations as GitHub Actions workflow commands,
+// which annotate the lines in a pull request.
+func writeAnnotations(w io.Writer, violations []check.Violation) {
+	data := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	property := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	for _, v := range violations {
+		fmt.Fprintf(w, "::error file=%s,line=%d,col=%d,title=%s::%s\n",
+			property.Replace(v.Path), v.Line, v.Column, property.Replace("cdx check: "+v.Rule), data.Replace(describeViolation(&v)))
+	}
+}
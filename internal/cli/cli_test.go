@@ -1,9 +1,39 @@
 package cli
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/cache"
+	"github.com/bashhack/cdx/internal/callers"
+	"github.com/bashhack/cdx/internal/config"
+	"github.com/bashhack/cdx/internal/outline"
+	"github.com/bashhack/cdx/internal/pager"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/refs"
+	"github.com/bashhack/cdx/internal/rpc"
+	"github.com/bashhack/cdx/internal/scan"
+	"github.com/bashhack/cdx/internal/termcolor"
+	"github.com/bashhack/cdx/internal/walk"
+	"github.com/bashhack/cdx/internal/workspace"
 )
 
 func TestVersionCommand(t *testing.T) {
@@ -67,6 +97,64 @@ func TestVersionCommand(t *testing.T) {
 	}
 }
 
+func TestVersionCommand_JSONAndCheck(t *testing.T) {
+	origVersion := Version
+	t.Cleanup(func() { Version, outputFormat, versionCheck = origVersion, "auto", "" })
+	Version = "1.4.2"
+
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"version", "-o", "json"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	var report versionReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Version != "1.4.2" || report.GoVersion != runtime.Version() || report.OS != runtime.GOOS ||
+		report.SchemaVersion != outline.SchemaVersion || !slices.Contains(report.Backends, "native") || !slices.Contains(report.Languages, "go") {
+		t.Errorf("version -o json = %s", stdout)
+	}
+
+	tests := []struct {
+		version    string
+		constraint string
+		wantErr    string
+		wantExit   bool
+	}{
+		{version: "1.4.2", constraint: ">=1.3.0"},
+		{version: "1.4.2", constraint: ">=1.3.0, <2"},
+		{version: "v1.4.2", constraint: "1.4.2"},
+		{version: "1.4.2-rc.1", constraint: ">1.4"},
+		{version: "1.2.9", constraint: ">=1.3.0", wantExit: true},
+		{version: "2.0.0", constraint: ">=1.3.0,<2", wantExit: true},
+		{version: "dev", constraint: ">=0.1", wantExit: true},
+		{version: "1.4.2", constraint: "=>1.3", wantErr: `unknown operator "=>"`},
+		{version: "1.4.2", constraint: ">=one", wantErr: `invalid version "one"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version+" "+tt.constraint, func(t *testing.T) {
+			Version, outputFormat, versionCheck = tt.version, "auto", ""
+			rootCmd.SetArgs([]string{"version", "--check", tt.constraint})
+			err := rootCmd.Execute()
+			var exit ExitError
+			switch {
+			case tt.wantErr != "":
+				if err == nil || errors.As(err, &exit) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+			case tt.wantExit:
+				if !errors.As(err, &exit) || exit.Code != 1 {
+					t.Errorf("Execute() error = %v, want exit code 1", err)
+				}
+			case err != nil:
+				t.Errorf("Execute() error = %v, want the constraint satisfied", err)
+			}
+		})
+	}
+}
+
 func TestRootCommand_Help(t *testing.T) {
 	buf := new(bytes.Buffer)
 	rootCmd.SetOut(buf)
@@ -165,3 +253,3788 @@ func TestRootCommand_HasVersionSubcommand(t *testing.T) {
 		t.Error("root command should have 'version' subcommand")
 	}
 }
+
+func TestCacheClearCommand(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("AppData", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOut(buf)
+	rootCmd.SetErr(buf)
+	rootCmd.SetArgs([]string{"cache", "clear"})
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "Cache cleared") {
+		t.Errorf("output = %q, want confirmation", buf.String())
+	}
+}
+
+func TestFilesCommand(t *testing.T) {
+	tmp := t.TempDir()
+	for name, content := range map[string]string{
+		"main.go":        "package main\n",
+		".cdxignore":     "generated/\n",
+		"generated/x.go": "package generated\n",
+	} {
+		p := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+
+	outputFormat = "auto"
+	filesLang, filesStats = "", false
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(stderr)
+	rootCmd.SetArgs([]string{"files", "--stats"})
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if got := stdout.String(); got != "main.go\n" {
+		t.Errorf("stdout = %q, want %q", got, "main.go\n")
+	}
+	if !strings.Contains(stderr.String(), "excluded: 1 by .cdxignore") {
+		t.Errorf("stderr = %q, want .cdxignore exclusion count", stderr.String())
+	}
+}
+
+func TestFilesCommand_WalkCache(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("AppData", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	for _, name := range []string{"main.go", "pkg/util.go", "pkg/sub/deep.go"} {
+		p := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("package p\n\nvar x = Limit\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Only directories that haven't changed in the last moments are cached
+	past := time.Now().Add(-time.Hour)
+	for _, dir := range []string{"", "pkg", "pkg/sub"} {
+		if err := os.Chtimes(filepath.Join(tmp, dir), past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+
+	tests := []struct {
+		name       string
+		wantStderr string
+		args       []string
+		wantListed bool
+	}{
+		{name: "first walk reads every directory", args: []string{"files", "--stats"}},
+		{name: "second walk reuses them", args: []string{"files", "--stats"}, wantListed: true},
+		{name: "no-cache reads them again", args: []string{"files", "--stats", "--no-cache"}},
+		{name: "refs reuses them too", args: []string{"refs", "--stats", "Limit"}, wantListed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat, filesLang, filesStats, refsLang, refsStats, noCache = "plain", "", false, "", false, false
+			t.Cleanup(func() { filesStats, refsStats, noCache = false, false, false })
+			stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetErr(stderr)
+			t.Cleanup(func() { rootCmd.SetErr(nil) })
+			rootCmd.SetArgs(tt.args)
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if !strings.Contains(stderr.String(), "walk:     ") {
+				t.Errorf("stderr = %q, want the walk time", stderr.String())
+			}
+			listed := strings.Contains(stderr.String(), "(3 directories unchanged since the last walk)")
+			if listed != tt.wantListed {
+				t.Errorf("stderr = %q, want directories reused: %v", stderr.String(), tt.wantListed)
+			}
+		})
+	}
+}
+
+func TestResolveCase(t *testing.T) {
+	tests := []struct {
+		name      string
+		symbol    string
+		wantInMsg string
+		args      []string
+		smartCfg  bool
+		wantFold  bool
+	}{
+		{name: "default is exact", symbol: "httpclient", wantFold: false, wantInMsg: "sensitive"},
+		{name: "smart case lowercase", symbol: "httpclient", args: []string{"--smart-case"}, wantFold: true, wantInMsg: "smart case"},
+		{name: "smart case uppercase", symbol: "HTTPClient", args: []string{"-S"}, wantFold: false, wantInMsg: "smart case"},
+		{name: "smart case from config", symbol: "httpclient", smartCfg: true, wantFold: true},
+		{name: "flag disables config smart case", symbol: "httpclient", smartCfg: true, args: []string{"--smart-case=false"}, wantFold: false},
+		{name: "ignore-case beats smart case", symbol: "HTTPClient", smartCfg: true, args: []string{"-i"}, wantFold: true, wantInMsg: "--ignore-case"},
+		{name: "case-sensitive beats smart case", symbol: "httpclient", smartCfg: true, args: []string{"-s"}, wantFold: false, wantInMsg: "--case-sensitive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var smart, ignore, sensitive bool
+			cmd := &cobra.Command{}
+			cmd.Flags().BoolVarP(&ignore, "ignore-case", "i", false, "")
+			cmd.Flags().BoolVarP(&sensitive, "case-sensitive", "s", false, "")
+			cmd.Flags().BoolVarP(&smart, "smart-case", "S", false, "")
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := config.DefaultConfig()
+			cfg.SmartCase = tt.smartCfg
+
+			fold, mode := resolveCase(cmd, tt.symbol, smart, cfg)
+			if fold != tt.wantFold {
+				t.Errorf("resolveCase() fold = %v, want %v", fold, tt.wantFold)
+			}
+			if !strings.Contains(mode, tt.wantInMsg) {
+				t.Errorf("resolveCase() mode = %q, want it to mention %q", mode, tt.wantInMsg)
+			}
+		})
+	}
+}
+
+func TestOutlineCommand_BOMAndCRLF(t *testing.T) {
+	outputFormat = "json"
+	outlineLang = ""
+	defer func() { outputFormat = "auto" }()
+
+	for _, tt := range []struct {
+		file       string
+		want       string
+		wantColumn string
+	}{
+		// A BOM precedes the definition on line 1 and isn't counted
+		{"settings.py", `"name": "load_settings"`, `"column": 5`},
+		{"format.ts", `"name": "formatPrice"`, `"column": 17`},
+	} {
+		stdout := new(bytes.Buffer)
+		rootCmd.SetOut(stdout)
+		rootCmd.SetArgs([]string{"outline", filepath.Join("..", "..", "testdata", "sample-project", tt.file)})
+
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("outline %s: %v", tt.file, err)
+		}
+		got := stdout.String()
+		if !strings.Contains(got, tt.want) || !strings.Contains(got, `"line": 1,`) || !strings.Contains(got, tt.wantColumn) {
+			t.Errorf("outline %s = %s, want %s on line 1 at %s", tt.file, got, tt.want, tt.wantColumn)
+		}
+	}
+}
+
+func TestUsePrecise(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		args    []string
+		want    bool
+		wantErr bool
+	}{
+		{name: "default", backend: "regex", want: false},
+		{name: "config gopls", backend: "gopls", want: true},
+		{name: "flag enables", backend: "regex", args: []string{"--precise"}, want: true},
+		{name: "flag disables config", backend: "gopls", args: []string{"--precise=false"}, want: false},
+		{name: "invalid config", backend: "clangd", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var precise bool
+			cmd := &cobra.Command{}
+			cmd.Flags().BoolVar(&precise, "precise", false, "")
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := config.DefaultConfig()
+			cfg.GoBackend = tt.backend
+
+			got, err := usePrecise(cmd, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("usePrecise() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("usePrecise() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveJobs(t *testing.T) {
+	auto := scan.Workers(0)
+	tests := []struct {
+		name    string
+		args    []string
+		config  int
+		want    int
+		wantErr bool
+	}{
+		{name: "auto", want: auto},
+		{name: "config", config: 3, want: 3},
+		{name: "flag overrides config", config: 3, args: []string{"--jobs", "8"}, want: 8},
+		{name: "flag zero means auto", config: 3, args: []string{"--jobs", "0"}, want: auto},
+		{name: "negative config", config: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := jobs
+			t.Cleanup(func() { jobs = old })
+			cmd := &cobra.Command{}
+			cmd.Flags().IntVar(&jobs, "jobs", 0, "")
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := config.DefaultConfig()
+			cfg.Jobs = tt.config
+
+			got, err := resolveJobs(cmd, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveJobs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want && !tt.wantErr {
+				t.Errorf("resolveJobs() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyConfigDefaults(t *testing.T) {
+	tests := []struct {
+		sources    map[string]string
+		name       string
+		wantOutput string
+		args       []string
+		wantLines  int
+	}{
+		{name: "unconfigured keeps flag defaults", wantLines: 0, wantOutput: "auto"},
+		{
+			name:       "config supplies defaults",
+			sources:    map[string]string{"context_lines": "/p/.cdx.yaml", "output_format": "CDX_OUTPUT_FORMAT"},
+			wantLines:  5,
+			wantOutput: "json",
+		},
+		{
+			name:       "flags beat config",
+			args:       []string{"-C", "1", "--output", "text"},
+			sources:    map[string]string{"context_lines": "/p/.cdx.yaml", "output_format": "/p/.cdx.yaml"},
+			wantLines:  1,
+			wantOutput: "text",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lines int
+			var output string
+			cmd := &cobra.Command{}
+			cmd.Flags().IntVarP(&lines, "context", "C", 0, "")
+			cmd.Flags().StringVar(&output, "output", "auto", "")
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := config.DefaultConfig()
+			cfg.ContextLines = 5
+			cfg.OutputFormat = "json"
+			cfg.Sources = tt.sources
+
+			if err := applyConfigDefaults(cmd, cfg); err != nil {
+				t.Fatalf("applyConfigDefaults() error = %v", err)
+			}
+			if lines != tt.wantLines || output != tt.wantOutput {
+				t.Errorf("context = %d, output = %q, want %d, %q", lines, output, tt.wantLines, tt.wantOutput)
+			}
+			if cmd.Flags().Changed("context") != (len(tt.args) > 0) {
+				t.Error("applying a config default marked the flag as set")
+			}
+		})
+	}
+}
+
+func TestTimeoutAndPagerPrecedence(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		envPager    string
+		wantPager   pager.Mode
+		args        []string
+		wantTimeout time.Duration
+	}{
+		{name: "defaults", wantTimeout: defaultSearchTimeout, wantPager: pager.Auto},
+		{name: "config", config: "timeout: 45s\npager: never\n", wantTimeout: 45 * time.Second, wantPager: pager.Never},
+		{
+			name:        "environment beats config",
+			config:      "timeout: 45s\npager: never\n",
+			envPager:    "always",
+			wantTimeout: 45 * time.Second,
+			wantPager:   pager.Always,
+		},
+		{
+			name:        "flags beat both",
+			config:      "timeout: 45s\npager: never\n",
+			envPager:    "always",
+			args:        []string{"--timeout", "0", "--pager", "auto"},
+			wantTimeout: 0,
+			wantPager:   pager.Auto,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("HOME", tmp)
+			t.Setenv("XDG_CONFIG_HOME", tmp)
+			t.Setenv("AppData", tmp)
+			t.Setenv("CDX_USE_PAGER", tt.envPager)
+			t.Chdir(tmp)
+			if tt.config != "" {
+				if err := os.WriteFile(".cdx.yaml", []byte(tt.config), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var timeout time.Duration
+			mode := pager.Auto
+			cmd := &cobra.Command{}
+			cmd.Flags().DurationVar(&timeout, "timeout", defaultSearchTimeout, "")
+			cmd.Flags().Var(&mode, "pager", "")
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := config.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := applyConfigDefaults(cmd, cfg); err != nil {
+				t.Fatalf("applyConfigDefaults() error = %v", err)
+			}
+			if timeout != tt.wantTimeout || mode != tt.wantPager {
+				t.Errorf("timeout = %v, pager = %q, want %v, %q", timeout, mode, tt.wantTimeout, tt.wantPager)
+			}
+		})
+	}
+}
+
+func TestOutlineCommand(t *testing.T) {
+	tmp := t.TempDir()
+	src := "package user\n\ntype User struct{}\n\nfunc (u *User) Name() string { return \"\" }\n"
+	if err := os.WriteFile(filepath.Join(tmp, "user.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+
+	outputFormat = "auto"
+	outlineLang = ""
+
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"outline", "user.go"})
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	want := "3:6\t◆ type      User\n5:16\t  ƒ method    Name\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+
+	stdout.Reset()
+	rootCmd.SetArgs([]string{"outline", "user.go", "-o", "json"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	var doc struct {
+		File    string `json:"file"`
+		Symbols []struct {
+			Name     string `json:"name"`
+			Kind     string `json:"kind"`
+			Children []struct {
+				Name   string `json:"name"`
+				Parent string `json:"parent"`
+			} `json:"children"`
+		} `json:"symbols"`
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	tree := doc.Symbols
+	if doc.File != "user.go" || doc.SchemaVersion != outline.SchemaVersion || len(tree) != 1 || tree[0].Kind != outline.KindStruct ||
+		len(tree[0].Children) != 1 || tree[0].Children[0].Parent != "User" {
+		t.Errorf("JSON = %s, want Name as a child of the struct User", stdout)
+	}
+	outputFormat = "auto"
+}
+
+func TestOutlineCommand_Ranges(t *testing.T) {
+	tmp := t.TempDir()
+	src := "package user\n\nfunc Load(id int) error {\n\treturn nil\n}\n\nconst Max = 3\n"
+	if err := os.WriteFile(filepath.Join(tmp, "user.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	outputFormat, outlineLang = "auto", ""
+
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"outline", "user.go"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	want := "3:6\tƒ function  Load (3–5)\n7:7\t≡ const     Max\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+
+	stdout.Reset()
+	rootCmd.SetArgs([]string{"outline", "user.go", "-o", "json"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	outputFormat = "auto"
+	var doc struct {
+		Symbols []struct {
+			EndLine int `json:"end_line"`
+			Lines   int `json:"lines"`
+		} `json:"symbols"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	tree := doc.Symbols
+	if len(tree) != 2 || tree[0].EndLine != 5 || tree[0].Lines != 3 || tree[1].Lines != 1 {
+		t.Errorf("JSON = %s, want Load spanning lines 3-5 and Max line 7", stdout)
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(tmp, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".git/HEAD", "")
+	write(".cdx.yaml", "checks:\n  - symbol: OldClient\n    message: use NewClient\n    allow: [client/]\n")
+	write("client/client.go", "package client\n\nfunc OldClient() {}\n\nfunc wrap() { OldClient() }\n")
+	write("api/api.go", "package api\n\nfunc run() {\n\tOldClient()\n}\n")
+	write("rules.yaml", "checks:\n  - regex: 'Old\\w+'\n")
+	t.Chdir(filepath.Join(tmp, "api"))
+	t.Cleanup(func() {
+		outputFormat, checkRules, checkBaseline, checkUpdateBaseline = "auto", "", "", false
+		rootCmd.SetErr(nil)
+	})
+
+	run := func(args ...string) (string, string, error) {
+		t.Helper()
+		outputFormat, checkRules, checkBaseline, checkUpdateBaseline = "auto", "", "", false
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		rootCmd.SetOut(stdout)
+		rootCmd.SetErr(stderr)
+		rootCmd.SetArgs(append([]string{"check"}, args...))
+		err := rootCmd.Execute()
+		return stdout.String(), stderr.String(), err
+	}
+	wantExit := func(err error, code int) {
+		t.Helper()
+		var exit ExitError
+		if code == 0 && err != nil || code != 0 && (!errors.As(err, &exit) || exit.Code != code) {
+			t.Fatalf("Execute() error = %v, want exit code %d", err, code)
+		}
+	}
+
+	// Paths are relative to the repository root, not the api directory
+	stdout, stderr, err := run()
+	wantExit(err, 1)
+	if want := "api/api.go:4:2: OldClient: use NewClient\n    OldClient()\n"; stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+	if stderr != "1 violation\n" {
+		t.Errorf("stderr = %q, want the count", stderr)
+	}
+
+	stdout, _, err = run("-o", "github")
+	wantExit(err, 1)
+	if want := "::error file=api/api.go,line=4,col=2,title=cdx check%3A OldClient::OldClient: use NewClient\n"; stdout != want {
+		t.Errorf("github stdout = %q, want %q", stdout, want)
+	}
+
+	// The rules file replaces the config's, and allows nothing
+	stdout, _, err = run("--rules", "../rules.yaml", "-o", "json")
+	wantExit(err, 1)
+	var report checkReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Count != 2 || report.Violations[0].Path != "api/api.go" || report.Violations[1].Path != "client/client.go" {
+		t.Errorf("JSON = %s, want violations in api.go and client.go", stdout)
+	}
+
+	_, stderr, err = run("--baseline", "../baseline.json", "--update-baseline")
+	wantExit(err, 0)
+	if stderr != "recorded 1 violation in ../baseline.json\n" {
+		t.Errorf("stderr = %q, want the violations recorded", stderr)
+	}
+	stdout, _, err = run("--baseline", "../baseline.json")
+	wantExit(err, 0)
+	if stdout != "" {
+		t.Errorf("stdout = %q, want the known violation let through", stdout)
+	}
+
+	write("api/new.go", "package api\n\nvar c = OldClient\n")
+	stdout, stderr, err = run("--baseline", "../baseline.json")
+	wantExit(err, 1)
+	if !strings.HasPrefix(stdout, "api/new.go:3:9:") || stderr != "1 violation (and 1 in the baseline)\n" {
+		t.Errorf("stdout = %q, stderr = %q, want only the new violation", stdout, stderr)
+	}
+
+	_, _, err = run("--update-baseline")
+	if err == nil || !strings.Contains(err.Error(), "--update-baseline needs --baseline") {
+		t.Errorf("Execute() error = %v, want --baseline required", err)
+	}
+}
+
+func TestOutlineCommand_CustomPatterns(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	files := map[string]string{
+		".cdx.yaml": `custom_patterns:
+  - regex: '^registerTask\("(\w+)"'
+    kind: task
+    lang: ts
+  - regex: '^DEFINE_METRIC\((\w+),'
+    kind: metric
+    extensions: [.tsx]
+`,
+		"tasks.ts":    "registerTask(\"nightly\")\nDEFINE_METRIC(requests, counter)\n\nfunction run() {}\n",
+		"metrics.tsx": "DEFINE_METRIC(requests, counter)\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { patterns.SetCustom(nil) })
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		// The metric pattern is limited to .tsx files
+		{file: "tasks.ts", want: "1:15\t• task      nightly\n4:10\tƒ function  run\n"},
+		{file: "metrics.tsx", want: "1:15\t• metric    requests\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			outputFormat, outlineLang = "auto", ""
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs([]string{"outline", tt.file})
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutlineCommand_PublicOnly(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	t.Setenv("NO_COLOR", "")
+	src := "package user\n\ntype store struct{}\n\nfunc (s *store) Get() {}\n\nfunc (s *store) load() {}\n\nfunc helper() {}\n\nfunc New() *store { return nil }\n"
+	if err := os.WriteFile(filepath.Join(tmp, "user.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { outlinePublicOnly, colorFlag = false, termcolor.Auto })
+
+	tests := []struct {
+		name string
+		want string
+		args []string
+	}{
+		{
+			name: "private parent kept for its public method",
+			args: []string{"outline", "user.go", "--public-only"},
+			want: "3:6\t◆ type      store\n5:17\t  ƒ method    Get\n11:6\tƒ function  New\n",
+		},
+		{
+			name: "private parent dimmed",
+			args: []string{"outline", "user.go", "--public-only", "--color", "always"},
+			want: ansiDim + "3:6\t◆ type      store" + ansiReset + "\n5:17\t  ƒ method    Get\n11:6\tƒ function  New\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat, outlineLang, colorFlag, noColor = "auto", "", termcolor.Auto, false
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutlineCommand_SortAndFilter(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	t.Setenv("NO_COLOR", "")
+	src := "package user\n\nconst Max = 3\n\ntype store struct{}\n\nfunc (s *store) Put() {}\n\n" +
+		"func (s *store) Get() {\n\tload()\n\tload()\n}\n\nfunc (s *store) load() {\n\tload()\n}\n\n" +
+		"func Open() *store {\n\treturn nil\n}\n\nfunc close() {}\n"
+	if err := os.WriteFile(filepath.Join(tmp, "user.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	reset := func() {
+		outputFormat, outlineLang, colorFlag, noColor = "auto", "", termcolor.Auto, false
+		outlineSort, outlineKinds, outlineMinLines, outlinePublicOnly = outline.ByLine, nil, 0, false
+	}
+	t.Cleanup(reset)
+
+	tests := []struct {
+		name    string
+		want    string
+		args    []string
+		wantErr bool
+	}{
+		{
+			name: "sort by name keeps methods under their type",
+			args: []string{"outline", "user.go", "--sort", "name"},
+			want: "22:6\tƒ function  close\n3:7\t≡ const     Max\n18:6\tƒ function  Open (18–20)\n5:6\t◆ type      store\n" +
+				"9:17\t  ƒ method    Get (9–12)\n14:17\t  ƒ method    load (14–16)\n7:17\t  ƒ method    Put\n",
+		},
+		{
+			name: "sort by kind",
+			args: []string{"outline", "user.go", "--sort", "kind"},
+			want: "5:6\t◆ type      store\n7:17\t  ƒ method    Put\n9:17\t  ƒ method    Get (9–12)\n14:17\t  ƒ method    load (14–16)\n" +
+				"18:6\tƒ function  Open (18–20)\n22:6\tƒ function  close\n3:7\t≡ const     Max\n",
+		},
+		{
+			name: "kinds",
+			args: []string{"outline", "user.go", "--kind", "function,const"},
+			want: "3:7\t≡ const     Max\n18:6\tƒ function  Open (18–20)\n22:6\tƒ function  close\n",
+		},
+		{
+			name: "min lines",
+			args: []string{"outline", "user.go", "--min-lines", "3"},
+			want: "5:6\t◆ type      store\n9:17\t  ƒ method    Get (9–12)\n14:17\t  ƒ method    load (14–16)\n18:6\tƒ function  Open (18–20)\n",
+		},
+		{
+			name: "public methods by name",
+			args: []string{"outline", "user.go", "--sort", "name", "--kind", "method", "--public-only"},
+			want: "5:6\t◆ type      store\n9:17\t  ƒ method    Get (9–12)\n7:17\t  ƒ method    Put\n",
+		},
+		{
+			name: "type kept for its members is dimmed",
+			args: []string{"outline", "user.go", "--kind", "method", "--min-lines", "4", "--color", "always"},
+			want: ansiDim + "5:6\t◆ type      store" + ansiReset + "\n9:17\t  ƒ method    Get (9–12)\n",
+		},
+		{
+			name:    "unknown order",
+			args:    []string{"outline", "user.go", "--sort", "size"},
+			wantErr: true,
+		},
+		{
+			name:    "negative min lines",
+			args:    []string{"outline", "user.go", "--min-lines", "-1"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+
+			err := rootCmd.Execute()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := stdout.String(); !tt.wantErr && got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutlineCommand_Stdin(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	// A byte order mark and CRLFs, which a file would have removed too
+	src := "\ufeffexport class Cart {\r\n  add(item: Item) {\r\n    return 1;\r\n  }\r\n}\r\n"
+	if err := os.WriteFile(filepath.Join(tmp, "cart.ts"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	reset := func() {
+		outputFormat, outlineLang, outlineFilename = "auto", "", ""
+		outlineSort, outlineKinds, outlineMinLines, outlinePublicOnly = outline.ByLine, nil, 0, false
+		rootCmd.SetIn(nil)
+	}
+	t.Cleanup(reset)
+
+	run := func(input string, args ...string) (outline.Document, error) {
+		reset()
+		stdout := new(bytes.Buffer)
+		rootCmd.SetOut(stdout)
+		rootCmd.SetIn(strings.NewReader(input))
+		rootCmd.SetArgs(append(args, "-o", "json"))
+		var doc outline.Document
+		if err := rootCmd.Execute(); err != nil {
+			return doc, err
+		}
+		err := json.Unmarshal(stdout.Bytes(), &doc)
+		return doc, err
+	}
+
+	fromFile, err := run("", "outline", "cart.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromStdin, err := run(src, "outline", "-", "--lang", "ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromStdin.File != "<stdin>" || fromStdin.Language != patterns.TypeScript {
+		t.Errorf("stdin document is %s in %s, want <stdin> in typescript", fromStdin.File, fromStdin.Language)
+	}
+	if !reflect.DeepEqual(fromStdin.Symbols, fromFile.Symbols) {
+		t.Errorf("stdin symbols = %+v, want the file's %+v", fromStdin.Symbols, fromFile.Symbols)
+	}
+
+	// --filename names the input and supplies its language
+	named, err := run(src, "outline", "-", "--filename", "src/cart.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if named.File != "src/cart.ts" || !reflect.DeepEqual(named.Symbols, fromFile.Symbols) {
+		t.Errorf("--filename document = %+v, want the file's symbols as src/cart.ts", named)
+	}
+
+	errTests := []struct {
+		name    string
+		env     string
+		wantErr string
+		args    []string
+	}{
+		{name: "no language", args: []string{"outline", "-"}, wantErr: "cannot detect the language of stdin (use --lang)"},
+		{name: "filename without stdin", args: []string{"outline", "cart.ts", "--filename", "x.ts"}, wantErr: "--filename applies only when reading stdin (-)"},
+		{name: "too large", env: "64", args: []string{"outline", "-", "--lang", "ts"}, wantErr: "stdin is larger than max_stdin_size (64)"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("CDX_MAX_STDIN_SIZE", tt.env)
+			}
+			_, err := run(strings.Repeat(src, 2), tt.args...)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Execute() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOutlineCommand_Docs(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	t.Setenv("NO_COLOR", "")
+	src := "package user\n\n// User is a person\n// with an account. It has a name.\ntype User struct{}\n\nfunc helper() {}\n"
+	if err := os.WriteFile(filepath.Join(tmp, "user.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { outlineDocs, colorFlag = false, termcolor.Auto })
+
+	tests := []struct {
+		name string
+		want string
+		args []string
+	}{
+		{
+			name: "without --docs",
+			args: []string{"outline", "user.go"},
+			want: "5:6\t◆ type      User\n7:6\tƒ function  helper\n",
+		},
+		{
+			name: "summaries",
+			args: []string{"outline", "user.go", "--docs"},
+			want: "5:6\t◆ type      User  is a person with an account.\n7:6\tƒ function  helper\n",
+		},
+		{
+			name: "dimmed",
+			args: []string{"outline", "user.go", "--docs", "--color", "always"},
+			want: "5:6\t◆ type      User  " + ansiDim + "is a person with an account." + ansiReset + "\n7:6\tƒ function  helper\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat, outlineLang, outlineDocs, colorFlag, noColor = "auto", "", false, termcolor.Auto, false
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutlineCommand_Metrics(t *testing.T) {
+	tmp := t.TempDir()
+	src := "package user\n\nfunc small() {}\n\nfunc big(xs []int) {\n\tfor _, x := range xs {\n\t\tif x > 0 {\n\t\t\tprintln(x)\n\t\t}\n\t}\n}\n"
+	if err := os.WriteFile(filepath.Join(tmp, "user.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	reset := func() {
+		outputFormat, outlineLang, outlineMetrics, outlineSort = "auto", "", false, outline.ByLine
+	}
+	t.Cleanup(reset)
+
+	tests := []struct {
+		name string
+		want string
+		args []string
+	}{
+		{
+			name: "suffix",
+			args: []string{"outline", "user.go", "--metrics"},
+			want: "3:6\tƒ function  small [1 line, depth 0, 0 branches]\n5:6\tƒ function  big (5–11) [7 lines, depth 2, 2 branches]\n",
+		},
+		{
+			name: "biggest first without the suffix",
+			args: []string{"outline", "user.go", "--sort", "metric:lines"},
+			want: "5:6\tƒ function  big (5–11)\n3:6\tƒ function  small\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	reset()
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"outline", "user.go", "--metrics", "-o", "json"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	var doc outline.Document
+	if err := json.Unmarshal(stdout.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	want := outline.Metrics{Lines: 7, Depth: 2, Branches: 2}
+	if len(doc.Symbols) != 2 || doc.Symbols[1].Metrics != want {
+		t.Errorf("JSON = %s, want big with metrics %+v", stdout, want)
+	}
+}
+
+func TestOutlineCommand_Diff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	write := func(name, src string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitCmd := func(args ...string) {
+		t.Helper()
+		args = append([]string{"-C", tmp, "-c", "user.name=cdx", "-c", "user.email=cdx@example.com"}, args...)
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	gitCmd("init", "-q")
+	write("store.go", "package store\n\ntype Store struct{}\n\nfunc (s *Store) Get() {}\n\nfunc (s *Store) load() {}\n")
+	write("blob.go", "package store\x00\n")
+	gitCmd("add", "-A")
+	gitCmd("commit", "-q", "-m", "v1")
+	write("store.go", "package store\n\ntype Store struct{}\n\nfunc (s *Store) Get() {\n\treturn\n}\n\nfunc Open() *Store { return nil }\n")
+	write("blob.go", "package store\n\nfunc Blob() {}\n")
+	write("new.go", "package store\n\nfunc New() {}\n")
+	t.Chdir(tmp)
+	t.Cleanup(func() { outlineDiff = "" })
+
+	tests := []struct {
+		name       string
+		want       string
+		wantStderr string
+		args       []string
+		wantErr    bool
+	}{
+		{
+			name: "added, removed, and changed",
+			args: []string{"outline", "store.go", "--diff", "HEAD"},
+			want: "added:\n  function    Open  9\nremoved:\n  method      Store.load  7\nchanged:\n  method      Store.Get  5 → 5–7\n",
+		},
+		{
+			name: "public only",
+			args: []string{"outline", "store.go", "--diff", "HEAD", "--public-only"},
+			want: "added:\n  function    Open  9\nremoved:\n  (none)\nchanged:\n  method      Store.Get  5 → 5–7\n",
+		},
+		{
+			name: "new file",
+			args: []string{"outline", "new.go", "--diff", "HEAD"},
+			want: "added:\n  function    New  3\nremoved:\n  (none)\nchanged:\n  (none)\n",
+		},
+		{
+			name:       "binary old version",
+			args:       []string{"outline", "blob.go", "--diff", "HEAD"},
+			want:       "added:\n  function    Blob  3\nremoved:\n  (none)\nchanged:\n  (none)\n",
+			wantStderr: "warning: blob.go is binary as of HEAD; treating every definition as added\n",
+		},
+		{
+			name:    "unknown revision",
+			args:    []string{"outline", "store.go", "--diff", "v9"},
+			wantErr: true,
+		},
+		{
+			name:    "stdin",
+			args:    []string{"outline", "-", "--lang", "go", "--diff", "HEAD"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat, outlineLang, outlineDiff, outlinePublicOnly = "auto", "", "", false
+			stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetErr(stderr)
+			t.Cleanup(func() { rootCmd.SetErr(nil) })
+			rootCmd.SetArgs(tt.args)
+
+			err := rootCmd.Execute()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+			if got := stderr.String(); got != tt.wantStderr {
+				t.Errorf("stderr = %q, want %q", got, tt.wantStderr)
+			}
+		})
+	}
+
+	// JSON has the three arrays, empty ones included
+	outputFormat, outlinePublicOnly = "json", false
+	t.Cleanup(func() { outputFormat = "auto" })
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"outline", "new.go", "--diff", "HEAD"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	var changes outline.Changes
+	if err := json.Unmarshal(stdout.Bytes(), &changes); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Added) != 1 || changes.Removed == nil || changes.Changed == nil {
+		t.Errorf("JSON = %s, want New added and empty removed and changed arrays", stdout)
+	}
+}
+
+func TestOutlineCommand_Rev(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	write := func(name, src string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitCmd := func(args ...string) {
+		t.Helper()
+		args = append([]string{"-C", tmp, "-c", "user.name=cdx", "-c", "user.email=cdx@example.com"}, args...)
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	gitCmd("init", "-q")
+	write("store.go", "package store\n\nfunc Load() {}\n")
+	write("blob.go", "package store\x00\n")
+	gitCmd("add", "-A")
+	gitCmd("commit", "-q", "-m", "v1")
+	gitCmd("tag", "v1")
+	write("store.go", "package store\n\nfunc Open() {}\n")
+	write("new.go", "package store\n\nfunc New() {}\n")
+	t.Chdir(tmp)
+	// cobra remembers which of the mutually exclusive flags were set
+	reset := func() {
+		outputFormat, outlineRev, outlineDiff, pickFlag = "json", "", "", false
+		for _, name := range []string{"rev", "diff", "pick"} {
+			outlineCmd.Flags().Lookup(name).Changed = false
+		}
+	}
+	t.Cleanup(func() {
+		reset()
+		outputFormat = "auto"
+	})
+
+	tests := []struct {
+		name     string
+		wantFile string
+		wantErr  string
+		args     []string
+		want     []string
+	}{
+		{
+			name:     "committed version",
+			args:     []string{"outline", "store.go", "--rev", "v1"},
+			wantFile: "store.go@v1",
+			want:     []string{"Load"},
+		},
+		{
+			name:    "not in revision",
+			args:    []string{"outline", "new.go", "--rev", "v1"},
+			wantErr: "new.go as of v1",
+		},
+		{
+			name:    "binary",
+			args:    []string{"outline", "blob.go", "--rev", "v1"},
+			wantErr: "blob.go is binary as of v1",
+		},
+		{
+			name:    "unknown revision",
+			args:    []string{"outline", "store.go", "--rev", "v9"},
+			wantErr: "--rev:",
+		},
+		{
+			name:    "stdin",
+			args:    []string{"outline", "-", "--lang", "go", "--rev", "v1"},
+			wantErr: "--rev needs a file",
+		},
+		{
+			name:    "pick",
+			args:    []string{"outline", "store.go", "--rev", "v1", "--pick"},
+			wantErr: "--pick needs a file to open",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+
+			err := rootCmd.Execute()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			var doc outline.Document
+			if err := json.Unmarshal(stdout.Bytes(), &doc); err != nil {
+				t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+			}
+			var names []string
+			for _, e := range doc.Symbols {
+				names = append(names, e.Name)
+			}
+			if doc.File != tt.wantFile || !slices.Equal(names, tt.want) {
+				t.Errorf("outline = %s with %v, want %s with %v", doc.File, names, tt.wantFile, tt.want)
+			}
+		})
+	}
+}
+
+func TestPick(t *testing.T) {
+	tmp := t.TempDir()
+	src := "package user\n\ntype User struct{}\n\nfunc (u *User) Name() string { return \"\" }\n"
+	if err := os.WriteFile(filepath.Join(tmp, "user.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	lookFzf = func() (string, error) { return "", exec.ErrNotFound }
+	t.Cleanup(func() {
+		lookFzf = func() (string, error) { return exec.LookPath("fzf") }
+		outputFormat, pickFlag = "auto", false
+		rootCmd.SetIn(nil)
+		rootCmd.SetErr(nil)
+	})
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr string
+		args    []string
+	}{
+		{
+			name: "fzf lines",
+			args: []string{"outline", "user.go", "-o", "fzf"},
+			want: "user.go\t3\ttype\tUser\ttype User struct\nuser.go\t5\tmethod\tName\tfunc (u *User) Name() string { return \"\" }\n",
+		},
+		{
+			name:  "numbered pick",
+			args:  []string{"outline", "user.go", "--pick"},
+			input: "2\n",
+			want:  "user.go:5:16\n",
+		},
+		{
+			name:  "asks again after a bad answer",
+			args:  []string{"outline", "user.go", "--pick"},
+			input: "9\n1\n",
+			want:  "user.go:3:6\n",
+		},
+		{
+			name:    "empty answer picks nothing",
+			args:    []string{"outline", "user.go", "--pick"},
+			input:   "\n",
+			wantErr: "nothing picked",
+		},
+		{
+			name:    "not from stdin",
+			args:    []string{"outline", "-", "--pick"},
+			wantErr: "--pick needs a file",
+		},
+		{
+			name:    "def has no fzf output",
+			args:    []string{"def", "User", "-o", "fzf"},
+			wantErr: "def doesn't support -o fzf",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat, pickFlag = "auto", false
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetErr(new(bytes.Buffer))
+			rootCmd.SetIn(strings.NewReader(tt.input))
+			rootCmd.SetArgs(tt.args)
+
+			err := rootCmd.Execute()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSymbolsCommand(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("AppData", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	if err := os.Mkdir(filepath.Join(tmp, ".git"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { symbolsComplete, symbolsLimit = "", completeLimit })
+
+	run := func(args ...string) string {
+		t.Helper()
+		symbolsComplete, symbolsLimit = "", completeLimit
+		stdout := new(bytes.Buffer)
+		rootCmd.SetOut(stdout)
+		rootCmd.SetArgs(args)
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("Execute(%v) error = %v", args, err)
+		}
+		return stdout.String()
+	}
+
+	if got := run("symbols", "--complete", "Get"); got != "" {
+		t.Errorf("without an index, stdout = %q, want nothing", got)
+	}
+
+	path := filepath.Join(tmp, "user.go")
+	if err := os.WriteFile(path, []byte("package user\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cache.Open(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(path, info, []cache.Symbol{{Name: "GetUser", Kind: "function"}, {Name: "GetOrder", Kind: "function"}, {Name: "User", Kind: "type"}})
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := run("symbols", "--complete", "Get"), "GetOrder\tfunction\nGetUser\tfunction\n"; got != want {
+		t.Errorf("symbols --complete Get = %q, want %q", got, want)
+	}
+	if got, want := run("symbols", "--complete", "Get", "--limit", "1"), "GetOrder\tfunction\n"; got != want {
+		t.Errorf("symbols --complete Get --limit 1 = %q, want %q", got, want)
+	}
+	if got := run(cobra.ShellCompRequestCmd, "refs", "Us"); !strings.HasPrefix(got, "User\ttype\n") {
+		t.Errorf("completing refs Us = %q, want User first", got)
+	}
+
+	// outline and refs add the definitions they find to the index
+	files := map[string]string{
+		"order.go": "package user\n\nfunc PlaceOrder() {}\n",
+		"cart.go":  "package user\n\nfunc checkout() { PlaceOrder() }\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("outline", "order.go")
+	if got, want := run("symbols", "--complete", "Place"), "PlaceOrder\tfunction\n"; got != want {
+		t.Errorf("after outline, symbols --complete Place = %q, want %q", got, want)
+	}
+	run("refs", "PlaceOrder")
+	if got, want := run("symbols", "--complete", "check"), "checkout\tfunction\n"; got != want {
+		t.Errorf("after refs, symbols --complete check = %q, want %q", got, want)
+	}
+}
+
+func TestDefSuggest(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("AppData", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(tmp, "user.go")
+	if err := os.WriteFile(path, []byte("package user\n\nfunc GetUserByID() {}\n\nfunc getUser() {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	roots := []workspace.Root{{Dir: tmp}}
+	t.Cleanup(func() { noCache = false })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := defSuggest(ctx, "getUserById", roots, walk.Options{}); len(got) != 0 {
+		t.Errorf("defSuggest() after ctx is done = %q, want none", got)
+	}
+	// Without an index, the files are scanned
+	if got, want := defSuggest(context.Background(), "getUserById", roots, walk.Options{}), []string{"GetUserByID"}; !slices.Equal(got, want) {
+		t.Errorf("defSuggest() from a scan = %q, want %q", got, want)
+	}
+
+	// A cached file whose lines no longer hold its names is scanned again
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cache.Open(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(path, info, []cache.Symbol{{Name: "GetUserByIDs", Kind: "function", Line: 3}})
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := cache.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexes, err := filepath.Glob(filepath.Join(dir, "*", "names.txt"))
+	if err != nil || len(indexes) != 1 {
+		t.Fatalf("names.txt = %v, %v, want one", indexes, err)
+	}
+	if err := os.Remove(indexes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := defSuggest(context.Background(), "getUserById", roots, walk.Options{}), []string{"GetUserByID"}; !slices.Equal(got, want) {
+		t.Errorf("defSuggest() from a stale cache = %q, want %q", got, want)
+	}
+
+	// With an index, it answers, even for names the files no longer hold
+	c, err = cache.Open(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(path, info, []cache.Symbol{{Name: "GetUserByIDs", Kind: "function"}})
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := defSuggest(context.Background(), "getUserById", roots, walk.Options{}), []string{"GetUserByIDs"}; !slices.Equal(got, want) {
+		t.Errorf("defSuggest() from the index = %q, want %q", got, want)
+	}
+	noCache = true
+	if got, want := defSuggest(context.Background(), "getUserById", roots, walk.Options{}), []string{"GetUserByID"}; !slices.Equal(got, want) {
+		t.Errorf("defSuggest() with --no-cache = %q, want %q", got, want)
+	}
+}
+
+func TestServeCommand(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("AppData", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	if err := os.Mkdir(filepath.Join(tmp, ".git"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	// The functions are in the cache too, which outlining the file
+	// then refreshes
+	src := "package limits\n\n// MaxUsers caps sign-ups.\nconst MaxUsers = 10\n\nfunc full(n int) bool { return n >= MaxUsers }\n\nfunc GetUser() {}\n\nfunc GetOrder() {}\n"
+	path := filepath.Join(tmp, "limits.go")
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cache.Open(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(path, info, []cache.Symbol{{Name: "GetUser", Kind: "function"}, {Name: "GetOrder", Kind: "function"}, {Name: "User", Kind: "type"}})
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	interval := progressInterval
+	progressInterval = 0
+	t.Cleanup(func() { progressInterval = interval; rootCmd.SetIn(nil) })
+
+	requests := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"cdx/references","params":{"symbol":"MaxUsers","no_comments":true}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"cdx/references","params":{"symbol":"MaxUsers","lang":"cobol"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"cdx/references","params":{"symbol":"MinUsers"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"cdx/outline","params":{"file":"limits.go"}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"cdx/outline","params":{"file":"buffer.py","content":"def run():\n    pass\n"}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"cdx/symbols","params":{"complete":"Get"}}`,
+		`{"jsonrpc":"2.0","id":7,"method":"cdx/symbols","params":{"prefix":"Get"}}`,
+		`{"jsonrpc":"2.0","id":8,"method":"cdx/stats"}`,
+	}
+	stdout := new(bytes.Buffer)
+	rootCmd.SetIn(strings.NewReader(strings.Join(requests, "\n") + "\n"))
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"serve", "--json-rpc"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	results := make(map[int]string)
+	errs := make(map[int]string)
+	var progress []string
+	for line := range strings.Lines(stdout.String()) {
+		var msg struct {
+			Error *struct {
+				Message string `json:"message"`
+				Code    int    `json:"code"`
+			} `json:"error"`
+			Method string          `json:"method"`
+			Result json.RawMessage `json:"result"`
+			Params json.RawMessage `json:"params"`
+			ID     int             `json:"id"`
+		}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("stdout line %q: %v", line, err)
+		}
+		switch {
+		case msg.Method != "":
+			progress = append(progress, msg.Method+" "+string(msg.Params))
+		case msg.Error != nil:
+			errs[msg.ID] = fmt.Sprintf("%d %s", msg.Error.Code, msg.Error.Message)
+		default:
+			results[msg.ID] = string(msg.Result)
+		}
+	}
+
+	var report refsReport
+	if err := json.Unmarshal([]byte(results[1]), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Refs) != 1 || report.Refs[0].Line != 6 || len(report.Definitions) != 1 || report.Files != 1 {
+		t.Errorf("cdx/references MaxUsers = %s, want one reference on line 6 and one definition", results[1])
+	}
+	// Requests run concurrently, so their notifications interleave
+	slices.Sort(progress)
+	if want := []string{`$/progress {"id":1,"files":1,"total":1}`, `$/progress {"id":3,"files":1,"total":1}`}; !slices.Equal(progress, want) {
+		t.Errorf("notifications = %q, want %q", progress, want)
+	}
+	if got, want := results[3], `{"refs":[],"definitions":[],"files":1,"partial":false}`; got != want {
+		t.Errorf("cdx/references MinUsers = %s, want %s", got, want)
+	}
+
+	var doc outline.Document
+	if err := json.Unmarshal([]byte(results[4]), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.File != "limits.go" || doc.Language != patterns.Go || len(doc.Symbols) != 4 || doc.Symbols[0].Name != "MaxUsers" {
+		t.Errorf("cdx/outline limits.go = %s, want MaxUsers, full, GetUser, and GetOrder", results[4])
+	}
+	if err := json.Unmarshal([]byte(results[5]), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.File != "buffer.py" || doc.Language != patterns.Python || len(doc.Symbols) != 1 || doc.Symbols[0].Name != "run" {
+		t.Errorf("cdx/outline with content = %s, want run", results[5])
+	}
+
+	if got, want := results[6], `{"symbols":[{"name":"GetOrder","kind":"function"},{"name":"GetUser","kind":"function"}]}`; got != want {
+		t.Errorf("cdx/symbols Get = %s, want %s", got, want)
+	}
+
+	// The references requests may not have run yet
+	var stats statsReport
+	if err := json.Unmarshal([]byte(results[8]), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if got := stats.DefinitionPatterns; got.Size != patterns.DefaultDefinitionCacheSize || got.Entries > 2 || got.Hits+got.Misses < got.Entries {
+		t.Errorf("cdx/stats = %s, want at most the two symbols searched cached", results[8])
+	}
+
+	wantErrs := map[int]string{
+		2: `-32602 lang: unknown language "cobol"`,
+		7: `-32602 invalid params: json: unknown field "prefix"`,
+	}
+	if !reflect.DeepEqual(errs, wantErrs) {
+		t.Errorf("errors = %q, want %q", errs, wantErrs)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("AppData", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	if err := os.Mkdir(filepath.Join(tmp, ".git"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(tmp, "user.go")
+	if err := os.WriteFile(path, []byte("package user\n\ntype User struct{}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cache.Open(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(path, info, []cache.Symbol{{Name: "User", Kind: "type", Line: 3}})
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { outputFormat = "auto"; rootCmd.SetIn(nil) })
+
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"capabilities", "-o", "json"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	var report capabilitiesReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.SchemaVersion != outline.SchemaVersion || !slices.Contains(report.Backends, "native") || !slices.Contains(report.Languages, "go") ||
+		!slices.Contains(report.Parsers, "regex") || !report.Features.Index || !report.Features.Cache {
+		t.Errorf("capabilities -o json = %s", stdout)
+	}
+
+	// Every method listed is answered, and cdx/capabilities says the same
+	var requests []string
+	for i, method := range report.Methods {
+		requests = append(requests, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q}`, i+1, method))
+	}
+	stdout.Reset()
+	rootCmd.SetIn(strings.NewReader(strings.Join(requests, "\n") + "\n"))
+	rootCmd.SetArgs([]string{"serve", "--json-rpc"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	answered := 0
+	for line := range strings.Lines(stdout.String()) {
+		var msg struct {
+			Error *struct {
+				Code int `json:"code"`
+			} `json:"error"`
+			Result json.RawMessage `json:"result"`
+			ID     int             `json:"id"`
+		}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil || msg.ID == 0 {
+			continue
+		}
+		answered++
+		method := report.Methods[msg.ID-1]
+		if msg.Error != nil && msg.Error.Code == rpc.CodeMethodNotFound {
+			t.Errorf("%s is listed but not answered", method)
+		}
+		if method != "cdx/capabilities" {
+			continue
+		}
+		var served capabilitiesReport
+		if err := json.Unmarshal(msg.Result, &served); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(served, report) {
+			t.Errorf("cdx/capabilities = %s, want what cdx capabilities reports", msg.Result)
+		}
+	}
+	if answered != len(report.Methods) || !slices.Contains(report.Methods, "cdx/capabilities") {
+		t.Errorf("%d of methods %q answered", answered, report.Methods)
+	}
+}
+
+func TestBatchCommand(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("AppData", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	if err := os.Mkdir(filepath.Join(tmp, ".git"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"limits.go": "package limits\n\n// MaxUsers caps sign-ups.\nconst MaxUsers = 10\n\nfunc full(n int) bool { return n >= MaxUsers }\n",
+		"limits.py": "MAX = MaxUsers\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { batchParallel = 1; rootCmd.SetIn(nil) })
+
+	queries := strings.Join([]string{
+		`{"id": 1, "cmd": "refs", "symbol": "MaxUsers", "no_comments": true}`,
+		`{"id": "py", "cmd": "refs", "symbol": "MaxUsers", "lang": "py"}`,
+		``,
+		`{"id": 3, "cmd": "outline", "file": "limits.go"}`,
+		`{"id": 4, "cmd": "refs", "symbol": "MaxUsers", "max": 1}`,
+		`{"id": 5, "cmd": "grep", "symbol": "MaxUsers"}`,
+		`{"cmd": "refs", "symbol": "MaxUsers"}`,
+		`{"id": 7, "cmd": "refs"`,
+	}, "\n")
+
+	tests := []struct {
+		parallel string
+		want     []string
+	}{
+		{parallel: "1", want: []string{
+			`1 refs limits.go:6 limits.py:1`,
+			`"py" refs limits.py:1`,
+			`3 outline MaxUsers full`,
+			`4 error: invalid params: json: unknown field "max"`,
+			`5 error: cmd: unknown command "grep" (want def, refs, or outline)`,
+			`null line 7 error: id: missing`,
+			`null line 8 error: invalid query: unexpected end of JSON input`,
+		}},
+		{parallel: "4"},
+	}
+	var sequential []string
+	for _, tt := range tests {
+		batchParallel = 1
+		stdout := new(bytes.Buffer)
+		rootCmd.SetIn(strings.NewReader(queries))
+		rootCmd.SetOut(stdout)
+		rootCmd.SetArgs([]string{"batch", "--parallel", tt.parallel})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("batch --parallel %s: %v", tt.parallel, err)
+		}
+
+		var got []string
+		for line := range strings.Lines(stdout.String()) {
+			var r struct {
+				Error *struct {
+					Message string `json:"message"`
+				} `json:"error"`
+				Result struct {
+					Refs    []refs.Ref      `json:"refs"`
+					Symbols []outline.Entry `json:"symbols"`
+				} `json:"result"`
+				ID   json.RawMessage `json:"id"`
+				Line int             `json:"line"`
+			}
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				t.Fatalf("stdout line %q: %v", line, err)
+			}
+			desc := string(r.ID)
+			if r.Line > 0 {
+				desc += fmt.Sprintf(" line %d", r.Line)
+			}
+			switch {
+			case r.Error != nil:
+				desc += " error: " + r.Error.Message
+			case r.Result.Symbols != nil:
+				desc += " outline"
+				for _, s := range r.Result.Symbols {
+					desc += " " + s.Name
+				}
+			default:
+				desc += " refs"
+				for _, ref := range r.Result.Refs {
+					desc += fmt.Sprintf(" %s:%d", ref.Path, ref.Line)
+				}
+			}
+			got = append(got, desc)
+		}
+		if tt.want != nil {
+			sequential = got
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("batch --parallel %s =\n%s\nwant\n%s", tt.parallel, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			continue
+		}
+		// In parallel, the answers are the same in any order
+		slices.Sort(got)
+		want := slices.Sorted(slices.Values(sequential))
+		if !slices.Equal(got, want) {
+			t.Errorf("batch --parallel %s = %q, want %q in any order", tt.parallel, got, want)
+		}
+	}
+}
+
+func TestRefsCommand(t *testing.T) {
+	tmp := t.TempDir()
+	src := "package limits\n\n// MaxUsers caps sign-ups.\nconst MaxUsers = 10\n\nfunc full(n int) bool { return n >= MaxUsers }\n"
+	if err := os.WriteFile(filepath.Join(tmp, "limits.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { refsCount, refsMaxResults = false, 0 })
+
+	tests := []struct {
+		name string
+		want string
+		args []string
+	}{
+		{
+			name: "definitions first, comments sort last",
+			args: []string{"refs", "MaxUsers"},
+			want: "definitions:\nlimits.go:4:7: const MaxUsers = 10\nreferences:\n" +
+				"full (limits.go)\n  limits.go:6:37: [other] func full(n int) bool { return n >= MaxUsers }\nlimits.go\n  limits.go:3:4: [other] // MaxUsers caps sign-ups.\n",
+		},
+		{
+			name: "no comments",
+			args: []string{"refs", "MaxUsers", "--no-comments"},
+			want: "definitions:\nlimits.go:4:7: const MaxUsers = 10\nreferences:\n" +
+				"full (limits.go)\n  limits.go:6:37: [other] func full(n int) bool { return n >= MaxUsers }\n",
+		},
+		{
+			name: "plain leaves out definitions",
+			args: []string{"refs", "MaxUsers", "-o", "plain"},
+			want: "limits.go:6:37: func full(n int) bool { return n >= MaxUsers }\nlimits.go:3:4: // MaxUsers caps sign-ups.\n",
+		},
+		{
+			name: "plain caps in walk order",
+			args: []string{"refs", "MaxUsers", "-o", "plain", "--max-results", "1"},
+			want: "limits.go:3:4: // MaxUsers caps sign-ups.\n",
+		},
+		{
+			name: "count excludes definitions",
+			args: []string{"refs", "MaxUsers", "--count"},
+			want: "2\n",
+		},
+		{
+			name: "fzf",
+			args: []string{"refs", "MaxUsers", "-o", "fzf"},
+			want: "limits.go\t4\tdefinition\tMaxUsers\tconst MaxUsers = 10\n" +
+				"limits.go\t3\tother\tMaxUsers\t// MaxUsers caps sign-ups.\n" +
+				"limits.go\t6\tother\tMaxUsers\tfunc full(n int) bool { return n >= MaxUsers }\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat = "auto"
+			refsLang, refsNoComments, refsNoStrings, refsIgnoreCase, refsCount = "", false, false, false, false
+			refsMaxResults = 0
+
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefsCommand_Case(t *testing.T) {
+	tmp := t.TempDir()
+	src := "package limits\n\nvar maxUsers = 1\n\nconst MaxUsers = 10\n\nfunc full(n int) bool { return n >= MaxUsers+maxUsers }\n"
+	if err := os.WriteFile(filepath.Join(tmp, "limits.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	// cobra remembers which of the mutually exclusive flags were set
+	reset := func() {
+		outputFormat, refsCount, refsStats = "auto", false, false
+		refsIgnoreCase, refsCaseSensitive, refsSmartCase = false, false, false
+		for _, name := range []string{"ignore-case", "case-sensitive", "smart-case", "count", "stats"} {
+			refsCmd.Flags().Lookup(name).Changed = false
+		}
+	}
+	t.Cleanup(reset)
+
+	tests := []struct {
+		name       string
+		want       string
+		wantStderr string
+		wantErr    string
+		args       []string
+	}{
+		{name: "sensitive by default", args: []string{"refs", "maxUsers", "--count"}, want: "1\n"},
+		{name: "ignore case", args: []string{"refs", "maxUsers", "-i", "--count"}, want: "2\n"},
+		{name: "smart case folds lowercase", args: []string{"refs", "maxusers", "-S", "--count"}, want: "2\n"},
+		{name: "smart case keeps uppercase", args: []string{"refs", "maxUsers", "--smart-case", "--count"}, want: "1\n"},
+		{name: "case-sensitive beats smart case", args: []string{"refs", "maxusers", "-S", "-s", "--count"}, wantErr: "no references"},
+		{name: "exclusive", args: []string{"refs", "maxUsers", "-i", "-s"}, wantErr: "none of the others can be"},
+		{
+			name:       "stats echo the mode",
+			args:       []string{"refs", "maxusers", "-S", "--count", "--stats"},
+			want:       "2\n",
+			wantStderr: "case:     insensitive (smart case: query is all lowercase)\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+			stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetErr(stderr)
+			t.Cleanup(func() { rootCmd.SetErr(nil) })
+			rootCmd.SetArgs(tt.args)
+
+			err := rootCmd.Execute()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Execute() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestRefsCommand_Archive(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	var tarball bytes.Buffer
+	gz := gzip.NewWriter(&tarball)
+	tw := tar.NewWriter(gz)
+	src := "package limits\n\nconst MaxUsers = 10\n\nfunc full(n int) bool { return n >= MaxUsers }\n"
+	if err := tw.WriteHeader(&tar.Header{Name: "limits/limits.go", Mode: 0o644, Size: int64(len(src)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "v1.tgz"), tarball.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// A file in the working directory that --archive leaves out
+	if err := os.WriteFile(filepath.Join(tmp, "main.go"), []byte("package main\n\nvar MaxUsers = 3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	// cobra remembers which of the mutually exclusive flags were set
+	reset := func() {
+		outputFormat, refsArchives, refsCount, refsByFile = "auto", nil, false, false
+		for _, name := range []string{"archive", "count", "count-by-file"} {
+			refsCmd.Flags().Lookup(name).Changed = false
+		}
+	}
+	t.Cleanup(reset)
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr string
+		args    []string
+	}{
+		{
+			name: "human",
+			args: []string{"refs", "MaxUsers", "--archive", "v1.tgz"},
+			want: "definitions:\nv1.tgz::limits/limits.go:3:7: const MaxUsers = 10\nreferences:\n" +
+				"full (v1.tgz::limits/limits.go)\n  v1.tgz::limits/limits.go:5:37: [other] func full(n int) bool { return n >= MaxUsers }\n",
+		},
+		{
+			name: "count by file",
+			args: []string{"refs", "MaxUsers", "--archive", "v1.tgz", "--count-by-file"},
+			want: "1 v1.tgz::limits/limits.go\n1 total\n",
+		},
+		{
+			name:    "directory",
+			args:    []string{"refs", "MaxUsers", "--archive", "."},
+			wantErr: "--archive: . is a directory",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+			err := rootCmd.Execute()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	reset()
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"refs", "MaxUsers", "--archive", "v1.tgz", "-o", "json"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	var report refsReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+	}
+	if len(report.Refs) != 1 || report.Refs[0].Archive != "v1.tgz" || report.Refs[0].Path != "v1.tgz::limits/limits.go" {
+		t.Errorf("refs = %+v, want one in v1.tgz::limits/limits.go with archive v1.tgz", report.Refs)
+	}
+}
+
+func TestRefsCommand_Rev(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	t.Setenv("NO_COLOR", "")
+	write := func(name, src string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(tmp, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitCmd := func(args ...string) {
+		t.Helper()
+		args = append([]string{"-C", tmp, "-c", "user.name=cdx", "-c", "user.email=cdx@example.com"}, args...)
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	gitCmd("init", "-q")
+	write("limits/limits.go", "package limits\n\nconst MaxUsers = 10\n\nfunc full(n int) bool { return n >= MaxUsers }\n")
+	gitCmd("add", "-A")
+	gitCmd("commit", "-q", "-m", "v1")
+	gitCmd("tag", "v1")
+	// Changes since v1 that --rev doesn't see
+	write("limits/limits.go", "package limits\n\nconst MaxUsers = 10\n")
+	write("main.go", "package main\n\nvar _ = limits.MaxUsers\n")
+	t.Chdir(tmp)
+	// cobra remembers which of the mutually exclusive flags were set
+	reset := func() {
+		outputFormat, refsRev, refsArchives, refsByFile = "auto", "", nil, false
+		for _, name := range []string{"rev", "archive", "count-by-file"} {
+			refsCmd.Flags().Lookup(name).Changed = false
+		}
+	}
+	t.Cleanup(reset)
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr string
+		args    []string
+	}{
+		{
+			name: "human",
+			args: []string{"refs", "MaxUsers", "--rev", "v1"},
+			want: "definitions:\nlimits/limits.go@v1:3:7: const MaxUsers = 10\nreferences:\n" +
+				"full (limits/limits.go@v1)\n  limits/limits.go@v1:5:37: [other] func full(n int) bool { return n >= MaxUsers }\n",
+		},
+		{
+			name: "count by file",
+			args: []string{"refs", "MaxUsers", "--rev", "v1", "--count-by-file"},
+			want: "1 limits/limits.go@v1\n1 total\n",
+		},
+		{
+			name:    "unknown revision",
+			args:    []string{"refs", "MaxUsers", "--rev", "v9"},
+			wantErr: "--rev:",
+		},
+		{
+			name:    "archive",
+			args:    []string{"refs", "MaxUsers", "--rev", "v1", "--archive", "v1.tgz"},
+			wantErr: "none of the others can be",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+			err := rootCmd.Execute()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	reset()
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"refs", "MaxUsers", "--rev", "v1", "-o", "json"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	var report refsReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+	}
+	if len(report.Refs) != 1 || report.Refs[0].Rev != "v1" || report.Refs[0].Path != "limits/limits.go@v1" {
+		t.Errorf("refs = %+v, want one in limits/limits.go@v1 with rev v1", report.Refs)
+	}
+}
+
+func TestRefsCommand_RefKind(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	t.Setenv("NO_COLOR", "")
+	src := "package app\n\ntype User struct{}\n\nfunc load() *User {\n\treturn &User{}\n}\n\nvar _ = load\n"
+	if err := os.WriteFile(filepath.Join(tmp, "user.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { refsKinds, colorFlag = nil, termcolor.Auto })
+
+	tests := []struct {
+		name    string
+		want    string
+		args    []string
+		wantErr bool
+	}{
+		{
+			name: "tagged",
+			args: []string{"refs", "User"},
+			want: "definitions:\nuser.go:3:6: type User struct{}\nreferences:\n" +
+				"load (user.go)\n  user.go:5:14: [type] func load() *User {\n  user.go:6:10: [construct] return &User{}\n",
+		},
+		{
+			name: "colored tags",
+			args: []string{"refs", "User", "--color", "always"},
+			want: "definitions:\nuser.go:3:6: type User struct{}\nreferences:\n" +
+				"load (user.go)\n  user.go:5:14: " + ansiMagenta + "[type]" + ansiReset + " func load() *User {\n" +
+				"  user.go:6:10: " + ansiGreen + "[construct]" + ansiReset + " return &User{}\n",
+		},
+		{
+			name: "filtered",
+			args: []string{"refs", "User", "--ref-kind", "construct"},
+			want: "definitions:\nuser.go:3:6: type User struct{}\nreferences:\nload (user.go)\n  user.go:6:10: [construct] return &User{}\n",
+		},
+		{
+			name: "plain is untagged",
+			args: []string{"refs", "User", "--ref-kind", "type,construct", "-o", "plain"},
+			want: "user.go:5:14: func load() *User {\nuser.go:6:10: return &User{}\n",
+		},
+		{
+			name:    "unknown kind",
+			args:    []string{"refs", "User", "--ref-kind", "usage"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat, colorFlag, noColor = "auto", termcolor.Auto, false
+			refsLang, refsNoComments, refsNoStrings, refsIgnoreCase = "", false, false, false
+			refsKinds = nil
+
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+
+			err := rootCmd.Execute()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := stdout.String(); !tt.wantErr && got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefsCommand_Containers(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	t.Setenv("NO_COLOR", "")
+	files := map[string]string{
+		"grep.go": "package search\n\nfunc (g *GrepSearcher) Close() error { return nil }\n",
+		"tags.go": "package search\n\nfunc (t TagSearcher) Close() error { return nil }\n\nfunc closeAll() { Close() }\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+
+	outputFormat, colorFlag, noColor = "auto", termcolor.Auto, false
+	refsLang, refsNoComments, refsNoStrings, refsIgnoreCase = "", false, false, false
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"refs", "Close"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	want := "definitions:\n" +
+		"grep.go:3:24: [(*GrepSearcher).Close] func (g *GrepSearcher) Close() error { return nil }\n" +
+		"tags.go:3:22: [(TagSearcher).Close] func (t TagSearcher) Close() error { return nil }\n" +
+		"references:\ncloseAll (tags.go)\n  tags.go:5:19: [call] func closeAll() { Close() }\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+
+	stdout.Reset()
+	rootCmd.SetArgs([]string{"refs", "Close", "-o", "json"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	var report struct {
+		Definitions []struct {
+			Container string `json:"container"`
+			Receiver  string `json:"receiver"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Definitions) != 2 || report.Definitions[0].Container != "GrepSearcher" || report.Definitions[0].Receiver != "*GrepSearcher" {
+		t.Errorf("definitions = %+v, want GrepSearcher's Close first", report.Definitions)
+	}
+}
+
+func TestRefsCommand_Enclosing(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	src := "package store\n\nfunc (s *Store) Get(id int) *Item {\n\treturn load(id)\n}\n\nfunc warm() {\n\tload(1)\n\tload(2)\n}\n\nvar fallback = load(0)\n"
+	if err := os.WriteFile(filepath.Join(tmp, "store.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	outputFormat = "auto"
+	refsLang, refsNoComments, refsNoStrings, refsIgnoreCase = "", false, false, false
+
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"refs", "load"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	want := "Get (store.go)\n  store.go:4:9: [call] return load(id)\n" +
+		"warm (store.go)\n  store.go:8:2: [call] load(1)\n  store.go:9:2: [call] load(2)\n" +
+		"store.go\n  store.go:12:16: [call] var fallback = load(0)\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+
+	stdout.Reset()
+	rootCmd.SetArgs([]string{"refs", "load", "-o", "json"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	var report struct {
+		Refs []struct {
+			Enclosing *refs.Enclosing `json:"enclosing"`
+		} `json:"refs"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Refs) != 4 {
+		t.Fatalf("got %d refs, want 4", len(report.Refs))
+	}
+	if got, want := report.Refs[0].Enclosing, (&refs.Enclosing{Name: "Get", Kind: "method", Line: 3}); !reflect.DeepEqual(got, want) {
+		t.Errorf("enclosing = %+v, want %+v", got, want)
+	}
+	if got := report.Refs[3].Enclosing; got != nil {
+		t.Errorf("top-level enclosing = %+v, want none", got)
+	}
+}
+
+func TestCallersCommand(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	src := "package store\n\nfunc (s *Store) Get(id int) *Item {\n\treturn load(id)\n}\n\n" +
+		"func warm(n int) {\n\tload(n)\n\twarm(n - 1)\n}\n\nfunc serve() {\n\ts.Get(1)\n}\n"
+	if err := os.WriteFile(filepath.Join(tmp, "store.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	outputFormat = "auto"
+	t.Cleanup(func() {
+		callersDepth, callersMaxNodes = 1, callers.DefaultMaxNodes
+		callersCmd.Flags().Lookup("depth").Changed = false
+		callersCmd.Flags().Lookup("max-nodes").Changed = false
+	})
+
+	tests := []struct {
+		name string
+		want string
+		args []string
+	}{
+		{"direct callers", "load\n  Get store.go:4 ...\n  warm store.go:8 ...\n", nil},
+		{
+			"depth",
+			"load\n  Get store.go:4\n    serve store.go:13\n  warm store.go:8\n    warm store.go:9 (cycle)\n",
+			[]string{"--depth", "3"},
+		},
+		{"node cap", "load\n  Get store.go:4 ...\n  warm store.go:8 ...\n", []string{"--depth", "3", "--max-nodes", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(append([]string{"callers", "load"}, tt.args...))
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"callers", "load", "--depth", "2", "--max-nodes", "200", "-o", "json"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	var report callersReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if !report.Truncated || len(report.Tree.Callers) != 2 || !report.Tree.Callers[0].Callers[0].Truncated {
+		t.Errorf("report = %s, want serve truncated at depth 2", stdout)
+	}
+	if got := report.Tree.Callers[1].Callers[0]; !got.Cycle || got.Truncated {
+		t.Errorf("warm's caller = %+v, want a cycle", got)
+	}
+
+	rootCmd.SetErr(new(bytes.Buffer))
+	rootCmd.SetArgs([]string{"callers", "nothing"})
+	var exit ExitError
+	if err := rootCmd.Execute(); !errors.As(err, &exit) || exit.Code != 3 {
+		t.Errorf("Execute() error = %v, want exit code 3", err)
+	}
+}
+
+func TestRefsCommand_Strings(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	files := map[string]string{
+		"order.go": "package shop\n\ntype Order struct {\n\tID int `json:\"order_id\"`\n}\n\n" +
+			"func place(order_id int) {\n\temit(\"order.created\", order_id)\n}\n",
+		"order.ts": "bus.on('order.created', onCreated);\nbus.on('suborder.created', onSub);\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+	// --strings and --no-strings are mutually exclusive, and cobra
+	// remembers which earlier tests set
+	reset := func() {
+		refsInStrings, refsNoStrings = false, false
+		refsCmd.Flags().Lookup("strings").Changed = false
+		refsCmd.Flags().Lookup("no-strings").Changed = false
+	}
+	t.Cleanup(reset)
+
+	tests := []struct {
+		name     string
+		want     string
+		args     []string
+		wantCode int
+	}{
+		{
+			name: "event name",
+			args: []string{"refs", "--strings", "order.created"},
+			want: "references (go):\nplace (order.go)\n  order.go:8:8: emit(\"order.created\", order_id)\n" +
+				"references (ts):\norder.ts\n  order.ts:1:9: bus.on('order.created', onCreated);\n",
+		},
+		{
+			name: "struct tag, not the parameter",
+			args: []string{"refs", "--strings", "order_id", "-o", "plain"},
+			want: "order.go:4:16: ID int `json:\"order_id\"`\n",
+		},
+		{
+			name:     "not found",
+			args:     []string{"refs", "--strings", "order.deleted"},
+			wantCode: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat = "auto"
+			refsLang, refsNoComments, refsIgnoreCase = "", false, false
+			reset()
+
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetErr(new(bytes.Buffer))
+			t.Cleanup(func() { rootCmd.SetErr(nil) })
+			rootCmd.SetArgs(tt.args)
+
+			err := rootCmd.Execute()
+			var exit ExitError
+			switch {
+			case tt.wantCode != 0 && (!errors.As(err, &exit) || exit.Code != tt.wantCode):
+				t.Fatalf("Execute() error = %v, want exit code %d", err, tt.wantCode)
+			case tt.wantCode == 0 && err != nil:
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("json gives the literal", func(t *testing.T) {
+		outputFormat = "auto"
+		reset()
+		stdout := new(bytes.Buffer)
+		rootCmd.SetOut(stdout)
+		rootCmd.SetArgs([]string{"refs", "--strings", "order_id", "-o", "json"})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		var report struct {
+			Refs []refs.Ref `json:"refs"`
+		}
+		if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Refs) != 1 || report.Refs[0].Literal != "`json:\"order_id\"`" || report.Refs[0].Enclosing.Name != "Order" {
+			t.Errorf("refs = %+v, want the struct tag in Order", report.Refs)
+		}
+	})
+}
+
+func TestRefsCommand_Languages(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	files := map[string]string{
+		"api/order.go": "package api\n\n// OrderItem is one line of an order.\ntype OrderItem struct{}\n\nvar items []OrderItem\n",
+		"web/order.ts": "export interface OrderItem {}\nconst a = $OrderItem;\nconst b: OrderItem[] = [];\n",
+		"web/order.js": "const c = new OrderItem();\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+
+	tests := []struct {
+		name string
+		want string
+		args []string
+	}{
+		{
+			name: "grouped by language",
+			args: []string{"refs", "OrderItem"},
+			want: "definitions:\napi/order.go:4:6: type OrderItem struct{}\nweb/order.ts:1:18: export interface OrderItem {}\n" +
+				"references (go):\napi/order.go\n  api/order.go:6:13: [type] var items []OrderItem\napi/order.go\n  api/order.go:3:4: [other] // OrderItem is one line of an order.\n" +
+				"references (js):\nweb/order.js\n  web/order.js:1:15: [construct] const c = new OrderItem();\n" +
+				"references (ts):\nweb/order.ts\n  web/order.ts:3:10: [type] const b: OrderItem[] = [];\n",
+		},
+		{
+			name: "plain isn't grouped",
+			args: []string{"refs", "OrderItem", "--no-comments", "-o", "plain"},
+			want: "api/order.go:6:13: var items []OrderItem\nweb/order.js:1:15: const c = new OrderItem();\nweb/order.ts:3:10: const b: OrderItem[] = [];\n",
+		},
+		{
+			name: "lang narrows",
+			args: []string{"refs", "OrderItem", "--lang", "ts"},
+			want: "definitions:\nweb/order.ts:1:18: export interface OrderItem {}\nreferences:\nweb/order.ts\n  web/order.ts:3:10: [type] const b: OrderItem[] = [];\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat = "auto"
+			refsLang, refsNoComments, refsNoStrings, refsIgnoreCase = "", false, false, false
+
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefsCommand_TestFiles(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	files := map[string]string{
+		"src/order.ts":           "export const o = parseOrder(raw);\n",
+		"src/__tests__/order.ts": "test(() => parseOrder(raw));\n",
+		"src/order.stories.ts":   "story(parseOrder(raw));\n",
+		"e2e/checkout.ts":        "go(() => parseOrder(raw));\n",
+		".cdx.yaml":              "include_tests: false\ntest_paths: [e2e/]\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+	// The flags are mutually exclusive, and cobra remembers which were set
+	// by earlier cases
+	reset := func() {
+		refsTestsOnly, refsCodeOnly, refsAll = false, false, false
+		for _, name := range []string{"tests-only", "code-only", "all"} {
+			refsCmd.Flags().Lookup(name).Changed = false
+		}
+	}
+	t.Cleanup(reset)
+
+	tests := []struct {
+		name    string
+		want    string
+		args    []string
+		wantErr bool
+	}{
+		{
+			name: "config leaves tests out",
+			args: []string{"refs", "parseOrder", "-o", "plain"},
+			want: "src/order.ts:1:18: export const o = parseOrder(raw);\n",
+		},
+		{
+			name: "all overrides the config",
+			args: []string{"refs", "parseOrder", "--all", "-o", "plain"},
+			want: "e2e/checkout.ts:1:10: go(() => parseOrder(raw));\nsrc/__tests__/order.ts:1:12: test(() => parseOrder(raw));\nsrc/order.stories.ts:1:7: story(parseOrder(raw));\nsrc/order.ts:1:18: export const o = parseOrder(raw);\n",
+		},
+		{
+			name: "tests only",
+			args: []string{"refs", "parseOrder", "--tests-only", "-o", "plain"},
+			want: "e2e/checkout.ts:1:10: go(() => parseOrder(raw));\nsrc/__tests__/order.ts:1:12: test(() => parseOrder(raw));\nsrc/order.stories.ts:1:7: story(parseOrder(raw));\n",
+		},
+		{
+			name: "code only",
+			args: []string{"refs", "parseOrder", "--code-only", "-o", "plain"},
+			want: "src/order.ts:1:18: export const o = parseOrder(raw);\n",
+		},
+		{
+			name:    "mutually exclusive",
+			args:    []string{"refs", "parseOrder", "--tests-only", "--code-only"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat = "auto"
+			refsLang, refsNoComments, refsNoStrings, refsIgnoreCase = "", false, false, false
+			reset()
+
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+
+			err := rootCmd.Execute()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := stdout.String(); !tt.wantErr && got != filepath.FromSlash(tt.want) {
+				t.Errorf("stdout = %q, want %q", got, filepath.FromSlash(tt.want))
+			}
+		})
+	}
+
+	t.Run("json marks test files", func(t *testing.T) {
+		outputFormat = "auto"
+		reset()
+		stdout := new(bytes.Buffer)
+		rootCmd.SetOut(stdout)
+		rootCmd.SetArgs([]string{"refs", "parseOrder", "--all", "-o", "json"})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		var report struct {
+			Refs []struct {
+				Path   string `json:"path"`
+				IsTest bool   `json:"is_test"`
+			} `json:"refs"`
+		}
+		if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]bool)
+		for _, r := range report.Refs {
+			got[r.Path] = r.IsTest
+		}
+		want := map[string]bool{
+			filepath.Join("e2e", "checkout.ts"):           true,
+			filepath.Join("src", "__tests__", "order.ts"): true,
+			filepath.Join("src", "order.stories.ts"):      true,
+			filepath.Join("src", "order.ts"):              false,
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("is_test = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestWarnUnreadable(t *testing.T) {
+	gone := refs.ReadError{Err: fs.ErrNotExist, Path: "gone.go"}
+	locked := refs.ReadError{Err: fs.ErrPermission, Path: "locked.go"}
+	tests := []struct {
+		name       string
+		want       string
+		unreadable []refs.ReadError
+	}{
+		{"none", "", nil},
+		{"one", "warning: skipped gone.go: file does not exist\n", []refs.ReadError{gone}},
+		{"several", "warning: skipped 2 unreadable files, such as gone.go: file does not exist\n", []refs.ReadError{gone, locked}},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		warnUnreadable(&b, tt.unreadable)
+		if b.String() != tt.want {
+			t.Errorf("%s: warnUnreadable() wrote %q, want %q", tt.name, b.String(), tt.want)
+		}
+	}
+}
+
+func TestRefsCommand_Generated(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	files := map[string]string{
+		"order.go":    "package m\n\nfunc f() { ParseOrder() }\n",
+		"order.pb.go": "package m\n\nfunc g() { ParseOrder() }\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { refsGenerated, refsStats = false, false })
+
+	tests := []struct {
+		name, want, wantErr string
+		args                []string
+	}{
+		{
+			name:    "left out by default",
+			args:    []string{"refs", "ParseOrder", "--stats", "-o", "plain"},
+			want:    "order.go:3:12: func f() { ParseOrder() }\n",
+			wantErr: "skipped:  1 generated (search them with --generated)\n",
+		},
+		{
+			name: "generated includes them",
+			args: []string{"refs", "ParseOrder", "--generated", "-o", "plain"},
+			want: "order.go:3:12: func f() { ParseOrder() }\norder.pb.go:3:12: func g() { ParseOrder() }\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat = "auto"
+			refsLang, refsNoComments, refsNoStrings, refsIgnoreCase = "", false, false, false
+			refsGenerated, refsStats = false, false
+
+			stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetErr(stderr)
+			rootCmd.SetArgs(tt.args)
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+			if !strings.Contains(stderr.String(), tt.wantErr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRefsCommand_CountByFile(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	files := map[string]string{
+		"log.go":     "package app\n\ntype Logger struct{}\n\nfunc New() *Logger { return &Logger{} }\n",
+		"main.go":    "package app\n\nvar l Logger\nvar m Logger\nvar n Logger\n",
+		"handler.go": "package app\n\nvar h Logger\n",
+		"other.go":   "package app\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+	// The flags are mutually exclusive, and cobra remembers which were set
+	// by earlier tests
+	reset := func() {
+		refsCount, refsByFile, refsMin = false, false, 0
+		for _, name := range []string{"count", "count-by-file", "min"} {
+			refsCmd.Flags().Lookup(name).Changed = false
+		}
+	}
+	t.Cleanup(reset)
+
+	tests := []struct {
+		name    string
+		want    string
+		args    []string
+		wantErr bool
+	}{
+		{
+			name: "most first, then the total",
+			args: []string{"refs", "Logger", "--count-by-file"},
+			want: "3 main.go\n2 log.go\n1 handler.go\n6 total\n",
+		},
+		{
+			name: "min hides small files but not from the total",
+			args: []string{"refs", "Logger", "--count-by-file", "--min", "2"},
+			want: "3 main.go\n2 log.go\n6 total\n",
+		},
+		{
+			name: "json",
+			args: []string{"refs", "Logger", "--count-by-file", "--min", "3", "-o", "json"},
+			want: "{\n  \"files\": [\n    {\n      \"file\": \"main.go\",\n      \"language\": \"go\",\n      \"count\": 3,\n      \"is_test\": false\n    }\n  ],\n" +
+				"  \"count\": 6,\n  \"partial\": false\n}\n",
+		},
+		{
+			name:    "min needs count-by-file",
+			args:    []string{"refs", "Logger", "--min", "2"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat = "auto"
+			refsLang, refsNoComments, refsNoStrings, refsIgnoreCase = "", false, false, false
+			reset()
+
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+
+			err := rootCmd.Execute()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := stdout.String(); !tt.wantErr && got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefsCommand_RepoRoot(t *testing.T) {
+	tmp := t.TempDir()
+	files := map[string]string{
+		"go.mod":                 "module example.com/app\n",
+		"limits/limits.go":       "package limits\n\nconst MaxUsers = 10\n",
+		"services/auth/login.go": "package auth\n\nvar cap = limits.MaxUsers\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(filepath.Join(tmp, "services", "auth"))
+	t.Cleanup(func() { cwdOnly = false })
+
+	tests := []struct {
+		name string
+		want string
+		args []string
+	}{
+		{
+			name: "whole repository, paths relative to cwd",
+			args: []string{"refs", "MaxUsers"},
+			want: "definitions:\n../../limits/limits.go:3:7: const MaxUsers = 10\nreferences:\nlogin.go\n  login.go:3:18: [other] var cap = limits.MaxUsers\n",
+		},
+		{
+			name: "cwd only",
+			args: []string{"refs", "MaxUsers", "--cwd-only"},
+			want: "login.go\n  login.go:3:18: [other] var cap = limits.MaxUsers\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat = "auto"
+			cwdOnly = false
+			refsLang, refsNoComments, refsNoStrings, refsIgnoreCase = "", false, false, false
+
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefsCommand_Roots(t *testing.T) {
+	tmp := t.TempDir()
+	work := filepath.Join(tmp, "work")
+	files := map[string]string{
+		"api/.git/HEAD":   "ref: refs/heads/main\n",
+		"api/orders.go":   "package api\n\nfunc CreateOrder() {}\n",
+		"api/handler.go":  "package api\n\nvar h = CreateOrder\n",
+		"web/.gitignore":  "gen/\n",
+		"web/app.ts":      "const o = CreateOrder();\n",
+		"web/gen/stub.ts": "CreateOrder();\n",
+		"proto/orders.py": "def CreateOrder(): pass\n",
+		"api/.cdx.yaml":   "roots: [" + filepath.Join(work, "web") + ", " + filepath.Join(work, "proto") + ", " + filepath.Join(work, "gone") + "]\n",
+		"unrelated/x.go":  "package x\n\nvar _ = CreateOrder\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(work, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	t.Chdir(filepath.Join(work, "api"))
+	t.Cleanup(func() { cwdOnly = false })
+
+	tests := []struct {
+		name      string
+		rootsMode string
+		want      string
+		args      []string
+	}{
+		{
+			name: "append, paths relative to the common ancestor",
+			args: []string{"refs", "CreateOrder"},
+			want: "definitions:\napi/orders.go:3:6: func CreateOrder() {}\nproto/orders.py:1:5: def CreateOrder(): pass\n" +
+				"references (go):\napi/handler.go\n  api/handler.go:3:9: [other] var h = CreateOrder\nreferences (ts):\nweb/app.ts\n  web/app.ts:1:11: [call] const o = CreateOrder();\n",
+		},
+		{
+			name:      "replace",
+			rootsMode: "replace",
+			args:      []string{"refs", "CreateOrder"},
+			want: "definitions:\nproto/orders.py:1:5: def CreateOrder(): pass\n" +
+				"references:\nweb/app.ts\n  web/app.ts:1:11: [call] const o = CreateOrder();\n",
+		},
+		{
+			name: "cwd only ignores roots",
+			args: []string{"refs", "CreateOrder", "--cwd-only"},
+			want: "definitions:\norders.go:3:6: func CreateOrder() {}\nreferences:\nhandler.go\n  handler.go:3:9: [other] var h = CreateOrder\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat = "auto"
+			cwdOnly = false
+			refsLang, refsNoComments, refsNoStrings, refsIgnoreCase = "", false, false, false
+			t.Setenv("CDX_ROOTS_MODE", tt.rootsMode)
+
+			stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetErr(stderr)
+			rootCmd.SetArgs(tt.args)
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+			warning := "warning: roots: skipping " + filepath.Join(work, "gone") + ": not a directory\n"
+			wantWarnings := 1
+			if cwdOnly {
+				wantWarnings = 0
+			}
+			if got := strings.Count(stderr.String(), warning); got != wantWarnings {
+				t.Errorf("stderr = %q, want the missing root warned about %d times", stderr.String(), wantWarnings)
+			}
+		})
+	}
+}
+
+func TestRefsCommand_ParallelRoots(t *testing.T) {
+	tmp := t.TempDir()
+	work := filepath.Join(tmp, "work")
+	// Three roots searched at once, with more files than workers, still
+	// list their references root by root in walk order
+	var want []string
+	var roots []string
+	for _, root := range []string{"charlie", "alpha", "bravo"} {
+		roots = append(roots, filepath.Join(work, root))
+		for i := range 30 {
+			name := fmt.Sprintf("%s/f%02d.go", root, i)
+			want = append(want, name)
+			p := filepath.Join(work, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte("package p\n\nvar _ = Limit\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	cfg := "roots: [" + strings.Join(roots, ", ") + "]\nroots_mode: replace\n"
+	if err := os.WriteFile(filepath.Join(work, ".cdx.yaml"), []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	t.Chdir(work)
+	t.Cleanup(func() {
+		jobs, refsMaxResults = 0, 0
+		rootCmd.PersistentFlags().Lookup("jobs").Changed = false
+		refsCmd.Flags().Lookup("max-results").Changed = false
+	})
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "all", args: []string{"refs", "Limit", "--jobs", "4"}, want: want},
+		// The first root's references, then the second's up to the cap
+		{name: "capped", args: []string{"refs", "Limit", "--jobs", "4", "-m", "45"}, want: want[:45]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 5 {
+				outputFormat, cwdOnly = "plain", false
+				refsLang, refsNoComments, refsNoStrings, refsIgnoreCase = "", false, false, false
+				refsMaxResults = 0
+				stdout := new(bytes.Buffer)
+				rootCmd.SetOut(stdout)
+				rootCmd.SetErr(new(bytes.Buffer))
+				rootCmd.SetArgs(tt.args)
+				if err := rootCmd.Execute(); err != nil {
+					t.Fatalf("Execute() error = %v", err)
+				}
+				var got []string
+				for line := range strings.Lines(stdout.String()) {
+					file, _, _ := strings.Cut(line, ":")
+					got = append(got, file)
+				}
+				if !slices.Equal(got, tt.want) {
+					t.Fatalf("refs files = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigShow(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	cfg := "exclude_dirs:\n  - generated\n  - /bazel-out\nexclude_globs:\n  - \"*.pb.go\"\n"
+	if err := os.WriteFile(filepath.Join(tmp, ".cdx.yaml"), []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { excludePatterns = nil })
+
+	outputFormat = "json"
+	excludePatterns = nil
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"config", "show", "-o", "json", "--exclude", "!generated/keep"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	var report configReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+	}
+	if report.Settings["search_root"] != "repo" {
+		t.Errorf("settings[search_root] = %v, want repo", report.Settings["search_root"])
+	}
+	if file := filepath.Join(tmp, ".cdx.yaml"); report.Sources["exclude_dirs"] != file || report.Sources["search_root"] != "default" {
+		t.Errorf("sources = %v, want exclude_dirs from %s and search_root from default", report.Sources, file)
+	}
+	builtin := len(walk.SkipDirs())
+	if len(report.Exclude) != builtin+4 {
+		t.Fatalf("exclude = %v, want %d built-in entries and 4 more", report.Exclude, builtin)
+	}
+	want := []exclusion{
+		{Pattern: "generated/", Source: "exclude_dirs"},
+		{Pattern: "/bazel-out/", Source: "exclude_dirs"},
+		{Pattern: "*.pb.go", Source: "exclude_globs"},
+		{Pattern: "!generated/keep", Source: "--exclude"},
+	}
+	if got := report.Exclude[builtin:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("exclude = %v, want %v", got, want)
+	}
+}
+
+func TestConfigShow_Strict(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	file := filepath.Join(tmp, ".cdx.yaml")
+	if err := os.WriteFile(file, []byte("output_fromat: json\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { configStrict = false })
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{name: "warnings are reported", args: []string{"config", "show"}},
+		{name: "strict fails on warnings", args: []string{"config", "show", "--strict"}, wantCode: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat, excludePatterns, configStrict = "plain", nil, false
+			stderr := new(bytes.Buffer)
+			rootCmd.SetOut(new(bytes.Buffer))
+			rootCmd.SetErr(stderr)
+			t.Cleanup(func() { rootCmd.SetErr(nil) })
+			rootCmd.SetArgs(tt.args)
+
+			err := rootCmd.Execute()
+			var exitErr ExitError
+			if errors.As(err, &exitErr) && exitErr.Code != tt.wantCode || err != nil && tt.wantCode == 0 || err == nil && tt.wantCode != 0 {
+				t.Fatalf("Execute() error = %v, want exit code %d", err, tt.wantCode)
+			}
+			want := "warning: " + file + ": unknown key \"output_fromat\" (did you mean \"output_format\"?)\n"
+			if stderr.String() != want {
+				t.Errorf("stderr = %q, want %q", stderr.String(), want)
+			}
+		})
+	}
+}
+
+func TestConfigShow_Profile(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	t.Setenv(config.EnvProfile, "")
+	cfg := "max_results: 10\nprofiles:\n  agent:\n    max_results: 50\n  human:\n    smart_case: true\n"
+	if err := os.WriteFile(filepath.Join(tmp, ".cdx.yaml"), []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { profileName = "" })
+
+	tests := []struct {
+		name       string
+		wantErr    string
+		wantSource string
+		args       []string
+		wantMax    float64
+	}{
+		{name: "base config", args: []string{"config", "show", "-o", "json"}, wantMax: 10, wantSource: filepath.Join(tmp, ".cdx.yaml")},
+		{name: "profile applied", args: []string{"config", "show", "-o", "json", "--profile", "agent"}, wantMax: 50, wantSource: "profile agent"},
+		{
+			name:    "unknown profile",
+			args:    []string{"config", "show", "-o", "json", "--profile", "robot"},
+			wantErr: `unknown profile "robot" (defined: agent, human)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat, excludePatterns, profileName = "json", nil, ""
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+
+			err := rootCmd.Execute()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			var report configReport
+			if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+				t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+			}
+			if report.Settings["max_results"] != tt.wantMax || report.Sources["max_results"] != tt.wantSource {
+				t.Errorf("max_results = %v from %q, want %v from %q",
+					report.Settings["max_results"], report.Sources["max_results"], tt.wantMax, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	file := filepath.Join(tmp, ".cdx.yaml")
+	if err := os.WriteFile(file, []byte("backend: native\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { doctorBackend = "" })
+
+	outputFormat, excludePatterns, doctorBackend = "json", nil, ""
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"doctor", "-o", "json"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	var report doctorReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+	}
+	if report.Backend != "native (backend: native)" {
+		t.Errorf("backend = %q, want native from config", report.Backend)
+	}
+	if !reflect.DeepEqual(report.ConfigFiles, []string{file}) {
+		t.Errorf("config_files = %v, want [%s]", report.ConfigFiles, file)
+	}
+	var names []string
+	for _, b := range report.Backends {
+		names = append(names, b.Name)
+	}
+	if want := []string{"rg", "grep", "native"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("backends = %v, want %v in detection order", names, want)
+	}
+
+	stdout.Reset()
+	rootCmd.SetArgs([]string{"doctor", "-o", "json", "--backend", "ripgrep"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), `--backend: invalid backend "ripgrep"`) {
+		t.Errorf("Execute() error = %v, want an invalid --backend error", err)
+	}
+}
+
+// TestDoctor_MissingBackend runs doctor in a subprocess whose PATH holds
+// neither rg nor grep, since backend detection happens once per process.
+func TestDoctor_MissingBackend(t *testing.T) {
+	if os.Getenv("CDX_TEST_NO_BACKENDS") == "1" {
+		outputFormat, excludePatterns, doctorBackend = "json", nil, ""
+		rootCmd.SetArgs([]string{"doctor", "-o", "json"})
+		err := rootCmd.Execute()
+		var exitErr ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
+		return
+	}
+
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, ".cdx.yaml"), []byte("backend: rg\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDoctor_MissingBackend$") // #nosec G204 -- reruns this test binary
+	cmd.Dir = tmp
+	cmd.Env = append(os.Environ(), "CDX_TEST_NO_BACKENDS=1", "PATH="+t.TempDir(),
+		"HOME="+tmp, "XDG_CONFIG_HOME="+tmp, "AppData="+tmp)
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("doctor with rg missing: %v, want exit code 1", err)
+	}
+
+	// The test binary's own output follows the report
+	var report doctorReport
+	if err := json.NewDecoder(bytes.NewReader(out)).Decode(&report); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	for _, b := range report.Backends {
+		if b.Available != (b.Name == "native") {
+			t.Errorf("backend %s available = %v with an empty PATH", b.Name, b.Available)
+		}
+	}
+	if want := "install ripgrep (rg), or set backend: auto"; !strings.HasPrefix(report.BackendFix, want) {
+		t.Errorf("backend_fix = %q, want it to start %q", report.BackendFix, want)
+	}
+	if !strings.Contains(report.BackendError, "rg not found on PATH") {
+		t.Errorf("backend_error = %q, want it to say rg wasn't found", report.BackendError)
+	}
+}
+
+func TestPluginLanguage(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	files := map[string]string{
+		"cdx/languages/vhdl.yaml": "name: vhdl\nextensions: [.vhd]\ndefinitions:\n  - kind: function\n    regex: '^\\s*(pure\\s+)?function\\s+(\\w+)'\n    group: 2\n",
+		"rtl/alu.vhd":             "pure function add(a, b : word) return word is\nbegin\n  return a + b;\nend;\n\nsum <= add(x, y);\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmp, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { patterns.SetPlugins(nil) })
+
+	outputFormat, excludePatterns, doctorBackend = "json", nil, ""
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"doctor", "-o", "json"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	var report doctorReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+	}
+	want := []pluginLanguage{{Name: "vhdl", File: filepath.Join(tmp, "cdx", "languages", "vhdl.yaml"), Extensions: []string{".vhd"}}}
+	if !reflect.DeepEqual(report.Languages, want) {
+		t.Errorf("plugin_languages = %+v, want %+v", report.Languages, want)
+	}
+
+	outputFormat = "auto"
+	refsLang, refsNoComments, refsNoStrings, refsIgnoreCase, refsCount = "", false, false, false, false
+	stdout.Reset()
+	rootCmd.SetArgs([]string{"refs", "add", "--lang", "vhdl"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if got, want := stdout.String(), "definitions:\nrtl/alu.vhd:1:15: pure function add(a, b : word) return word is\nreferences:\n"+
+		"rtl/alu.vhd\n  rtl/alu.vhd:6:8: [other] sum <= add(x, y);\n"; got != want {
+		t.Errorf("refs output = %q, want %q", got, want)
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	t.Chdir(tmp)
+	explicit := filepath.Join(tmp, "ci.yaml")
+	// A broken config file mustn't stop config path from reporting it
+	if err := os.WriteFile(explicit, []byte("output_format: [\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { configPath = "" })
+
+	tests := []struct {
+		name     string
+		env      string
+		want     string
+		args     []string
+		wantCode int
+	}{
+		{name: "nothing found", args: []string{"config", "path"}, wantCode: 3},
+		{name: "env", env: explicit, args: []string{"config", "path"}, want: explicit + "\n"},
+		{name: "flag", args: []string{"config", "path", "--config", "ci.yaml"}, want: explicit + "\n"},
+		{name: "broken explicit config fails other commands", args: []string{"files", "--config", "ci.yaml"}, wantCode: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(config.EnvConfig, tt.env)
+			outputFormat, configPath, excludePatterns = "plain", "", nil
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetErr(new(bytes.Buffer))
+			t.Cleanup(func() { rootCmd.SetErr(nil) })
+			rootCmd.SetArgs(tt.args)
+
+			err := rootCmd.Execute()
+			code := 0
+			if err != nil {
+				code = 1
+				var exitErr ExitError
+				if errors.As(err, &exitErr) {
+					code = exitErr.Code
+				}
+			}
+			if code != tt.wantCode {
+				t.Fatalf("Execute() error = %v, want exit code %d", err, tt.wantCode)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilesCommand_Exclude(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	files := map[string]string{
+		".git/HEAD":             "ref: refs/heads/main\n",
+		".cdx.yaml":             "exclude_dirs: [/generated, coverage]\nexclude_globs: [\"*_mock.go\"]\n",
+		"main.go":               "package main\n",
+		"user_mock.go":          "package main\n",
+		"generated/api.go":      "package generated\n",
+		"pkg/generated/ok.go":   "package generated\n",
+		"pkg/coverage/skip.go":  "package coverage\n",
+		"scripts/release.py":    "pass\n",
+		"scripts/release_ci.py": "pass\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { excludePatterns = nil })
+
+	outputFormat, cwdOnly, excludePatterns = "plain", false, nil
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetArgs([]string{"files", "--exclude", "*_ci.py"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	want := filepath.FromSlash("main.go\npkg/generated/ok.go\nscripts/release.py\n")
+	if got := stdout.String(); got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+}
+
+func TestFilesCommand_Slash(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	for _, name := range []string{".git/HEAD", "main.go", "pkg/user.go", "pkg/gen/api.go"} {
+		p := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("package x\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { excludePatterns, slashPaths = nil, false })
+
+	// The exclude pattern uses the platform's separator, as typed on Windows
+	exclude := filepath.Join("pkg", "gen")
+	tests := []struct {
+		name, want string
+		args       []string
+	}{
+		{"native separators", "main.go\n" + filepath.Join("pkg", "user.go") + "\n", []string{"files", "--exclude", exclude}},
+		{"slash", "main.go\npkg/user.go\n", []string{"files", "--exclude", exclude, "--slash"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat, cwdOnly, excludePatterns, slashPaths = "plain", false, nil, false
+			filesLang, filesStats = "", false
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilesCommand_LanguageExtensions(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	files := map[string]string{
+		".cdx.yaml":   "language_extensions:\n  .gohtml: go\n  .tsx: \"\"\n",
+		"main.go":     "package main\n",
+		"page.gohtml": "{{define \"page\"}}{{end}}\n",
+		"app.ts":      "export {}\n",
+		"view.tsx":    "export {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { patterns.SetExtensions(nil) })
+
+	tests := []struct {
+		want string
+		args []string
+	}{
+		{args: []string{"files", "--lang", "go"}, want: "main.go\npage.gohtml\n"},
+		{args: []string{"files"}, want: "app.ts\nmain.go\npage.gohtml\n"}, // view.tsx is unmapped
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			outputFormat, filesLang, cwdOnly, excludePatterns = "plain", "", false, nil
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetArgs(tt.args)
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultLang(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	files := map[string]string{
+		".cdx.yaml":      "default_lang: ts\n",
+		"app.ts":         "export const MaxUsers = 1\n",
+		"tools/limit.go": "package tools\n\nconst Limit = 2\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+
+	tests := []struct {
+		name       string
+		wantOut    string
+		wantStderr string
+		args       []string
+		wantCode   int
+	}{
+		{
+			name:       "default applies",
+			args:       []string{"files", "--stats"},
+			wantOut:    "app.ts\n",
+			wantStderr: "lang:     ts (from default_lang; --lang all searches every language)\n",
+		},
+		{name: "flag overrides", args: []string{"files", "--lang", "go"}, wantOut: "tools/limit.go\n"},
+		{name: "all clears the default", args: []string{"files", "--lang", "all"}, wantOut: "app.ts\ntools/limit.go\n"},
+		{
+			name:       "not found explains the filter",
+			args:       []string{"refs", "Limit"},
+			wantStderr: "note: only searched ts (default_lang); use --lang all to search every language\n",
+			wantCode:   3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFormat, cwdOnly, excludePatterns = "plain", false, nil
+			filesLang, refsLang, filesStats = "", "", false
+			stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetErr(stderr)
+			t.Cleanup(func() { rootCmd.SetErr(nil) })
+			rootCmd.SetArgs(tt.args)
+
+			err := rootCmd.Execute()
+			var exitErr ExitError
+			if errors.As(err, &exitErr) && exitErr.Code != tt.wantCode || err != nil && tt.wantCode == 0 {
+				t.Fatalf("Execute() error = %v, want exit code %d", err, tt.wantCode)
+			}
+			if got := stdout.String(); got != filepath.FromSlash(tt.wantOut) {
+				t.Errorf("stdout = %q, want %q", got, filepath.FromSlash(tt.wantOut))
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestRefsCommand_ResultDefaults(t *testing.T) {
+	tmp := t.TempDir()
+	// Outside the tree searched, which the symbol cache would add to
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("AppData", home)
+	files := map[string]string{
+		".cdx.yaml": "max_results: 2\ninclude_tests: false\n",
+		"a.go":      "package p\n\nvar a = Limit\n",
+		"a_test.go": "package p\n\nvar t = Limit\n",
+		"b.go":      "package p\n\nvar b = Limit\n",
+		"c.go":      "package p\n\nvar c = Limit\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { refsMaxResults, refsTests = 0, true })
+
+	// Cases run in precedence order: cobra remembers a flag was set, so
+	// the flag case has to come last
+	tests := []struct {
+		name       string
+		env        string
+		wantStderr string
+		args       []string
+		want       []string
+	}{
+		{
+			name:       "config file",
+			args:       []string{"refs", "Limit"},
+			want:       []string{"a.go", "b.go"},
+			wantStderr: "showing the first 2 references; pass --max-results 0 for all\n",
+		},
+		{
+			name: "env overrides file",
+			env:  "3",
+			args: []string{"refs", "Limit"},
+			want: []string{"a.go", "b.go", "c.go"},
+		},
+		{
+			name: "flags override env and file",
+			env:  "3",
+			args: []string{"refs", "Limit", "--max-results", "0", "--include-tests"},
+			want: []string{"a.go", "a_test.go", "b.go", "c.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("CDX_MAX_RESULTS", tt.env)
+			}
+			outputFormat, cwdOnly, excludePatterns = "plain", false, nil
+			refsLang, refsNoComments, refsNoStrings, refsIgnoreCase = "", false, false, false
+			refsMaxResults, refsTests = 0, true
+			stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetErr(stderr)
+			t.Cleanup(func() { rootCmd.SetErr(nil) })
+			rootCmd.SetArgs(tt.args)
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			var got []string
+			for line := range strings.Lines(stdout.String()) {
+				file, _, _ := strings.Cut(line, ":")
+				got = append(got, file)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+			if stderr.String() != tt.wantStderr {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestRefsCommand_Color(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("CLICOLOR_FORCE", "")
+	src := "package p\n\n// Limit caps it\nvar x = 1\n"
+	if err := os.WriteFile(filepath.Join(tmp, "p.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	t.Cleanup(func() { colorFlag, noColor = termcolor.Auto, false })
+
+	// Cases that set a flag come last, since cobra remembers it was set
+	tests := []struct {
+		name     string
+		env      map[string]string
+		args     []string
+		wantDim  bool
+		wantCode int
+	}{
+		{name: "piped output is plain", args: []string{"refs", "Limit"}},
+		{name: "CLICOLOR_FORCE colors a pipe", env: map[string]string{"CLICOLOR_FORCE": "1"}, args: []string{"refs", "Limit"}, wantDim: true},
+		{name: "color always", args: []string{"refs", "Limit", "--color", "always"}, wantDim: true},
+		{
+			name: "no-color beats CLICOLOR_FORCE",
+			env:  map[string]string{"CLICOLOR_FORCE": "1"},
+			args: []string{"refs", "Limit", "--no-color"},
+		},
+		{name: "invalid mode", args: []string{"refs", "Limit", "--color", "rainbow"}, wantCode: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			outputFormat, cwdOnly, excludePatterns = "auto", false, nil
+			colorFlag, noColor = termcolor.Auto, false
+			refsLang, refsNoComments, refsNoStrings, refsIgnoreCase = "", false, false, false
+			stdout := new(bytes.Buffer)
+			rootCmd.SetOut(stdout)
+			rootCmd.SetErr(new(bytes.Buffer))
+			t.Cleanup(func() { rootCmd.SetErr(nil) })
+			rootCmd.SetArgs(tt.args)
+
+			err := rootCmd.Execute()
+			if (err != nil) != (tt.wantCode != 0) {
+				t.Fatalf("Execute() error = %v, want exit code %d", err, tt.wantCode)
+			}
+			if got := strings.Contains(stdout.String(), ansiDim); got != tt.wantDim {
+				t.Errorf("stdout = %q, want dimmed %v", stdout.String(), tt.wantDim)
+			}
+		})
+	}
+}
+
+// progressErr stands in for a searcher's partial-result error.
+type progressErr struct {
+	err            error
+	scanned, total int
+}
+
+func (e progressErr) Error() string                  { return e.err.Error() }
+func (e progressErr) Unwrap() error                  { return e.err }
+func (e progressErr) Progress() (scanned, total int) { return e.scanned, e.total }
+
+func TestPartialError(t *testing.T) {
+	tests := []struct {
+		err     error
+		name    string
+		want    string
+		timeout time.Duration
+	}{
+		{
+			name:    "timeout with estimate",
+			err:     progressErr{err: context.DeadlineExceeded, scanned: 1204, total: 5000},
+			timeout: 30 * time.Second,
+			want:    "warning: search timed out after 30s; 1,204 of ~5,000 files scanned — rerun with --timeout 2m\n",
+		},
+		{
+			name:    "timeout without estimate",
+			err:     progressErr{err: context.DeadlineExceeded, scanned: 12},
+			timeout: 5 * time.Second,
+			want:    "warning: search timed out after 5s; 12 files scanned — rerun with --timeout 20s\n",
+		},
+		{
+			name:    "timeout without progress",
+			err:     fmt.Errorf("searching: %w", context.DeadlineExceeded),
+			timeout: 90 * time.Second,
+			want:    "warning: search timed out after 90s — rerun with --timeout 6m\n",
+		},
+		{
+			name: "signal",
+			err:  progressErr{err: context.Canceled, scanned: 12, total: 40},
+			want: "warning: search interrupted; 12 of ~40 files scanned\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := searchTimeout
+			searchTimeout = tt.timeout
+			t.Cleanup(func() { searchTimeout = old })
+
+			stderr := new(bytes.Buffer)
+			err := partialError(stderr, tt.err)
+
+			var exitErr ExitError
+			if !errors.As(err, &exitErr) || exitErr.Code != exitPartial {
+				t.Fatalf("partialError() = %v, want ExitError with code %d", err, exitPartial)
+			}
+			if !interrupted(err) {
+				t.Error("interrupted(partialError()) = false, want true")
+			}
+			if stderr.String() != tt.want {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestThousands(t *testing.T) {
+	for n, want := range map[int]string{0: "0", 999: "999", 1000: "1,000", 1234567: "1,234,567", -4500: "-4,500"} {
+		if got := thousands(n); got != want {
+			t.Errorf("thousands(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestGenDocsCommand(t *testing.T) {
+	t.Cleanup(func() { genDocsFormat, genDocsOut = "markdown", "" })
+	long := defCmd.Long
+
+	// def's page is golden, so that changing its flags or text means
+	// regenerating the file and reviewing the difference
+	out := t.TempDir()
+	rootCmd.SetArgs([]string{"gen-docs", "--out", out})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(out, "cdx_def.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "cdx_def.md")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("cdx_def.md differs from %s (run go test -update to accept):\n%s", golden, got)
+	}
+	if defCmd.Long != long {
+		t.Error("gen-docs left the exit codes in def's Long text")
+	}
+	if _, err := os.Stat(filepath.Join(out, "cdx_gen-docs.md")); err == nil {
+		t.Error("gen-docs documented itself, though it's hidden")
+	}
+
+	for format, page := range map[string]string{"man": "cdx-def.1", "rest": "cdx_def.rst"} {
+		out := t.TempDir()
+		rootCmd.SetArgs([]string{"gen-docs", "--format", format, "--out", out})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("gen-docs --format %s: %v", format, err)
+		}
+		data, err := os.ReadFile(filepath.Join(out, page))
+		if err != nil {
+			t.Fatalf("gen-docs --format %s: %v", format, err)
+		}
+		if !bytes.Contains(data, []byte("3  Nothing matched")) {
+			t.Errorf("gen-docs --format %s: %s has no exit codes:\n%s", format, page, data)
+		}
+	}
+
+	rootCmd.SetArgs([]string{"gen-docs", "--format", "pdf", "--out", t.TempDir()})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "--format") {
+		t.Errorf("gen-docs --format pdf error = %v", err)
+	}
+}
+
+func TestCommandExitCodes(t *testing.T) {
+	// Every command's annotation parses
+	var check func(cmd *cobra.Command)
+	check = func(cmd *cobra.Command) {
+		if _, err := commandExitCodes(cmd); err != nil {
+			t.Error(err)
+		}
+		for _, sub := range cmd.Commands() {
+			check(sub)
+		}
+	}
+	check(rootCmd)
+
+	got, err := commandExitCodes(refsCmd)
+	want := []exitCode{{code: 0, meaning: "Success"}, {code: 1, meaning: "Error"}, exitCodeNotFound, exitCodePartial}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("commandExitCodes(refs) = %v, %v, want %v", got, err, want)
+	}
+	bad := &cobra.Command{Use: "bad", Annotations: map[string]string{exitCodesAnnotation: "three\tNothing"}}
+	if _, err := commandExitCodes(bad); err == nil {
+		t.Error("commandExitCodes() accepted a code that isn't a number")
+	}
+}
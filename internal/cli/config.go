@@ -0,0 +1,253 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/config"
+	"github.com/bashhack/cdx/internal/ignore"
+	"github.com/bashhack/cdx/internal/walk"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect cdx configuration",
+	Long: `Inspect cdx configuration.
+
+Settings come from .cdx.yaml files in the user config directory, the home
+directory, and the project (the nearest one from the current directory up to
+the repository root), merged in that order so each file overrides only the
+keys it sets. --config (or CDX_CONFIG) names a single file to read instead,
+skipping the search. A profile selected with --profile (or CDX_PROFILE)
+overrides the files, CDX_* environment variables override the profile, and
+flags override everything.
+
+Maps such as language_extensions merge entry by entry. Lists replace the
+list from an earlier file; to add to it instead, use extra_exclude_dirs and
+extra_exclude_globs, which accumulate across every file.
+
+Settings that shape where def looks:
+
+  search_root         repo (the enclosing repository) or cwd, as --cwd-only
+  roots, roots_mode   more directories to search, such as sibling
+                      repositories, added to the repository (append) or
+                      searched instead of it (replace)
+  use_tags            answer from a tags, .tags, or TAGS file at the
+                      repository root first, re-verifying changed files
+  go_backend          regex, or gopls for type-checked Go answers, as
+                      --precise, falling back to regex when gopls fails
+  backend             auto, rg, grep, or native, as --backend
+  generated_patterns  names of generated files left out unless --generated,
+                      besides files marked "Code generated ... DO NOT EDIT"
+
+Profiles are named sets of settings defined under profiles:
+
+  profiles:
+    agent:
+      output_format: json
+      color: never
+      max_results: 50`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the effective configuration",
+	Long: `Show the effective value of every setting and the file or environment
+variable that supplied it, followed by the merged list of
+exclusions applied to every search: the built-in skip list, exclude_dirs,
+exclude_globs, and any --exclude flags, in the order they're applied.
+
+Problems that don't stop the config from loading, such as unknown keys, are
+printed as warnings. Pass --strict to exit non-zero when there are any, e.g.
+to lint a config in CI.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigShow,
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print the config files cdx reads",
+	Long: `Print the config files cdx reads, lowest precedence first: the file
+selected with --config or CDX_CONFIG, or else every .cdx.yaml found in the
+user config directory, the home directory, and the project.
+
+Exits with code 3 when no config file is found.`,
+	Args: cobra.NoArgs,
+	Annotations: map[string]string{
+		noConfigAnnotation:  "true",
+		exitCodesAnnotation: exitCodes(exitCode{code: 3, meaning: "No config file was found"}),
+	},
+	RunE: runConfigPath,
+}
+
+var configStrict bool
+
+func init() {
+	configShowCmd.Flags().BoolVar(&configStrict, "strict", false, "Exit non-zero if the config has any warnings")
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configPathCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// exclusion is one entry in the merged exclusion list.
+type exclusion struct {
+	Pattern string `json:"pattern"`
+	Source  string `json:"source"`
+}
+
+// configReport is the JSON representation of config show.
+type configReport struct {
+	Settings map[string]any    `json:"settings"`
+	Sources  map[string]string `json:"sources"` // Where each setting came from
+	Exclude  []exclusion       `json:"exclude"`
+	Files    []string          `json:"files"`             // Config files read, lowest precedence first
+	Profile  string            `json:"profile,omitempty"` // Profile applied
+	Warnings []string          `json:"warnings"`
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) error {
+	cfg := commandConfig(cmd)
+	rules, err := excludeRules(cfg)
+	if err != nil {
+		return err
+	}
+	exclusions := mergedExclusions(rules)
+
+	w := cmd.OutOrStdout()
+	if wantJSON() {
+		report := configReport{
+			Settings: make(map[string]any),
+			Sources:  make(map[string]string),
+			Exclude:  exclusions,
+			Files:    append([]string{}, cfg.Files...),
+			Profile:  cfg.Profile,
+			Warnings: []string{},
+		}
+		for _, s := range cfg.Settings() {
+			report.Settings[s.Key] = s.Value
+			report.Sources[s.Key] = s.Source
+		}
+		for _, warning := range cfg.Warnings {
+			report.Warnings = append(report.Warnings, warning.String())
+		}
+		if err := writeJSON(w, report); err != nil {
+			return err
+		}
+	} else {
+		if err := writeConfig(w, cfg, exclusions); err != nil {
+			return err
+		}
+		// A default language filter is the usual reason a symbol "can't be found"
+		if len(cfg.DefaultLang) > 0 {
+			fmt.Fprintf(w, "\nnote: def, refs, and files search only %s unless --lang is given (default_lang)\n",
+				strings.Join(cfg.DefaultLang, ", "))
+		}
+	}
+
+	// loadCommandConfig has already printed the warnings themselves
+	if configStrict && len(cfg.Warnings) > 0 {
+		return ExitError{Code: 1, Err: fmt.Errorf("config has %d warning(s)", len(cfg.Warnings))}
+	}
+	return nil
+}
+
+func runConfigPath(cmd *cobra.Command, args []string) error {
+	files, err := config.Files(configPath)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		err := errors.New("no config file found")
+		fmt.Fprintf(cmd.ErrOrStderr(), "%v\n", err)
+		return ExitError{Code: 3, Err: err}
+	}
+	for _, file := range files {
+		fmt.Fprintln(cmd.OutOrStdout(), file)
+	}
+	return nil
+}
+
+// mergedExclusions lists the built-in skip list followed by rules.
+func mergedExclusions(rules []ignore.Rule) []exclusion {
+	skip := walk.SkipDirs()
+	list := make([]exclusion, 0, len(skip)+len(rules))
+	for _, name := range skip {
+		list = append(list, exclusion{Pattern: name + "/", Source: walk.SourceBuiltin})
+	}
+	for _, r := range rules {
+		pattern := r.Pattern
+		if r.Negate {
+			pattern = "!" + pattern
+		}
+		if r.DirOnly {
+			pattern += "/"
+		}
+		list = append(list, exclusion{Pattern: pattern, Source: r.Source})
+	}
+	return list
+}
+
+// writeConfig renders the config files read and the profile applied, then
+// settings as aligned "key: value (source)" lines, then the exclusion list.
+func writeConfig(w io.Writer, cfg *config.Config, exclusions []exclusion) error {
+	if len(cfg.Files) == 0 {
+		fmt.Fprintln(w, "files:  none (using defaults)")
+	} else {
+		fmt.Fprintln(w, "files:")
+		for _, file := range cfg.Files {
+			fmt.Fprintf(w, "  %s\n", file)
+		}
+	}
+	if cfg.Profile != "" {
+		fmt.Fprintf(w, "profile: %s\n", cfg.Profile)
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, s := range cfg.Settings() {
+		fmt.Fprintf(tw, "%s:\t%s\t(%s)\n", s.Key, formatSetting(s.Value), s.Source)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nexclude:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, e := range exclusions {
+		fmt.Fprintf(tw, "  %s\t%s\n", e.Pattern, e.Source)
+	}
+	return tw.Flush()
+}
+
+// formatSetting renders a setting value for human output.
+func formatSetting(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "auto"
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	case map[string]string:
+		pairs := make([]string, 0, len(v))
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			pairs = append(pairs, fmt.Sprintf("%s: %q", k, v[k]))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case map[string]map[string]any:
+		return "[" + strings.Join(slices.Sorted(maps.Keys(v)), ", ") + "]"
+	case []config.CustomPattern:
+		kinds := make([]string, len(v))
+		for i, p := range v {
+			kinds[i] = p.Kind + " /" + p.Regex + "/"
+		}
+		return "[" + strings.Join(kinds, ", ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -1,14 +1,33 @@
 package cli
 
 import (
+	"bytes"
 	"context"
-	"os"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/bashhack/cdx/internal/cache"
+	"github.com/bashhack/cdx/internal/config"
+	"github.com/bashhack/cdx/internal/deps"
+	"github.com/bashhack/cdx/internal/git"
+	"github.com/bashhack/cdx/internal/godeps"
+	"github.com/bashhack/cdx/internal/gopls"
+	"github.com/bashhack/cdx/internal/nodedeps"
 	"github.com/bashhack/cdx/internal/output"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/pydeps"
 	"github.com/bashhack/cdx/internal/search"
+	"github.com/bashhack/cdx/internal/similar"
+	"github.com/bashhack/cdx/internal/symbols"
+	"github.com/bashhack/cdx/internal/tags"
+	"github.com/bashhack/cdx/internal/walk"
+	"github.com/bashhack/cdx/internal/workspace"
 )
 
 const (
@@ -17,9 +36,30 @@ const (
 )
 
 var (
-	defLang         string
-	defAll          bool
-	defContextLines int
+	defLang             string
+	defRev              string
+	defMaxFileSize      string
+	defExcludeAnnotated []string
+	defAll              bool
+	defContextLines     int
+	defBinary           bool
+	defTracked          bool
+	defUntracked        bool
+	defSmartCase        bool
+	defIgnoreCase       bool
+	defCaseSensitive    bool
+	defStats            bool
+	defNoTags           bool
+	defPrecise          bool
+	defFollow           bool
+	defBackend          string
+	defIncludeTests     bool
+	defGenerated        bool
+	defMaxResults       int
+	defDeps             bool
+	defPythonEnv        string
+	defNested           bool
+	defNoSuggest        bool
 )
 
 var defCmd = &cobra.Command{
@@ -31,59 +71,250 @@ Examples:
   cdx def GetUserByID           # Find definition of GetUserByID
   cdx def GetUserByID -C 5      # Show 5 lines of context
   cdx def UserService --lang=ts # Search TypeScript files only
-  cdx def Config -o json        # Output as JSON`,
-	Args: cobra.ExactArgs(1),
-	RunE: runDef,
+  cdx def Config -o json        # Output as JSON
+  cdx def Config --rev v1.4.0   # Search the tree as of a git revision
+  cdx def viper.New --deps      # Search dependencies too`,
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{exitCodesAnnotation: exitCodes(exitCodeNotFound, exitCodePartial)},
+	RunE:        runDef,
 }
 
 func init() {
-	defCmd.Flags().StringVarP(&defLang, "lang", "l", "", "Force language (go, ts, js, py, rust)")
+	defCmd.Flags().StringVarP(&defLang, "lang", "l", "", "Force language ("+builtinLangs+", or all to ignore default_lang)")
 	defCmd.Flags().BoolVarP(&defAll, "all", "a", false, "Include test files and show all results (no limit)")
+	defCmd.Flags().IntVarP(&defMaxResults, "max-results", "m", defaultMaxResults, "Show at most this many results (0 for no limit)")
+	defCmd.Flags().BoolVar(&defIncludeTests, "include-tests", false, "Search test files too")
+	defCmd.Flags().BoolVar(&defGenerated, "generated", false, "Search generated files too, such as *.pb.go")
 	defCmd.Flags().IntVarP(&defContextLines, "context", "C", 0, "Lines of context around definition")
+	defCmd.Flags().BoolVar(&defBinary, "binary", false, "Search files that look binary")
+	defCmd.Flags().StringVar(&defMaxFileSize, "max-filesize", "", "Skip files larger than this (e.g. 512K, 10M; 0 for unlimited)")
+	defCmd.Flags().BoolVarP(&defFollow, "follow", "L", false, "Follow symlinks, searching each file once")
+	defCmd.Flags().BoolVar(&defTracked, "tracked", false, "Search only files tracked by git")
+	defCmd.Flags().BoolVar(&defUntracked, "include-untracked", false, "With --tracked, also search untracked files git doesn't ignore")
+	defCmd.Flags().StringVar(&defRev, "rev", "", "Search files as of this git revision without checking it out")
+	defCmd.MarkFlagsMutuallyExclusive("rev", "tracked")
+	defCmd.MarkFlagsMutuallyExclusive("rev", "include-untracked")
+	defCmd.Flags().BoolVar(&defDeps, "deps", false, "Also search dependencies: Go modules and the standard library, node_modules, or the Python virtualenv")
+	defCmd.MarkFlagsMutuallyExclusive("rev", "deps")
+	defCmd.Flags().StringVar(&defPythonEnv, "python-env", "", "With --deps, the Python virtual environment to search (default $VIRTUAL_ENV, then .venv)")
+	defCmd.Flags().BoolVarP(&defIgnoreCase, "ignore-case", "i", false, "Match the symbol case-insensitively")
+	defCmd.Flags().BoolVarP(&defCaseSensitive, "case-sensitive", "s", false, "Match the symbol exactly (overrides smart case)")
+	defCmd.Flags().BoolVarP(&defSmartCase, "smart-case", "S", false, "Match case-insensitively unless the symbol has uppercase")
+	defCmd.MarkFlagsMutuallyExclusive("ignore-case", "case-sensitive")
+	defCmd.Flags().BoolVar(&defStats, "stats", false, "Print search settings to stderr")
+	defCmd.Flags().BoolVar(&defPrecise, "precise", false, "Resolve Go symbols with gopls when it's installed (slower, exact)")
+	defCmd.Flags().StringVar(&defBackend, "backend", "", "Text search backend: auto, rg, grep, or native")
+	defCmd.Flags().BoolVar(&defNoTags, "no-tags", false, "Ignore ctags/etags tags files and always search live")
+	defCmd.Flags().StringSliceVar(&defExcludeAnnotated, "exclude-annotated", nil,
+		"Drop definitions carrying these decorators/attributes (e.g. test, overload)")
+	defCmd.Flags().BoolVar(&defNested, "nested", false, "Include functions nested in other functions, such as Python closures")
+	defCmd.Flags().BoolVar(&defNoSuggest, "no-suggest", false, "Don't look for similar names when the symbol isn't found")
 
 	rootCmd.AddCommand(defCmd)
 }
 
 func runDef(cmd *cobra.Command, args []string) error {
 	symbol := args[0]
+	if wantFzf() {
+		return errors.New("def doesn't support -o fzf; use refs, callers, or outline")
+	}
 
-	// Get current directory. If Getwd fails (e.g., directory was deleted),
-	// fall back to "." silently - it's semantically equivalent and this edge
-	// case doesn't warrant logging infrastructure.
-	dir, err := os.Getwd()
+	cfg := commandConfig(cmd)
+	// A revision belongs to one repository, so --rev ignores the roots
+	// setting
+	var roots []workspace.Root
+	var base string
+	var err error
+	if defRev != "" {
+		var root workspace.Root
+		root, base, err = resolveRoot(cmd, cfg)
+		roots = []workspace.Root{root}
+	} else {
+		roots, base, err = resolveRoots(cmd, cfg)
+	}
+	if err != nil {
+		return err
+	}
+	exclude, err := excludeRules(cfg)
 	if err != nil {
-		dir = "."
+		return err
+	}
+	maxFileSize, err := resolveMaxFileSize(cmd, defMaxFileSize, cfg)
+	if err != nil {
+		return err
 	}
+	maxLineLength, err := resolveMaxLineLength(cfg)
+	if err != nil {
+		return err
+	}
+	workers, err := resolveJobs(cmd, cfg)
+	if err != nil {
+		return err
+	}
+	searchBackend, err := resolveBackend(cmd, defBackend, cfg)
+	if err != nil {
+		return err
+	}
+	searchBackend = searchBackend.ForSymbol(symbol)
+
+	// Create context with timeout
+	ctx, cancel := searchContext(cmd)
+	defer cancel()
 
-	// Create searcher
-	searcher := search.NewGrepSearcher(dir)
+	ignoreCase, caseMode := resolveCase(cmd, symbol, defSmartCase, cfg)
+	langs, err := resolveLangs(cmd, defLang, cfg)
+	if err != nil {
+		return err
+	}
 
 	// Build search options
 	opts := search.Options{
-		Language:     defLang,
-		Context:      defContextLines,
-		IncludeTests: defAll,
-		Directory:    dir,
+		Languages:        langs.Langs,
+		IgnoreCase:       ignoreCase,
+		Context:          defContextLines,
+		IncludeTests:     true,
+		IncludeBinary:    defBinary,
+		FollowSymlinks:   defFollow,
+		MaxFileSize:      maxFileSize,
+		MaxLineLength:    maxLineLength,
+		Jobs:             workers,
+		Backend:          searchBackend,
+		ExcludeAnnotated: defExcludeAnnotated,
+		Nested:           defNested,
+		Exclude:          exclude,
+		Rev:              defRev,
+		RelativeTo:       base,
+		Slash:            slashPaths,
+		Generated:        generatedFiles(cfg),
+		SkipGenerated:    !defGenerated,
+		Tests:            testFiles(cfg),
 	}
 
+	if len(langs.Langs) == 1 {
+		opts.Language = string(langs.Langs[0])
+	}
+	// --all lifts both the result cap and the test-file filter
 	if !defAll {
-		opts.MaxResults = defaultMaxResults
+		opts.IncludeTests = resolveIncludeTests(cmd, defIncludeTests, cfg, false)
+		opts.MaxResults, err = resolveMaxResults(cmd, defMaxResults, cfg, defaultMaxResults)
+		if err != nil {
+			return err
+		}
 	}
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), defaultSearchTimeout)
-	defer cancel()
+	precise, err := usePrecise(cmd, cfg)
+	if err != nil {
+		return err
+	}
 
-	// Find definitions
-	results, err := searcher.FindDefinition(ctx, symbol, opts)
+	// showDeps prints what --deps found, reporting whether that answers
+	// the query
+	showDeps := func(found []deps.Definition, depsErr error) (bool, error) {
+		switch {
+		case depsErr != nil && interrupted(depsErr):
+			return true, partialError(cmd.ErrOrStderr(), depsErr)
+		case depsErr != nil:
+			return true, depsErr
+		case len(found) == 0:
+			return false, nil
+		}
+		if opts.MaxResults > 0 && len(found) > opts.MaxResults {
+			found = found[:opts.MaxResults]
+		}
+		return true, writeDeps(cmd, found)
+	}
 
-	// Determine output format
-	format := output.Format(outputFormat)
-	formatter := output.New(format, noColor)
+	// A qualified Go symbol names a dependency, so what it finds there
+	// answers the query on its own; without any, the symbol is searched
+	// for in the roots as if --deps weren't set
+	if defDeps && langs.Includes(patterns.Go) {
+		if done, depsErr := showDeps(defSearchGoDeps(ctx, cfg, symbol, roots, walk.Options{Exclude: exclude, MaxFileSize: maxFileSize, FollowSymlinks: defFollow})); done {
+			return depsErr
+		}
+	}
+
+	// Each root is searched with its own file list, cache, tags file, and
+	// gopls workspace, all at once; what each prints to stderr is held
+	// back and shown in root order. A root without the symbol doesn't stop
+	// the others.
+	byRoot := make([][]search.Result, len(roots))
+	stderr := make([]bytes.Buffer, len(roots))
+	errs := searchRoots(ctx, len(roots), workers, func(ctx context.Context, i, jobs int) error {
+		if defStats {
+			fmt.Fprintf(&stderr[i], "root:     %s\n", describeRoot(roots[i]))
+		}
+		ropts := opts
+		ropts.Jobs = jobs
+		var err error
+		byRoot[i], err = defSearchRoot(ctx, cmd, &stderr[i], cfg, symbol, roots[i].Dir, ropts, precise && langs.Includes(patterns.Go))
+		return err
+	})
+	var results []search.Result
+	for i := range roots {
+		_, _ = stderr[i].WriteTo(cmd.ErrOrStderr())
+		results = append(results, byRoot[i]...)
+		err = errs[i]
+		if _, ok := err.(search.ErrNotFound); ok {
+			continue
+		}
+		if err != nil {
+			break
+		}
+	}
+	// A symbol found in any root was found
+	if _, ok := err.(search.ErrNotFound); ok && len(results) > 0 {
+		err = nil
+	}
+	if opts.MaxResults > 0 && len(results) > opts.MaxResults {
+		results = results[:opts.MaxResults]
+	}
+
+	if defStats {
+		fmt.Fprintf(cmd.ErrOrStderr(), "lang:     %s\n", langs)
+		fmt.Fprintf(cmd.ErrOrStderr(), "case:     %s\n", caseMode)
+		fmt.Fprintf(cmd.ErrOrStderr(), "search:   %s\n", searchBackend)
+		fmt.Fprintf(cmd.ErrOrStderr(), "workers:  %d\n", workers)
+		if !defGenerated {
+			fmt.Fprintf(cmd.ErrOrStderr(), "generated: left out (search them with --generated)\n")
+		}
+	}
+
+	// node_modules and site-packages are far bigger than the project, so
+	// they're searched only for what the roots don't define
+	if _, ok := err.(search.ErrNotFound); ok && defDeps && (langs.Includes(patterns.TypeScript) || langs.Includes(patterns.JavaScript)) {
+		if done, depsErr := showDeps(defSearchNodeDeps(ctx, cfg, symbol, roots, ignoreCase)); done {
+			return depsErr
+		}
+	}
+	if _, ok := err.(search.ErrNotFound); ok && defDeps && langs.Includes(patterns.Python) {
+		if done, depsErr := showDeps(defSearchPythonDeps(ctx, cfg, symbol, roots, ignoreCase)); done {
+			return depsErr
+		}
+	}
+
+	// A symbol found nowhere may be misspelled, so the names defined near
+	// it are offered instead
+	if nf, ok := err.(search.ErrNotFound); ok && !defNoSuggest {
+		nf.Suggestions = defSuggest(ctx, symbol, roots, walk.Options{Languages: langs.Langs, Exclude: exclude, MaxFileSize: maxFileSize, FollowSymlinks: defFollow})
+		err = nf
+	}
 
 	// Handle output
 	w := cmd.OutOrStdout()
 
+	// Determine output format
+	format := output.Format(outputFormat)
+	formatter := output.New(format, !useColor(cmd, w))
+
+	// The searcher stops between files when ctx is done and returns what it
+	// found so far with ctx's error; show those before flagging them partial
+	if err != nil && interrupted(err) && len(results) > 0 {
+		if fmtErr := formatter.FormatResults(w, results); fmtErr != nil {
+			return fmtErr
+		}
+		return partialError(cmd.ErrOrStderr(), err)
+	}
+
 	if err != nil {
 		// Format error output - we handle all error display ourselves
 		if fmtErr := formatter.FormatError(w, err); fmtErr != nil {
@@ -91,6 +322,7 @@ func runDef(cmd *cobra.Command, args []string) error {
 		}
 		// Not found is a special case - exit code 3 per COMMANDS.md
 		if _, ok := err.(search.ErrNotFound); ok {
+			warnDefaultLang(cmd, langs)
 			return ExitError{Code: 3, Err: err}
 		}
 		return err
@@ -98,3 +330,283 @@ func runDef(cmd *cobra.Command, args []string) error {
 
 	return formatter.FormatResults(w, results)
 }
+
+// defSearchRoot runs def's search in one root, setting up what's specific to
+// it: the file list or revision, the symbol cache, the tags file, and, when
+// precise is set, gopls. Warnings go to stderr, and with --stats, the tags
+// file and backend.
+func defSearchRoot(ctx context.Context, cmd *cobra.Command, stderr io.Writer, cfg *config.Config, symbol, dir string, opts search.Options, precise bool) ([]search.Result, error) {
+	opts.Directory = dir
+
+	// A revision is read from git's object store, so there's no file list
+	// to build and no working-tree cache to consult
+	if defRev != "" {
+		if _, err := git.ResolveRev(ctx, dir, defRev); err != nil {
+			return nil, fmt.Errorf("--rev: %w", err)
+		}
+	} else {
+		paths, err := trackedPaths(ctx, cmd, dir, defTracked, defUntracked, cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts.Paths = paths
+	}
+
+	// Serve unchanged files from the symbol cache. A cache that can't be
+	// opened just means a cold run, so it isn't worth failing the search.
+	if !noCache && defRev == "" {
+		if c, cacheErr := cache.Open(dir); cacheErr == nil {
+			opts.Cache = c
+			defer saveCache(stderr, c)
+		}
+	}
+
+	// A tags file describes the working tree, so it can't answer --rev
+	// queries. An unreadable one is reported and then searched around.
+	if useTags(cmd, cfg) && defRev == "" {
+		tf, tagsErr := tags.Find(dir)
+		if tagsErr != nil {
+			fmt.Fprintf(stderr, "warning: ignoring tags file: %v\n", tagsErr)
+		}
+		opts.Tags = tf
+	}
+
+	// gopls only knows the working tree. Its absence isn't an error: the
+	// searcher falls back to the regex path whenever Gopls is nil or fails.
+	if precise && defRev == "" {
+		if client, goplsErr := gopls.New(dir); goplsErr == nil {
+			opts.Gopls = client
+		}
+	}
+
+	results, err := search.NewGrepSearcher(dir).FindDefinition(ctx, symbol, opts)
+	if native, ok := opts.Backend.Fallback(err); ok {
+		fmt.Fprintf(stderr, "warning: %v; searching natively instead\n", err)
+		opts.Backend = native
+		results, err = search.NewGrepSearcher(dir).FindDefinition(ctx, symbol, opts)
+	}
+
+	if defStats {
+		backend := "regex"
+		if opts.Gopls != nil {
+			backend = "gopls (" + opts.Gopls.Path + ")"
+		}
+		fmt.Fprintf(stderr, "backend:  %s\n", backend)
+		if opts.Tags != nil {
+			fmt.Fprintf(stderr, "tags:     %s (%d names)\n", opts.Tags.Path, opts.Tags.Len())
+		}
+	}
+	return results, err
+}
+
+// defSearchGoDeps looks symbol up in the imports of each root that its
+// package qualifier names, such as context in context.WithTimeout. A
+// qualifier no root imports, or an import go can't resolve to a directory
+// in GOROOT or the module cache, finds nothing rather than failing.
+func defSearchGoDeps(ctx context.Context, cfg *config.Config, symbol string, roots []workspace.Root, opts walk.Options) ([]deps.Definition, error) {
+	qualifier, name, ok := strings.Cut(symbol, ".")
+	if !ok || qualifier == "" || name == "" {
+		return nil, nil
+	}
+	ex, err := symbols.ForParser(cfg.BackendParser)
+	if err != nil {
+		return nil, err
+	}
+	var defs []deps.Definition
+	seen := make(map[string]bool) // Package directories searched
+	for _, root := range roots {
+		opts.Root = root.Dir
+		imports, err := godeps.Imports(ctx, opts, qualifier)
+		if err != nil {
+			return nil, err
+		}
+		if len(imports) == 0 {
+			continue
+		}
+		// Without go there's nothing to resolve with, which is as good as
+		// a module missing from the cache
+		resolver, err := godeps.NewResolver(root.Dir)
+		if err != nil {
+			continue
+		}
+		for _, ip := range imports {
+			pkg, err := resolver.Resolve(ctx, ip)
+			if interrupted(err) {
+				return nil, err
+			}
+			if err != nil || seen[pkg.Dir] {
+				continue
+			}
+			seen[pkg.Dir] = true
+			found, err := godeps.Definitions(pkg, name, ex)
+			if err != nil {
+				return nil, err
+			}
+			defs = append(defs, found...)
+		}
+	}
+	return defs, nil
+}
+
+// defSearchNodeDeps looks symbol up in the node_modules packages that the
+// package.json nearest each root depends on, preferring their type
+// declarations.
+func defSearchNodeDeps(ctx context.Context, cfg *config.Config, symbol string, roots []workspace.Root, fold bool) ([]deps.Definition, error) {
+	ex, err := symbols.ForParser(cfg.BackendParser)
+	if err != nil {
+		return nil, err
+	}
+	var defs []deps.Definition
+	seen := make(map[string]bool) // Package directories searched
+	for _, root := range roots {
+		pkgs, err := nodedeps.Dependencies(root.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("--deps: %w", err)
+		}
+		for _, pkg := range pkgs {
+			if seen[pkg.Dir] {
+				continue
+			}
+			seen[pkg.Dir] = true
+			found, err := nodedeps.Definitions(ctx, pkg, symbol, ex, fold)
+			if err != nil {
+				return nil, err
+			}
+			defs = append(defs, found...)
+		}
+	}
+	return defs, nil
+}
+
+// defSearchPythonDeps looks symbol up in the site-packages of the virtual
+// environment that --python-env, $VIRTUAL_ENV, or each root's .venv names.
+func defSearchPythonDeps(ctx context.Context, cfg *config.Config, symbol string, roots []workspace.Root, fold bool) ([]deps.Definition, error) {
+	ex, err := symbols.ForParser(cfg.BackendParser)
+	if err != nil {
+		return nil, err
+	}
+	var defs []deps.Definition
+	seen := make(map[string]bool) // Environments searched
+	for _, root := range roots {
+		env, ok := pydeps.FindEnv(defPythonEnv, root.Dir)
+		if !ok || seen[env] {
+			continue
+		}
+		seen[env] = true
+		sites, err := pydeps.SitePackages(env)
+		if err != nil {
+			return nil, fmt.Errorf("--deps: %w", err)
+		}
+		for _, site := range sites {
+			found, err := pydeps.Definitions(ctx, site, symbol, ex, fold)
+			if err != nil {
+				return nil, err
+			}
+			defs = append(defs, found...)
+		}
+	}
+	return defs, nil
+}
+
+// writeDeps prints definitions found in dependencies grep-style, each
+// tagged external with the module or package and version it's from, or as
+// JSON.
+func writeDeps(cmd *cobra.Command, defs []deps.Definition) error {
+	w := cmd.OutOrStdout()
+	if wantJSON() {
+		return writeJSON(w, struct {
+			Results []deps.Definition `json:"results"`
+		}{defs})
+	}
+	color := useColor(cmd, w)
+	for _, d := range defs {
+		tag := "[external: " + d.Origin + "]"
+		if color {
+			tag = ansiDim + tag + ansiReset
+		}
+		fmt.Fprintf(w, "%s:%d:%d: %s  %s\n", d.Path, d.Line, d.Column, d.Text, tag)
+	}
+	return nil
+}
+
+// openCache returns the symbol cache of the repository rooted at dir, or nil
+// when caching is off or the cache can't be opened, which just means a cold
+// run.
+func openCache(dir string) *cache.Cache {
+	if noCache {
+		return nil
+	}
+	c, err := cache.Open(dir)
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+// saveCache persists the symbol cache, warning rather than failing on error
+// since a lost cache write only costs the next run a rescan.
+func saveCache(w io.Writer, c *cache.Cache) {
+	if err := c.Save(); err != nil {
+		fmt.Fprintf(w, "warning: could not save cache: %v\n", err)
+	}
+}
+
+// suggestScanFiles caps the files defSuggest reads in a root without a
+// current symbol index, so a misspelled symbol fails fast in a huge tree.
+const suggestScanFiles = 2000
+
+// defSuggest returns the names defined in roots that symbol may be a
+// misspelling of, closest first: from each root's symbol index when it's
+// current, or else from the definitions in the first suggestScanFiles files
+// opts walks, which come from the symbol cache when it still holds them and
+// go into it when not. It stops early, with the names read so far, when ctx
+// is done.
+func defSuggest(ctx context.Context, symbol string, roots []workspace.Root, opts walk.Options) []string {
+	var names []string
+	for _, root := range roots {
+		if !noCache {
+			if indexed, err := cache.Complete(root.Dir, "", math.MaxInt); err == nil {
+				for _, n := range indexed {
+					names = append(names, n.Name)
+				}
+				continue
+			}
+		}
+		c := openCache(root.Dir)
+		walkCtx, stop := context.WithCancel(ctx)
+		opts.Root = root.Dir
+		files := 0
+		// The walk ends with an error when it's stopped, at the cap or by
+		// ctx; either way, the names read so far are what there is
+		_, _ = walk.Walk(walkCtx, opts, func(f walk.File) error {
+			if files++; files >= suggestScanFiles {
+				stop()
+			}
+			if c != nil && f.Info != nil {
+				if cached, ok := c.Lookup(f.Path, f.Info); ok {
+					for _, s := range cached {
+						names = append(names, s.Name)
+					}
+					return nil
+				}
+			}
+			// A file that can't be read has no names to offer
+			syms, err := symbols.ExtractFile(symbols.Regex{}, f.Path, f.Language)
+			if err != nil {
+				return nil
+			}
+			if c != nil && f.Info != nil {
+				c.Put(f.Path, f.Info, cache.FromSymbols(syms))
+			}
+			for _, s := range syms {
+				names = append(names, s.Name)
+			}
+			return nil
+		})
+		stop()
+		if c != nil {
+			_ = c.Save() // A lost write only costs the next miss a rescan
+		}
+	}
+	return similar.Names(symbol, names, similar.Limit)
+}
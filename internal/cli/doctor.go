@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/backend"
+	"github.com/bashhack/cdx/internal/config"
+	"github.com/bashhack/cdx/internal/gopls"
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+var doctorBackend string
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check how cdx is set up to search",
+	Long: `Check how cdx is set up to search: the config files in effect, which
+search backends are installed and which one def will use, whether gopls is
+available for --precise, and the plugin languages loaded from
+languages/*.yaml in the user config directory and .cdx/languages/.
+
+Exits with code 1 when the configured backend isn't available, saying what
+to install or set instead; JSON output gives that as backend_fix.`,
+	Args: cobra.NoArgs,
+	RunE: runDoctor,
+}
+
+func init() {
+	doctorCmd.Flags().StringVar(&doctorBackend, "backend", "", "Check this backend instead of the configured one")
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// backendStatus is the JSON representation of one backend's availability.
+type backendStatus struct {
+	Name      string `json:"name"`
+	Path      string `json:"path,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Available bool   `json:"available"`
+}
+
+// pluginLanguage is the JSON representation of a loaded plugin language.
+type pluginLanguage struct {
+	Name       string   `json:"name"`
+	File       string   `json:"file"`
+	Extensions []string `json:"extensions"`
+	Filenames  []string `json:"filenames,omitempty"`
+	Builtin    bool     `json:"builtin"` // Whether it replaces a built-in language
+}
+
+// doctorReport is the JSON representation of doctor's checks.
+type doctorReport struct {
+	Backend      string           `json:"backend,omitempty"` // Chosen backend
+	BackendError string           `json:"backend_error,omitempty"`
+	BackendFix   string           `json:"backend_fix,omitempty"` // What to install or set instead
+	Gopls        string           `json:"gopls,omitempty"`       // Path, when installed
+	ConfigFiles  []string         `json:"config_files"`
+	Backends     []backendStatus  `json:"backends"` // In auto detection order
+	Languages    []pluginLanguage `json:"plugin_languages"`
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	cfg := commandConfig(cmd)
+	report := doctorReport{ConfigFiles: append([]string{}, cfg.Files...)}
+
+	for _, a := range backend.Detect() {
+		status := backendStatus{Name: string(a.Name), Path: a.Path, Available: a.Available()}
+		if a.Err != nil {
+			status.Error = a.Err.Error()
+		}
+		report.Backends = append(report.Backends, status)
+	}
+	choice, backendErr := resolveBackend(cmd, doctorBackend, cfg)
+	var unavailable *backend.UnavailableError
+	if errors.As(backendErr, &unavailable) {
+		report.BackendFix = unavailable.Fix()
+	}
+	if backendErr != nil {
+		report.BackendError = backendErr.Error()
+	} else {
+		report.Backend = choice.String()
+	}
+	if client, err := gopls.New(""); err == nil {
+		report.Gopls = client.Path
+	}
+	report.Languages = []pluginLanguage{}
+	for _, lp := range patterns.Plugins() {
+		report.Languages = append(report.Languages, pluginLanguage{
+			Name:       string(lp.Language),
+			File:       lp.Source,
+			Extensions: append([]string{}, lp.Extensions...),
+			Filenames:  lp.Filenames,
+			Builtin:    patterns.IsBuiltin(lp.Language),
+		})
+	}
+
+	w := cmd.OutOrStdout()
+	if wantJSON() {
+		if err := writeJSON(w, report); err != nil {
+			return err
+		}
+	} else {
+		writeDoctor(w, cfg, report)
+	}
+
+	if backendErr != nil {
+		return ExitError{Code: 1, Err: backendErr}
+	}
+	return nil
+}
+
+// writeDoctor renders doctor's checks for a human.
+func writeDoctor(w io.Writer, cfg *config.Config, report doctorReport) {
+	if len(report.ConfigFiles) == 0 {
+		fmt.Fprintln(w, "config:   none (using defaults)")
+	}
+	for _, file := range report.ConfigFiles {
+		fmt.Fprintf(w, "config:   %s\n", file)
+	}
+
+	if report.BackendError != "" {
+		fmt.Fprintf(w, "backend:  error: %s\n", report.BackendError)
+	} else {
+		fmt.Fprintf(w, "backend:  %s\n", report.Backend)
+	}
+	for _, b := range report.Backends {
+		switch {
+		case !b.Available:
+			fmt.Fprintf(w, "  %-7s not found\n", b.Name)
+		case b.Path == "":
+			fmt.Fprintf(w, "  %-7s built in\n", b.Name)
+		default:
+			fmt.Fprintf(w, "  %-7s %s\n", b.Name, b.Path)
+		}
+	}
+
+	if report.Gopls != "" {
+		fmt.Fprintf(w, "gopls:    %s (go_backend: %s)\n", report.Gopls, cfg.GoBackend)
+	} else {
+		fmt.Fprintln(w, "gopls:    not installed; --precise falls back to regex")
+	}
+
+	if len(report.Languages) == 0 {
+		fmt.Fprintln(w, "plugins:  none")
+	}
+	for _, lang := range report.Languages {
+		files := strings.Join(append(slices.Clone(lang.Extensions), lang.Filenames...), " ")
+		replaces := ""
+		if lang.Builtin {
+			replaces = ", replacing the built-in language"
+		}
+		fmt.Fprintf(w, "plugins:  %s (%s) from %s%s\n", lang.Name, files, lang.File, replaces)
+	}
+}
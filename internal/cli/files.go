@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/cache"
+	"github.com/bashhack/cdx/internal/config"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/walk"
+)
+
+var (
+	filesLang        string
+	filesMaxFileSize string
+	filesStats       bool
+	filesBinary      bool
+	filesSkipped     bool
+	filesTracked     bool
+	filesUntracked   bool
+	filesFollow      bool
+)
+
+var filesCmd = &cobra.Command{
+	Use:   "files",
+	Short: "List the files cdx searches",
+	Long: `List the files cdx searches, after applying the built-in skip list,
+.gitignore, and .cdxignore rules.
+
+Use --stats to see how many paths each ignore source excluded, which helps
+explain why a file isn't being searched, and how long the walk took.
+
+Directory listings are cached between runs, so a walk only reads the
+directories that changed since the last one; walk_cache_ttl sets how long
+they're trusted before every directory is read again, and --no-cache
+reads them all.
+
+Examples:
+  cdx files                # List every searchable file
+  cdx files --lang=py      # List Python files only
+  cdx files --stats        # Show exclusion counts per ignore source
+  cdx files --skipped      # List files skipped for exceeding the size limit`,
+	Args: cobra.NoArgs,
+	RunE: runFiles,
+}
+
+func init() {
+	filesCmd.Flags().StringVarP(&filesLang, "lang", "l", "", "Force language ("+builtinLangs+", or all to ignore default_lang)")
+	filesCmd.Flags().BoolVar(&filesStats, "stats", false, "Print walk statistics to stderr")
+	filesCmd.Flags().BoolVar(&filesBinary, "binary", false, "Include files that look binary")
+	filesCmd.Flags().StringVar(&filesMaxFileSize, "max-filesize", "", "Skip files larger than this (e.g. 512K, 10M; 0 for unlimited)")
+	filesCmd.Flags().BoolVar(&filesTracked, "tracked", false, "List only files tracked by git")
+	filesCmd.Flags().BoolVar(&filesUntracked, "include-untracked", false, "With --tracked, also list untracked files git doesn't ignore")
+	filesCmd.Flags().BoolVarP(&filesFollow, "follow", "L", false, "Follow symlinks, listing each file once")
+	filesCmd.Flags().BoolVar(&filesSkipped, "skipped", false, "List files skipped for exceeding the size limit instead")
+
+	rootCmd.AddCommand(filesCmd)
+}
+
+// fileEntry is the JSON representation of a listed file.
+type fileEntry struct {
+	Path     string `json:"path"`
+	Language string `json:"language"`
+}
+
+func runFiles(cmd *cobra.Command, args []string) error {
+	cfg := commandConfig(cmd)
+	roots, base, err := resolveRoots(cmd, cfg)
+	if err != nil {
+		return err
+	}
+	exclude, err := excludeRules(cfg)
+	if err != nil {
+		return err
+	}
+	maxFileSize, err := resolveMaxFileSize(cmd, filesMaxFileSize, cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := searchContext(cmd)
+	defer cancel()
+
+	langs, err := resolveLangs(cmd, filesLang, cfg)
+	if err != nil {
+		return err
+	}
+
+	// Each root is walked on its own, so its ignore files apply to it
+	var entries []fileEntry
+	stats := make([]walk.Stats, len(roots))
+	for i, root := range roots {
+		paths, err := trackedPaths(ctx, cmd, root.Dir, filesTracked, filesUntracked, cfg)
+		if err != nil {
+			return err
+		}
+		opts := walk.Options{
+			Root:           root.Dir,
+			Paths:          paths,
+			Exclude:        exclude,
+			MaxFileSize:    maxFileSize,
+			IncludeBinary:  filesBinary,
+			FollowSymlinks: filesFollow,
+			Languages:      langs.Langs,
+		}
+		if paths == nil {
+			opts.Listings = walkListings(cfg, root.Dir)
+		}
+		var files []walk.File
+		files, stats[i], err = walk.Files(ctx, opts)
+		if err != nil {
+			return err
+		}
+		saveListings(opts.Listings)
+
+		if filesSkipped {
+			for _, rel := range stats[i].Oversized {
+				lang := patterns.DetectFile(rel)
+				entries = append(entries, fileEntry{Path: showPath(root.RelTo(base, rel)), Language: string(lang)})
+			}
+		} else {
+			for _, f := range files {
+				entries = append(entries, fileEntry{Path: showPath(root.RelTo(base, f.Rel)), Language: string(f.Language)})
+			}
+		}
+	}
+	if entries == nil {
+		entries = []fileEntry{}
+	}
+
+	w := cmd.OutOrStdout()
+	if wantJSON() {
+		if err := writeJSON(w, entries); err != nil {
+			return err
+		}
+	} else {
+		for _, e := range entries {
+			fmt.Fprintln(w, e.Path)
+		}
+	}
+
+	if filesStats {
+		fmt.Fprintf(cmd.ErrOrStderr(), "lang:     %s\n", langs)
+		for i, root := range roots {
+			fmt.Fprintf(cmd.ErrOrStderr(), "root:     %s\n", describeRoot(root))
+			writeWalkStats(cmd.ErrOrStderr(), stats[i])
+		}
+	}
+	return nil
+}
+
+// walkListings returns the directory listings recorded by earlier walks of
+// the root dir, or nil when caching is off or they can't be used.
+func walkListings(cfg *config.Config, dir string) *walk.Listings {
+	if noCache {
+		return nil
+	}
+	ttl, err := cfg.WalkCacheLifetime()
+	if err != nil || ttl == 0 {
+		return nil
+	}
+	file, err := cache.ListingsFile(dir)
+	if err != nil {
+		return nil
+	}
+	return walk.LoadListings(file, ttl)
+}
+
+// saveListings records the listings a walk read for the next one. Failing
+// to only costs the next walk the time to read them again, so it's silent.
+func saveListings(l *walk.Listings) {
+	if l != nil {
+		_ = l.Save()
+	}
+}
+
+// writeWalkStats prints a human-readable walk summary.
+func writeWalkStats(w io.Writer, stats walk.Stats) {
+	fmt.Fprintf(w, "files:    %d (%d directories walked)\n", stats.Files, stats.Dirs)
+	walked := stats.Elapsed.Round(time.Microsecond).String()
+	if stats.Listed > 0 {
+		walked += fmt.Sprintf(" (%d directories unchanged since the last walk)", stats.Listed)
+	}
+	fmt.Fprintf(w, "walk:     %s\n", walked)
+	if stats.Binary > 0 {
+		fmt.Fprintf(w, "skipped:  %d binary\n", stats.Binary)
+	}
+	if stats.Duplicates > 0 {
+		fmt.Fprintf(w, "skipped:  %d reached again through symlinks\n", stats.Duplicates)
+	}
+	if len(stats.Oversized) > 0 {
+		fmt.Fprintf(w, "skipped:  %d over the size limit (list with --skipped)\n", len(stats.Oversized))
+	}
+
+	sources := make([]string, 0, len(stats.Excluded))
+	for source := range stats.Excluded {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		fmt.Fprintf(w, "excluded: %d by %s\n", stats.Excluded[source], source)
+	}
+}
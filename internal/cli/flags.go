@@ -0,0 +1,519 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/backend"
+	"github.com/bashhack/cdx/internal/config"
+	"github.com/bashhack/cdx/internal/generated"
+	"github.com/bashhack/cdx/internal/git"
+	"github.com/bashhack/cdx/internal/ignore"
+	"github.com/bashhack/cdx/internal/pager"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/scan"
+	"github.com/bashhack/cdx/internal/termcolor"
+	"github.com/bashhack/cdx/internal/testfiles"
+	"github.com/bashhack/cdx/internal/workspace"
+	"github.com/bashhack/cdx/pkg/cdx"
+)
+
+// noConfigAnnotation marks commands that run without loading the config,
+// so a broken config file can't stop them.
+const noConfigAnnotation = "cdx:no-config"
+
+// noPagerAnnotation marks commands whose output must go straight to stdout,
+// such as a protocol another program reads, whatever --pager says.
+const noPagerAnnotation = "cdx:no-pager"
+
+// configKey is the context key under which the loaded config is stored.
+type configKey struct{}
+
+// loadCommandConfig loads the plugin languages and the configuration once
+// per invocation, before the command runs, prints its warnings to stderr,
+// registers its extension mappings and custom definition patterns so every
+// command sees the same registry, and stores it in the command's context
+// for commandConfig.
+func loadCommandConfig(cmd *cobra.Command, args []string) error {
+	if cmd.Annotations[noConfigAnnotation] != "" {
+		return nil
+	}
+	// The config can map extensions to plugin languages, so they come first
+	plugins, err := config.LoadLanguages(config.LanguageDirs()...)
+	if err != nil {
+		return err
+	}
+	patterns.SetPlugins(plugins)
+	cfg, err := config.LoadFrom(configPath, profileName)
+	if err != nil {
+		return err
+	}
+	for _, w := range cfg.Warnings {
+		fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", w)
+	}
+	exts, err := cfg.Extensions()
+	if err != nil {
+		return err
+	}
+	defs, err := cfg.CustomDefinitions()
+	if err != nil {
+		return err
+	}
+	patterns.SetExtensions(exts)
+	patterns.SetCustom(defs)
+	if err := applyConfigDefaults(cmd, cfg); err != nil {
+		return err
+	}
+	if err := startPager(cmd); err != nil {
+		return err
+	}
+	cmd.SetContext(context.WithValue(cmd.Context(), configKey{}, cfg))
+	return nil
+}
+
+// configFlags maps flags to the settings that supply their defaults.
+var configFlags = map[string]string{
+	"output":    "output_format",
+	"context":   "context_lines",
+	"timeout":   "timeout",
+	"pager":     "pager",
+	"max-nodes": "max_caller_nodes",
+}
+
+// applyConfigDefaults sets each flag in configFlags that cmd has, and that
+// wasn't given on the command line, to its setting's value. Only settings a
+// config file, profile, or CDX_* variable actually set are applied, so an
+// unconfigured flag keeps its own default.
+func applyConfigDefaults(cmd *cobra.Command, cfg *config.Config) error {
+	values := make(map[string]string)
+	for _, s := range cfg.Settings() {
+		values[s.Key] = fmt.Sprint(s.Value)
+	}
+	for name, key := range configFlags {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || flag.Changed || cfg.Source(key) == config.SourceDefault {
+			continue
+		}
+		// Value.Set leaves the flag unchanged, so it still reads as a default
+		if err := flag.Value.Set(values[key]); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// startPager sends cmd's output through the pager when --pager, or the
+// pager setting it defaults to, asks for one.
+func startPager(cmd *cobra.Command) error {
+	out := cmd.OutOrStdout()
+	// --pick hands the terminal to fzf or its own prompt instead
+	if pickFlag || cmd.Annotations[noPagerAnnotation] != "" || !pager.Wanted(pagerFlag, termcolor.IsTerminal(out)) {
+		return nil
+	}
+	command := pager.Command(os.LookupEnv)
+	if command == nil {
+		return nil
+	}
+	p, err := pager.Start(command, out)
+	if err != nil {
+		return err
+	}
+	activePager = p
+	cmd.SetOut(p)
+	return nil
+}
+
+// commandConfig returns the configuration loadCommandConfig loaded for cmd.
+func commandConfig(cmd *cobra.Command) *config.Config {
+	if cfg, ok := cmd.Context().Value(configKey{}).(*config.Config); ok {
+		return cfg
+	}
+	// Only commands annotated to skip loading get here
+	return config.DefaultConfig()
+}
+
+// resolveMaxFileSize returns the per-file size cap in bytes, preferring the
+// --max-filesize flag when it was set explicitly over the configured value.
+func resolveMaxFileSize(cmd *cobra.Command, flagValue string, cfg *config.Config) (int64, error) {
+	value, source := cfg.MaxFileSize, "max_file_size"
+	if cmd.Flags().Changed("max-filesize") {
+		value, source = flagValue, "--max-filesize"
+	}
+	size, err := config.ParseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", source, err)
+	}
+	return size, nil
+}
+
+// resolveMaxLineLength returns how many bytes of each line are searched,
+// from the max_line_length setting, with -1 meaning unlimited.
+func resolveMaxLineLength(cfg *config.Config) (int, error) {
+	size, err := config.ParseSize(cfg.MaxLineLength)
+	if err != nil {
+		return 0, fmt.Errorf("max_line_length: %w", err)
+	}
+	if size == 0 {
+		return -1, nil
+	}
+	return int(min(size, math.MaxInt32)), nil // #nosec G115 -- clamped to MaxInt32
+}
+
+// resolveJobs returns the effective scanner worker count, preferring --jobs
+// when it was set explicitly over the jobs config setting.
+func resolveJobs(cmd *cobra.Command, cfg *config.Config) (int, error) {
+	value, source := cfg.Jobs, "jobs"
+	if cmd.Flags().Changed("jobs") {
+		value, source = jobs, "--jobs"
+	}
+	if value < 0 {
+		return 0, fmt.Errorf("%s: must be 0 (automatic) or a positive count, got %d", source, value)
+	}
+	return scan.Workers(value), nil
+}
+
+// resolveRoot returns where a search starts and the working directory that
+// result paths are shown relative to. Searches cover the enclosing repository
+// unless --cwd-only or search_root: cwd limits them to the working directory.
+func resolveRoot(cmd *cobra.Command, cfg *config.Config) (workspace.Root, string, error) {
+	// If Getwd fails (e.g., the directory was deleted), "." is semantically
+	// equivalent and this edge case doesn't warrant logging infrastructure
+	cwd, err := os.Getwd()
+	if err != nil {
+		cwd = "."
+	}
+
+	mode := cfg.SearchRoot
+	if cmd.Flags().Changed("cwd-only") && cwdOnly {
+		mode = "cwd"
+	}
+	switch mode {
+	case "", "repo":
+		root, err := workspace.Find(cwd)
+		return root, cwd, err
+	case "cwd":
+		return workspace.Root{Dir: cwd}, cwd, nil
+	default:
+		return workspace.Root{}, "", fmt.Errorf("invalid search_root %q (want repo or cwd)", cfg.SearchRoot)
+	}
+}
+
+// resolveRoots returns every root a search covers and the directory result
+// paths are shown relative to. The roots setting adds directories to the
+// root resolveRoot picks, or replaces it under roots_mode: replace, unless
+// --cwd-only limits the search to the working directory. With more than one
+// root, paths are relative to the roots' common ancestor, so each says which
+// root it's in. A root that isn't a directory is skipped with a warning, and
+// one inside a root already searched is skipped quietly.
+func resolveRoots(cmd *cobra.Command, cfg *config.Config) ([]workspace.Root, string, error) {
+	root, cwd, err := resolveRoot(cmd, cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	dirs, err := cfg.SearchRoots()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(dirs) == 0 || (cmd.Flags().Changed("cwd-only") && cwdOnly) {
+		return []workspace.Root{root}, cwd, nil
+	}
+
+	var roots []workspace.Root
+	if cfg.RootsMode != "replace" {
+		roots = append(roots, root)
+	}
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			fmt.Fprintf(cmd.ErrOrStderr(), "warning: roots: skipping %s: not a directory\n", dir)
+			continue
+		}
+		if slices.ContainsFunc(roots, func(r workspace.Root) bool { return workspace.Within(r.Dir, dir) }) {
+			continue
+		}
+		roots = append(roots, workspace.Root{Dir: dir})
+	}
+
+	switch len(roots) {
+	case 0:
+		return nil, "", errors.New("roots: none of the configured roots is a directory")
+	case 1:
+		return roots, cwd, nil
+	}
+	common := make([]string, len(roots))
+	for i, r := range roots {
+		common[i] = r.Dir
+	}
+	base := workspace.CommonDir(common)
+	if base == "" {
+		base = cwd
+	}
+	return roots, base, nil
+}
+
+// describeRoot explains a search root for --stats.
+func describeRoot(root workspace.Root) string {
+	if root.Marker == "" {
+		return root.Dir
+	}
+	return fmt.Sprintf("%s (found %s)", root.Dir, root.Marker)
+}
+
+// excludeRules merges the exclude_dirs and exclude_globs settings with any
+// --exclude patterns. The flags come last, so "!pattern" can re-include a
+// path the config excludes. On Windows, a pattern may separate directories
+// with backslashes, as paths there do.
+func excludeRules(cfg *config.Config) ([]ignore.Rule, error) {
+	rules, err := cfg.ExcludeRules()
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range excludePatterns {
+		rule, err := ignore.CompileRule(filepath.ToSlash(pattern), "", "--exclude")
+		if err != nil {
+			return nil, fmt.Errorf("--exclude: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// exclusions is excludeRules for a cdx.Query: the exclude setting's patterns
+// and then the --exclude flags', once they're known to compile.
+func exclusions(cfg *config.Config) ([]cdx.Exclusion, error) {
+	if _, err := excludeRules(cfg); err != nil {
+		return nil, err
+	}
+	var excl []cdx.Exclusion
+	for _, e := range cfg.Exclusions() {
+		excl = append(excl, cdx.Exclusion{Pattern: e.Pattern, Source: e.Source})
+	}
+	for _, pattern := range excludePatterns {
+		excl = append(excl, cdx.Exclusion{Pattern: filepath.ToSlash(pattern), Source: "--exclude"})
+	}
+	return excl, nil
+}
+
+// langAll is the --lang value that searches every language, overriding
+// default_lang for one invocation.
+const langAll = "all"
+
+// builtinLangs lists the built-in languages' names for the --lang flags'
+// help.
+const builtinLangs = "go, ts, js, py, rust, c, cpp, ruby, php, kotlin, swift, csharp, scala, elixir, zig, lua"
+
+// langFilter is the language restriction in effect for a search.
+type langFilter struct {
+	Source string              // "--lang" or the like, "default_lang", or "" when unrestricted
+	Langs  []patterns.Language // nil means every language
+}
+
+// resolveLangs decides which languages to search: --lang when given (with
+// "all" lifting any default), otherwise the default_lang setting.
+func resolveLangs(cmd *cobra.Command, flagValue string, cfg *config.Config) (langFilter, error) {
+	if !cmd.Flags().Changed("lang") {
+		flagValue = ""
+	}
+	return langsFor(flagValue, "--lang", cfg)
+}
+
+// langsFor decides which languages to search: value, as --lang takes it, as
+// given by source, when it isn't empty, otherwise the default_lang setting.
+func langsFor(value, source string, cfg *config.Config) (langFilter, error) {
+	if value != "" {
+		if value == langAll {
+			return langFilter{}, nil
+		}
+		lang := patterns.Language(value)
+		if patterns.ForLanguage(lang) == nil {
+			return langFilter{}, fmt.Errorf("unknown language %q", value)
+		}
+		return langFilter{Langs: []patterns.Language{lang}, Source: source}, nil
+	}
+
+	langs, err := cfg.DefaultLanguages()
+	if err != nil || len(langs) == 0 {
+		return langFilter{}, err
+	}
+	return langFilter{Langs: langs, Source: "default_lang"}, nil
+}
+
+// Includes reports whether the filter allows lang.
+func (f langFilter) Includes(lang patterns.Language) bool {
+	return f.Langs == nil || slices.Contains(f.Langs, lang)
+}
+
+// String describes the filter for --stats, flagging a default_lang filter
+// since it narrows searches without anything on the command line saying so.
+func (f langFilter) String() string {
+	if f.Langs == nil {
+		return langAll
+	}
+	desc := f.names()
+	if f.Source == "default_lang" {
+		return desc + " (from default_lang; --lang all searches every language)"
+	}
+	return desc
+}
+
+// names lists the filter's languages, comma-separated.
+func (f langFilter) names() string {
+	names := make([]string, len(f.Langs))
+	for i, l := range f.Langs {
+		names[i] = string(l)
+	}
+	return strings.Join(names, ", ")
+}
+
+// warnDefaultLang points out, after a search came up empty, that default_lang
+// narrowed it, since nothing on the command line says so.
+func warnDefaultLang(cmd *cobra.Command, f langFilter) {
+	if f.Source == "default_lang" {
+		fmt.Fprintf(cmd.ErrOrStderr(), "note: only searched %s (default_lang); use --lang all to search every language\n", f.names())
+	}
+}
+
+// resolveMaxResults returns the result cap, preferring --max-results when it
+// was set explicitly over max_results, and the command's own default when
+// neither is set. Zero means unlimited.
+func resolveMaxResults(cmd *cobra.Command, flagValue int, cfg *config.Config, fallback int) (int, error) {
+	value, source := fallback, ""
+	switch {
+	case cmd.Flags().Changed("max-results"):
+		value, source = flagValue, "--max-results"
+	case cfg.MaxResults != 0:
+		value, source = cfg.MaxResults, "max_results"
+	}
+	if value < 0 {
+		return 0, fmt.Errorf("%s: must be 0 (unlimited) or a positive count, got %d", source, value)
+	}
+	return value, nil
+}
+
+// resolveIncludeTests reports whether test files are searched, preferring
+// --include-tests when it was set explicitly over include_tests, and the
+// command's own default when neither is set.
+func resolveIncludeTests(cmd *cobra.Command, flagValue bool, cfg *config.Config, fallback bool) bool {
+	switch {
+	case cmd.Flags().Changed("include-tests"):
+		return flagValue
+	case cfg.IncludeTests != nil:
+		return *cfg.IncludeTests
+	}
+	return fallback
+}
+
+// generatedFiles returns the detector for the generated files searches
+// leave out unless --generated, recognizing names by generated_patterns.
+func generatedFiles(cfg *config.Config) *generated.Detector {
+	// A config whose patterns don't compile never loaded, so the error
+	// here is always nil
+	d, _ := cfg.Generated()
+	return d
+}
+
+// testFiles returns the classifier for the test files searches leave out or
+// keep to, applying test_paths over each language's conventions.
+func testFiles(cfg *config.Config) *testfiles.Classifier {
+	// As with generatedFiles, a config whose patterns don't compile never
+	// loaded
+	c, _ := cfg.Tests()
+	return c
+}
+
+// resolveBackend picks def's text search backend, preferring --backend when
+// it was set explicitly over the backend setting. A backend asked for by
+// name that isn't installed is an error, not a fallback.
+func resolveBackend(cmd *cobra.Command, flagValue string, cfg *config.Config) (backend.Choice, error) {
+	value, source := cfg.Backend, "backend:"
+	if cmd.Flags().Changed("backend") {
+		value, source = flagValue, "--backend"
+	}
+	// An invalid backend setting fails config validation, so only the
+	// flag can be invalid here
+	want, err := backend.Parse(value)
+	if err != nil {
+		return backend.Choice{}, fmt.Errorf("--backend: %w", err)
+	}
+	return backend.Choose(want, source)
+}
+
+// trackedPaths returns the files git knows about under dir when --tracked,
+// --include-untracked, or tracked_only is in effect, and nil otherwise so the
+// caller falls back to a directory walk.
+func trackedPaths(ctx context.Context, cmd *cobra.Command, dir string, tracked, includeUntracked bool, cfg *config.Config) ([]string, error) {
+	if !cmd.Flags().Changed("tracked") {
+		tracked = cfg.TrackedOnly
+	}
+	if !tracked && !includeUntracked {
+		return nil, nil
+	}
+
+	paths, err := git.LsFiles(ctx, dir, includeUntracked)
+	if err != nil {
+		return nil, fmt.Errorf("--tracked: %w", err)
+	}
+	// An empty repository still means "search nothing", not "walk everything"
+	if paths == nil {
+		paths = []string{}
+	}
+	return paths, nil
+}
+
+// resolveCase decides whether symbol should match case-insensitively and
+// describes the decision for --stats. -i and --case-sensitive win outright;
+// otherwise --smart-case (or smart_case in config) folds case only for
+// all-lowercase symbols.
+func resolveCase(cmd *cobra.Command, symbol string, smartCase bool, cfg *config.Config) (ignoreCase bool, mode string) {
+	flags := cmd.Flags()
+	switch {
+	case flags.Changed("ignore-case"):
+		return true, "insensitive (--ignore-case)"
+	case flags.Changed("case-sensitive"):
+		return false, "sensitive (--case-sensitive)"
+	}
+
+	if !flags.Changed("smart-case") {
+		smartCase = cfg.SmartCase
+	}
+	if !smartCase {
+		return false, "sensitive"
+	}
+	if patterns.SmartCase(symbol) {
+		return true, "insensitive (smart case: query is all lowercase)"
+	}
+	return false, "sensitive (smart case: query has uppercase)"
+}
+
+// useTags reports whether def may answer from a tags file. --no-tags always
+// wins; otherwise the use_tags config setting decides.
+func useTags(cmd *cobra.Command, cfg *config.Config) bool {
+	if cmd.Flags().Changed("no-tags") {
+		noTags, err := cmd.Flags().GetBool("no-tags")
+		return err == nil && !noTags
+	}
+	return cfg.UseTags
+}
+
+// usePrecise reports whether Go symbols should be resolved with gopls.
+// --precise wins; otherwise the go_backend config setting decides.
+func usePrecise(cmd *cobra.Command, cfg *config.Config) (bool, error) {
+	if cmd.Flags().Changed("precise") {
+		return cmd.Flags().GetBool("precise")
+	}
+	switch cfg.GoBackend {
+	case "", "regex":
+		return false, nil
+	case "gopls":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid go_backend %q (want regex or gopls)", cfg.GoBackend)
+	}
+}
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+// exitCodesAnnotation lists the exit codes a command returns besides 0 and
+// 1, as exitCodes encodes them, for gen-docs to document.
+const exitCodesAnnotation = "cdx:exit-codes"
+
+// exitCode is an exit code and what it tells a script.
+type exitCode struct {
+	meaning string
+	code    int
+}
+
+// The exit codes commands share.
+var (
+	exitCodeNotFound = exitCode{code: 3, meaning: "Nothing matched"}
+	exitCodePartial  = exitCode{code: exitPartial, meaning: "Interrupted or timed out; the results printed are partial"}
+)
+
+// exitCodes encodes codes for exitCodesAnnotation, one "code<TAB>meaning"
+// per line.
+func exitCodes(codes ...exitCode) string {
+	lines := make([]string, len(codes))
+	for i, c := range codes {
+		lines[i] = strconv.Itoa(c.code) + "\t" + c.meaning
+	}
+	return strings.Join(lines, "\n")
+}
+
+// commandExitCodes returns the exit codes cmd documents: 0 and 1, which
+// every command has, then those in its exitCodesAnnotation.
+func commandExitCodes(cmd *cobra.Command) ([]exitCode, error) {
+	codes := []exitCode{{code: 0, meaning: "Success"}, {code: 1, meaning: "Error"}}
+	value := cmd.Annotations[exitCodesAnnotation]
+	if value == "" {
+		return codes, nil
+	}
+	for line := range strings.SplitSeq(value, "\n") {
+		code, meaning, ok := strings.Cut(line, "\t")
+		n, err := strconv.Atoi(code)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("%s: malformed %s annotation line %q", cmd.CommandPath(), exitCodesAnnotation, line)
+		}
+		codes = append(codes, exitCode{code: n, meaning: meaning})
+	}
+	return codes, nil
+}
+
+var (
+	genDocsFormat string
+	genDocsOut    string
+)
+
+var genDocsCmd = &cobra.Command{
+	Use:   "gen-docs --out <dir>",
+	Short: "Generate man pages or a markdown or reST reference",
+	Long: `Generate a page for each command from the command tree: its usage, the
+Long text with its examples, its flags, and its exit codes.
+
+--format picks man (section 1), markdown, or rest (reStructuredText). Pages
+are written to --out, which is created if need be, one per command.
+
+Examples:
+  cdx gen-docs --format man --out man/man1
+  cdx gen-docs --out docs/reference`,
+	Args:   cobra.NoArgs,
+	Hidden: true,
+	// Generating docs doesn't read the config, and a broken one shouldn't
+	// stop a package build
+	Annotations: map[string]string{noConfigAnnotation: "true"},
+	RunE:        runGenDocs,
+}
+
+func init() {
+	genDocsCmd.Flags().StringVar(&genDocsFormat, "format", "markdown", "Page format: man, markdown, or rest")
+	genDocsCmd.Flags().StringVar(&genDocsOut, "out", "", "Directory to write the pages to")
+	_ = genDocsCmd.MarkFlagRequired("out")
+	rootCmd.AddCommand(genDocsCmd)
+}
+
+func runGenDocs(cmd *cobra.Command, args []string) error {
+	root := cmd.Root()
+	var gen func() error
+	switch genDocsFormat {
+	case "man":
+		gen = func() error {
+			return doc.GenManTree(root, &doc.GenManHeader{Title: "CDX", Section: "1", Source: "cdx " + Version}, genDocsOut)
+		}
+	case "markdown":
+		gen = func() error { return doc.GenMarkdownTree(root, genDocsOut) }
+	case "rest":
+		gen = func() error { return doc.GenReSTTree(root, genDocsOut) }
+	default:
+		return fmt.Errorf("--format must be man, markdown, or rest, got %q", genDocsFormat)
+	}
+	if err := os.MkdirAll(genDocsOut, 0o750); err != nil {
+		return err
+	}
+	return withExitCodeDocs(root, gen)
+}
+
+// withExitCodeDocs runs gen with an exit codes section added to the Long
+// text of each command under root, since cobra's generators have no place
+// for one of their own, and without the generation date, so that pages only
+// change when the commands do.
+func withExitCodeDocs(root *cobra.Command, gen func() error) error {
+	type saved struct {
+		cmd     *cobra.Command
+		long    string
+		autoGen bool
+	}
+	var restore []saved
+	defer func() {
+		for _, s := range restore {
+			s.cmd.Long, s.cmd.DisableAutoGenTag = s.long, s.autoGen
+		}
+	}()
+
+	var add func(cmd *cobra.Command) error
+	add = func(cmd *cobra.Command) error {
+		codes, err := commandExitCodes(cmd)
+		if err != nil {
+			return err
+		}
+		restore = append(restore, saved{cmd: cmd, long: cmd.Long, autoGen: cmd.DisableAutoGenTag})
+		var b strings.Builder
+		b.WriteString(strings.TrimRight(cmd.Long, "\n"))
+		if b.Len() == 0 {
+			b.WriteString(cmd.Short)
+		}
+		b.WriteString("\n\nExit codes:\n")
+		for _, c := range codes {
+			fmt.Fprintf(&b, "  %d  %s\n", c.code, c.meaning)
+		}
+		cmd.Long = b.String()
+		cmd.DisableAutoGenTag = true
+		for _, sub := range cmd.Commands() {
+			if err := add(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := add(root); err != nil {
+		return err
+	}
+	return gen()
+}
@@ -0,0 +1,564 @@
+package cli
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/cache"
+	"github.com/bashhack/cdx/internal/config"
+	"github.com/bashhack/cdx/internal/git"
+	"github.com/bashhack/cdx/internal/outline"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/scan"
+	"github.com/bashhack/cdx/internal/symbols"
+	"github.com/bashhack/cdx/internal/workspace"
+)
+
+var (
+	outlineLang       string
+	outlineFilename   string
+	outlineDiff       string
+	outlineRev        string
+	outlineDocs       bool
+	outlineMetrics    bool
+	outlineSort       string
+	outlineKinds      []string
+	outlineMinLines   int
+	outlinePublicOnly bool
+)
+
+var outlineCmd = &cobra.Command{
+	Use:   "outline <file | ->",
+	Short: "List the definitions in a file",
+	Long: `List the definitions in a file, in source order, with methods nested under
+their types: a Go method under its receiver's type, even one declared in
+another file; a C++ method defined outside its class under the class it's
+qualified with; a Lua function defined on a table, as in M.name or M:name,
+under the table; a Rust method under the type its impl block is for; and a
+TypeScript, JavaScript, Python, Ruby, PHP, Kotlin, Swift, C#, Scala, Zig, or
+C++ method under the type (or Ruby module or Swift extension) it's indented
+in, as is an Elixir function under its module. Human output indents members
+beneath their parents and marks each kind with a glyph (◆ type, ◇ interface,
+ƒ function, method, or Elixir private function, ≡ const or macro, = var,
+□ namespace).
+
+JSON output has a stable schema for editor plugins and other tools:
+{file, language, symbols, schema_version}, where each symbol has name, kind,
+line, column, end_line, lines, parent, exported, signature, and its members
+as children. Every key is always present, symbols is [] for a file without
+definitions, and kind is one of class, struct, enum, interface, type,
+function, method, constructor, namespace, constant, variable, or other,
+after the LSP symbol kinds; an Elixir private function is a function that
+isn't exported. schema_version changes only when a field is removed or
+changes meaning.
+
+Each definition's extent runs to where the braces opened after it close, or
+in Python (and Scala without braces), to the end of its indented body, and
+in Ruby, Elixir with do, and Lua, to its end; JSON output gives it as
+end_line and lines. Braces in strings and comments don't count, and when the
+braces don't balance, a definition runs until the next one at its level.
+
+--public-only shows just the exported surface, for API review: capitalized
+names in Go, export and export default in TypeScript and JavaScript (and
+class members that aren't private or protected), pub items in Rust, names
+without a leading underscore in Python, what isn't static in C, what isn't
+private or protected in PHP, what isn't private, protected, or internal in
+Kotlin, what's public or open in Swift, what's public or protected in C#,
+what isn't private or protected in Scala, what isn't defp or defmacrop in
+Elixir, pub or export declarations in Zig, and what isn't local in Lua. An
+unexported type is still shown, dimmed, when it has exported members. JSON
+output marks every definition with exported.
+
+--docs follows each definition with the first sentence of its doc comment,
+dimmed, like an index of a package's documentation: the comment lines (//,
+///, or #) or /** */ block right above the definition, or a Python
+docstring. In Go, the definition's name at the start of the comment is left
+out. JSON output always gives it as doc.
+
+--metrics follows each definition with rough measures for spotting outsized
+ones in review, as in [42 lines, depth 4, 9 branches]: the lines it spans,
+how deeply blocks nest in its body, by braces or in Python indentation, and
+how many branching and looping keywords (if, for, case, and the like) it
+has outside comments and strings. JSON output gives them as metrics. --sort
+metric:lines, metric:depth, or metric:branches lists the largest first.
+
+--kind shows just the definitions of the given kinds, as human output names
+them (function, method, type, interface, const, var, component for a React
+component wrapped in memo, forwardRef, or styled in a .tsx or .jsx file, or
+a custom pattern's kind), and --min-lines just those spanning at least that
+many lines. Like --public-only, they keep a type that holds matching
+members, dimmed. --sort orders each level's definitions by line (the
+default), name, or kind (types, interfaces, components, functions, methods,
+consts, then vars), keeping members nested under their types.
+
+A file of "-" is read from standard input, as an editor does to outline an
+unsaved buffer. Its language comes from --lang, or else from the extension
+of --filename, which also names the file in JSON output in place of
+<stdin>. Lines and columns are the same as for the same content in a file.
+Input beyond max_stdin_size in config (8M by default; 0 for no limit) is an
+error.
+
+--diff compares the file with its version at a git revision, as for a code
+review: it lists the definitions added, those removed, and those that moved
+or changed size, matched by name and the type they're in, so a rename is a
+removal and an addition. JSON output has added, removed, and changed arrays.
+When the old version doesn't exist or can't be outlined, every definition
+is added. Differences don't change the exit code. Filters apply to both
+versions.
+
+--rev outlines the file as of a git revision instead, reading it from git's
+object store without checking it out, and names it as file@rev, such as
+server.go@v1.4.0.
+
+` + pickHelp + ` The text of each
+definition is its signature.
+
+Definitions are extracted with the parser selected by backend_parser in
+.cdx.yaml: "regex" (the default) or "tree-sitter", which reports precise
+kinds, ranges, and enclosing types for Go, Python, JavaScript, and Rust and
+is available in builds made with -tags treesitter.
+
+Examples:
+  cdx outline user.go               # List the definitions in user.go
+  cdx outline -l py script          # Force the language
+  cdx outline user.go -o json       # Output as JSON
+  cdx outline api.go --public-only  # Just the exported API
+  cdx outline api.go --docs         # With doc comment summaries
+  cdx outline user.go --kind function --min-lines 50  # The long functions
+  cdx outline api.go --sort name --kind method        # Methods, alphabetically
+  cdx outline api.go --metrics --sort metric:lines    # The biggest first
+  cat buffer | cdx outline - --lang ts -o json        # Outline stdin
+  cdx outline server.go --diff HEAD~1                 # What changed since HEAD~1
+  cdx outline server.go --rev v1.4.0                  # As of a git revision
+  cdx outline server.go --pick                        # Choose one to jump to`,
+	Args: cobra.ExactArgs(1),
+	RunE: runOutline,
+}
+
+func init() {
+	outlineCmd.Flags().StringVarP(&outlineLang, "lang", "l", "", "Force language ("+builtinLangs+")")
+	outlineCmd.Flags().BoolVar(&outlineDocs, "docs", false, "Follow each definition with the first sentence of its doc comment")
+	outlineCmd.Flags().StringVar(&outlineDiff, "diff", "", "Show the definitions added, removed, or changed since this git revision")
+	outlineCmd.Flags().StringVar(&outlineRev, "rev", "", "Outline the file as of this git revision without checking it out")
+	outlineCmd.MarkFlagsMutuallyExclusive("rev", "diff")
+	outlineCmd.Flags().StringVar(&outlineFilename, "filename", "", "Name to report for stdin (-), and detect its language from")
+	outlineCmd.Flags().BoolVar(&outlinePublicOnly, "public-only", false, "Show only exported definitions")
+	outlineCmd.Flags().StringVar(&outlineSort, "sort", outline.ByLine,
+		"Order definitions by line, name, kind, or, largest first, metric:lines, metric:depth, or metric:branches")
+	outlineCmd.Flags().BoolVar(&outlineMetrics, "metrics", false, "Show each definition's lines, nesting depth, and branch count")
+	outlineCmd.Flags().StringSliceVar(&outlineKinds, "kind", nil, "Show only these kinds of definition (e.g. function,type)")
+	outlineCmd.Flags().IntVar(&outlineMinLines, "min-lines", 0, "Show only definitions spanning at least this many lines")
+	outlineCmd.Flags().BoolVar(&pickFlag, "pick", false, "Choose a definition with fzf, or from a numbered list, and print or open it")
+
+	rootCmd.AddCommand(outlineCmd)
+}
+
+func runOutline(cmd *cobra.Command, args []string) error {
+	file := args[0]
+	stdin := file == "-"
+	if outlineFilename != "" && !stdin {
+		return errors.New("--filename applies only when reading stdin (-)")
+	}
+	if outlineDiff != "" && stdin {
+		return errors.New("--diff needs a file, not stdin (-)")
+	}
+	if outlineRev != "" && stdin {
+		return errors.New("--rev needs a file, not stdin (-)")
+	}
+	if pickFlag && (stdin || outlineDiff != "" || outlineRev != "") {
+		return errors.New("--pick needs a file to open, without --diff or --rev")
+	}
+	filter, err := newOutlineFilter(outlineSort, outlineKinds, outlineMinLines, outlinePublicOnly, outlineMetrics)
+	if err != nil {
+		return err
+	}
+
+	cfg := commandConfig(cmd)
+	extractor, err := symbols.ForParser(cfg.BackendParser)
+	if err != nil {
+		return err
+	}
+
+	name := file
+	if stdin {
+		name = cmp.Or(outlineFilename, "<stdin>")
+	}
+	lang := patterns.Language(outlineLang)
+	if lang == patterns.Unknown {
+		lang = patterns.DetectFile(name)
+	}
+	if outlineRev != "" {
+		name = file + "@" + outlineRev
+	}
+	if patterns.ForLanguage(lang) == nil {
+		if stdin && outlineFilename == "" {
+			return errors.New("cannot detect the language of stdin (use --lang)")
+		}
+		return fmt.Errorf("cannot detect language of %s (use --lang)", name)
+	}
+
+	build := func(src []byte) ([]*outline.Node, error) {
+		return filter.build(extractor, src, lang, name, nil)
+	}
+	if outlineDiff != "" {
+		return runOutlineDiff(cmd, file, outlineDiff, lang, build)
+	}
+	// A file on disk fills the symbol index as a def search would
+	if !stdin && outlineRev == "" {
+		if c, record := outlineCache(file, openCache); c != nil {
+			defer saveCache(cmd.ErrOrStderr(), c)
+			build = func(src []byte) ([]*outline.Node, error) {
+				return filter.build(extractor, src, lang, name, record)
+			}
+		}
+	}
+
+	var src []byte
+	switch {
+	case stdin:
+		src, err = readStdin(cmd, cfg)
+	case outlineRev != "":
+		src, err = readRev(cmd.Context(), file, outlineRev)
+	default:
+		src, _, err = scan.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+	tree, err := build(src)
+	if err != nil {
+		return err
+	}
+	outline.Sort(tree, filter.sort)
+
+	w := cmd.OutOrStdout()
+	if pickFlag || wantFzf() {
+		var locs []location
+		for _, n := range outline.Flatten(tree) {
+			if !filter.filtered() || filter.match(n) {
+				locs = append(locs, location{File: name, Line: n.Line, Column: n.Column, Kind: n.Kind, Name: n.Name, Text: n.Signature})
+			}
+		}
+		if pickFlag {
+			return pick(cmd, locs)
+		}
+		writeFzf(w, locs)
+		return nil
+	}
+	if wantJSON() {
+		return writeJSON(w, outline.NewDocument(name, lang, tree))
+	}
+	view := outlineView{docs: outlineDocs, metrics: outlineMetrics, color: useColor(cmd, w)}
+	if filter.filtered() && view.color {
+		view.fade = func(n *outline.Node) bool { return !filter.match(n) }
+	}
+	writeOutline(w, tree, "", view)
+	return nil
+}
+
+// outlineFilter is which of a file's definitions outline shows, in what
+// order, and whether it measures them.
+type outlineFilter struct {
+	sort       string
+	kinds      []string // Lowercase; none means every kind
+	minLines   int
+	publicOnly bool
+	measure    bool
+}
+
+// newOutlineFilter validates outline's filter settings, as --sort, --kind,
+// --min-lines, --public-only, and --metrics give them.
+func newOutlineFilter(sortBy string, kinds []string, minLines int, publicOnly, metrics bool) (outlineFilter, error) {
+	switch sortBy {
+	case outline.ByLine, outline.ByName, outline.ByKind, outline.ByLines, outline.ByDepth, outline.ByBranches:
+	default:
+		return outlineFilter{}, fmt.Errorf("--sort: unknown order %q (want line, name, kind, metric:lines, metric:depth, or metric:branches)", sortBy)
+	}
+	if minLines < 0 {
+		return outlineFilter{}, fmt.Errorf("--min-lines must be at least 0, got %d", minLines)
+	}
+	f := outlineFilter{
+		sort:       sortBy,
+		minLines:   minLines,
+		publicOnly: publicOnly,
+		measure:    metrics || strings.HasPrefix(sortBy, "metric:"),
+	}
+	for _, k := range kinds {
+		f.kinds = append(f.kinds, strings.ToLower(strings.TrimSpace(k)))
+	}
+	return f, nil
+}
+
+// filtered reports whether f leaves any definitions out.
+func (f outlineFilter) filtered() bool {
+	return f.publicOnly || len(f.kinds) > 0 || f.minLines > 0
+}
+
+// match reports whether f shows n for itself, rather than only for its
+// members.
+func (f outlineFilter) match(n *outline.Node) bool {
+	return (!f.publicOnly || n.Exported) &&
+		(len(f.kinds) == 0 || slices.Contains(f.kinds, n.Kind)) &&
+		n.Lines >= f.minLines
+}
+
+// build outlines src, the content of the file name in lang, with
+// extractor, keeping the definitions f shows. It doesn't sort them. record,
+// when set, is passed every definition found, before any are left out.
+func (f outlineFilter) build(extractor symbols.Extractor, src []byte, lang patterns.Language, name string, record func([]symbols.Symbol)) ([]*outline.Node, error) {
+	found, err := symbols.ExtractSource(extractor, src, lang, filepath.Ext(name))
+	if err != nil {
+		return nil, err
+	}
+	if record != nil {
+		record(found)
+	}
+	symbols.FillExtents(found, src, lang)
+	tree := outline.Build(found, src, lang)
+	if f.measure {
+		outline.Measure(tree, src, lang)
+	}
+	if f.filtered() {
+		tree = outline.Filter(tree, f.match)
+	}
+	return tree, nil
+}
+
+// outlineCache returns the symbol cache of the repository holding file,
+// which open returns, and a function that records the definitions found in
+// file in it, for build; the cache is nil when there's none to fill. The
+// file's metadata is read first, so a change while it's outlined leaves the
+// entry stale rather than wrong.
+func outlineCache(file string, open func(dir string) *cache.Cache) (*cache.Cache, func([]symbols.Symbol)) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, nil
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, nil
+	}
+	root, err := workspace.Find(filepath.Dir(abs))
+	if err != nil {
+		return nil, nil
+	}
+	c := open(root.Dir)
+	if c == nil {
+		return nil, nil
+	}
+	return c, func(found []symbols.Symbol) { c.Put(abs, info, cache.FromSymbols(found)) }
+}
+
+// readRev returns the contents of file as of rev, decoded as scan.ReadFile
+// decodes a file on disk.
+func readRev(ctx context.Context, file, rev string) ([]byte, error) {
+	dir := filepath.Dir(file)
+	if _, err := git.ResolveRev(ctx, dir, rev); err != nil {
+		return nil, fmt.Errorf("--rev: %w", err)
+	}
+	data, err := git.Show(ctx, dir, rev, filepath.Base(file))
+	if err != nil {
+		return nil, err
+	}
+	if binary(data) {
+		return nil, fmt.Errorf("%s is binary as of %s", file, rev)
+	}
+	src, _ := scan.Decode(data)
+	return src, nil
+}
+
+// runOutlineDiff prints the definitions added, removed, and moved or resized
+// in file since rev, outlining each version with build. An old version that
+// doesn't exist, is binary, or can't be outlined counts as empty, so every
+// definition is added, as a deleted file has every definition removed.
+func runOutlineDiff(cmd *cobra.Command, file, rev string, lang patterns.Language, build func([]byte) ([]*outline.Node, error)) error {
+	ctx := cmd.Context()
+	dir, base := filepath.Dir(file), filepath.Base(file)
+	if _, err := git.ResolveRev(ctx, dir, rev); err != nil {
+		return err
+	}
+
+	var from []*outline.Node
+	data, err := git.Show(ctx, dir, rev, base)
+	switch {
+	case errors.Is(err, git.ErrNotInRev):
+	case err != nil:
+		return err
+	case binary(data):
+		fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s is binary as of %s; treating every definition as added\n", file, rev)
+	default:
+		src, _ := scan.Decode(data)
+		if from, err = build(src); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "warning: cannot outline %s as of %s: %v; treating every definition as added\n", file, rev, err)
+		}
+	}
+
+	var to []*outline.Node
+	src, _, err := scan.ReadFile(file)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && data != nil:
+		// Deleted since rev
+	case err != nil:
+		return err
+	default:
+		if to, err = build(src); err != nil {
+			return err
+		}
+	}
+
+	changes := outline.Diff(from, to, lang)
+	w := cmd.OutOrStdout()
+	if wantJSON() {
+		return writeJSON(w, changes)
+	}
+	for _, section := range []struct {
+		title  string
+		deltas []outline.Delta
+	}{
+		{"added", changes.Added},
+		{"removed", changes.Removed},
+		{"changed", changes.Changed},
+	} {
+		fmt.Fprintf(w, "%s:\n", section.title)
+		if len(section.deltas) == 0 {
+			fmt.Fprintln(w, "  (none)")
+		}
+		for _, d := range section.deltas {
+			name := d.Name
+			if d.Parent != "" {
+				name = d.Parent + "." + d.Name
+			}
+			span := lineSpan(d.Line, d.EndLine)
+			if d.OldLine > 0 {
+				span = lineSpan(d.OldLine, d.OldEndLine) + " → " + span
+			}
+			fmt.Fprintf(w, "  %-11s %s  %s\n", d.Kind, name, span)
+		}
+	}
+	return nil
+}
+
+// lineSpan formats the lines from start to end, such as "12–20", or "12" for
+// a single line.
+func lineSpan(start, end int) string {
+	if end <= start {
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d–%d", start, end)
+}
+
+// binary reports whether data looks binary, with a NUL byte in its first 8KB
+// and no UTF-16 byte order mark, as the directory walk decides for files.
+func binary(data []byte) bool {
+	head := data[:min(len(data), 8<<10)]
+	if enc := scan.Sniff(head); enc == scan.UTF16LE || enc == scan.UTF16BE {
+		return false
+	}
+	return bytes.IndexByte(head, 0) >= 0
+}
+
+// readStdin reads the command's input, decoded as scan.ReadFile decodes a
+// file, up to the max_stdin_size setting.
+func readStdin(cmd *cobra.Command, cfg *config.Config) ([]byte, error) {
+	limit, err := config.ParseSize(cfg.MaxStdinSize)
+	if err != nil {
+		return nil, fmt.Errorf("max_stdin_size: %w", err)
+	}
+	r := cmd.InOrStdin()
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading stdin: %w", err)
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		return nil, fmt.Errorf("stdin is larger than max_stdin_size (%s)", cfg.MaxStdinSize)
+	}
+	src, _ := scan.Decode(data)
+	return src, nil
+}
+
+// kindGlyphs marks each kind of definition in human outline output; other
+// kinds, such as those of custom patterns, get a bullet.
+var kindGlyphs = map[string]string{
+	"type":      "◆",
+	"interface": "◇",
+	"function":  "ƒ",
+	"component": "ƒ",
+	"method":    "ƒ",
+	"private":   "ƒ",
+	"const":     "≡",
+	"macro":     "≡",
+	"var":       "=",
+	"namespace": "□",
+}
+
+// pluralize formats n of noun, such as "1 line" or "9 branches".
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	if strings.HasSuffix(noun, "ch") {
+		return fmt.Sprintf("%d %ses", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// outlineView is how writeOutline shows definitions.
+type outlineView struct {
+	// fade reports the definitions to dim, there only for the members that
+	// matched a filter; nil dims none
+	fade    func(*outline.Node) bool
+	docs    bool // Follow each definition with its doc summary
+	metrics bool // Follow each definition with its Metrics
+	color   bool // Dim the doc summaries
+}
+
+// writeOutline prints nodes and their children, each level indented two
+// spaces further after the line:column, and each kind after its glyph and
+// each name before the lines it spans, if more than one. A type holding
+// members from another file has no position.
+func writeOutline(w io.Writer, nodes []*outline.Node, indent string, view outlineView) {
+	for _, n := range nodes {
+		glyph, ok := kindGlyphs[n.Kind]
+		if !ok {
+			glyph = "•"
+		}
+		pos := ""
+		if n.Line > 0 {
+			pos = fmt.Sprintf("%d:%d", n.Line, n.Column)
+		}
+		line := fmt.Sprintf("%s\t%s%s %-9s %s", pos, indent, glyph, n.Kind, n.Name)
+		if n.EndLine > n.Line {
+			line += fmt.Sprintf(" (%d–%d)", n.Line, n.EndLine)
+		}
+		if m := n.Metrics; view.metrics && m.Lines > 0 {
+			line += fmt.Sprintf(" [%s, depth %d, %s]", pluralize(m.Lines, "line"), m.Depth, pluralize(m.Branches, "branch"))
+		}
+		if view.docs && n.Doc != "" {
+			if view.color {
+				line += "  " + ansiDim + n.Doc + ansiReset
+			} else {
+				line += "  " + n.Doc
+			}
+		}
+		if view.fade != nil && view.fade(n) {
+			line = ansiDim + line + ansiReset
+		}
+		fmt.Fprintln(w, line)
+		writeOutline(w, n.Children, indent+"  ", view)
+	}
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/cache"
+)
+
+// exitPartial is the exit code for a search that was cut short and printed
+// only the results found so far, so scripts can tell them from complete output.
+const exitPartial = 4
+
+// progressError is implemented by errors that report how far an interrupted
+// search got, such as refs.ErrPartial. total is an estimate, or 0 if unknown.
+type progressError interface {
+	error
+	Progress() (scanned, total int)
+}
+
+// searchContext derives the context a search runs under from the command's
+// context, applying --timeout unless it's zero.
+func searchContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	return withSearchTimeout(cmd.Context())
+}
+
+// withSearchTimeout derives a search's context from ctx, applying --timeout
+// unless it's zero.
+func withSearchTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if searchTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, searchTimeout)
+}
+
+// interrupted reports whether err means a search stopped early because its
+// context was canceled by a signal or ran out of time.
+func interrupted(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// partialError warns on w that the output is incomplete, saying how far the
+// search got when err reports it, and returns the error that makes cdx exit
+// with exitPartial.
+func partialError(w io.Writer, err error) error {
+	msg := "search interrupted"
+	timedOut := errors.Is(err, context.DeadlineExceeded)
+	if timedOut {
+		msg = "search timed out after " + formatDuration(searchTimeout)
+	}
+
+	var p progressError
+	if errors.As(err, &p) {
+		switch scanned, total := p.Progress(); {
+		case total > scanned:
+			msg += fmt.Sprintf("; %s of ~%s files scanned", thousands(scanned), thousands(total))
+		case scanned > 0:
+			msg += fmt.Sprintf("; %s files scanned", thousands(scanned))
+		}
+	}
+	if timedOut {
+		msg += " — rerun with --timeout " + formatDuration(4*searchTimeout)
+	}
+
+	fmt.Fprintf(w, "warning: %s\n", msg)
+	return ExitError{Code: exitPartial, Err: err}
+}
+
+// estimateFiles guesses how many files a search will visit, for progress
+// messages: the explicit file list if there is one, otherwise the number of
+// files the symbol cache saw last time. It returns 0 when there's no basis
+// for a guess.
+func estimateFiles(dir string, paths []string) int {
+	if paths != nil {
+		return len(paths)
+	}
+	if noCache {
+		return 0
+	}
+	c, err := cache.Open(dir)
+	if err != nil {
+		return 0
+	}
+	return c.Len()
+}
+
+// formatDuration renders d the way it would be typed on the command line,
+// such as "30s" or "2m".
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Minute && d%time.Minute == 0:
+		return strconv.FormatInt(int64(d/time.Minute), 10) + "m"
+	case d >= time.Second && d%time.Second == 0:
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+	}
+	return d.String()
+}
+
+// thousands formats n with comma separators.
+func thousands(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0 && s[i-1] != '-'; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/openineditor"
+	"github.com/bashhack/cdx/internal/termcolor"
+)
+
+// fzfPreview is the preview command --pick gives fzf, showing the lines
+// around the highlighted result from the file and line fields of -o fzf
+// output. It's the one to use when piping -o fzf into fzf by hand.
+const fzfPreview = `awk -v line={2} 'NR >= line - 5 && NR <= line + 20' {1}`
+
+// pickHelp documents -o fzf and --pick in the help of the commands that
+// support them.
+const pickHelp = `-o fzf prints one line per result, its fields separated by tabs, without
+color: file, line, kind, name, and the line's text. To pick from them with a
+preview of the code around each:
+
+  cdx refs Name -o fzf | fzf --delimiter '\t' --preview "` + fzfPreview + `"
+
+--pick does that itself, when fzf is installed and output is a terminal,
+and prints the location picked as file:line:col, or opens it when editor is
+set in .cdx.yaml. Without fzf, it asks for the number of a result instead.`
+
+// pickFlag is --pick, registered on each command that supports it.
+var pickFlag bool
+
+// lookFzf finds fzf; tests replace it.
+var lookFzf = func() (string, error) { return exec.LookPath("fzf") }
+
+// location is a result as -o fzf and --pick present it.
+type location struct {
+	File   string
+	Kind   string
+	Name   string
+	Text   string
+	Line   int
+	Column int
+}
+
+// wantFzf reports whether results should be written as -o fzf lines.
+func wantFzf() bool {
+	return outputFormat == "fzf"
+}
+
+// writeFzf prints locs one per line as file, line, kind, name, and text,
+// separated by tabs. Tabs in the fields become spaces.
+func writeFzf(w io.Writer, locs []location) {
+	field := strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace
+	for _, l := range locs {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n",
+			field(l.File), l.Line, field(l.Kind), field(l.Name), field(strings.TrimSpace(l.Text)))
+	}
+}
+
+// pick has the user choose one of locs, with fzf when it's installed and
+// output is a terminal or else from a numbered list, then prints it or, with
+// an editor configured, opens it.
+func pick(cmd *cobra.Command, locs []location) error {
+	if len(locs) == 0 {
+		return errors.New("nothing to pick from")
+	}
+	var (
+		chosen location
+		ok     bool
+		err    error
+	)
+	if path, lookErr := lookFzf(); lookErr == nil && termcolor.IsTerminal(cmd.OutOrStdout()) {
+		chosen, ok, err = pickFzf(cmd, path, locs)
+	} else {
+		chosen, ok, err = pickNumbered(cmd, locs)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("nothing picked")
+	}
+
+	if setting := commandConfig(cmd).Editor; setting != "" {
+		editor, err := openineditor.Resolve(setting)
+		if err != nil {
+			return err
+		}
+		if warning := editor.Warning(); warning != "" {
+			fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", warning)
+		}
+		return editor.Open(cmd.Context(), openineditor.Location{File: chosen.File, Line: chosen.Line, Column: chosen.Column})
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s:%d:%d\n", chosen.File, chosen.Line, max(chosen.Column, 1))
+	return nil
+}
+
+// pickFzf runs fzf on locs and returns the one chosen, or false if the user
+// quit without choosing.
+func pickFzf(cmd *cobra.Command, path string, locs []location) (location, bool, error) {
+	var in, out bytes.Buffer
+	for i, l := range locs {
+		// A leading index, hidden from view, identifies the line picked
+		fmt.Fprintf(&in, "%d\t", i)
+		writeFzf(&in, []location{l})
+	}
+	fzf := exec.CommandContext(cmd.Context(), path, // #nosec G204 -- fzf from PATH with fixed arguments
+		"--delimiter", "\t", "--with-nth", "2..", "--preview", strings.NewReplacer("{1}", "{2}", "{2}", "{3}").Replace(fzfPreview))
+	fzf.Stdin = &in
+	fzf.Stdout = &out
+	fzf.Stderr = os.Stderr
+	if err := fzf.Run(); err != nil {
+		var exit *exec.ExitError
+		// 1 is no match and 130 is interrupted
+		if errors.As(err, &exit) && (exit.ExitCode() == 1 || exit.ExitCode() == 130) {
+			return location{}, false, nil
+		}
+		return location{}, false, fmt.Errorf("fzf: %w", err)
+	}
+	index, _, _ := strings.Cut(out.String(), "\t")
+	i, err := strconv.Atoi(index)
+	if err != nil || i < 0 || i >= len(locs) {
+		return location{}, false, fmt.Errorf("fzf: unexpected selection %q", strings.TrimSpace(out.String()))
+	}
+	return locs[i], true, nil
+}
+
+// pickNumbered lists locs on stderr, numbered from 1, and reads the number of
+// one from the command's input. An empty answer picks nothing.
+func pickNumbered(cmd *cobra.Command, locs []location) (location, bool, error) {
+	errOut := cmd.ErrOrStderr()
+	width := len(strconv.Itoa(len(locs)))
+	for i, l := range locs {
+		fmt.Fprintf(errOut, "%*d) %s:%d  %s %s  %s\n", width, i+1, l.File, l.Line, l.Kind, l.Name, strings.TrimSpace(l.Text))
+	}
+	in := bufio.NewReader(cmd.InOrStdin())
+	for {
+		fmt.Fprintf(errOut, "pick 1-%d: ", len(locs))
+		answer, err := in.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			return location{}, false, nil
+		}
+		if n, convErr := strconv.Atoi(answer); convErr == nil && n >= 1 && n <= len(locs) {
+			return locs[n-1], true, nil
+		}
+		if err != nil {
+			return location{}, false, nil
+		}
+		fmt.Fprintf(errOut, "%q isn't a number from 1 to %d\n", answer, len(locs))
+	}
+}
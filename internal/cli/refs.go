@@ -0,0 +1,798 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/git"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/refs"
+	"github.com/bashhack/cdx/internal/symbols"
+	"github.com/bashhack/cdx/internal/walk"
+	"github.com/bashhack/cdx/internal/workspace"
+	"github.com/bashhack/cdx/pkg/cdx"
+)
+
+var (
+	refsLang          string
+	refsNoComments    bool
+	refsNoStrings     bool
+	refsInStrings     bool
+	refsIgnoreCase    bool
+	refsCaseSensitive bool
+	refsSmartCase     bool
+	refsFollow        bool
+	refsStats         bool
+	refsTests         bool
+	refsTestsOnly     bool
+	refsCodeOnly      bool
+	refsAll           bool
+	refsGenerated     bool
+	refsMaxResults    int
+	refsCount         bool
+	refsByFile        bool
+	refsMin           int
+	refsKinds         []string
+	refsArchives      []string
+	refsRev           string
+)
+
+// errShown stops a streamed search once it has printed as many references
+// as --max-results allows.
+var errShown = errors.New("shown enough references")
+
+var refsCmd = &cobra.Command{
+	Use:   "refs <symbol>",
+	Short: "Find references to a symbol",
+	Long: `Find every whole-word occurrence of a symbol in the codebase.
+
+Occurrences inside comments and string literals are detected heuristically
+and flagged: human output dims them and lists them after the code matches,
+and JSON output marks them with in_comment and in_string. Use --no-comments
+and --no-strings to leave them out. When in doubt, an occurrence is treated
+as code.
+
+The symbol's definition sites, such as the name in "func MaxUsers(", aren't
+references. Human output lists them first under "definitions:", JSON output
+puts them in a separate definitions array, and plain output and --count
+leave them out. A symbol with definitions but no references exits with code
+3, like one that isn't found at all. Methods with the same name are told
+apart by what they belong to: human output tags each with its qualified
+name, as in [(*GrepSearcher).Close] or [Cart.total], and JSON gives the
+type or class as container and a Go method's receiver as receiver.
+
+--max-results stops the search as soon as it has found that many references,
+so the first ones come back quickly even in a huge tree; definition sites in
+the files it didn't reach aren't listed.
+
+Test files, as each language's conventions identify them (user_test.go,
+user.spec.ts, Button.stories.tsx, test_user.py, a Zig file with test "name"
+blocks, and files under __tests__/, __mocks__/, tests/, spec/, testdata/, or
+fixtures/), are searched unless --include-tests=false or include_tests says
+otherwise. test_paths adds gitignore-style patterns for more of them, such
+as e2e/, or with a !, like !src/features/, marks what it matches as code
+instead. --code-only leaves them out, --tests-only searches nothing else,
+and --all searches both regardless of include_tests. JSON output marks
+references in test files with is_test.
+
+Generated files are left out unless --generated: files named like *.pb.go,
+zz_generated*.go, *_string.go, or *.min.js, a list generated_patterns
+replaces, and files whose first five lines say "Code generated ... DO NOT
+EDIT" or "@generated". --stats counts the files left out, and with
+--generated, JSON output marks references in them with is_generated.
+
+A file that can't be read, as when it's deleted or its permissions change
+while the search runs, is skipped with a warning rather than failing the
+search. --stats counts them, as does unreadable in JSON output.
+
+Human output groups the references in each function, method, or class
+under its name and file, with top-level references under just the file;
+JSON output gives the enclosing definition's name, kind, and line as
+enclosing. Definitions come from the parser backend_parser selects, as for
+cdx outline.
+
+Without --lang or default_lang, every supported language is searched, each
+with its own rules for what can be part of an identifier, so $OrderItem in
+JavaScript isn't a reference to OrderItem. When the references span more
+than one language, human output groups them by language, and JSON output
+gives each one's language.
+
+Each reference is classified by how the code uses the symbol: call
+(Symbol(...)), construct (Symbol{...} in Go and Rust, new Symbol(...) in
+TypeScript and JavaScript), type (*Symbol, []Symbol, : Symbol, and other
+type positions), import, or other. The classification reads only the
+matched line, so it's a heuristic. Human output tags each reference with its
+kind, JSON output has a ref_kind field, and --ref-kind shows only the kinds
+given. References in comments and strings are always other.
+
+--count-by-file shows where a symbol is used rather than each use: every
+file with references and how many, most first, then the total. It keeps
+only the counts, so it's cheap even for symbols used thousands of times.
+--min hides files with fewer references, though the total still counts them.
+
+--strings turns the search around for text that lives in strings, like a
+config key, a JSON field name in a Go struct tag, or an event name: it
+matches only inside string literals, Go raw strings and struct tags
+included, and never in code. The text must not run on into a longer word.
+JSON output gives the literal each match is in as literal.
+
+--archive searches the files inside a zip, tar, or gzipped tar archive, such
+as a source snapshot, instead of the roots, reading them in memory without
+extracting anything. Repeat it to search several. The language, test file,
+size, and exclude filters apply to the archive's entries, archives inside
+it are skipped, and at most 1GB is read from each. Locations read
+snapshot.tgz::src/main.go:12, and JSON output names the archive as archive.
+
+--rev searches the repository as of a git revision, such as a tag, branch,
+or commit, reading the files from git's object store without checking it
+out. Only the exclude setting and --exclude leave files out, since the
+ignore files in the working tree may not match the revision. Locations read
+main.go@v1.4.0:12, JSON output gives the revision as rev, and the roots
+setting is ignored.
+
+` + pickHelp + ` Definitions come first, with kind
+definition.
+
+Examples:
+  cdx refs MaxUsers                            # Find references to MaxUsers
+  cdx refs MaxUsers --no-comments --no-strings # Code references only
+  cdx refs MaxUsers -o json                    # Output as JSON
+  cdx refs MaxUsers --count                    # Just count the references
+  cdx refs ParseOrder --tests-only             # Which tests touch ParseOrder
+  cdx refs User --ref-kind construct,type      # Where User is built or named as a type
+  cdx refs Logger --count-by-file --min 5      # Files using Logger 5+ times
+  cdx refs --strings order.created             # Where the event is emitted
+  cdx refs ParseOrder --archive v1.2.tgz       # References in a snapshot
+  cdx refs ParseOrder --rev v1.4.0             # References as of a git revision
+  cdx refs ParseOrder --pick                   # Choose one to jump to`,
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{exitCodesAnnotation: exitCodes(exitCodeNotFound, exitCodePartial)},
+	RunE:        runRefs,
+}
+
+func init() {
+	refsCmd.Flags().StringVarP(&refsLang, "lang", "l", "", "Force language ("+builtinLangs+", or all to ignore default_lang)")
+	refsCmd.Flags().BoolVar(&refsNoComments, "no-comments", false, "Omit references inside comments")
+	refsCmd.Flags().BoolVar(&refsNoStrings, "no-strings", false, "Omit references inside string literals")
+	refsCmd.Flags().BoolVar(&refsInStrings, "strings", false, "Search for the text inside string literals and struct tags only")
+	refsCmd.MarkFlagsMutuallyExclusive("strings", "no-strings")
+	refsCmd.Flags().IntVarP(&refsMaxResults, "max-results", "m", 0, "Show at most this many references (0 for no limit)")
+	refsCmd.Flags().BoolVar(&refsTests, "include-tests", true, "Search test files too")
+	refsCmd.Flags().BoolVar(&refsCodeOnly, "code-only", false, "Leave out test files")
+	refsCmd.Flags().BoolVar(&refsTestsOnly, "tests-only", false, "Search only test files")
+	refsCmd.Flags().BoolVarP(&refsAll, "all", "a", false, "Search test files and the rest, overriding include_tests")
+	refsCmd.MarkFlagsMutuallyExclusive("code-only", "tests-only", "all")
+	refsCmd.Flags().BoolVar(&refsGenerated, "generated", false, "Search generated files too, such as *.pb.go")
+	refsCmd.Flags().BoolVarP(&refsIgnoreCase, "ignore-case", "i", false, "Match the symbol case-insensitively")
+	refsCmd.Flags().BoolVarP(&refsCaseSensitive, "case-sensitive", "s", false, "Match the symbol exactly (overrides smart case)")
+	refsCmd.Flags().BoolVarP(&refsSmartCase, "smart-case", "S", false, "Match case-insensitively unless the symbol has uppercase")
+	refsCmd.MarkFlagsMutuallyExclusive("ignore-case", "case-sensitive")
+	refsCmd.Flags().BoolVarP(&refsCount, "count", "c", false, "Print only the number of references")
+	refsCmd.Flags().StringSliceVar(&refsKinds, "ref-kind", nil, "Show only these kinds of reference: call, construct, type, import, other")
+	refsCmd.Flags().BoolVar(&refsByFile, "count-by-file", false, "Print only how many references each file has")
+	refsCmd.Flags().IntVar(&refsMin, "min", 0, "With --count-by-file, hide files with fewer references than this")
+	refsCmd.MarkFlagsMutuallyExclusive("count", "count-by-file")
+	refsCmd.Flags().BoolVar(&refsStats, "stats", false, "Print search statistics to stderr")
+	refsCmd.Flags().BoolVarP(&refsFollow, "follow", "L", false, "Follow symlinks, searching each file once")
+	refsCmd.Flags().StringArrayVar(&refsArchives, "archive", nil, "Search inside this zip, tar, or tar.gz archive instead of the roots (repeatable)")
+	refsCmd.Flags().BoolVar(&pickFlag, "pick", false, "Choose a reference with fzf, or from a numbered list, and print or open it")
+	refsCmd.MarkFlagsMutuallyExclusive("archive", "pick")
+	refsCmd.Flags().StringVar(&refsRev, "rev", "", "Search files as of this git revision without checking it out")
+	refsCmd.MarkFlagsMutuallyExclusive("rev", "archive")
+
+	rootCmd.AddCommand(refsCmd)
+}
+
+func runRefs(cmd *cobra.Command, args []string) error {
+	symbol := args[0]
+	if refsMin != 0 && !refsByFile {
+		return errors.New("--min needs --count-by-file")
+	}
+
+	cfg := commandConfig(cmd)
+	// A revision belongs to one repository, so --rev ignores the roots
+	// setting
+	var roots []workspace.Root
+	var base string
+	var err error
+	if refsRev != "" {
+		var root workspace.Root
+		root, base, err = resolveRoot(cmd, cfg)
+		roots = []workspace.Root{root}
+	} else {
+		roots, base, err = resolveRoots(cmd, cfg)
+	}
+	if err != nil {
+		return err
+	}
+	if refsRev != "" {
+		if _, err := git.ResolveRev(cmd.Context(), roots[0].Dir, refsRev); err != nil {
+			return fmt.Errorf("--rev: %w", err)
+		}
+	}
+	if len(refsArchives) > 0 {
+		if roots, err = archiveRoots(refsArchives); err != nil {
+			return err
+		}
+	}
+	exclude, err := exclusions(cfg)
+	if err != nil {
+		return err
+	}
+	maxFileSize, err := resolveMaxFileSize(cmd, "", cfg)
+	if err != nil {
+		return err
+	}
+	maxLineLength, err := resolveMaxLineLength(cfg)
+	if err != nil {
+		return err
+	}
+	workers, err := resolveJobs(cmd, cfg)
+	if err != nil {
+		return err
+	}
+	maxResults, err := resolveMaxResults(cmd, refsMaxResults, cfg, 0)
+	if err != nil {
+		return err
+	}
+	kinds, err := parseRefKinds(refsKinds)
+	if err != nil {
+		return err
+	}
+
+	ignoreCase, caseMode := resolveCase(cmd, symbol, refsSmartCase, cfg)
+
+	ctx, cancel := searchContext(cmd)
+	defer cancel()
+
+	query := cdx.Query{
+		Symbol:            symbol,
+		Rev:               refsRev,
+		Exclude:           exclude,
+		TestPaths:         cfg.TestPaths,
+		GeneratedPatterns: cfg.GeneratedPatterns,
+		MaxFileSize:       maxFileSize,
+		MaxLineLength:     maxLineLength,
+		IncludeTests:      true,
+		IncludeGenerated:  refsGenerated,
+		IgnoreCase:        ignoreCase,
+		SkipComments:      refsNoComments,
+		SkipStrings:       refsNoStrings,
+		InStrings:         refsInStrings,
+		FollowSymlinks:    refsFollow,
+		Archive:           len(refsArchives) > 0,
+		CountByFile:       refsByFile,
+		Cache:             !noCache,
+	}
+	for _, kind := range kinds {
+		query.Kinds = append(query.Kinds, string(kind))
+	}
+	langs, err := resolveLangs(cmd, refsLang, cfg)
+	if err != nil {
+		return err
+	}
+	for _, lang := range langs.Langs {
+		query.Languages = append(query.Languages, cdx.Language(lang))
+	}
+	if !refsCount && !refsByFile {
+		// Validated here for the error the parser setting's name gives
+		if _, err := symbols.ForParser(cfg.BackendParser); err != nil {
+			return err
+		}
+		query.Parser = cfg.BackendParser
+	}
+	// An unreadable lifetime fails config validation
+	query.ListingsLifetime, _ = cfg.WalkCacheLifetime()
+	switch {
+	case refsTestsOnly:
+		query.OnlyTests = true
+	case refsCodeOnly:
+		query.IncludeTests = false
+	case !refsAll:
+		query.IncludeTests = resolveIncludeTests(cmd, refsTests, cfg, true)
+	}
+
+	// Roots are searched at once, each with its own ignore files, and
+	// their results merged in order. An interrupted search still prints
+	// what it found before stopping.
+	type rootResult struct {
+		found  []refs.Ref
+		counts []refs.FileCount
+		stats  refs.Stats
+	}
+	byRoot := make([]rootResult, len(roots))
+	// An archive's locations already name it
+	locateIn := func(root workspace.Root) func(string) string {
+		switch {
+		case len(refsArchives) > 0:
+			return func(path string) string { return path }
+		case refsRev != "":
+			return func(path string) string { return showPath(root.RelTo(base, path)) + "@" + refsRev }
+		}
+		return func(path string) string { return showPath(root.RelTo(base, path)) }
+	}
+	started := time.Now()
+	// Plain output prints the references in code file by file as the
+	// search goes, in walk order, instead of once every root is done, so a
+	// pipe sees the first at once; for it the roots are searched in turn.
+	// The rest are held back to follow them, as writeRefs orders them, but
+	// count toward the cap where they're found.
+	var errs []error
+	var shown, held int
+	if outputFormat == "plain" && !refsCount && !refsByFile && !pickFlag {
+		w := cmd.OutOrStdout()
+		errs = make([]error, len(roots))
+		for i, root := range roots {
+			q, r, locate := query, &byRoot[i], locateIn(root)
+			q.Roots, q.Jobs, q.InOrder = []string{root.Dir}, workers, true
+			res, err := cdx.Stream(ctx, q, func(results []cdx.Result) error {
+				var code []refs.Ref
+				for _, found := range results {
+					ref := refOf(found)
+					ref.Path = locate(ref.Path)
+					switch {
+					case ref.Definition:
+						continue
+					case maxResults > 0 && shown+len(code)+held == maxResults:
+						writeRefs(w, nil, code, false, false)
+						shown += len(code)
+						return errShown
+					case ref.Code():
+						code = append(code, ref)
+					default:
+						r.found = append(r.found, ref)
+						held++
+					}
+				}
+				writeRefs(w, nil, code, false, false)
+				shown += len(code)
+				return nil
+			})
+			full := errors.Is(err, errShown)
+			if full {
+				err = nil
+			}
+			r.stats = statsOf(res)
+			r.stats.Limited = r.stats.Limited || full
+			for i := range r.stats.Unreadable {
+				r.stats.Unreadable[i].Path = locate(r.stats.Unreadable[i].Path)
+			}
+			errs[i] = err
+			// The roots after are left out of the merge, as searchRoots
+			// cancels them
+			if full || endsMerge(err) {
+				byRoot, errs = byRoot[:i+1], errs[:i+1]
+				break
+			}
+		}
+	} else {
+		errs = searchRoots(ctx, len(roots), workers, func(ctx context.Context, i, jobs int) error {
+			root, q, r, locate := roots[i], query, &byRoot[i], locateIn(roots[i])
+			q.Roots, q.Jobs = []string{root.Dir}, jobs
+			// --count counts every reference, so only the listing stops
+			// early. Each root stops once it has found enough on its own:
+			// those are all the merge keeps from it, whatever the roots
+			// before it found.
+			if !refsCount && !refsByFile {
+				q.StopAfter = maxResults
+			}
+			res, err := cdx.Search(ctx, q)
+			for _, c := range res.Counts {
+				r.counts = append(r.counts, refs.FileCount{
+					File:        locate(c.Path),
+					Language:    patterns.Language(c.Language),
+					Count:       c.Count,
+					IsTest:      c.IsTest,
+					IsGenerated: c.IsGenerated,
+				})
+			}
+			for _, found := range res.Results {
+				ref := refOf(found)
+				ref.Path = locate(ref.Path)
+				r.found = append(r.found, ref)
+			}
+			r.stats = statsOf(res)
+			for i := range r.stats.Unreadable {
+				r.stats.Unreadable[i].Path = locate(r.stats.Unreadable[i].Path)
+			}
+			return err
+		})
+	}
+	elapsed := time.Since(started)
+
+	var found []refs.Ref
+	var counts []refs.FileCount
+	var files int
+	var limited bool
+	var unreadable []refs.ReadError
+	stats := make([]refs.Stats, 0, len(roots))
+	for i, r := range byRoot {
+		if !refsCount && !refsByFile {
+			if _, limited = resultBudget(maxResults, found); limited {
+				break
+			}
+		}
+		found = append(found, r.found...)
+		counts = append(counts, r.counts...)
+		files += r.stats.Files
+		limited = limited || r.stats.Limited
+		unreadable = append(unreadable, r.stats.Unreadable...)
+		stats = append(stats, r.stats)
+		if err = errs[i]; err != nil {
+			break
+		}
+	}
+	partial := err != nil && interrupted(err)
+	if err != nil && !partial {
+		return err
+	}
+	defs, found := refs.Partition(found)
+	// The cap keeps the first references in walk order, so repeated runs
+	// show the same ones, though how many more the search found before it
+	// stopped varies. It doesn't apply to --count.
+	total := shown + len(found)
+	if maxResults > 0 && total > maxResults && !refsCount {
+		found, limited = found[:maxResults-shown], true
+	}
+	if refsByFile {
+		counts, total = rankFileCounts(counts, refsMin)
+	}
+
+	w := cmd.OutOrStdout()
+	switch {
+	case refsByFile && wantJSON():
+		report := refsFileCountReport{Files: counts, Count: total, Partial: partial}
+		if report.Files == nil {
+			report.Files = []refs.FileCount{}
+		}
+		if err := writeJSON(w, report); err != nil {
+			return err
+		}
+	case refsByFile:
+		writeFileCounts(w, counts, total)
+	case refsCount && wantJSON():
+		if err := writeJSON(w, refsCountReport{Count: total, Partial: partial}); err != nil {
+			return err
+		}
+	case refsCount:
+		fmt.Fprintln(w, total)
+	case wantJSON():
+		report := refsReport{Refs: found, Definitions: defs, Files: files, Unreadable: len(unreadable), Partial: partial}
+		var p progressError
+		if errors.As(err, &p) {
+			_, report.Total = p.Progress()
+		}
+		if report.Refs == nil {
+			report.Refs = []refs.Ref{}
+		}
+		if report.Definitions == nil {
+			report.Definitions = []refs.Ref{}
+		}
+		if err := writeJSON(w, report); err != nil {
+			return err
+		}
+	case pickFlag:
+		// Picked once the search's warnings are out of the way
+	case wantFzf():
+		writeFzf(w, refLocations(symbol, defs, found))
+	case outputFormat == "plain":
+		writeRefs(w, nil, found, false, false)
+	default:
+		writeRefs(w, defs, found, true, useColor(cmd, w))
+	}
+
+	if limited && !refsByFile {
+		fmt.Fprintf(cmd.ErrOrStderr(), "showing the first %d references; pass --max-results 0 for all\n", shown+len(found))
+	}
+	warnUnreadable(cmd.ErrOrStderr(), unreadable)
+
+	if refsStats {
+		fmt.Fprintf(cmd.ErrOrStderr(), "lang:     %s\n", langs)
+		fmt.Fprintf(cmd.ErrOrStderr(), "case:     %s\n", caseMode)
+		fmt.Fprintf(cmd.ErrOrStderr(), "workers:  %d\n", workers)
+		// Each root's walk time is counted apart from this, which includes
+		// scanning the files it found
+		fmt.Fprintf(cmd.ErrOrStderr(), "elapsed:  %s\n", elapsed.Round(time.Microsecond))
+		for i, s := range stats {
+			fmt.Fprintf(cmd.ErrOrStderr(), "root:     %s\n", describeRoot(roots[i]))
+			writeWalkStats(cmd.ErrOrStderr(), s.Stats)
+			if s.Generated > 0 {
+				fmt.Fprintf(cmd.ErrOrStderr(), "skipped:  %d generated (search them with --generated)\n", s.Generated)
+			}
+			if len(s.Unreadable) > 0 {
+				fmt.Fprintf(cmd.ErrOrStderr(), "skipped:  %d unreadable\n", len(s.Unreadable))
+			}
+			if s.Truncated > 0 {
+				fmt.Fprintf(cmd.ErrOrStderr(), "truncated: %d lines searched only up to %s\n", s.Truncated, cfg.MaxLineLength)
+			}
+		}
+	}
+
+	if partial {
+		return partialError(cmd.ErrOrStderr(), err)
+	}
+	if total == 0 {
+		err := fmt.Errorf("no references to %s found", symbol)
+		if refsInStrings {
+			err = fmt.Errorf("no string literals containing %q found", symbol)
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "%v\n", err)
+		warnDefaultLang(cmd, langs)
+		return ExitError{Code: 3, Err: err}
+	}
+	if pickFlag && !refsCount && !refsByFile {
+		return pick(cmd, refLocations(symbol, defs, found))
+	}
+	return nil
+}
+
+// refOf returns the reference a cdx search result is.
+func refOf(r cdx.Result) refs.Ref {
+	ref := refs.Ref{
+		Path:        r.Path,
+		Text:        r.Text,
+		Language:    patterns.Language(r.Language),
+		Archive:     r.Archive,
+		Rev:         r.Rev,
+		Encoding:    r.Encoding,
+		Literal:     r.Literal,
+		Scope:       r.Scope,
+		Container:   r.Container,
+		Receiver:    r.Receiver,
+		Kind:        patterns.RefKind(r.Kind),
+		Line:        r.Line,
+		Column:      r.Column,
+		InComment:   r.InComment,
+		InString:    r.InString,
+		IsTest:      r.IsTest,
+		IsGenerated: r.IsGenerated,
+		Nested:      r.Nested,
+		Definition:  r.Kind == string(patterns.RefDefinition),
+		Offset:      -1,
+	}
+	if r.Enclosing != nil {
+		ref.Enclosing = &refs.Enclosing{Name: r.Enclosing.Name, Kind: r.Enclosing.Kind, Line: r.Enclosing.Line}
+	}
+	return ref
+}
+
+// statsOf returns the stats of a cdx search of one root, for --stats.
+func statsOf(res cdx.Results) refs.Stats {
+	s := res.Stats
+	stats := refs.Stats{
+		Stats: walk.Stats{
+			Excluded:   s.Excluded,
+			Oversized:  s.Oversized,
+			Files:      s.Files,
+			Dirs:       s.Dirs,
+			Binary:     s.Binary,
+			Duplicates: s.Duplicates,
+			Listed:     s.Listed,
+			Elapsed:    s.Walk,
+		},
+		Truncated: s.Truncated,
+		Generated: s.Generated,
+		Limited:   res.Stopped,
+	}
+	for _, e := range res.Unreadable {
+		stats.Unreadable = append(stats.Unreadable, refs.ReadError{Err: e.Err, Path: e.Path})
+	}
+	return stats
+}
+
+// resultBudget returns how many more references a search may find, after
+// found, before it has maxResults of them: 0 for no limit, and false once
+// it has them all.
+func resultBudget(maxResults int, found []refs.Ref) (int, bool) {
+	if maxResults == 0 {
+		return 0, false
+	}
+	left := maxResults
+	for _, r := range found {
+		if !r.Definition {
+			left--
+		}
+	}
+	return left, left <= 0
+}
+
+// refLocations lists defs, then found, references to symbol, for -o fzf
+// and --pick.
+func refLocations(symbol string, defs, found []refs.Ref) []location {
+	locs := make([]location, 0, len(defs)+len(found))
+	for _, r := range defs {
+		locs = append(locs, location{File: r.Path, Line: r.Line, Column: r.Column, Kind: "definition", Name: symbol, Text: r.Text})
+	}
+	for _, r := range found {
+		locs = append(locs, location{File: r.Path, Line: r.Line, Column: r.Column, Kind: string(r.Kind), Name: symbol, Text: r.Text})
+	}
+	return locs
+}
+
+// parseRefKinds validates the --ref-kind values, returning nil for none.
+func parseRefKinds(names []string) ([]patterns.RefKind, error) {
+	var kinds []patterns.RefKind
+	for _, name := range names {
+		kind := patterns.RefKind(strings.ToLower(strings.TrimSpace(name)))
+		if !slices.Contains(patterns.RefKinds, kind) {
+			return nil, fmt.Errorf("--ref-kind: unknown kind %q (want call, construct, type, import, or other)", name)
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// refKindColors maps each kind of reference to the color of its tag; other
+// isn't colored.
+var refKindColors = map[patterns.RefKind]string{
+	patterns.RefCall:      ansiCyan,
+	patterns.RefConstruct: ansiGreen,
+	patterns.RefType:      ansiMagenta,
+	patterns.RefImport:    ansiBlue,
+}
+
+// warnUnreadable reports the files a search left out because they couldn't
+// be read, naming the first.
+func warnUnreadable(w io.Writer, unreadable []refs.ReadError) {
+	switch len(unreadable) {
+	case 0:
+	case 1:
+		fmt.Fprintf(w, "warning: skipped %v\n", unreadable[0])
+	default:
+		fmt.Fprintf(w, "warning: skipped %d unreadable files, such as %v\n", len(unreadable), unreadable[0])
+	}
+}
+
+// refsReport is the JSON representation of a reference search.
+type refsReport struct {
+	Refs        []refs.Ref `json:"refs"`
+	Definitions []refs.Ref `json:"definitions"`     // Definition sites, not counted as refs
+	Files       int        `json:"files"`           // Files searched
+	Total       int        `json:"total,omitempty"` // Estimated files in a partial search
+	// Unreadable counts the files left out because they couldn't be read
+	Unreadable int  `json:"unreadable,omitempty"`
+	Partial    bool `json:"partial"` // The search was interrupted
+}
+
+// refsCountReport is the JSON representation of refs --count.
+type refsCountReport struct {
+	Count   int  `json:"count"` // References, not counting definitions
+	Partial bool `json:"partial"`
+}
+
+// refsFileCountReport is the JSON representation of refs --count-by-file.
+type refsFileCountReport struct {
+	Files   []refs.FileCount `json:"files"`
+	Count   int              `json:"count"` // References in every file, shown or not
+	Partial bool             `json:"partial"`
+}
+
+// rankFileCounts sorts counts by descending count, then by path, and drops
+// the files with fewer than atLeast references. It returns the files kept and
+// the references in all of them.
+func rankFileCounts(counts []refs.FileCount, atLeast int) ([]refs.FileCount, int) {
+	total := 0
+	for _, c := range counts {
+		total += c.Count
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].File < counts[j].File
+	})
+	kept := counts[:0]
+	for _, c := range counts {
+		if c.Count >= atLeast {
+			kept = append(kept, c)
+		}
+	}
+	return kept, total
+}
+
+// writeFileCounts prints each file's reference count, then the total, with
+// the counts right-aligned like wc's.
+func writeFileCounts(w io.Writer, counts []refs.FileCount, total int) {
+	width := len(strconv.Itoa(total))
+	for _, c := range counts {
+		fmt.Fprintf(w, "%*d %s\n", width, c.Count, c.File)
+	}
+	fmt.Fprintf(w, "%*d total\n", width, total)
+}
+
+// writeRefs prints references grep-style, code first. References in comments
+// and strings follow, dimmed when color is on. With human set, definition
+// sites come first under their own heading, each method tagged with its
+// qualified name, as in [(*GrepSearcher).Close]; references in more than one
+// language are grouped by language, in the order the search met them; and
+// within that, references are grouped under their enclosing definition,
+// indented and tagged with their kind, colored when color is on. References
+// from a --strings search are what was asked for, so they're neither tagged
+// nor dimmed.
+func writeRefs(w io.Writer, defs, found []refs.Ref, human, color bool) {
+	var langs []patterns.Language
+	var scopes []string
+	for _, r := range found {
+		if !slices.Contains(langs, r.Language) {
+			langs = append(langs, r.Language)
+		}
+		if !slices.Contains(scopes, refScope(r)) {
+			scopes = append(scopes, refScope(r))
+		}
+	}
+	grouped := human && len(langs) > 1
+
+	if human && len(defs) > 0 {
+		fmt.Fprintln(w, "definitions:")
+		for _, r := range defs {
+			var tag string
+			if r.Container != "" {
+				tag = "[" + r.Qualified() + "] "
+			}
+			fmt.Fprintf(w, "%s:%d:%d: %s%s\n", r.Path, r.Line, r.Column, tag, strings.TrimSpace(r.Text))
+		}
+		if len(found) > 0 && !grouped {
+			fmt.Fprintln(w, "references:")
+		}
+	}
+
+	sorted := append([]refs.Ref(nil), found...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		switch {
+		case grouped && a.Language != b.Language:
+			return slices.Index(langs, a.Language) < slices.Index(langs, b.Language)
+		case a.Code() != b.Code():
+			return a.Code()
+		case human:
+			return slices.Index(scopes, refScope(a)) < slices.Index(scopes, refScope(b))
+		}
+		return false
+	})
+
+	for i, r := range sorted {
+		newLang := grouped && (i == 0 || r.Language != sorted[i-1].Language)
+		if newLang {
+			fmt.Fprintf(w, "references (%s):\n", r.Language)
+		}
+		var prefix string
+		if human {
+			if newLang || i == 0 || refScope(r) != refScope(sorted[i-1]) || r.Code() != sorted[i-1].Code() {
+				fmt.Fprintln(w, refScope(r))
+			}
+			if r.Literal == "" {
+				prefix = "[" + string(r.Kind) + "] "
+			}
+			// A dimmed line can't hold a colored tag without losing the dim
+			if c, ok := refKindColors[r.Kind]; ok && color && r.Code() {
+				prefix = c + prefix[:len(prefix)-1] + ansiReset + " "
+			}
+		}
+		line := fmt.Sprintf("%s:%d:%d: %s%s", r.Path, r.Line, r.Column, prefix, strings.TrimSpace(r.Text))
+		if color && !r.Code() && r.Literal == "" {
+			line = ansiDim + line + ansiReset
+		}
+		if human {
+			line = "  " + line
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// refScope names the group a reference is listed under in human output: its
+// enclosing definition and file, or just the file at the top level.
+func refScope(r refs.Ref) string {
+	if r.Enclosing == nil {
+		return r.Path
+	}
+	return fmt.Sprintf("%s (%s)", r.Enclosing.Name, r.Path)
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/termcolor"
+)
+
+// wantJSON reports whether the selected output format is JSON.
+func wantJSON() bool {
+	return outputFormat == "json"
+}
+
+// writeJSON encodes v as indented JSON for the commands that render their own
+// output rather than going through a search formatter.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// showPath returns path, which uses the platform's separators, as results
+// show it: with forward slashes under --slash, so scripts reading the output
+// see the same paths on Windows as elsewhere.
+func showPath(path string) string {
+	if slashPaths {
+		return filepath.ToSlash(path)
+	}
+	return path
+}
+
+// ANSI sequences used by the commands that render their own output.
+const (
+	ansiDim     = "\x1b[2m"
+	ansiReset   = "\x1b[0m"
+	ansiGreen   = "\x1b[32m"
+	ansiBlue    = "\x1b[34m"
+	ansiMagenta = "\x1b[35m"
+	ansiCyan    = "\x1b[36m"
+)
+
+// useColor reports whether output written to w should be colored; see
+// termcolor.Decide for the precedence.
+func useColor(cmd *cobra.Command, w io.Writer) bool {
+	// A config that fails to parse its mode never loaded, so the error
+	// here is always nil
+	mode, _ := commandConfig(cmd).ColorMode()
+	return termcolor.Enabled(flagColorMode(cmd), mode, w)
+}
+
+// flagColorMode returns the color mode given on the command line, or ""
+// when neither --color nor --no-color was. --no-color wins if both were.
+func flagColorMode(cmd *cobra.Command) termcolor.Mode {
+	flags := cmd.Flags()
+	switch {
+	case flags.Changed("no-color") && noColor:
+		return termcolor.Never
+	case flags.Changed("color"):
+		return colorFlag
+	}
+	return ""
+}
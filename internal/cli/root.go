@@ -2,16 +2,45 @@
 package cli
 
 import (
+	"context"
 	"errors"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/config"
+	"github.com/bashhack/cdx/internal/pager"
+	"github.com/bashhack/cdx/internal/termcolor"
 )
 
 var (
 	// Global flags
 	outputFormat string
 	noColor      bool
+	// colorFlag is --color; --no-color is the same as --color=never
+	colorFlag = termcolor.Auto
+	noCache   bool
+	// searchTimeout bounds each search; zero means no limit
+	searchTimeout time.Duration
+	jobs          int
+	cwdOnly       bool
+	// slashPaths is --slash: show result paths with forward slashes, whatever
+	// the platform's separator
+	slashPaths bool
+	// excludePatterns holds --exclude patterns, layered over the config's
+	excludePatterns []string
+	// configPath is --config, an explicit config file to load instead of
+	// searching for one
+	configPath string
+	// profileName is --profile, a named set of config settings to apply
+	profileName string
+	// pagerFlag is --pager
+	pagerFlag = pager.Auto
+	// activePager is the pager the command's output goes to, if any
+	activePager *pager.Pager
 )
 
 // ExitError is an error that carries a specific exit code.
@@ -45,6 +74,7 @@ Examples:
   cdx def MyFunction     # Find definition of MyFunction
   cdx refs MyFunction    # Find references to MyFunction
   cdx outline main.go    # Show structure of main.go`,
+	PersistentPreRunE: loadCommandConfig,
 }
 
 // Execute runs the root command and exits on error.
@@ -62,8 +92,22 @@ func Execute() {
 
 // ExecuteE runs the root command and returns any error.
 // This is useful for testing and programmatic use.
+//
+// SIGINT and SIGTERM cancel the command's context rather than killing the
+// process, so searches can stop between files and report what they found.
+// A second signal kills the process as usual.
 func ExecuteE() error {
-	return rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	err := rootCmd.ExecuteContext(ctx)
+	if activePager != nil {
+		// Wait for the user to quit the pager before exiting
+		_ = activePager.Close()
+		activePager = nil
+	}
+	return err
 }
 
 func init() {
@@ -74,9 +118,29 @@ func init() {
 
 	// Global flags available to all commands
 	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "auto",
-		"Output format: auto, human, json, plain")
+		"Output format: auto, human, json, plain, fzf, github")
+	rootCmd.PersistentFlags().Var(&colorFlag, "color",
+		"Color output: always, never, or auto (when writing to a terminal)")
 	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false,
-		"Disable color output")
+		"Disable color output (same as --color=never)")
+	rootCmd.PersistentFlags().Var(&pagerFlag, "pager",
+		"Page output through $PAGER: always, never, or auto (when writing to a terminal)")
+	rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false,
+		"Bypass the persistent symbol and directory listing caches")
+	rootCmd.PersistentFlags().DurationVar(&searchTimeout, "timeout", defaultSearchTimeout,
+		"Stop searching after this long and show partial results (0 for no limit)")
+	rootCmd.PersistentFlags().IntVarP(&jobs, "jobs", "j", 0,
+		"Files to scan concurrently (0 for automatic)")
+	rootCmd.PersistentFlags().BoolVar(&cwdOnly, "cwd-only", false,
+		"Search only the current directory instead of the whole repository")
+	rootCmd.PersistentFlags().BoolVar(&slashPaths, "slash", false,
+		"Separate directories in result paths with / on every platform")
+	rootCmd.PersistentFlags().StringArrayVar(&excludePatterns, "exclude", nil,
+		"Skip paths matching this gitignore-style pattern (repeatable)")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "",
+		"Load only this config file (default: search for .cdx.yaml; or set "+config.EnvConfig+")")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "",
+		"Apply this profile from the config's profiles (or set "+config.EnvProfile+")")
 }
 
 // GetOutputFormat returns the current output format setting.
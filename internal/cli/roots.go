@@ -0,0 +1,22 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/bashhack/cdx/internal/roots"
+	"github.com/bashhack/cdx/internal/search"
+)
+
+// searchRoots runs search for each of n roots with roots.Search, sharing the
+// --jobs budget between them. A root that doesn't define the symbol hasn't
+// failed, so the merge goes on past it.
+func searchRoots(ctx context.Context, n, workers int, search func(ctx context.Context, i, jobs int) error) []error {
+	return roots.Search(ctx, n, workers, search, endsMerge)
+}
+
+// endsMerge reports whether err, from one root's search, stops callers of
+// searchRoots from merging the roots after it.
+func endsMerge(err error) bool {
+	_, notFound := err.(search.ErrNotFound)
+	return err != nil && !notFound
+}
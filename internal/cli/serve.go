@@ -0,0 +1,701 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/cache"
+	"github.com/bashhack/cdx/internal/config"
+	"github.com/bashhack/cdx/internal/outline"
+	"github.com/bashhack/cdx/internal/output"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/refs"
+	"github.com/bashhack/cdx/internal/rpc"
+	"github.com/bashhack/cdx/internal/scan"
+	"github.com/bashhack/cdx/internal/search"
+	"github.com/bashhack/cdx/internal/session"
+	"github.com/bashhack/cdx/internal/symbols"
+	"github.com/bashhack/cdx/internal/tags"
+	"github.com/bashhack/cdx/internal/walk"
+	"github.com/bashhack/cdx/pkg/cdx"
+)
+
+// progressMethod is the notification cdx serve sends while a search runs.
+const progressMethod = "$/progress"
+
+// progressInterval is the least time between a request's progress
+// notifications; tests lower it.
+var progressInterval = 200 * time.Millisecond
+
+var serveJSONRPC bool
+
+var serveCmd = &cobra.Command{
+	Use:   "serve --json-rpc",
+	Short: "Answer queries from editor plugins over JSON-RPC",
+	Long: `Answer queries from editor plugins and other long-running tools over
+JSON-RPC 2.0 on standard input and output, one message per line, so they
+don't start a process per query. The server runs until its input ends.
+
+Each method takes the flags of the command it stands for as params, named
+with underscores (max_results for --max-results), and returns that
+command's -o json output:
+
+  cdx/definition  {"symbol": "Config", "lang": "go"}       as cdx def
+  cdx/references  {"symbol": "Config", "no_comments": true} as cdx refs
+  cdx/outline     {"file": "user.go", "public_only": true}  as cdx outline
+  cdx/symbols     {"complete": "Get", "limit": 10}          as cdx symbols
+
+cdx/outline outlines "content" instead of reading the file when it's given,
+as for an unsaved buffer. cdx/symbols returns {"symbols": [{name, kind}]}.
+A search that finds nothing returns empty results rather than an error.
+
+cdx/capabilities takes no params and returns what cdx capabilities -o json
+prints: the version, the methods answered, the backends, languages, and
+optional features available. A client can ask it first and leave alone the
+methods and features this cdx doesn't have.
+
+cdx/stats takes no params and returns {"definition_patterns": {"hits",
+"misses", "entries", "size"}}: how often a query found its symbol's
+definition patterns already compiled.
+
+Requests run concurrently, each under --timeout, and their responses can
+come in any order. A $/cancelRequest notification with {"id": <id>} stops
+a request, which then fails with code -32800. While cdx/references runs,
+$/progress notifications report {"id", "files", "total"}: the files searched
+so far and an estimate of all of them.
+
+The config and plugin languages are loaded once, at startup, and each
+root's symbol cache stays open between requests, so cdx/symbols completes
+the names cdx/definition, cdx/references, and cdx/outline have just found.
+
+Examples:
+  echo '{"jsonrpc":"2.0","id":1,"method":"cdx/references","params":{"symbol":"MaxUsers"}}' | cdx serve --json-rpc`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{noPagerAnnotation: "true"},
+	RunE:        runServe,
+}
+
+func init() {
+	serveCmd.Flags().BoolVar(&serveJSONRPC, "json-rpc", false, "Speak JSON-RPC 2.0 on stdin and stdout, one message per line")
+	_ = serveCmd.MarkFlagRequired("json-rpc")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	s := newServer(cmd)
+	defer s.save()
+	rs := rpc.Server{Handlers: s.handlers()}
+	return rs.Serve(cmd.Context(), cmd.InOrStdin(), cmd.OutOrStdout())
+}
+
+// handlers returns the server's handlers by method, which cdx/capabilities
+// lists as well as cdx serve answering them.
+func (s *server) handlers() map[string]rpc.Handler {
+	return map[string]rpc.Handler{
+		"cdx/capabilities": s.capabilities,
+		"cdx/definition":   s.definition,
+		"cdx/references":   s.references,
+		"cdx/outline":      s.outline,
+		"cdx/symbols":      s.symbols,
+		"cdx/stats":        s.stats,
+	}
+}
+
+// server answers cdx serve's requests, and cdx batch's queries, holding
+// what they share.
+type server struct {
+	cmd    *cobra.Command
+	cfg    *config.Config
+	caches map[string]*cache.Cache // By root, opened by the first request needing one
+	// walks are the files of each root, walked once for every query to
+	// share, by cdx batch; without one, each query walks the root itself
+	walks map[string]*rootWalk
+	// defs holds the definition patterns of the symbols queried, which
+	// every query for the same symbol would otherwise compile anew
+	defs *patterns.DefinitionCache
+	mu   sync.Mutex // Guards caches
+}
+
+// rootWalk is the files a walk of a root found.
+type rootWalk struct {
+	files []walk.File
+	paths []string // The files' root-relative paths
+}
+
+// newServer returns a server for cmd's requests.
+func newServer(cmd *cobra.Command) *server {
+	return &server{cmd: cmd, cfg: commandConfig(cmd), caches: make(map[string]*cache.Cache), defs: patterns.NewDefinitionCache(0)}
+}
+
+// cache returns the open symbol cache of the root dir, or nil when caching
+// is off or the cache can't be opened.
+func (s *server) cache(dir string) *cache.Cache {
+	if noCache {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.caches[dir]; ok {
+		return c
+	}
+	c, err := cache.Open(dir)
+	if err != nil {
+		return nil
+	}
+	s.caches[dir] = c
+	return c
+}
+
+// save saves every open cache.
+func (s *server) save() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.caches {
+		saveCache(s.cmd.ErrOrStderr(), c)
+	}
+}
+
+// definitionParams are cdx/definition's params, after def's flags.
+type definitionParams struct {
+	MaxResults       *int     `json:"max_results"`
+	IncludeTests     *bool    `json:"include_tests"`
+	Symbol           string   `json:"symbol"`
+	Lang             string   `json:"lang"`
+	ExcludeAnnotated []string `json:"exclude_annotated"`
+	Context          int      `json:"context"`
+	All              bool     `json:"all"`
+	IgnoreCase       bool     `json:"ignore_case"`
+	CaseSensitive    bool     `json:"case_sensitive"`
+	Binary           bool     `json:"binary"`
+	Follow           bool     `json:"follow"`
+	Generated        bool     `json:"generated"`
+}
+
+// definition answers cdx/definition.
+func (s *server) definition(ctx context.Context, req *rpc.Request) (any, error) {
+	var p definitionParams
+	if err := req.Decode(&p); err != nil {
+		return nil, err
+	}
+	return s.findDefinition(ctx, p)
+}
+
+// findDefinition answers p as cdx def -o json does, searching the working
+// tree with each root's open cache and, when use_tags allows, its tags file.
+func (s *server) findDefinition(ctx context.Context, p definitionParams) (any, error) {
+	if p.Symbol == "" {
+		return nil, rpc.Errorf(rpc.CodeInvalidParams, "symbol: missing")
+	}
+	if p.IgnoreCase && p.CaseSensitive {
+		return nil, rpc.Errorf(rpc.CodeInvalidParams, "ignore_case and case_sensitive can't both be set")
+	}
+	roots, base, err := resolveRoots(s.cmd, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := s.searchOptions(p, base)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withSearchTimeout(ctx)
+	defer cancel()
+	byRoot := make([][]search.Result, len(roots))
+	errs := searchRoots(ctx, len(roots), opts.Jobs, func(ctx context.Context, i, jobs int) error {
+		root, ropts := roots[i], opts
+		ropts.Directory, ropts.Jobs = root.Dir, jobs
+		if w := s.walks[root.Dir]; w != nil {
+			ropts.Paths = w.paths
+		}
+		if c := s.cache(root.Dir); c != nil {
+			ropts.Cache = c
+			defer saveCache(s.cmd.ErrOrStderr(), c)
+		}
+		if useTags(s.cmd, s.cfg) {
+			tf, tagsErr := tags.Find(root.Dir)
+			if tagsErr != nil {
+				fmt.Fprintf(s.cmd.ErrOrStderr(), "warning: ignoring tags file: %v\n", tagsErr)
+			}
+			ropts.Tags = tf
+		}
+		var err error
+		byRoot[i], err = search.NewGrepSearcher(root.Dir).FindDefinition(ctx, p.Symbol, ropts)
+		if native, ok := ropts.Backend.Fallback(err); ok {
+			fmt.Fprintf(s.cmd.ErrOrStderr(), "warning: %v; searching natively instead\n", err)
+			ropts.Backend = native
+			byRoot[i], err = search.NewGrepSearcher(root.Dir).FindDefinition(ctx, p.Symbol, ropts)
+		}
+		return err
+	})
+	var results []search.Result
+	for i := range roots {
+		results = append(results, byRoot[i]...)
+		err = errs[i]
+		if _, ok := err.(search.ErrNotFound); ok {
+			err = nil
+			continue
+		}
+		if err != nil {
+			break
+		}
+	}
+	// An interrupted search returns what it found, as def prints it
+	if err != nil && !interrupted(err) {
+		return nil, err
+	}
+	if opts.MaxResults > 0 && len(results) > opts.MaxResults {
+		results = results[:opts.MaxResults]
+	}
+
+	var buf bytes.Buffer
+	if err := output.New(output.Format("json"), true).FormatResults(&buf, results); err != nil {
+		return nil, err
+	}
+	return json.RawMessage(bytes.TrimSpace(buf.Bytes())), nil
+}
+
+// searchOptions returns the search options for p, as runDef builds them
+// from def's flags, with paths relative to base.
+func (s *server) searchOptions(p definitionParams, base string) (search.Options, error) {
+	exclude, err := excludeRules(s.cfg)
+	if err != nil {
+		return search.Options{}, err
+	}
+	maxFileSize, err := resolveMaxFileSize(s.cmd, "", s.cfg)
+	if err != nil {
+		return search.Options{}, err
+	}
+	maxLineLength, err := resolveMaxLineLength(s.cfg)
+	if err != nil {
+		return search.Options{}, err
+	}
+	workers, err := resolveJobs(s.cmd, s.cfg)
+	if err != nil {
+		return search.Options{}, err
+	}
+	searchBackend, err := resolveBackend(s.cmd, "", s.cfg)
+	if err != nil {
+		return search.Options{}, err
+	}
+	langs, err := langsFor(p.Lang, "lang", s.cfg)
+	if err != nil {
+		return search.Options{}, rpc.Errorf(rpc.CodeInvalidParams, "lang: %v", err)
+	}
+	ignoreCase := p.IgnoreCase
+	if !ignoreCase && !p.CaseSensitive {
+		ignoreCase, _ = resolveCase(s.cmd, p.Symbol, false, s.cfg)
+	}
+
+	opts := search.Options{
+		Languages:        langs.Langs,
+		IgnoreCase:       ignoreCase,
+		Context:          p.Context,
+		IncludeTests:     true,
+		IncludeBinary:    p.Binary,
+		FollowSymlinks:   p.Follow,
+		MaxFileSize:      maxFileSize,
+		MaxLineLength:    maxLineLength,
+		Jobs:             workers,
+		Backend:          searchBackend,
+		ExcludeAnnotated: p.ExcludeAnnotated,
+		Exclude:          exclude,
+		RelativeTo:       base,
+		Slash:            slashPaths,
+		Generated:        generatedFiles(s.cfg),
+		SkipGenerated:    !p.Generated,
+		Tests:            testFiles(s.cfg),
+	}
+	if len(langs.Langs) == 1 {
+		opts.Language = string(langs.Langs[0])
+	}
+	// all lifts both the result cap and the test-file filter
+	if !p.All {
+		opts.IncludeTests = paramOr(p.IncludeTests, s.cfg.IncludeTests, false)
+		opts.MaxResults = paramOr(p.MaxResults, nonZero(s.cfg.MaxResults), defaultMaxResults)
+		if opts.MaxResults < 0 {
+			return search.Options{}, rpc.Errorf(rpc.CodeInvalidParams, "max_results: must be 0 (unlimited) or a positive count, got %d", opts.MaxResults)
+		}
+	}
+	return opts, nil
+}
+
+// referencesParams are cdx/references' params, after refs' flags.
+type referencesParams struct {
+	MaxResults   *int     `json:"max_results"`
+	IncludeTests *bool    `json:"include_tests"`
+	Symbol       string   `json:"symbol"`
+	Lang         string   `json:"lang"`
+	RefKind      []string `json:"ref_kind"`
+	NoComments   bool     `json:"no_comments"`
+	NoStrings    bool     `json:"no_strings"`
+	Strings      bool     `json:"strings"`
+	IgnoreCase   bool     `json:"ignore_case"`
+	CodeOnly     bool     `json:"code_only"`
+	TestsOnly    bool     `json:"tests_only"`
+	All          bool     `json:"all"`
+	Follow       bool     `json:"follow"`
+	Generated    bool     `json:"generated"`
+}
+
+// progressReport is the params of a $/progress notification.
+type progressReport struct {
+	ID    json.RawMessage `json:"id"`    // The request's
+	Files int             `json:"files"` // Searched so far
+	Total int             `json:"total"` // Estimated, or 0 if unknown
+}
+
+// references answers cdx/references, sending progress notifications as it
+// goes.
+func (s *server) references(ctx context.Context, req *rpc.Request) (any, error) {
+	var p referencesParams
+	if err := req.Decode(&p); err != nil {
+		return nil, err
+	}
+	var sent time.Time
+	return s.findReferences(ctx, p, func(files, total int) {
+		if time.Since(sent) < progressInterval {
+			return
+		}
+		sent = time.Now()
+		// A client that's gone will find out from the response
+		_ = req.Notify(progressMethod, progressReport{ID: req.ID, Files: files, Total: total})
+	})
+}
+
+// findReferences answers p as cdx refs -o json does. progress, when set, is
+// called as each file is reached with how many have been and an estimate
+// of how many will be.
+func (s *server) findReferences(ctx context.Context, p referencesParams, progress func(files, total int)) (any, error) {
+	switch {
+	case p.Symbol == "":
+		return nil, rpc.Errorf(rpc.CodeInvalidParams, "symbol: missing")
+	case p.Strings && p.NoStrings:
+		return nil, rpc.Errorf(rpc.CodeInvalidParams, "strings and no_strings can't both be set")
+	case countTrue(p.CodeOnly, p.TestsOnly, p.All) > 1:
+		return nil, rpc.Errorf(rpc.CodeInvalidParams, "only one of code_only, tests_only, and all can be set")
+	}
+	kinds, err := parseRefKinds(p.RefKind)
+	if err != nil {
+		return nil, rpc.Errorf(rpc.CodeInvalidParams, "%v", err)
+	}
+	maxResults := paramOr(p.MaxResults, nonZero(s.cfg.MaxResults), 0)
+	if maxResults < 0 {
+		return nil, rpc.Errorf(rpc.CodeInvalidParams, "max_results: must be 0 (unlimited) or a positive count, got %d", maxResults)
+	}
+	langs, err := langsFor(p.Lang, "lang", s.cfg)
+	if err != nil {
+		return nil, rpc.Errorf(rpc.CodeInvalidParams, "lang: %v", err)
+	}
+	roots, base, err := resolveRoots(s.cmd, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := exclusions(s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	maxFileSize, err := resolveMaxFileSize(s.cmd, "", s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	maxLineLength, err := resolveMaxLineLength(s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	workers, err := resolveJobs(s.cmd, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := symbols.ForParser(s.cfg.BackendParser); err != nil {
+		return nil, err
+	}
+
+	query := cdx.Query{
+		Symbol:            p.Symbol,
+		Parser:            s.cfg.BackendParser,
+		Exclude:           exclude,
+		TestPaths:         s.cfg.TestPaths,
+		GeneratedPatterns: s.cfg.GeneratedPatterns,
+		StopAfter:         maxResults,
+		MaxFileSize:       maxFileSize,
+		MaxLineLength:     maxLineLength,
+		IncludeTests:      true,
+		IncludeGenerated:  p.Generated,
+		IgnoreCase:        p.IgnoreCase,
+		SkipComments:      p.NoComments,
+		SkipStrings:       p.NoStrings,
+		InStrings:         p.Strings,
+		FollowSymlinks:    p.Follow,
+		Cache:             !noCache,
+	}
+	for _, kind := range kinds {
+		query.Kinds = append(query.Kinds, string(kind))
+	}
+	for _, lang := range langs.Langs {
+		query.Languages = append(query.Languages, cdx.Language(lang))
+	}
+	switch {
+	case p.TestsOnly:
+		query.OnlyTests = true
+	case p.CodeOnly:
+		query.IncludeTests = false
+	case !p.All:
+		query.IncludeTests = paramOr(p.IncludeTests, s.cfg.IncludeTests, true)
+	}
+
+	ctx, cancel := withSearchTimeout(ctx)
+	defer cancel()
+	// Each root's search reuses the server's walk of it and its open cache,
+	// saved once the search is done
+	ctx = session.With(ctx, &session.State{
+		Definitions: s.defs,
+		Root: func(dir string) session.Root {
+			var r session.Root
+			if w := s.walks[dir]; w != nil {
+				r.Files = w.files
+			}
+			r.Cache = s.cache(dir)
+			return r
+		},
+	})
+	// The roots are searched at once, so progress adds up their files
+	var (
+		total      int
+		reached    = make([]int, len(roots))
+		progressMu sync.Mutex
+	)
+	expected := make([]int, len(roots))
+	for i, root := range roots {
+		if w := s.walks[root.Dir]; w != nil {
+			expected[i] = len(w.files)
+		} else {
+			expected[i] = estimateFiles(root.Dir, nil)
+		}
+		total += expected[i]
+	}
+	byRoot := make([][]refs.Ref, len(roots))
+	stats := make([]refs.Stats, len(roots))
+	errs := searchRoots(ctx, len(roots), workers, func(ctx context.Context, i, jobs int) error {
+		root, q := roots[i], query
+		q.Roots, q.Jobs = []string{root.Dir}, jobs
+		if c := s.cache(root.Dir); c != nil {
+			defer saveCache(s.cmd.ErrOrStderr(), c)
+		}
+		if progress != nil {
+			q.Progress = func(n int) {
+				progressMu.Lock()
+				defer progressMu.Unlock()
+				reached[i] = n
+				files := 0
+				for _, r := range reached {
+					files += r
+				}
+				progress(files, total)
+			}
+		}
+		res, err := cdx.Search(ctx, q)
+		for _, r := range res.Results {
+			ref := refOf(r)
+			ref.Path = showPath(root.RelTo(base, ref.Path))
+			byRoot[i] = append(byRoot[i], ref)
+		}
+		stats[i] = statsOf(res)
+		return err
+	})
+	var found []refs.Ref
+	var files, unreadable int
+	for i := range roots {
+		if _, done := resultBudget(maxResults, found); done {
+			break
+		}
+		found = append(found, byRoot[i]...)
+		files += stats[i].Files
+		unreadable += len(stats[i].Unreadable)
+		if err = errs[i]; err != nil {
+			break
+		}
+	}
+	partial := err != nil && interrupted(err)
+	if err != nil && !partial {
+		return nil, err
+	}
+
+	defs, found := refs.Partition(found)
+	if maxResults > 0 && len(found) > maxResults {
+		found = found[:maxResults]
+	}
+	report := refsReport{Refs: found, Definitions: defs, Files: files, Unreadable: unreadable, Partial: partial}
+	var pe progressError
+	if errors.As(err, &pe) {
+		_, report.Total = pe.Progress()
+	}
+	if report.Refs == nil {
+		report.Refs = []refs.Ref{}
+	}
+	if report.Definitions == nil {
+		report.Definitions = []refs.Ref{}
+	}
+	return report, nil
+}
+
+// outlineParams are cdx/outline's params, after outline's flags.
+type outlineParams struct {
+	// Content, when set, is outlined in place of the file's content
+	Content    *string  `json:"content"`
+	File       string   `json:"file"`
+	Lang       string   `json:"lang"`
+	Sort       string   `json:"sort"`
+	Kind       []string `json:"kind"`
+	MinLines   int      `json:"min_lines"`
+	PublicOnly bool     `json:"public_only"`
+	Metrics    bool     `json:"metrics"`
+}
+
+// outline answers cdx/outline.
+func (s *server) outline(ctx context.Context, req *rpc.Request) (any, error) {
+	var p outlineParams
+	if err := req.Decode(&p); err != nil {
+		return nil, err
+	}
+	return s.outlineFile(p)
+}
+
+// outlineFile answers p as cdx outline -o json does.
+func (s *server) outlineFile(p outlineParams) (any, error) {
+	if p.File == "" {
+		return nil, rpc.Errorf(rpc.CodeInvalidParams, "file: missing")
+	}
+	if p.Sort == "" {
+		p.Sort = outline.ByLine
+	}
+	filter, err := newOutlineFilter(p.Sort, p.Kind, p.MinLines, p.PublicOnly, p.Metrics)
+	if err != nil {
+		return nil, rpc.Errorf(rpc.CodeInvalidParams, "%v", err)
+	}
+	extractor, err := symbols.ForParser(s.cfg.BackendParser)
+	if err != nil {
+		return nil, err
+	}
+	lang := patterns.Language(p.Lang)
+	if lang == patterns.Unknown {
+		lang = patterns.DetectFile(p.File)
+	}
+	if patterns.ForLanguage(lang) == nil {
+		return nil, rpc.Errorf(rpc.CodeInvalidParams, "cannot detect language of %s (use lang)", p.File)
+	}
+
+	var src []byte
+	var record func([]symbols.Symbol)
+	if p.Content != nil {
+		src, _ = scan.Decode([]byte(*p.Content))
+	} else {
+		// A file on disk fills its root's open cache, for cdx/symbols
+		if c, rec := outlineCache(p.File, s.cache); c != nil {
+			record = rec
+			defer saveCache(s.cmd.ErrOrStderr(), c)
+		}
+		if src, _, err = scan.ReadFile(p.File); err != nil {
+			return nil, err
+		}
+	}
+	tree, err := filter.build(extractor, src, lang, p.File, record)
+	if err != nil {
+		return nil, err
+	}
+	outline.Sort(tree, filter.sort)
+	return outline.NewDocument(p.File, lang, tree), nil
+}
+
+// symbolsParams are cdx/symbols' params, after symbols' flags.
+type symbolsParams struct {
+	Complete string `json:"complete"`
+	Limit    int    `json:"limit"`
+}
+
+// symbolsReport is cdx/symbols' result.
+type symbolsReport struct {
+	Symbols []cache.Name `json:"symbols"`
+}
+
+// symbols answers cdx/symbols from the open cache of the repository, which
+// holds the definitions found since the server started as well as the
+// saved ones.
+func (s *server) symbols(ctx context.Context, req *rpc.Request) (any, error) {
+	p := symbolsParams{Limit: completeLimit}
+	if err := req.Decode(&p); err != nil {
+		return nil, err
+	}
+	if p.Limit < 1 {
+		return nil, rpc.Errorf(rpc.CodeInvalidParams, "limit: must be at least 1, got %d", p.Limit)
+	}
+	report := symbolsReport{Symbols: []cache.Name{}}
+	root, _, err := resolveRoot(s.cmd, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	if c := s.cache(root.Dir); c != nil {
+		report.Symbols = append(report.Symbols, c.Complete(p.Complete, p.Limit)...)
+	}
+	return report, nil
+}
+
+// statsReport is cdx/stats's result.
+type statsReport struct {
+	DefinitionPatterns patterns.DefinitionCacheStats `json:"definition_patterns"`
+}
+
+// stats answers cdx/stats with how well the server's caches are doing.
+func (s *server) stats(ctx context.Context, req *rpc.Request) (any, error) {
+	if err := req.Decode(&struct{}{}); err != nil {
+		return nil, err
+	}
+	return statsReport{DefinitionPatterns: s.defs.Stats()}, nil
+}
+
+// capabilities answers cdx/capabilities with what the server can do, as cdx
+// capabilities reports it.
+func (s *server) capabilities(ctx context.Context, req *rpc.Request) (any, error) {
+	if err := req.Decode(&struct{}{}); err != nil {
+		return nil, err
+	}
+	return s.capabilitiesReport(), nil
+}
+
+// paramOr returns *param when the param was given, otherwise the config's
+// setting when it's set, otherwise fallback.
+func paramOr[T any](param, setting *T, fallback T) T {
+	switch {
+	case param != nil:
+		return *param
+	case setting != nil:
+		return *setting
+	}
+	return fallback
+}
+
+// nonZero returns a pointer to n, or nil when n is zero, for settings whose
+// zero value means unset.
+func nonZero(n int) *int {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+// countTrue returns how many of bs are true.
+func countTrue(bs ...bool) int {
+	n := 0
+	for _, b := range bs {
+		if b {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/cache"
+)
+
+// completeLimit is how many names completion offers at most.
+const completeLimit = 50
+
+var (
+	symbolsComplete string
+	symbolsLimit    int
+)
+
+var symbolsCmd = &cobra.Command{
+	Use:   "symbols --complete <prefix>",
+	Short: "Complete symbol names from the index",
+	Long: `Complete symbol names from the index, for shell widgets, editor pickers,
+and other tools that look names up as they're typed.
+
+--complete prints the names starting with a prefix, one per line with its
+kind after a tab, in sorted order. The names come only from the symbol
+cache's index of the repository, which def, refs, and outline keep up to
+date, so the lookup takes milliseconds however large the repository is, but
+knows only the definitions they have seen: every file def searches, the
+files refs finds references in, and the files outline is run on. When
+there's no index yet, or it's out of date, nothing is printed and the exit
+code is still 0; run a def search to build it. The symbol argument of def, refs, and callers completes the same way.
+
+Examples:
+  cdx symbols --complete Parse             # Names starting with Parse
+  cdx symbols --complete Get --limit 10    # At most 10 of them`,
+	Args: cobra.NoArgs,
+	RunE: runSymbols,
+}
+
+func init() {
+	symbolsCmd.Flags().StringVar(&symbolsComplete, "complete", "", "Print the indexed names starting with this prefix")
+	symbolsCmd.Flags().IntVar(&symbolsLimit, "limit", completeLimit, "Print at most this many names")
+	_ = symbolsCmd.MarkFlagRequired("complete")
+	rootCmd.AddCommand(symbolsCmd)
+
+	for _, c := range []*cobra.Command{defCmd, refsCmd, callersCmd} {
+		c.ValidArgsFunction = completeSymbol
+	}
+}
+
+func runSymbols(cmd *cobra.Command, args []string) error {
+	if symbolsLimit < 1 {
+		return fmt.Errorf("--limit must be at least 1, got %d", symbolsLimit)
+	}
+	w := cmd.OutOrStdout()
+	for _, n := range indexedNames(cmd, symbolsComplete, symbolsLimit) {
+		fmt.Fprintf(w, "%s\t%s\n", n.Name, n.Kind)
+	}
+	return nil
+}
+
+// completeSymbol completes the symbol argument of a search command from the
+// index.
+func completeSymbol(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []cobra.Completion
+	for _, n := range indexedNames(cmd, toComplete, completeLimit) {
+		names = append(names, cobra.CompletionWithDesc(n.Name, n.Kind))
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// indexedNames returns up to limit names starting with prefix from the index
+// of the repository cmd searches, or none when there's no usable index.
+func indexedNames(cmd *cobra.Command, prefix string, limit int) []cache.Name {
+	if noCache {
+		return nil
+	}
+	root, _, err := resolveRoot(cmd, commandConfig(cmd))
+	if err != nil {
+		return nil
+	}
+	names, err := cache.Complete(root.Dir, prefix, limit)
+	if err != nil {
+		return nil
+	}
+	return names
+}
@@ -1,7 +1,18 @@
 package cli
 
 import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+
 	"github.com/spf13/cobra"
+
+	"github.com/bashhack/cdx/internal/backend"
+	"github.com/bashhack/cdx/internal/outline"
+	"github.com/bashhack/cdx/pkg/cdx"
 )
 
 // Version information (set at build time via ldflags)
@@ -11,19 +22,193 @@ var (
 	BuildDate = "unknown"
 )
 
+var versionCheck string
+
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print version information",
-	Long:  `Print the version, commit hash, and build date of cdx.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		cmd.Printf("cdx %s\n", Version)
-		if Commit != "unknown" || BuildDate != "unknown" {
-			cmd.Printf("  commit: %s\n", Commit)
-			cmd.Printf("  built:  %s\n", BuildDate)
-		}
-	},
+	Long: `Print the version, commit hash, and build date of cdx.
+
+A build without them set at link time, such as one from go install, reports
+the module version and the commit git stamped into it, when there is one.
+
+JSON output adds what wrapping tools check for: the Go version and platform,
+the schema_version of cdx outline's JSON, the search backends available,
+and the languages supported.
+
+--check exits with code 1 unless the version satisfies a constraint, such
+as ">=1.3.0", "<2", or ">=1.3.0,<2" for both, so scripts can require a
+feature. A development build satisfies none.
+
+Examples:
+  cdx version
+  cdx version -o json
+  cdx version --check '>=1.3.0' || echo "cdx is too old"`,
+	Args: cobra.NoArgs,
+	// Reporting the version shouldn't depend on the config parsing
+	Annotations: map[string]string{noConfigAnnotation: "true"},
+	RunE:        runVersion,
 }
 
 func init() {
+	versionCmd.Flags().StringVar(&versionCheck, "check", "", "Exit with code 1 unless the version satisfies this constraint, e.g. \">=1.3.0\"")
 	rootCmd.AddCommand(versionCmd)
 }
+
+// versionReport is the JSON representation of cdx version.
+type versionReport struct {
+	Version       string   `json:"version"`
+	Commit        string   `json:"commit"`
+	BuildDate     string   `json:"build_date"`
+	GoVersion     string   `json:"go_version"`
+	OS            string   `json:"os"`
+	Arch          string   `json:"arch"`
+	Backends      []string `json:"backends"` // Available, in auto detection order
+	Languages     []string `json:"languages"`
+	SchemaVersion int      `json:"schema_version"`
+}
+
+func runVersion(cmd *cobra.Command, args []string) error {
+	version, commit, buildDate := buildInfo()
+	if versionCheck != "" {
+		ok, err := satisfies(version, versionCheck)
+		if err != nil {
+			return fmt.Errorf("--check: %w", err)
+		}
+		if !ok {
+			return ExitError{Code: 1, Err: fmt.Errorf("cdx %s doesn't satisfy %s", version, versionCheck)}
+		}
+		return nil
+	}
+
+	if wantJSON() {
+		report := versionReport{
+			Version:       version,
+			Commit:        commit,
+			BuildDate:     buildDate,
+			GoVersion:     runtime.Version(),
+			OS:            runtime.GOOS,
+			Arch:          runtime.GOARCH,
+			Backends:      availableBackends(),
+			Languages:     languageNames(),
+			SchemaVersion: outline.SchemaVersion,
+		}
+		return writeJSON(cmd.OutOrStdout(), report)
+	}
+
+	cmd.Printf("cdx %s\n", version)
+	if commit != "unknown" || buildDate != "unknown" {
+		cmd.Printf("  commit: %s\n", commit)
+		cmd.Printf("  built:  %s\n", buildDate)
+	}
+	return nil
+}
+
+// availableBackends returns the names of the search backends available, in
+// auto detection order.
+func availableBackends() []string {
+	names := []string{}
+	for _, a := range backend.Detect() {
+		if a.Available() {
+			names = append(names, string(a.Name))
+		}
+	}
+	return names
+}
+
+// languageNames returns the names of the languages supported, plugin
+// languages among them, in sorted order.
+func languageNames() []string {
+	var names []string
+	for _, lang := range cdx.Languages() {
+		names = append(names, string(lang))
+	}
+	return names
+}
+
+// buildInfo returns the version, commit, and build date, filling in those
+// the linker didn't set from the build information Go embeds.
+func buildInfo() (version, commit, buildDate string) {
+	version, commit, buildDate = Version, Commit, BuildDate
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return version, commit, buildDate
+	}
+	if v := info.Main.Version; version == "dev" && v != "" && v != "(devel)" {
+		version = strings.TrimPrefix(v, "v")
+	}
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision" && commit == "unknown":
+			commit = s.Value
+		case s.Key == "vcs.time" && buildDate == "unknown":
+			buildDate = s.Value
+		}
+	}
+	return version, commit, buildDate
+}
+
+// satisfies reports whether version meets constraint, comparisons such as
+// ">=1.3.0" separated by commas, all of which must hold. A version that
+// isn't a release, such as dev, satisfies none.
+func satisfies(version, constraint string) (bool, error) {
+	have, haveErr := parseVersion(version)
+	for c := range strings.SplitSeq(constraint, ",") {
+		c = strings.TrimSpace(c)
+		op := strings.TrimRight(c[:len(c)-len(strings.TrimLeft(c, "<>=!"))], " ")
+		want, err := parseVersion(strings.TrimSpace(c[len(op):]))
+		if err != nil {
+			return false, fmt.Errorf("%q: %w", c, err)
+		}
+		var ok bool
+		switch cmp := compareVersions(have, want); op {
+		case ">=":
+			ok = cmp >= 0
+		case ">":
+			ok = cmp > 0
+		case "<=":
+			ok = cmp <= 0
+		case "<":
+			ok = cmp < 0
+		case "=", "==", "":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		default:
+			return false, fmt.Errorf("%q: unknown operator %q (want >=, >, <=, <, =, or !=)", c, op)
+		}
+		if haveErr != nil || !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// parseVersion parses a version such as 1.3.0 or v1.3, with any missing
+// parts 0, into its major, minor, and patch numbers. A prerelease or build
+// suffix, as in 1.3.0-rc.1, is ignored.
+func parseVersion(s string) ([3]int, error) {
+	var v [3]int
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > len(v) {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// compareVersions returns -1, 0, or 1 as a is older than, the same as, or
+// newer than b.
+func compareVersions(a, b [3]int) int {
+	return slices.Compare(a[:], b[:])
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/bashhack/cdx/internal/ignore"
+)
+
+// CheckRule is a rule from the checks section, for cdx check: references to
+// a symbol that aren't allowed outside some paths, such as uses of a
+// deprecated API.
+type CheckRule struct {
+	// Symbol is the name references to which break the rule
+	Symbol string `mapstructure:"symbol" json:"symbol,omitempty"`
+	// Regex, instead of Symbol, matches every name the rule covers in full,
+	// e.g. 'Legacy\w+'
+	Regex string `mapstructure:"regex" json:"regex,omitempty"`
+	// Message says what to do instead, e.g. "use NewClient"
+	Message string `mapstructure:"message" json:"message,omitempty"`
+	// Allow lists gitignore-style patterns of paths where references are
+	// fine, such as the package that defines the API
+	Allow []string `mapstructure:"allow" json:"allow,omitempty"`
+}
+
+// Name identifies the rule: its symbol, or else its regex.
+func (r CheckRule) Name() string {
+	if r.Symbol != "" {
+		return r.Symbol
+	}
+	return r.Regex
+}
+
+// Names compiles the rule's regex anchored to match whole names, or returns
+// nil for a rule naming a symbol.
+func (r CheckRule) Names() (*regexp.Regexp, error) {
+	if r.Regex == "" {
+		return nil, nil
+	}
+	return regexp.Compile(`^(?:` + r.Regex + `)$`)
+}
+
+// AllowRules compiles the rule's allow patterns, relative to the repository
+// root.
+func (r CheckRule) AllowRules() ([]ignore.Rule, error) {
+	rules := make([]ignore.Rule, 0, len(r.Allow))
+	for _, pattern := range r.Allow {
+		rule, err := ignore.CompileRule(strings.TrimSpace(pattern), "", "allow")
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// checkChecks validates rules, naming the offending entry by its index, e.g.
+// checks[2].regex.
+func checkChecks(rules []CheckRule) error {
+	for i, r := range rules {
+		where := fmt.Sprintf("checks[%d]", i)
+		switch {
+		case r.Symbol == "" && r.Regex == "":
+			return fmt.Errorf("%s: needs symbol or regex", where)
+		case r.Symbol != "" && r.Regex != "":
+			return fmt.Errorf("%s: has both symbol and regex", where)
+		}
+		if _, err := r.Names(); err != nil {
+			return fmt.Errorf("%s.regex: %w", where, err)
+		}
+		if _, err := r.AllowRules(); err != nil {
+			return fmt.Errorf("%s.allow: %w", where, err)
+		}
+	}
+	return nil
+}
+
+// ReadChecks reads the rules in the checks section of the YAML file at path,
+// a rules file given to cdx check in place of the config's.
+func ReadChecks(path string) ([]CheckRule, error) {
+	v := viper.NewWithOptions(viper.KeyDelimiter("::"))
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("rules file: %w", err)
+	}
+	if !v.IsSet("checks") {
+		return nil, errors.New(path + ": no checks")
+	}
+	var rules []CheckRule
+	if err := v.UnmarshalKey("checks", &rules); err != nil {
+		return nil, fmt.Errorf("%s: checks: %w", path, err)
+	}
+	if err := checkChecks(rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckRules(t *testing.T) {
+	rule := CheckRule{Regex: `Legacy\w+`, Allow: []string{"internal/legacy/**"}}
+	if got := rule.Name(); got != `Legacy\w+` {
+		t.Errorf("Name() = %q, want the regex", got)
+	}
+	names, err := rule.Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"LegacyClient": true, "NewLegacyClient": false, "Legacy": false} {
+		if got := names.MatchString(name); got != want {
+			t.Errorf("Names() matches %q = %v, want %v", name, got, want)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		wantErr string
+		rule    CheckRule
+	}{
+		{name: "symbol", rule: CheckRule{Symbol: "OldClient", Message: "use NewClient"}},
+		{name: "neither", rule: CheckRule{Message: "nothing"}, wantErr: "checks[0]: needs symbol or regex"},
+		{name: "both", rule: CheckRule{Symbol: "A", Regex: "B"}, wantErr: "checks[0]: has both symbol and regex"},
+		{name: "bad regex", rule: CheckRule{Regex: "Old(Client"}, wantErr: "checks[0].regex: error parsing regexp"},
+		{name: "bad allow", rule: CheckRule{Symbol: "A", Allow: []string{"/"}}, wantErr: "checks[0].allow: invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkChecks([]CheckRule{tt.rule})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkChecks() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkChecks() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_Checks(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Chdir(tmp)
+	yaml := `checks:
+  - symbol: OldClient
+    message: use NewClient
+    allow: [internal/legacy/]
+  - regex: 'Deprecated\w*'
+`
+	if err := os.WriteFile(".cdx.yaml", []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Checks) != 2 || cfg.Checks[0].Message != "use NewClient" || cfg.Checks[0].Allow[0] != "internal/legacy/" || cfg.Checks[1].Regex != `Deprecated\w*` {
+		t.Errorf("Checks = %+v", cfg.Checks)
+	}
+	if len(cfg.Warnings) != 0 {
+		t.Errorf("Warnings = %v, want none", cfg.Warnings)
+	}
+
+	if err := os.WriteFile(".cdx.yaml", []byte("checks:\n  - message: no name\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), ".cdx.yaml: checks[0]: needs symbol or regex") {
+		t.Errorf("Load() error = %v, want the config file and entry named", err)
+	}
+}
+
+func TestReadChecks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte("checks:\n  - symbol: OldClient\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := ReadChecks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].Symbol != "OldClient" {
+		t.Errorf("ReadChecks() = %+v, want OldClient", rules)
+	}
+
+	if err := os.WriteFile(path, []byte("rules: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadChecks(path); err == nil || !strings.Contains(err.Error(), "no checks") {
+		t.Errorf("ReadChecks() error = %v, want no checks", err)
+	}
+	if _, err := ReadChecks(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("ReadChecks() of a missing file succeeded")
+	}
+}
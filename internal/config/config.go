@@ -2,79 +2,377 @@
 package config
 
 import (
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
+
+	"github.com/bashhack/cdx/internal/backend"
+	"github.com/bashhack/cdx/internal/generated"
+	"github.com/bashhack/cdx/internal/pager"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/termcolor"
 )
 
 // Config holds the application configuration.
 type Config struct {
-	// Whether to use color output (auto-detected if not set)
-	Color *bool `mapstructure:"color"`
+	// Search test files; unset keeps each command's default (def skips
+	// them, refs includes them)
+	IncludeTests *bool `mapstructure:"include_tests"`
+	// Color output: "auto" (when writing to a terminal), "always", or "never"
+	Color string `mapstructure:"color"`
 	// Output format: "auto", "human", "json", "plain"
 	OutputFormat string `mapstructure:"output_format"`
+	// Files larger than this are skipped, e.g. "2M" or "512K"; "0" means unlimited
+	MaxFileSize string `mapstructure:"max_file_size"`
+	// Only this much of each line is searched, e.g. "64K"; "0" means unlimited
+	MaxLineLength string `mapstructure:"max_line_length"`
+	// Most input read from stdin, as by "cdx outline -", e.g. "8M"; "0"
+	// means unlimited
+	MaxStdinSize string `mapstructure:"max_stdin_size"`
+	// Symbol extractor: "regex" or "tree-sitter" (needs a -tags treesitter build)
+	BackendParser string `mapstructure:"backend_parser"`
+	// Where searches start: "repo" (the enclosing repository root) or "cwd"
+	SearchRoot string `mapstructure:"search_root"`
+	// Go def/refs backend: "regex" or "gopls" (precise, when gopls is installed)
+	GoBackend string `mapstructure:"go_backend"`
+	// Text search backend for def: "auto", "rg", "grep", or "native"
+	Backend string `mapstructure:"backend"`
+	// How long a search runs before stopping with partial results, e.g.
+	// "45s" or "2m"; "0" means no limit
+	Timeout string `mapstructure:"timeout"`
+	// Page output through $PAGER: "auto" (when writing to a terminal),
+	// "always", or "never"; the environment variable is CDX_USE_PAGER, since
+	// $PAGER names the program
+	Pager string `mapstructure:"pager"`
+	// Command that opens a file at a line, e.g. "nvim +{line} {file}", with
+	// {file}, {line}, and {col} placeholders; unset falls back to $VISUAL or
+	// $EDITOR. A bare program name uses its known line-jump syntax.
+	Editor string `mapstructure:"editor"`
+	// Whether roots add to the default search root ("append") or replace
+	// it ("replace")
+	RootsMode string `mapstructure:"roots_mode"`
+	// How long the directory listings recorded by one walk are relied on,
+	// where a directory's modification time says it hasn't changed, before
+	// a walk reads every directory again, e.g. "15m" or "1h"; "0" turns the
+	// recorded listings off
+	WalkCacheTTL string `mapstructure:"walk_cache_ttl"`
+	// The profile applied, if any
+	Profile string `mapstructure:"-"`
+	// Named sets of settings selected with --profile, e.g. an "agent"
+	// profile with output_format: json; each overrides the files' settings
+	Profiles map[string]map[string]any `mapstructure:"profiles"`
+	// Where each key's value came from; see Source
+	Sources map[string]string `mapstructure:"-"`
+	// Directory names never searched, on top of the built-in list; "/name"
+	// anchors an entry to the repository root
+	ExcludeDirs []string `mapstructure:"exclude_dirs"`
+	// More directories every search covers, such as sibling repositories
+	// in a multi-repo workspace; absolute or starting with ~/
+	Roots []string `mapstructure:"roots"`
+	// Languages searched when --lang isn't given, e.g. "ts" or [ts, js]
+	DefaultLang []string `mapstructure:"default_lang"`
+	// gitignore-style patterns for paths never searched
+	ExcludeGlobs []string `mapstructure:"exclude_globs"`
+	// Like exclude_dirs and exclude_globs, but accumulated across config
+	// files instead of replaced, so a project can add to global exclusions
+	ExtraExcludeDirs  []string `mapstructure:"extra_exclude_dirs"`
+	ExtraExcludeGlobs []string `mapstructure:"extra_exclude_globs"`
+	// gitignore-style patterns for the names of generated files, left out
+	// of def, refs, and callers unless --generated; files whose first lines
+	// say they're generated are left out too
+	GeneratedPatterns []string `mapstructure:"generated_patterns"`
+	// gitignore-style patterns for test files and the directories they live
+	// in, beyond each language's conventions; a negated one, such as
+	// "!src/features/", marks what it matches as code instead
+	TestPaths []string `mapstructure:"test_paths"`
+	// Maps file extensions to languages, e.g. {".gohtml": "go"}; "" stops an
+	// extension from being searched
+	LanguageExtensions map[string]string `mapstructure:"language_extensions"`
+	// Extra definition patterns for in-house DSLs; see CustomPattern
+	CustomPatterns []CustomPattern `mapstructure:"custom_patterns"`
+	// Rules cdx check enforces; see CheckRule
+	Checks []CheckRule `mapstructure:"checks"`
+	// Problems found while loading that didn't stop it, such as unknown keys
+	Warnings []Warning `mapstructure:"-"`
+	// Config files read, lowest precedence first
+	Files []string `mapstructure:"-"`
 	// Default context lines for search results
 	ContextLines int `mapstructure:"context_lines"`
+	// Result cap for def and refs; 0 keeps each command's default
+	MaxResults int `mapstructure:"max_results"`
+	// Most callers a cdx callers tree shows; 0 means no limit
+	MaxCallerNodes int `mapstructure:"max_caller_nodes"`
+	// Files scanned concurrently; 0 picks a count from the CPUs available
+	Jobs int `mapstructure:"jobs"`
+	// Search only files tracked by git instead of walking the directory
+	TrackedOnly bool `mapstructure:"tracked_only"`
+	// Match all-lowercase symbols case-insensitively
+	SmartCase bool `mapstructure:"smart_case"`
+	// Answer def from a ctags/etags tags file at the repo root when present
+	UseTags bool `mapstructure:"use_tags"`
 }
 
 // DefaultConfig returns a Config with sensible defaults.
 func DefaultConfig() *Config {
 	return &Config{
-		OutputFormat: "auto",
-		ContextLines: 2,
-		Color:        nil, // auto-detect
+		OutputFormat:   "auto",
+		ContextLines:   2,
+		MaxFileSize:    "2M",
+		MaxLineLength:  "64K",
+		MaxStdinSize:   "8M",
+		BackendParser:  "regex",
+		GoBackend:      "regex",
+		Backend:        string(backend.Auto),
+		SearchRoot:     "repo",
+		UseTags:        true,
+		Color:          string(termcolor.Auto),
+		Timeout:        "30s",
+		Pager:          string(pager.Auto),
+		RootsMode:      "append",
+		WalkCacheTTL:   "15m",
+		MaxCallerNodes: 200,
+		// A copy, so a config can't change the package's list
+		GeneratedPatterns: slices.Clone(generated.DefaultPatterns),
 	}
 }
 
-// Load reads configuration from files and environment.
-// It looks for .cdx.yaml in order of precedence:
-// 1. Current directory (./.cdx.yaml)
-// 2. OS-specific config directory (e.g., ~/.config/cdx/.cdx.yaml on Linux)
-// 3. Home directory (~/.cdx.yaml)
-// 4. Environment variables prefixed with CDX_
-func Load() (*Config, error) {
-	cfg := DefaultConfig()
-
-	v := viper.New()
-	v.SetConfigName(".cdx")
-	v.SetConfigType("yaml")
+// Environment variables that choose what to load, as --config and
+// --profile do.
+const (
+	EnvConfig  = "CDX_CONFIG"
+	EnvProfile = "CDX_PROFILE"
+)
 
-	// Look in current directory first
-	v.AddConfigPath(".")
+// Load reads configuration from files and environment; see LoadFrom.
+func Load() (*Config, error) {
+	return LoadFrom("", "")
+}
 
-	// Then OS-specific config directory
-	if configDir, err := ConfigDir(); err == nil {
-		v.AddConfigPath(configDir)
+// LoadFrom reads configuration from files and environment. When path, or
+// else $CDX_CONFIG, names a config file, only that file is read, and it's an
+// error for it not to exist. Otherwise every .cdx.yaml that exists is read,
+// lowest precedence first, and merged key by key:
+// 1. OS-specific config directory (e.g., ~/.config/cdx/.cdx.yaml on Linux)
+// 2. Home directory (~/.cdx.yaml)
+// 3. Project directory: the nearest .cdx.yaml from the current directory
+// up to the repository root
+// The named profile, or else $CDX_PROFILE's, overrides every file, and
+// environment variables prefixed with CDX_ override the profile.
+//
+// A later file overrides only the keys it sets. Maps such as
+// language_extensions merge entry by entry, and lists replace the earlier
+// list, except extra_exclude_dirs and extra_exclude_globs, which accumulate
+// across files and add to exclude_dirs and exclude_globs.
+func LoadFrom(path, profile string) (*Config, error) {
+	files, err := Files(path)
+	if err != nil {
+		return nil, err
 	}
-
-	// Then home directory
-	if home, err := os.UserHomeDir(); err == nil {
-		v.AddConfigPath(home)
+	if profile == "" {
+		profile = os.Getenv(EnvProfile)
 	}
+	cfg := DefaultConfig()
+
+	// Map keys such as ".gohtml" contain dots, so nested keys are split on
+	// "::" instead
+	v := viper.NewWithOptions(viper.KeyDelimiter("::"))
 
 	// Set defaults so Viper knows about the keys
 	v.SetDefault("output_format", cfg.OutputFormat)
+	v.SetDefault("color", cfg.Color)
 	v.SetDefault("context_lines", cfg.ContextLines)
+	v.SetDefault("jobs", cfg.Jobs)
+	v.SetDefault("max_results", cfg.MaxResults)
+	v.SetDefault("max_caller_nodes", cfg.MaxCallerNodes)
+	v.SetDefault("include_tests", cfg.IncludeTests)
+	v.SetDefault("max_file_size", cfg.MaxFileSize)
+	v.SetDefault("max_line_length", cfg.MaxLineLength)
+	v.SetDefault("max_stdin_size", cfg.MaxStdinSize)
+	v.SetDefault("tracked_only", cfg.TrackedOnly)
+	v.SetDefault("smart_case", cfg.SmartCase)
+	v.SetDefault("backend_parser", cfg.BackendParser)
+	v.SetDefault("go_backend", cfg.GoBackend)
+	v.SetDefault("backend", cfg.Backend)
+	v.SetDefault("editor", cfg.Editor)
+	v.SetDefault("timeout", cfg.Timeout)
+	v.SetDefault("pager", cfg.Pager)
+	v.SetDefault("roots", cfg.Roots)
+	v.SetDefault("roots_mode", cfg.RootsMode)
+	v.SetDefault("walk_cache_ttl", cfg.WalkCacheTTL)
+	v.SetDefault("search_root", cfg.SearchRoot)
+	v.SetDefault("use_tags", cfg.UseTags)
+	v.SetDefault("default_lang", cfg.DefaultLang)
+	v.SetDefault("exclude_dirs", cfg.ExcludeDirs)
+	v.SetDefault("exclude_globs", cfg.ExcludeGlobs)
+	v.SetDefault("extra_exclude_dirs", cfg.ExtraExcludeDirs)
+	v.SetDefault("extra_exclude_globs", cfg.ExtraExcludeGlobs)
+	v.SetDefault("generated_patterns", cfg.GeneratedPatterns)
+	v.SetDefault("test_paths", cfg.TestPaths)
 
-	// Environment variables (CDX_OUTPUT_FORMAT, CDX_CONTEXT_LINES, etc.)
-	v.SetEnvPrefix("CDX")
-	v.AutomaticEnv()
-
-	// Read config file (ignore if not found)
-	if err := v.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+	l := newLayers()
+	for _, file := range files {
+		if err := l.merge(v, file); err != nil {
 			return nil, err
 		}
 	}
-
-	if err := v.Unmarshal(cfg); err != nil {
+	if profile != "" {
+		if err := l.profile(v, profile); err != nil {
+			return nil, err
+		}
+	}
+	// Environment variables (CDX_OUTPUT_FORMAT, CDX_CONTEXT_LINES, etc.)
+	if err := l.bindEnv(v); err != nil {
 		return nil, err
 	}
 
+	if err := decode(v, cfg); err != nil {
+		return nil, l.blame(err)
+	}
+	if cfg.ExtraExcludeDirs, err = l.extra(v, "extra_exclude_dirs"); err != nil {
+		return nil, l.blame(err)
+	}
+	if cfg.ExtraExcludeGlobs, err = l.extra(v, "extra_exclude_globs"); err != nil {
+		return nil, l.blame(err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, l.blame(err)
+	}
+	cfg.Files, cfg.Sources, cfg.Warnings = l.files, l.sources, l.warnings
+	cfg.Profile = profile
+
 	return cfg, nil
 }
 
+// ColorMode returns the color setting. The true and false of older configs
+// still work, as always and never.
+func (c *Config) ColorMode() (termcolor.Mode, error) {
+	switch strings.ToLower(c.Color) {
+	case "true", "1":
+		return termcolor.Always, nil
+	case "false", "0":
+		return termcolor.Never, nil
+	}
+	mode, err := termcolor.ParseMode(c.Color)
+	if err != nil {
+		return "", fmt.Errorf("color: %w", err)
+	}
+	return mode, nil
+}
+
+// SearchTimeout returns the timeout setting as a duration; zero means no
+// limit.
+func (c *Config) SearchTimeout() (time.Duration, error) {
+	d, err := time.ParseDuration(c.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("timeout: invalid duration %q (want e.g. 45s or 2m)", c.Timeout)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("timeout: must be 0 or more, got %s", c.Timeout)
+	}
+	return d, nil
+}
+
+// WalkCacheLifetime returns the walk_cache_ttl setting as a duration; zero
+// means recorded directory listings aren't used.
+func (c *Config) WalkCacheLifetime() (time.Duration, error) {
+	d, err := time.ParseDuration(c.WalkCacheTTL)
+	if err != nil {
+		return 0, fmt.Errorf("walk_cache_ttl: invalid duration %q (want e.g. 15m or 1h)", c.WalkCacheTTL)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("walk_cache_ttl: must be 0 or more, got %s", c.WalkCacheTTL)
+	}
+	return d, nil
+}
+
+// SearchRoots returns the roots setting as absolute, clean paths, with a
+// leading ~ expanded to the home directory.
+func (c *Config) SearchRoots() ([]string, error) {
+	roots := make([]string, 0, len(c.Roots))
+	for _, root := range c.Roots {
+		dir := root
+		if dir == "~" || strings.HasPrefix(dir, "~/") || strings.HasPrefix(dir, `~\`) {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("roots: expanding %q: %w", root, err)
+			}
+			dir = filepath.Join(home, dir[1:])
+		}
+		if !filepath.IsAbs(dir) {
+			return nil, fmt.Errorf("roots: %q is not an absolute path or under ~/", root)
+		}
+		roots = append(roots, filepath.Clean(dir))
+	}
+	return roots, nil
+}
+
+// DefaultLanguages validates default_lang and returns it as languages.
+func (c *Config) DefaultLanguages() ([]patterns.Language, error) {
+	langs := make([]patterns.Language, 0, len(c.DefaultLang))
+	for _, name := range c.DefaultLang {
+		lang := patterns.Language(strings.TrimSpace(name))
+		if patterns.ForLanguage(lang) == nil {
+			known := make([]string, 0, len(patterns.AllLanguages()))
+			for _, l := range patterns.AllLanguages() {
+				known = append(known, string(l))
+			}
+			slices.Sort(known)
+			return nil, fmt.Errorf("default_lang: unknown language %q (want one of %s)", name, strings.Join(known, ", "))
+		}
+		langs = append(langs, lang)
+	}
+	return langs, nil
+}
+
+// validate checks enum values and numeric ranges and compiles the settings
+// that hold patterns, so a bad one is reported when the config loads rather
+// than on the first search to use it.
+func (c *Config) validate() error {
+	if err := c.checkEnums(); err != nil {
+		return err
+	}
+	if err := c.checkRanges(); err != nil {
+		return err
+	}
+	if err := c.checkEditor(); err != nil {
+		return err
+	}
+	if _, err := c.ColorMode(); err != nil {
+		return err
+	}
+	if _, err := c.ExcludeRules(); err != nil {
+		return err
+	}
+	if _, err := c.Generated(); err != nil {
+		return err
+	}
+	if _, err := c.Tests(); err != nil {
+		return err
+	}
+	if _, err := c.Extensions(); err != nil {
+		return err
+	}
+	if _, err := c.DefaultLanguages(); err != nil {
+		return err
+	}
+	if _, err := c.SearchRoots(); err != nil {
+		return err
+	}
+	if err := checkChecks(c.Checks); err != nil {
+		return err
+	}
+	_, err := c.CustomDefinitions()
+	return err
+}
+
 // ConfigDir returns the path to the user's cdx config directory.
 // Uses OS-specific config location (e.g., ~/.config/cdx on Linux,
 // ~/Library/Application Support/cdx on macOS, %AppData%\cdx on Windows).
@@ -90,3 +388,68 @@ func ConfigDir() (string, error) {
 	}
 	return filepath.Join(configDir, "cdx"), nil
 }
+
+// ParseSize parses a byte size such as "512", "512K", "10M", or "1G"
+// (binary units, case-insensitive, optional trailing "B"). Zero means
+// unlimited.
+func ParseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "B")
+
+	multiplier := int64(1)
+	if str != "" {
+		switch str[len(str)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			str = str[:len(str)-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(str), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: want a non-negative number with an optional K, M, or G suffix", s)
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+	return n * multiplier, nil
+}
+
+// Setting is one configuration key, its effective value, and where the
+// value came from (see Config.Source).
+type Setting struct {
+	Value  any
+	Key    string
+	Source string
+}
+
+// Settings lists every configuration key with its value, sorted by key.
+// Unset optional values, such as an auto-detected color, are nil.
+func (c *Config) Settings() []Setting {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	settings := make([]Setting, 0, t.NumField())
+	for i := range t.NumField() {
+		key := t.Field(i).Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+		value := v.Field(i)
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				settings = append(settings, Setting{Key: key, Source: c.Source(key)})
+				continue
+			}
+			value = value.Elem()
+		}
+		settings = append(settings, Setting{Key: key, Value: value.Interface(), Source: c.Source(key)})
+	}
+	slices.SortFunc(settings, func(a, b Setting) int { return strings.Compare(a.Key, b.Key) })
+	return settings
+}
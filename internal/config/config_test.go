@@ -3,7 +3,14 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+
+	"github.com/bashhack/cdx/internal/ignore"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/termcolor"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -15,8 +22,44 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.ContextLines != 2 {
 		t.Errorf("ContextLines = %d, want %d", cfg.ContextLines, 2)
 	}
-	if cfg.Color != nil {
-		t.Errorf("Color = %v, want nil (auto-detect)", cfg.Color)
+	if cfg.Color != "auto" {
+		t.Errorf("Color = %q, want %q", cfg.Color, "auto")
+	}
+	if cfg.MaxFileSize != "2M" {
+		t.Errorf("MaxFileSize = %q, want %q", cfg.MaxFileSize, "2M")
+	}
+	if cfg.MaxLineLength != "64K" {
+		t.Errorf("MaxLineLength = %q, want %q", cfg.MaxLineLength, "64K")
+	}
+	if cfg.BackendParser != "regex" {
+		t.Errorf("BackendParser = %q, want %q", cfg.BackendParser, "regex")
+	}
+	if cfg.GoBackend != "regex" {
+		t.Errorf("GoBackend = %q, want %q", cfg.GoBackend, "regex")
+	}
+	if !cfg.UseTags {
+		t.Error("UseTags = false, want true")
+	}
+	if cfg.SearchRoot != "repo" {
+		t.Errorf("SearchRoot = %q, want %q", cfg.SearchRoot, "repo")
+	}
+	if cfg.Jobs != 0 {
+		t.Errorf("Jobs = %d, want 0 (auto)", cfg.Jobs)
+	}
+	if cfg.MaxResults != 0 {
+		t.Errorf("MaxResults = %d, want 0 (command default)", cfg.MaxResults)
+	}
+	if cfg.IncludeTests != nil {
+		t.Errorf("IncludeTests = %v, want nil (command default)", *cfg.IncludeTests)
+	}
+	if cfg.Timeout != "30s" {
+		t.Errorf("Timeout = %q, want %q", cfg.Timeout, "30s")
+	}
+	if cfg.Pager != "auto" {
+		t.Errorf("Pager = %q, want %q", cfg.Pager, "auto")
+	}
+	if cfg.RootsMode != "append" {
+		t.Errorf("RootsMode = %q, want %q", cfg.RootsMode, "append")
 	}
 }
 
@@ -121,6 +164,223 @@ func TestLoad_EnvOverride(t *testing.T) {
 	}
 }
 
+func TestLoad_EnvEveryKey(t *testing.T) {
+	yes := true
+	no := false
+	tests := []struct {
+		get   func(*Config) any
+		want  any
+		env   string
+		value string
+	}{
+		{env: "CDX_OUTPUT_FORMAT", value: "json", get: func(c *Config) any { return c.OutputFormat }, want: "json"},
+		{env: "CDX_COLOR", value: "never", get: func(c *Config) any { return c.Color }, want: "never"},
+		{env: "CDX_COLOR", value: "false", get: func(c *Config) any { m, _ := c.ColorMode(); return m }, want: termcolor.Never},
+		{env: "CDX_COLOR", value: "1", get: func(c *Config) any { m, _ := c.ColorMode(); return m }, want: termcolor.Always},
+		{env: "CDX_CONTEXT_LINES", value: "4", get: func(c *Config) any { return c.ContextLines }, want: 4},
+		{env: "CDX_JOBS", value: "3", get: func(c *Config) any { return c.Jobs }, want: 3},
+		{env: "CDX_MAX_RESULTS", value: "25", get: func(c *Config) any { return c.MaxResults }, want: 25},
+		{env: "CDX_MAX_CALLER_NODES", value: "50", get: func(c *Config) any { return c.MaxCallerNodes }, want: 50},
+		{env: "CDX_INCLUDE_TESTS", value: "0", get: func(c *Config) any { return c.IncludeTests }, want: &no},
+		{env: "CDX_MAX_FILE_SIZE", value: "2MB", get: func(c *Config) any { return c.MaxFileSize }, want: "2MB"},
+		{env: "CDX_MAX_LINE_LENGTH", value: "4KB", get: func(c *Config) any { return c.MaxLineLength }, want: "4KB"},
+		{env: "CDX_MAX_STDIN_SIZE", value: "1M", get: func(c *Config) any { return c.MaxStdinSize }, want: "1M"},
+		{env: "CDX_TRACKED_ONLY", value: "1", get: func(c *Config) any { return c.TrackedOnly }, want: true},
+		{env: "CDX_SMART_CASE", value: "false", get: func(c *Config) any { return c.SmartCase }, want: false},
+		{env: "CDX_BACKEND_PARSER", value: "regex", get: func(c *Config) any { return c.BackendParser }, want: "regex"},
+		{env: "CDX_GO_BACKEND", value: "gopls", get: func(c *Config) any { return c.GoBackend }, want: "gopls"},
+		{env: "CDX_BACKEND", value: "native", get: func(c *Config) any { return c.Backend }, want: "native"},
+		{env: "CDX_TIMEOUT", value: "45s", get: func(c *Config) any { return c.Timeout }, want: "45s"},
+		{env: "CDX_USE_PAGER", value: "never", get: func(c *Config) any { return c.Pager }, want: "never"},
+		{env: "CDX_ROOTS", value: "/work/web,/work/proto", get: func(c *Config) any { return c.Roots }, want: []string{"/work/web", "/work/proto"}},
+		{env: "CDX_ROOTS_MODE", value: "replace", get: func(c *Config) any { return c.RootsMode }, want: "replace"},
+		{env: "CDX_WALK_CACHE_TTL", value: "1h", get: func(c *Config) any { return c.WalkCacheTTL }, want: "1h"},
+		{env: "CDX_EDITOR", value: "nvim", get: func(c *Config) any { return c.Editor }, want: "nvim"},
+		{env: "CDX_SEARCH_ROOT", value: "cwd", get: func(c *Config) any { return c.SearchRoot }, want: "cwd"},
+		{env: "CDX_USE_TAGS", value: "true", get: func(c *Config) any { return c.UseTags }, want: true},
+		{env: "CDX_DEFAULT_LANG", value: "go,py", get: func(c *Config) any { return c.DefaultLang }, want: []string{"go", "py"}},
+		{env: "CDX_EXCLUDE_DIRS", value: "out", get: func(c *Config) any { return c.ExcludeDirs }, want: []string{"out"}},
+		{env: "CDX_EXCLUDE_GLOBS", value: "*.gen.go", get: func(c *Config) any { return c.ExcludeGlobs }, want: []string{"*.gen.go"}},
+		{env: "CDX_EXTRA_EXCLUDE_DIRS", value: "tmp,build", get: func(c *Config) any { return c.ExtraExcludeDirs }, want: []string{"tmp", "build"}},
+		{env: "CDX_EXTRA_EXCLUDE_GLOBS", value: "*.pb.go", get: func(c *Config) any { return c.ExtraExcludeGlobs }, want: []string{"*.pb.go"}},
+		{env: "CDX_GENERATED_PATTERNS", value: "*.gen.go", get: func(c *Config) any { return c.GeneratedPatterns }, want: []string{"*.gen.go"}},
+		{env: "CDX_TEST_PATHS", value: "e2e/", get: func(c *Config) any { return c.TestPaths }, want: []string{"e2e/"}},
+		{env: "CDX_INCLUDE_TESTS", value: "TRUE", get: func(c *Config) any { return c.IncludeTests }, want: &yes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env+"="+tt.value, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("HOME", tmp)
+			t.Setenv("XDG_CONFIG_HOME", tmp)
+			t.Setenv("AppData", tmp)
+			t.Chdir(tmp)
+			t.Setenv(tt.env, tt.value)
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got := tt.get(cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s=%s gave %#v, want %#v", tt.env, tt.value, got, tt.want)
+			}
+			key := envKey(tt.env)
+			if got := cfg.Source(key); got != tt.env {
+				t.Errorf("Source(%q) = %q, want %q", key, got, tt.env)
+			}
+		})
+	}
+
+	keys := make(map[string]bool)
+	for _, tt := range tests {
+		keys[envKey(tt.env)] = true
+	}
+	for _, key := range Keys() {
+		if !keys[key] && !slices.Contains(fileOnlyKeys, key) {
+			t.Errorf("no test sets %s", key)
+		}
+	}
+}
+
+// envKey returns the key the environment variable env overrides.
+func envKey(env string) string {
+	for _, key := range Keys() {
+		if envName(key) == env {
+			return key
+		}
+	}
+	return ""
+}
+
+func TestLoad_EnvInvalid(t *testing.T) {
+	tests := []struct {
+		env     string
+		value   string
+		wantErr string
+	}{
+		{"CDX_CONTEXT_LINES", "four", `CDX_CONTEXT_LINES: context_lines: "four" is not a whole number`},
+		{"CDX_JOBS", "-2", "CDX_JOBS: jobs: must be 0 or more, got -2"},
+		{"CDX_TRACKED_ONLY", "yes", `CDX_TRACKED_ONLY: tracked_only: "yes" is not true or false`},
+		{"CDX_INCLUDE_TESTS", "maybe", `CDX_INCLUDE_TESTS: include_tests: "maybe" is not true or false`},
+		{"CDX_COLOR", "sometimes", `CDX_COLOR: color: invalid color mode "sometimes"`},
+		{"CDX_OUTPUT_FORMAT", "xml", `CDX_OUTPUT_FORMAT: output_format: invalid value "xml"`},
+		{"CDX_TIMEOUT", "45", `CDX_TIMEOUT: timeout: invalid duration "45" (want e.g. 45s or 2m)`},
+		{"CDX_USE_PAGER", "sometimes", `CDX_USE_PAGER: pager: invalid value "sometimes" (want one of auto, always, never)`},
+		{"CDX_TEST_PATHS", "!", `CDX_TEST_PATHS: test_paths: invalid pattern "!": matches nothing`},
+		{"CDX_LANGUAGE_EXTENSIONS", ".tpl=go", "CDX_LANGUAGE_EXTENSIONS: language_extensions can only be set in a config file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("HOME", tmp)
+			t.Setenv("XDG_CONFIG_HOME", tmp)
+			t.Setenv("AppData", tmp)
+			t.Chdir(tmp)
+			t.Setenv(tt.env, tt.value)
+
+			_, err := Load()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_ResultDefaults(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       string
+		wantMax   int
+		wantTests bool
+	}{
+		{name: "config file", wantMax: 25, wantTests: true},
+		{name: "env overrides file", env: "50", wantMax: 50, wantTests: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("HOME", tmp)
+			t.Setenv("XDG_CONFIG_HOME", tmp)
+			t.Setenv("AppData", tmp)
+			t.Chdir(tmp)
+			cfg := "max_results: 25\ninclude_tests: true\n"
+			if err := os.WriteFile(filepath.Join(tmp, ".cdx.yaml"), []byte(cfg), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if tt.env != "" {
+				t.Setenv("CDX_MAX_RESULTS", tt.env)
+			}
+
+			got, err := Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got.MaxResults != tt.wantMax {
+				t.Errorf("MaxResults = %d, want %d", got.MaxResults, tt.wantMax)
+			}
+			if got.IncludeTests == nil || *got.IncludeTests != tt.wantTests {
+				t.Errorf("IncludeTests = %v, want %v", got.IncludeTests, tt.wantTests)
+			}
+		})
+	}
+}
+
+func TestLoad_BadExcludeGlob(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Chdir(tmp)
+	if err := os.WriteFile(".cdx.yaml", []byte("exclude_globs: [\"[z-a].go\"]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), `exclude_globs: invalid pattern "[z-a].go"`) {
+		t.Errorf("Load() error = %v, want one naming the bad pattern", err)
+	}
+}
+
+func TestExcludeRules(t *testing.T) {
+	cfg := DefaultConfig()
+	// Joined with the platform's separator, as a Windows user would write it
+	cfg.ExcludeDirs = []string{"generated", "/bazel-out/", " coverage ", filepath.Join("docs", "build")}
+	cfg.ExcludeGlobs = []string{"*.pb.go", "!keep.pb.go"}
+
+	rules, err := cfg.ExcludeRules()
+	if err != nil {
+		t.Fatalf("ExcludeRules() error = %v", err)
+	}
+	m := ignore.New(rules...)
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"generated", true, true},
+		{"pkg/generated", true, true}, // unanchored: any depth
+		{"generated", false, false},   // directories only
+		{"bazel-out", true, true},
+		{"pkg/bazel-out", true, false}, // anchored to the root
+		{"web/coverage", true, true},
+		{"api/user.pb.go", false, true},
+		{"api/keep.pb.go", false, false},
+		{"docs/build", true, true},
+		{"web/docs/build", true, false}, // a separator anchors it on every platform
+	}
+	for _, tt := range tests {
+		if got, _ := m.Match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Match(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+
+	cfg.ExcludeDirs = []string{"/"}
+	if _, err := cfg.ExcludeRules(); err == nil {
+		t.Error("ExcludeRules() with \"/\" = nil error, want invalid pattern")
+	}
+}
+
 func TestConfigDir(t *testing.T) {
 	dir, err := ConfigDir()
 	if err != nil {
@@ -137,3 +397,543 @@ func TestConfigDir(t *testing.T) {
 		t.Errorf("ConfigDir() = %q, want absolute path", dir)
 	}
 }
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "512", want: 512},
+		{in: "512K", want: 512 << 10},
+		{in: "512kb", want: 512 << 10},
+		{in: "10M", want: 10 << 20},
+		{in: " 2m ", want: 2 << 20},
+		{in: "1G", want: 1 << 30},
+		{in: "", wantErr: true},
+		{in: "M", wantErr: true},
+		{in: "-1K", wantErr: true},
+		{in: "ten", wantErr: true},
+		{in: "10T", wantErr: true},
+		{in: "9223372036854775807", want: 1<<63 - 1},
+		{in: "8589934592G", wantErr: true},
+		{in: "9223372036854775807K", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseSize(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_DefaultLang(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+		want    []patterns.Language
+	}{
+		{name: "single value", yaml: "default_lang: ts\n", want: []patterns.Language{patterns.TypeScript}},
+		{name: "list", yaml: "default_lang: [ts, js]\n", want: []patterns.Language{patterns.TypeScript, patterns.JavaScript}},
+		{name: "unset", yaml: "context_lines: 2\n", want: []patterns.Language{}},
+		{name: "unknown", yaml: "default_lang: typescript\n", wantErr: `default_lang: unknown language "typescript" (want one of c, cpp, csharp, elixir, go, js, kotlin, lua, php, py, ruby, rust, scala, swift, ts, zig)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("HOME", tmp)
+			t.Chdir(tmp)
+			if err := os.WriteFile(".cdx.yaml", []byte(tt.yaml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			got, err := cfg.DefaultLanguages()
+			if err != nil {
+				t.Fatalf("DefaultLanguages() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("DefaultLanguages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name:    "misspelled enum value",
+			config:  "output_format: jsn\n",
+			wantErr: `output_format: invalid value "jsn" (want one of auto, human, json, plain; did you mean "json"?)`,
+		},
+		{
+			name:    "unrelated enum value",
+			config:  "search_root: everywhere\n",
+			wantErr: `search_root: invalid value "everywhere" (want one of repo, cwd)`,
+		},
+		{name: "wrong type", config: "context_lines: two\n", wantErr: `context_lines: "two" is not a whole number`},
+		{name: "negative count", config: "context_lines: -1\n", wantErr: "context_lines: must be 0 or more, got -1"},
+		{name: "bad size", config: "max_file_size: big\n", wantErr: `max_file_size: invalid size "big"`},
+		{name: "bad stdin size", config: "max_stdin_size: lots\n", wantErr: `max_stdin_size: invalid size "lots"`},
+		{name: "bad editor placeholder", config: "editor: nvim +{ln} {file}\n", wantErr: "editor: unknown placeholder {ln}"},
+		{name: "bad color", config: "color: rainbow\n", wantErr: `color: invalid color mode "rainbow"`},
+		{name: "bad timeout", config: "timeout: 1 minute\n", wantErr: `timeout: invalid duration "1 minute"`},
+		{name: "negative timeout", config: "timeout: -5s\n", wantErr: "timeout: must be 0 or more, got -5s"},
+		{name: "bad walk cache ttl", config: "walk_cache_ttl: forever\n", wantErr: `walk_cache_ttl: invalid duration "forever"`},
+		{name: "relative root", config: "roots: [../web]\n", wantErr: `roots: "../web" is not an absolute path or under ~/`},
+		{name: "bad roots mode", config: "roots_mode: prepend\n", wantErr: `roots_mode: invalid value "prepend" (want one of append, replace`},
+		{name: "misspelled pager", config: "pager: alway\n", wantErr: `pager: invalid value "alway" (want one of auto, always, never; did you mean "always"?)`},
+		{
+			name:    "misspelled backend",
+			config:  "backend: ripgrep\n",
+			wantErr: `backend: invalid value "ripgrep" (want one of auto, grep, rg, native)`,
+		},
+		{name: "malformed yaml", config: "exclude_dirs: [\n", wantErr: "While parsing config"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("HOME", tmp)
+			t.Setenv("XDG_CONFIG_HOME", tmp)
+			t.Setenv("AppData", tmp)
+			t.Chdir(tmp)
+			file := filepath.Join(tmp, ".cdx.yaml")
+			if err := os.WriteFile(file, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := Load()
+			if err == nil {
+				t.Fatal("Load() error = nil, want an error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %q, want it to contain %q", err, tt.wantErr)
+			}
+			if !strings.HasPrefix(err.Error(), file+": ") {
+				t.Errorf("Load() error = %q, want it to name %s", err, file)
+			}
+		})
+	}
+}
+
+func TestLoad_UnknownKeys(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	t.Chdir(tmp)
+	file := filepath.Join(tmp, ".cdx.yaml")
+	config := "output_fromat: json\ncolour: true\nlanguage_extensions:\n  .gohtml: go\n"
+	if err := os.WriteFile(file, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := []Warning{
+		{File: file, Message: `unknown key "colour" (did you mean "color"?)`},
+		{File: file, Message: `unknown key "output_fromat" (did you mean "output_format"?)`},
+	}
+	if !reflect.DeepEqual(cfg.Warnings, want) {
+		t.Errorf("Warnings = %v, want %v", cfg.Warnings, want)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	keys := Keys()
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"output_fromat", "output_format"},
+		{"context_line", "context_lines"},
+		{"maxresults", "max_results"},
+		{"jbos", "jobs"},
+		{"telemetry", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := suggest(tt.in, keys); got != tt.want {
+				t.Errorf("suggest(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_Layers(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmp, "xdg"))
+	t.Setenv("AppData", filepath.Join(tmp, "xdg"))
+	global := filepath.Join(tmp, "xdg", "cdx", ".cdx.yaml")
+	home := filepath.Join(tmp, "home", ".cdx.yaml")
+	project := filepath.Join(tmp, "project", ".cdx.yaml")
+	files := map[string]string{
+		global: "output_format: json\ncontext_lines: 4\nexclude_dirs: [vendor]\n" +
+			"extra_exclude_globs: [\"*.gen.go\"]\nlanguage_extensions:\n  .gohtml: go\n",
+		home: "smart_case: true\n",
+		project: "default_lang: ts\nexclude_dirs: [dist]\n" +
+			"extra_exclude_globs: [\"*.pb.go\"]\nlanguage_extensions:\n  .tpl: go\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(filepath.Dir(project))
+	t.Setenv("CDX_CONTEXT_LINES", "7")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if want := []string{global, home, project}; !reflect.DeepEqual(cfg.Files, want) {
+		t.Errorf("Files = %v, want %v", cfg.Files, want)
+	}
+	if cfg.OutputFormat != "json" || !cfg.SmartCase || !slices.Equal(cfg.DefaultLang, []string{"ts"}) {
+		t.Errorf("settings from each file weren't all kept: output_format = %q, smart_case = %v, default_lang = %v",
+			cfg.OutputFormat, cfg.SmartCase, cfg.DefaultLang)
+	}
+	if cfg.ContextLines != 7 {
+		t.Errorf("ContextLines = %d, want 7 (env overrides files)", cfg.ContextLines)
+	}
+	if !slices.Equal(cfg.ExcludeDirs, []string{"dist"}) {
+		t.Errorf("ExcludeDirs = %v, want [dist] (lists replace)", cfg.ExcludeDirs)
+	}
+	if want := []string{"*.gen.go", "*.pb.go"}; !slices.Equal(cfg.ExtraExcludeGlobs, want) {
+		t.Errorf("ExtraExcludeGlobs = %v, want %v (extra_* lists accumulate)", cfg.ExtraExcludeGlobs, want)
+	}
+	if want := map[string]string{".gohtml": "go", ".tpl": "go"}; !reflect.DeepEqual(cfg.LanguageExtensions, want) {
+		t.Errorf("LanguageExtensions = %v, want %v (maps merge)", cfg.LanguageExtensions, want)
+	}
+
+	sources := map[string]string{
+		"output_format":       global,
+		"smart_case":          home,
+		"default_lang":        project,
+		"context_lines":       "CDX_CONTEXT_LINES",
+		"extra_exclude_globs": global + ", " + project,
+		"language_extensions": global + ", " + project,
+		"jobs":                SourceDefault,
+	}
+	for key, want := range sources {
+		if got := cfg.Source(key); got != want {
+			t.Errorf("Source(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestLoad_ProjectFromSubdirectory(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmp, "xdg"))
+	t.Setenv("AppData", filepath.Join(tmp, "xdg"))
+	repo := filepath.Join(tmp, "repo")
+	sub := filepath.Join(repo, "internal", "api")
+	if err := os.MkdirAll(sub, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	// A config above the repository belongs to another project
+	for dir, content := range map[string]string{tmp: "smart_case: true\n", repo: "default_lang: ts\n"} {
+		if err := os.WriteFile(filepath.Join(dir, ".cdx.yaml"), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(sub)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if want := []string{filepath.Join(repo, ".cdx.yaml")}; !reflect.DeepEqual(cfg.Files, want) {
+		t.Errorf("Files = %v, want %v", cfg.Files, want)
+	}
+	if !slices.Equal(cfg.DefaultLang, []string{"ts"}) || cfg.SmartCase {
+		t.Errorf("default_lang = %v, smart_case = %v, want [ts] from the repository root's file alone", cfg.DefaultLang, cfg.SmartCase)
+	}
+}
+
+func TestLoad_LayerErrorNamesFile(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmp, "xdg"))
+	t.Setenv("AppData", filepath.Join(tmp, "xdg"))
+	global := filepath.Join(tmp, ".cdx.yaml")
+	project := filepath.Join(tmp, "project", ".cdx.yaml")
+	if err := os.WriteFile(global, []byte("output_format: json\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(project), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(project, []byte("jobs: -1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(filepath.Dir(project))
+
+	_, err := Load()
+	if err == nil || !strings.HasPrefix(err.Error(), project+": jobs:") {
+		t.Errorf("Load() error = %v, want it to name %s", err, project)
+	}
+}
+
+func TestLoadFrom_Explicit(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	t.Chdir(tmp)
+	discovered := filepath.Join(tmp, ".cdx.yaml")
+	explicit := filepath.Join(tmp, "ci.yaml")
+	fromEnv := filepath.Join(tmp, "env.yaml")
+	for file, content := range map[string]string{
+		discovered: "output_format: plain\ncontext_lines: 9\n",
+		explicit:   "output_format: json\n",
+		fromEnv:    "output_format: human\n",
+	} {
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		env        string
+		wantFormat string
+		wantErr    string
+		wantLines  int
+	}{
+		{name: "discovered", wantFormat: "plain", wantLines: 9},
+		// An explicit file is read alone, not layered over the others
+		{name: "path", path: "ci.yaml", wantFormat: "json", wantLines: 2},
+		{name: "env", env: fromEnv, wantFormat: "human", wantLines: 2},
+		{name: "path beats env", path: explicit, env: fromEnv, wantFormat: "json", wantLines: 2},
+		{name: "missing file", path: "nope.yaml", wantErr: "config file: stat " + filepath.Join(tmp, "nope.yaml")},
+		{name: "directory", path: tmp, wantErr: "is a directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvConfig, tt.env)
+
+			cfg, err := LoadFrom(tt.path, "")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadFrom() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadFrom() error = %v", err)
+			}
+			if cfg.OutputFormat != tt.wantFormat {
+				t.Errorf("OutputFormat = %q, want %q", cfg.OutputFormat, tt.wantFormat)
+			}
+			if cfg.ContextLines != tt.wantLines {
+				t.Errorf("ContextLines = %d, want %d", cfg.ContextLines, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestColorMode(t *testing.T) {
+	tests := []struct {
+		color   string
+		want    termcolor.Mode
+		wantErr bool
+	}{
+		{"auto", termcolor.Auto, false},
+		{"", termcolor.Auto, false},
+		{"always", termcolor.Always, false},
+		{"never", termcolor.Never, false},
+		// YAML booleans decode as "1" and "0"; the environment passes words
+		{"1", termcolor.Always, false},
+		{"0", termcolor.Never, false},
+		{"true", termcolor.Always, false},
+		{"FALSE", termcolor.Never, false},
+		{"rainbow", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.color, func(t *testing.T) {
+			cfg := Config{Color: tt.color}
+			got, err := cfg.ColorMode()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ColorMode() = %q, %v, want %q (error %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_Profiles(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmp, "xdg"))
+	t.Setenv("AppData", filepath.Join(tmp, "xdg"))
+	global := filepath.Join(tmp, "xdg", "cdx", ".cdx.yaml")
+	project := filepath.Join(tmp, "project", ".cdx.yaml")
+	files := map[string]string{
+		global: "profiles:\n  agent:\n    output_format: json\n    color: never\n    max_results: 50\n" +
+			"    extra_exclude_dirs: [fixtures]\n    max_reslts: 5\n",
+		project: "output_format: human\ncontext_lines: 3\nextra_exclude_dirs: [dist]\n" +
+			"profiles:\n  human:\n    smart_case: true\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(filepath.Dir(project))
+
+	tests := []struct {
+		env        map[string]string
+		name       string
+		profile    string
+		wantErr    string
+		wantFormat string
+		wantColor  string
+		wantMax    int
+		wantSmart  bool
+	}{
+		{name: "no profile", wantFormat: "human", wantColor: "auto"},
+		{name: "profile overrides files", profile: "agent", wantFormat: "json", wantColor: "never", wantMax: 50},
+		{name: "profiles merge across files", profile: "human", wantFormat: "human", wantColor: "auto", wantSmart: true},
+		{name: "env selects a profile", env: map[string]string{EnvProfile: "agent"}, wantFormat: "json", wantColor: "never", wantMax: 50},
+		{
+			name:       "flag beats env",
+			profile:    "human",
+			env:        map[string]string{EnvProfile: "agent"},
+			wantFormat: "human",
+			wantColor:  "auto",
+			wantSmart:  true,
+		},
+		{
+			name:       "env overrides profile",
+			profile:    "agent",
+			env:        map[string]string{"CDX_MAX_RESULTS": "7"},
+			wantFormat: "json",
+			wantColor:  "never",
+			wantMax:    7,
+		},
+		{name: "unknown profile", profile: "robot", wantErr: `unknown profile "robot" (defined: agent, human)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvProfile, "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := LoadFrom("", tt.profile)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("LoadFrom() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadFrom() error = %v", err)
+			}
+			if cfg.OutputFormat != tt.wantFormat || cfg.Color != tt.wantColor || cfg.MaxResults != tt.wantMax || cfg.SmartCase != tt.wantSmart {
+				t.Errorf("output_format, color, max_results, smart_case = %q, %q, %d, %v, want %q, %q, %d, %v",
+					cfg.OutputFormat, cfg.Color, cfg.MaxResults, cfg.SmartCase,
+					tt.wantFormat, tt.wantColor, tt.wantMax, tt.wantSmart)
+			}
+			if cfg.ContextLines != 3 {
+				t.Errorf("ContextLines = %d, want 3 from the project file", cfg.ContextLines)
+			}
+		})
+	}
+
+	t.Run("profile details", func(t *testing.T) {
+		t.Setenv(EnvProfile, "")
+		cfg, err := LoadFrom("", "agent")
+		if err != nil {
+			t.Fatalf("LoadFrom() error = %v", err)
+		}
+		if cfg.Profile != "agent" || cfg.Source("output_format") != "profile agent" {
+			t.Errorf("Profile = %q, Source(output_format) = %q, want agent from the profile", cfg.Profile, cfg.Source("output_format"))
+		}
+		if want := []string{"dist", "fixtures"}; !slices.Equal(cfg.ExtraExcludeDirs, want) {
+			t.Errorf("ExtraExcludeDirs = %v, want %v", cfg.ExtraExcludeDirs, want)
+		}
+		want := []Warning{{File: global, Message: `unknown key "max_reslts" in profile "agent" (did you mean "max_results"?)`}}
+		if !reflect.DeepEqual(cfg.Warnings, want) {
+			t.Errorf("Warnings = %v, want %v", cfg.Warnings, want)
+		}
+	})
+}
+
+func TestLoad_NoProfiles(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("AppData", tmp)
+	t.Chdir(tmp)
+
+	_, err := LoadFrom("", "agent")
+	if want := `unknown profile "agent": no profiles are defined`; err == nil || err.Error() != want {
+		t.Errorf("LoadFrom() error = %v, want %q", err, want)
+	}
+}
+
+func TestSearchRoots(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	abs := filepath.Join(home, "work", "web")
+
+	cfg := DefaultConfig()
+	cfg.Roots = []string{"~/work/api", abs + string(filepath.Separator), "~"}
+	got, err := cfg.SearchRoots()
+	if err != nil {
+		t.Fatalf("SearchRoots() error = %v", err)
+	}
+	want := []string{filepath.Join(home, "work", "api"), abs, home}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SearchRoots() = %q, want %q", got, want)
+	}
+
+	cfg.Roots = []string{"~user/work"}
+	if _, err := cfg.SearchRoots(); err == nil {
+		t.Error("SearchRoots() error = nil for ~user, want an error")
+	}
+}
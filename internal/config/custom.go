@@ -0,0 +1,128 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+// CustomPattern is a user-defined definition pattern from the
+// custom_patterns section, for in-house DSLs and codegen conventions such as
+// DEFINE_METRIC(name, ...) macros.
+type CustomPattern struct {
+	// Regex matches a definition line; its single capture group is the name
+	Regex string `mapstructure:"regex" json:"regex"`
+	// Kind is reported for matches, e.g. "metric" or "task"
+	Kind string `mapstructure:"kind" json:"kind"`
+	// Lang is the language the pattern applies to; it may be omitted when
+	// every extension belongs to one supported language
+	Lang string `mapstructure:"lang" json:"lang,omitempty"`
+	// Extensions limits the pattern to these file extensions, e.g. [".h"]
+	Extensions []string `mapstructure:"extensions" json:"extensions,omitempty"`
+}
+
+// Extensions validates language_extensions and returns it keyed by
+// normalized extension (lowercase, with a leading dot), ready for
+// patterns.SetExtensions. An empty language removes an extension.
+func (c *Config) Extensions() (map[string]patterns.Language, error) {
+	if len(c.LanguageExtensions) == 0 {
+		return nil, nil
+	}
+	exts := make(map[string]patterns.Language, len(c.LanguageExtensions))
+	for ext, lang := range c.LanguageExtensions {
+		if lang != "" && patterns.ForLanguage(patterns.Language(lang)) == nil {
+			return nil, fmt.Errorf("language_extensions[%q]: unknown language %q", ext, lang)
+		}
+		exts[normalizeExt(ext)] = patterns.Language(lang)
+	}
+	return exts, nil
+}
+
+// normalizeExt lowercases ext and gives it a leading dot.
+func normalizeExt(ext string) string {
+	return "." + strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+}
+
+// CustomDefinitions compiles custom_patterns into definition patterns keyed
+// by language, ready for patterns.SetCustom. Errors name the offending entry
+// by its index, e.g. custom_patterns[2].regex.
+func (c *Config) CustomDefinitions() (map[patterns.Language][]patterns.Pattern, error) {
+	mapped, err := c.Extensions()
+	if err != nil {
+		return nil, err
+	}
+
+	var defs map[patterns.Language][]patterns.Pattern
+	for i, cp := range c.CustomPatterns {
+		where := fmt.Sprintf("custom_patterns[%d]", i)
+
+		if cp.Regex == "" {
+			return nil, fmt.Errorf("%s.regex: missing", where)
+		}
+		re, err := regexp.Compile(cp.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("%s.regex: %w", where, err)
+		}
+		if n := re.NumSubexp(); n != 1 {
+			return nil, fmt.Errorf("%s.regex: want exactly one capture group around the name, found %d", where, n)
+		}
+		if cp.Kind == "" {
+			return nil, fmt.Errorf("%s.kind: missing", where)
+		}
+
+		exts := make([]string, len(cp.Extensions))
+		for j, ext := range cp.Extensions {
+			exts[j] = normalizeExt(ext)
+		}
+		langs, err := customLanguages(cp.Lang, exts, mapped)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+
+		p := patterns.Pattern{Regex: re, Kind: cp.Kind}
+		if len(exts) > 0 {
+			p.Extensions = exts
+		}
+		if defs == nil {
+			defs = make(map[patterns.Language][]patterns.Pattern)
+		}
+		for _, lang := range langs {
+			defs[lang] = append(defs[lang], p)
+		}
+	}
+	return defs, nil
+}
+
+// customLanguages resolves the languages a custom pattern applies to: lang
+// when given, otherwise the languages its extensions belong to, taking
+// language_extensions (mapped) into account.
+func customLanguages(lang string, exts []string, mapped map[string]patterns.Language) ([]patterns.Language, error) {
+	if lang != "" {
+		if patterns.ForLanguage(patterns.Language(lang)) == nil {
+			return nil, fmt.Errorf("lang: unknown language %q", lang)
+		}
+		return []patterns.Language{patterns.Language(lang)}, nil
+	}
+	if len(exts) == 0 {
+		return nil, errors.New("needs lang or extensions")
+	}
+
+	var langs []patterns.Language
+	for _, ext := range exts {
+		l, ok := mapped[ext]
+		if !ok {
+			l = patterns.DetectLanguage(ext)
+		}
+		if l == patterns.Unknown {
+			return nil, fmt.Errorf("extensions: %s isn't a supported language's extension; set lang", ext)
+		}
+		if !slices.Contains(langs, l) {
+			langs = append(langs, l)
+		}
+	}
+	return langs, nil
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+func TestCustomDefinitions(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CustomPatterns = []CustomPattern{
+		{Regex: `register_task\("(\w+)"`, Kind: "task", Lang: "py"},
+		{Regex: `^DEFINE_METRIC\((\w+)`, Kind: "metric", Extensions: []string{"ts", ".js"}},
+	}
+
+	defs, err := cfg.CustomDefinitions()
+	if err != nil {
+		t.Fatalf("CustomDefinitions() error = %v", err)
+	}
+	if got := len(defs[patterns.Python]); got != 1 {
+		t.Errorf("py patterns = %d, want 1", got)
+	}
+	for _, lang := range []patterns.Language{patterns.TypeScript, patterns.JavaScript} {
+		ps := defs[lang]
+		if len(ps) != 1 || ps[0].Kind != "metric" || strings.Join(ps[0].Extensions, ",") != ".ts,.js" {
+			t.Errorf("%s patterns = %+v, want the metric pattern limited to .ts and .js", lang, ps)
+		}
+	}
+}
+
+func TestCustomDefinitions_Invalid(t *testing.T) {
+	valid := CustomPattern{Regex: `task\("(\w+)"`, Kind: "task", Lang: "py"}
+	tests := []struct {
+		name    string
+		wantErr string
+		bad     CustomPattern
+	}{
+		{name: "compile error", bad: CustomPattern{Regex: `task\((\w+`, Kind: "task", Lang: "py"}, wantErr: "custom_patterns[1].regex: error parsing regexp"},
+		{name: "no capture group", bad: CustomPattern{Regex: `task\(\w+`, Kind: "task", Lang: "py"}, wantErr: "custom_patterns[1].regex: want exactly one capture group around the name, found 0"},
+		{name: "two capture groups", bad: CustomPattern{Regex: `(\w+)\((\w+)`, Kind: "task", Lang: "py"}, wantErr: "found 2"},
+		{name: "missing regex", bad: CustomPattern{Kind: "task", Lang: "py"}, wantErr: "custom_patterns[1].regex: missing"},
+		{name: "missing kind", bad: CustomPattern{Regex: `(\w+)`, Lang: "py"}, wantErr: "custom_patterns[1].kind: missing"},
+		{name: "unknown lang", bad: CustomPattern{Regex: `(\w+)`, Kind: "task", Lang: "cobol"}, wantErr: `custom_patterns[1]: lang: unknown language "cobol"`},
+		{name: "no lang or extensions", bad: CustomPattern{Regex: `(\w+)`, Kind: "task"}, wantErr: "custom_patterns[1]: needs lang or extensions"},
+		{name: "unknown extension", bad: CustomPattern{Regex: `(\w+)`, Kind: "task", Extensions: []string{".dsl"}}, wantErr: ".dsl isn't a supported language's extension"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.CustomPatterns = []CustomPattern{valid, tt.bad}
+			_, err := cfg.CustomDefinitions()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CustomDefinitions() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_CustomPatterns(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Chdir(tmp)
+	yaml := `custom_patterns:
+  - regex: 'register_task\("(\w+)"'
+    kind: task
+    lang: py
+  - regex: 'DEFINE_METRIC\(\w+'
+    kind: metric
+    lang: go
+`
+	if err := os.WriteFile(".cdx.yaml", []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), ".cdx.yaml: custom_patterns[1].regex: want exactly one capture group") {
+		t.Errorf("Load() error = %v, want the config file and entry named", err)
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.LanguageExtensions = map[string]string{".gohtml": "go", "bzl": "py", ".TSX": ""}
+
+	got, err := cfg.Extensions()
+	if err != nil {
+		t.Fatalf("Extensions() error = %v", err)
+	}
+	want := map[string]patterns.Language{".gohtml": patterns.Go, ".bzl": patterns.Python, ".tsx": patterns.Unknown}
+	if !maps.Equal(got, want) {
+		t.Errorf("Extensions() = %v, want %v", got, want)
+	}
+
+	// Custom patterns infer their language through the mapping
+	cfg.CustomPatterns = []CustomPattern{{Regex: `^{{define "(\w+)"`, Kind: "template", Extensions: []string{".gohtml"}}}
+	defs, err := cfg.CustomDefinitions()
+	if err != nil {
+		t.Fatalf("CustomDefinitions() error = %v", err)
+	}
+	if len(defs[patterns.Go]) != 1 {
+		t.Errorf("CustomDefinitions() = %v, want the template pattern under go", defs)
+	}
+
+	cfg.LanguageExtensions = map[string]string{".inc": "cobol"}
+	if _, err := cfg.Extensions(); err == nil || !strings.Contains(err.Error(), `language_extensions[".inc"]: unknown language "cobol"`) {
+		t.Errorf("Extensions() error = %v, want unknown language", err)
+	}
+}
+
+func TestLoad_LanguageExtensions(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Chdir(tmp)
+	yaml := "language_extensions:\n  .gohtml: go\n  \".bzl\": py\n"
+	if err := os.WriteFile(".cdx.yaml", []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := map[string]string{".gohtml": "go", ".bzl": "py"}
+	if !maps.Equal(cfg.LanguageExtensions, want) {
+		t.Errorf("LanguageExtensions = %v, want %v (dotted keys kept whole)", cfg.LanguageExtensions, want)
+	}
+}
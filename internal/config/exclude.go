@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bashhack/cdx/internal/generated"
+	"github.com/bashhack/cdx/internal/ignore"
+	"github.com/bashhack/cdx/internal/testfiles"
+)
+
+// Sources that configured exclusions are attributed to in walk statistics.
+const (
+	SourceExcludeDirs       = "exclude_dirs"
+	SourceExcludeGlobs      = "exclude_globs"
+	SourceExtraExcludeDirs  = "extra_exclude_dirs"
+	SourceExtraExcludeGlobs = "extra_exclude_globs"
+)
+
+// Exclusion is an exclude setting's entry as a gitignore-style pattern, with
+// the setting it came from.
+type Exclusion struct {
+	Pattern string
+	Source  string // One of the Source constants
+}
+
+// Exclusions returns exclude_dirs and exclude_globs, followed by their
+// extra_* counterparts, as gitignore-style patterns relative to the
+// repository root. Directory entries use gitignore semantics: "generated"
+// skips a directory of that name anywhere, while "/generated" (or any entry
+// containing a slash) is anchored to the root. On Windows, entries may
+// separate directories with backslashes, which are read as slashes rather
+// than the escapes they'd be elsewhere.
+func (c *Config) Exclusions() []Exclusion {
+	var exclusions []Exclusion
+	for _, list := range []struct {
+		source  string
+		entries []string
+		dirs    bool
+	}{
+		{SourceExcludeDirs, c.ExcludeDirs, true},
+		{SourceExcludeGlobs, c.ExcludeGlobs, false},
+		{SourceExtraExcludeDirs, c.ExtraExcludeDirs, true},
+		{SourceExtraExcludeGlobs, c.ExtraExcludeGlobs, false},
+	} {
+		for _, entry := range list.entries {
+			pattern := filepath.ToSlash(strings.TrimSpace(entry))
+			if list.dirs {
+				pattern = strings.TrimRight(pattern, "/") + "/"
+			}
+			exclusions = append(exclusions, Exclusion{Pattern: pattern, Source: list.source})
+		}
+	}
+	return exclusions
+}
+
+// ExcludeRules compiles Exclusions into ignore rules relative to the
+// repository root.
+func (c *Config) ExcludeRules() ([]ignore.Rule, error) {
+	var rules []ignore.Rule
+	for _, e := range c.Exclusions() {
+		rule, err := ignore.CompileRule(e.Pattern, "", e.Source)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Source, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Generated returns the detector for the generated files def, refs, and
+// callers leave out, recognizing names by generated_patterns.
+func (c *Config) Generated() (*generated.Detector, error) {
+	return generated.New(c.GeneratedPatterns, "generated_patterns")
+}
+
+// Tests returns the classifier for the test files refs and callers leave out
+// by default, applying test_paths over each language's conventions.
+func (c *Config) Tests() (*testfiles.Classifier, error) {
+	return testfiles.New(c.TestPaths, "test_paths")
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+// LanguageFile is a plugin language, declared in a YAML file in a languages
+// directory, for a language cdx doesn't build in, such as VHDL or an
+// in-house DSL.
+type LanguageFile struct {
+	// Name is the language's name, as --lang takes it
+	Name string `mapstructure:"name"`
+	// TestFile matches the paths or base names of its test files
+	TestFile string `mapstructure:"test_file"`
+	// Extensions and Filenames are the files in the language: those with
+	// these extensions, e.g. [".vhd"], and those with these names, e.g.
+	// [Jenkinsfile]
+	Extensions []string `mapstructure:"extensions"`
+	Filenames  []string `mapstructure:"filenames"`
+	// Definitions are the patterns that find definitions, tried in order
+	Definitions []LanguageDefinition `mapstructure:"definitions"`
+}
+
+// LanguageDefinition is a plugin language's definition pattern.
+type LanguageDefinition struct {
+	// Regex matches a definition line
+	Regex string `mapstructure:"regex"`
+	// Kind is one of patterns.DefinitionKinds
+	Kind string `mapstructure:"kind"`
+	// Group is the index of the capture group around the name; 0 means 1
+	Group int `mapstructure:"group"`
+}
+
+// languageKeys are the keys a plugin language file can have.
+var languageKeys = []string{"name", "extensions", "filenames", "test_file", "definitions"}
+
+// languageName matches the names a plugin language can have.
+var languageName = regexp.MustCompile(`^[a-z0-9_+#-]+$`)
+
+// LanguageDirs returns the directories plugin languages are loaded from,
+// lowest precedence first: languages in the user config directory, and
+// .cdx/languages in the current directory.
+func LanguageDirs() []string {
+	var dirs []string
+	if configDir, err := ConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(configDir, "languages"))
+	}
+	return append(dirs, filepath.Join(".cdx", "languages"))
+}
+
+// LoadLanguages reads the plugin languages in the *.yaml files of dirs,
+// ready for patterns.SetPlugins; a directory that doesn't exist has none.
+// A language in a later directory replaces one of the same name in an
+// earlier one, but two files in one directory can't declare the same
+// language. Errors name the file and the offending field, e.g.
+// definitions[2].regex.
+func LoadLanguages(dirs ...string) ([]*patterns.LanguagePatterns, error) {
+	var langs []*patterns.LanguagePatterns
+	for _, dir := range dirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+		if err != nil {
+			return nil, err
+		}
+		declared := make(map[patterns.Language]string)
+		for _, file := range files {
+			if abs, err := filepath.Abs(file); err == nil {
+				file = abs
+			}
+			lp, err := ReadLanguage(file)
+			if err != nil {
+				return nil, err
+			}
+			if other, ok := declared[lp.Language]; ok {
+				return nil, fmt.Errorf("%s: language %q is also declared in %s", file, lp.Language, other)
+			}
+			declared[lp.Language] = file
+			langs = append(langs, lp)
+		}
+	}
+	return langs, nil
+}
+
+// ReadLanguage reads and validates the plugin language declared in the YAML
+// file at path.
+func ReadLanguage(path string) (*patterns.LanguagePatterns, error) {
+	v := viper.NewWithOptions(viper.KeyDelimiter("::"))
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, key := range v.AllKeys() {
+		key, _, _ = strings.Cut(key, "::")
+		if slices.Contains(languageKeys, key) {
+			continue
+		}
+		msg := fmt.Sprintf("%s: unknown key %q", path, key)
+		if s := suggest(key, languageKeys); s != "" {
+			msg += fmt.Sprintf(" (did you mean %q?)", s)
+		}
+		return nil, errors.New(msg)
+	}
+	var lf LanguageFile
+	if err := v.Unmarshal(&lf); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	lp, err := lf.compile()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	lp.Source = path
+	return lp, nil
+}
+
+// compile validates lf and builds its patterns.
+func (lf *LanguageFile) compile() (*patterns.LanguagePatterns, error) {
+	switch {
+	case lf.Name == "":
+		return nil, errors.New("name: missing")
+	case !languageName.MatchString(lf.Name):
+		return nil, fmt.Errorf("name: %q isn't a valid language name (use lowercase letters, digits, and _+#-)", lf.Name)
+	case len(lf.Extensions) == 0 && len(lf.Filenames) == 0:
+		return nil, errors.New("needs extensions or filenames")
+	case len(lf.Definitions) == 0:
+		return nil, errors.New("definitions: missing")
+	}
+
+	lp := &patterns.LanguagePatterns{Language: patterns.Language(lf.Name), Filenames: lf.Filenames}
+	for _, ext := range lf.Extensions {
+		lp.Extensions = append(lp.Extensions, normalizeExt(ext))
+	}
+	if lf.TestFile != "" {
+		re, err := regexp.Compile(lf.TestFile)
+		if err != nil {
+			return nil, fmt.Errorf("test_file: %w", err)
+		}
+		lp.TestFile = re
+	}
+	for i, def := range lf.Definitions {
+		where := fmt.Sprintf("definitions[%d]", i)
+		if def.Kind == "" {
+			return nil, fmt.Errorf("%s.kind: missing", where)
+		}
+		if !slices.Contains(patterns.DefinitionKinds, def.Kind) {
+			return nil, fmt.Errorf("%s.kind: unknown kind %q (want %s)", where, def.Kind, strings.Join(patterns.DefinitionKinds, ", "))
+		}
+		if def.Regex == "" {
+			return nil, fmt.Errorf("%s.regex: missing", where)
+		}
+		re, err := onlyCapture(def.Regex, cmp.Or(def.Group, 1))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+		lp.Definition = append(lp.Definition, patterns.Pattern{Regex: re, Kind: def.Kind})
+	}
+	return lp, nil
+}
+
+// onlyCapture compiles expr with capture group group as its only one, the
+// other groups made non-capturing, so the name is always group 1.
+func onlyCapture(expr string, group int) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("regex: %w", err)
+	}
+	n := re.NumSubexp()
+	if group < 1 || group > n {
+		return nil, fmt.Errorf("group: the regex has no capture group %d around the name (it has %d)", group, n)
+	}
+	if n == 1 {
+		return re, nil
+	}
+	tree, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("regex: %w", err)
+	}
+	uncapture(tree, group)
+	return regexp.Compile(tree.String())
+}
+
+// uncapture replaces every capture group in re but the one numbered keep
+// with its contents.
+func uncapture(re *syntax.Regexp, keep int) {
+	for _, sub := range re.Sub {
+		uncapture(sub, keep)
+	}
+	if re.Op == syntax.OpCapture && re.Cap != keep {
+		*re = *re.Sub[0]
+	}
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeLanguage(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLanguages(t *testing.T) {
+	user, project := filepath.Join(t.TempDir(), "user"), filepath.Join(t.TempDir(), "project")
+	writeLanguage(t, user, "vhdl.yaml", `
+name: vhdl
+extensions: [vhd, .VHDL]
+test_file: '_tb\.vhdl?$'
+definitions:
+  - kind: type
+    regex: '(?i)^\s*entity\s+(\w+)'
+`)
+	writeLanguage(t, user, "notes.txt", "not a language")
+	override := writeLanguage(t, project, "vhdl.yaml", `
+name: vhdl
+extensions: [.vhd]
+filenames: [Vhdlfile]
+definitions:
+  - kind: function
+    regex: '^\s*(pure|impure)?\s*function\s+(\w+)'
+    group: 2
+`)
+
+	langs, err := LoadLanguages(user, project, filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatalf("LoadLanguages() error = %v", err)
+	}
+	if len(langs) != 2 {
+		t.Fatalf("LoadLanguages() = %d languages, want both files' vhdl", len(langs))
+	}
+	if got := langs[0].Extensions; !slices.Equal(got, []string{".vhd", ".vhdl"}) {
+		t.Errorf("extensions = %v, want them normalized", got)
+	}
+	lp := langs[1]
+	if lp.Source != override || !slices.Equal(lp.Filenames, []string{"Vhdlfile"}) || lp.TestFile != nil {
+		t.Errorf("project vhdl = %+v, want the override from %s", lp, override)
+	}
+	// The name's group becomes the only one
+	p := lp.Definition[0]
+	if m := p.Regex.FindStringSubmatch("  pure function add"); p.Regex.NumSubexp() != 1 || len(m) != 2 || m[1] != "add" {
+		t.Errorf("pattern %s matched %q, want one group holding add", p.Regex, m)
+	}
+}
+
+func TestLoadLanguages_Duplicate(t *testing.T) {
+	dir := t.TempDir()
+	lang := "name: vhdl\nextensions: [.vhd]\ndefinitions: [{kind: type, regex: 'entity (\\w+)'}]\n"
+	writeLanguage(t, dir, "a.yaml", lang)
+	writeLanguage(t, dir, "b.yaml", lang)
+	if _, err := LoadLanguages(dir); err == nil || !strings.Contains(err.Error(), "also declared in") {
+		t.Errorf("LoadLanguages() error = %v, want a duplicate language error", err)
+	}
+}
+
+func TestReadLanguage_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"no name", "extensions: [.x]\ndefinitions: [{kind: type, regex: '(x)'}]", "name: missing"},
+		{"bad name", "name: My Lang\nextensions: [.x]\ndefinitions: [{kind: type, regex: '(x)'}]", `name: "My Lang" isn't a valid language name`},
+		{"no files", "name: x\ndefinitions: [{kind: type, regex: '(x)'}]", "needs extensions or filenames"},
+		{"no definitions", "name: x\nextensions: [.x]", "definitions: missing"},
+		{"unknown key", "name: x\nextension: [.x]\ndefinitions: [{kind: type, regex: '(x)'}]", `unknown key "extension" (did you mean "extensions"?)`},
+		{"bad test_file", "name: x\nextensions: [.x]\ntest_file: '('\ndefinitions: [{kind: type, regex: '(x)'}]", "test_file: error parsing regexp"},
+		{"unknown kind", "name: x\nextensions: [.x]\ndefinitions: [{kind: type, regex: '(x)'}, {kind: module, regex: '(x)'}]", `definitions[1].kind: unknown kind "module" (want function, method`},
+		{"bad regex", "name: x\nextensions: [.x]\ndefinitions: [{kind: type, regex: '(x'}]", "definitions[0]: regex: error parsing regexp"},
+		{"no group", "name: x\nextensions: [.x]\ndefinitions: [{kind: type, regex: 'x'}]", "definitions[0]: group: the regex has no capture group 1"},
+		{"group out of range", "name: x\nextensions: [.x]\ndefinitions: [{kind: type, regex: '(a)(b)', group: 3}]", "no capture group 3 around the name (it has 2)"},
+		{"not yaml", "name: [", "While parsing config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeLanguage(t, dir, strings.ReplaceAll(tt.name, " ", "_")+".yaml", tt.content)
+			_, err := ReadLanguage(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), path) {
+				t.Errorf("ReadLanguage() error = %v, want one naming %s and containing %q", err, path, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/bashhack/cdx/internal/workspace"
+)
+
+// SourceDefault is the source of a setting no file or variable sets.
+const SourceDefault = "default"
+
+// extraKeys are the list settings that accumulate across layers.
+var extraKeys = []string{"extra_exclude_dirs", "extra_exclude_globs"}
+
+// fileOnlyKeys are the mapping settings, which an environment variable
+// can't express.
+var fileOnlyKeys = []string{"language_extensions", "custom_patterns", "checks", "profiles"}
+
+// mergedKeys are the settings that combine across layers instead of the
+// highest-precedence layer replacing them.
+var mergedKeys = append([]string{"language_extensions"}, extraKeys...)
+
+// Files returns the config files LoadFrom(path) reads, lowest precedence
+// first: the explicit file when path or $CDX_CONFIG names one, and otherwise
+// every .cdx.yaml found in the search locations.
+func Files(path string) ([]string, error) {
+	if path == "" {
+		path = os.Getenv(EnvConfig)
+	}
+	if path == "" {
+		return discover(), nil
+	}
+	file, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("config file %s is a directory", file)
+	}
+	return []string{file}, nil
+}
+
+// discover returns the config files that exist, lowest precedence first,
+// each listed once even when two locations are the same directory.
+func discover() []string {
+	var dirs []string
+	if configDir, err := ConfigDir(); err == nil {
+		dirs = append(dirs, configDir)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, home)
+	}
+	if dir := projectDir(); dir != "" {
+		dirs = append(dirs, dir)
+	}
+
+	var files []string
+	for _, dir := range dirs {
+		file, err := filepath.Abs(filepath.Join(dir, ".cdx.yaml"))
+		if err != nil || slices.Contains(files, file) {
+			continue
+		}
+		if isFile(file) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// projectDir returns the directory of the project's .cdx.yaml: the nearest
+// one holding it from the current directory up to the root of the
+// repository it's in, so a command run in a subdirectory reads the same
+// config as one run at the root. It returns "" when there's none.
+func projectDir() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	root, err := workspace.Find(cwd)
+	if err != nil {
+		return ""
+	}
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		if isFile(filepath.Join(dir, ".cdx.yaml")) {
+			return dir
+		}
+		if dir == root.Dir || dir == filepath.Dir(dir) {
+			return ""
+		}
+	}
+}
+
+// isFile reports whether path exists and isn't a directory.
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// layers tracks what each config file and the environment contributed
+// while they're merged.
+type layers struct {
+	sources  map[string]string   // Key to the layers that set it
+	extras   map[string][]string // Accumulated extra_* lists
+	files    []string
+	warnings []Warning
+}
+
+func newLayers() *layers {
+	return &layers{sources: make(map[string]string), extras: make(map[string][]string)}
+}
+
+// merge reads file and merges its settings over v's.
+func (l *layers) merge(v *viper.Viper, file string) error {
+	layer := viper.NewWithOptions(viper.KeyDelimiter("::"))
+	layer.SetConfigFile(file)
+	layer.SetConfigType("yaml")
+	if err := layer.ReadInConfig(); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	l.files = append(l.files, file)
+	l.warnings = append(l.warnings, unknownKeys(layer)...)
+	for _, key := range layer.AllKeys() {
+		top, _, _ := strings.Cut(key, "::")
+		l.set(top, file)
+	}
+	for _, key := range extraKeys {
+		l.extras[key] = append(l.extras[key], layer.GetStringSlice(key)...)
+	}
+	return v.MergeConfigMap(layer.AllSettings())
+}
+
+// profile merges the named profile's settings over v's.
+func (l *layers) profile(v *viper.Viper, name string) error {
+	profiles := v.GetStringMap("profiles")
+	// viper lowercases keys, profile names included
+	settings, ok := profiles[strings.ToLower(name)].(map[string]any)
+	if !ok {
+		if len(profiles) == 0 {
+			return fmt.Errorf("unknown profile %q: no profiles are defined", name)
+		}
+		names := slices.Sorted(maps.Keys(profiles))
+		return fmt.Errorf("unknown profile %q (defined: %s)", name, strings.Join(names, ", "))
+	}
+
+	source := "profile " + name
+	for key := range settings {
+		l.set(key, source)
+	}
+	for _, key := range extraKeys {
+		if list, ok := settings[key].([]any); ok {
+			for _, entry := range list {
+				l.extras[key] = append(l.extras[key], fmt.Sprint(entry))
+			}
+		}
+	}
+	return v.MergeConfigMap(settings)
+}
+
+// bindEnv binds every setting to its CDX_* environment variable, so keys
+// without a default are overridable too, and records the ones that are set.
+// A mapping setting set in the environment is an error rather than ignored.
+func (l *layers) bindEnv(v *viper.Viper) error {
+	v.SetEnvPrefix("CDX")
+	v.SetEnvKeyReplacer(envKeyReplacer)
+	for _, key := range Keys() {
+		name := envName(key)
+		if slices.Contains(fileOnlyKeys, key) {
+			if os.Getenv(name) != "" {
+				return fmt.Errorf("%s: %s can only be set in a config file", name, key)
+			}
+			continue
+		}
+		if err := v.BindEnv(key, name); err != nil {
+			return err
+		}
+		if os.Getenv(name) != "" {
+			l.set(key, name)
+		}
+	}
+	return nil
+}
+
+// set records that source supplied key.
+func (l *layers) set(key, source string) {
+	prev := l.sources[key]
+	switch {
+	case prev == source:
+	case prev != "" && slices.Contains(mergedKeys, key):
+		l.sources[key] = prev + ", " + source
+	default:
+		l.sources[key] = source
+	}
+}
+
+// extra returns the accumulated list for an extra_* key, with the
+// environment variable's entries, if any, added last.
+func (l *layers) extra(v *viper.Viper, key string) ([]string, error) {
+	list := l.extras[key]
+	if os.Getenv(envName(key)) != "" {
+		// Decoded like the other lists, so entries are comma-separated
+		var env []string
+		if err := v.UnmarshalKey(key, &env); err != nil {
+			return nil, err
+		}
+		list = append(list, env...)
+	}
+	return list, nil
+}
+
+// blame prefixes err, which starts with the offending key, with the layer
+// that set the key, so the message says which file to fix.
+func (l *layers) blame(err error) error {
+	msg := err.Error()
+	key := msg[:strings.IndexAny(msg+":", ":[")]
+	if source, ok := l.sources[key]; ok {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	return err
+}
+
+// envKeyReplacer turns a nested key such as colors::match into the
+// COLORS_MATCH part of its environment variable.
+var envKeyReplacer = strings.NewReplacer("::", "_", ".", "_")
+
+// envNames are the environment variables that don't follow the CDX_<KEY>
+// pattern.
+var envNames = map[string]string{
+	// CDX_PAGER would read as the pager program, like $PAGER
+	"pager": "CDX_USE_PAGER",
+}
+
+// envName returns the environment variable that overrides key.
+func envName(key string) string {
+	if name, ok := envNames[key]; ok {
+		return name
+	}
+	return "CDX_" + strings.ToUpper(envKeyReplacer.Replace(key))
+}
+
+// Source describes where key's effective value came from: a config file
+// path, a CDX_* environment variable, or SourceDefault. Settings that merge
+// across files, such as language_extensions, list every file that set them.
+func (c *Config) Source(key string) string {
+	if source, ok := c.Sources[key]; ok {
+		return source
+	}
+	return SourceDefault
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/bashhack/cdx/internal/backend"
+	"github.com/bashhack/cdx/internal/openineditor"
+	"github.com/bashhack/cdx/internal/pager"
+	"github.com/bashhack/cdx/internal/similar"
+)
+
+// Warning is a problem in a config file that doesn't stop it from loading,
+// such as a key cdx doesn't know.
+type Warning struct {
+	File    string
+	Message string
+}
+
+func (w Warning) String() string {
+	if w.File == "" {
+		return w.Message
+	}
+	return w.File + ": " + w.Message
+}
+
+// Allowed values for the enum settings.
+var (
+	outputFormats  = []string{"auto", "human", "json", "plain"}
+	backendParsers = []string{"regex", "tree-sitter"}
+	goBackends     = []string{"regex", "gopls"}
+	searchRoots    = []string{"repo", "cwd"}
+	rootsModes     = []string{"append", "replace"}
+)
+
+// Keys lists every configuration key, sorted.
+func Keys() []string {
+	t := reflect.TypeFor[Config]()
+	keys := make([]string, 0, t.NumField())
+	for i := range t.NumField() {
+		if key := t.Field(i).Tag.Get("mapstructure"); key != "" && key != "-" {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// decode unmarshals v into cfg one key at a time, so a value of the wrong
+// type is reported against its key rather than as a raw decoder error.
+func decode(v *viper.Viper, cfg *Config) error {
+	rv := reflect.ValueOf(cfg).Elem()
+	t := rv.Type()
+	for i := range t.NumField() {
+		key := t.Field(i).Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+		if err := v.UnmarshalKey(key, rv.Field(i).Addr().Interface()); err != nil {
+			return fmt.Errorf("%s: %s is not %s", key, formatValue(v.Get(key)), describeType(t.Field(i).Type))
+		}
+	}
+	return nil
+}
+
+// formatValue renders a raw config value for an error message.
+func formatValue(v any) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// describeType names the kind of value a setting of type t accepts.
+func describeType(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int:
+		return "a whole number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.String {
+			return "a string or list of strings"
+		}
+		return "a list"
+	case reflect.Map:
+		return "a mapping"
+	default:
+		return "a " + t.String()
+	}
+}
+
+// unknownKeys warns about keys in the config file, or in its profiles, that
+// cdx doesn't know, suggesting the closest known key for a likely typo.
+func unknownKeys(v *viper.Viper) []Warning {
+	known := Keys()
+	inProfile := slices.DeleteFunc(slices.Clone(known), func(k string) bool { return k == "profiles" })
+	var warnings []Warning
+	seen := make(map[string]bool)
+	for _, key := range v.AllKeys() {
+		// Map settings such as language_extensions flatten into nested keys
+		parts := strings.SplitN(key, "::", 4)
+		name, where, candidates := parts[0], "", known
+		if name == "profiles" && len(parts) > 2 {
+			name, where, candidates = parts[2], fmt.Sprintf(" in profile %q", parts[1]), inProfile
+		}
+		if seen[name+where] || slices.Contains(candidates, name) {
+			continue
+		}
+		seen[name+where] = true
+		msg := fmt.Sprintf("unknown key %q%s", name, where)
+		if s := suggest(name, candidates); s != "" {
+			msg += fmt.Sprintf(" (did you mean %q?)", s)
+		}
+		warnings = append(warnings, Warning{File: v.ConfigFileUsed(), Message: msg})
+	}
+	slices.SortFunc(warnings, func(a, b Warning) int { return strings.Compare(a.Message, b.Message) })
+	return warnings
+}
+
+// checkEnums rejects enum settings with a value outside their allowed set.
+func (c *Config) checkEnums() error {
+	enums := []struct {
+		key     string
+		value   string
+		allowed []string
+	}{
+		{"output_format", c.OutputFormat, outputFormats},
+		{"backend_parser", c.BackendParser, backendParsers},
+		{"go_backend", c.GoBackend, goBackends},
+		{"search_root", c.SearchRoot, searchRoots},
+		{"roots_mode", c.RootsMode, rootsModes},
+		{"backend", c.Backend, backends()},
+		{"pager", c.Pager, pagers()},
+	}
+	for _, e := range enums {
+		if e.value == "" || slices.Contains(e.allowed, e.value) {
+			continue
+		}
+		msg := fmt.Sprintf("%s: invalid value %q (want one of %s", e.key, e.value, strings.Join(e.allowed, ", "))
+		if s := suggest(e.value, e.allowed); s != "" {
+			msg += fmt.Sprintf("; did you mean %q?", s)
+		}
+		return fmt.Errorf("%s)", msg)
+	}
+	return nil
+}
+
+// backends lists the backend setting's allowed values.
+func backends() []string {
+	names := make([]string, len(backend.Names))
+	for i, n := range backend.Names {
+		names[i] = string(n)
+	}
+	return names
+}
+
+// pagers lists the pager setting's allowed values.
+func pagers() []string {
+	names := make([]string, len(pager.Modes))
+	for i, m := range pager.Modes {
+		names[i] = string(m)
+	}
+	return names
+}
+
+// checkRanges rejects numeric settings outside their valid range.
+func (c *Config) checkRanges() error {
+	counts := []struct {
+		key   string
+		value int
+	}{
+		{"context_lines", c.ContextLines},
+		{"max_results", c.MaxResults},
+		{"max_caller_nodes", c.MaxCallerNodes},
+		{"jobs", c.Jobs},
+	}
+	for _, n := range counts {
+		if n.value < 0 {
+			return fmt.Errorf("%s: must be 0 or more, got %d", n.key, n.value)
+		}
+	}
+	if _, err := ParseSize(c.MaxFileSize); err != nil {
+		return fmt.Errorf("max_file_size: %w", err)
+	}
+	if _, err := ParseSize(c.MaxLineLength); err != nil {
+		return fmt.Errorf("max_line_length: %w", err)
+	}
+	if _, err := ParseSize(c.MaxStdinSize); err != nil {
+		return fmt.Errorf("max_stdin_size: %w", err)
+	}
+	if _, err := c.SearchTimeout(); err != nil {
+		return err
+	}
+	if _, err := c.WalkCacheLifetime(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkEditor rejects an editor template with unknown placeholders.
+func (c *Config) checkEditor() error {
+	if err := openineditor.Validate(c.Editor); err != nil {
+		return fmt.Errorf("editor: %w", err)
+	}
+	return nil
+}
+
+// suggest returns the candidate closest to s when it's near enough to be a
+// likely typo, or "" when none is.
+func suggest(s string, candidates []string) string {
+	best, bestDist := "", max(2, len(s)/4)+1
+	for _, c := range candidates {
+		if d := similar.Distance(s, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
@@ -0,0 +1,26 @@
+// Package deps holds what the dependency searches have in common: godeps
+// for the packages a Go module imports, nodedeps for node_modules, and
+// pydeps for a virtual environment's site-packages.
+package deps
+
+// Definition is a definition found in a dependency rather than in the
+// repository. Which of Package, Module, and Distribution are set depends on
+// the ecosystem the dependency comes from.
+type Definition struct {
+	Path         string `json:"file"` // Absolute path in GOROOT, the module cache, node_modules, or site-packages
+	Name         string `json:"name"`
+	Kind         string `json:"kind"`
+	Text         string `json:"text"`
+	Package      string `json:"package,omitempty"`      // Go import path or npm package name
+	Module       string `json:"module,omitempty"`       // Go module path
+	Distribution string `json:"distribution,omitempty"` // Python distribution name
+	Version      string `json:"version,omitempty"`
+	// Origin describes where the definition comes from for display, such
+	// as github.com/spf13/viper@v1.18.2, std, or pydantic@2.5.0
+	Origin string `json:"-"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	// External is always set, marking the definition in JSON as outside
+	// the repository
+	External bool `json:"external"`
+}
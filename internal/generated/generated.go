@@ -0,0 +1,87 @@
+// Package generated recognizes generated source files, such as protobuf
+// bindings and stringer output, whose definitions and references crowd out
+// the code people actually edit.
+//
+// A file is generated if its name matches one of a list of gitignore-style
+// patterns, or if one of its first lines carries a marker such as Go's
+// "Code generated ... DO NOT EDIT." or the "@generated" used elsewhere.
+package generated
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"github.com/bashhack/cdx/internal/ignore"
+)
+
+// DefaultPatterns are the file names recognized as generated unless the
+// generated_patterns setting says otherwise.
+var DefaultPatterns = []string{"*.pb.go", "zz_generated*.go", "*_string.go", "*.min.js"}
+
+// HeaderLines is how many lines at the top of a file Header looks at.
+const HeaderLines = 5
+
+// maxHeader caps the bytes Header looks at, so a minified file's single
+// enormous line isn't searched to its end.
+const maxHeader = 4096
+
+// marker matches a line marking its file generated.
+var marker = regexp.MustCompile(`Code generated .*DO NOT EDIT|@generated`)
+
+// Detector recognizes generated files by name and by header.
+type Detector struct {
+	names *ignore.Matcher
+}
+
+// New returns a detector for files whose names match patterns, which follow
+// gitignore syntax relative to the search root. Errors name source, the
+// setting the patterns came from.
+func New(patterns []string, source string) (*Detector, error) {
+	rules := make([]ignore.Rule, 0, len(patterns))
+	for _, p := range patterns {
+		rule, err := ignore.CompileRule(p, "", source)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		rules = append(rules, rule)
+	}
+	return &Detector{names: ignore.New(rules...)}, nil
+}
+
+// Default returns a detector for DefaultPatterns.
+func Default() *Detector {
+	// DefaultPatterns are all valid
+	d, _ := New(DefaultPatterns, "generated_patterns")
+	return d
+}
+
+// Name reports whether rel, a slash-separated path relative to the search
+// root, names a generated file. A nil Detector recognizes none.
+func (d *Detector) Name(rel string) bool {
+	if d == nil {
+		return false
+	}
+	generated, _ := d.names.Match(rel, false)
+	return generated
+}
+
+// Header reports whether one of the first HeaderLines lines of data marks
+// the file generated. A nil Detector recognizes none.
+func (d *Detector) Header(data []byte) bool {
+	if d == nil {
+		return false
+	}
+	head := data[:min(len(data), maxHeader)]
+	for range HeaderLines {
+		line, rest, _ := bytes.Cut(head, []byte("\n"))
+		if marker.Match(line) {
+			return true
+		}
+		if len(rest) == 0 {
+			break
+		}
+		head = rest
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package generated
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetector_Name(t *testing.T) {
+	d := Default()
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{"api/user.pb.go", true},
+		{"pkg/apis/zz_generated.deepcopy.go", true},
+		{"color_string.go", true},
+		{"web/vendor/app.min.js", true},
+		{"api/user.go", false},
+		{"string.go", false},
+		{"web/app.js", false},
+	}
+	for _, tt := range tests {
+		if got := d.Name(tt.rel); got != tt.want {
+			t.Errorf("Name(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+
+	custom, err := New([]string{"gen/", "*_gen.ts"}, "generated_patterns")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if !custom.Name("client/api_gen.ts") || custom.Name("api/user.pb.go") {
+		t.Error("custom patterns should replace the defaults")
+	}
+
+	var none *Detector
+	if none.Name("api/user.pb.go") {
+		t.Error("nil Detector recognized a name")
+	}
+}
+
+func TestNew_BadPattern(t *testing.T) {
+	_, err := New([]string{"[z-a]"}, "generated_patterns")
+	if err == nil || !strings.Contains(err.Error(), "generated_patterns") {
+		t.Errorf("New() error = %v, want one naming generated_patterns", err)
+	}
+}
+
+func TestDetector_Header(t *testing.T) {
+	tests := []struct {
+		name, src string
+		want      bool
+	}{
+		{"go", "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage api\n", true},
+		{"after license", "// Copyright 2024\n//\n// Code generated by mockgen. DO NOT EDIT.\npackage m\n", true},
+		{"at generated", "/**\n * @generated\n */\nexport const x = 1;\n", true},
+		{"too late", "a\nb\nc\nd\ne\n// Code generated by hand. DO NOT EDIT.\n", false},
+		{"no newline", "# @generated", true},
+		{"hand written", "package m\n\n// DO NOT EDIT the table below by hand.\n", false},
+		{"empty", "", false},
+		{"long first line", strings.Repeat("x", 2*maxHeader) + "@generated\n", false},
+	}
+	d := Default()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.Header([]byte(tt.src)); got != tt.want {
+				t.Errorf("Header() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
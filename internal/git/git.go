@@ -0,0 +1,72 @@
+// Package git runs the git commands cdx uses to enumerate and read files.
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// ErrNotRepository is returned when a directory is not inside a git work tree.
+var ErrNotRepository = errors.New("not inside a git repository")
+
+// ErrNotInstalled is returned when the git binary can't be found.
+var ErrNotInstalled = errors.New("git is not installed or not on PATH")
+
+// run executes git with args in dir and returns its standard output.
+func run(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, ErrNotInstalled
+	}
+
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...) // #nosec G204 -- fixed git subcommands
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(msg, "not a git repository") {
+			return nil, fmt.Errorf("%s: %w", dir, ErrNotRepository)
+		}
+		if msg == "" {
+			return nil, fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return nil, fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// LsFiles returns the files git tracks under dir, relative to dir,
+// slash-separated, and sorted. With includeUntracked, untracked files that
+// aren't ignored by git are listed too.
+func LsFiles(ctx context.Context, dir string, includeUntracked bool) ([]string, error) {
+	args := []string{"ls-files", "-z", "--cached"}
+	if includeUntracked {
+		args = append(args, "--others", "--exclude-standard")
+	}
+
+	out, err := run(ctx, dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	paths := splitNUL(out)
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// splitNUL splits NUL-terminated output, dropping the trailing empty field.
+func splitNUL(out []byte) []string {
+	fields := strings.Split(string(out), "\x00")
+	paths := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f != "" {
+			paths = append(paths, f)
+		}
+	}
+	return paths
+}
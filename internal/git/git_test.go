@@ -0,0 +1,111 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// initRepo creates a git repository containing files and stages the ones listed in tracked.
+func initRepo(t *testing.T, files map[string]string, tracked ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gitCmd(t, dir, "init", "-q")
+	if len(tracked) > 0 {
+		gitCmd(t, dir, append([]string{"add", "--"}, tracked...)...)
+	}
+	return dir
+}
+
+func gitCmd(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestLsFiles(t *testing.T) {
+	dir := initRepo(t, map[string]string{
+		".gitignore":    "*.swp\n",
+		"main.go":       "package main\n",
+		"pkg/util.go":   "package pkg\n",
+		"pkg/new.go":    "package pkg\n",
+		"main.go.swp":   "junk",
+		"with space.py": "x = 1\n",
+	}, ".gitignore", "main.go", "pkg/util.go", "with space.py")
+
+	tests := []struct {
+		name             string
+		want             []string
+		includeUntracked bool
+	}{
+		{
+			name: "tracked only",
+			want: []string{".gitignore", "main.go", "pkg/util.go", "with space.py"},
+		},
+		{
+			name:             "with untracked",
+			includeUntracked: true,
+			want:             []string{".gitignore", "main.go", "pkg/new.go", "pkg/util.go", "with space.py"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LsFiles(context.Background(), dir, tt.includeUntracked)
+			if err != nil {
+				t.Fatalf("LsFiles() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LsFiles() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLsFiles_Subdirectory(t *testing.T) {
+	dir := initRepo(t, map[string]string{
+		"main.go":     "package main\n",
+		"pkg/util.go": "package pkg\n",
+	}, "main.go", "pkg/util.go")
+
+	got, err := LsFiles(context.Background(), filepath.Join(dir, "pkg"), false)
+	if err != nil {
+		t.Fatalf("LsFiles() error = %v", err)
+	}
+	if want := []string{"util.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LsFiles() = %q, want %q (relative to the subdirectory)", got, want)
+	}
+}
+
+func TestLsFiles_NotRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+
+	_, err := LsFiles(context.Background(), dir, false)
+	if !errors.Is(err, ErrNotRepository) {
+		t.Errorf("LsFiles() error = %v, want ErrNotRepository", err)
+	}
+}
@@ -0,0 +1,165 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TreeEntry is a file in a git tree.
+type TreeEntry struct {
+	Path string // Slash-separated, relative to the directory the tree was listed from
+	OID  string // Blob object ID
+}
+
+// ResolveRev verifies that rev names a commit and returns its full object ID.
+func ResolveRev(ctx context.Context, dir, rev string) (string, error) {
+	out, err := run(ctx, dir, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		if errors.Is(err, ErrNotRepository) || errors.Is(err, ErrNotInstalled) {
+			return "", err
+		}
+		return "", fmt.Errorf("unknown revision %q", rev)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ErrNotInRev is returned by Show when a path doesn't exist as of a revision.
+var ErrNotInRev = errors.New("path does not exist in revision")
+
+// Show returns the contents of path, relative to dir, as of rev.
+func Show(ctx context.Context, dir, rev, path string) ([]byte, error) {
+	out, err := run(ctx, dir, "show", rev+":./"+filepath.ToSlash(path))
+	if err != nil {
+		if msg := err.Error(); strings.Contains(msg, "does not exist in") || strings.Contains(msg, "but not in") {
+			return nil, fmt.Errorf("%s as of %s: %w", path, rev, ErrNotInRev)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// LsTree lists the files under dir as of rev. Submodules and symlinks are
+// omitted since they have no searchable content.
+func LsTree(ctx context.Context, dir, rev string) ([]TreeEntry, error) {
+	out, err := run(ctx, dir, "ls-tree", "-r", "-z", rev)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []TreeEntry
+	for _, record := range splitNUL(out) {
+		// <mode> SP <type> SP <oid> TAB <path>
+		meta, path, ok := strings.Cut(record, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 3 || fields[1] != "blob" || fields[0] == "120000" {
+			continue
+		}
+		entries = append(entries, TreeEntry{Path: path, OID: fields[2]})
+	}
+	return entries, nil
+}
+
+// Blobs reads object contents through a single long-running
+// 'git cat-file --batch' process, avoiding a process per file.
+// A Blobs is not safe for concurrent use.
+type Blobs struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// OpenBlobs starts a cat-file process for the repository containing dir.
+func OpenBlobs(ctx context.Context, dir string) (*Blobs, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, ErrNotInstalled
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "cat-file", "--batch") // #nosec G204 -- fixed git subcommand
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &Blobs{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// Read returns the contents of the object named by oid (or any object
+// expression git accepts, such as "v1.4.0:./main.go").
+func (b *Blobs) Read(oid string) ([]byte, error) {
+	if _, err := io.WriteString(b.stdin, oid+"\n"); err != nil {
+		return nil, err
+	}
+
+	// <oid> SP <type> SP <size> LF, or <object> SP missing LF
+	header, err := b.stdout.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("git cat-file: object %q not found", oid)
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file: malformed header %q", strings.TrimSpace(header))
+	}
+
+	// Contents are followed by a LF separator
+	buf := make([]byte, size+1)
+	if _, err := io.ReadFull(b.stdout, buf); err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
+
+// Close stops the cat-file process.
+func (b *Blobs) Close() error {
+	if err := b.stdin.Close(); err != nil {
+		return err
+	}
+	return b.cmd.Wait()
+}
+
+// ReadTree calls fn with the path and contents of every file under dir as of
+// rev that keep accepts, or of every file when keep is nil, reading contents
+// through a single cat-file process. Files keep rejects are never read.
+func ReadTree(ctx context.Context, dir, rev string, keep func(path string) bool, fn func(path string, content []byte) error) error {
+	entries, err := LsTree(ctx, dir, rev)
+	if err != nil {
+		return err
+	}
+
+	blobs, err := OpenBlobs(ctx, dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if keep != nil && !keep(e.Path) {
+			continue
+		}
+		content, err := blobs.Read(e.OID)
+		if err == nil {
+			err = fn(e.Path, content)
+		}
+		if err != nil {
+			return errors.Join(err, blobs.Close())
+		}
+	}
+	return blobs.Close()
+}
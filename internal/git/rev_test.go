@@ -0,0 +1,150 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// commitAll commits the work tree and tags the commit.
+func commitAll(t *testing.T, dir, tag string) {
+	t.Helper()
+	gitCmd(t, dir, "add", "-A")
+	gitCmd(t, dir, "-c", "user.name=cdx", "-c", "user.email=cdx@example.com", "commit", "-q", "-m", tag)
+	gitCmd(t, dir, "tag", tag)
+}
+
+func TestReadTree(t *testing.T) {
+	dir := initRepo(t, map[string]string{
+		"main.go":     "package main\n\nfunc Old() {}\n",
+		"pkg/util.go": "package pkg\n",
+	})
+	commitAll(t, dir, "v1.0.0")
+
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc New() {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "pkg", "util.go")); err != nil {
+		t.Fatal(err)
+	}
+	commitAll(t, dir, "v2.0.0")
+
+	tests := []struct {
+		keep func(string) bool
+		want map[string]string
+		name string
+	}{
+		{
+			name: "every file",
+			want: map[string]string{
+				"main.go":     "package main\n\nfunc Old() {}\n",
+				"pkg/util.go": "package pkg\n",
+			},
+		},
+		{
+			name: "kept files",
+			keep: func(path string) bool { return path != "main.go" },
+			want: map[string]string{"pkg/util.go": "package pkg\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[string]string)
+			err := ReadTree(context.Background(), dir, "v1.0.0", tt.keep, func(path string, content []byte) error {
+				got[path] = string(content)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ReadTree() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadTree(v1.0.0) = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLsTree_Subdirectory(t *testing.T) {
+	dir := initRepo(t, map[string]string{
+		"main.go":     "package main\n",
+		"pkg/util.go": "package pkg\n",
+	})
+	commitAll(t, dir, "v1.0.0")
+
+	entries, err := LsTree(context.Background(), filepath.Join(dir, "pkg"), "v1.0.0")
+	if err != nil {
+		t.Fatalf("LsTree() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Path != "util.go" {
+		t.Errorf("LsTree() = %v, want only util.go relative to pkg/", entries)
+	}
+}
+
+func TestResolveRev(t *testing.T) {
+	dir := initRepo(t, map[string]string{"main.go": "package main\n"})
+	commitAll(t, dir, "v1.0.0")
+
+	oid, err := ResolveRev(context.Background(), dir, "v1.0.0")
+	if err != nil {
+		t.Fatalf("ResolveRev() error = %v", err)
+	}
+	if len(oid) < 40 {
+		t.Errorf("ResolveRev() = %q, want a full object ID", oid)
+	}
+
+	if _, err := ResolveRev(context.Background(), dir, "no-such-tag"); err == nil {
+		t.Error("ResolveRev(no-such-tag) error = nil, want error")
+	}
+}
+
+func TestBlobs_MissingObject(t *testing.T) {
+	dir := initRepo(t, map[string]string{"main.go": "package main\n"})
+	commitAll(t, dir, "v1.0.0")
+
+	blobs, err := OpenBlobs(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("OpenBlobs() error = %v", err)
+	}
+	defer blobs.Close()
+
+	if _, err := blobs.Read("v1.0.0:./missing.go"); err == nil {
+		t.Error("Read(missing) error = nil, want error")
+	}
+	// The process stays usable after a miss
+	content, err := blobs.Read("v1.0.0:./main.go")
+	if err != nil || string(content) != "package main\n" {
+		t.Errorf("Read(main.go) = (%q, %v), want file contents", content, err)
+	}
+}
+
+func TestShow(t *testing.T) {
+	dir := initRepo(t, map[string]string{
+		"main.go":     "package main\n\nfunc Old() {}\n",
+		"pkg/util.go": "package pkg\n",
+	})
+	commitAll(t, dir, "v1.0.0")
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc New() {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	got, err := Show(ctx, dir, "v1.0.0", "main.go")
+	if err != nil {
+		t.Fatalf("Show() error = %v", err)
+	}
+	if want := "package main\n\nfunc Old() {}\n"; string(got) != want {
+		t.Errorf("Show(main.go) = %q, want %q", got, want)
+	}
+
+	// Relative to a subdirectory
+	if got, err := Show(ctx, filepath.Join(dir, "pkg"), "v1.0.0", "util.go"); err != nil || string(got) != "package pkg\n" {
+		t.Errorf("Show(util.go) = %q, %v, want the committed file", got, err)
+	}
+
+	if _, err := Show(ctx, dir, "v1.0.0", "missing.go"); !errors.Is(err, ErrNotInRev) {
+		t.Errorf("Show(missing.go) error = %v, want ErrNotInRev", err)
+	}
+}
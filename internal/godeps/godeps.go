@@ -0,0 +1,362 @@
+// Package godeps finds definitions in the packages a Go module imports, for
+// symbols like context.WithTimeout or viper.New that are defined in GOROOT
+// or the module cache rather than in the module itself.
+//
+// Import paths are resolved with the go command, which is run with
+// GOPROXY=off so that a lookup never downloads anything: a module that isn't
+// already in the module cache is simply not found.
+package godeps
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bashhack/cdx/internal/deps"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/symbols"
+	"github.com/bashhack/cdx/internal/walk"
+)
+
+// DefaultTimeout bounds a single go invocation.
+const DefaultTimeout = 10 * time.Second
+
+// ErrNotInstalled is returned when the go binary can't be found.
+var ErrNotInstalled = errors.New("go is not installed or not on PATH")
+
+// ErrNotFound is returned when an import path has no source directory in
+// GOROOT or the module cache.
+var ErrNotFound = errors.New("package not found in GOROOT or the module cache")
+
+// Package is an imported package's source directory.
+type Package struct {
+	ImportPath string
+	Dir        string
+	Module     string // Module path; empty for the standard library
+	Version    string // Module version; empty for the standard library and local replacements
+}
+
+// Origin describes where p comes from: its module path and version, or std
+// for the standard library.
+func (p Package) Origin() string {
+	switch {
+	case p.Module == "":
+		return "std"
+	case p.Version == "":
+		return p.Module
+	}
+	return p.Module + "@" + p.Version
+}
+
+// module is a module as go list -m -json reports it.
+type module struct {
+	Replace *module
+	Path    string
+	Version string
+	Dir     string
+	Main    bool
+}
+
+// Resolver resolves import paths for one module. It runs the go command
+// the first time it's asked and reuses the answers after that.
+type Resolver struct {
+	Go       string // go binary
+	Dir      string // Module directory go runs in
+	goroot   string
+	modcache string
+	modules  []module
+	Timeout  time.Duration // Per-invocation limit; zero means DefaultTimeout
+	loaded   bool
+}
+
+// NewResolver returns a resolver for the module in dir, using the go found
+// on PATH.
+func NewResolver(dir string) (*Resolver, error) {
+	path, err := exec.LookPath("go")
+	if err != nil {
+		return nil, ErrNotInstalled
+	}
+	return &Resolver{Go: path, Dir: dir}, nil
+}
+
+// run executes go with args and returns its standard output.
+func (r *Resolver) run(ctx context.Context, args ...string) ([]byte, error) {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, r.Go, args...) // #nosec G204 -- fixed go subcommands
+	cmd.Dir = r.Dir
+	cmd.Env = append(os.Environ(), "GOPROXY=off")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("go %s: %w", args[0], ctx.Err())
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("go %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("go %s: %w", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// load asks go for GOROOT, GOMODCACHE, and the module's build list.
+func (r *Resolver) load(ctx context.Context) error {
+	if r.loaded {
+		return nil
+	}
+	out, err := r.run(ctx, "env", "-json", "GOROOT", "GOMODCACHE")
+	if err != nil {
+		return err
+	}
+	var env struct {
+		GOROOT     string
+		GOMODCACHE string
+	}
+	if err = json.Unmarshal(out, &env); err != nil {
+		return fmt.Errorf("go env: %w", err)
+	}
+	r.goroot, r.modcache = env.GOROOT, env.GOMODCACHE
+
+	// Outside a module there's no build list, only the standard library;
+	// -e reports modules missing from the cache without failing the list
+	if out, err = r.run(ctx, "list", "-mod=readonly", "-e", "-m", "-json", "all"); err != nil {
+		out = nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var m module
+		if err = dec.Decode(&m); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("go list: %w", err)
+		}
+		r.modules = append(r.modules, m)
+	}
+	r.loaded = true
+	return nil
+}
+
+// Resolve returns the source directory of the package with importPath.
+// Packages in the module itself aren't dependencies, so they aren't found.
+func (r *Resolver) Resolve(ctx context.Context, importPath string) (Package, error) {
+	if err := r.load(ctx); err != nil {
+		return Package{}, err
+	}
+	p := Package{ImportPath: importPath}
+	first, _, _ := strings.Cut(importPath, "/")
+	if !strings.Contains(first, ".") {
+		p.Dir = filepath.Join(r.goroot, "src", filepath.FromSlash(importPath))
+		return p, exists(p)
+	}
+
+	var m *module
+	for i := range r.modules {
+		c := &r.modules[i]
+		if (importPath == c.Path || strings.HasPrefix(importPath, c.Path+"/")) && (m == nil || len(c.Path) > len(m.Path)) {
+			m = c
+		}
+	}
+	if m == nil || m.Main {
+		return p, fmt.Errorf("%s: %w", importPath, ErrNotFound)
+	}
+	p.Module, p.Version = m.Path, m.Version
+	dir := m.Dir
+	if m.Replace != nil {
+		p.Version, dir = m.Replace.Version, m.Replace.Dir
+	}
+	if dir == "" && m.Replace == nil {
+		// go list leaves Dir out when the module isn't extracted, but the
+		// layout is fixed, so look where it would be
+		dir = filepath.Join(r.modcache, escapePath(m.Path)+"@"+m.Version)
+	}
+	if dir == "" {
+		return p, fmt.Errorf("%s: %w", importPath, ErrNotFound)
+	}
+	p.Dir = filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(importPath, m.Path)))
+	return p, exists(p)
+}
+
+// exists reports ErrNotFound when p's directory isn't there.
+func exists(p Package) error {
+	if info, err := os.Stat(p.Dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s: %w", p.ImportPath, ErrNotFound)
+	}
+	return nil
+}
+
+// escapePath escapes a module path as the module cache does, writing each
+// uppercase letter as ! and its lowercase, so that paths differing only in
+// case stay apart on case-insensitive file systems.
+func escapePath(p string) string {
+	var b strings.Builder
+	for _, r := range p {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Imports returns the import paths that the Go files opts walks import
+// under name, either explicitly or by the package name the path implies,
+// most imported first.
+func Imports(ctx context.Context, opts walk.Options, name string) ([]string, error) {
+	opts.Languages = []patterns.Language{patterns.Go}
+	counts := make(map[string]int)
+	fset := token.NewFileSet()
+	_, err := walk.Walk(ctx, opts, func(f walk.File) error {
+		// A nil Data must reach the parser as a nil src to be read from Path
+		var src any
+		if f.Data != nil {
+			src = f.Data
+		}
+		// A file that doesn't parse has no imports worth reporting
+		file, err := parser.ParseFile(fset, f.Path, src, parser.ImportsOnly)
+		if err != nil {
+			return nil
+		}
+		for _, spec := range file.Imports {
+			ip, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			local := packageName(ip)
+			if spec.Name != nil {
+				local = spec.Name.Name
+			}
+			if local == name {
+				counts[ip]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(counts))
+	for ip := range counts {
+		paths = append(paths, ip)
+	}
+	slices.SortFunc(paths, func(a, b string) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+		return strings.Compare(a, b)
+	})
+	return paths, nil
+}
+
+// majorSuffix matches an import path's major version element, such as /v2,
+// or gopkg.in's .v3.
+var majorSuffix = regexp.MustCompile(`^v[0-9]+$|\.v[0-9]+$`)
+
+// packageName guesses the name of the package at importPath, the way goimports
+// does without loading it: the last element, less any major version and
+// go- prefix or -go suffix.
+func packageName(importPath string) string {
+	base := path.Base(importPath)
+	if majorSuffix.MatchString(base) {
+		if strings.HasPrefix(base, "v") {
+			base = path.Base(path.Dir(importPath))
+		} else {
+			base = base[:strings.LastIndex(base, ".v")]
+		}
+	}
+	base = strings.TrimPrefix(base, "go-")
+	base = strings.TrimSuffix(base, "-go")
+	return strings.ReplaceAll(base, "-", "_")
+}
+
+// Definitions returns the definitions of name in p, reading its non-test
+// files with ex. name is Name for a package-level definition, or
+// Type.Method for a method.
+func Definitions(p Package, name string, ex symbols.Extractor) ([]deps.Definition, error) {
+	entries, err := os.ReadDir(p.Dir)
+	if err != nil {
+		return nil, err
+	}
+	typeName, method, isMethod := strings.Cut(name, ".")
+	var defs []deps.Definition
+	for _, e := range entries {
+		file := e.Name()
+		if e.IsDir() || !strings.HasSuffix(file, ".go") || strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		path := filepath.Join(p.Dir, file)
+		src, err := os.ReadFile(path) // #nosec G304 -- a file in a package directory go resolved
+		if err != nil {
+			return nil, err
+		}
+		syms, err := ex.Extract(src, patterns.Go)
+		if err != nil {
+			return nil, err
+		}
+		lines := strings.Split(string(src), "\n")
+		for _, s := range syms {
+			text := ""
+			if s.Line <= len(lines) {
+				text = strings.TrimSpace(lines[s.Line-1])
+			}
+			switch {
+			case !isMethod && (s.Name != name || s.Kind == "method"):
+				continue
+			case isMethod && (s.Name != method || s.Kind != "method" || !receiverIs(s, lines, typeName)):
+				continue
+			}
+			defs = append(defs, deps.Definition{
+				Path:     path,
+				Name:     s.Name,
+				Kind:     s.Kind,
+				Text:     text,
+				Package:  p.ImportPath,
+				Module:   p.Module,
+				Version:  p.Version,
+				Origin:   p.Origin(),
+				Line:     s.Line,
+				Column:   s.Column,
+				External: true,
+			})
+		}
+	}
+	return defs, nil
+}
+
+// receiverIs reports whether method s is declared on typeName: by its
+// parent when the extractor knows it, or else by the receiver ahead of its
+// name.
+func receiverIs(s symbols.Symbol, lines []string, typeName string) bool {
+	if s.Parent != "" {
+		return s.Parent == typeName
+	}
+	if s.Line > len(lines) || s.Column < 1 || s.Column > len(lines[s.Line-1])+1 {
+		return false
+	}
+	recv := lines[s.Line-1][:s.Column-1]
+	return strings.Contains(recv, " "+typeName+")") || strings.Contains(recv, "*"+typeName+")") ||
+		strings.Contains(recv, " "+typeName+"[") || strings.Contains(recv, "*"+typeName+"[")
+}
@@ -0,0 +1,198 @@
+package godeps
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/deps"
+	"github.com/bashhack/cdx/internal/symbols"
+	"github.com/bashhack/cdx/internal/walk"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// fakeGo writes a shell script standing in for go that answers go env and
+// go list -m with canned output.
+func fakeGo(t *testing.T, env, list string) *Resolver {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake go is a shell script")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "go")
+	script := "#!/bin/sh\ncase \"$1\" in\nenv) cat <<'OUT'\n" + env + "\nOUT\n;;\nlist) cat <<'OUT'\n" + list + "\nOUT\n;;\nesac\n"
+	if err := os.WriteFile(path, []byte(script), 0o700); err != nil { // #nosec G306 -- must be executable
+		t.Fatal(err)
+	}
+	return &Resolver{Go: path, Dir: dir}
+}
+
+func TestResolve(t *testing.T) {
+	root := t.TempDir()
+	goroot := filepath.Join(root, "goroot")
+	modcache := filepath.Join(root, "mod")
+	local := filepath.Join(root, "local")
+	writeFiles(t, root, map[string]string{
+		"goroot/src/context/context.go":                     "package context\n",
+		"mod/example.com/lib@v1.2.0/lib.go":                 "package lib\n",
+		"mod/example.com/lib@v1.2.0/sub/sub.go":             "package sub\n",
+		"mod/github.com/!burnt!sushi/toml@v1.3.2/decode.go": "package toml\n",
+		"local/fork.go":                                      "package fork\n",
+		"mod/example.com/lib/v2@v2.0.0/lib.go":               "package lib\n",
+		"mod/example.com/unrelated@v0.1.0/unrelated/file.go": "package unrelated\n",
+	})
+	r := fakeGo(t, `{"GOROOT": "`+goroot+`", "GOMODCACHE": "`+modcache+`"}`, `{"Path": "example.com/app", "Main": true, "Dir": "/app"}
+{"Path": "example.com/lib", "Version": "v1.2.0", "Dir": "`+filepath.Join(modcache, "example.com/lib@v1.2.0")+`"}
+{"Path": "example.com/lib/v2", "Version": "v2.0.0"}
+{"Path": "github.com/BurntSushi/toml", "Version": "v1.3.2"}
+{"Path": "example.com/fork", "Version": "v1.0.0", "Replace": {"Path": "../local", "Dir": "`+local+`"}}
+{"Path": "example.com/gone", "Version": "v0.3.0"}`)
+
+	tests := []struct {
+		want       Package
+		importPath string
+		origin     string
+		notFound   bool
+	}{
+		{importPath: "context", want: Package{ImportPath: "context", Dir: filepath.Join(goroot, "src/context")}, origin: "std"},
+		{importPath: "example.com/lib", want: Package{ImportPath: "example.com/lib", Dir: filepath.Join(modcache, "example.com/lib@v1.2.0"), Module: "example.com/lib", Version: "v1.2.0"}, origin: "example.com/lib@v1.2.0"},
+		// The longest module path wins
+		{importPath: "example.com/lib/sub", want: Package{ImportPath: "example.com/lib/sub", Dir: filepath.Join(modcache, "example.com/lib@v1.2.0/sub"), Module: "example.com/lib", Version: "v1.2.0"}, origin: "example.com/lib@v1.2.0"},
+		{importPath: "example.com/lib/v2", want: Package{ImportPath: "example.com/lib/v2", Dir: filepath.Join(modcache, "example.com/lib/v2@v2.0.0"), Module: "example.com/lib/v2", Version: "v2.0.0"}, origin: "example.com/lib/v2@v2.0.0"},
+		// Without a Dir, the cache layout is used, with uppercase escaped
+		{importPath: "github.com/BurntSushi/toml", want: Package{ImportPath: "github.com/BurntSushi/toml", Dir: filepath.Join(modcache, "github.com/!burnt!sushi/toml@v1.3.2"), Module: "github.com/BurntSushi/toml", Version: "v1.3.2"}, origin: "github.com/BurntSushi/toml@v1.3.2"},
+		{importPath: "example.com/fork", want: Package{ImportPath: "example.com/fork", Dir: local, Module: "example.com/fork"}, origin: "example.com/fork"},
+		{importPath: "example.com/gone", notFound: true},
+		{importPath: "example.com/app/internal/x", notFound: true},
+		{importPath: "example.com/nobody", notFound: true},
+		{importPath: "nosuchstd", notFound: true},
+	}
+	for _, tt := range tests {
+		got, err := r.Resolve(context.Background(), tt.importPath)
+		if tt.notFound {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("Resolve(%q) error = %v, want ErrNotFound", tt.importPath, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Resolve(%q) error = %v", tt.importPath, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Resolve(%q) = %+v, want %+v", tt.importPath, got, tt.want)
+		}
+		if got.Origin() != tt.origin {
+			t.Errorf("Resolve(%q).Origin() = %q, want %q", tt.importPath, got.Origin(), tt.origin)
+		}
+	}
+}
+
+func TestPackageName(t *testing.T) {
+	tests := map[string]string{
+		"context":                    "context",
+		"net/http":                   "http",
+		"github.com/spf13/viper":     "viper",
+		"example.com/lib/v2":         "lib",
+		"gopkg.in/yaml.v3":           "yaml",
+		"github.com/mattn/go-isatty": "isatty",
+		"github.com/foo/bar-go":      "bar",
+		"github.com/foo/some-thing":  "some_thing",
+	}
+	for path, want := range tests {
+		if got := packageName(path); got != want {
+			t.Errorf("packageName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.go":      "package app\n\nimport (\n\t\"context\"\n\n\t\"github.com/spf13/viper\"\n\tv \"example.com/other/viper\"\n)\n",
+		"b.go":      "package app\n\nimport (\n\tctx \"example.com/ctx\"\n\t\"github.com/spf13/viper\"\n\t_ \"example.com/blank\"\n)\n",
+		"c.go":      "package app\n\nimport \"gopkg.in/yaml.v3\"\n",
+		"broken.go": "package app\n\nimport (\n",
+		"notes.txt": "import \"github.com/spf13/viper\"\n",
+	})
+	tests := map[string][]string{
+		"viper":   {"github.com/spf13/viper"},
+		"v":       {"example.com/other/viper"},
+		"context": {"context"},
+		"ctx":     {"example.com/ctx"},
+		"yaml":    {"gopkg.in/yaml.v3"},
+		"blank":   nil,
+		"fmt":     nil,
+	}
+	for name, want := range tests {
+		got, err := Imports(context.Background(), walk.Options{Root: dir}, name)
+		if err != nil {
+			t.Fatalf("Imports(%q) error = %v", name, err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Imports(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"client.go": `package lib
+
+type Client struct{}
+
+func New() *Client { return &Client{} }
+
+func (c *Client) Do() error { return nil }
+
+func (o Other) Do() error { return nil }
+`,
+		"other.go":       "package lib\n\ntype Other struct{}\n\nconst Version = \"1\"\n",
+		"client_test.go": "package lib\n\nfunc New() {}\n",
+	})
+	p := Package{ImportPath: "example.com/lib", Dir: dir, Module: "example.com/lib", Version: "v1.0.0"}
+	def := func(file, name, kind, text string, line, column int) deps.Definition {
+		return deps.Definition{Path: filepath.Join(dir, file), Name: name, Kind: kind, Text: text, Package: p.ImportPath,
+			Module: p.Module, Version: p.Version, Origin: "example.com/lib@v1.0.0", Line: line, Column: column, External: true}
+	}
+
+	tests := []struct {
+		name string
+		want []deps.Definition
+	}{
+		{name: "New", want: []deps.Definition{def("client.go", "New", "function", "func New() *Client { return &Client{} }", 5, 6)}},
+		{name: "Version", want: []deps.Definition{def("other.go", "Version", "const", `const Version = "1"`, 5, 7)}},
+		{name: "Client.Do", want: []deps.Definition{def("client.go", "Do", "method", "func (c *Client) Do() error { return nil }", 7, 18)}},
+		{name: "Other.Do", want: []deps.Definition{def("client.go", "Do", "method", "func (o Other) Do() error { return nil }", 9, 16)}},
+		// A method needs its type
+		{name: "Do"},
+		{name: "Missing"},
+	}
+	for _, tt := range tests {
+		got, err := Definitions(p, tt.name, symbols.Regex{})
+		if err != nil {
+			t.Fatalf("Definitions(%q) error = %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Definitions(%q) = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package gopls answers Go definition and reference queries precisely by
+// running the gopls command-line client.
+//
+// It is an opt-in alternative to regex matching for Go: gopls type-checks
+// the workspace, so it's exact but slower, and callers are expected to fall
+// back to the regex path on any error.
+package gopls
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds a single gopls invocation, which includes loading
+// the workspace on a cold start.
+const DefaultTimeout = 10 * time.Second
+
+// ErrNotInstalled is returned when the gopls binary can't be found.
+var ErrNotInstalled = errors.New("gopls is not installed or not on PATH")
+
+// Client runs gopls commands in a workspace.
+type Client struct {
+	Path    string        // gopls binary
+	Dir     string        // Workspace directory gopls runs in
+	Timeout time.Duration // Per-invocation limit; zero means DefaultTimeout
+}
+
+// Location is a position reported by gopls.
+type Location struct {
+	Path   string // Absolute path of the file
+	Name   string // Symbol name, for workspace symbol results
+	Kind   string // cdx kind name, for workspace symbol results
+	Line   int    // 1-based
+	Column int    // 1-based
+}
+
+// New returns a client for the gopls found on PATH.
+func New(dir string) (*Client, error) {
+	path, err := exec.LookPath("gopls")
+	if err != nil {
+		return nil, ErrNotInstalled
+	}
+	return &Client{Path: path, Dir: dir}, nil
+}
+
+// run executes gopls with args and returns its standard output.
+func (c *Client) run(ctx context.Context, args ...string) ([]byte, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.Path, args...) // #nosec G204 -- fixed gopls subcommands
+	cmd.Dir = c.Dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("gopls %s: %w", args[0], ctx.Err())
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("gopls %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("gopls %s: %w", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// Definition returns where symbol is declared in the workspace, using
+// gopls's workspace symbol search and keeping only exact name matches.
+// Methods and fields match on their own name, without the receiver.
+func (c *Client) Definition(ctx context.Context, symbol string, ignoreCase bool) ([]Location, error) {
+	matcher := "casesensitive"
+	if ignoreCase {
+		matcher = "caseinsensitive"
+	}
+	out, err := c.run(ctx, "workspace_symbol", "-matcher="+matcher, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	var locs []Location
+	for line := range strings.SplitSeq(string(out), "\n") {
+		loc, ok := parseSymbol(line)
+		if !ok {
+			continue
+		}
+		if loc.Name == symbol || ignoreCase && strings.EqualFold(loc.Name, symbol) {
+			locs = append(locs, loc)
+		}
+	}
+	return locs, nil
+}
+
+// References returns the uses of the identifier at path:line:column,
+// including its declaration.
+func (c *Client) References(ctx context.Context, path string, line, column int) ([]Location, error) {
+	out, err := c.run(ctx, "references", "-d", fmt.Sprintf("%s:%d:%d", path, line, column))
+	if err != nil {
+		return nil, err
+	}
+
+	var locs []Location
+	for s := range strings.SplitSeq(string(out), "\n") {
+		if loc, ok := parseLocation(strings.TrimSpace(s)); ok {
+			locs = append(locs, loc)
+		}
+	}
+	return locs, nil
+}
+
+// locationRE matches gopls's span format, path:line:col or
+// path:line:col-[line:]col. The path may itself contain colons.
+var locationRE = regexp.MustCompile(`^(.+):(\d+):(\d+)(?:-(?:\d+:)?\d+)?$`)
+
+func parseLocation(s string) (Location, bool) {
+	m := locationRE.FindStringSubmatch(s)
+	if m == nil {
+		return Location{}, false
+	}
+	line, err := strconv.Atoi(m[2])
+	if err != nil {
+		return Location{}, false
+	}
+	col, err := strconv.Atoi(m[3])
+	if err != nil {
+		return Location{}, false
+	}
+	return Location{Path: m[1], Line: line, Column: col}, true
+}
+
+// parseSymbol parses a workspace_symbol result line: a span, the symbol
+// name (possibly qualified as pkg.Name or Type.Method), and its kind.
+func parseSymbol(s string) (Location, bool) {
+	fields := strings.Fields(s)
+	if len(fields) < 3 {
+		return Location{}, false
+	}
+	loc, ok := parseLocation(fields[0])
+	if !ok {
+		return Location{}, false
+	}
+	name := fields[1]
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	loc.Name = name
+	loc.Kind = kindName(fields[2])
+	return loc, true
+}
+
+// kinds maps LSP symbol kinds to cdx's kind names.
+var kinds = map[string]string{
+	"Function":  "function",
+	"Method":    "method",
+	"Struct":    "type",
+	"Class":     "type",
+	"Interface": "interface",
+	"Constant":  "const",
+	"Variable":  "var",
+	"Field":     "field",
+}
+
+func kindName(k string) string {
+	if name, ok := kinds[k]; ok {
+		return name
+	}
+	return strings.ToLower(k)
+}
@@ -0,0 +1,131 @@
+package gopls
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeGopls writes a shell script standing in for gopls that records its
+// arguments and prints output.
+func fakeGopls(t *testing.T, script string) *Client {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake gopls is a shell script")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gopls")
+	content := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\n" + script + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o700); err != nil { // #nosec G306 -- must be executable
+		t.Fatal(err)
+	}
+	return &Client{Path: path, Dir: dir}
+}
+
+func lastArgs(t *testing.T, c *Client) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(c.Dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestDefinition(t *testing.T) {
+	c := fakeGopls(t, `cat <<'OUT'
+/repo/user.go:10:6-13 NewUser Function
+/repo/user.go:20:16-20 User.Name Method
+/repo/store.go:5:6-18 NewUserStore Function
+/repo/user.go:3:6-10 user.User Struct
+OUT`)
+
+	tests := []struct {
+		symbol     string
+		wantArgs   string
+		want       []Location
+		ignoreCase bool
+	}{
+		{
+			symbol:   "NewUser",
+			wantArgs: "workspace_symbol -matcher=casesensitive NewUser",
+			want:     []Location{{Path: "/repo/user.go", Name: "NewUser", Kind: "function", Line: 10, Column: 6}},
+		},
+		{
+			symbol:   "Name",
+			wantArgs: "workspace_symbol -matcher=casesensitive Name",
+			want:     []Location{{Path: "/repo/user.go", Name: "Name", Kind: "method", Line: 20, Column: 16}},
+		},
+		{
+			symbol:     "user",
+			ignoreCase: true,
+			wantArgs:   "workspace_symbol -matcher=caseinsensitive user",
+			want:       []Location{{Path: "/repo/user.go", Name: "User", Kind: "type", Line: 3, Column: 6}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.symbol, func(t *testing.T) {
+			got, err := c.Definition(context.Background(), tt.symbol, tt.ignoreCase)
+			if err != nil {
+				t.Fatalf("Definition: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Definition(%q) = %+v, want %+v", tt.symbol, got, tt.want)
+			}
+			if args := lastArgs(t, c); args != tt.wantArgs {
+				t.Errorf("gopls args = %q, want %q", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestReferences(t *testing.T) {
+	c := fakeGopls(t, `printf '/repo/user.go:10:6-13\n/repo/main.go:7:9-16\n'`)
+
+	got, err := c.References(context.Background(), "/repo/user.go", 10, 6)
+	if err != nil {
+		t.Fatalf("References: %v", err)
+	}
+	want := []Location{
+		{Path: "/repo/user.go", Line: 10, Column: 6},
+		{Path: "/repo/main.go", Line: 7, Column: 9},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("References() = %+v, want %+v", got, want)
+	}
+	if args := lastArgs(t, c); args != "references -d /repo/user.go:10:6" {
+		t.Errorf("gopls args = %q", args)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	t.Run("failure", func(t *testing.T) {
+		c := fakeGopls(t, "echo 'no views' >&2; exit 1")
+		_, err := c.Definition(context.Background(), "NewUser", false)
+		if err == nil || !strings.Contains(err.Error(), "no views") {
+			t.Errorf("Definition() error = %v, want gopls stderr", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		c := fakeGopls(t, "exec sleep 5")
+		c.Timeout = 50 * time.Millisecond
+		_, err := c.Definition(context.Background(), "NewUser", false)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Definition() error = %v, want deadline exceeded", err)
+		}
+	})
+}
+
+func TestNewNotInstalled(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := New("."); !errors.Is(err, ErrNotInstalled) {
+		t.Errorf("New() error = %v, want ErrNotInstalled", err)
+	}
+}
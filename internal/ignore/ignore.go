@@ -0,0 +1,212 @@
+// Package ignore implements gitignore-style path exclusion rules.
+//
+// Rules follow gitignore semantics: blank lines and lines starting with '#'
+// are skipped, a leading '!' negates a pattern, a trailing '/' restricts it
+// to directories, a pattern containing a '/' (other than a trailing one) is
+// anchored to the directory of the file that declared it, and '**' matches
+// across directory boundaries. When several rules match a path, the last one
+// wins, so rules from deeper ignore files override those of their parents.
+package ignore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Rule is a single compiled ignore pattern.
+type Rule struct {
+	re      *regexp.Regexp
+	Pattern string // Pattern as written, without the negation prefix
+	Base    string // Slash-separated directory the rule is relative to ("" for the root)
+	Source  string // Where the rule came from, e.g. ".cdxignore" or "web/.gitignore"
+	Negate  bool
+	DirOnly bool
+}
+
+// Matcher evaluates an ordered list of rules. The zero value matches nothing.
+// A Matcher is immutable; With returns an extended copy.
+type Matcher struct {
+	rules []Rule
+}
+
+// New returns a matcher for the given rules.
+func New(rules ...Rule) *Matcher {
+	return &Matcher{rules: rules}
+}
+
+// With returns a new matcher with rules appended after the receiver's rules.
+func (m *Matcher) With(rules ...Rule) *Matcher {
+	if len(rules) == 0 {
+		return m
+	}
+	combined := make([]Rule, 0, len(m.rules)+len(rules))
+	combined = append(combined, m.rules...)
+	combined = append(combined, rules...)
+	return &Matcher{rules: combined}
+}
+
+// Len returns the number of rules in the matcher.
+func (m *Matcher) Len() int {
+	return len(m.rules)
+}
+
+// Match reports whether the slash-separated path rel (relative to the walk
+// root) is ignored, and the source of the deciding rule. A path that a
+// negated rule re-includes is reported as not ignored.
+func (m *Matcher) Match(rel string, isDir bool) (ignored bool, source string) {
+	for i := len(m.rules) - 1; i >= 0; i-- {
+		r := &m.rules[i]
+		if r.matches(rel, isDir) {
+			return !r.Negate, r.Source
+		}
+	}
+	return false, ""
+}
+
+// matches reports whether the rule's pattern matches rel.
+func (r *Rule) matches(rel string, isDir bool) bool {
+	if r.DirOnly && !isDir {
+		return false
+	}
+	if r.Base != "" {
+		if !strings.HasPrefix(rel, r.Base+"/") {
+			return false
+		}
+		rel = rel[len(r.Base)+1:]
+	}
+	return r.re.MatchString(rel)
+}
+
+// Parse reads gitignore-syntax rules from r. Rules are relative to base, the
+// slash-separated directory containing the ignore file, and are tagged with
+// source for diagnostics.
+func Parse(r io.Reader, base, source string) ([]Rule, error) {
+	var rules []Rule
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		rule, ok := ParseRule(scanner.Text(), base, source)
+		if ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// ParseFile reads rules from the ignore file at path. A missing file yields
+// no rules and no error.
+func ParseFile(path, base, source string) ([]Rule, error) {
+	f, err := os.Open(path) // #nosec G304 -- ignore files are discovered by the walker
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f, base, source)
+}
+
+// ParseRule compiles one line of gitignore syntax. It returns false for blank
+// lines, comments, and patterns that can't be compiled.
+func ParseRule(line, base, source string) (Rule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return Rule{}, false
+	}
+	rule, err := CompileRule(line, base, source)
+	return rule, err == nil
+}
+
+// CompileRule compiles a single gitignore-syntax pattern that didn't come
+// from an ignore file, such as one from configuration, reporting why an
+// unusable pattern can't be compiled rather than skipping it.
+func CompileRule(pattern, base, source string) (Rule, error) {
+	line := pattern
+	rule := Rule{Base: strings.Trim(base, "/"), Source: source}
+	if strings.HasPrefix(line, "!") {
+		rule.Negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.DirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return Rule{}, fmt.Errorf("invalid pattern %q: matches nothing", pattern)
+	}
+	rule.Pattern = line
+
+	// A slash anywhere but the end anchors the pattern to its base directory;
+	// otherwise it matches a name at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "(?:^|/)" + expr + "$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	rule.re = re
+	return rule, nil
+}
+
+// globToRegexp translates gitignore glob syntax into a regular expression
+// matched against slash-separated paths.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				// "**/" matches zero or more directories, a trailing "**"
+				// matches everything below
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString(`(?:.*/)?`)
+				} else {
+					b.WriteString(`.*`)
+				}
+				continue
+			}
+			b.WriteString(`[^/]*`)
+		case '?':
+			b.WriteString(`[^/]`)
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
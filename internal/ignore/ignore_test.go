@@ -0,0 +1,129 @@
+package ignore
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, text, base, source string) []Rule {
+	t.Helper()
+	rules, err := Parse(strings.NewReader(text), base, source)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	return rules
+}
+
+func TestMatcher_Match(t *testing.T) {
+	rules := mustParse(t, `# generated clients
+generated/
+*.min.js
+/fixtures
+docs/**/*.md
+!generated/keep.go
+build?/
+[Tt]emp
+`, "", ".cdxignore")
+	m := New(rules...)
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"generated", true, true},
+		{"api/generated", true, true},
+		{"generated", false, false}, // dir-only pattern doesn't match files
+		{"web/app.min.js", false, true},
+		{"web/app.js", false, false},
+		{"fixtures", true, true},
+		{"pkg/fixtures", true, false}, // anchored to the root
+		{"docs/guide.md", false, true},
+		{"docs/a/b/guide.md", false, true},
+		{"docs/guide.txt", false, false},
+		{"generated/keep.go", false, false},
+		{"build1", true, true},
+		{"build", true, false},
+		{"Temp", false, true},
+		{"temp", false, true},
+		{"main.go", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, source := m.Match(tt.path, tt.isDir)
+			if got != tt.ignored {
+				t.Errorf("Match(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.ignored)
+			}
+			if got && source != ".cdxignore" {
+				t.Errorf("Match(%q) source = %q, want %q", tt.path, source, ".cdxignore")
+			}
+		})
+	}
+}
+
+func TestMatcher_NestedRulesOverrideParents(t *testing.T) {
+	root := New(mustParse(t, "*.pb.go\n", "", ".gitignore")...)
+	nested := root.With(mustParse(t, "!keep.pb.go\nlocal.go\n", "api", "api/.cdxignore")...)
+
+	tests := []struct {
+		path       string
+		wantSource string
+		ignored    bool
+	}{
+		{"user.pb.go", ".gitignore", true},
+		{"api/user.pb.go", ".gitignore", true},
+		{"api/keep.pb.go", "api/.cdxignore", false},
+		{"keep.pb.go", ".gitignore", true}, // negation is scoped to api/
+		{"api/local.go", "api/.cdxignore", true},
+		{"local.go", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, source := nested.Match(tt.path, false)
+			if got != tt.ignored || source != tt.wantSource {
+				t.Errorf("Match(%q) = (%v, %q), want (%v, %q)", tt.path, got, source, tt.ignored, tt.wantSource)
+			}
+		})
+	}
+
+	if root.Len() != 1 {
+		t.Errorf("With() mutated the parent matcher: Len() = %d, want 1", root.Len())
+	}
+}
+
+func TestParseRule_SkipsBlankAndComments(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment", "/"} {
+		if _, ok := ParseRule(line, "", "test"); ok {
+			t.Errorf("ParseRule(%q) ok = true, want false", line)
+		}
+	}
+
+	rule, ok := ParseRule(`\#literal`, "", "test")
+	if !ok || rule.Pattern != "#literal" {
+		t.Errorf("ParseRule(`\\#literal`) = (%q, %v), want escaped pattern", rule.Pattern, ok)
+	}
+}
+
+func TestCompileRule(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr string
+	}{
+		{pattern: "generated/"},
+		{pattern: "/bazel-out"},
+		{pattern: "**/*.pb.go"},
+		{pattern: "/", wantErr: `invalid pattern "/": matches nothing`},
+		{pattern: "[z-a].go", wantErr: `invalid pattern "[z-a].go"`},
+	}
+	for _, tt := range tests {
+		_, err := CompileRule(tt.pattern, "", "test")
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("CompileRule(%q) error = %v", tt.pattern, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("CompileRule(%q) error = %v, want %q", tt.pattern, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+// Package nodedeps finds definitions in the npm packages a JavaScript or
+// TypeScript project depends on, for symbols like useQuery that are declared
+// in node_modules rather than in the project itself.
+//
+// Only the packages the nearest package.json lists are looked at, along with
+// their @types packages, since node_modules as a whole is far too big to
+// search. Within a package, its type declarations are read, entry points
+// first; a package that ships none is searched in its JavaScript instead.
+package nodedeps
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bashhack/cdx/internal/deps"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/symbols"
+)
+
+// Package is a dependency installed in node_modules.
+type Package struct {
+	Name    string
+	Version string
+	Dir     string
+	Entries []string // Type declaration entry points, slash-separated and relative to Dir
+}
+
+// Origin describes p as the package name and version.
+func (p Package) Origin() string {
+	if p.Version == "" {
+		return p.Name
+	}
+	return p.Name + "@" + p.Version
+}
+
+// manifest is the part of a package.json this package reads.
+type manifest struct {
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+	Exports              any               `json:"exports"`
+	Name                 string            `json:"name"`
+	Version              string            `json:"version"`
+	Types                string            `json:"types"`
+	Typings              string            `json:"typings"`
+}
+
+// readManifest reads the package.json in dir.
+func readManifest(dir string) (manifest, error) {
+	var m manifest
+	data, err := os.ReadFile(filepath.Join(dir, "package.json")) // #nosec G304 -- a package.json in the project or node_modules
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
+
+// Dependencies returns the installed packages that the nearest package.json
+// at or above dir depends on, along with their @types packages. Each is
+// looked for in node_modules beside the package.json and then in the
+// directories above it, as Node resolves them. Without a package.json
+// there are none; a dependency that isn't installed is left out.
+func Dependencies(dir string) ([]Package, error) {
+	root, ok := nearestManifest(dir)
+	if !ok {
+		return nil, nil
+	}
+	m, err := readManifest(root)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, deps := range []map[string]string{m.Dependencies, m.DevDependencies, m.PeerDependencies, m.OptionalDependencies} {
+		for name := range deps {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	var pkgs []Package
+	seen := make(map[string]bool) // By directory
+	for _, name := range names {
+		for _, n := range []string{name, typesPackage(name)} {
+			p, found := install(root, n)
+			if !found || seen[p.Dir] {
+				continue
+			}
+			seen[p.Dir] = true
+			pkgs = append(pkgs, p)
+		}
+	}
+	return pkgs, nil
+}
+
+// nearestManifest returns the closest directory at or above dir holding a
+// package.json.
+func nearestManifest(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "package.json")); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// typesPackage returns the name of the DefinitelyTyped package for name:
+// @types/name, or @types/scope__name for a scoped package.
+func typesPackage(name string) string {
+	if strings.HasPrefix(name, "@types/") {
+		return name
+	}
+	if scope, rest, ok := strings.Cut(strings.TrimPrefix(name, "@"), "/"); ok && strings.HasPrefix(name, "@") {
+		return "@types/" + scope + "__" + rest
+	}
+	return "@types/" + name
+}
+
+// install finds the package name in the node_modules of dir or a directory
+// above it.
+func install(dir, name string) (Package, bool) {
+	for {
+		pkgDir := filepath.Join(dir, "node_modules", filepath.FromSlash(name))
+		if m, err := readManifest(pkgDir); err == nil {
+			return Package{Name: name, Version: m.Version, Dir: pkgDir, Entries: entries(m)}, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return Package{}, false
+		}
+		dir = parent
+	}
+}
+
+// entries returns the declaration files a manifest names: types or typings,
+// then the types conditions of its exports. Wildcard subpath patterns name
+// no single file, so they're skipped.
+func entries(m manifest) []string {
+	var files []string
+	add := func(file string) {
+		file = path.Clean(strings.TrimPrefix(file, "./"))
+		if file != "." && !strings.Contains(file, "*") && isDeclaration(file) && !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+	}
+	add(m.Types)
+	add(m.Typings)
+	var walkExports func(v any, types bool)
+	walkExports = func(v any, types bool) {
+		switch v := v.(type) {
+		case string:
+			if types {
+				add(v)
+			}
+		case []any:
+			for _, e := range v {
+				walkExports(e, types)
+			}
+		case map[string]any:
+			for _, k := range slices.Sorted(maps.Keys(v)) {
+				walkExports(v[k], types || k == "types")
+			}
+		}
+	}
+	walkExports(m.Exports, false)
+	return files
+}
+
+// isDeclaration reports whether file is a TypeScript declaration file.
+func isDeclaration(file string) bool {
+	return strings.HasSuffix(file, ".d.ts") || strings.HasSuffix(file, ".d.mts") || strings.HasSuffix(file, ".d.cts")
+}
+
+// isScript reports whether file is a JavaScript source file.
+func isScript(file string) bool {
+	switch path.Ext(file) {
+	case ".js", ".mjs", ".cjs":
+		return true
+	}
+	return false
+}
+
+// sourceFiles returns the files of p to search, slash-separated and relative
+// to p.Dir: its entry points, then its other declaration files, or its
+// JavaScript when it has no declarations. Packages nested in its own
+// node_modules are its dependencies, not its source, so they're skipped.
+func sourceFiles(ctx context.Context, p Package) ([]string, error) {
+	var decls, scripts []string
+	err := filepath.WalkDir(p.Dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if d.IsDir() {
+			if d.Name() == "node_modules" && file != p.Dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(p.Dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case isDeclaration(rel):
+			decls = append(decls, rel)
+		case isScript(rel):
+			scripts = append(scripts, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(decls) == 0 {
+		return scripts, nil
+	}
+	var files []string
+	for _, e := range p.Entries {
+		if slices.Contains(decls, e) {
+			files = append(files, e)
+		}
+	}
+	for _, f := range decls {
+		if !slices.Contains(files, f) {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// Definitions returns the definitions of name in p, reading its files with
+// ex. With fold set, name matches case-insensitively.
+func Definitions(ctx context.Context, p Package, name string, ex symbols.Extractor, fold bool) ([]deps.Definition, error) {
+	files, err := sourceFiles(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	var defs []deps.Definition
+	for _, rel := range files {
+		if err := ctx.Err(); err != nil {
+			return defs, err
+		}
+		file := filepath.Join(p.Dir, filepath.FromSlash(rel))
+		src, err := os.ReadFile(file) // #nosec G304 -- a file in an installed package
+		if err != nil {
+			return nil, err
+		}
+		lang := patterns.JavaScript
+		if isDeclaration(rel) {
+			lang = patterns.TypeScript
+		}
+		syms, err := ex.Extract(src, lang)
+		if err != nil {
+			return nil, err
+		}
+		lines := strings.Split(string(src), "\n")
+		for _, s := range syms {
+			if s.Name != name && (!fold || !strings.EqualFold(s.Name, name)) {
+				continue
+			}
+			text := ""
+			if s.Line <= len(lines) {
+				text = strings.TrimSpace(lines[s.Line-1])
+			}
+			defs = append(defs, deps.Definition{
+				Path:     file,
+				Name:     s.Name,
+				Kind:     s.Kind,
+				Text:     text,
+				Package:  p.Name,
+				Version:  p.Version,
+				Origin:   p.Origin(),
+				Line:     s.Line,
+				Column:   s.Column,
+				External: true,
+			})
+		}
+	}
+	return defs, nil
+}
@@ -0,0 +1,134 @@
+package nodedeps
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/deps"
+	"github.com/bashhack/cdx/internal/symbols"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		// A workspace package, with some dependencies hoisted to the root
+		"packages/app/package.json": `{"dependencies": {"@tanstack/react-query": "^5", "react": "^18", "missing": "1"},
+			"devDependencies": {"lodash": "4"}, "peerDependencies": {"react": "^18"}}`,
+		"packages/app/src/index.ts": "",
+		"packages/app/node_modules/@tanstack/react-query/package.json": `{"name": "@tanstack/react-query", "version": "5.1.0",
+			"types": "./build/index.d.ts",
+			"exports": {".": {"import": {"types": "./build/modern/index.d.ts", "default": "./build/modern/index.js"}, "require": "./build/index.cjs"}, "./*": {"types": "./build/*.d.ts"}}}`,
+		"node_modules/react/package.json":            `{"name": "react", "version": "18.2.0", "main": "index.js"}`,
+		"node_modules/@types/react/package.json":     `{"name": "@types/react", "version": "18.2.1", "typings": "index.d.ts"}`,
+		"node_modules/lodash/package.json":           `{"name": "lodash", "version": "4.17.21"}`,
+		"node_modules/not-a-dependency/package.json": `{"name": "not-a-dependency"}`,
+		"package.json": `{"dependencies": {"not-a-dependency": "1"}}`,
+	})
+
+	got, err := Dependencies(filepath.Join(dir, "packages/app/src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Package{
+		{Name: "@tanstack/react-query", Version: "5.1.0", Dir: filepath.Join(dir, "packages/app/node_modules/@tanstack/react-query"),
+			Entries: []string{"build/index.d.ts", "build/modern/index.d.ts"}},
+		{Name: "lodash", Version: "4.17.21", Dir: filepath.Join(dir, "node_modules/lodash")},
+		{Name: "react", Version: "18.2.0", Dir: filepath.Join(dir, "node_modules/react")},
+		{Name: "@types/react", Version: "18.2.1", Dir: filepath.Join(dir, "node_modules/@types/react"), Entries: []string{"index.d.ts"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Dependencies() =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if got, err := Dependencies(t.TempDir()); err != nil || got != nil {
+		t.Errorf("Dependencies() without a package.json = %+v, %v, want none", got, err)
+	}
+}
+
+func TestTypesPackage(t *testing.T) {
+	tests := map[string]string{
+		"react":                 "@types/react",
+		"@tanstack/react-query": "@types/tanstack__react-query",
+		"@types/node":           "@types/node",
+	}
+	for name, want := range tests {
+		if got := typesPackage(name); got != want {
+			t.Errorf("typesPackage(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"typed/package.json":                `{"name": "typed", "version": "1.0.0"}`,
+		"typed/build/index.d.ts":            "export { useQuery } from './useQuery';\nexport declare class QueryClient {\n}\n",
+		"typed/build/useQuery.d.ts":         "export declare function useQuery<T>(options: Options<T>): Result<T>;\nexport declare function useQuery(key: string): Result<unknown>;\n",
+		"typed/build/useQuery.js":           "export function useQuery(options) {\n}\n",
+		"typed/node_modules/dep/index.d.ts": "export declare function useQuery(): void;\n",
+		"plain/lib/index.js":                "function useQuery(options) {\n}\nmodule.exports = { useQuery };\n",
+	})
+	typed := Package{Name: "typed", Version: "1.0.0", Dir: filepath.Join(dir, "typed"), Entries: []string{"build/useQuery.d.ts", "build/missing.d.ts"}}
+	plain := Package{Name: "plain", Dir: filepath.Join(dir, "plain")}
+	def := func(p Package, file, kind, text, name string, line, column int) deps.Definition {
+		return deps.Definition{Path: filepath.Join(p.Dir, filepath.FromSlash(file)), Name: name, Kind: kind, Text: text,
+			Package: p.Name, Version: p.Version, Origin: p.Origin(), Line: line, Column: column, External: true}
+	}
+
+	tests := []struct {
+		name string
+		want []deps.Definition
+		pkg  Package
+		fold bool
+	}{
+		// Declarations only, overloads and all; the JavaScript and the
+		// nested package are skipped
+		{pkg: typed, name: "useQuery", want: []deps.Definition{
+			def(typed, "build/useQuery.d.ts", "function", "export declare function useQuery<T>(options: Options<T>): Result<T>;", "useQuery", 1, 25),
+			def(typed, "build/useQuery.d.ts", "function", "export declare function useQuery(key: string): Result<unknown>;", "useQuery", 2, 25),
+		}},
+		{pkg: typed, name: "queryclient", fold: true, want: []deps.Definition{
+			def(typed, "build/index.d.ts", "type", "export declare class QueryClient {", "QueryClient", 2, 22),
+		}},
+		{pkg: typed, name: "queryclient"},
+		// Without declarations, the JavaScript is searched
+		{pkg: plain, name: "useQuery", want: []deps.Definition{
+			def(plain, "lib/index.js", "function", "function useQuery(options) {", "useQuery", 1, 10),
+		}},
+	}
+	for _, tt := range tests {
+		got, err := Definitions(context.Background(), tt.pkg, tt.name, symbols.Regex{}, tt.fold)
+		if err != nil {
+			t.Fatalf("Definitions(%s, %q) error = %v", tt.pkg.Name, tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Definitions(%s, %q) =\n%+v\nwant\n%+v", tt.pkg.Name, tt.name, got, tt.want)
+		}
+	}
+
+	// Entry points come first, and only those that exist
+	files, err := sourceFiles(context.Background(), typed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"build/useQuery.d.ts", "build/index.d.ts"}; !slices.Equal(files, want) {
+		t.Errorf("sourceFiles() = %q, want %q", files, want)
+	}
+}
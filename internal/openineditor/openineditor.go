@@ -0,0 +1,190 @@
+// Package openineditor builds and runs the command that opens a file at a
+// line in the user's editor.
+//
+// The editor comes from the editor config setting, a template such as
+// "code --goto {file}:{line}:{col}", or else from $VISUAL or $EDITOR. A bare
+// program name is looked up in a table of known editors' line-jump syntax;
+// an editor that isn't in the table is given just the file.
+package openineditor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrNoEditor is returned when no editor is configured or set in the
+// environment.
+var ErrNoEditor = errors.New("no editor configured: set editor in .cdx.yaml, $VISUAL, or $EDITOR")
+
+// Location is a position to open.
+type Location struct {
+	File   string
+	Line   int // 1-based; zero means the first line
+	Column int // 1-based; zero means the start of the line
+}
+
+// Editor is a resolved editor command.
+type Editor struct {
+	// Source says where the editor came from: "editor", "VISUAL", or "EDITOR"
+	Source string
+	// Base is the command and any arguments that precede the template, e.g.
+	// ["code", "-w"] from EDITOR="code -w"
+	Base []string
+	// Template holds the arguments naming the location, with {file},
+	// {line}, and {col} placeholders. Without {line}, the editor can't jump
+	// to a line.
+	Template []string
+}
+
+// known maps editor program names to the arguments that open a file at a
+// line and column.
+var known = map[string]string{
+	"vi":            "+{line} {file}",
+	"vim":           "+{line} {file}",
+	"nvim":          "+{line} {file}",
+	"gvim":          "+{line} {file}",
+	"mvim":          "+{line} {file}",
+	"nano":          "+{line},{col} {file}",
+	"micro":         "+{line}:{col} {file}",
+	"kak":           "+{line}:{col} {file}",
+	"emacs":         "+{line}:{col} {file}",
+	"emacsclient":   "+{line}:{col} {file}",
+	"hx":            "{file}:{line}:{col}",
+	"helix":         "{file}:{line}:{col}",
+	"subl":          "{file}:{line}:{col}",
+	"zed":           "{file}:{line}:{col}",
+	"code":          "--goto {file}:{line}:{col}",
+	"code-insiders": "--goto {file}:{line}:{col}",
+	"codium":        "--goto {file}:{line}:{col}",
+	"cursor":        "--goto {file}:{line}:{col}",
+	"mate":          "-l {line}:{col} {file}",
+	"idea":          "--line {line} --column {col} {file}",
+	"goland":        "--line {line} --column {col} {file}",
+	"pycharm":       "--line {line} --column {col} {file}",
+	"webstorm":      "--line {line} --column {col} {file}",
+}
+
+// placeholder matches a template placeholder.
+var placeholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// Validate checks an editor setting's placeholders, so a typo is reported
+// when the config loads rather than when an editor is launched.
+func Validate(setting string) error {
+	for _, p := range placeholder.FindAllString(setting, -1) {
+		switch p {
+		case "{file}", "{line}", "{col}":
+		default:
+			return fmt.Errorf("unknown placeholder %s (want {file}, {line}, or {col})", p)
+		}
+	}
+	return nil
+}
+
+// Resolve returns the editor to use: setting when it isn't empty, otherwise
+// $VISUAL, otherwise $EDITOR.
+func Resolve(setting string) (Editor, error) {
+	return resolve(setting, os.Getenv)
+}
+
+func resolve(setting string, getenv func(string) string) (Editor, error) {
+	source := "editor"
+	if strings.TrimSpace(setting) == "" {
+		for _, name := range []string{"VISUAL", "EDITOR"} {
+			if setting = getenv(name); strings.TrimSpace(setting) != "" {
+				source = name
+				break
+			}
+		}
+	}
+	fields := strings.Fields(setting)
+	if len(fields) == 0 {
+		return Editor{}, ErrNoEditor
+	}
+	if err := Validate(setting); err != nil {
+		return Editor{}, fmt.Errorf("%s: %w", source, err)
+	}
+
+	// A setting with placeholders spells out its own arguments
+	for i, f := range fields {
+		if placeholder.MatchString(f) {
+			if i == 0 {
+				return Editor{}, fmt.Errorf("%s: %q starts with a placeholder instead of the editor program", source, setting)
+			}
+			return Editor{Base: fields[:i], Template: fields[i:], Source: source}, nil
+		}
+	}
+	e := Editor{Base: fields, Template: []string{"{file}"}, Source: source}
+	if tmpl, ok := known[programName(fields[0])]; ok {
+		e.Template = strings.Fields(tmpl)
+	}
+	return e, nil
+}
+
+// programName returns the editor's name for the known table, without its
+// directory or a Windows .exe suffix. Both separators are stripped, so a
+// Windows path in $EDITOR resolves the same on any platform.
+func programName(path string) string {
+	name := path[strings.LastIndexAny(path, `/\`)+1:]
+	return strings.TrimSuffix(strings.ToLower(name), ".exe")
+}
+
+// JumpsToLine reports whether the editor can open a file at a line.
+func (e Editor) JumpsToLine() bool {
+	for _, arg := range e.Template {
+		if strings.Contains(arg, "{line}") {
+			return true
+		}
+	}
+	return false
+}
+
+// Args returns the argv that opens loc. A zero line or column becomes 1,
+// since every editor's syntax needs a number there.
+func (e Editor) Args(loc Location) []string {
+	line, col := strconv.Itoa(max(loc.Line, 1)), strconv.Itoa(max(loc.Column, 1))
+	args := append([]string{}, e.Base...)
+	for _, arg := range e.Template {
+		arg = placeholder.ReplaceAllStringFunc(arg, func(p string) string {
+			switch p {
+			case "{file}":
+				return loc.File
+			case "{line}":
+				return line
+			case "{col}":
+				return col
+			}
+			return p
+		})
+		args = append(args, arg)
+	}
+	return args
+}
+
+// Warning returns the note to show before opening with an editor that can't
+// jump to a line, or "" when it can.
+func (e Editor) Warning() string {
+	if e.JumpsToLine() {
+		return ""
+	}
+	return fmt.Sprintf("%s doesn't support jumping to a line; set editor in .cdx.yaml to a template with {line}", e.Base[0])
+}
+
+// Open runs the editor on loc attached to the terminal and waits for it to
+// exit.
+func (e Editor) Open(ctx context.Context, loc Location) error {
+	args := e.Args(loc)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) // #nosec G204 -- the user's own editor setting
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %s: %w", args[0], err)
+	}
+	return nil
+}
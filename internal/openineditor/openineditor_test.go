@@ -0,0 +1,152 @@
+package openineditor
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestArgs_KnownEditors(t *testing.T) {
+	loc := Location{File: "src/main.go", Line: 42, Column: 7}
+	tests := []struct {
+		editor string
+		want   []string
+	}{
+		{"vi", []string{"vi", "+42", "src/main.go"}},
+		{"vim", []string{"vim", "+42", "src/main.go"}},
+		{"nvim", []string{"nvim", "+42", "src/main.go"}},
+		{"gvim", []string{"gvim", "+42", "src/main.go"}},
+		{"mvim", []string{"mvim", "+42", "src/main.go"}},
+		{"nano", []string{"nano", "+42,7", "src/main.go"}},
+		{"micro", []string{"micro", "+42:7", "src/main.go"}},
+		{"kak", []string{"kak", "+42:7", "src/main.go"}},
+		{"emacs", []string{"emacs", "+42:7", "src/main.go"}},
+		{"emacsclient", []string{"emacsclient", "+42:7", "src/main.go"}},
+		{"hx", []string{"hx", "src/main.go:42:7"}},
+		{"helix", []string{"helix", "src/main.go:42:7"}},
+		{"subl", []string{"subl", "src/main.go:42:7"}},
+		{"zed", []string{"zed", "src/main.go:42:7"}},
+		{"code", []string{"code", "--goto", "src/main.go:42:7"}},
+		{"code-insiders", []string{"code-insiders", "--goto", "src/main.go:42:7"}},
+		{"codium", []string{"codium", "--goto", "src/main.go:42:7"}},
+		{"cursor", []string{"cursor", "--goto", "src/main.go:42:7"}},
+		{"mate", []string{"mate", "-l", "42:7", "src/main.go"}},
+		{"idea", []string{"idea", "--line", "42", "--column", "7", "src/main.go"}},
+		{"goland", []string{"goland", "--line", "42", "--column", "7", "src/main.go"}},
+		{"pycharm", []string{"pycharm", "--line", "42", "--column", "7", "src/main.go"}},
+		{"webstorm", []string{"webstorm", "--line", "42", "--column", "7", "src/main.go"}},
+	}
+
+	if len(tests) != len(known) {
+		t.Fatalf("%d editors tested, want all %d known editors", len(tests), len(known))
+	}
+	for _, tt := range tests {
+		t.Run(tt.editor, func(t *testing.T) {
+			e, err := Resolve(tt.editor)
+			if err != nil {
+				t.Fatalf("Resolve(%q) error = %v", tt.editor, err)
+			}
+			if got := e.Args(loc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Args() = %q, want %q", got, tt.want)
+			}
+			if !e.JumpsToLine() || e.Warning() != "" {
+				t.Errorf("JumpsToLine() = %v, Warning() = %q, want a line jump", e.JumpsToLine(), e.Warning())
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	loc := Location{File: "my dir/app.py", Line: 3}
+	tests := []struct {
+		env        map[string]string
+		name       string
+		setting    string
+		wantSource string
+		wantErr    string
+		want       []string
+		wantJump   bool
+	}{
+		{
+			name:       "template",
+			setting:    "code --wait --goto {file}:{line}:{col}",
+			want:       []string{"code", "--wait", "--goto", "my dir/app.py:3:1"},
+			wantSource: "editor",
+			wantJump:   true,
+		},
+		{
+			name:       "setting beats environment",
+			setting:    "nvim",
+			env:        map[string]string{"VISUAL": "code", "EDITOR": "vim"},
+			want:       []string{"nvim", "+3", "my dir/app.py"},
+			wantSource: "editor",
+			wantJump:   true,
+		},
+		{
+			name:       "VISUAL beats EDITOR",
+			env:        map[string]string{"VISUAL": "code -w", "EDITOR": "vim"},
+			want:       []string{"code", "-w", "--goto", "my dir/app.py:3:1"},
+			wantSource: "VISUAL",
+			wantJump:   true,
+		},
+		{
+			name:       "EDITOR with a path",
+			env:        map[string]string{"EDITOR": "/usr/local/bin/hx"},
+			want:       []string{"/usr/local/bin/hx", "my dir/app.py:3:1"},
+			wantSource: "EDITOR",
+			wantJump:   true,
+		},
+		{
+			name:       "Windows executable",
+			env:        map[string]string{"EDITOR": `C:\Tools\Nano.exe`},
+			want:       []string{`C:\Tools\Nano.exe`, "+3,1", "my dir/app.py"},
+			wantSource: "EDITOR",
+			wantJump:   true,
+		},
+		{
+			name:       "unknown editor opens the file",
+			env:        map[string]string{"EDITOR": "ed"},
+			want:       []string{"ed", "my dir/app.py"},
+			wantSource: "EDITOR",
+		},
+		{name: "nothing set", wantErr: ErrNoEditor.Error()},
+		{name: "unknown placeholder", setting: "vim +{row} {file}", wantErr: "editor: unknown placeholder {row}"},
+		{name: "no program", setting: "{file}", wantErr: "starts with a placeholder"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := resolve(tt.setting, func(name string) string { return tt.env[name] })
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolve() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolve() error = %v", err)
+			}
+			if got := e.Args(loc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Args() = %q, want %q", got, tt.want)
+			}
+			if e.Source != tt.wantSource {
+				t.Errorf("Source = %q, want %q", e.Source, tt.wantSource)
+			}
+			if e.JumpsToLine() != tt.wantJump {
+				t.Errorf("JumpsToLine() = %v, want %v", e.JumpsToLine(), tt.wantJump)
+			}
+			if warned := e.Warning() != ""; warned == tt.wantJump {
+				t.Errorf("Warning() = %q with JumpsToLine() = %v", e.Warning(), tt.wantJump)
+			}
+		})
+	}
+}
+
+func TestResolve_NoEditor(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+	if _, err := Resolve(""); !errors.Is(err, ErrNoEditor) {
+		t.Errorf("Resolve() error = %v, want ErrNoEditor", err)
+	}
+}
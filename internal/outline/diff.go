@@ -0,0 +1,86 @@
+package outline
+
+import "github.com/bashhack/cdx/internal/patterns"
+
+// Changes are the differences between two outlines of a file.
+type Changes struct {
+	Added   []Delta `json:"added"`   // In the new outline only, in its order
+	Removed []Delta `json:"removed"` // In the old outline only, in its order
+	Changed []Delta `json:"changed"` // In both, over different lines
+}
+
+// Delta is a definition that was added, removed, or moved or resized.
+type Delta struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`   // One of the Kind constants, as in a Document
+	Parent string `json:"parent"` // As in a Document
+	// Line and EndLine are where the definition is in the new outline, or
+	// for a removed one, the old
+	Line    int `json:"line"`
+	EndLine int `json:"end_line"`
+	// OldLine and OldEndLine are where a changed definition was
+	OldLine    int `json:"old_line,omitempty"`
+	OldEndLine int `json:"old_end_line,omitempty"`
+}
+
+// Diff compares from and to, old and new outlines of a file in lang.
+// Definitions are matched by name and parent, the nth of a name in from with
+// the nth in to; a renamed definition is removed and added. Types that only
+// hold members defined in another file aren't definitions and aren't
+// compared, though their members are.
+func Diff(from, to []*Node, lang patterns.Language) Changes {
+	changes := Changes{Added: []Delta{}, Removed: []Delta{}, Changed: []Delta{}}
+	type key struct{ parent, name string }
+	before := make(map[key][]*Node)
+	for _, n := range Flatten(from) {
+		k := key{n.Parent, n.Name}
+		before[k] = append(before[k], n)
+	}
+
+	matched := make(map[*Node]bool)
+	for _, n := range Flatten(to) {
+		k := key{n.Parent, n.Name}
+		d := delta(n, lang)
+		prev := before[k]
+		if len(prev) == 0 {
+			changes.Added = append(changes.Added, d)
+			continue
+		}
+		o := prev[0]
+		before[k] = prev[1:]
+		matched[o] = true
+		if o.Line != n.Line || o.EndLine != n.EndLine {
+			d.OldLine, d.OldEndLine = o.Line, o.EndLine
+			changes.Changed = append(changes.Changed, d)
+		}
+	}
+	for _, o := range Flatten(from) {
+		if !matched[o] {
+			changes.Removed = append(changes.Removed, delta(o, lang))
+		}
+	}
+	return changes
+}
+
+func delta(n *Node, lang patterns.Language) Delta {
+	return Delta{
+		Name:    n.Name,
+		Kind:    documentKind(n, lang),
+		Parent:  n.Parent,
+		Line:    n.Line,
+		EndLine: n.EndLine,
+	}
+}
+
+// Flatten lists the definitions in nodes, each before its children, leaving
+// out the stand-ins for types defined elsewhere.
+func Flatten(nodes []*Node) []*Node {
+	var list []*Node
+	for _, n := range nodes {
+		if n.Line > 0 {
+			list = append(list, n)
+		}
+		list = append(list, Flatten(n.Children)...)
+	}
+	return list
+}
@@ -0,0 +1,44 @@
+package outline
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/symbols"
+)
+
+func TestDiff(t *testing.T) {
+	outline := func(src string) []*Node {
+		t.Helper()
+		syms, err := symbols.ExtractSource(symbols.Regex{}, []byte(src), patterns.Go, ".go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		symbols.FillExtents(syms, []byte(src), patterns.Go)
+		return Build(syms, []byte(src), patterns.Go)
+	}
+	from := outline("package store\n\ntype Store struct{}\n\nfunc (s *Store) Get() {}\n\nfunc (s *Store) load() {}\n\nfunc Open() {}\n")
+	to := outline("package store\n\ntype Store struct{}\n\nfunc (s *Store) Get() {\n\treturn\n}\n\n// Open opens.\nfunc Open() {}\n\nfunc Close() {}\n")
+
+	got := Diff(from, to, patterns.Go)
+	want := Changes{
+		Added:   []Delta{{Name: "Close", Kind: KindFunction, Line: 12, EndLine: 12}},
+		Removed: []Delta{{Name: "load", Kind: KindMethod, Parent: "Store", Line: 7, EndLine: 7}},
+		Changed: []Delta{
+			{Name: "Get", Kind: KindMethod, Parent: "Store", Line: 5, EndLine: 7, OldLine: 5, OldEndLine: 5},
+			{Name: "Open", Kind: KindFunction, Line: 10, EndLine: 10, OldLine: 9, OldEndLine: 9},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// Everything is added when there's no old version
+	if got := Diff(nil, to, patterns.Go); len(got.Added) != 4 || len(got.Removed) != 0 || len(got.Changed) != 0 {
+		t.Errorf("Diff(nil) = %+v, want all 4 definitions added", got)
+	}
+	if got := Diff(to, to, patterns.Go); len(got.Added)+len(got.Removed)+len(got.Changed) != 0 {
+		t.Errorf("Diff(same) = %+v, want no changes", got)
+	}
+}
@@ -0,0 +1,126 @@
+package outline
+
+import (
+	"regexp"
+
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+// SchemaVersion identifies the shape of Document. It changes only when a
+// field is removed or changes meaning; fields can be added without a change.
+const SchemaVersion = 1
+
+// Kinds of definition in a Document, a fixed vocabulary named after the
+// nearest LSP SymbolKind so an editor can reuse its icons.
+const (
+	KindClass       = "class"
+	KindStruct      = "struct"
+	KindEnum        = "enum"
+	KindInterface   = "interface"
+	KindType        = "type" // A type alias or other named type; LSP's nearest is TypeParameter
+	KindFunction    = "function"
+	KindMethod      = "method"
+	KindConstructor = "constructor"
+	KindNamespace   = "namespace"
+	KindConstant    = "constant"
+	KindVariable    = "variable"
+	KindOther       = "other" // Anything else, such as the kinds of custom patterns
+)
+
+// Document is a file's outline in the stable JSON shape that editor plugins
+// and other tools can rely on. Every key is always present, except metrics,
+// which is there only when the outline was measured.
+type Document struct {
+	File          string            `json:"file"`
+	Language      patterns.Language `json:"language"`
+	Symbols       []Entry           `json:"symbols"`
+	SchemaVersion int               `json:"schema_version"`
+}
+
+// Entry is one definition in a Document.
+type Entry struct {
+	Name      string  `json:"name"`
+	Kind      string  `json:"kind"`      // One of the Kind constants
+	Parent    string  `json:"parent"`    // The name of the entry this one is among the children of, or ""
+	Signature string  `json:"signature"` // See Node.Signature
+	Doc       string  `json:"doc"`       // See Node.Doc; "" when there's no doc comment
+	Children  []Entry `json:"children"`
+	Line      int     `json:"line"`             // 0 for a type defined in another file, holding its members here
+	Column    int     `json:"column"`           // 1-based byte column of the name
+	EndLine   int     `json:"end_line"`         // 0 when unknown
+	Lines     int     `json:"lines"`            // 0 when unknown
+	Metrics   Metrics `json:"metrics,omitzero"` // See Measure
+	Exported  bool    `json:"exported"`
+}
+
+var (
+	structLine = regexp.MustCompile(`\b(?:def)?struct\b`)
+	classLine  = regexp.MustCompile(`\bclass\b`)
+	enumLine   = regexp.MustCompile(`\benum\b`)
+)
+
+// NewDocument returns the Document for nodes, the outline of file, which is
+// written in lang.
+func NewDocument(file string, lang patterns.Language, nodes []*Node) Document {
+	return Document{
+		File:          file,
+		Language:      lang,
+		Symbols:       entries(nodes, lang),
+		SchemaVersion: SchemaVersion,
+	}
+}
+
+func entries(nodes []*Node, lang patterns.Language) []Entry {
+	list := make([]Entry, 0, len(nodes))
+	for _, n := range nodes {
+		list = append(list, Entry{
+			Name:      n.Name,
+			Kind:      documentKind(n, lang),
+			Parent:    n.Parent,
+			Signature: n.Signature,
+			Doc:       n.Doc,
+			Children:  entries(n.Children, lang),
+			Metrics:   n.Metrics,
+			Line:      n.Line,
+			Column:    n.Column,
+			EndLine:   n.EndLine,
+			Lines:     n.Lines,
+			Exported:  n.Exported,
+		})
+	}
+	return list
+}
+
+// documentKind maps a definition's kind onto the Document vocabulary, using
+// its signature to tell a class, struct, or enum from other types.
+func documentKind(n *Node, lang patterns.Language) string {
+	switch n.Kind {
+	case "function", "component", "private":
+		return KindFunction
+	case "method":
+		if n.Name == "constructor" || n.Name == "__init__" || n.Name == "__construct" || ((lang == patterns.Rust || lang == patterns.Lua) && n.Name == "new") ||
+			(lang == patterns.Ruby && n.Name == "initialize") || ((lang == patterns.Swift || lang == patterns.Zig) && n.Name == "init") || ((lang == patterns.Cpp || lang == patterns.CSharp) && n.Name == n.Parent) {
+			return KindConstructor
+		}
+		return KindMethod
+	case "interface":
+		return KindInterface
+	case "namespace":
+		return KindNamespace
+	case "const", "macro":
+		return KindConstant
+	case "var":
+		return KindVariable
+	case "type":
+		switch {
+		case enumLine.MatchString(n.Signature):
+			return KindEnum
+		case structLine.MatchString(n.Signature):
+			return KindStruct
+		case classLine.MatchString(n.Signature) || lang == patterns.Python:
+			return KindClass
+		}
+		return KindType
+	}
+	return KindOther
+}
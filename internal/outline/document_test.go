@@ -0,0 +1,137 @@
+package outline
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/symbols"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// document returns the Document for src, named file, as cdx outline builds it.
+func document(t *testing.T, file string, src []byte, lang patterns.Language) Document {
+	t.Helper()
+	syms, err := symbols.ExtractSource(symbols.Regex{}, src, lang, filepath.Ext(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	symbols.FillExtents(syms, src, lang)
+	return NewDocument(file, lang, Build(syms, src, lang))
+}
+
+func TestDocumentGolden(t *testing.T) {
+	for _, file := range []string{"user.go", "user_cache.go", "handlers.ts", "utils.js", "utils.py", "user.rs"} {
+		t.Run(file, func(t *testing.T) {
+			src, err := os.ReadFile(filepath.Join("..", "..", "testdata", "sample-project", file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc := document(t, file, src, patterns.DetectLanguage(filepath.Ext(file)))
+			got, err := json.MarshalIndent(doc, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", file+".json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("document for %s differs from %s (run go test -update to accept):\n%s", file, golden, got)
+			}
+		})
+	}
+}
+
+func TestDocumentEmpty(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"empty file", ""},
+		{"no definitions", "package main\n\n// Just a comment\nimport \"fmt\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(document(t, "main.go", []byte(tt.src), patterns.Go))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := `{"file":"main.go","language":"go","symbols":[],"schema_version":1}`
+			if string(got) != want {
+				t.Errorf("document = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestDocumentKind(t *testing.T) {
+	tests := []struct {
+		lang patterns.Language
+		want string
+		node Node
+	}{
+		{patterns.Go, KindStruct, Node{Symbol: symbols.Symbol{Name: "User", Kind: "type"}, Signature: "type User struct"}},
+		{patterns.Go, KindType, Node{Symbol: symbols.Symbol{Name: "ID", Kind: "type"}, Signature: "type ID int"}},
+		{patterns.TypeScript, KindClass, Node{Symbol: symbols.Symbol{Name: "App", Kind: "type"}, Signature: "export class App"}},
+		{patterns.TypeScript, KindEnum, Node{Symbol: symbols.Symbol{Name: "Role", Kind: "type"}, Signature: "export enum Role"}},
+		{patterns.Python, KindClass, Node{Symbol: symbols.Symbol{Name: "User", Kind: "type"}, Signature: "class User"}},
+		{patterns.Rust, KindEnum, Node{Symbol: symbols.Symbol{Name: "Role", Kind: "type"}, Signature: "pub enum Role"}},
+		{patterns.Rust, KindInterface, Node{Symbol: symbols.Symbol{Name: "Repo", Kind: "interface"}}},
+		{patterns.Rust, KindConstructor, Node{Symbol: symbols.Symbol{Name: "new", Kind: "method"}}},
+		{patterns.Go, KindMethod, Node{Symbol: symbols.Symbol{Name: "new", Kind: "method"}}},
+		{patterns.Python, KindConstructor, Node{Symbol: symbols.Symbol{Name: "__init__", Kind: "method"}}},
+		{patterns.Go, KindConstant, Node{Symbol: symbols.Symbol{Name: "Max", Kind: "const"}}},
+		{patterns.C, KindStruct, Node{Symbol: symbols.Symbol{Name: "user", Kind: "type"}, Signature: "typedef struct user"}},
+		{patterns.C, KindConstant, Node{Symbol: symbols.Symbol{Name: "MAX_USERS", Kind: "macro"}, Signature: "#define MAX_USERS 100"}},
+		{patterns.Cpp, KindConstructor, Node{Symbol: symbols.Symbol{Name: "Widget", Kind: "method", Parent: "Widget"}}},
+		{patterns.Cpp, KindMethod, Node{Symbol: symbols.Symbol{Name: "~Widget", Kind: "method", Parent: "Widget"}}},
+		{patterns.Cpp, KindNamespace, Node{Symbol: symbols.Symbol{Name: "shapes", Kind: "namespace"}, Signature: "namespace shapes"}},
+		{patterns.Ruby, KindConstructor, Node{Symbol: symbols.Symbol{Name: "initialize", Kind: "method"}}},
+		{patterns.Ruby, KindClass, Node{Symbol: symbols.Symbol{Name: "Cart", Kind: "type"}, Signature: "class Cart < Base"}},
+		{patterns.Ruby, KindNamespace, Node{Symbol: symbols.Symbol{Name: "Shop", Kind: "namespace"}, Signature: "module Shop"}},
+		{patterns.PHP, KindConstructor, Node{Symbol: symbols.Symbol{Name: "__construct", Kind: "method"}}},
+		{patterns.PHP, KindInterface, Node{Symbol: symbols.Symbol{Name: "Repository", Kind: "interface"}, Signature: "interface Repository"}},
+		{patterns.Kotlin, KindClass, Node{Symbol: symbols.Symbol{Name: "User", Kind: "type"}, Signature: "data class User(val id: Long)"}},
+		{patterns.Kotlin, KindEnum, Node{Symbol: symbols.Symbol{Name: "Color", Kind: "type"}, Signature: "enum class Color"}},
+		{patterns.Swift, KindConstructor, Node{Symbol: symbols.Symbol{Name: "init", Kind: "method"}}},
+		{patterns.Swift, KindStruct, Node{Symbol: symbols.Symbol{Name: "Point", Kind: "type"}, Signature: "public struct Point"}},
+		{patterns.Swift, KindInterface, Node{Symbol: symbols.Symbol{Name: "Repository", Kind: "interface"}, Signature: "protocol Repository"}},
+		{patterns.CSharp, KindConstructor, Node{Symbol: symbols.Symbol{Name: "UserService", Kind: "method", Parent: "UserService"}}},
+		{patterns.CSharp, KindClass, Node{Symbol: symbols.Symbol{Name: "UserService", Kind: "type"}, Signature: "public class UserService"}},
+		{patterns.Scala, KindClass, Node{Symbol: symbols.Symbol{Name: "User", Kind: "type"}, Signature: "final case class User(id: Long)"}},
+		{patterns.Scala, KindInterface, Node{Symbol: symbols.Symbol{Name: "Repository", Kind: "interface"}, Signature: "trait Repository"}},
+		{patterns.Elixir, KindFunction, Node{Symbol: symbols.Symbol{Name: "normalize", Kind: "private"}, Signature: "defp normalize(email) do"}},
+		{patterns.Elixir, KindStruct, Node{Symbol: symbols.Symbol{Name: "defstruct", Kind: "type"}, Signature: "defstruct [:name, :email]"}},
+		{patterns.Elixir, KindNamespace, Node{Symbol: symbols.Symbol{Name: "Accounts", Kind: "namespace"}, Signature: "defmodule MyApp.Accounts do"}},
+		{patterns.Zig, KindStruct, Node{Symbol: symbols.Symbol{Name: "Point", Kind: "type"}, Signature: "pub const Point = struct"}},
+		{patterns.Zig, KindEnum, Node{Symbol: symbols.Symbol{Name: "Color", Kind: "type"}, Signature: "pub const Color = enum(u8)"}},
+		{patterns.Zig, KindConstructor, Node{Symbol: symbols.Symbol{Name: "init", Kind: "method"}, Signature: "pub fn init() Self"}},
+		{patterns.Lua, KindConstructor, Node{Symbol: symbols.Symbol{Name: "new", Kind: "method"}, Signature: "function Stack.new(items)"}},
+		{patterns.Lua, KindMethod, Node{Symbol: symbols.Symbol{Name: "push", Kind: "method"}, Signature: "function Stack:push(item)"}},
+		{patterns.Go, KindVariable, Node{Symbol: symbols.Symbol{Name: "Default", Kind: "var"}}},
+		{patterns.Go, KindOther, Node{Symbol: symbols.Symbol{Name: "route", Kind: "route"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.node.Name+"/"+string(tt.lang), func(t *testing.T) {
+			if got := documentKind(&tt.node, tt.lang); got != tt.want {
+				t.Errorf("documentKind(%s %s) = %q, want %q", tt.node.Kind, tt.node.Name, got, tt.want)
+			}
+		})
+	}
+}
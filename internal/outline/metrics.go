@@ -0,0 +1,136 @@
+package outline
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/scan"
+)
+
+// Metrics are rough measures of a definition's size and complexity, for
+// spotting the outsized ones in review. They're heuristics read off the
+// source text, not a parse.
+type Metrics struct {
+	Lines int `json:"lines"`
+	// Depth is how deeply blocks nest in the body: 0 for a body without
+	// blocks, 1 with an if in it, 2 with a loop in that, and so on
+	Depth int `json:"depth"`
+	// Branches counts the keywords in the language's Branches list, such
+	// as if, for, and case
+	Branches int `json:"branches"`
+}
+
+// notKeyword matches the rest of a line after a word that can't be a
+// keyword starting a statement or expression, as when a soft keyword such as
+// Python's match is a variable's name.
+var notKeyword = regexp.MustCompile(`^\s*(?:=[^=]|=$|[),.;\]}]|$)`)
+
+// Measure sets the Metrics of nodes and their children, definitions in src,
+// which is in lang, whose extents are known.
+func Measure(nodes []*Node, src []byte, lang patterns.Language) {
+	var code []string
+	lx := patterns.NewLexer(lang)
+	for _, line := range scan.Lines(src) {
+		code = append(code, codeOnly(line, lx.Line(line)))
+	}
+	var branches *regexp.Regexp
+	if lp := patterns.ForLanguage(lang); lp != nil && len(lp.Branches) > 0 {
+		branches = regexp.MustCompile(`\b(?:` + strings.Join(lp.Branches, "|") + `)\b`)
+	}
+
+	var measure func([]*Node)
+	measure = func(nodes []*Node) {
+		for _, n := range nodes {
+			if n.Line > 0 && n.EndLine >= n.Line && n.EndLine <= len(code) {
+				body := code[n.Line-1 : n.EndLine]
+				m := Metrics{Lines: len(body), Branches: countBranches(body, branches)}
+				if lang == patterns.Python {
+					m.Depth = indentDepth(body)
+				} else {
+					m.Depth = braceDepth(body)
+				}
+				n.Metrics = m
+			}
+			measure(n.Children)
+		}
+	}
+	measure(nodes)
+}
+
+// codeOnly returns line with everything but code, as ctx classifies it,
+// blanked out.
+func codeOnly(line string, ctx patterns.LineContext) string {
+	b := []byte(line)
+	for i := range b {
+		if ctx.At(i) != patterns.Code {
+			b[i] = ' '
+		}
+	}
+	return string(b)
+}
+
+// countBranches counts the matches of keywords in body, leaving out fields,
+// as in x.match, and names used as values.
+func countBranches(body []string, keywords *regexp.Regexp) int {
+	if keywords == nil {
+		return 0
+	}
+	count := 0
+	for _, line := range body {
+		for _, loc := range keywords.FindAllStringIndex(line, -1) {
+			if loc[0] > 0 && line[loc[0]-1] == '.' || notKeyword.MatchString(line[loc[1]:]) {
+				continue
+			}
+			count++
+		}
+	}
+	return count
+}
+
+// braceDepth returns how deeply braces nest in body below the outermost
+// pair, the definition's own.
+func braceDepth(body []string) int {
+	depth, deepest := 0, 0
+	for _, line := range body {
+		for i := 0; i < len(line); i++ {
+			switch line[i] {
+			case '{':
+				depth++
+				deepest = max(deepest, depth)
+			case '}':
+				depth--
+			}
+		}
+	}
+	return max(deepest-1, 0)
+}
+
+// indentDepth returns how many levels of indentation body, a Python
+// definition, has beyond the first level of its body. Lines continuing a
+// bracketed expression don't count.
+func indentDepth(body []string) int {
+	base := indent(body[0])
+	var levels []int // Indentation of each open level, innermost last
+	brackets, deepest := 0, 0
+	for i, line := range body {
+		open := brackets
+		brackets += strings.Count(line, "(") + strings.Count(line, "[") + strings.Count(line, "{") -
+			strings.Count(line, ")") - strings.Count(line, "]") - strings.Count(line, "}")
+		if i == 0 || open > 0 || strings.TrimSpace(line) == "" {
+			continue
+		}
+		n := indent(line)
+		if n <= base {
+			continue
+		}
+		for len(levels) > 0 && levels[len(levels)-1] > n {
+			levels = levels[:len(levels)-1]
+		}
+		if len(levels) == 0 || levels[len(levels)-1] < n {
+			levels = append(levels, n)
+		}
+		deepest = max(deepest, len(levels))
+	}
+	return max(deepest-1, 0)
+}
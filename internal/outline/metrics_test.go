@@ -0,0 +1,101 @@
+package outline
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/symbols"
+)
+
+func TestMeasure(t *testing.T) {
+	tests := []struct {
+		want map[string]Metrics
+		name string
+		file string
+		src  string
+	}{
+		{
+			name: "go",
+			file: "x.go",
+			src: "package x\n\nfunc flat() {\n\treturn\n}\n\n" +
+				"func nested(xs []int) {\n\tfor _, x := range xs {\n\t\tif x > 0 {\n\t\t\tswitch x {\n\t\t\tcase 1:\n\t\t\t\t// if in a comment\n\t\t\t\ts := \"for in a string\"\n\t\t\t\t_ = s\n\t\t\t}\n\t\t}\n\t}\n}\n",
+			want: map[string]Metrics{
+				"flat":   {Lines: 3, Depth: 0, Branches: 0},
+				"nested": {Lines: 12, Depth: 3, Branches: 4},
+			},
+		},
+		{
+			name: "python",
+			file: "x.py",
+			src:  "def check(items,\n          strict=False):\n    match = None\n    for item in items:\n        if item:\n            match = re.match(item)\n        elif strict:\n            raise ValueError(\n                \"if\",\n            )\n    return match\n",
+			want: map[string]Metrics{
+				"check": {Lines: 11, Depth: 2, Branches: 3},
+			},
+		},
+		{
+			name: "typescript",
+			file: "x.ts",
+			src:  "export class Cart {\n  add(item: Item) {\n    while (this.full()) {\n      this.drop();\n    }\n  }\n}\n",
+			want: map[string]Metrics{
+				"Cart": {Lines: 7, Depth: 2, Branches: 1},
+				"add":  {Lines: 5, Depth: 1, Branches: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lang := patterns.DetectLanguage(filepath.Ext(tt.file))
+			src := []byte(tt.src)
+			syms, err := symbols.ExtractSource(symbols.Regex{}, src, lang, filepath.Ext(tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			symbols.FillExtents(syms, src, lang)
+			nodes := Build(syms, src, lang)
+			Measure(nodes, src, lang)
+			got := make(map[string]Metrics)
+			for _, n := range Flatten(nodes) {
+				got[n.Name] = n.Metrics
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("%s metrics = %+v, want %+v", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestSortByMetric(t *testing.T) {
+	nodes := []*Node{
+		{Symbol: symbols.Symbol{Name: "small"}, Metrics: Metrics{Lines: 3, Branches: 4}},
+		{Symbol: symbols.Symbol{Name: "unmeasured"}},
+		{Symbol: symbols.Symbol{Name: "big"}, Metrics: Metrics{Lines: 40, Depth: 2, Branches: 1}},
+		{Symbol: symbols.Symbol{Name: "tie"}, Metrics: Metrics{Lines: 3}},
+	}
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{ByLines, []string{"big", "small", "tie", "unmeasured"}},
+		{ByDepth, []string{"big", "small", "unmeasured", "tie"}},
+		{ByBranches, []string{"small", "big", "unmeasured", "tie"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			sorted := slices.Clone(nodes)
+			Sort(sorted, tt.order)
+			var got []string
+			for _, n := range sorted {
+				got = append(got, n.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Sort(%s) = %v, want %v", tt.order, got, tt.want)
+			}
+		})
+	}
+}
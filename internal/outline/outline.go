@@ -0,0 +1,279 @@
+// Package outline arranges the definitions extracted from a file into a
+// hierarchy: methods under the types they belong to, and in languages where
+// definitions nest, members under whatever contains them.
+package outline
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/scan"
+	"github.com/bashhack/cdx/internal/symbols"
+)
+
+// Node is a definition and the definitions nested in it.
+type Node struct {
+	// Signature is the definition's line, trimmed, without an opening brace
+	// or semicolon or, in Python, the colon ending it
+	Signature string `json:"signature,omitempty"`
+	// Doc is the first sentence of the definition's doc comment or
+	// docstring; see patterns.DocSummary
+	Doc      string  `json:"doc,omitempty"`
+	Children []*Node `json:"children,omitempty"`
+	symbols.Symbol
+	// Exported reports whether the definition is visible outside its
+	// package or module; see patterns.IsExported
+	Exported bool `json:"exported"`
+	// Lines is how many lines the definition spans, when its EndLine is
+	// known
+	Lines int `json:"lines,omitempty"`
+	// Metrics are set by Measure
+	Metrics Metrics `json:"metrics,omitzero"`
+}
+
+// Build nests syms, the definitions extracted from src in lang, in source
+// order.
+//
+// A definition with a Parent is grouped under the type of that name, as are
+// a Go method under its receiver's type, a C++ member function defined
+// outside its class under the class it's qualified with, a Lua function
+// defined on a table under the table, and a Rust function under the type its
+// impl block is for. When that type isn't defined in src, as with a Go
+// method in a different file from its type, a node with just the type's
+// name, kind "type", and no line holds the group, where its first member is.
+// In the other languages, a definition nests under the definition on the
+// nearest line above it that's indented less, which is how Python and
+// TypeScript methods end up under their class. In Python, that line may be
+// an if or the like, and in Kotlin a companion object, and the definition
+// nests under what that's in; a def nested in another function is a function
+// rather than a method. Each nested definition's Parent names the node it's
+// under. Everything else stays at the top level, in source order.
+func Build(syms []symbols.Symbol, src []byte, lang patterns.Language) []*Node {
+	var lines []string
+	for _, line := range scan.Lines(src) {
+		lines = append(lines, line)
+	}
+	text := func(n int) string {
+		if n < 1 || n > len(lines) {
+			return ""
+		}
+		return lines[n-1]
+	}
+	var comments []string
+	if lp := patterns.ForLanguage(lang); lp != nil && lp.Syntax != nil {
+		comments = lp.Syntax.LineComment
+	}
+
+	// Types are indexed first, since a Go method can come before its type
+	nodes := make([]*Node, 0, len(syms))
+	byLine := make(map[int]*Node)
+	types := make(map[string]*Node)
+	for _, s := range syms {
+		if lang == patterns.Rust && patterns.ImplTarget(text(s.Line)) != "" {
+			// An impl block stands for its type; its members join the type
+			continue
+		}
+		n := &Node{
+			Symbol:    s,
+			Exported:  patterns.IsExported(lang, s.Name, text(s.Line)),
+			Signature: signature(text(s.Line), lang),
+			Doc:       patterns.DocSummary(lang, patterns.DocComment(lang, lines, s.Line), s.Name),
+		}
+		if s.EndLine >= s.Line {
+			n.Lines = s.EndLine - s.Line + 1
+		}
+		nodes = append(nodes, n)
+		if _, ok := byLine[s.Line]; !ok {
+			byLine[s.Line] = n
+		}
+		if _, ok := types[s.Name]; !ok && (s.Kind == "type" || s.Kind == "interface") {
+			types[s.Name] = n
+		}
+	}
+
+	var roots []*Node
+	groups := make(map[string]*Node)
+	for _, n := range nodes {
+		group := n.Parent
+		var owner *Node
+		switch {
+		case group != "":
+		case lang == patterns.Go || lang == patterns.Lua:
+			if n.Kind == "method" {
+				group, _ = patterns.Container(lang, lines, n.Line)
+			}
+		case lang == patterns.Cpp && patterns.Qualifier(text(n.Line)) != "":
+			group = patterns.Qualifier(text(n.Line))
+		default:
+			above := outer(lines, n.Line, lang, comments)
+			// A Python definition inside an if, with, or the like belongs to
+			// the definition those are in, as a Kotlin one in a companion
+			// object belongs to its class
+			for (lang == patterns.Python || lang == patterns.Kotlin) && above > 0 && byLine[above] == nil {
+				above = outer(lines, above, lang, comments)
+			}
+			if target := patterns.ImplTarget(text(above)); target != "" && lang == patterns.Rust {
+				group = target
+			} else if p := byLine[above]; p != nil && p != n {
+				owner = p
+			}
+		}
+		if group != "" {
+			if owner = types[group]; owner == nil || owner == n {
+				if owner = groups[group]; owner == nil {
+					owner = &Node{Symbol: symbols.Symbol{Name: group, Kind: "type"}, Exported: patterns.IsExported(lang, group, "")}
+					groups[group] = owner
+					roots = append(roots, owner)
+				}
+			}
+		}
+		if owner == nil {
+			roots = append(roots, n)
+			continue
+		}
+		if n.Parent == "" {
+			n.Parent = owner.Name
+		}
+		// An indented Python def is a method only in a class; in another
+		// function it's a nested function
+		if lang == patterns.Python && n.Kind == "method" && (owner.Kind == "function" || owner.Kind == "method") {
+			n.Kind = "function"
+		}
+		owner.Children = append(owner.Children, n)
+	}
+	return roots
+}
+
+// Public prunes nodes, in place, to the exported definitions, keeping an
+// unexported one only when it holds exported ones.
+func Public(nodes []*Node) []*Node {
+	return Filter(nodes, func(n *Node) bool { return n.Exported })
+}
+
+// Filter prunes nodes, in place, to those keep reports true for, keeping any
+// other node only when it holds some of them.
+func Filter(nodes []*Node, keep func(*Node) bool) []*Node {
+	var kept []*Node
+	for _, n := range nodes {
+		n.Children = Filter(n.Children, keep)
+		if keep(n) || len(n.Children) > 0 {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
+
+// Orders Sort can arrange siblings in.
+const (
+	ByLine = "line" // Source order, as Build returns them
+	ByName = "name" // Alphabetically, ignoring case
+	ByKind = "kind" // Types, interfaces, components, functions, methods, consts, vars, then other kinds alphabetically
+	// Largest first by a metric, which needs Measure
+	ByLines    = "metric:lines"
+	ByDepth    = "metric:depth"
+	ByBranches = "metric:branches"
+)
+
+// kindRanks orders kinds for ByKind; other kinds come after these.
+var kindRanks = map[string]int{"type": 1, "interface": 2, "component": 3, "function": 4, "private": 4, "method": 5, "const": 6, "macro": 6, "var": 7}
+
+// Sort arranges each node's children, and nodes themselves, in order, one
+// of the orders above. Nesting is kept; only siblings move, and ties stay in
+// source order.
+func Sort(nodes []*Node, order string) {
+	var cmp func(a, b *Node) int
+	switch order {
+	case ByName:
+		cmp = func(a, b *Node) int {
+			return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		}
+	case ByKind:
+		cmp = func(a, b *Node) int {
+			if c := rank(a.Kind) - rank(b.Kind); c != 0 {
+				return c
+			}
+			return strings.Compare(a.Kind, b.Kind)
+		}
+	case ByLines, ByDepth, ByBranches:
+		cmp = func(a, b *Node) int { return metric(b, order) - metric(a, order) }
+	default:
+		return
+	}
+	var sortAll func([]*Node)
+	sortAll = func(nodes []*Node) {
+		slices.SortStableFunc(nodes, cmp)
+		for _, n := range nodes {
+			sortAll(n.Children)
+		}
+	}
+	sortAll(nodes)
+}
+
+// metric returns n's metric for order, 0 if n hasn't been measured.
+func metric(n *Node, order string) int {
+	switch order {
+	case ByDepth:
+		return n.Metrics.Depth
+	case ByBranches:
+		return n.Metrics.Branches
+	}
+	return n.Metrics.Lines
+}
+
+func rank(kind string) int {
+	if r, ok := kindRanks[kind]; ok {
+		return r
+	}
+	return len(kindRanks) + 1
+}
+
+// signature trims a definition's line down to its signature.
+func signature(line string, lang patterns.Language) string {
+	sig := strings.TrimSpace(line)
+	if lang == patterns.Python {
+		return strings.TrimSuffix(sig, ":")
+	}
+	sig = strings.TrimSuffix(strings.TrimSuffix(sig, ";"), "{}")
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(sig), "{"))
+}
+
+// outer returns the number of the nearest line above line n that's indented
+// less than it, skipping blank lines, line comments, lang's access labels,
+// and braces on lines of their own, which open the definition on the line
+// before, or 0 if there's none or line n isn't indented.
+func outer(lines []string, n int, lang patterns.Language, comments []string) int {
+	if n < 1 || n > len(lines) {
+		return 0
+	}
+	depth := indent(lines[n-1])
+	if depth == 0 {
+		return 0
+	}
+	for i := n - 1; i >= 1; i-- {
+		line := lines[i-1]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "{" || hasPrefix(trimmed, comments) || patterns.AccessLabel(lang, line) {
+			continue
+		}
+		if indent(line) < depth {
+			return i
+		}
+	}
+	return 0
+}
+
+// indent returns the width of line's indentation, with tabs expanded as
+// patterns.IndentWidth does, so a file mixing them nests as Python reads it.
+func indent(line string) int {
+	return patterns.IndentWidth(line)
+}
+
+func hasPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
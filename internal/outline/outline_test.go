@@ -0,0 +1,251 @@
+package outline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/symbols"
+)
+
+// render prints nodes one per line as "line kind name", indented by depth.
+func render(nodes []*Node, indent string, b *strings.Builder) {
+	for _, n := range nodes {
+		fmt.Fprintf(b, "%s%d %s %s\n", indent, n.Line, n.Kind, n.Name)
+		render(n.Children, indent+"  ", b)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{
+			file: "user.go",
+			want: "6 type User\n13 interface UserRepository\n19 function GetUserByID\n" +
+				"24 type userService\n  34 method GetUser\n29 function NewUserService\n39 const MaxUsers\n42 var DefaultPageSize\n",
+		},
+		{
+			// User is declared in user.go, so its method is grouped under a
+			// stand-in
+			file: "user_cache.go",
+			want: "0 type User\n  6 method CacheKey\n",
+		},
+		{
+			file: "handlers.ts",
+			want: "3 interface User\n9 type UserHandler\n  10 method constructor\n  12 method getUser\n" +
+				"17 function createHandler\n21 function fetchUser\n26 interface UserRepository\n30 type UserId\n",
+		},
+		{
+			file: "utils.py",
+			want: "8 type User\n14 type UserService\n  17 method __init__\n  20 method get_user\n" +
+				"25 function create_user\n30 function fetch_user\n",
+		},
+		{
+			file: "user.rs",
+			want: "3 type User\n  43 method fmt\n9 interface UserRepository\n  10 method find_by_id\n  11 method create\n" +
+				"14 type UserService\n  19 method new\n  23 method get_user\n" +
+				"28 function create_user\n32 function fetch_user\n36 type UserRole\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			path := filepath.Join("..", "..", "testdata", "sample-project", tt.file)
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lang := patterns.DetectLanguage(filepath.Ext(path))
+			syms, err := symbols.ExtractSource(symbols.Regex{}, src, lang, filepath.Ext(path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b strings.Builder
+			render(Build(syms, src, lang), "", &b)
+			if got := b.String(); got != tt.want {
+				t.Errorf("Build() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildParents(t *testing.T) {
+	// A Parent as the tree-sitter extractor reports it, and a function
+	// nested in a method by indentation
+	src := "def helper():\n    pass\n\nclass Store:\n    def get(self):\n        def inner():\n            pass\n"
+	syms := []symbols.Symbol{
+		{Name: "helper", Kind: "function", Line: 1},
+		{Name: "Store", Kind: "type", Line: 4},
+		{Name: "get", Kind: "method", Parent: "Store", Line: 5},
+		{Name: "inner", Kind: "function", Line: 6},
+	}
+	var b strings.Builder
+	render(Build(syms, []byte(src), patterns.Python), "", &b)
+	want := "1 function helper\n4 type Store\n  5 method get\n    6 function inner\n"
+	if got := b.String(); got != want {
+		t.Errorf("Build() =\n%s\nwant\n%s", got, want)
+	}
+
+	// Every nested node names its parent
+	nodes := Build(syms, []byte(src), patterns.Python)
+	if got := nodes[1].Children[0].Children[0].Parent; got != "get" {
+		t.Errorf("inner's Parent = %q, want get", got)
+	}
+}
+
+func TestBuildPythonNested(t *testing.T) {
+	// Closures nest under their function as functions, even inside an if,
+	// and a tab indents as deep as eight spaces
+	src := "def outer():\n    if True:\n        def inner():\n            def innermost():\n                pass\n" +
+		"class Cart:\n    def total(self):\n        pass\n" +
+		"def tabbed():\n        x = 1\n\tdef helper():\n\t\tpass\n"
+	syms, err := symbols.Regex{}.Extract([]byte(src), patterns.Python)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	render(Build(syms, []byte(src), patterns.Python), "", &b)
+	want := "1 function outer\n  3 function inner\n    4 function innermost\n" +
+		"6 type Cart\n  7 method total\n" +
+		"9 function tabbed\n  11 function helper\n"
+	if got := b.String(); got != want {
+		t.Errorf("Build() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestBuildMembers(t *testing.T) {
+	tests := []struct {
+		name string
+		lang patterns.Language
+		src  string
+		want string
+	}{
+		{
+			name: "kotlin companion object",
+			lang: patterns.Kotlin,
+			src: "class Repo {\n    fun find() = 1\n\n    companion object {\n        fun create() = Repo()\n    }\n}\n\n" +
+				"fun helper() = 2\n",
+			want: "1 type Repo\n  2 method find\n  5 method create\n9 function helper\n",
+		},
+		{
+			name: "elixir module",
+			lang: patterns.Elixir,
+			src:  "defmodule Accounts do\n  defstruct [:name]\n\n  def list_users, do: []\n\n  defp normalize(email) do\n    email\n  end\nend\n",
+			want: "1 namespace Accounts\n  2 type defstruct\n  4 function list_users\n  6 private normalize\n",
+		},
+		{
+			name: "lua table",
+			lang: patterns.Lua,
+			src:  "local Stack = {}\n\nfunction Stack.new()\n  return setmetatable({}, Stack)\nend\n\nfunction Stack:push(item)\nend\n\nlocal function trim(s)\nend\n",
+			want: "0 type Stack\n  3 method new\n  7 method push\n10 function trim\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			syms, err := symbols.Regex{}.Extract([]byte(tt.src), tt.lang)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b strings.Builder
+			render(Build(syms, []byte(tt.src), tt.lang), "", &b)
+			if got := b.String(); got != tt.want {
+				t.Errorf("Build() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublic(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		// userService is unexported but holds the exported GetUser
+		{
+			file: "user.go",
+			want: "6 type User\n13 interface UserRepository\n19 function GetUserByID\n" +
+				"24 type userService\n  34 method GetUser\n29 function NewUserService\n39 const MaxUsers\n42 var DefaultPageSize\n",
+		},
+		{
+			file: "handlers.ts",
+			want: "3 interface User\n9 type UserHandler\n  10 method constructor\n  12 method getUser\n" +
+				"17 function createHandler\n21 function fetchUser\n30 type UserId\n",
+		},
+		{
+			file: "user.rs",
+			want: "3 type User\n9 interface UserRepository\n14 type UserService\n  19 method new\n  23 method get_user\n" +
+				"28 function create_user\n32 function fetch_user\n36 type UserRole\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			path := filepath.Join("..", "..", "testdata", "sample-project", tt.file)
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lang := patterns.DetectLanguage(filepath.Ext(path))
+			syms, err := symbols.ExtractSource(symbols.Regex{}, src, lang, filepath.Ext(path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b strings.Builder
+			render(Public(Build(syms, src, lang)), "", &b)
+			if got := b.String(); got != tt.want {
+				t.Errorf("Public() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSort(t *testing.T) {
+	src := "package user\n\nvar b = 1\n\ntype Z struct{}\n\nfunc (z Z) b() {}\n\nfunc (z Z) A() {}\n\nfunc a() {}\n\ntype Y interface{}\n"
+	tests := []struct {
+		order string
+		want  string
+	}{
+		{ByLine, "3 var b\n5 type Z\n  7 method b\n  9 method A\n11 function a\n13 interface Y\n"},
+		{ByName, "11 function a\n3 var b\n13 interface Y\n5 type Z\n  9 method A\n  7 method b\n"},
+		{ByKind, "5 type Z\n  7 method b\n  9 method A\n13 interface Y\n11 function a\n3 var b\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			syms, err := symbols.ExtractSource(symbols.Regex{}, []byte(src), patterns.Go, ".go")
+			if err != nil {
+				t.Fatal(err)
+			}
+			nodes := Build(syms, []byte(src), patterns.Go)
+			Sort(nodes, tt.order)
+			var b strings.Builder
+			render(nodes, "", &b)
+			if got := b.String(); got != tt.want {
+				t.Errorf("Sort(%s) =\n%s\nwant\n%s", tt.order, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	src := "class Store:\n    def get(self):\n        pass\n\n    def put(self):\n        pass\n\ndef helper():\n    pass\n"
+	syms := []symbols.Symbol{
+		{Name: "Store", Kind: "type", Line: 1},
+		{Name: "get", Kind: "method", Line: 2},
+		{Name: "put", Kind: "method", Line: 5},
+		{Name: "helper", Kind: "function", Line: 8},
+	}
+	nodes := Filter(Build(syms, []byte(src), patterns.Python), func(n *Node) bool { return n.Name == "put" })
+	var b strings.Builder
+	render(nodes, "", &b)
+	// Store stays, holding the one match
+	if want := "1 type Store\n  5 method put\n"; b.String() != want {
+		t.Errorf("Filter() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
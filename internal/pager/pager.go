@@ -0,0 +1,142 @@
+// Package pager pipes a command's output through a pager such as less.
+//
+// The pager setting mirrors color: "auto" pages when writing to a terminal,
+// "always" pages even when not, and "never" doesn't. The pager program is
+// $PAGER, or less when that's unset; an empty $PAGER or "cat" turns paging
+// off.
+package pager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/bashhack/cdx/internal/termcolor"
+)
+
+// Mode is a pager setting.
+type Mode string
+
+// Pager modes.
+const (
+	Auto   Mode = "auto"   // Page when writing to a terminal
+	Always Mode = "always" // Page even when output is piped
+	Never  Mode = "never"
+)
+
+// Modes lists the valid pager settings.
+var Modes = []Mode{Auto, Always, Never}
+
+// ParseMode parses a --pager or pager config value. Empty means Auto.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case "":
+		return Auto, nil
+	case Auto, Always, Never:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid pager mode %q (want always, never, or auto)", s)
+	}
+}
+
+// String, Set, and Type make *Mode a pflag.Value, so an invalid --pager is
+// rejected while flags are parsed.
+func (m *Mode) String() string { return string(*m) }
+
+// Set parses s into m.
+func (m *Mode) Set(s string) error {
+	mode, err := ParseMode(s)
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// Type names the flag's value in help output.
+func (m *Mode) Type() string { return "when" }
+
+// Wanted reports whether output should be paged under mode when the output
+// is, or isn't, a terminal.
+func Wanted(mode Mode, terminal bool) bool {
+	switch mode {
+	case Always:
+		return true
+	case Never:
+		return false
+	default:
+		return terminal
+	}
+}
+
+// defaultCommand runs when $PAGER is unset: -F quits when the output fits
+// on one screen, -R passes color through, and -X leaves it on the screen.
+const defaultCommand = "less -FRX"
+
+// Command returns the pager program and its arguments, or nil when $PAGER
+// turns paging off. lookupEnv is os.LookupEnv outside tests.
+func Command(lookupEnv func(string) (string, bool)) []string {
+	cmd, set := lookupEnv("PAGER")
+	if !set {
+		cmd = defaultCommand
+	}
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 || fields[0] == "cat" {
+		return nil
+	}
+	return fields
+}
+
+// Pager is a running pager; output written to it is paged.
+type Pager struct {
+	cmd *exec.Cmd
+	in  io.WriteCloser
+}
+
+// Start runs the pager command with its output on out.
+func Start(command []string, out io.Writer) (*Pager, error) {
+	cmd := exec.Command(command[0], command[1:]...) // #nosec G204 -- the user's $PAGER
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	if _, set := os.LookupEnv("LESS"); !set {
+		// As git does, so a $PAGER of plain less still passes color through
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("pager %s: %w", command[0], err)
+	}
+	return &Pager{cmd: cmd, in: in}, nil
+}
+
+// Write sends b to the pager. Once the user quits the pager the rest of the
+// output is discarded rather than reported as an error.
+func (p *Pager) Write(b []byte) (int, error) {
+	n, err := p.in.Write(b)
+	if errors.Is(err, syscall.EPIPE) {
+		return len(b), nil
+	}
+	return n, err
+}
+
+// IsTerminal reports that the pager's output is a terminal, so output
+// written to it is colored as for the terminal.
+func (p *Pager) IsTerminal() bool {
+	return termcolor.IsTerminal(p.cmd.Stdout)
+}
+
+// Close ends the output and waits for the user to quit the pager.
+func (p *Pager) Close() error {
+	err := p.in.Close()
+	if waitErr := p.cmd.Wait(); err == nil {
+		err = waitErr
+	}
+	return err
+}
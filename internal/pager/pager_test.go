@@ -0,0 +1,82 @@
+package pager
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWanted(t *testing.T) {
+	tests := []struct {
+		mode     Mode
+		terminal bool
+		want     bool
+	}{
+		{Auto, true, true},
+		{Auto, false, false},
+		{Always, false, true},
+		{Never, true, false},
+	}
+	for _, tt := range tests {
+		if got := Wanted(tt.mode, tt.terminal); got != tt.want {
+			t.Errorf("Wanted(%q, %v) = %v, want %v", tt.mode, tt.terminal, got, tt.want)
+		}
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	if m, err := ParseMode(""); err != nil || m != Auto {
+		t.Errorf(`ParseMode("") = %q, %v, want auto`, m, err)
+	}
+	var m Mode
+	if err := m.Set("always"); err != nil || m != Always {
+		t.Errorf(`Set("always") gave %q, %v`, m, err)
+	}
+	if err := m.Set("yes"); err == nil {
+		t.Error(`Set("yes") error = nil, want an error`)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		name string
+		want []string
+	}{
+		{name: "unset", want: []string{"less", "-FRX"}},
+		{name: "set", env: map[string]string{"PAGER": "more -s"}, want: []string{"more", "-s"}},
+		{name: "empty turns paging off", env: map[string]string{"PAGER": ""}},
+		{name: "cat turns paging off", env: map[string]string{"PAGER": "cat"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Command(func(name string) (string, bool) {
+				v, ok := tt.env[name]
+				return v, ok
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Command() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStart(t *testing.T) {
+	var out bytes.Buffer
+	p, err := Start([]string{"cat"}, &out)
+	if err != nil {
+		t.Skipf("cat unavailable: %v", err)
+	}
+	if _, err := p.Write([]byte("paged\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if out.String() != "paged\n" {
+		t.Errorf("output = %q, want %q", out.String(), "paged\n")
+	}
+	if p.IsTerminal() {
+		t.Error("IsTerminal() = true for a buffer")
+	}
+}
@@ -0,0 +1,72 @@
+package patterns
+
+import "strings"
+
+// MaxAnnotationLines is how many lines above a definition are examined for
+// decorators and attributes.
+const MaxAnnotationLines = 5
+
+// Annotations returns the decorators or attributes attached to a definition,
+// in source order. preceding holds the lines immediately above the
+// definition line, oldest first; only the last MaxAnnotationLines are
+// examined. Comment lines between annotations are skipped, and the scan stops
+// at the first line that is neither.
+func Annotations(lang Language, preceding []string) []string {
+	lp := ForLanguage(lang)
+	if lp == nil || lp.Annotation == nil {
+		return nil
+	}
+
+	if len(preceding) > MaxAnnotationLines {
+		preceding = preceding[len(preceding)-MaxAnnotationLines:]
+	}
+
+	var found []string
+	for i := len(preceding) - 1; i >= 0; i-- {
+		line := preceding[i]
+		if m := lp.Annotation.FindStringSubmatch(line); len(m) > 1 {
+			found = append(found, m[1])
+			continue
+		}
+		if isCommentLine(lang, line) {
+			continue
+		}
+		break
+	}
+
+	// Collected bottom-up; restore source order
+	for i, j := 0, len(found)-1; i < j; i, j = i+1, j-1 {
+		found[i], found[j] = found[j], found[i]
+	}
+	return found
+}
+
+// HasAnnotation reports whether annotations includes name, either exactly or
+// as the final path segment, so "test" matches "tokio::test" and "overload"
+// matches "typing.overload". Arguments are ignored: "Deprecated" matches
+// "Deprecated()".
+func HasAnnotation(annotations []string, name string) bool {
+	for _, a := range annotations {
+		if i := strings.IndexByte(a, '('); i >= 0 {
+			a = a[:i]
+		}
+		if i := strings.LastIndexAny(a, ".:"); i >= 0 {
+			a = a[i+1:]
+		}
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isCommentLine reports whether line is a whole-line comment in lang.
+func isCommentLine(lang Language, line string) bool {
+	trimmed := strings.TrimSpace(line)
+	switch lang {
+	case Python:
+		return strings.HasPrefix(trimmed, "#")
+	default:
+		return strings.HasPrefix(trimmed, "//")
+	}
+}
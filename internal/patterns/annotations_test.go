@@ -0,0 +1,98 @@
+package patterns
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		name      string
+		lang      Language
+		preceding []string
+		want      []string
+	}{
+		{
+			name:      "Python overload",
+			lang:      Python,
+			preceding: []string{"", "@overload"},
+			want:      []string{"overload"},
+		},
+		{
+			name:      "Python stacked decorators with comment",
+			lang:      Python,
+			preceding: []string{"x = 1", "@app.route(\"/users\")", "# requires auth", "@login_required"},
+			want:      []string{"app.route", "login_required"},
+		},
+		{
+			name:      "Rust test attribute",
+			lang:      Rust,
+			preceding: []string{"    /// Checks creation", "    #[test]"},
+			want:      []string{"test"},
+		},
+		{
+			name:      "Rust async test with derive above blank line",
+			lang:      Rust,
+			preceding: []string{"#[derive(Debug)]", "", "#[tokio::test]"},
+			want:      []string{"tokio::test"},
+		},
+		{
+			name:      "TypeScript class decorator",
+			lang:      TypeScript,
+			preceding: []string{"@Deprecated()"},
+			want:      []string{"Deprecated"},
+		},
+		{
+			name:      "no annotations",
+			lang:      Python,
+			preceding: []string{"import os", ""},
+			want:      nil,
+		},
+		{
+			name:      "Go has no annotations",
+			lang:      Go,
+			preceding: []string{"// @deprecated"},
+			want:      nil,
+		},
+		{
+			name: "only the last MaxAnnotationLines lines are examined",
+			lang: Python,
+			preceding: []string{
+				"@too_far", "# 1", "# 2", "# 3", "# 4", "@close",
+			},
+			want: []string{"close"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Annotations(tt.lang, tt.preceding); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Annotations() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasAnnotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		annotations []string
+		want        bool
+	}{
+		{"exact", "test", []string{"test"}, true},
+		{"rust path", "test", []string{"tokio::test"}, true},
+		{"python attribute", "overload", []string{"typing.overload"}, true},
+		{"arguments ignored", "Deprecated", []string{"Deprecated()"}, true},
+		{"no partial names", "test", []string{"testing"}, false},
+		{"empty", "test", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasAnnotation(tt.annotations, tt.query); got != tt.want {
+				t.Errorf("HasAnnotation(%q, %q) = %v, want %v", tt.annotations, tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package patterns
+
+// Blocks follows a file line by line through its blocks of grouped
+// declarations, such as Go's const ( ... ), so that patterns for their
+// members, which have no keyword of their own, apply only inside them and
+// not to lines that merely look alike, such as a struct's fields.
+type Blocks struct {
+	lp   *LanguagePatterns
+	kind string
+}
+
+// NewBlocks returns a tracker for a file in lang, starting outside any block.
+func NewBlocks(lang Language) *Blocks {
+	return &Blocks{lp: ForLanguage(lang)}
+}
+
+// Next takes the file's next line and returns the kind of block it's a
+// member of, or "" if it's in none, as Pattern.Block names them. The lines
+// that open and close a block are in none. Blocks open and close at the
+// start of an unindented line, so indented ones cost no matching.
+func (b *Blocks) Next(line string) string {
+	if b.lp == nil || b.lp.BlockStart == nil || line == "" || line[0] == ' ' || line[0] == '\t' {
+		return b.kind
+	}
+	if b.kind != "" {
+		if b.lp.BlockEnd.MatchString(line) {
+			b.kind = ""
+		}
+		return b.kind
+	}
+	if m := b.lp.BlockStart.FindStringSubmatch(line); len(m) > 1 {
+		b.kind = m[1]
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package patterns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBlocks(t *testing.T) {
+	src := "package p\n" +
+		"const (\n" +
+		"\tA = 1\n" +
+		"\tB\n" +
+		")\n" +
+		"type User struct {\n" +
+		"\tName string\n" +
+		"}\n" +
+		"var ( // Defaults\n" +
+		"\tx = map[string]int{\n" +
+		"\t\t\"a\": 1,\n" +
+		"\t}\n" +
+		")\n" +
+		"type (\n" +
+		"\tID int\n" +
+		")\n" +
+		"func f() {\n" +
+		"\tconst (\n" +
+		"\t\tC = 1\n" +
+		"\t)\n" +
+		"}\n"
+	want := []string{"", "", "const", "const", "", "", "", "", "", "var", "var", "var", "", "", "type", "", "", "", "", "", ""}
+
+	b := NewBlocks(Go)
+	for i, line := range strings.Split(strings.TrimSuffix(src, "\n"), "\n") {
+		if got := b.Next(line); got != want[i] {
+			t.Errorf("Next(%q) on line %d = %q, want %q", line, i+1, got, want[i])
+		}
+	}
+
+	// A language without blocks never has a line in one
+	b = NewBlocks(Python)
+	for _, line := range []string{"const (", "\tA = 1"} {
+		if got := b.Next(line); got != "" {
+			t.Errorf("Next(%q) for Python = %q, want none", line, got)
+		}
+	}
+}
+
+func TestDefinitionsMatchIn(t *testing.T) {
+	defs := DefinitionsFor("Name", Go, false)
+	tests := []struct {
+		line  string
+		block string
+		want  string
+	}{
+		{line: "\tName = \"cdx\"", block: "const", want: "const"},
+		{line: "\tName", block: "const", want: "const"},
+		{line: "\tName, Alias = \"cdx\", \"x\"", block: "const", want: "const"},
+		{line: "\tName string", block: "var", want: "var"},
+		{line: "\tName = flag.String()", block: "var", want: "var"},
+		{line: "\tName string", block: "type", want: "type"},
+		{line: "\tName[T any] struct{}", block: "type", want: "type"},
+		{line: "\tName string", block: "", want: ""},
+		{line: "\tName: \"cdx\",", block: "", want: ""},
+		{line: "\tName() string", block: "", want: ""},
+		{line: "\tName = \"cdx\"", block: "", want: ""},
+		{line: "const Name = \"cdx\"", block: "", want: "const"},
+	}
+	for _, tt := range tests {
+		kind, ok := defs.MatchIn(tt.line, tt.block, nil)
+		if kind != tt.want || ok != (tt.want != "") {
+			t.Errorf("MatchIn(%q, %q) = %q, %v, want %q", tt.line, tt.block, kind, ok, tt.want)
+		}
+		if loc := defs.Find(tt.line, tt.block, nil); (loc != nil) != ok {
+			t.Errorf("Find(%q, %q) = %v, want a match: %v", tt.line, tt.block, loc, ok)
+		}
+	}
+}
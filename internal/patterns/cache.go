@@ -0,0 +1,99 @@
+package patterns
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultDefinitionCacheSize is how many symbols' patterns a
+// DefinitionCache holds when NewDefinitionCache is given no size.
+const DefaultDefinitionCacheSize = 1024
+
+// DefinitionCache memoizes DefinitionsFor for processes that answer many
+// queries, such as cdx serve, which would otherwise compile the same
+// patterns for every request. It holds a bounded number of symbols,
+// dropping the least recently used first, and is safe for concurrent use.
+//
+// The patterns depend on SetCustom, SetExtensions, and the plugin
+// languages, which should all be in place before the cache is first used;
+// patterns cached earlier aren't rebuilt when they change.
+type DefinitionCache struct {
+	entries map[definitionKey]*list.Element
+	order   *list.List // Of *definitionEntry, most recently used first
+	size    int
+	hits    int
+	misses  int
+	mu      sync.Mutex
+}
+
+// definitionKey is what DefinitionsFor's result depends on.
+type definitionKey struct {
+	symbol string
+	lang   Language
+	fold   bool
+}
+
+// definitionEntry is a cached result of DefinitionsFor.
+type definitionEntry struct {
+	key  definitionKey
+	defs Definitions
+}
+
+// DefinitionCacheStats counts a DefinitionCache's lookups.
+type DefinitionCacheStats struct {
+	Hits    int `json:"hits"`
+	Misses  int `json:"misses"`
+	Entries int `json:"entries"` // Symbols cached now
+	Size    int `json:"size"`    // Most symbols the cache holds
+}
+
+// NewDefinitionCache returns an empty cache holding at most size symbols'
+// patterns, or DefaultDefinitionCacheSize when size isn't positive.
+func NewDefinitionCache(size int) *DefinitionCache {
+	if size <= 0 {
+		size = DefaultDefinitionCacheSize
+	}
+	return &DefinitionCache{entries: make(map[definitionKey]*list.Element), order: list.New(), size: size}
+}
+
+// Get is like DefinitionsFor, but returns the cached patterns when symbol
+// has been looked up in lang, with the same fold, before. The Definitions
+// returned are shared and must not be modified.
+func (c *DefinitionCache) Get(symbol string, lang Language, fold bool) Definitions {
+	key := definitionKey{symbol: symbol, lang: lang, fold: fold}
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		c.hits++
+		c.order.MoveToFront(e)
+		defs := e.Value.(*definitionEntry).defs
+		c.mu.Unlock()
+		return defs
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	// Compiling is the expensive part, so it happens unlocked; two lookups
+	// of a new symbol at once may both compile it
+	defs := DefinitionsFor(symbol, lang, fold)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*definitionEntry).defs
+	}
+	c.entries[key] = c.order.PushFront(&definitionEntry{key: key, defs: defs})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*definitionEntry).key)
+	}
+	return defs
+}
+
+// Stats returns the cache's counts so far.
+func (c *DefinitionCache) Stats() DefinitionCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return DefinitionCacheStats{Hits: c.hits, Misses: c.misses, Entries: c.order.Len(), Size: c.size}
+}
@@ -0,0 +1,80 @@
+package patterns
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestDefinitionCache(t *testing.T) {
+	c := NewDefinitionCache(2)
+	first := c.Get("MaxUsers", Go, false)
+	if again := c.Get("MaxUsers", Go, false); again.Combined != first.Combined {
+		t.Error("Get() of a cached symbol compiled its patterns again")
+	}
+	// Each of the language and folding makes a different entry
+	if folded := c.Get("MaxUsers", Go, true); folded.Combined == first.Combined {
+		t.Error("Get() with fold set returned the patterns without it")
+	}
+	if got, want := c.Stats(), (DefinitionCacheStats{Hits: 1, Misses: 2, Entries: 2, Size: 2}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	// A third symbol evicts the least recently used, the unfolded one
+	c.Get("UserStore", Go, false)
+	if again := c.Get("MaxUsers", Go, false); again.Combined == first.Combined {
+		t.Error("Get() returned patterns that should have been evicted")
+	}
+	if got := c.Stats(); got.Entries != 2 || got.Misses != 4 {
+		t.Errorf("Stats() = %+v, want 2 entries after 4 misses", got)
+	}
+
+	if got := NewDefinitionCache(0).Stats().Size; got != DefaultDefinitionCacheSize {
+		t.Errorf("NewDefinitionCache(0) size = %d, want %d", got, DefaultDefinitionCacheSize)
+	}
+}
+
+func TestDefinitionCacheConcurrent(t *testing.T) {
+	c := NewDefinitionCache(8)
+	var wg sync.WaitGroup
+	for i := range 16 {
+		wg.Go(func() {
+			for j := range 100 {
+				symbol := fmt.Sprintf("Sym%d", (i+j)%12)
+				if defs := c.Get(symbol, TypeScript, false); defs.Combined == nil || !defs.Combined.MatchString("function "+symbol+"(") {
+					t.Errorf("Get(%q) doesn't match its definition", symbol)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+	if got := c.Stats(); got.Entries > 8 || got.Hits+got.Misses != 1600 {
+		t.Errorf("Stats() = %+v, want at most 8 entries and 1600 lookups", got)
+	}
+}
+
+// BenchmarkDefinitionCache looks up the patterns for 1,000 queries over 50
+// TypeScript symbols, as a long-lived process answering them would, with
+// and without the cache.
+func BenchmarkDefinitionCache(b *testing.B) {
+	queries := make([]string, 1000)
+	for i := range queries {
+		queries[i] = fmt.Sprintf("useQuery%d", i%50)
+	}
+	b.Run("uncached", func(b *testing.B) {
+		for b.Loop() {
+			for _, q := range queries {
+				DefinitionsFor(q, TypeScript, false)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		c := NewDefinitionCache(0)
+		for b.Loop() {
+			for _, q := range queries {
+				c.Get(q, TypeScript, false)
+			}
+		}
+	})
+}
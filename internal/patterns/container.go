@@ -0,0 +1,217 @@
+package patterns
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// goReceiver matches a Go method's line up to the end of its receiver;
+	// group 1 is the receiver's *, if any, group 2 its type's name, and
+	// group 3 any type parameters.
+	goReceiver = regexp.MustCompile(`^func\s*\(\s*(?:[\p{L}_][\p{L}\p{Nd}_]*\s+)?(\*?)\s*([\p{L}_][\p{L}\p{Nd}_]*)\s*(\[[^\]]*\])?\s*\)`)
+	// rustImpl matches the start of a Rust impl block; group 1 is the type it
+	// implements for, the one after "for" in a trait impl.
+	rustImpl = regexp.MustCompile(`^\s*(?:unsafe\s+)?impl\b(?:\s*<[^{]*?>)?\s+(?:[^{]*?\bfor\s+)?(?:[\p{L}_][\p{L}\p{Nd}_]*::)*([\p{L}_][\p{L}\p{Nd}_]*)`)
+	// rustTrait matches the start of a Rust trait; group 1 is its name.
+	rustTrait = regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:unsafe\s+)?trait\s+([\p{L}_][\p{L}\p{Nd}_]*)`)
+	// jsClass matches the start of a TypeScript or JavaScript class; group 1
+	// is its name.
+	jsClass = regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:declare\s+)?(?:abstract\s+)?class\s+([\p{L}_$][\p{L}\p{Nd}_$]*)`)
+	// cppQualified matches the start of a C++ member function defined
+	// outside its class, as in void Widget::draw(; group 1 is the class.
+	cppQualified = regexp.MustCompile(`^` + cppTemplate + `(?:` + cppSpecifiers + `)?(?:[\p{L}_][\p{L}\p{Nd}_]*(?:<[^;{}()]*>)?::)*([\p{L}_][\p{L}\p{Nd}_]*)(?:<[^;{}()]*>)?::~?[\p{L}_][\p{L}\p{Nd}_]*\s*\(`)
+	// cppClass matches the start of a C++ class or struct; group 1 is its
+	// name.
+	cppClass = regexp.MustCompile(`^\s*` + cppTemplate + `(?:class|struct)\s+(?:\[\[[^\]]*\]\]\s*)?(?:[\p{Lu}_][\p{Lu}\p{Nd}_]*\s+)?([\p{L}_][\p{L}\p{Nd}_]*)`)
+	// rubyClass matches the start of a Ruby class or module; group 1 is its
+	// name, the last of Outer::Name.
+	rubyClass = regexp.MustCompile(`^\s*(?:class|module)\s+(?:[\p{L}_][\p{L}\p{Nd}_]*::)*([\p{L}_][\p{L}\p{Nd}_]*)`)
+	// phpClass matches the start of a PHP class, interface, trait, or enum;
+	// group 1 is its name.
+	phpClass = regexp.MustCompile(`^\s*(?:(?:abstract|final|readonly)\s+)*(?:class|interface|trait|enum)\s+([\p{L}_][\p{L}\p{Nd}_]*)`)
+	// kotlinClass matches the start of a Kotlin class, object, or interface;
+	// group 1 is its name.
+	kotlinClass = regexp.MustCompile(`^\s*` + kotlinModifiers + `(?:fun\s+)?(?:class|object|interface)\s+([\p{L}_][\p{L}\p{Nd}_]*)`)
+	// swiftType matches the start of a Swift class, struct, enum, actor,
+	// protocol, or extension; group 1 is its name, the last of Outer.Name.
+	swiftType = regexp.MustCompile(`^\s*` + swiftModifiers + `(?:class|struct|enum|actor|protocol|extension)\s+(?:[\p{L}_][\p{L}\p{Nd}_]*\.)*([\p{L}_][\p{L}\p{Nd}_]*)`)
+	// csharpClass matches the start of a C# class, struct, record, or
+	// interface; group 1 is its name.
+	csharpClass = regexp.MustCompile(`^\s*` + csharpModifiers + `(?:class|struct|interface|record(?:\s+(?:class|struct))?)\s+([\p{L}_][\p{L}\p{Nd}_]*)`)
+	// scalaType matches the start of a Scala class, object, trait, or enum;
+	// group 1 is its name.
+	scalaType = regexp.MustCompile(`^\s*` + scalaModifiers + `(?:class|object|trait|enum)\s+([\p{L}_][\p{L}\p{Nd}_]*)`)
+	// elixirModule matches the start of an Elixir module or protocol; group
+	// 1 is its name, the last of Outer.Name.
+	elixirModule = regexp.MustCompile(`^\s*(?:defmodule|defprotocol)\s+` + elixirQualifier + `(\p{Lu}[\p{L}\p{Nd}_]*)`)
+	// zigContainer matches the start of a Zig struct, enum, union, or
+	// opaque type; group 1 is its name.
+	zigContainer = regexp.MustCompile(`^\s*` + zigQualifiers + `const\s+([\p{L}_][\p{L}\p{Nd}_]*)` + zigType)
+	// luaMethod matches the start of a Lua function defined on a table;
+	// group 1 is the table.
+	luaMethod = regexp.MustCompile(`^\s*function\s+(` + luaTable + `)[.:][\p{L}_][\p{L}\p{Nd}_]*\s*\(`)
+	// kotlinCompanion matches the start of a Kotlin companion object, whose
+	// members belong to the class it's in.
+	kotlinCompanion = regexp.MustCompile(`^\s*companion\s+object\b`)
+	// cppAccess matches a C++ access label, such as public:.
+	cppAccess = regexp.MustCompile(`^\s*(?:public|protected|private)\s*:(?:[^:]|$)`)
+)
+
+// Container returns the type or class the definition on line n, 1-based, of
+// lines belongs to: a Go method's receiver type, the class around a Python,
+// TypeScript, JavaScript, PHP, Kotlin, C#, or C++ method, the class, object,
+// or trait around a Scala method, the class or module around a Ruby method,
+// the module or protocol around an Elixir function, the struct or other type
+// around a Zig method, the type or extension around a Swift method, the
+// class a C++ method defined outside it is qualified with, the table a Lua
+// function is defined on, as M in function M.name( or M:name(, or the type a
+// Rust impl block is for, or the trait a Rust function is declared in. For a
+// Go method, receiver is the receiver's type as the method writes it, such
+// as *GrepSearcher or List[T], so the method reads as (*GrepSearcher).Close;
+// it's empty in the other languages. A definition that belongs to nothing,
+// such as a top-level function or a Python function nested in another, has
+// no container.
+//
+// A Python method's container is its Scope, which names what its class is
+// nested in too, as in Outer.Inner. In the other languages, a method
+// belongs to the class, module, impl, or trait on the nearest line above
+// it that's indented less, skipping a brace on a line of its own and C++
+// access labels such as public:, which are often written at the class's
+// own indentation. A Kotlin companion object's members belong to the class
+// it's in.
+func Container(lang Language, lines []string, n int) (container, receiver string) {
+	if n < 1 || n > len(lines) {
+		return "", ""
+	}
+	line := lines[n-1]
+	switch lang {
+	case Go:
+		m := goReceiver.FindStringSubmatch(line)
+		if m == nil {
+			return "", ""
+		}
+		return m[2], m[1] + m[2] + m[3]
+	case Python:
+		chain, nested := Scope(lang, lines, n)
+		if nested {
+			return "", ""
+		}
+		return strings.Join(chain, "."), ""
+	case Cpp:
+		if class := Qualifier(line); class != "" {
+			return class, ""
+		}
+	case Lua:
+		if m := luaMethod.FindStringSubmatch(line); m != nil {
+			return m[1], ""
+		}
+		return "", ""
+	}
+
+	depth := IndentWidth(line)
+	if depth == 0 {
+		return "", ""
+	}
+	for i := n - 1; i >= 1; i-- {
+		above := lines[i-1]
+		// A brace on a line of its own opens the class on the line before
+		if trimmed := strings.TrimSpace(above); trimmed == "" || trimmed == "{" || isCommentLine(lang, above) || AccessLabel(lang, above) || IndentWidth(above) >= depth {
+			continue
+		}
+		switch lang {
+		case TypeScript, JavaScript:
+			if m := jsClass.FindStringSubmatch(above); m != nil {
+				return m[1], ""
+			}
+		case Cpp:
+			if m := cppClass.FindStringSubmatch(above); m != nil {
+				return m[1], ""
+			}
+		case Ruby:
+			if m := rubyClass.FindStringSubmatch(above); m != nil {
+				return m[1], ""
+			}
+		case PHP:
+			if m := phpClass.FindStringSubmatch(above); m != nil {
+				return m[1], ""
+			}
+		case Zig:
+			if m := zigContainer.FindStringSubmatch(above); m != nil {
+				return m[1], ""
+			}
+		case Elixir:
+			if m := elixirModule.FindStringSubmatch(above); m != nil {
+				return m[1], ""
+			}
+		case Scala:
+			if m := scalaType.FindStringSubmatch(above); m != nil {
+				return m[1], ""
+			}
+		case CSharp:
+			if m := csharpClass.FindStringSubmatch(above); m != nil {
+				return m[1], ""
+			}
+		case Swift:
+			if m := swiftType.FindStringSubmatch(above); m != nil {
+				return m[1], ""
+			}
+		case Kotlin:
+			if kotlinCompanion.MatchString(above) {
+				depth = IndentWidth(above)
+				continue
+			}
+			if m := kotlinClass.FindStringSubmatch(above); m != nil {
+				return m[1], ""
+			}
+		case Rust:
+			if target := ImplTarget(above); target != "" {
+				return target, ""
+			}
+			if m := rustTrait.FindStringSubmatch(above); m != nil {
+				return m[1], ""
+			}
+		}
+		return "", ""
+	}
+	return "", ""
+}
+
+// ImplTarget returns the type the Rust impl block starting on line is for,
+// the one after "for" in a trait impl, or "" if line doesn't start one.
+func ImplTarget(line string) string {
+	if m := rustImpl.FindStringSubmatch(line); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// Qualifier returns the class a C++ member function defined outside it on
+// line is qualified with, such as Widget in void Widget::draw() {, or "" if
+// line doesn't start one.
+func Qualifier(line string) string {
+	if m := cppQualified.FindStringSubmatch(line); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// AccessLabel reports whether line is an access label in lang, such as
+// C++'s public:, which a class's members are indented under without being
+// nested in.
+func AccessLabel(lang Language, line string) bool {
+	return lang == Cpp && cppAccess.MatchString(line)
+}
+
+// Qualify returns name as a member of container: (receiver).name for a Go
+// method, container.name otherwise, or just name when it belongs to
+// nothing. The arguments are as Container returns them.
+func Qualify(name, container, receiver string) string {
+	switch {
+	case receiver != "":
+		return "(" + receiver + ")." + name
+	case container != "":
+		return container + "." + name
+	}
+	return name
+}
@@ -0,0 +1,84 @@
+package patterns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContainer(t *testing.T) {
+	tests := []struct {
+		name, src           string
+		lang                Language
+		container, receiver string
+		line                int
+	}{
+		{"go pointer", "func (g *GrepSearcher) Close() error {", Go, "GrepSearcher", "*GrepSearcher", 1},
+		{"go value", "func (u User) Name() string {", Go, "User", "User", 1},
+		{"go unnamed", "func (*Store) Reset() {", Go, "Store", "*Store", 1},
+		{"go generic", "func (l *List[K, V]) Len() int {", Go, "List", "*List[K, V]", 1},
+		{"go function", "func Close() {", Go, "", "", 1},
+		{"python method", "class Cart:\n    def total(self):", Python, "Cart", "", 2},
+		{"python nested class", "class Cart:\n    class Item:\n        def price(self):", Python, "Cart.Item", "", 3},
+		{"python nested function", "def outer():\n    def inner():", Python, "", "", 2},
+		{"python top level", "def total():", Python, "", "", 1},
+		{"ts method", "export class Cart extends Base {\n  // Sums the items\n\n  total(): number {", TypeScript, "Cart", "", 4},
+		{"ts abstract", "export abstract class Shape {\n  abstract area(): number;", TypeScript, "Shape", "", 2},
+		{"js object method", "const cart = {\n  total() {", JavaScript, "", "", 2},
+		{"js top level", "function total() {", JavaScript, "", "", 1},
+		{"rust impl", "impl Cart {\n    pub fn total(&self) -> u32 {", Rust, "Cart", "", 2},
+		{"rust trait impl", "impl<T: Item> fmt::Display for Cart<T> {\n    fn fmt(&self) {", Rust, "Cart", "", 2},
+		{"rust trait", "pub trait Priced {\n    fn price(&self) -> u32;", Rust, "Priced", "", 2},
+		{"rust in mod", "mod shop {\n    impl Cart {\n        fn total(&self) {}", Rust, "Cart", "", 3},
+		{"rust function", "fn total() {}", Rust, "", "", 1},
+		{"cpp qualified", "void Widget::draw() const {", Cpp, "Widget", "", 1},
+		{"cpp nested qualified", "template <typename T> void ui::Stack<T>::push(const T& v) {", Cpp, "Stack", "", 1},
+		{"cpp in class", "class Widget : public Base {\npublic:\n    void draw() {", Cpp, "Widget", "", 3},
+		{"cpp function", "int main() {", Cpp, "", "", 1},
+		{"ruby method", "class Cart < Base\n  # Sums the items\n  def total", Ruby, "Cart", "", 3},
+		{"ruby module function", "module Shop::Billing\n  def self.charge(cart)", Ruby, "Billing", "", 2},
+		{"ruby top level", "def total", Ruby, "", "", 1},
+		{"php method", "final class Cart extends Base\n{\n    public function total(): int", PHP, "Cart", "", 3},
+		{"php function", "function total() {", PHP, "", "", 1},
+		{"kotlin method", "data class Cart(val items: List<Item>) {\n    fun total(): Int {", Kotlin, "Cart", "", 2},
+		{"kotlin object", "object Registry {\n    private fun reset() {}", Kotlin, "Registry", "", 2},
+		{"kotlin companion", "class Repo {\n    companion object {\n        fun create() = Repo()", Kotlin, "Repo", "", 3},
+		{"swift method", "public struct Cart {\n    func total() -> Int {", Swift, "Cart", "", 2},
+		{"swift extension", "extension Cart: Codable {\n    init(from decoder: Decoder) throws {", Swift, "Cart", "", 2},
+		{"csharp method", "namespace Shop\n{\n    public class Cart\n    {\n        public int Total()", CSharp, "Cart", "", 5},
+		{"csharp record", "public record Point(int X, int Y)\n{\n    public double Length() => 0;", CSharp, "Point", "", 3},
+		{"scala object", "object Users {\n  def apply(name: String): User =", Scala, "Users", "", 2},
+		{"scala trait", "sealed trait Repo:\n  def find(id: Long): Option[User]", Scala, "Repo", "", 2},
+		{"elixir module", "defmodule MyApp.Accounts do\n  def list_users do", Elixir, "Accounts", "", 2},
+		{"elixir protocol", "defprotocol Renderable do\n  def render(data)", Elixir, "Renderable", "", 2},
+		{"zig struct", "pub const Point = struct {\n    pub fn norm(self: Point) f32 {", Zig, "Point", "", 2},
+		{"zig top-level function", "pub fn main() void {", Zig, "", "", 1},
+		{"lua dot", "function Stack.new(items)", Lua, "Stack", "", 1},
+		{"lua colon", "function M.util:join(parts)", Lua, "M.util", "", 1},
+		{"lua plain function", "local function trim(s)\n  local function inner()", Lua, "", "", 2},
+		{"kotlin function", "fun total() = 0", Kotlin, "", "", 1},
+		{"out of range", "func (u User) Name() {", Go, "", "", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			container, receiver := Container(tt.lang, strings.Split(tt.src, "\n"), tt.line)
+			if container != tt.container || receiver != tt.receiver {
+				t.Errorf("Container() = %q, %q, want %q, %q", container, receiver, tt.container, tt.receiver)
+			}
+		})
+	}
+}
+
+func TestQualify(t *testing.T) {
+	tests := []struct {
+		name, container, receiver, want string
+	}{
+		{"Close", "GrepSearcher", "*GrepSearcher", "(*GrepSearcher).Close"},
+		{"total", "Cart", "", "Cart.total"},
+		{"main", "", "", "main"},
+	}
+	for _, tt := range tests {
+		if got := Qualify(tt.name, tt.container, tt.receiver); got != tt.want {
+			t.Errorf("Qualify(%q, %q, %q) = %q, want %q", tt.name, tt.container, tt.receiver, got, tt.want)
+		}
+	}
+}
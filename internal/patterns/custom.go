@@ -0,0 +1,135 @@
+package patterns
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+)
+
+// Configuration can extend the built-in registry and plugin languages with
+// custom definition patterns and extension mappings. Neither is ever
+// modified; effective holds extended copies for the languages that changed.
+var (
+	customDefs   map[Language][]Pattern
+	extOverrides map[string]Language
+	effective    map[Language]*LanguagePatterns
+)
+
+// SetCustom replaces the user-defined definition patterns, keyed by
+// language. They're appended after the built-in patterns, so a built-in
+// kind wins when both match a line. Each regex must have exactly one
+// capture group, around the defined name. Patterns for unsupported
+// languages are ignored, and SetCustom(nil) restores the built-in patterns.
+func SetCustom(defs map[Language][]Pattern) {
+	customDefs = defs
+	rebuild()
+}
+
+// SetExtensions replaces the extension-to-language overrides consulted by
+// DetectLanguage. Extensions include the leading dot and match
+// case-insensitively. Mapping an extension to Unknown stops it being
+// detected as any language; SetExtensions(nil) restores the built-in
+// mapping.
+func SetExtensions(exts map[string]Language) {
+	extOverrides = nil
+	for ext, lang := range exts {
+		if extOverrides == nil {
+			extOverrides = make(map[string]Language, len(exts))
+		}
+		extOverrides[strings.ToLower(ext)] = lang
+	}
+	rebuild()
+}
+
+// rebuild recomputes effective from the registry, the plugin languages,
+// and the overrides.
+func rebuild() {
+	effective = nil
+	for _, lang := range AllLanguages() {
+		base := declared(lang)
+		defs := customDefs[lang]
+		exts := overriddenExtensions(lang, base.Extensions)
+		if len(defs) == 0 && slices.Equal(exts, base.Extensions) {
+			continue
+		}
+
+		lp := *base
+		lp.Extensions = exts
+		lp.Definition = slices.Clip(base.Definition)
+		for _, p := range defs {
+			p.Custom = true
+			lp.Definition = append(lp.Definition, p)
+		}
+		if effective == nil {
+			effective = make(map[Language]*LanguagePatterns)
+		}
+		effective[lang] = &lp
+	}
+}
+
+// overriddenExtensions applies extOverrides to a language's built-in
+// extensions: mapped-away extensions are dropped and newly mapped ones are
+// appended in sorted order.
+func overriddenExtensions(lang Language, builtin []string) []string {
+	if extOverrides == nil {
+		return builtin
+	}
+	exts := make([]string, 0, len(builtin))
+	for _, ext := range builtin {
+		if to, ok := extOverrides[ext]; !ok || to == lang {
+			exts = append(exts, ext)
+		}
+	}
+	var added []string
+	for ext, to := range extOverrides {
+		if to == lang && !slices.Contains(builtin, ext) {
+			added = append(added, ext)
+		}
+	}
+	slices.Sort(added)
+	return append(exts, added...)
+}
+
+// DefinitionsFor returns the definition patterns that apply to a file with
+// extension ext: every pattern without an extension restriction, plus the
+// ones whose Extensions (lowercase) include ext.
+func (lp *LanguagePatterns) DefinitionsFor(ext string) []Pattern {
+	ext = strings.ToLower(ext)
+	defs := make([]Pattern, 0, len(lp.Definition))
+	for _, p := range lp.Definition {
+		if len(p.Extensions) == 0 || slices.Contains(p.Extensions, ext) {
+			defs = append(defs, p)
+		}
+	}
+	return defs
+}
+
+// customDefinition builds the symbol-specific version of a custom pattern by
+// replacing its capture group with sym, an already-quoted symbol regex.
+func customDefinition(p Pattern, sym string) (*regexp.Regexp, error) {
+	re, err := syntax.Parse(p.Regex.String(), syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	name, err := syntax.Parse(sym, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	replaceCapture(re, name)
+	return regexp.Compile(re.String())
+}
+
+// replaceCapture substitutes with for the first capture group in re.
+func replaceCapture(re, with *syntax.Regexp) bool {
+	if re.Op == syntax.OpCapture {
+		*re = *with
+		return true
+	}
+	for _, sub := range re.Sub {
+		if replaceCapture(sub, with) {
+			return true
+		}
+	}
+	return false
+}
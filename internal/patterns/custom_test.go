@@ -0,0 +1,122 @@
+package patterns
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestSetCustom(t *testing.T) {
+	t.Cleanup(func() { SetCustom(nil) })
+	builtin := len(ForLanguage(Python).Definition)
+
+	SetCustom(map[Language][]Pattern{
+		Python: {
+			{Regex: regexp.MustCompile(`register_task\("(\w+)"`), Kind: "task"},
+			{Regex: regexp.MustCompile(`^DEFINE_METRIC\((\w+)`), Kind: "metric", Extensions: []string{".pyi"}},
+		},
+		Unknown: {{Regex: regexp.MustCompile(`(x)`), Kind: "ignored"}},
+	})
+
+	lp := ForLanguage(Python)
+	if got := len(lp.Definition); got != builtin+2 {
+		t.Fatalf("len(Definition) = %d, want %d built-in + 2 custom", got, builtin)
+	}
+	if last := lp.Definition[len(lp.Definition)-1]; !last.Custom || last.Kind != "metric" {
+		t.Errorf("last pattern = %+v, want the custom metric pattern", last)
+	}
+	if got := len(lp.DefinitionsFor(".py")); got != builtin+1 {
+		t.Errorf("len(DefinitionsFor(.py)) = %d, want %d (metric is .pyi only)", got, builtin+1)
+	}
+	if got := len(lp.DefinitionsFor(".pyi")); got != builtin+2 {
+		t.Errorf("len(DefinitionsFor(.pyi)) = %d, want %d", got, builtin+2)
+	}
+	if got := len(ForLanguage(Go).Definition); got != len(registry[Go].Definition) {
+		t.Errorf("Go has %d patterns, want the built-in %d", got, len(registry[Go].Definition))
+	}
+
+	SetCustom(nil)
+	if got := len(ForLanguage(Python).Definition); got != builtin {
+		t.Errorf("after SetCustom(nil): len(Definition) = %d, want %d", got, builtin)
+	}
+}
+
+func TestDefinitionPatternFor_Custom(t *testing.T) {
+	t.Cleanup(func() { SetCustom(nil) })
+	SetCustom(map[Language][]Pattern{
+		Go: {{Regex: regexp.MustCompile(`^\s*DEFINE_METRIC\(\s*([A-Za-z_]\w*)\s*,`), Kind: "metric"}},
+	})
+
+	tests := []struct {
+		name   string
+		symbol string
+		line   string
+		fold   bool
+		want   bool
+	}{
+		{name: "exact", symbol: "requests_total", line: "DEFINE_METRIC(requests_total, counter)", want: true},
+		{name: "other name", symbol: "requests_total", line: "DEFINE_METRIC(errors_total, counter)", want: false},
+		{name: "prefix only", symbol: "requests", line: "DEFINE_METRIC(requests_total, counter)", want: false},
+		{name: "metacharacters quoted", symbol: "a.b", line: "DEFINE_METRIC(axb, counter)", want: false},
+		{name: "folded", symbol: "REQUESTS_TOTAL", line: "DEFINE_METRIC(requests_total, counter)", fold: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := DefinitionPatternFor(tt.symbol, Go)
+			if tt.fold {
+				res = DefinitionPatternForFold(tt.symbol, Go)
+			}
+			got := false
+			for _, re := range res {
+				if re.MatchString(tt.line) {
+					got = true
+				}
+			}
+			if got != tt.want {
+				t.Errorf("match %q for %q = %v, want %v", tt.line, tt.symbol, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetExtensions(t *testing.T) {
+	t.Cleanup(func() { SetExtensions(nil) })
+	SetExtensions(map[string]Language{
+		".gohtml": Go,
+		".BZL":    Python,
+		".tsx":    Unknown,
+	})
+
+	tests := []struct {
+		ext  string
+		want Language
+	}{
+		{".gohtml", Go},
+		{".GOHTML", Go},
+		{".bzl", Python},
+		{".tsx", Unknown}, // removed
+		{".ts", TypeScript},
+		{".go", Go},
+	}
+	for _, tt := range tests {
+		if got := DetectLanguage(tt.ext); got != tt.want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", tt.ext, got, tt.want)
+		}
+	}
+
+	if got, want := ForLanguage(Go).Extensions, []string{".go", ".gohtml"}; !slices.Equal(got, want) {
+		t.Errorf("Go extensions = %v, want %v", got, want)
+	}
+	if got, want := ForLanguage(TypeScript).Extensions, []string{".ts"}; !slices.Equal(got, want) {
+		t.Errorf("TypeScript extensions = %v, want %v", got, want)
+	}
+
+	SetExtensions(nil)
+	if got := DetectLanguage(".gohtml"); got != Unknown {
+		t.Errorf("after SetExtensions(nil): DetectLanguage(.gohtml) = %q, want unknown", got)
+	}
+	if got := ForLanguage(TypeScript).Extensions; !slices.Contains(got, ".tsx") {
+		t.Errorf("after SetExtensions(nil): TypeScript extensions = %v, want .tsx restored", got)
+	}
+}
@@ -0,0 +1,189 @@
+package patterns
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// goDirective matches a Go directive comment such as //go:generate or
+	// //nolint:errcheck, which isn't part of the documentation.
+	goDirective = regexp.MustCompile(`^//[a-z0-9]+:[a-z0-9]`)
+	// pyDocstring matches the opening of a Python docstring; group 1 is its
+	// quotes.
+	pyDocstring = regexp.MustCompile(`^[rRuU]?("""|''')`)
+	// sentenceEnd matches the end of a summary's first sentence.
+	sentenceEnd = regexp.MustCompile(`[.!?](?:\s|$)`)
+)
+
+// DocComment returns the documentation of the definition on line n, 1-based,
+// of lines, with the comment markers removed and lines joined with "\n", or
+// "" if there's none.
+//
+// Documentation is the contiguous block of comment lines (//, ///, or #) or
+// the block comment (/* */ or /** */) ending right above the definition,
+// past any decorators or attributes, or in Python, preferably the docstring
+// that starts its body. Go directives such as //go:generate are left out,
+// as are JSDoc tags from the first @tag line on.
+func DocComment(lang Language, lines []string, n int) string {
+	if n < 1 || n > len(lines) {
+		return ""
+	}
+	if lang == Python {
+		if doc := pythonDocstring(lines, n); doc != "" {
+			return doc
+		}
+	}
+	lp := ForLanguage(lang)
+	if lp == nil || lp.Syntax == nil {
+		return ""
+	}
+
+	i := n - 1 // Index of the line above the definition
+	for i > 0 && lp.Annotation != nil && lp.Annotation.MatchString(lines[i-1]) {
+		i--
+	}
+	if i == 0 {
+		return ""
+	}
+	above := strings.TrimSpace(lines[i-1])
+	if len(lp.Syntax.BlockComment) > 0 && strings.HasSuffix(above, lp.Syntax.BlockComment[0][1]) {
+		return blockDoc(lines[:i], lp.Syntax.BlockComment[0])
+	}
+
+	var doc []string
+	for ; i > 0; i-- {
+		line := strings.TrimSpace(lines[i-1])
+		marker := commentMarker(line, lp.Syntax.LineComment)
+		if marker == "" {
+			break
+		}
+		if lang == Go && goDirective.MatchString(line) {
+			continue
+		}
+		text := strings.TrimLeft(line[len(marker):], "/!")
+		doc = append(doc, strings.TrimPrefix(text, " "))
+	}
+	for l, r := 0, len(doc)-1; l < r; l, r = l+1, r-1 {
+		doc[l], doc[r] = doc[r], doc[l]
+	}
+	return strings.TrimSpace(strings.Join(doc, "\n"))
+}
+
+// commentMarker returns the one of markers line starts with, or "".
+func commentMarker(line string, markers []string) string {
+	for _, m := range markers {
+		if strings.HasPrefix(line, m) {
+			return m
+		}
+	}
+	return ""
+}
+
+// blockDoc returns the text of the block comment, delimited by delims, that
+// ends on the last of lines, less the leading asterisks of its lines and any
+// JSDoc tags.
+func blockDoc(lines []string, delims [2]string) string {
+	end := len(lines) - 1
+	start := end
+	for start >= 0 && !strings.Contains(lines[start], delims[0]) {
+		start--
+	}
+	if start < 0 {
+		return ""
+	}
+	var doc []string
+	for i := start; i <= end; i++ {
+		line := strings.TrimSpace(lines[i])
+		if i == start {
+			line = line[strings.Index(line, delims[0])+len(delims[0]):]
+			line = strings.TrimLeft(line, "*!")
+		}
+		if i == end {
+			line = strings.TrimSuffix(line, delims[1])
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "*"))
+		if strings.HasPrefix(line, "@") {
+			break
+		}
+		doc = append(doc, line)
+	}
+	return strings.TrimSpace(strings.Join(doc, "\n"))
+}
+
+// pythonDocstring returns the docstring starting the body of the definition
+// on line n of lines, without its quotes, or "" if the body doesn't start
+// with one.
+func pythonDocstring(lines []string, n int) string {
+	// The header ends where its brackets balance; the body starts after it
+	// if it ends in a colon, as a one-line definition's doesn't
+	i, depth := n-1, 0
+	for ; i < len(lines); i++ {
+		depth += strings.Count(lines[i], "(") + strings.Count(lines[i], "[") -
+			strings.Count(lines[i], ")") - strings.Count(lines[i], "]")
+		if depth <= 0 {
+			break
+		}
+	}
+	if i >= len(lines) || !strings.HasSuffix(strings.TrimSpace(stripHashComment(lines[i])), ":") {
+		return ""
+	}
+	i++
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+	if i >= len(lines) {
+		return ""
+	}
+	first := strings.TrimSpace(lines[i])
+	m := pyDocstring.FindStringSubmatch(first)
+	if m == nil {
+		return ""
+	}
+	quotes := m[1]
+	rest := first[len(m[0]):]
+	if j := strings.Index(rest, quotes); j >= 0 {
+		return strings.TrimSpace(rest[:j])
+	}
+	doc := []string{rest}
+	for i++; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if j := strings.Index(line, quotes); j >= 0 {
+			doc = append(doc, line[:j])
+			break
+		}
+		doc = append(doc, line)
+	}
+	return strings.TrimSpace(strings.Join(doc, "\n"))
+}
+
+// stripHashComment removes a # comment from a Python line, ignoring the
+// possibility of a # in a string.
+func stripHashComment(line string) string {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+// DocSummary returns the first sentence of doc, the documentation of name in
+// lang as DocComment returns it, on one line: up to the first period,
+// question mark, or exclamation mark ending a sentence, or else the end of
+// the first paragraph. In Go, where a comment conventionally starts with the
+// name it documents, as in "User represents a user", the name and any
+// article before it are dropped, leaving "represents a user".
+func DocSummary(lang Language, doc, name string) string {
+	para, _, _ := strings.Cut(doc, "\n\n")
+	summary := strings.Join(strings.Fields(para), " ")
+	if loc := sentenceEnd.FindStringIndex(summary); loc != nil {
+		summary = summary[:loc[0]+1]
+	}
+	if lang == Go && name != "" {
+		for _, article := range []string{"", "A ", "An ", "The "} {
+			if rest, ok := strings.CutPrefix(summary, article+name+" "); ok {
+				return rest
+			}
+		}
+	}
+	return summary
+}
@@ -0,0 +1,123 @@
+package patterns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocComment(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+		lang Language
+		line int
+	}{
+		{
+			name: "go line comments",
+			src:  "package x\n\n// User is a user.\n//\n// It has a name.\ntype User struct{}\n",
+			lang: Go, line: 6,
+			want: "User is a user.\n\nIt has a name.",
+		},
+		{
+			name: "go directive left out",
+			src:  "// Kind is a kind.\n//go:generate stringer -type Kind\ntype Kind int\n",
+			lang: Go, line: 3,
+			want: "Kind is a kind.",
+		},
+		{
+			name: "blank line detaches a comment",
+			src:  "// Section header\n\nfunc f() {}\n",
+			lang: Go, line: 3,
+			want: "",
+		},
+		{
+			name: "trailing comment on code isn't documentation",
+			src:  "x := 1 // one\nfunc f() {}\n",
+			lang: Go, line: 2,
+			want: "",
+		},
+		{
+			name: "jsdoc past a decorator",
+			src:  "/**\n * Handles users.\n * @param id the user\n */\n@Injectable()\nexport class UserHandler {\n",
+			lang: TypeScript, line: 6,
+			want: "Handles users.",
+		},
+		{
+			name: "one-line block comment",
+			src:  "/* Formats a price. */\nfunction format() {}\n",
+			lang: JavaScript, line: 2,
+			want: "Formats a price.",
+		},
+		{
+			name: "rust doc past attributes",
+			src:  "/// A user.\n/// With a name.\n#[derive(Debug)]\npub struct User {\n",
+			lang: Rust, line: 4,
+			want: "A user.\nWith a name.",
+		},
+		{
+			name: "python docstring",
+			src:  "def load(\n    path,\n):\n    \"\"\"Load settings.\n\n    From a file.\n    \"\"\"\n",
+			lang: Python, line: 1,
+			want: "Load settings.\n\nFrom a file.",
+		},
+		{
+			name: "python one-line docstring",
+			src:  "class User:\n    '''A user.'''\n",
+			lang: Python, line: 1,
+			want: "A user.",
+		},
+		{
+			name: "python comment when there's no docstring",
+			src:  "# Adds one.\n@cache\ndef inc(x):\n    return x + 1\n",
+			lang: Python, line: 3,
+			want: "Adds one.",
+		},
+		{
+			name: "python one-liner has no body docstring",
+			src:  "def f(): pass\n\"\"\"Not f's.\"\"\"\n",
+			lang: Python, line: 1,
+			want: "",
+		},
+		{
+			name: "first line",
+			src:  "// Top.\nfunc f() {}\n",
+			lang: Go, line: 1,
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := strings.Split(strings.TrimSuffix(tt.src, "\n"), "\n")
+			if got := DocComment(tt.lang, lines, tt.line); got != tt.want {
+				t.Errorf("DocComment() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocSummary(t *testing.T) {
+	tests := []struct {
+		doc  string
+		name string
+		want string
+		lang Language
+	}{
+		{"User represents a user. It has a name.", "User", "represents a user.", Go},
+		{"A Store holds items\nin memory.\n\nMore detail.", "Store", "holds items in memory.", Go},
+		{"Users are people.", "User", "Users are people.", Go},
+		{"Handles users", "UserHandler", "Handles users", TypeScript},
+		{"User represents a user.", "User", "User represents a user.", Python},
+		{"Version 1.2 of the API.", "API", "Version 1.2 of the API.", Rust},
+		{"", "f", "", Go},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.doc, func(t *testing.T) {
+			if got := DocSummary(tt.lang, tt.doc, tt.name); got != tt.want {
+				t.Errorf("DocSummary(%q) = %q, want %q", tt.doc, got, tt.want)
+			}
+		})
+	}
+}
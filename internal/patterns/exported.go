@@ -0,0 +1,104 @@
+package patterns
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// jsExport matches a top-level export, export default included.
+	jsExport = regexp.MustCompile(`^export\b`)
+	// jsPrivateMember matches a class member hidden from other code: a TS
+	// private or protected modifier, or a #private name.
+	jsPrivateMember = regexp.MustCompile(`^(?:(?:static|async|readonly|override|abstract|get|set)\s+)*(?:private\b|protected\b|#)`)
+	// rustPub matches pub visibility, but not the restricted pub(crate)
+	// and pub(super), which stay inside the crate.
+	rustPub = regexp.MustCompile(`^pub\s`)
+	// cStatic matches a static C definition, which has internal linkage and
+	// so stays in its file.
+	cStatic = regexp.MustCompile(`^static\b`)
+	// kotlinPrivate matches a Kotlin declaration that's private, protected,
+	// or internal to its module.
+	kotlinPrivate = regexp.MustCompile(`^(?:(?:open|abstract|final|override|suspend|inline|operator|infix|tailrec|data|sealed|enum|annotation|inner|value|const|lateinit)\s+)*(?:private|protected|internal)\b`)
+	// swiftPublic matches a Swift declaration that's public or open, and so
+	// visible outside its module.
+	swiftPublic = regexp.MustCompile(`^(?:@[\p{L}_][\p{L}\p{Nd}_.]*(?:\([^)]*\))?\s+)*(?:(?:final|static|class|override|mutating|nonmutating|convenience|required|dynamic|lazy|weak|unowned|indirect|nonisolated)\s+)*(?:public|open)\b`)
+	// csharpPublic matches a C# declaration that's public or protected, and
+	// so part of its assembly's API.
+	csharpPublic = regexp.MustCompile(`^(?:(?:static|async|override|virtual|abstract|sealed|readonly|unsafe|extern|new|partial|required|const)\s+)*(?:public|protected)\b`)
+	// scalaPrivate matches a Scala definition that's private or protected,
+	// qualified or not.
+	scalaPrivate = regexp.MustCompile(`^(?:(?:implicit|final|override|sealed|abstract|lazy|case|inline|opaque|transparent|open)\s+)*(?:private|protected)\b`)
+	// zigPub matches a Zig declaration that's pub, or export, which makes it
+	// visible to C.
+	zigPub = regexp.MustCompile(`^(?:pub|export)\s`)
+	// luaLocal matches a Lua definition local to its file.
+	luaLocal = regexp.MustCompile(`^local\b`)
+	// elixirPrivate matches an Elixir function or macro private to its
+	// module.
+	elixirPrivate = regexp.MustCompile(`^(?:defp|defmacrop)\b`)
+	// phpPrivateMember matches a PHP class member hidden from other code.
+	phpPrivateMember = regexp.MustCompile(`^(?:(?:static|abstract|final|readonly)\s+)*(?:private|protected)\b`)
+)
+
+// IsExported reports whether the definition of name on line, its full source
+// line, is visible outside its package or module by lang's rules:
+//
+//   - Go: the name starts with an uppercase letter, in Unicode's sense
+//   - TypeScript and JavaScript: a top-level definition is exported, export
+//     default included; an indented class member is unless it's private,
+//     protected, or a #name
+//   - Rust: the definition is pub, not pub(crate) or pub(super)
+//   - C: the definition isn't static
+//   - Zig: the definition is pub or export
+//   - Kotlin: the definition isn't private, protected, or internal
+//   - Swift: the definition is public or open
+//   - C#: the definition is public or protected
+//   - Scala: the definition isn't private or protected
+//   - Elixir: the definition isn't a defp or defmacrop
+//   - Lua: the definition isn't local
+//   - PHP: a top-level definition is exported, and so is a class member
+//     unless it's private or protected
+//   - Python: the name doesn't start with an underscore, though dunder
+//     methods such as __init__ are public
+//
+// Languages without rules treat every definition as exported.
+func IsExported(lang Language, name, line string) bool {
+	trimmed := strings.TrimLeft(line, " \t")
+	switch lang {
+	case Go:
+		r, _ := utf8.DecodeRuneInString(name)
+		return unicode.Is(unicode.Lu, r)
+	case TypeScript, JavaScript:
+		if trimmed == line {
+			return jsExport.MatchString(line)
+		}
+		return !jsPrivateMember.MatchString(trimmed)
+	case Rust:
+		return rustPub.MatchString(trimmed)
+	case C:
+		return !cStatic.MatchString(trimmed)
+	case Zig:
+		return zigPub.MatchString(trimmed)
+	case PHP:
+		return !phpPrivateMember.MatchString(trimmed)
+	case Kotlin:
+		return !kotlinPrivate.MatchString(trimmed)
+	case Swift:
+		return swiftPublic.MatchString(trimmed)
+	case CSharp:
+		return csharpPublic.MatchString(trimmed)
+	case Scala:
+		return !scalaPrivate.MatchString(trimmed)
+	case Elixir:
+		return !elixirPrivate.MatchString(trimmed)
+	case Lua:
+		return !luaLocal.MatchString(trimmed)
+	case Python:
+		dunder := len(name) > 4 && strings.HasPrefix(name, "__") && strings.HasSuffix(name, "__")
+		return dunder || !strings.HasPrefix(name, "_")
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package patterns
+
+import "testing"
+
+func TestIsExported(t *testing.T) {
+	tests := []struct {
+		name string
+		sym  string
+		line string
+		lang Language
+		want bool
+	}{
+		{"go exported", "User", "type User struct {", Go, true},
+		{"go unexported", "user", "type user struct {", Go, false},
+		{"go underscore", "_User", "var _User = 1", Go, false},
+		{"go unicode uppercase", "Ärger", "func Ärger() {", Go, true},
+		{"go unicode lowercase", "élan", "func élan() {", Go, false},
+		{"go uncased letter", "日本", "func 日本() {", Go, false},
+		{"ts export", "formatPrice", "export function formatPrice(amount: number) {", TypeScript, true},
+		{"ts export default", "App", "export default class App {", TypeScript, true},
+		{"ts unexported", "helper", "function helper() {", TypeScript, false},
+		{"ts public member", "getUser", "  async getUser(id: number) {", TypeScript, true},
+		{"ts private member", "load", "  private async load() {", TypeScript, false},
+		{"ts static protected member", "create", "  static protected create() {", TypeScript, false},
+		{"js private name", "#reset", "  #reset() {", JavaScript, false},
+		{"js export", "createUser", "export async function createUser() {", JavaScript, true},
+		{"rust pub", "new", "    pub fn new() -> Self {", Rust, true},
+		{"rust pub crate", "helper", "pub(crate) fn helper() {", Rust, false},
+		{"rust private", "helper", "fn helper() {", Rust, false},
+		{"c extern", "parse", "int parse(const char *s) {", C, true},
+		{"c static", "helper", "static inline int helper(void) {", C, false},
+		{"c macro", "MAX", "#define MAX 10", C, true},
+		{"kotlin public", "load", "fun load(): User {", Kotlin, true},
+		{"kotlin private", "helper", "private fun helper() {", Kotlin, false},
+		{"kotlin internal", "Cache", "internal object Cache {", Kotlin, false},
+		{"kotlin override protected", "onStart", "    override protected fun onStart() {", Kotlin, false},
+		{"swift public", "load", "public func load() {", Swift, true},
+		{"swift open", "viewDidLoad", "    override open func viewDidLoad() {", Swift, true},
+		{"swift attribute", "reload", "@MainActor public func reload() {", Swift, true},
+		{"swift internal", "helper", "func helper() {", Swift, false},
+		{"swift private", "cache", "    private static var cache = [:]", Swift, false},
+		{"csharp public", "GetUser", "        public async Task<User> GetUser(int id)", CSharp, true},
+		{"csharp protected", "OnSave", "        protected virtual void OnSave()", CSharp, true},
+		{"csharp static public", "Main", "    static public void Main()", CSharp, true},
+		{"csharp private", "Load", "        private void Load()", CSharp, false},
+		{"csharp internal", "Cache", "internal class Cache", CSharp, false},
+		{"csharp default", "Count", "        int Count() { return 0; }", CSharp, false},
+		{"scala public", "apply", "  def apply(name: String): User =", Scala, true},
+		{"scala private", "validate", "  private def validate(): Boolean =", Scala, false},
+		{"scala qualified private", "cache", "  private[service] val cache = 1", Scala, false},
+		{"scala override protected", "init", "  override protected def init(): Unit = {", Scala, false},
+		{"elixir def", "list_users", "  def list_users do", Elixir, true},
+		{"elixir defp", "normalize", "  defp normalize(email) do", Elixir, false},
+		{"elixir defmacrop", "debug", "  defmacrop debug(msg) do", Elixir, false},
+		{"elixir module", "Accounts", "defmodule MyApp.Accounts do", Elixir, true},
+		{"zig pub", "init", "    pub fn init() Self {", Zig, true},
+		{"zig export", "add", "export fn add(a: i32, b: i32) i32 {", Zig, true},
+		{"zig private", "helper", "fn helper() void {", Zig, false},
+		{"lua global", "greet", "function greet(name)", Lua, true},
+		{"lua method", "push", "function Stack:push(item)", Lua, true},
+		{"lua local", "trim", "local function trim(s)", Lua, false},
+		{"lua local assignment", "validate", "local validate = function(input)", Lua, false},
+		{"php function", "render", "function render($view) {", PHP, true},
+		{"php public method", "save", "    public function save() {", PHP, true},
+		{"php implicit public method", "legacy", "    function legacy() {", PHP, true},
+		{"php private method", "validate", "    private function validate() {", PHP, false},
+		{"php static protected method", "boot", "    static protected function boot() {", PHP, false},
+		{"php private const", "LIMIT", "    private const LIMIT = 10;", PHP, false},
+		{"python public", "load_settings", "def load_settings(path):", Python, true},
+		{"python private", "_cache", "    def _cache(self):", Python, false},
+		{"python dunder", "__init__", "    def __init__(self):", Python, true},
+		{"unknown language", "x", "x", Unknown, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsExported(tt.lang, tt.sym, tt.line); got != tt.want {
+				t.Errorf("IsExported(%q, %q, %q) = %v, want %v", tt.lang, tt.sym, tt.line, got, tt.want)
+			}
+		})
+	}
+}
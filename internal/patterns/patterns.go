@@ -1,7 +1,15 @@
 // Package patterns provides language-specific regex patterns for code search.
 package patterns
 
-import "regexp"
+import (
+	"bytes"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 // Language represents a programming language.
 type Language string
@@ -12,21 +20,83 @@ const (
 	JavaScript Language = "js"
 	Python     Language = "py"
 	Rust       Language = "rust"
+	C          Language = "c"
+	Cpp        Language = "cpp"
+	Ruby       Language = "ruby"
+	PHP        Language = "php"
+	Kotlin     Language = "kotlin"
+	Swift      Language = "swift"
+	CSharp     Language = "csharp"
+	Scala      Language = "scala"
+	Elixir     Language = "elixir"
+	Zig        Language = "zig"
+	Lua        Language = "lua"
 	Unknown    Language = ""
 )
 
 // Pattern holds a compiled regex and metadata about what it matches.
 type Pattern struct {
 	Regex *regexp.Regexp
-	Kind  string // "function", "type", "method", "interface", "const", "var"
+	Kind  string // "function", "type", "method", "interface", "const", "var", "component", "macro", "namespace"
+	// Block restricts the pattern to the members of a block of grouped
+	// declarations of this kind, such as "const" for Go's const ( ... ), as
+	// Blocks tracks them; "" applies it on any line.
+	Block string
+	// Extensions restricts the pattern to files with these extensions; nil
+	// applies it to every file in the language.
+	Extensions []string
+	// Custom marks a pattern from configuration, registered with SetCustom
+	// or in a plugin language, whose capture group is the name.
+	Custom bool
+	// Wrapped marks a pattern that matches only the start of a definition
+	// whose parameter list runs on past the line, up to its opening
+	// parenthesis; LanguagePatterns.Unwraps confirms the rest.
+	Wrapped bool
 }
 
 // LanguagePatterns holds all definition patterns for a language.
 type LanguagePatterns struct {
-	Language   Language
+	Language Language
+	// IdentExtra lists the characters besides letters, digits, and _ that
+	// identifiers can contain, such as $ in JavaScript.
+	IdentExtra string
+	// TestPath matches the directories test files live in, against a
+	// file's directory written with slashes between leading and trailing
+	// ones, as in /src/__tests__/; nil if the language has no such
+	// convention. See IsTestFile.
+	TestPath *regexp.Regexp
+	// TestBlock matches a line that makes its file a test file wherever it
+	// lives, as a Zig test "name" block does; nil if nothing in a file
+	// does. See IsTestSource.
+	TestBlock *regexp.Regexp
+	// Source is the file a plugin language was declared in; "" for a
+	// built-in language.
+	Source     string
 	TestFile   *regexp.Regexp // Pattern to identify test files
+	Annotation *regexp.Regexp // Decorator/attribute line; group 1 is the name (nil if unsupported)
+	// BlockStart opens a block of grouped declarations, with group 1 its
+	// kind, and BlockEnd closes it; nil if the language has none. See
+	// Pattern.Block.
+	BlockStart *regexp.Regexp
+	BlockEnd   *regexp.Regexp
+	// WrappedEnd matches what follows the parameter list of a definition a
+	// Wrapped pattern matched, on the line the list closes; see Unwraps.
+	WrappedEnd *regexp.Regexp
+	Syntax     *Syntax // Comment and string delimiters (nil if unknown)
 	Definition []Pattern
+	// References classify references, tried in order; see ClassifyRef
+	References []RefRule
 	Extensions []string
+	// Filenames lists the file names, such as Makefile, that are in the
+	// language whatever their extension; only plugin languages have them.
+	Filenames []string
+	// Reserved lists keywords that a definition pattern could take for a
+	// name, like if in "  if (ok) {" for a method pattern; such matches
+	// aren't definitions.
+	Reserved []string
+	// Branches lists the keywords that branch or loop, counted as a rough
+	// measure of a definition's complexity.
+	Branches []string
 }
 
 // registry maps languages to their patterns.
@@ -36,18 +106,38 @@ var registry = map[Language]*LanguagePatterns{
 	JavaScript: jsPatterns(),
 	Python:     pythonPatterns(),
 	Rust:       rustPatterns(),
+	C:          cPatterns(),
+	Cpp:        cppPatterns(),
+	Ruby:       rubyPatterns(),
+	PHP:        phpPatterns(),
+	Kotlin:     kotlinPatterns(),
+	Swift:      swiftPatterns(),
+	CSharp:     csharpPatterns(),
+	Scala:      scalaPatterns(),
+	Elixir:     elixirPatterns(),
+	Zig:        zigPatterns(),
+	Lua:        luaPatterns(),
 }
 
-// ForLanguage returns patterns for the given language.
+// ForLanguage returns patterns for the given language, including plugin
+// languages and any changes made by SetCustom and SetExtensions.
 func ForLanguage(lang Language) *LanguagePatterns {
-	if p, ok := registry[lang]; ok {
+	if p, ok := effective[lang]; ok {
 		return p
 	}
-	return nil
+	return declared(lang)
 }
 
-// DetectLanguage determines language from file extension.
+// DetectLanguage determines language from file extension, honoring any
+// overrides registered with SetExtensions and the extensions of plugin
+// languages.
 func DetectLanguage(ext string) Language {
+	if lang, ok := extOverrides[strings.ToLower(ext)]; ok {
+		return lang
+	}
+	if lang, ok := pluginExts[strings.ToLower(ext)]; ok {
+		return lang
+	}
 	switch ext {
 	case ".go":
 		return Go
@@ -59,17 +149,44 @@ func DetectLanguage(ext string) Language {
 		return Python
 	case ".rs":
 		return Rust
+	case ".c", ".h":
+		return C
+	case ".cpp", ".cc", ".cxx", ".hpp", ".hh":
+		return Cpp
+	case ".rb":
+		return Ruby
+	case ".php":
+		return PHP
+	case ".kt", ".kts":
+		return Kotlin
+	case ".swift":
+		return Swift
+	case ".cs":
+		return CSharp
+	case ".scala", ".sc":
+		return Scala
+	case ".ex", ".exs":
+		return Elixir
+	case ".zig":
+		return Zig
+	case ".lua":
+		return Lua
 	default:
 		return Unknown
 	}
 }
 
-// AllLanguages returns all supported languages.
+// AllLanguages returns all supported languages, built-in and plugin.
 func AllLanguages() []Language {
-	langs := make([]Language, 0, len(registry))
+	langs := make([]Language, 0, len(registry)+len(plugins))
 	for lang := range registry {
 		langs = append(langs, lang)
 	}
+	for lang := range plugins {
+		if registry[lang] == nil {
+			langs = append(langs, lang)
+		}
+	}
 	return langs
 }
 
@@ -81,53 +198,91 @@ func goPatterns() *LanguagePatterns {
 		Definition: []Pattern{
 			// func FunctionName(
 			{
-				Regex: regexp.MustCompile(`^func\s+([A-Za-z_][A-Za-z0-9_]*)\s*\(`),
+				Regex: regexp.MustCompile(`^func\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*\(`),
 				Kind:  "function",
 			},
 			// func (receiver) MethodName(
 			{
-				Regex: regexp.MustCompile(`^func\s+\([^)]+\)\s+([A-Za-z_][A-Za-z0-9_]*)\s*\(`),
+				Regex: regexp.MustCompile(`^func\s+\([^)]+\)\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*\(`),
 				Kind:  "method",
 			},
 			// type TypeName struct/interface
 			{
-				Regex: regexp.MustCompile(`^type\s+([A-Za-z_][A-Za-z0-9_]*)\s+struct\b`),
+				Regex: regexp.MustCompile(`^type\s+([\p{L}_][\p{L}\p{Nd}_]*)\s+struct\b`),
 				Kind:  "type",
 			},
 			{
-				Regex: regexp.MustCompile(`^type\s+([A-Za-z_][A-Za-z0-9_]*)\s+interface\b`),
+				Regex: regexp.MustCompile(`^type\s+([\p{L}_][\p{L}\p{Nd}_]*)\s+interface\b`),
 				Kind:  "interface",
 			},
 			// type TypeName = ... (type alias)
 			{
-				Regex: regexp.MustCompile(`^type\s+([A-Za-z_][A-Za-z0-9_]*)\s+=`),
+				Regex: regexp.MustCompile(`^type\s+([\p{L}_][\p{L}\p{Nd}_]*)\s+=`),
 				Kind:  "type",
 			},
 			// type TypeName SomeOtherType (type definition)
 			{
-				Regex: regexp.MustCompile(`^type\s+([A-Za-z_][A-Za-z0-9_]*)\s+[A-Za-z]`),
+				Regex: regexp.MustCompile(`^type\s+([\p{L}_][\p{L}\p{Nd}_]*)\s+\p{L}`),
 				Kind:  "type",
 			},
 			// const ConstName = (standalone declaration)
 			{
-				Regex: regexp.MustCompile(`^const\s+([A-Z_][A-Za-z0-9_]*)\s*(?:=|[A-Za-z])`),
+				Regex: regexp.MustCompile(`^const\s+([\p{Lu}_][\p{L}\p{Nd}_]*)\s*(?:=|\p{L})`),
 				Kind:  "const",
 			},
-			// Const block member (tab-indented per gofmt)
+			// var VarName = or var VarName Type
+			{
+				Regex: regexp.MustCompile(`^var\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*(?:=|[\p{L}\[])`),
+				Kind:  "var",
+			},
+			// Members of const ( ... ), var ( ... ), and type ( ... ),
+			// tab-indented per gofmt; a const may repeat the one before
+			// it with just its name
 			{
-				Regex: regexp.MustCompile(`^\t([A-Z_][A-Za-z0-9_]*)\s*(?:=|[A-Za-z])`),
+				Regex: regexp.MustCompile(`^\t([\p{L}_][\p{L}\p{Nd}_]*)\s*(?:[=,]|\p{L}|$)`),
 				Kind:  "const",
+				Block: "const",
 			},
-			// var VarName = or var VarName Type
 			{
-				Regex: regexp.MustCompile(`^var\s+([A-Za-z_][A-Za-z0-9_]*)\s*(?:=|[A-Za-z\[])`),
+				Regex: regexp.MustCompile(`^\t([\p{L}_][\p{L}\p{Nd}_]*)\s*(?:[=,]|[\p{L}\[*(])`),
 				Kind:  "var",
+				Block: "var",
+			},
+			{
+				Regex: regexp.MustCompile(`^\t([\p{L}_][\p{L}\p{Nd}_]*)(?:\[|\s+[\p{L}=*\[(])`),
+				Kind:  "type",
+				Block: "type",
 			},
 		},
+		BlockStart: regexp.MustCompile(`^(const|var|type)\s*\(\s*(?://.*)?$`),
+		BlockEnd:   regexp.MustCompile(`^\)`),
+		Syntax: &Syntax{
+			LineComment:  []string{"//"},
+			BlockComment: [][2]string{{"/*", "*/"}},
+			Strings:      []string{`"`, "'"},
+			RawStrings:   []string{"`"},
+		},
+		Branches: []string{"if", "for", "switch", "select", "case"},
+		References: []RefRule{
+			refRule(RefImport, `^\s*import\b`, ""),
+			// &User{...} and []User{...} build values, so this comes first
+			refRule(RefConstruct, "", `^\{`),
+			refRule(RefCall, "", `^\s*\(`),
+			// *User, []User, map[K]User, chan User, x.(User), var u User,
+			// a parameter (u User, or a result type after )
+			refRule(RefType, `(?:\*|\[\]|\]|\bchan\s+|\.\(|\bvar\s+[\p{L}\p{Nd}_]+\s+|[(,]\s*[\p{L}\p{Nd}_]+\s+|\)\s*)$`, ""),
+		},
 		TestFile: regexp.MustCompile(`_test\.go$`),
+		TestPath: regexp.MustCompile(`/(testdata|fixtures)/`),
 	}
 }
 
+// wrappedComponent matches what follows the = of a const that defines a
+// React component through a wrapper: a call to memo, React.memo, forwardRef,
+// or observer, any of them nested, around a function or an arrow function,
+// or a styled-components template such as styled.button` or styled(Link)`.
+const wrappedComponent = `(?:(?:(?:(?:React\.)?(?:memo|forwardRef)|observer)\s*(?:<[^()]*>)?\(\s*)+(?:async\s+)?(?:function\b|\((?:[^()]*|\([^()]*\))*\).*?=>|[\p{L}_$][\p{L}\p{Nd}_$]*\s*=>)|styled(?:\.[\p{L}_$][\p{L}\p{Nd}_$]*|\([^()]*\))\s*(?:<[^\x60]*>)?\s*\x60)`
+
 // tsPatterns returns TypeScript-specific patterns.
 func tsPatterns() *LanguagePatterns {
 	return &LanguagePatterns{
@@ -136,44 +291,101 @@ func tsPatterns() *LanguagePatterns {
 		Definition: []Pattern{
 			// function functionName(
 			{
-				Regex: regexp.MustCompile(`^(?:export\s+)?(?:async\s+)?function\s+([A-Za-z_$][A-Za-z0-9_$]*)\s*[<(]`),
+				Regex: regexp.MustCompile(`^(?:export\s+)?(?:declare\s+)?(?:async\s+)?function\s+([\p{L}_$][\p{L}\p{Nd}_$]*)\s*[<(]`),
 				Kind:  "function",
 			},
 			// const functionName = (): Type => (arrow function with parens, optional return type)
 			{
-				Regex: regexp.MustCompile(`^(?:export\s+)?const\s+([A-Za-z_$][A-Za-z0-9_$]*)\s*=\s*(?:async\s*)?\((?:[^()]*|\([^()]*\))*\).*?=>`),
+				Regex: regexp.MustCompile(`^(?:export\s+)?const\s+([\p{L}_$][\p{L}\p{Nd}_$]*)\s*=\s*(?:async\s*)?\((?:[^()]*|\([^()]*\))*\).*?=>`),
 				Kind:  "function",
 			},
 			// const functionName = x => (arrow function without parens)
 			{
-				Regex: regexp.MustCompile(`^(?:export\s+)?const\s+([A-Za-z_$][A-Za-z0-9_$]*)\s*=\s*(?:async\s+)?[A-Za-z_$][A-Za-z0-9_$]*\s*=>`),
+				Regex: regexp.MustCompile(`^(?:export\s+)?const\s+([\p{L}_$][\p{L}\p{Nd}_$]*)\s*=\s*(?:async\s+)?[\p{L}_$][\p{L}\p{Nd}_$]*\s*=>`),
+				Kind:  "function",
+			},
+			// const Card = memo(({ title }) => or styled.button`, a React
+			// component in .tsx and a function elsewhere
+			{
+				Regex:      regexp.MustCompile(`^(?:export\s+)?const\s+([\p{L}_$][\p{L}\p{Nd}_$]*)\s*=\s*` + wrappedComponent),
+				Kind:       "component",
+				Extensions: []string{".tsx"},
+			},
+			{
+				Regex: regexp.MustCompile(`^(?:export\s+)?const\s+([\p{L}_$][\p{L}\p{Nd}_$]*)\s*=\s*` + wrappedComponent),
 				Kind:  "function",
 			},
+			// const functionName = ( with the parameters on the lines after
+			{
+				Regex:   regexp.MustCompile(`^(?:export\s+)?const\s+([\p{L}_$][\p{L}\p{Nd}_$]*)\s*=\s*(?:async\s*)?\(`),
+				Kind:    "function",
+				Wrapped: true,
+			},
 			// class ClassName
 			{
-				Regex: regexp.MustCompile(`^(?:export\s+)?(?:abstract\s+)?class\s+([A-Za-z_$][A-Za-z0-9_$]*)`),
+				Regex: regexp.MustCompile(`^(?:export\s+)?(?:declare\s+)?(?:abstract\s+)?class\s+([\p{L}_$][\p{L}\p{Nd}_$]*)`),
 				Kind:  "type",
 			},
 			// interface InterfaceName
 			{
-				Regex: regexp.MustCompile(`^(?:export\s+)?interface\s+([A-Za-z_$][A-Za-z0-9_$]*)`),
+				Regex: regexp.MustCompile(`^(?:export\s+)?(?:declare\s+)?interface\s+([\p{L}_$][\p{L}\p{Nd}_$]*)`),
 				Kind:  "interface",
 			},
 			// type TypeName =
 			{
-				Regex: regexp.MustCompile(`^(?:export\s+)?type\s+([A-Za-z_$][A-Za-z0-9_$]*)\s*[<=]`),
+				Regex: regexp.MustCompile(`^(?:export\s+)?(?:declare\s+)?type\s+([\p{L}_$][\p{L}\p{Nd}_$]*)\s*[<=]`),
 				Kind:  "type",
 			},
 			// enum EnumName
 			{
-				Regex: regexp.MustCompile(`^(?:export\s+)?enum\s+([A-Za-z_$][A-Za-z0-9_$]*)`),
+				Regex: regexp.MustCompile(`^(?:export\s+)?(?:declare\s+)?(?:const\s+)?enum\s+([\p{L}_$][\p{L}\p{Nd}_$]*)`),
 				Kind:  "type",
 			},
+			// declare const name: Type, as in a .d.ts declaration file
+			{
+				Regex: regexp.MustCompile(`^(?:export\s+)?declare\s+(?:const|let|var)\s+([\p{L}_$][\p{L}\p{Nd}_$]*)\s*:`),
+				Kind:  "var",
+			},
+			// Indented methodName(...): Type {, as in a class body
+			{
+				Regex: regexp.MustCompile(`^\s+(?:(?:public|private|protected|static|async|readonly|override|abstract|get|set)\s+)*([\p{L}_$][\p{L}\p{Nd}_$]*)\s*(?:<[^>]*>)?\s*\([^)]*\)\s*(?::\s*[^{;=]+)?\{`),
+				Kind:  "method",
+			},
+		},
+		Syntax: &Syntax{
+			LineComment:  []string{"//"},
+			BlockComment: [][2]string{{"/*", "*/"}},
+			Strings:      []string{`"`, "'"},
+			LongStrings:  []string{"`"},
+		},
+		References: []RefRule{
+			refRule(RefImport, `^\s*import\b`, ""),
+			refRule(RefImport, `^\s*export\b`, `\bfrom\s*['"]`),
+			refRule(RefConstruct, `\bnew\s+$`, ""),
+			refRule(RefCall, "", `^\s*(?:<[^<>()]*>)?\s*\(`),
+			// : User, <User>, extends/implements User, x as User
+			refRule(RefType, `(?::|<|\b(?:extends|implements|as|keyof|instanceof))\s*$`, ""),
 		},
-		TestFile: regexp.MustCompile(`\.(test|spec)\.tsx?$`),
+		// features/ at the root holds Cucumber's step definitions; deeper
+		// down it's as likely an app's feature modules
+		TestFile:   regexp.MustCompile(`\.(test|spec|stories)\.tsx?$`),
+		TestPath:   regexp.MustCompile(`/(__tests__|__mocks__|tests?|spec|testdata|fixtures)/|^/features/`),
+		Annotation: regexp.MustCompile(`^\s*@([\p{L}_$][\p{L}\p{Nd}_$.]*)`),
+		// ): ReturnType => of an arrow function
+		WrappedEnd: regexp.MustCompile(`^\s*(?::[^;=]*)?=>`),
+		IdentExtra: "$",
+		Reserved:   jsReserved,
+		Branches:   jsBranches,
 	}
 }
 
+// jsReserved are the JavaScript and TypeScript keywords that can look like a
+// method name followed by its parameters.
+var jsReserved = []string{"if", "for", "while", "switch", "catch", "with", "function", "return", "await", "typeof"}
+
+// jsBranches are the JavaScript and TypeScript keywords that branch or loop.
+var jsBranches = []string{"if", "for", "while", "switch", "case", "catch"}
+
 // jsPatterns returns JavaScript-specific patterns.
 func jsPatterns() *LanguagePatterns {
 	return &LanguagePatterns{
@@ -182,26 +394,69 @@ func jsPatterns() *LanguagePatterns {
 		Definition: []Pattern{
 			// function functionName(
 			{
-				Regex: regexp.MustCompile(`^(?:export\s+)?(?:async\s+)?function\s+([A-Za-z_$][A-Za-z0-9_$]*)\s*\(`),
+				Regex: regexp.MustCompile(`^(?:export\s+)?(?:async\s+)?function\s+([\p{L}_$][\p{L}\p{Nd}_$]*)\s*\(`),
 				Kind:  "function",
 			},
 			// const functionName = (): Type => (arrow function with parens, optional return type)
 			{
-				Regex: regexp.MustCompile(`^(?:export\s+)?const\s+([A-Za-z_$][A-Za-z0-9_$]*)\s*=\s*(?:async\s*)?\((?:[^()]*|\([^()]*\))*\).*?=>`),
+				Regex: regexp.MustCompile(`^(?:export\s+)?const\s+([\p{L}_$][\p{L}\p{Nd}_$]*)\s*=\s*(?:async\s*)?\((?:[^()]*|\([^()]*\))*\).*?=>`),
 				Kind:  "function",
 			},
 			// const functionName = x => (arrow function without parens)
 			{
-				Regex: regexp.MustCompile(`^(?:export\s+)?const\s+([A-Za-z_$][A-Za-z0-9_$]*)\s*=\s*(?:async\s+)?[A-Za-z_$][A-Za-z0-9_$]*\s*=>`),
+				Regex: regexp.MustCompile(`^(?:export\s+)?const\s+([\p{L}_$][\p{L}\p{Nd}_$]*)\s*=\s*(?:async\s+)?[\p{L}_$][\p{L}\p{Nd}_$]*\s*=>`),
+				Kind:  "function",
+			},
+			// const Card = memo(({ title }) => or styled.button`, a React
+			// component in .jsx and a function elsewhere
+			{
+				Regex:      regexp.MustCompile(`^(?:export\s+)?const\s+([\p{L}_$][\p{L}\p{Nd}_$]*)\s*=\s*` + wrappedComponent),
+				Kind:       "component",
+				Extensions: []string{".jsx"},
+			},
+			{
+				Regex: regexp.MustCompile(`^(?:export\s+)?const\s+([\p{L}_$][\p{L}\p{Nd}_$]*)\s*=\s*` + wrappedComponent),
 				Kind:  "function",
 			},
+			// const functionName = ( with the parameters on the lines after
+			{
+				Regex:   regexp.MustCompile(`^(?:export\s+)?const\s+([\p{L}_$][\p{L}\p{Nd}_$]*)\s*=\s*(?:async\s*)?\(`),
+				Kind:    "function",
+				Wrapped: true,
+			},
 			// class ClassName
 			{
-				Regex: regexp.MustCompile(`^(?:export\s+)?class\s+([A-Za-z_$][A-Za-z0-9_$]*)`),
+				Regex: regexp.MustCompile(`^(?:export\s+)?class\s+([\p{L}_$][\p{L}\p{Nd}_$]*)`),
 				Kind:  "type",
 			},
+			// Indented methodName(...) {, as in a class body
+			{
+				Regex: regexp.MustCompile(`^\s+(?:(?:static|async|get|set)\s+)*([\p{L}_$][\p{L}\p{Nd}_$]*)\s*\([^)]*\)\s*\{`),
+				Kind:  "method",
+			},
 		},
-		TestFile: regexp.MustCompile(`\.(test|spec)\.(js|jsx|mjs)$`),
+		Syntax: &Syntax{
+			LineComment:  []string{"//"},
+			BlockComment: [][2]string{{"/*", "*/"}},
+			Strings:      []string{`"`, "'"},
+			LongStrings:  []string{"`"},
+		},
+		References: []RefRule{
+			refRule(RefImport, `^\s*import\b`, ""),
+			refRule(RefImport, `^\s*export\b`, `\bfrom\s*['"]`),
+			refRule(RefImport, `\brequire\(\s*$`, ""),
+			refRule(RefConstruct, `\bnew\s+$`, ""),
+			refRule(RefCall, "", `^\s*\(`),
+			refRule(RefType, `\b(?:extends|instanceof)\s+$`, ""),
+		},
+		TestFile:   regexp.MustCompile(`\.(test|spec|stories)\.(js|jsx|mjs)$`),
+		TestPath:   regexp.MustCompile(`/(__tests__|__mocks__|tests?|spec|testdata|fixtures)/|^/features/`),
+		Annotation: regexp.MustCompile(`^\s*@([\p{L}_$][\p{L}\p{Nd}_$.]*)`),
+		// ): ReturnType => of an arrow function
+		WrappedEnd: regexp.MustCompile(`^\s*(?::[^;=]*)?=>`),
+		IdentExtra: "$",
+		Reserved:   jsReserved,
+		Branches:   jsBranches,
 	}
 }
 
@@ -213,16 +468,36 @@ func pythonPatterns() *LanguagePatterns {
 		Definition: []Pattern{
 			// def function_name(
 			{
-				Regex: regexp.MustCompile(`^(?:async\s+)?def\s+([A-Za-z_][A-Za-z0-9_]*)\s*\(`),
+				Regex: regexp.MustCompile(`^(?:async\s+)?def\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*\(`),
 				Kind:  "function",
 			},
 			// class ClassName
 			{
-				Regex: regexp.MustCompile(`^class\s+([A-Za-z_][A-Za-z0-9_]*)`),
+				Regex: regexp.MustCompile(`^class\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
 				Kind:  "type",
 			},
+			// Indented def method_name(, as in a class body
+			{
+				Regex: regexp.MustCompile(`^\s+(?:async\s+)?def\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*\(`),
+				Kind:  "method",
+			},
+		},
+		Syntax: &Syntax{
+			LineComment: []string{"#"},
+			Strings:     []string{`"`, "'"},
+			LongStrings: []string{`"""`, "'''"},
 		},
-		TestFile: regexp.MustCompile(`(^test_|_test\.py$)`),
+		References: []RefRule{
+			refRule(RefImport, `^\s*(?:from|import)\b`, ""),
+			refRule(RefCall, "", `^\s*\(`),
+			// Annotations (u: User, -> User), base classes, and except clauses
+			refRule(RefType, `(?::|->|^\s*class\s+[\p{L}\p{Nd}_]+\s*\((?:[^)]*,)?|\bexcept\s+\(?)\s*$`, ""),
+		},
+		// features/ at the root holds behave's steps
+		TestFile:   regexp.MustCompile(`(^test_|_test\.py$)`),
+		TestPath:   regexp.MustCompile(`/(tests?|testdata|fixtures)/|^/features/`),
+		Annotation: regexp.MustCompile(`^\s*@([\p{L}_][\p{L}\p{Nd}_.]*)`),
+		Branches:   []string{"if", "elif", "for", "while", "match", "case", "except"},
 	}
 }
 
@@ -234,113 +509,1486 @@ func rustPatterns() *LanguagePatterns {
 		Definition: []Pattern{
 			// fn function_name(
 			{
-				Regex: regexp.MustCompile(`^(?:pub\s+)?(?:async\s+)?fn\s+([A-Za-z_][A-Za-z0-9_]*)\s*[<(]`),
+				Regex: regexp.MustCompile(`^(?:pub\s+)?(?:async\s+)?fn\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*[<(]`),
 				Kind:  "function",
 			},
 			// struct StructName
 			{
-				Regex: regexp.MustCompile(`^(?:pub\s+)?struct\s+([A-Za-z_][A-Za-z0-9_]*)`),
+				Regex: regexp.MustCompile(`^(?:pub\s+)?struct\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
 				Kind:  "type",
 			},
 			// enum EnumName
 			{
-				Regex: regexp.MustCompile(`^(?:pub\s+)?enum\s+([A-Za-z_][A-Za-z0-9_]*)`),
+				Regex: regexp.MustCompile(`^(?:pub\s+)?enum\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
 				Kind:  "type",
 			},
 			// trait TraitName
 			{
-				Regex: regexp.MustCompile(`^(?:pub\s+)?trait\s+([A-Za-z_][A-Za-z0-9_]*)`),
+				Regex: regexp.MustCompile(`^(?:pub\s+)?trait\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
 				Kind:  "interface",
 			},
 			// impl TraitName for or impl StructName
 			{
-				Regex: regexp.MustCompile(`^impl\s+(?:<[^>]+>\s+)?([A-Za-z_][A-Za-z0-9_]*)`),
+				Regex: regexp.MustCompile(`^impl\s+(?:<[^>]+>\s+)?([\p{L}_][\p{L}\p{Nd}_]*)`),
 				Kind:  "type",
 			},
+			// Indented fn method_name(, as in an impl or trait body
+			{
+				Regex: regexp.MustCompile(`^\s+(?:pub(?:\([^)]*\))?\s+)?(?:async\s+)?fn\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*[<(]`),
+				Kind:  "method",
+			},
+		},
+		Syntax: &Syntax{
+			LineComment:  []string{"//"},
+			BlockComment: [][2]string{{"/*", "*/"}},
+			Strings:      []string{`"`},
+		},
+		References: []RefRule{
+			refRule(RefImport, `^\s*(?:pub(?:\([^)]*\))?\s+)?use\b`, ""),
+			// impl User {, -> User {, and &User come before User { builds one
+			refRule(RefType, `(?::|->|&(?:mut\s+)?|<|\b(?:impl(?:<[^>]*>)?|for|dyn|as))\s*$`, ""),
+			refRule(RefType, "", `^::`),
+			refRule(RefConstruct, "", `^\s*\{`),
+			refRule(RefCall, "", `^(?:::<[^>]*>)?!?\s*\(`),
 		},
-		TestFile: regexp.MustCompile(`(^test_|_test\.rs$|/tests/)`),
+		TestFile:   regexp.MustCompile(`(^test_|_test\.rs$)`),
+		TestPath:   regexp.MustCompile(`/(tests|testdata|fixtures)/`),
+		Annotation: regexp.MustCompile(`^\s*#\[\s*([^\]]*?)\s*\]`),
+		Branches:   []string{"if", "for", "while", "loop", "match"},
 	}
 }
 
-// DefinitionPatternFor builds a regex pattern to find definitions of a specific symbol.
-func DefinitionPatternFor(symbol string, lang Language) []*regexp.Regexp {
-	lp := ForLanguage(lang)
-	if lp == nil {
-		return nil
-	}
-
-	// Track seen patterns to avoid duplicates (e.g., multiple "type" patterns
-	// in Go all generate the same symbol-specific regex)
-	seen := make(map[string]bool)
-	var patterns []*regexp.Regexp
-	sym := regexp.QuoteMeta(symbol)
+// identExcept returns a regex matching an identifier other than one of
+// words, which must be letters and _ alone, for ruling keywords out where
+// the regexp package has no lookahead to do it with.
+func identExcept(words ...string) string {
+	return identRunExcept(words, true)
+}
 
-	for _, p := range lp.Definition {
-		var patStr string
-		switch lang {
-		case Go:
-			switch p.Kind {
-			case "function":
-				patStr = `^func\s+` + sym + `\s*\(`
-			case "method":
-				patStr = `^func\s+\([^)]+\)\s+` + sym + `\s*\(`
-			case "type", "interface":
-				patStr = `^type\s+` + sym + `\s+`
-			case "const":
-				// Two patterns: standalone const and tab-indented block member (gofmt style)
-				for _, constPat := range []string{
-					`^const\s+` + sym + `\s*(?:=|[A-Za-z])`,
-					`^\t` + sym + `\s*(?:=|[A-Za-z])`,
-				} {
-					if !seen[constPat] {
-						seen[constPat] = true
-						// Error safe to ignore: hardcoded template + QuoteMeta
-						if re, err := regexp.Compile(constPat); err == nil {
-							patterns = append(patterns, re)
-						}
-					}
-				}
-			case "var":
-				patStr = `^var\s+` + sym + `\s*`
-			}
-		case TypeScript, JavaScript:
-			switch p.Kind {
-			case "function":
-				// Match: function decl, arrow with parens (+ optional return type), or arrow without parens
-				patStr = `(?:` +
-					`^(?:export\s+)?(?:async\s+)?function\s+` + sym + `|` +
-					`^(?:export\s+)?const\s+` + sym + `\s*=\s*(?:async\s*)?\((?:[^()]*|\([^()]*\))*\).*?=>|` +
-					`^(?:export\s+)?const\s+` + sym + `\s*=\s*(?:async\s+)?[A-Za-z_$][A-Za-z0-9_$]*\s*=>)`
-			case "type", "interface":
-				patStr = `^(?:export\s+)?(?:class|interface|type|enum)\s+` + sym
-			}
-		case Python:
-			switch p.Kind {
-			case "function":
-				patStr = `^(?:async\s+)?def\s+` + sym + `\s*\(`
-			case "type":
-				patStr = `^class\s+` + sym
-			}
-		case Rust:
-			switch p.Kind {
-			case "function":
-				patStr = `^(?:pub\s+)?(?:async\s+)?fn\s+` + sym + `\s*[<(]`
-			case "type":
-				patStr = `^(?:pub\s+)?(?:struct|enum)\s+` + sym
-			case "interface":
-				patStr = `^(?:pub\s+)?trait\s+` + sym
-			}
+// identRunExcept implements identExcept for the rest of an identifier after
+// the characters words have had theirs cut from, matching any run of
+// identifier characters but words; with first set, the run is the whole
+// identifier, so it can't be empty or start with a digit.
+func identRunExcept(words []string, first bool) string {
+	var empty bool
+	next := make(map[rune][]string)
+	var keys []rune
+	for _, w := range words {
+		if w == "" {
+			empty = true
+			continue
 		}
+		r, size := utf8.DecodeRuneInString(w)
+		if _, ok := next[r]; !ok {
+			keys = append(keys, r)
+		}
+		next[r] = append(next[r], w[size:])
+	}
+	slices.Sort(keys)
 
-		if patStr != "" && !seen[patStr] {
-			seen[patStr] = true
-			// Compilation errors are safe to ignore: patterns are built from
-			// hardcoded templates + regexp.QuoteMeta(symbol), so they're always valid.
-			if re, err := regexp.Compile(patStr); err == nil {
-				patterns = append(patterns, re)
-			}
+	// A first character no word starts with ends the comparison
+	var letters string
+	other := `\p{Nd}_`
+	if first {
+		other = `_`
+	}
+	for _, r := range keys {
+		if r == '_' {
+			other = strings.TrimSuffix(other, "_")
+		} else {
+			letters += string(r)
 		}
 	}
+	alts := []string{`[^\P{L}` + letters + `][\p{L}\p{Nd}_]*`}
+	if other != "" {
+		alts = append(alts, `[`+other+`][\p{L}\p{Nd}_]*`)
+	}
+	for _, r := range keys {
+		alts = append(alts, regexp.QuoteMeta(string(r))+identRunExcept(next[r], false))
+	}
+	re := `(?:` + strings.Join(alts, "|") + `)`
+	if !first && !empty {
+		re += `?`
+	}
+	return re
+}
+
+// cKeywords are the C keywords that can start a line of code before a name
+// and a parenthesis, as in return foo(a,, without that line defining the
+// name.
+var cKeywords = []string{"_Alignof", "alignof", "case", "do", "else", "goto", "return", "sizeof", "typeof"}
+
+// cReturnType matches what comes before the name of a C function defined at
+// the start of a line: its specifiers and return type, each word followed by
+// spaces or the stars of a pointer, as in "static inline int " or "char *".
+// A call such as foo(bar); has no such words before the name, and one such
+// as return foo(a, or else foo(a) has a keyword; a * foo(z), spaced on
+// both sides of the star, is a product.
+var cReturnType = `^` + identExcept(cKeywords...) + cSpace + `(?:[\p{L}_][\p{L}\p{Nd}_]*` + cSpace + `)*`
+
+// cSpace matches what separates the words of a C function's return type:
+// spaces, or the stars of a pointer against the word before or after them.
+const cSpace = `(?:\*+\s*|\s+\*+|\s+)`
+
+// cDefinitionEnd matches the rest of a C function's line from the opening
+// parenthesis of its parameters, which mustn't end in the semicolon of a
+// prototype or of a call such as int n = count(xs);.
+const cDefinitionEnd = `\s*\((?:.*[^;\s])?\s*$`
+
+// cPatterns returns C-specific patterns.
+func cPatterns() *LanguagePatterns {
+	return &LanguagePatterns{
+		Language:   C,
+		Extensions: []string{".c", ".h"},
+		Definition: []Pattern{
+			// static int function_name(, the body or the rest of the
+			// parameters to follow
+			{
+				Regex: regexp.MustCompile(cReturnType + `([\p{L}_][\p{L}\p{Nd}_]*)` + cDefinitionEnd),
+				Kind:  "function",
+			},
+			// struct, union, or enum Name {, possibly typedef'd; a bare
+			// struct Name; only declares it
+			{
+				Regex: regexp.MustCompile(`^(?:typedef\s+)?(?:struct|union|enum)\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*(?:\{|$)`),
+				Kind:  "type",
+			},
+			// typedef int (*handler_fn)(int);
+			{
+				Regex: regexp.MustCompile(`^typedef\b.*\(\s*\*\s*([\p{L}_][\p{L}\p{Nd}_]*)\s*\)\s*\(`),
+				Kind:  "type",
+			},
+			// typedef unsigned long size_type;
+			{
+				Regex: regexp.MustCompile(`^typedef\b[^(]*[\s*]([\p{L}_][\p{L}\p{Nd}_]*)\s*(?:\[[^\]]*\])?\s*;`),
+				Kind:  "type",
+			},
+			// } Name; closing typedef struct { ... }
+			{
+				Regex: regexp.MustCompile(`^\}\s*([\p{L}_][\p{L}\p{Nd}_]*)\s*;`),
+				Kind:  "type",
+			},
+			// #define NAME or #define NAME(args)
+			{
+				Regex: regexp.MustCompile(`^\s*#\s*define\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "macro",
+			},
+		},
+		Syntax: &Syntax{
+			LineComment:  []string{"//"},
+			BlockComment: [][2]string{{"/*", "*/"}},
+			Strings:      []string{`"`, "'"},
+		},
+		References: []RefRule{
+			refRule(RefImport, `^\s*#\s*include\b`, ""),
+			refRule(RefType, `\b(?:struct|union|enum|sizeof\s*\()\s*$`, ""),
+			refRule(RefCall, "", `^\s*\(`),
+			// A declaration, as in user *u or const user u
+			refRule(RefType, `(?:^|[;{(,]|\bconst)\s*$`, `^\s*\*?\s*[\p{L}_][\p{L}\p{Nd}_]*\s*[;=,)\[]`),
+		},
+		TestFile: regexp.MustCompile(`(^test_|_test\.c$)`),
+		TestPath: regexp.MustCompile(`/(tests?|testdata|fixtures)/`),
+		// else if (ready) at the start of a line looks like a function
+		// returning else
+		Reserved: []string{"if", "for", "while", "switch", "return", "sizeof"},
+		Branches: []string{"if", "for", "while", "switch", "case"},
+	}
+}
+
+// cppTemplate matches a template<...> heading a C++ definition on its line.
+const cppTemplate = `(?:template\s*<[^;{}]*>\s*)?`
+
+// cppWord matches a word of a C++ function's specifiers and return type,
+// such as static, std::vector<int>, or Widget&, with what follows it: spaces,
+// or the stars and ampersands of a pointer or reference against the word
+// before or after them.
+const cppWord = `(?:[\p{L}_][\p{L}\p{Nd}_]*` + cppTypeRest + `)`
+
+// cppTypeRest matches what follows the first name of a word of cppWord.
+const cppTypeRest = `(?:::[\p{L}_][\p{L}\p{Nd}_]*)*(?:<[^;{}()]*>)?(?:[*&]+\s*|\s+[*&]+|\s+)`
+
+// cppKeywords are cKeywords with the C++ keywords that can start a line of
+// code the same way, as in new foo(bar) or co_return foo(x).
+var cppKeywords = append([]string{"co_await", "co_return", "co_yield", "delete", "new", "throw"}, cKeywords...)
+
+// cppSpecifiers matches a C++ function's specifiers and return type, which
+// can't start with one of cppKeywords.
+var cppSpecifiers = identExcept(cppKeywords...) + cppTypeRest + cppWord + `*`
+
+// cppReturnType is cReturnType with C++'s types and an optional template
+// heading.
+var cppReturnType = `^` + cppTemplate + cppSpecifiers
+
+// cppQualifier matches the class, and any namespaces, qualifying the name of
+// a C++ member defined outside its class, as in Widget:: or ns::Stack<T>::.
+const cppQualifier = `(?:[\p{L}_][\p{L}\p{Nd}_]*(?:<[^;{}()]*>)?::)+`
+
+// cppMemberEnd matches the rest of a C++ member function defined in its
+// class body: its parameters, qualifiers such as const and override, any
+// trailing return type, and the opening brace, which a declaration lacks.
+const cppMemberEnd = `\s*\([^;]*\)[\s\p{L}&]*(?:->\s*[^{;]+)?\{`
+
+// cppPatterns returns C++-specific patterns.
+func cppPatterns() *LanguagePatterns {
+	return &LanguagePatterns{
+		Language:   Cpp,
+		Extensions: []string{".cpp", ".cc", ".cxx", ".hpp", ".hh"},
+		Definition: []Pattern{
+			// int function_name(, as for C, with C++'s types
+			{
+				Regex: regexp.MustCompile(cppReturnType + `([\p{L}_][\p{L}\p{Nd}_]*)` + cDefinitionEnd),
+				Kind:  "function",
+			},
+			// void Widget::draw(, Widget::Widget(, or Widget::~Widget(,
+			// defined outside the class
+			{
+				Regex: regexp.MustCompile(`^` + cppTemplate + `(?:` + cppSpecifiers + `)?` + cppQualifier + `(~?[\p{L}_][\p{L}\p{Nd}_]*)` + cDefinitionEnd),
+				Kind:  "method",
+			},
+			// Indented virtual void draw() const override {, in a class body
+			{
+				Regex: regexp.MustCompile(`^\s+` + cppTemplate + cppWord + `+([\p{L}_][\p{L}\p{Nd}_]*)` + cppMemberEnd),
+				Kind:  "method",
+			},
+			// class Name, struct Name, or union Name, and not a declaration
+			// such as class Name;
+			{
+				Regex: regexp.MustCompile(`^\s*` + cppTemplate + `(?:typedef\s+)?(?:class|struct|union)\s+(?:\[\[[^\]]*\]\]\s*)?(?:[\p{Lu}_][\p{Lu}\p{Nd}_]*\s+)?([\p{L}_][\p{L}\p{Nd}_]*)(?:\s+final)?\s*(?:[:{]|$)`),
+				Kind:  "type",
+			},
+			// enum Name or enum class Name
+			{
+				Regex: regexp.MustCompile(`^\s*(?:typedef\s+)?enum(?:\s+(?:class|struct))?\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*(?:[:{]|$)`),
+				Kind:  "type",
+			},
+			// using Name = ..., possibly a template alias
+			{
+				Regex: regexp.MustCompile(`^\s*` + cppTemplate + `using\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*=`),
+				Kind:  "type",
+			},
+			// typedef unsigned long size_type; and the rest as in C
+			{
+				Regex: regexp.MustCompile(`^\s*typedef\b.*\(\s*\*\s*([\p{L}_][\p{L}\p{Nd}_]*)\s*\)\s*\(`),
+				Kind:  "type",
+			},
+			{
+				Regex: regexp.MustCompile(`^\s*typedef\b[^(]*[\s*&]([\p{L}_][\p{L}\p{Nd}_]*)\s*(?:\[[^\]]*\])?\s*;`),
+				Kind:  "type",
+			},
+			// namespace name {, or the last of namespace outer::inner {
+			{
+				Regex: regexp.MustCompile(`^\s*(?:inline\s+)?namespace\s+(?:[\p{L}_][\p{L}\p{Nd}_]*::)*([\p{L}_][\p{L}\p{Nd}_]*)\s*(?:\{|$)`),
+				Kind:  "namespace",
+			},
+			{
+				Regex: regexp.MustCompile(`^\s*#\s*define\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "macro",
+			},
+		},
+		Syntax: &Syntax{
+			LineComment:  []string{"//"},
+			BlockComment: [][2]string{{"/*", "*/"}},
+			Strings:      []string{`"`, "'"},
+		},
+		References: []RefRule{
+			refRule(RefImport, `^\s*(?:#\s*include|using|import)\b`, ""),
+			refRule(RefConstruct, `\bnew\s+$`, ""),
+			refRule(RefType, `(?:\b(?:class|struct|union|enum|sizeof\s*\()|<|\b(?:public|protected|private))\s*$`, ""),
+			refRule(RefType, "", `^\s*(?:::|<[^<>()]*>\s*[*&]*\s*[\p{L}_])`),
+			refRule(RefCall, "", `^\s*\(`),
+			refRule(RefConstruct, "", `^\s*\{`),
+			refRule(RefType, `(?:^|[;{(,]|\bconst)\s*$`, `^\s*[*&]?\s*[\p{L}_][\p{L}\p{Nd}_]*\s*[;=,)\[({]`),
+		},
+		TestFile: regexp.MustCompile(`(^test_|_(?:unit)?test\.(?:cpp|cc|cxx)$)`),
+		TestPath: regexp.MustCompile(`/(tests?|testdata|fixtures)/`),
+		Reserved: []string{"if", "for", "while", "switch", "return", "sizeof", "catch", "delete", "new", "throw", "decltype", "static_assert"},
+		Branches: []string{"if", "for", "while", "switch", "case", "catch"},
+	}
+}
+
+// rubyName matches a Ruby method's name, which may end in ?, !, or = as in
+// empty?, save!, or name=.
+const rubyName = `[\p{L}_][\p{L}\p{Nd}_]*[?!=]?`
+
+// rubyNameEnd matches what follows the name of a Ruby method being defined:
+// its parameters, with or without parentheses, an endless method's =, a
+// semicolon, or the end of the line.
+const rubyNameEnd = `(?:[\s(;]|$)`
+
+// rubyPatterns returns Ruby-specific patterns.
+func rubyPatterns() *LanguagePatterns {
+	return &LanguagePatterns{
+		Language:   Ruby,
+		Extensions: []string{".rb"},
+		Definition: []Pattern{
+			// def method_name or def self.method_name, at the top level
+			{
+				Regex: regexp.MustCompile(`^def\s+(?:self\.)?(` + rubyName + `)` + rubyNameEnd),
+				Kind:  "function",
+			},
+			// Indented def method_name or def self.method_name, as in a class
+			// or module body
+			{
+				Regex: regexp.MustCompile(`^\s+def\s+(?:self\.)?(` + rubyName + `)` + rubyNameEnd),
+				Kind:  "method",
+			},
+			// class Name, or the last of class Outer::Name; not class << self
+			{
+				Regex: regexp.MustCompile(`^\s*class\s+(?:[\p{L}_][\p{L}\p{Nd}_]*::)*([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "type",
+			},
+			// module Name, or the last of module Outer::Name
+			{
+				Regex: regexp.MustCompile(`^\s*module\s+(?:[\p{L}_][\p{L}\p{Nd}_]*::)*([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "namespace",
+			},
+			// NAME = ..., at the top level or in a class or module body
+			// indented two spaces, and not a comparison such as NAME == x
+			{
+				Regex: regexp.MustCompile(`^(?:  )?(\p{Lu}[\p{L}\p{Nd}_]*)\s*=(?:[^=~>]|$)`),
+				Kind:  "const",
+			},
+		},
+		Syntax: &Syntax{
+			LineComment: []string{"#"},
+			Strings:     []string{`"`, "'"},
+		},
+		References: []RefRule{
+			refRule(RefImport, `^\s*(?:require|require_relative|load)\b`, ""),
+			refRule(RefConstruct, "", `^\.new\b`),
+			// A superclass, as in class Admin < User
+			refRule(RefType, `^\s*class\s+[\p{L}\p{Nd}_:]+\s*<\s*$`, ""),
+			refRule(RefCall, "", `^\s*\(`),
+		},
+		TestFile: regexp.MustCompile(`(^test_|_(?:test|spec)\.rb$)`),
+		TestPath: regexp.MustCompile(`/(tests?|spec|testdata|fixtures)/`),
+		Branches: []string{"if", "elsif", "unless", "while", "until", "for", "when", "rescue"},
+	}
+}
+
+// phpModifiers matches the modifiers of a PHP method, such as public static.
+const phpModifiers = `(?:(?:public|protected|private|static|abstract|final|readonly)\s+)*`
+
+// phpPatterns returns PHP-specific patterns.
+func phpPatterns() *LanguagePatterns {
+	return &LanguagePatterns{
+		Language:   PHP,
+		Extensions: []string{".php"},
+		Definition: []Pattern{
+			// function name(, or function &name( returning a reference
+			{
+				Regex: regexp.MustCompile(`^function\s+&?\s*([\p{L}_][\p{L}\p{Nd}_]*)\s*\(`),
+				Kind:  "function",
+			},
+			// Indented public static function name(, as in a class body
+			{
+				Regex: regexp.MustCompile(`^\s+` + phpModifiers + `function\s+&?\s*([\p{L}_][\p{L}\p{Nd}_]*)\s*\(`),
+				Kind:  "method",
+			},
+			// class Name, trait Name, or enum Name, with any modifiers
+			{
+				Regex: regexp.MustCompile(`^\s*(?:(?:abstract|final|readonly)\s+)*(?:class|trait|enum)\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "type",
+			},
+			// interface Name
+			{
+				Regex: regexp.MustCompile(`^\s*interface\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "interface",
+			},
+			// const NAME = ..., at the top level or in a class, where it may
+			// have a visibility and, since PHP 8.3, a type
+			{
+				Regex: regexp.MustCompile(`^\s*(?:(?:public|protected|private|final)\s+)*const\s+(?:[\p{L}_?\\][\p{L}\p{Nd}_|\\]*\s+)?([\p{L}_][\p{L}\p{Nd}_]*)\s*=`),
+				Kind:  "const",
+			},
+		},
+		Syntax: &Syntax{
+			LineComment:  []string{"//", "#"},
+			BlockComment: [][2]string{{"/*", "*/"}},
+			Strings:      []string{`"`, "'"},
+		},
+		References: []RefRule{
+			refRule(RefImport, `^\s*(?:use|require|require_once|include|include_once)\b`, ""),
+			refRule(RefConstruct, `\bnew\s+$`, ""),
+			refRule(RefType, `\b(?:extends|implements|instanceof|catch\s*\()\s*$`, ""),
+			// A type declaration, as in User $user, ?User $user, or ): User
+			refRule(RefType, `(?:[(,|?]|\):)\s*\??$`, `^\s*(?:[|&]|\.\.\.|&?\$|$|[{;])`),
+			refRule(RefCall, "", `^\s*\(`),
+		},
+		TestFile:   regexp.MustCompile(`Test\.php$`),
+		TestPath:   regexp.MustCompile(`/(tests?|testdata|fixtures)/`),
+		Annotation: regexp.MustCompile(`^\s*#\[\s*\\?([\p{L}_][\p{L}\p{Nd}_\\]*)`),
+		Branches:   []string{"if", "elseif", "for", "foreach", "while", "switch", "case", "catch", "match"},
+	}
+}
 
-	return patterns
+// kotlinModifiers matches the modifiers of a Kotlin declaration, such as
+// private suspend or internal data.
+const kotlinModifiers = `(?:(?:public|private|protected|internal|open|abstract|final|override|suspend|inline|operator|infix|tailrec|external|data|sealed|enum|annotation|inner|value|const|lateinit|actual|expect)\s+)*`
+
+// kotlinFun matches a Kotlin fun up to its name: any type parameters, as
+// in fun <T> first(, and the receiver of an extension, as in
+// fun String.slug(.
+const kotlinFun = kotlinModifiers + `fun\s+(?:<[^>]*>\s*)?(?:[\p{L}_][\p{L}\p{Nd}_<>?,\s]*\.)?`
+
+// kotlinPatterns returns Kotlin-specific patterns.
+func kotlinPatterns() *LanguagePatterns {
+	return &LanguagePatterns{
+		Language:   Kotlin,
+		Extensions: []string{".kt", ".kts"},
+		Definition: []Pattern{
+			// fun name(, at the top level
+			{
+				Regex: regexp.MustCompile(`^` + kotlinFun + `([\p{L}_][\p{L}\p{Nd}_]*)\s*\(`),
+				Kind:  "function",
+			},
+			// Indented fun name(, as in a class or object body
+			{
+				Regex: regexp.MustCompile(`^\s+` + kotlinFun + `([\p{L}_][\p{L}\p{Nd}_]*)\s*\(`),
+				Kind:  "method",
+			},
+			// interface Name or fun interface Name
+			{
+				Regex: regexp.MustCompile(`^\s*` + kotlinModifiers + `(?:fun\s+)?interface\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "interface",
+			},
+			// class Name, data class Name, sealed class Name, object Name,
+			// and the like; not a companion object
+			{
+				Regex: regexp.MustCompile(`^\s*` + kotlinModifiers + `(?:class|object)\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "type",
+			},
+			// typealias Name = ...
+			{
+				Regex: regexp.MustCompile(`^\s*` + kotlinModifiers + `typealias\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "type",
+			},
+			// const val NAME, at the top level
+			{
+				Regex: regexp.MustCompile(`^(?:(?:public|private|internal)\s+)?const\s+val\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*[:=]`),
+				Kind:  "const",
+			},
+			// val name or var name, at the top level, including an
+			// extension property such as val String.slug
+			{
+				Regex: regexp.MustCompile(`^` + kotlinModifiers + `(?:val|var)\s+(?:<[^>]*>\s*)?(?:[\p{L}_][\p{L}\p{Nd}_<>?,\s]*\.)?([\p{L}_][\p{L}\p{Nd}_]*)\s*[:=]`),
+				Kind:  "var",
+			},
+		},
+		Syntax: &Syntax{
+			LineComment:  []string{"//"},
+			BlockComment: [][2]string{{"/*", "*/"}},
+			Strings:      []string{`"`, "'"},
+			LongStrings:  []string{`"""`},
+		},
+		References: []RefRule{
+			refRule(RefImport, `^\s*import\b`, ""),
+			refRule(RefCall, "", `^\s*\(`),
+			// An annotation (u: User) or a type argument (List<User>)
+			refRule(RefType, `(?::|<)\s*$`, ""),
+		},
+		TestFile:   regexp.MustCompile(`Tests?\.kts?$`),
+		TestPath:   regexp.MustCompile(`/(tests?|androidTest|testdata|fixtures)/`),
+		Annotation: regexp.MustCompile(`^\s*@(?:[\p{L}_]+:)?([\p{L}_][\p{L}\p{Nd}_.]*)`),
+		Branches:   []string{"if", "for", "while", "when", "catch"},
+	}
+}
+
+// swiftModifiers matches the attributes and modifiers of a Swift
+// declaration, such as @MainActor public final or private(set) static.
+const swiftModifiers = `(?:@[\p{L}_][\p{L}\p{Nd}_.]*(?:\([^)]*\))?\s+)*` +
+	`(?:(?:public|open|internal|private|fileprivate|package)(?:\(set\))?\s+|` +
+	`(?:final|static|class|override|mutating|nonmutating|convenience|required|dynamic|lazy|weak|unowned|indirect|nonisolated|distributed)\s+)*`
+
+// swiftPatterns returns Swift-specific patterns.
+func swiftPatterns() *LanguagePatterns {
+	return &LanguagePatterns{
+		Language:   Swift,
+		Extensions: []string{".swift"},
+		Definition: []Pattern{
+			// func name( or generic func name<T>(, at the top level
+			{
+				Regex: regexp.MustCompile(`^` + swiftModifiers + `func\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*[<(]`),
+				Kind:  "function",
+			},
+			// Indented func name(, as in a type or extension body
+			{
+				Regex: regexp.MustCompile(`^\s+` + swiftModifiers + `func\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*[<(]`),
+				Kind:  "method",
+			},
+			// init(, init?(, or init!(
+			{
+				Regex: regexp.MustCompile(`^\s+` + swiftModifiers + `(init)[?!]?\s*[<(]`),
+				Kind:  "method",
+			},
+			// class Name, struct Name, enum Name, or actor Name
+			{
+				Regex: regexp.MustCompile(`^\s*` + swiftModifiers + `(?:class|struct|enum|actor)\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "type",
+			},
+			// protocol Name
+			{
+				Regex: regexp.MustCompile(`^\s*` + swiftModifiers + `protocol\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "interface",
+			},
+			// extension Name, or the last of extension Outer.Name
+			{
+				Regex: regexp.MustCompile(`^\s*` + swiftModifiers + `extension\s+(?:[\p{L}_][\p{L}\p{Nd}_]*\.)*([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "type",
+			},
+			// typealias Name = ...
+			{
+				Regex: regexp.MustCompile(`^\s*` + swiftModifiers + `typealias\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "type",
+			},
+			// let name, at the top level
+			{
+				Regex: regexp.MustCompile(`^` + swiftModifiers + `let\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*[:=]`),
+				Kind:  "const",
+			},
+			// var name, at the top level
+			{
+				Regex: regexp.MustCompile(`^` + swiftModifiers + `var\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*[:={]`),
+				Kind:  "var",
+			},
+		},
+		Syntax: &Syntax{
+			LineComment:  []string{"//"},
+			BlockComment: [][2]string{{"/*", "*/"}},
+			Strings:      []string{`"`},
+			LongStrings:  []string{`"""`},
+		},
+		References: []RefRule{
+			refRule(RefImport, `^\s*(?:@testable\s+)?import\b`, ""),
+			refRule(RefCall, "", `^\s*\(`),
+			// An annotation (u: User), a return type, a generic argument,
+			// or a cast
+			refRule(RefType, `(?::|->|<|\bas[?!]?|\bis)\s*$`, ""),
+		},
+		TestFile:   regexp.MustCompile(`Tests?\.swift$`),
+		TestPath:   regexp.MustCompile(`/(tests?|Tests|testdata|fixtures)/`),
+		Annotation: regexp.MustCompile(`^\s*@([\p{L}_][\p{L}\p{Nd}_.]*)`),
+		Branches:   []string{"if", "guard", "for", "while", "repeat", "switch", "case", "catch"},
+	}
+}
+
+// csharpModifiers matches the modifiers of a C# declaration, such as
+// public static async.
+const csharpModifiers = `(?:(?:public|private|protected|internal|static|async|override|virtual|abstract|sealed|readonly|unsafe|extern|new|partial|file|required|volatile)\s+)*`
+
+// csharpType matches a C# type followed by a space, such as int,
+// List<string>, string[], or int?.
+const csharpType = `[\p{L}_][\p{L}\p{Nd}_.]*(?:<[^()=;]*>)?(?:\[[,\s]*\])*\??\s+`
+
+// csharpBody matches what follows a C# method's parameters: any
+// constructor initializer or type constraints, then its body's brace, an
+// expression body's =>, or the end of the line before an opening brace on
+// the next. A call's semicolon doesn't match.
+const csharpBody = `(?::\s*(?:base|this)\s*\(.*|where\b[^;{]*)?(?:\{.*|=>.*)?$`
+
+// csharpMethodEnd matches the rest of a C# method's line after its name:
+// any type parameters, its parameters, and csharpBody.
+const csharpMethodEnd = `(?:<[^()]*>)?\s*\([^;]*\)\s*` + csharpBody
+
+// csharpConstructor matches a C# constructor's modifiers, which it has
+// in place of a return type.
+const csharpConstructor = `^\s*(?:(?:public|private|protected|internal|static)\s+)+`
+
+// csharpPatterns returns C#-specific patterns. C# declares its methods and
+// properties inside classes, and often its classes inside a namespace
+// block, so unlike most languages' patterns these aren't anchored to
+// column 0: each allows leading whitespace, and tells a definition from a
+// statement by its modifiers, type, and what follows the name.
+func csharpPatterns() *LanguagePatterns {
+	return &LanguagePatterns{
+		Language:   CSharp,
+		Extensions: []string{".cs"},
+		Definition: []Pattern{
+			// class Name, struct Name, record Name, or record struct Name
+			{
+				Regex: regexp.MustCompile(`^\s*` + csharpModifiers + `(?:class|struct|record(?:\s+(?:class|struct))?)\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "type",
+			},
+			// interface Name
+			{
+				Regex: regexp.MustCompile(`^\s*` + csharpModifiers + `interface\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "interface",
+			},
+			// enum Name
+			{
+				Regex: regexp.MustCompile(`^\s*` + csharpModifiers + `enum\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "type",
+			},
+			// public async Task<User> GetUser(int id), with a return type.
+			// A declaration without a body, as in an interface, looks too
+			// much like a call to tell apart.
+			{
+				Regex: regexp.MustCompile(`^\s*` + csharpModifiers + csharpType + `([\p{L}_][\p{L}\p{Nd}_]*)` + csharpMethodEnd),
+				Kind:  "method",
+			},
+			// public User(string name), a constructor
+			{
+				Regex: regexp.MustCompile(csharpConstructor + `([\p{L}_][\p{L}\p{Nd}_]*)` + csharpMethodEnd),
+				Kind:  "method",
+			},
+			// Either, with the parameters on the lines after
+			{
+				Regex:   regexp.MustCompile(`^\s*` + csharpModifiers + csharpType + `([\p{L}_][\p{L}\p{Nd}_]*)\s*(?:<[^()]*>)?\s*\(`),
+				Kind:    "method",
+				Wrapped: true,
+			},
+			{
+				Regex:   regexp.MustCompile(csharpConstructor + `([\p{L}_][\p{L}\p{Nd}_]*)\s*\(`),
+				Kind:    "method",
+				Wrapped: true,
+			},
+			// public string Name { get; set; }
+			{
+				Regex: regexp.MustCompile(`^\s*` + csharpModifiers + csharpType + `([\p{L}_][\p{L}\p{Nd}_]*)\s*\{\s*(?:(?:private|protected|internal)\s+)?(?:get|set|init)\b`),
+				Kind:  "var",
+			},
+			// public const int MaxUsers = 100;
+			{
+				Regex: regexp.MustCompile(`^\s*` + csharpModifiers + `const\s+` + csharpType + `([\p{L}_][\p{L}\p{Nd}_]*)\s*=`),
+				Kind:  "const",
+			},
+		},
+		Syntax: &Syntax{
+			LineComment:  []string{"//"},
+			BlockComment: [][2]string{{"/*", "*/"}},
+			Strings:      []string{`"`, "'"},
+			LongStrings:  []string{`"""`},
+		},
+		References: []RefRule{
+			refRule(RefImport, `^\s*(?:global\s+)?using\s+(?:static\s+)?(?:[\p{L}_][\p{L}\p{Nd}_]*\s*=\s*)?$`, ""),
+			refRule(RefConstruct, `\bnew\s+$`, ""),
+			refRule(RefCall, "", `^\s*(?:<[^()]*>)?\s*\(`),
+			// A base type (class Admin : User), a type argument, or a
+			// declaration (User user)
+			refRule(RefType, `(?::|<|\b(?:is|as|typeof\s*\())\s*$`, ""),
+			refRule(RefType, `(?:^|[;{(,]|\b(?:out|ref|in|params))\s*$`, `^\??(?:\[[,\s]*\])*\s+[\p{L}_]`),
+		},
+		WrappedEnd: regexp.MustCompile(`^\s*` + csharpBody),
+		TestFile:   regexp.MustCompile(`Tests?\.cs$`),
+		TestPath:   regexp.MustCompile(`/(tests?|testdata|fixtures)/|\.Tests?/`),
+		Annotation: regexp.MustCompile(`^\s*\[\s*([\p{L}_][\p{L}\p{Nd}_.]*)`),
+		// else if (ready) looks like a method returning else
+		Reserved: []string{"if", "for", "foreach", "while", "switch", "catch", "using", "lock", "return", "nameof", "typeof", "sizeof", "default", "when", "fixed"},
+		Branches: []string{"if", "for", "foreach", "while", "switch", "case", "catch"},
+	}
+}
+
+// scalaModifiers matches the modifiers of a Scala definition, such as
+// private[pkg] implicit or final case.
+const scalaModifiers = `(?:(?:private|protected)(?:\[[^\]]*\])?\s+|(?:implicit|final|override|sealed|abstract|lazy|case|inline|opaque|transparent|open)\s+)*`
+
+// scalaMember matches the indentation of a member of a top-level Scala
+// object, class, or trait, or none at all, but not the deeper indentation
+// of a local val in a method.
+const scalaMember = `^(?:  |\t)?`
+
+// scalaPatterns returns Scala-specific patterns.
+func scalaPatterns() *LanguagePatterns {
+	return &LanguagePatterns{
+		Language:   Scala,
+		Extensions: []string{".scala", ".sc"},
+		Definition: []Pattern{
+			// def name, at the top level, as Scala 3 allows
+			{
+				Regex: regexp.MustCompile(`^` + scalaModifiers + `def\s+([\p{L}_][\p{L}\p{Nd}_]*)(?:[\s(\[:=]|$)`),
+				Kind:  "function",
+			},
+			// Indented def name, as in an object, class, or trait body
+			{
+				Regex: regexp.MustCompile(`^\s+` + scalaModifiers + `def\s+([\p{L}_][\p{L}\p{Nd}_]*)(?:[\s(\[:=]|$)`),
+				Kind:  "method",
+			},
+			// trait Name
+			{
+				Regex: regexp.MustCompile(`^\s*` + scalaModifiers + `trait\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "interface",
+			},
+			// class Name, case class Name, object Name, or enum Name
+			{
+				Regex: regexp.MustCompile(`^\s*` + scalaModifiers + `(?:class|object|enum)\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "type",
+			},
+			// type Name = ...
+			{
+				Regex: regexp.MustCompile(`^\s*` + scalaModifiers + `type\s+([\p{L}_][\p{L}\p{Nd}_]*)`),
+				Kind:  "type",
+			},
+			// val name or var name, at the top level or a member's
+			// indentation
+			{
+				Regex: regexp.MustCompile(scalaMember + scalaModifiers + `(?:val|var)\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*[:=]`),
+				Kind:  "var",
+			},
+		},
+		Syntax: &Syntax{
+			LineComment:  []string{"//"},
+			BlockComment: [][2]string{{"/*", "*/"}},
+			Strings:      []string{`"`},
+			LongStrings:  []string{`"""`},
+		},
+		References: []RefRule{
+			refRule(RefImport, `^\s*import\b`, ""),
+			refRule(RefConstruct, `\bnew\s+$`, ""),
+			refRule(RefCall, "", `^\s*\(`),
+			// An annotation (u: User), a type argument (List[User]), or a
+			// supertype (extends Base with Logging)
+			refRule(RefType, `(?::|<:|>:|\[|\b(?:extends|with))\s*$`, ""),
+		},
+		TestFile:   regexp.MustCompile(`(?:Spec|Suite|Test)\.scala$`),
+		TestPath:   regexp.MustCompile(`/(tests?|testdata|fixtures)/`),
+		Annotation: regexp.MustCompile(`^\s*@([\p{L}_][\p{L}\p{Nd}_.]*)`),
+		Branches:   []string{"if", "for", "while", "case", "catch"},
+	}
+}
+
+// elixirName matches an Elixir function's name, which may end in ? or ! as
+// in valid? or save!.
+const elixirName = `[\p{L}_][\p{L}\p{Nd}_]*[?!]?`
+
+// elixirNameEnd matches what follows the name of an Elixir function being
+// defined: its parameters, with or without parentheses, the comma before a
+// do: body, or the end of the line, as in a protocol.
+const elixirNameEnd = `(?:[\s(,]|$)`
+
+// elixirQualifier matches the dotted prefix of an Elixir module's name, as in
+// MyApp.Accounts.User.
+const elixirQualifier = `(?:\p{Lu}[\p{L}\p{Nd}_]*\.)*`
+
+// elixirPatterns returns Elixir-specific patterns. A private function,
+// defined with defp, has kind "private" so it reads apart from a public
+// one.
+func elixirPatterns() *LanguagePatterns {
+	return &LanguagePatterns{
+		Language:   Elixir,
+		Extensions: []string{".ex", ".exs"},
+		Definition: []Pattern{
+			// def name(args) do, def name args do, or def name, do: value
+			{
+				Regex: regexp.MustCompile(`^\s*def\s+(` + elixirName + `)` + elixirNameEnd),
+				Kind:  "function",
+			},
+			// defp name, a function private to its module
+			{
+				Regex: regexp.MustCompile(`^\s*defp\s+(` + elixirName + `)` + elixirNameEnd),
+				Kind:  "private",
+			},
+			// defmacro name or defmacrop name
+			{
+				Regex: regexp.MustCompile(`^\s*defmacrop?\s+(` + elixirName + `)` + elixirNameEnd),
+				Kind:  "macro",
+			},
+			// defmodule Name, or the last of defmodule Outer.Name
+			{
+				Regex: regexp.MustCompile(`^\s*defmodule\s+` + elixirQualifier + `(\p{Lu}[\p{L}\p{Nd}_]*)`),
+				Kind:  "namespace",
+			},
+			// defprotocol Name, or the last of defprotocol Outer.Name
+			{
+				Regex: regexp.MustCompile(`^\s*defprotocol\s+` + elixirQualifier + `(\p{Lu}[\p{L}\p{Nd}_]*)`),
+				Kind:  "interface",
+			},
+			// defstruct, named for the keyword, since the struct takes the
+			// name of the module it's in
+			{
+				Regex: regexp.MustCompile(`^\s*(defstruct)(?:[\s(\[]|$)`),
+				Kind:  "type",
+			},
+		},
+		Syntax: &Syntax{
+			LineComment: []string{"#"},
+			Strings:     []string{`"`, "'"},
+			LongStrings: []string{`"""`, "'''"},
+		},
+		References: []RefRule{
+			refRule(RefImport, `^\s*(?:alias|import|require|use)\b`, ""),
+			// A struct, as in %User{name: name}
+			refRule(RefConstruct, `%(?:[\p{L}\p{Nd}_]+\.)*$`, `^\{`),
+			// A typespec, as in @spec get(id) :: User.t()
+			refRule(RefType, `::\s*(?:[\p{L}\p{Nd}_]+\.)*$`, ""),
+			refRule(RefCall, "", `^\s*\(`),
+		},
+		TestFile:   regexp.MustCompile(`_test\.exs$`),
+		TestPath:   regexp.MustCompile(`/(tests?|testdata|fixtures)/`),
+		Annotation: regexp.MustCompile(`^\s*@([\p{L}_][\p{L}\p{Nd}_]*)`),
+		Branches:   []string{"if", "unless", "case", "cond", "with", "for", "receive", "rescue", "catch"},
+	}
+}
+
+// zigFn matches what precedes the name of a Zig function: its visibility
+// and qualifiers, and fn.
+const zigFn = `(?:pub\s+)?(?:(?:export|extern(?:\s+"[^"]*")?|inline|noinline)\s+)*fn\s+`
+
+// zigQualifiers matches the visibility and qualifiers of a Zig constant or
+// variable, such as pub or export.
+const zigQualifiers = `(?:pub\s+)?(?:(?:export|extern|threadlocal)\s+)*`
+
+// zigType matches the type a Zig constant is assigned when it declares one,
+// as struct does in const Point = struct {, with any layout or tag.
+const zigType = `\s*(?::\s*type\s*)?=\s*(?:(?:extern|packed)\s+)?(?:struct|enum|union|opaque|error)\b`
+
+// zigPatterns returns Zig-specific patterns. A Zig type is a constant
+// assigned a struct, enum, union, or the like, so its name is the one left
+// of the =.
+func zigPatterns() *LanguagePatterns {
+	return &LanguagePatterns{
+		Language:   Zig,
+		Extensions: []string{".zig"},
+		Definition: []Pattern{
+			// fn name( or pub fn name(, at the top level
+			{
+				Regex: regexp.MustCompile(`^` + zigFn + `([\p{L}_][\p{L}\p{Nd}_]*)\s*\(`),
+				Kind:  "function",
+			},
+			// Indented fn name(, as in a struct body
+			{
+				Regex: regexp.MustCompile(`^\s+` + zigFn + `([\p{L}_][\p{L}\p{Nd}_]*)\s*\(`),
+				Kind:  "method",
+			},
+			// const Name = struct {, enum {, union(, and the like
+			{
+				Regex: regexp.MustCompile(`^\s*` + zigQualifiers + `const\s+([\p{L}_][\p{L}\p{Nd}_]*)` + zigType),
+				Kind:  "type",
+			},
+			// Any other const name = ..., at the top level
+			{
+				Regex: regexp.MustCompile(`^` + zigQualifiers + `const\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*[:=]`),
+				Kind:  "const",
+			},
+			// var name: T = ..., at the top level
+			{
+				Regex: regexp.MustCompile(`^` + zigQualifiers + `var\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*[:=]`),
+				Kind:  "var",
+			},
+		},
+		Syntax: &Syntax{
+			LineComment: []string{"//"},
+			Strings:     []string{`"`, "'"},
+		},
+		References: []RefRule{
+			refRule(RefImport, `@import\(\s*"?$`, ""),
+			// A parameter, field, or return type, as in p: *const Point or
+			// ) !Point
+			refRule(RefType, `(?::|\))\s*(?:[!?*]|\[[^\]]*\]|const\s+)*$`, ""),
+			refRule(RefConstruct, "", `^\{`),
+			refRule(RefCall, "", `^\s*\(`),
+		},
+		TestFile:  regexp.MustCompile(`_test\.zig$`),
+		TestPath:  regexp.MustCompile(`/(tests?|testdata|fixtures)/`),
+		TestBlock: regexp.MustCompile(`^\s*test\s+"`),
+		Branches:  []string{"if", "while", "for", "switch", "catch", "orelse"},
+	}
+}
+
+// luaTable matches the table a Lua method is defined on, such as M in
+// function M.name( or M.sub in function M.sub:name(.
+const luaTable = `[\p{L}_][\p{L}\p{Nd}_]*(?:\.[\p{L}_][\p{L}\p{Nd}_]*)*`
+
+// luaPatterns returns Lua-specific patterns.
+func luaPatterns() *LanguagePatterns {
+	return &LanguagePatterns{
+		Language:   Lua,
+		Extensions: []string{".lua"},
+		Definition: []Pattern{
+			// function name( or local function name(
+			{
+				Regex: regexp.MustCompile(`^\s*(?:local\s+)?function\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*\(`),
+				Kind:  "function",
+			},
+			// function M.name( or function M:name(, on a table
+			{
+				Regex: regexp.MustCompile(`^\s*function\s+` + luaTable + `[.:]([\p{L}_][\p{L}\p{Nd}_]*)\s*\(`),
+				Kind:  "method",
+			},
+			// local name = function(, at the top level
+			{
+				Regex: regexp.MustCompile(`^local\s+([\p{L}_][\p{L}\p{Nd}_]*)\s*=\s*function\s*\(`),
+				Kind:  "function",
+			},
+		},
+		Syntax: &Syntax{
+			LineComment:  []string{"--"},
+			BlockComment: [][2]string{{"--[[", "]]"}},
+			Strings:      []string{`"`, "'"},
+		},
+		References: []RefRule{
+			// A call, which needs no parentheses around a lone string or
+			// table, as in require "json" or Point{x = 1}
+			refRule(RefCall, "", `^\s*\(|^\s*["'{]`),
+		},
+		TestFile: regexp.MustCompile(`_spec\.lua$`),
+		TestPath: regexp.MustCompile(`/(tests?|spec|testdata|fixtures)/`),
+		Branches: []string{"if", "elseif", "while", "for", "repeat"},
+	}
+}
+
+// IsTestFile reports whether the path rel, relative to the search root, is a
+// test file in lang: one whose name the language's TestFile matches, such as
+// test_*.py, or that lives under a directory its TestPath matches, such as
+// __tests__/ or testdata/. TestFile is tried against the full path too, as a
+// plugin language's test_file may be written for it. Either separator may
+// divide rel, so a Windows path and its slash-separated form give the same
+// answer.
+func IsTestFile(rel string, lang Language) bool {
+	lp := ForLanguage(lang)
+	if lp == nil {
+		return false
+	}
+	slash := strings.ReplaceAll(rel, `\`, "/")
+	dir, base := "", slash
+	if i := strings.LastIndex(slash, "/"); i >= 0 {
+		dir, base = slash[:i], slash[i+1:]
+	}
+	if lp.TestFile != nil && (lp.TestFile.MatchString(base) || lp.TestFile.MatchString("/"+slash)) {
+		return true
+	}
+	return lp.TestPath != nil && dir != "" && lp.TestPath.MatchString("/"+dir+"/")
+}
+
+// IsTestSource reports whether src, the contents of a file in lang, make it
+// a test file wherever it lives, by having a line the language's TestBlock
+// matches, such as a Zig test "name" block.
+func IsTestSource(src []byte, lang Language) bool {
+	lp := ForLanguage(lang)
+	if lp == nil || lp.TestBlock == nil {
+		return false
+	}
+	for line := range bytes.Lines(src) {
+		if lp.TestBlock.Match(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsWholeWord reports whether line[start:end] is a whole identifier in lang
+// rather than part of a longer one, going by the characters on either side.
+// Unlike a regexp \b, this honors identifier characters such as $ in
+// JavaScript and letters outside ASCII. An end of the text that isn't an
+// identifier character, like the dots in ".created", needs no boundary.
+func IsWholeWord(lang Language, line string, start, end int) bool {
+	var extra string
+	if lp := ForLanguage(lang); lp != nil {
+		extra = lp.IdentExtra
+	}
+	ident := func(r rune) bool {
+		return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(extra, r)
+	}
+	if first, _ := utf8.DecodeRuneInString(line[start:end]); ident(first) {
+		if r, _ := utf8.DecodeLastRuneInString(line[:start]); start > 0 && ident(r) {
+			return false
+		}
+	}
+	if last, _ := utf8.DecodeLastRuneInString(line[start:end]); ident(last) {
+		if r, _ := utf8.DecodeRuneInString(line[end:]); end < len(line) && ident(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// DefinitionPatternFor builds a regex pattern to find definitions of a specific symbol.
+func DefinitionPatternFor(symbol string, lang Language) []*regexp.Regexp {
+	return definitionPatterns(symbol, lang, false).Patterns
+}
+
+// DefinitionPatternForFold is like DefinitionPatternFor but matches the symbol
+// case-insensitively. Only the symbol is folded; keywords such as "func" must
+// still match exactly.
+func DefinitionPatternForFold(symbol string, lang Language) []*regexp.Regexp {
+	return definitionPatterns(symbol, lang, true).Patterns
+}
+
+// Definitions holds a symbol's definition patterns in one language, along
+// with a single regex combining them, so that a search makes one pass over
+// each file however many kinds of definition the language has: Combined for
+// the native matcher, or Patterns as one -e argument apiece for grep and
+// ripgrep, each written in its dialect by backend.Name.Pattern. The kind of
+// a line that matched is attributed afterward by testing the individual
+// patterns against that line alone, with Match.
+//
+// Such a line-oriented search doesn't know which block of grouped
+// declarations a line is in, so Patterns leave out the patterns for block
+// members, which a struct field or an interface method looks just like.
+// Only the members no field can be mistaken for stand in for them, such as
+// Go's Name = value; MatchIn and Find, given the block, apply the rest.
+type Definitions struct {
+	// Combined matches a line when any of Patterns does; nil when there
+	// are no patterns.
+	Combined *regexp.Regexp
+	lp       *LanguagePatterns // For Unwraps
+	Patterns []*regexp.Regexp
+	// symbol is the symbol, lowercased when fold is set, which a line has
+	// to contain to define it
+	symbol string
+	Kinds  []string // Kinds[i] is the kind of definition Patterns[i] finds
+	// Wrapped[i] reports whether Patterns[i] matches only the start of a
+	// definition whose parameters run on past the line; see Pattern.Wrapped.
+	// Combined matches the start alone.
+	Wrapped []bool
+	// all holds every pattern, those for block members and the stand-ins
+	// for them included, in the order they're tried
+	all  []definition
+	fold bool
+}
+
+// definition is one of a Definitions' patterns.
+type definition struct {
+	re   *regexp.Regexp
+	kind string
+	// block is the kind of block the pattern applies in, or "" for any
+	// line; see Pattern.Block
+	block string
+	// standIn marks a pattern that takes the place of those for a block's
+	// members when the block isn't known, as in Match
+	standIn bool
+	wrapped bool
+}
+
+// DefinitionsFor returns the definition patterns for symbol in lang, like
+// DefinitionPatternFor, combined. With fold set, the symbol matches
+// case-insensitively, as with DefinitionPatternForFold.
+func DefinitionsFor(symbol string, lang Language, fold bool) Definitions {
+	return definitionPatterns(symbol, lang, fold)
+}
+
+// Match reports whether line defines the symbol by itself, and if it does,
+// the kind of the first of Patterns that matches it, for a search that
+// doesn't follow the blocks of grouped declarations; see MatchIn for one
+// that does.
+func (d Definitions) Match(line string) (string, bool) {
+	if !d.mayDefine(line) || !d.Combined.MatchString(line) {
+		return "", false
+	}
+	if i, _ := d.find(line, "", nil, false); i >= 0 {
+		return d.all[i].kind, true
+	}
+	return "", false
+}
+
+// MatchIn reports whether line, in a block of the kind Blocks reports, or
+// "" outside any, defines the symbol, and if it does, the kind of the first
+// pattern that matches it there. rest is the source following line, for a
+// definition that runs on past it; with rest nil, line has to be all of it.
+// A line without the symbol in it can't define it, so it's rejected before
+// any regex runs.
+func (d Definitions) MatchIn(line, block string, rest []byte) (string, bool) {
+	if !d.mayDefine(line) {
+		return "", false
+	}
+	// Combined leaves out the patterns for block members
+	if block == "" && !d.Combined.MatchString(line) {
+		return "", false
+	}
+	if i, _ := d.find(line, block, rest, true); i >= 0 {
+		return d.all[i].kind, true
+	}
+	// Only a pattern for another kind of block, or the start of a
+	// definition that doesn't go on to be one, matched
+	return "", false
+}
+
+// mayDefine reports whether line has the symbol in it, without which it
+// can't define it, so it's rejected before any regex runs.
+func (d Definitions) mayDefine(line string) bool {
+	if d.Combined == nil {
+		return false
+	}
+	if d.fold {
+		return strings.Contains(strings.ToLower(line), d.symbol)
+	}
+	return strings.Contains(line, d.symbol)
+}
+
+// Find returns where in line, in a block of the kind Blocks reports, or ""
+// outside any, the first pattern to match there matches, or nil if none
+// does. rest is as for MatchIn.
+func (d Definitions) Find(line, block string, rest []byte) []int {
+	_, loc := d.find(line, block, rest, true)
+	return loc
+}
+
+// find returns the index in all of the first pattern to match line, and
+// where it does, or -1 and nil. With inBlocks set, block is the line's
+// block and the patterns for block members apply in theirs; otherwise
+// the stand-ins for them apply on any line.
+func (d Definitions) find(line, block string, rest []byte, inBlocks bool) (int, []int) {
+	for i, p := range d.all {
+		if inBlocks && (p.standIn || p.block != "" && p.block != block) || !inBlocks && p.block != "" {
+			continue
+		}
+		loc := p.re.FindStringIndex(line)
+		if loc == nil || p.wrapped && (rest == nil || !d.lp.Unwraps(line[loc[1]:], rest)) {
+			continue
+		}
+		return i, loc
+	}
+	return -1, nil
+}
+
+// SmartCase reports whether a query should match case-insensitively under
+// smart-case rules: all-lowercase symbols fold case, while any uppercase
+// letter makes the match exact.
+func SmartCase(symbol string) bool {
+	return strings.ToLower(symbol) == symbol
+}
+
+// definitionPatterns implements DefinitionsFor.
+func definitionPatterns(symbol string, lang Language, fold bool) Definitions {
+	defs := Definitions{symbol: symbol, fold: fold}
+	if fold {
+		defs.symbol = strings.ToLower(symbol)
+	}
+	lp := ForLanguage(lang)
+	if lp == nil {
+		return defs
+	}
+	defs.lp = lp
+
+	// Track seen patterns to avoid duplicates (e.g., multiple "type" patterns
+	// in Go all generate the same symbol-specific regex)
+	seen := make(map[string]bool)
+	add := func(re *regexp.Regexp, p Pattern) {
+		defs.all = append(defs.all, definition{re: re, kind: p.Kind, block: p.Block, wrapped: p.Wrapped})
+		if p.Block == "" {
+			defs.Patterns = append(defs.Patterns, re)
+			defs.Kinds = append(defs.Kinds, p.Kind)
+			defs.Wrapped = append(defs.Wrapped, p.Wrapped)
+		}
+	}
+	sym := regexp.QuoteMeta(symbol)
+	if fold {
+		sym = `(?i:` + sym + `)`
+	}
+
+	for _, p := range lp.Definition {
+		if p.Custom {
+			key := "custom:" + p.Regex.String()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			// Custom regexes were validated when registered
+			if re, err := customDefinition(p, sym); err == nil {
+				add(re, p)
+			}
+			continue
+		}
+
+		// standIn takes the place of a block member's pattern where the
+		// block isn't known; see Definitions
+		var patStr, standIn string
+		switch lang {
+		case Go:
+			switch {
+			case p.Block == "const":
+				patStr = `^\t` + sym + `\s*(?:[=,]|\p{L}|$)`
+			case p.Block == "var":
+				patStr = `^\t` + sym + `\s*(?:[=,]|[\p{L}\[*(])`
+			case p.Block == "type":
+				patStr = `^\t` + sym + `(?:\[|\s+[\p{L}=*\[(])`
+			}
+			// A const or var member assigned a value, as in Name Type =
+			// value, unlike a field, a method, or a literal's key; one
+			// repeating the member before it, or only typed, needs the
+			// block
+			if p.Block == "const" || p.Block == "var" {
+				standIn = `^\t` + sym + `(?:\s*,\s*[\p{L}_][\p{L}\p{Nd}_]*)*(?:\s+[\p{L}\[*][^=\x60]*?)?\s+=[^=]`
+			}
+			switch p.Kind {
+			case "function":
+				patStr = `^func\s+` + sym + `\s*\(`
+			case "method":
+				patStr = `^func\s+\([^)]+\)\s+` + sym + `\s*\(`
+			case "type", "interface":
+				if p.Block == "" {
+					patStr = `^type\s+` + sym + `\s+`
+				}
+			case "const":
+				if p.Block == "" {
+					patStr = `^const\s+` + sym + `\s*(?:=|\p{L})`
+				}
+			case "var":
+				if p.Block == "" {
+					patStr = `^var\s+` + sym + `\s*`
+				}
+			}
+		case TypeScript, JavaScript:
+			switch {
+			case p.Wrapped:
+				patStr = `^(?:export\s+)?const\s+` + sym + `\s*=\s*(?:async\s*)?\(`
+			case p.Kind == "function":
+				// Match: function decl, arrow with parens (+ optional return type), or arrow without parens
+				patStr = `(?:` +
+					`^(?:export\s+)?(?:declare\s+)?(?:async\s+)?function\s+` + sym + `|` +
+					`^(?:export\s+)?const\s+` + sym + `\s*=\s*(?:async\s*)?\((?:[^()]*|\([^()]*\))*\).*?=>|` +
+					`^(?:export\s+)?const\s+` + sym + `\s*=\s*(?:async\s+)?[\p{L}_$][\p{L}\p{Nd}_$]*\s*=>|` +
+					`^(?:export\s+)?const\s+` + sym + `\s*=\s*` + wrappedComponent + `)`
+			case p.Kind == "component":
+				// The function patterns find components too, in a file of
+				// any extension, as symbol-specific patterns don't tell
+				// extensions apart
+			case p.Kind == "type", p.Kind == "interface":
+				patStr = `^(?:export\s+)?(?:declare\s+)?(?:abstract\s+|const\s+)?(?:class|interface|type|enum)\s+` + sym
+			case p.Kind == "var":
+				patStr = `^(?:export\s+)?declare\s+(?:const|let|var)\s+` + sym + `\s*:`
+			case p.Kind == "method" && lang == TypeScript:
+				patStr = `^\s+(?:(?:public|private|protected|static|async|readonly|override|abstract|get|set)\s+)*` + sym + `\s*(?:<[^>]*>)?\s*\([^)]*\)\s*(?::\s*[^{;=]+)?\{`
+			case p.Kind == "method":
+				patStr = `^\s+(?:(?:static|async|get|set)\s+)*` + sym + `\s*\([^)]*\)\s*\{`
+			}
+		case Python:
+			switch p.Kind {
+			case "function":
+				patStr = `^(?:async\s+)?def\s+` + sym + `\s*\(`
+			case "method":
+				// Also a function nested in another; see Scope
+				patStr = `^\s+(?:async\s+)?def\s+` + sym + `\s*\(`
+			case "type":
+				patStr = `^class\s+` + sym
+			}
+		case Rust:
+			switch p.Kind {
+			case "function":
+				patStr = `^(?:pub\s+)?(?:async\s+)?fn\s+` + sym + `\s*[<(]`
+			case "type":
+				patStr = `^(?:pub\s+)?(?:struct|enum)\s+` + sym
+			case "interface":
+				patStr = `^(?:pub\s+)?trait\s+` + sym
+			case "method":
+				patStr = `^\s+(?:pub(?:\([^)]*\))?\s+)?(?:async\s+)?fn\s+` + sym + `\s*[<(]`
+			}
+		case C:
+			switch p.Kind {
+			case "function":
+				patStr = cReturnType + sym + cDefinitionEnd
+			case "type":
+				patStr = `(?:` +
+					`^(?:typedef\s+)?(?:struct|union|enum)\s+` + sym + `\s*(?:\{|$)|` +
+					`^typedef\b.*\(\s*\*\s*` + sym + `\s*\)\s*\(|` +
+					`^typedef\b[^(]*[\s*]` + sym + `\s*(?:\[[^\]]*\])?\s*;|` +
+					`^\}\s*` + sym + `\s*;)`
+			case "macro":
+				patStr = `^\s*#\s*define\s+` + sym + `(?:[\s(]|$)`
+			}
+		case Cpp:
+			switch p.Kind {
+			case "function":
+				patStr = cppReturnType + sym + cDefinitionEnd
+			case "method":
+				patStr = `(?:` +
+					`^` + cppTemplate + `(?:` + cppSpecifiers + `)?` + cppQualifier + sym + cDefinitionEnd + `|` +
+					`^\s+` + cppTemplate + cppWord + `+` + sym + cppMemberEnd + `)`
+			case "type":
+				patStr = `(?:` +
+					`^\s*` + cppTemplate + `(?:typedef\s+)?(?:class|struct|union)\s+(?:\[\[[^\]]*\]\]\s*)?(?:[\p{Lu}_][\p{Lu}\p{Nd}_]*\s+)?` + sym + `(?:\s+final)?\s*(?:[:{]|$)|` +
+					`^\s*(?:typedef\s+)?enum(?:\s+(?:class|struct))?\s+` + sym + `\s*(?:[:{]|$)|` +
+					`^\s*` + cppTemplate + `using\s+` + sym + `\s*=|` +
+					`^\s*typedef\b.*\(\s*\*\s*` + sym + `\s*\)\s*\(|` +
+					`^\s*typedef\b[^(]*[\s*&]` + sym + `\s*(?:\[[^\]]*\])?\s*;)`
+			case "namespace":
+				patStr = `^\s*(?:inline\s+)?namespace\s+(?:[\p{L}_][\p{L}\p{Nd}_]*::)*` + sym + `\s*(?:\{|$)`
+			case "macro":
+				patStr = `^\s*#\s*define\s+` + sym + `(?:[\s(]|$)`
+			}
+		case Ruby:
+			switch p.Kind {
+			case "function":
+				patStr = `^def\s+(?:self\.)?` + sym + rubyNameEnd
+			case "method":
+				patStr = `^\s+def\s+(?:self\.)?` + sym + rubyNameEnd
+			case "type":
+				patStr = `^\s*class\s+(?:[\p{L}_][\p{L}\p{Nd}_]*::)*` + sym + `(?:[\s<;]|$)`
+			case "namespace":
+				patStr = `^\s*module\s+(?:[\p{L}_][\p{L}\p{Nd}_]*::)*` + sym + `(?:[\s;]|$)`
+			case "const":
+				patStr = `^(?:  )?` + sym + `\s*=(?:[^=~>]|$)`
+			}
+		case Kotlin:
+			switch p.Kind {
+			case "function":
+				patStr = `^` + kotlinFun + sym + `\s*\(`
+			case "method":
+				patStr = `^\s+` + kotlinFun + sym + `\s*\(`
+			case "interface":
+				patStr = `^\s*` + kotlinModifiers + `(?:fun\s+)?interface\s+` + sym + `(?:[\s<:{(]|$)`
+			case "type":
+				patStr = `^\s*` + kotlinModifiers + `(?:class|object|typealias)\s+` + sym + `(?:[\s<:{(=]|$)`
+			case "const":
+				patStr = `^(?:(?:public|private|internal)\s+)?const\s+val\s+` + sym + `\s*[:=]`
+			case "var":
+				patStr = `^` + kotlinModifiers + `(?:val|var)\s+(?:<[^>]*>\s*)?(?:[\p{L}_][\p{L}\p{Nd}_<>?,\s]*\.)?` + sym + `\s*[:=]`
+			}
+		case Swift:
+			switch p.Kind {
+			case "function":
+				patStr = `^` + swiftModifiers + `func\s+` + sym + `\s*[<(]`
+			case "method":
+				patStr = `^\s+` + swiftModifiers + `func\s+` + sym + `\s*[<(]`
+				if symbol == "init" {
+					patStr = `^\s+` + swiftModifiers + sym + `[?!]?\s*[<(]`
+				}
+			case "type":
+				patStr = `^\s*` + swiftModifiers + `(?:class|struct|enum|actor|typealias|extension\s+(?:[\p{L}_][\p{L}\p{Nd}_]*\.)*)\s*` + sym + `(?:[\s<:{=]|$)`
+			case "interface":
+				patStr = `^\s*` + swiftModifiers + `protocol\s+` + sym + `(?:[\s:{]|$)`
+			case "const":
+				patStr = `^` + swiftModifiers + `let\s+` + sym + `\s*[:=]`
+			case "var":
+				patStr = `^` + swiftModifiers + `var\s+` + sym + `\s*[:={]`
+			}
+		case CSharp:
+			switch p.Kind {
+			case "type":
+				patStr = `^\s*` + csharpModifiers + `(?:class|struct|enum|record(?:\s+(?:class|struct))?)\s+` + sym + `(?:[\s<:({;]|$)`
+			case "interface":
+				patStr = `^\s*` + csharpModifiers + `interface\s+` + sym + `(?:[\s<:{]|$)`
+			case "method":
+				end := csharpMethodEnd
+				if p.Wrapped {
+					end = `\s*(?:<[^()]*>)?\s*\(`
+				}
+				patStr = `(?:^\s*` + csharpModifiers + csharpType + sym + end + `|` + csharpConstructor + sym + end + `)`
+			case "var":
+				patStr = `^\s*` + csharpModifiers + csharpType + sym + `\s*\{\s*(?:(?:private|protected|internal)\s+)?(?:get|set|init)\b`
+			case "const":
+				patStr = `^\s*` + csharpModifiers + `const\s+` + csharpType + sym + `\s*=`
+			}
+		case Scala:
+			switch p.Kind {
+			case "function":
+				patStr = `^` + scalaModifiers + `def\s+` + sym + `(?:[\s(\[:=]|$)`
+			case "method":
+				patStr = `^\s+` + scalaModifiers + `def\s+` + sym + `(?:[\s(\[:=]|$)`
+			case "interface":
+				patStr = `^\s*` + scalaModifiers + `trait\s+` + sym + `(?:[\s(\[:{]|$)`
+			case "type":
+				patStr = `^\s*` + scalaModifiers + `(?:class|object|enum|type)\s+` + sym + `(?:[\s(\[:{=]|$)`
+			case "var":
+				patStr = scalaMember + scalaModifiers + `(?:val|var)\s+` + sym + `\s*[:=]`
+			}
+		case Elixir:
+			switch p.Kind {
+			case "function":
+				patStr = `^\s*def\s+` + sym + elixirNameEnd
+			case "private":
+				patStr = `^\s*defp\s+` + sym + elixirNameEnd
+			case "macro":
+				patStr = `^\s*defmacrop?\s+` + sym + elixirNameEnd
+			case "namespace":
+				patStr = `^\s*defmodule\s+` + elixirQualifier + sym + `(?:[\s,]|$)`
+			case "interface":
+				patStr = `^\s*defprotocol\s+` + elixirQualifier + sym + `(?:[\s,]|$)`
+			case "type":
+				// Only defstruct itself names a defstruct
+				if strings.EqualFold(symbol, "defstruct") {
+					patStr = `^\s*defstruct(?:[\s(\[]|$)`
+				}
+			}
+		case Zig:
+			switch p.Kind {
+			case "function":
+				patStr = `^` + zigFn + sym + `\s*\(`
+			case "method":
+				patStr = `^\s+` + zigFn + sym + `\s*\(`
+			case "type":
+				// The name is the constant's, left of the type it's
+				// assigned
+				patStr = `^\s*` + zigQualifiers + `const\s+` + sym + zigType
+			case "const":
+				patStr = `^` + zigQualifiers + `const\s+` + sym + `\s*[:=]`
+			case "var":
+				patStr = `^` + zigQualifiers + `var\s+` + sym + `\s*[:=]`
+			}
+		case Lua:
+			switch p.Kind {
+			case "function":
+				patStr = `(?:^\s*(?:local\s+)?function\s+` + sym + `\s*\(|^local\s+` + sym + `\s*=\s*function\s*\()`
+			case "method":
+				// A bare name matches with either . or :
+				patStr = `^\s*function\s+` + luaTable + `[.:]` + sym + `\s*\(`
+			}
+		case PHP:
+			switch p.Kind {
+			case "function":
+				patStr = `^function\s+&?\s*` + sym + `\s*\(`
+			case "method":
+				patStr = `^\s+` + phpModifiers + `function\s+&?\s*` + sym + `\s*\(`
+			case "type":
+				patStr = `^\s*(?:(?:abstract|final|readonly)\s+)*(?:class|trait|enum)\s+` + sym + `(?:[\s{:]|$)`
+			case "interface":
+				patStr = `^\s*interface\s+` + sym + `(?:[\s{]|$)`
+			case "const":
+				patStr = `^\s*(?:(?:public|protected|private|final)\s+)*const\s+(?:[\p{L}_?\\][\p{L}\p{Nd}_|\\]*\s+)?` + sym + `\s*=`
+			}
+		}
+
+		if key := p.Block + ":" + patStr; patStr != "" && !seen[key] {
+			seen[key] = true
+			// Compilation errors are safe to ignore: patterns are built from
+			// hardcoded templates + regexp.QuoteMeta(symbol), so they're always valid.
+			if re, err := regexp.Compile(patStr); err == nil {
+				add(re, p)
+			}
+		}
+		// A const and a var member look alike, so the first kind wins
+		if key := "stand-in:" + standIn; standIn != "" && !seen[key] {
+			seen[key] = true
+			re := regexp.MustCompile(standIn)
+			defs.all = append(defs.all, definition{re: re, kind: p.Kind, standIn: true})
+			defs.Patterns = append(defs.Patterns, re)
+			defs.Kinds = append(defs.Kinds, p.Kind)
+			defs.Wrapped = append(defs.Wrapped, false)
+		}
+	}
+
+	if len(defs.Patterns) == 0 {
+		return defs
+	}
+	alts := make([]string, len(defs.Patterns))
+	anchored := true
+	for i, re := range defs.Patterns {
+		alts[i] = `(?:` + re.String() + `)`
+		anchored = anchored && startAnchored(re)
+	}
+	combined := strings.Join(alts, "|")
+	// An alternation of anchored patterns isn't anchored to the regexp
+	// package, which would try it at every offset of the line; anchoring it
+	// outside lets a line that doesn't start right fail at once
+	if anchored {
+		combined = `^(?:` + combined + `)`
+	}
+	// Each alternative compiled on its own, so together they do too
+	defs.Combined = regexp.MustCompile(combined)
+	return defs
+}
+
+// startAnchored reports whether re can only match at the start of the text.
+func startAnchored(re *regexp.Regexp) bool {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return false
+	}
+	var anchored func(re *syntax.Regexp) bool
+	anchored = func(re *syntax.Regexp) bool {
+		switch re.Op {
+		case syntax.OpBeginText:
+			return true
+		case syntax.OpConcat, syntax.OpCapture:
+			return len(re.Sub) > 0 && anchored(re.Sub[0])
+		case syntax.OpAlternate:
+			for _, sub := range re.Sub {
+				if !anchored(sub) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	}
+	return anchored(parsed)
 }
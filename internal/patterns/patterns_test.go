@@ -1,6 +1,11 @@
 package patterns
 
 import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -17,6 +22,25 @@ func TestDetectLanguage(t *testing.T) {
 		{".mjs", JavaScript},
 		{".py", Python},
 		{".rs", Rust},
+		{".c", C},
+		{".h", C},
+		{".cpp", Cpp},
+		{".cc", Cpp},
+		{".cxx", Cpp},
+		{".hpp", Cpp},
+		{".hh", Cpp},
+		{".rb", Ruby},
+		{".php", PHP},
+		{".kt", Kotlin},
+		{".kts", Kotlin},
+		{".swift", Swift},
+		{".cs", CSharp},
+		{".scala", Scala},
+		{".sc", Scala},
+		{".ex", Elixir},
+		{".exs", Elixir},
+		{".zig", Zig},
+		{".lua", Lua},
 		{".unknown", Unknown},
 		{"", Unknown},
 	}
@@ -40,6 +64,17 @@ func TestForLanguage(t *testing.T) {
 		{JavaScript, false},
 		{Python, false},
 		{Rust, false},
+		{C, false},
+		{Cpp, false},
+		{Ruby, false},
+		{PHP, false},
+		{Kotlin, false},
+		{Swift, false},
+		{CSharp, false},
+		{Scala, false},
+		{Elixir, false},
+		{Zig, false},
+		{Lua, false},
 		{Unknown, true},
 		{Language("invalid"), true},
 	}
@@ -174,6 +209,34 @@ func TestDefinitionPatternFor(t *testing.T) {
 			testLine:   "export function createUser(name: string): User {",
 			shouldFind: true,
 		},
+		{
+			name:       "TypeScript declared function",
+			symbol:     "useQuery",
+			lang:       TypeScript,
+			testLine:   "export declare function useQuery<TData>(options: Options<TData>): Result<TData>;",
+			shouldFind: true,
+		},
+		{
+			name:       "TypeScript declared class",
+			symbol:     "QueryClient",
+			lang:       TypeScript,
+			testLine:   "export declare class QueryClient {",
+			shouldFind: true,
+		},
+		{
+			name:       "TypeScript declared const",
+			symbol:     "version",
+			lang:       TypeScript,
+			testLine:   "declare const version: string;",
+			shouldFind: true,
+		},
+		{
+			name:       "TypeScript const enum",
+			symbol:     "Status",
+			lang:       TypeScript,
+			testLine:   "export declare const enum Status {",
+			shouldFind: true,
+		},
 		{
 			name:       "Python function",
 			symbol:     "get_user",
@@ -202,6 +265,174 @@ func TestDefinitionPatternFor(t *testing.T) {
 			testLine:   "pub struct User {",
 			shouldFind: true,
 		},
+		{
+			name:       "C function",
+			symbol:     "user_new",
+			lang:       C,
+			testLine:   "struct user *user_new(const char *name) {",
+			shouldFind: true,
+		},
+		{
+			name:       "C call",
+			symbol:     "user_new",
+			lang:       C,
+			testLine:   "user_new(name);",
+			shouldFind: false,
+		},
+		{
+			name:       "C++ method",
+			symbol:     "draw",
+			lang:       Cpp,
+			testLine:   "void Widget::draw() {",
+			shouldFind: true,
+		},
+		{
+			name:       "C++ call",
+			symbol:     "draw",
+			lang:       Cpp,
+			testLine:   "    widget.draw();",
+			shouldFind: false,
+		},
+		{
+			name:       "Ruby class method",
+			symbol:     "find_by",
+			lang:       Ruby,
+			testLine:   "  def self.find_by(attrs)",
+			shouldFind: true,
+		},
+		{
+			name:       "Ruby call",
+			symbol:     "find_by",
+			lang:       Ruby,
+			testLine:   "    User.find_by(name: name)",
+			shouldFind: false,
+		},
+		{
+			name:       "PHP static method",
+			symbol:     "findById",
+			lang:       PHP,
+			testLine:   "    public static function findById(int $id): ?User",
+			shouldFind: true,
+		},
+		{
+			name:       "PHP call",
+			symbol:     "findById",
+			lang:       PHP,
+			testLine:   "        $user = self::findById($id);",
+			shouldFind: false,
+		},
+		{
+			name:       "Kotlin suspend function",
+			symbol:     "fetchUser",
+			lang:       Kotlin,
+			testLine:   "internal suspend fun fetchUser(id: Long): User {",
+			shouldFind: true,
+		},
+		{
+			name:       "Kotlin call",
+			symbol:     "fetchUser",
+			lang:       Kotlin,
+			testLine:   "    val user = fetchUser(id)",
+			shouldFind: false,
+		},
+		{
+			name:       "Swift generic function",
+			symbol:     "map",
+			lang:       Swift,
+			testLine:   "public func map<T>(_ transform: (Element) -> T) -> [T] {",
+			shouldFind: true,
+		},
+		{
+			name:       "Swift call",
+			symbol:     "map",
+			lang:       Swift,
+			testLine:   "let names = users.map { $0.name }",
+			shouldFind: false,
+		},
+		{
+			name:       "C# async method",
+			symbol:     "GetUser",
+			lang:       CSharp,
+			testLine:   "        public async Task<User> GetUser(int id)",
+			shouldFind: true,
+		},
+		{
+			name:       "C# call",
+			symbol:     "GetUser",
+			lang:       CSharp,
+			testLine:   "            var user = await GetUser(id);",
+			shouldFind: false,
+		},
+		{
+			name:       "Scala object member",
+			symbol:     "apply",
+			lang:       Scala,
+			testLine:   "  def apply(name: String): User =",
+			shouldFind: true,
+		},
+		{
+			name:       "Scala call",
+			symbol:     "apply",
+			lang:       Scala,
+			testLine:   "    val user = User.apply(name)",
+			shouldFind: false,
+		},
+		{
+			name:       "Elixir function with parentheses",
+			symbol:     "create_user",
+			lang:       Elixir,
+			testLine:   "  def create_user(attrs \\\\ %{}) do",
+			shouldFind: true,
+		},
+		{
+			name:       "Elixir function without parentheses",
+			symbol:     "list_users",
+			lang:       Elixir,
+			testLine:   "  def list_users do",
+			shouldFind: true,
+		},
+		{
+			name:       "Elixir call",
+			symbol:     "list_users",
+			lang:       Elixir,
+			testLine:   "    users = Accounts.list_users()",
+			shouldFind: false,
+		},
+		{
+			name:       "Zig struct",
+			symbol:     "Point",
+			lang:       Zig,
+			testLine:   "pub const Point = struct {",
+			shouldFind: true,
+		},
+		{
+			name:       "Zig struct literal",
+			symbol:     "Point",
+			lang:       Zig,
+			testLine:   "    const p = Point{ .x = 1, .y = 2 };",
+			shouldFind: false,
+		},
+		{
+			name:       "Lua method with a dot",
+			symbol:     "new",
+			lang:       Lua,
+			testLine:   "function Stack.new(items)",
+			shouldFind: true,
+		},
+		{
+			name:       "Lua method with a colon",
+			symbol:     "push",
+			lang:       Lua,
+			testLine:   "function Stack:push(item)",
+			shouldFind: true,
+		},
+		{
+			name:       "Lua method call",
+			symbol:     "push",
+			lang:       Lua,
+			testLine:   "  stack:push(item)",
+			shouldFind: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -264,6 +495,98 @@ func TestLanguagePatterns_TestFileDetection(t *testing.T) {
 	}
 }
 
+func TestIsTestFile(t *testing.T) {
+	tests := []struct {
+		rel  string
+		lang Language
+		want bool
+	}{
+		{"pkg/user_test.go", Go, true},
+		{"pkg/user.go", Go, false},
+		{"app/tests/test_user.py", Python, true},
+		{"app/contest_user.py", Python, false},
+		{"crate/tests/integration.rs", Rust, true},
+		{"tests/integration.rs", Rust, true},
+		{"crate/src/lib.rs", Rust, false},
+		{"src/__tests__/user.ts", TypeScript, true},
+		{"spec/user.ts", TypeScript, true},
+		{"src/inspector/user.ts", TypeScript, false},
+		{"web/test/user.js", JavaScript, true},
+		{"web/__tests__/user.jsx", JavaScript, true},
+		{"web/latest/user.js", JavaScript, false},
+		{"app/tests/conftest.py", Python, true},
+		{"app/attests/user.py", Python, false},
+		{"pkg/tests/user.go", Go, false},
+		{"README.md", "", false},
+		{"pkg/scan/testdata/big.go", Go, true},
+		{"internal/fixtures/user.go", Go, true},
+		{"pkg/testdatabase/user.go", Go, false},
+		{"src/__mocks__/api.ts", TypeScript, true},
+		{"src/Button.stories.tsx", TypeScript, true},
+		{"src/Button.tsx", TypeScript, false},
+		{"features/step_definitions/cart.js", JavaScript, true},
+		{"src/features/cart.js", JavaScript, false},
+		{"web/Button.stories.jsx", JavaScript, true},
+		{"features/steps/cart.py", Python, true},
+		{"app/fixtures/users.py", Python, true},
+		{"crate/src/fixtures/mod.rs", Rust, true},
+		{"tests/test_parser.c", C, true},
+		{"src/parser_test.c", C, true},
+		{"src/parser.c", C, false},
+		{"src/widget_test.cpp", Cpp, true},
+		{"src/widget_unittest.cc", Cpp, true},
+		{"src/widget.cpp", Cpp, false},
+		{"spec/models/user_spec.rb", Ruby, true},
+		{"lib/user_spec.rb", Ruby, true},
+		{"lib/test_user.rb", Ruby, true},
+		{"lib/user_test.rb", Ruby, true},
+		{"lib/user.rb", Ruby, false},
+		{"tests/Unit/UserTest.php", PHP, true},
+		{"src/UserTest.php", PHP, true},
+		{"src/User.php", PHP, false},
+		{"app/src/test/kotlin/UserTest.kt", Kotlin, true},
+		{"src/UserRepositoryTest.kt", Kotlin, true},
+		{"src/User.kt", Kotlin, false},
+		{"Tests/AppTests/UserTests.swift", Swift, true},
+		{"Sources/App/UserTests.swift", Swift, true},
+		{"Sources/App/User.swift", Swift, false},
+		{"src/App.Tests/UserServiceTests.cs", CSharp, true},
+		{"src/App/UserServiceTest.cs", CSharp, true},
+		{"src/App.Tests/Fixtures.cs", CSharp, true},
+		{"src/App/UserService.cs", CSharp, false},
+		{"src/test/scala/UserSpec.scala", Scala, true},
+		{"core/UserSuite.scala", Scala, true},
+		{"core/UserTest.scala", Scala, true},
+		{"core/User.scala", Scala, false},
+		{"test/my_app/accounts_test.exs", Elixir, true},
+		{"lib/my_app/accounts.ex", Elixir, false},
+		{"lib/my_app/accounts_test.ex", Elixir, false},
+		{"src/parser_test.zig", Zig, true},
+		{"src/parser.zig", Zig, false},
+		{"spec/stack_spec.lua", Lua, true},
+		{"lib/stack_spec.lua", Lua, true},
+		{"lib/stack.lua", Lua, false},
+		// Windows separators
+		{`pkg\user_test.go`, Go, true},
+		{`app\tests\test_user.py`, Python, true},
+		{`crate\tests\integration.rs`, Rust, true},
+		{`src\__tests__\user.ts`, TypeScript, true},
+		{`web\spec\user.js`, JavaScript, true},
+		{`web\latest\user.js`, JavaScript, false},
+		{`app\attests\user.py`, Python, false},
+		{`pkg\scan\testdata\big.go`, Go, true},
+		{`features\steps\cart.py`, Python, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			if got := IsTestFile(tt.rel, tt.lang); got != tt.want {
+				t.Errorf("IsTestFile(%q, %q) = %v, want %v", tt.rel, tt.lang, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestAllLanguages(t *testing.T) {
 	langs := AllLanguages()
 
@@ -284,6 +607,7 @@ func TestArrowFunctionPatterns(t *testing.T) {
 		name        string
 		lang        Language
 		line        string
+		rest        string // The lines after line
 		wantName    string
 		shouldMatch bool
 	}{
@@ -351,7 +675,44 @@ func TestArrowFunctionPatterns(t *testing.T) {
 			shouldMatch: true,
 			wantName:    "getName",
 		},
+		{
+			name:        "TS parameters wrapped by Prettier",
+			lang:        TypeScript,
+			line:        "export const createOrder = async (",
+			rest:        "  userId: string,\n  items: Item[],\n): Promise<Order> => {\n  return save(userId, items);\n};\n",
+			shouldMatch: true,
+			wantName:    "createOrder",
+		},
+		{
+			name:        "TS wrapped parameters with nested parens",
+			lang:        TypeScript,
+			line:        "const withRetry = (",
+			rest:        "  fn: () => Promise<void>,\n  opts = defaults(),\n) =>\n  loop(fn, opts);\n",
+			shouldMatch: true,
+			wantName:    "withRetry",
+		},
 		// TypeScript - should NOT match (false positives)
+		{
+			name:        "TS wrapped parenthesized tuple",
+			lang:        TypeScript,
+			line:        "const pair = (",
+			rest:        "  a,\n  b\n);\nconst f = (x: number) => x;\n",
+			shouldMatch: false,
+		},
+		{
+			name:        "TS wrapped arithmetic",
+			lang:        TypeScript,
+			line:        "const total = (",
+			rest:        "  price +\n  tax\n) * 2;\n",
+			shouldMatch: false,
+		},
+		{
+			name:        "TS parameters too long to look ahead through",
+			lang:        TypeScript,
+			line:        "const build = (",
+			rest:        strings.Repeat("  option: string,\n", MaxWrappedLines) + ") => {\n",
+			shouldMatch: false,
+		},
 		{
 			name:        "TS parenthesized expression",
 			lang:        TypeScript,
@@ -395,7 +756,22 @@ func TestArrowFunctionPatterns(t *testing.T) {
 			shouldMatch: true,
 			wantName:    "fetchAPI",
 		},
+		{
+			name:        "JS wrapped parameters",
+			lang:        JavaScript,
+			line:        "export const fetchAll = async (",
+			rest:        "  urls,\n  { retries = 3 } = {},\n) => {\n",
+			shouldMatch: true,
+			wantName:    "fetchAll",
+		},
 		// JavaScript - should NOT match
+		{
+			name:        "JS wrapped call arguments",
+			lang:        JavaScript,
+			line:        "const client = (",
+			rest:        "  createClient(url)\n);\n",
+			shouldMatch: false,
+		},
 		{
 			name:        "JS parenthesized expression",
 			lang:        JavaScript,
@@ -419,11 +795,13 @@ func TestArrowFunctionPatterns(t *testing.T) {
 				if p.Kind != "function" {
 					continue
 				}
-				if matches := p.Regex.FindStringSubmatch(tt.line); len(matches) > 1 {
-					matched = true
-					matchedName = matches[1]
-					break
+				loc := p.Regex.FindStringSubmatchIndex(tt.line)
+				if len(loc) < 4 || p.Wrapped && !lp.Unwraps(tt.line[loc[1]:], []byte(tt.rest)) {
+					continue
 				}
+				matched = true
+				matchedName = tt.line[loc[2]:loc[3]]
+				break
 			}
 
 			if matched != tt.shouldMatch {
@@ -437,11 +815,498 @@ func TestArrowFunctionPatterns(t *testing.T) {
 	}
 }
 
+func TestWrappedComponentPatterns(t *testing.T) {
+	tests := []struct {
+		lang     Language
+		ext      string
+		line     string
+		wantName string
+		wantKind string
+	}{
+		{TypeScript, ".tsx", "export const Card = React.memo(({ title }) => {", "Card", "component"},
+		{TypeScript, ".tsx", "const Input = forwardRef(function Input(props, ref) {", "Input", "component"},
+		{TypeScript, ".tsx", "const Input = forwardRef<HTMLInputElement, Props>((props, ref) => (", "Input", "component"},
+		{TypeScript, ".tsx", "export const Row = memo(forwardRef((props, ref) => {", "Row", "component"},
+		{TypeScript, ".tsx", "const Panel = observer(() => {", "Panel", "component"},
+		{TypeScript, ".tsx", "const Button = styled.button`", "Button", "component"},
+		{TypeScript, ".tsx", "const Title = styled.h1<{ muted: boolean }>`", "Title", "component"},
+		{TypeScript, ".tsx", "const Fancy = styled(Link)`", "Fancy", "component"},
+		{TypeScript, ".ts", "export const Card = React.memo(({ title }) => {", "Card", "function"},
+		{JavaScript, ".jsx", "const Button = styled.button`", "Button", "component"},
+		{JavaScript, ".js", "const Input = forwardRef(function Input(props, ref) {", "Input", "function"},
+		// Not components
+		{TypeScript, ".tsx", "const x = memo", "", ""},
+		{TypeScript, ".tsx", "const Cached = memo(Button)", "", ""},
+		{TypeScript, ".tsx", "const theme = styled", "", ""},
+		{JavaScript, ".jsx", "const total = memoize(() => 1)", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ext+" "+tt.line, func(t *testing.T) {
+			var name, kind string
+			for _, p := range ForLanguage(tt.lang).DefinitionsFor(tt.ext) {
+				if m := p.Regex.FindStringSubmatch(tt.line); m != nil && !p.Wrapped {
+					name, kind = m[1], p.Kind
+					break
+				}
+			}
+			if name != tt.wantName || kind != tt.wantKind {
+				t.Errorf("matched %q as %q, want %q as %q", name, kind, tt.wantName, tt.wantKind)
+			}
+			// The name the const declares, whether or not it's a definition
+			sym := strings.Fields(tt.line)[slices.Index(strings.Fields(tt.line), "const")+1]
+			if _, ok := DefinitionsFor(sym, tt.lang, false).Match(tt.line); ok != (tt.wantName != "") {
+				t.Errorf("DefinitionsFor(%q).Match(%q) = %v, want %v", sym, tt.line, ok, !ok)
+			}
+		})
+	}
+}
+
+// definitionCase is a line that defines sym as kind, or when kind is "",
+// mentions sym without defining it.
+type definitionCase struct {
+	line string
+	sym  string
+	kind string
+}
+
+// checkDefinitions checks that lang's patterns find each case's definition
+// and nothing else, both extracting definitions and searching for sym's.
+func checkDefinitions(t *testing.T, lang Language, tests []definitionCase) {
+	t.Helper()
+	lp := ForLanguage(lang)
+	for _, tt := range tests {
+		var name, kind string
+		for _, p := range lp.Definition {
+			if m := p.Regex.FindStringSubmatch(tt.line); m != nil && p.Block == "" && !p.Wrapped && !slices.Contains(lp.Reserved, m[1]) {
+				name, kind = m[1], p.Kind
+				break
+			}
+		}
+		if tt.kind == "" && name == tt.sym || tt.kind != "" && (name != tt.sym || kind != tt.kind) {
+			t.Errorf("%s: %q matched %q as %q, want %q as %q", lang, tt.line, name, kind, tt.sym, tt.kind)
+		}
+		if got, _ := DefinitionsFor(tt.sym, lang, false).Match(tt.line); got != tt.kind {
+			t.Errorf("%s: DefinitionsFor(%q).Match(%q) = %q, want %q", lang, tt.sym, tt.line, got, tt.kind)
+		}
+	}
+}
+
+func TestIdentExcept(t *testing.T) {
+	re := regexp.MustCompile(`^` + identExcept("return", "else", "do", "_Alignof") + `$`)
+	for name, want := range map[string]bool{
+		"return":    false,
+		"else":      false,
+		"do":        false,
+		"_Alignof":  false,
+		"returns":   true,
+		"retur":     true,
+		"r":         true,
+		"Return":    true,
+		"elsewhere": true,
+		"d":         true,
+		"done":      true,
+		"_":         true,
+		"_Align":    true,
+		"x2":        true,
+		"é":         true,
+		"2x":        false,
+		"":          false,
+	} {
+		if got := re.MatchString(name); got != want {
+			t.Errorf("identExcept matches %q = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestCPatterns(t *testing.T) {
+	checkDefinitions(t, C, []definitionCase{
+		{"int main(int argc, char **argv) {", "main", "function"},
+		{"static inline int clamp(int v, int lo, int hi)", "clamp", "function"},
+		{"char *strdup_or_die(const char *s) {", "strdup_or_die", "function"},
+		{"const struct user *user_find(struct db *db,", "user_find", "function"},
+		{"void reset(void) { count = 0; }", "reset", "function"},
+		{"return_t make(void) {", "make", "function"},
+		{"int *find(int key) {", "find", "function"},
+		{"struct user {", "user", "type"},
+		{"typedef struct node {", "node", "type"},
+		{"enum color", "color", "type"},
+		{"union value {", "value", "type"},
+		{"typedef unsigned long size_type;", "size_type", "type"},
+		{"typedef struct user user_t;", "user_t", "type"},
+		{"typedef int (*handler_fn)(int code);", "handler_fn", "type"},
+		{"} point_t;", "point_t", "type"},
+		{"#define MAX_USERS 100", "MAX_USERS", "macro"},
+		{"#  define MIN(a, b) ((a) < (b) ? (a) : (b))", "MIN", "macro"},
+		// Calls, prototypes, and declarations define nothing
+		{"foo(bar);", "foo", ""},
+		{"    foo(bar);", "foo", ""},
+		{"    result = compute(x, y);", "compute", ""},
+		{"int n = count(items);", "count", ""},
+		{"    return build(a,", "build", ""},
+		{"return build(a,", "build", ""},
+		{"else build(a)", "build", ""},
+		{"case build(a):", "build", ""},
+		{"a * build(z)", "build", ""},
+		{"int parse(const char *s);", "parse", ""},
+		{"extern void log_error(const char *fmt, ...);", "log_error", ""},
+		{"struct user;", "user", ""},
+		{"struct user *current = NULL;", "user", ""},
+		{"#include \"user.h\"", "user", ""},
+	})
+}
+
+func TestCppPatterns(t *testing.T) {
+	checkDefinitions(t, Cpp, []definitionCase{
+		{"int main(int argc, char **argv) {", "main", "function"},
+		{"std::vector<int> parse(const std::string& s) {", "parse", "function"},
+		{"template <typename T> T clamp(T v, T lo, T hi) {", "clamp", "function"},
+		{"Widget& get(int i) {", "get", "function"},
+		{"new_handler install(new_handler h) {", "install", "function"},
+		{"void Widget::draw() {", "draw", "method"},
+		{"void Widget::draw() const {", "draw", "method"},
+		{"Widget::Widget(int w) : w_(w) {}", "Widget", "method"},
+		{"Widget::~Widget() {", "~Widget", "method"},
+		{"template <typename T> void Stack<T>::push(const T& v) {", "push", "method"},
+		{"const std::string& ui::Widget::name() const {", "name", "method"},
+		{"    virtual void draw() const override {", "draw", "method"},
+		{"    int size() const { return n_; }", "size", "method"},
+		{"class Widget {", "Widget", "type"},
+		{"class Widget : public Base {", "Widget", "type"},
+		{"class API_EXPORT Widget final : public Base {", "Widget", "type"},
+		{"struct Point {", "Point", "type"},
+		{"template <typename T> class Stack {", "Stack", "type"},
+		{"enum class Color : int { Red, Green };", "Color", "type"},
+		{"using Vec = std::vector<int>;", "Vec", "type"},
+		{"template <typename T> using Ptr = std::unique_ptr<T>;", "Ptr", "type"},
+		{"typedef unsigned long size_type;", "size_type", "type"},
+		{"namespace shapes {", "shapes", "namespace"},
+		{"namespace outer::inner {", "inner", "namespace"},
+		{"#define MAX_WIDGETS 100", "MAX_WIDGETS", "macro"},
+		// Calls, declarations, and using directives define nothing
+		{"    widget.draw();", "draw", ""},
+		{"    draw();", "draw", ""},
+		{"    Widget::create(1);", "create", ""},
+		{"new build(bar)", "build", ""},
+		{"delete build(bar)", "build", ""},
+		{"throw build(bar)", "build", ""},
+		{"co_return build(x)", "build", ""},
+		{"return build(a,", "build", ""},
+		{"else build(a)", "build", ""},
+		{"a * build(z)", "build", ""},
+		{"return Widget::create(a,", "create", ""},
+		{"    int size() const;", "size", ""},
+		{"void draw();", "draw", ""},
+		{"class Widget;", "Widget", ""},
+		{"using namespace std;", "std", ""},
+		{"using std::vector;", "vector", ""},
+		{"    Widget w(1);", "Widget", ""},
+	})
+}
+
+func TestRubyPatterns(t *testing.T) {
+	checkDefinitions(t, Ruby, []definitionCase{
+		{"def helper(x)", "helper", "function"},
+		{"def helper", "helper", "function"},
+		{"  def initialize(name)", "initialize", "method"},
+		{"  def self.find_by(attrs)", "find_by", "method"},
+		{"    def empty?", "empty?", "method"},
+		{"    def save!(validate: true)", "save!", "method"},
+		{"  def name=(value)", "name=", "method"},
+		{"  def total = items.sum", "total", "method"},
+		{"  def reset; end", "reset", "method"},
+		{"class User", "User", "type"},
+		{"class Admin < User", "Admin", "type"},
+		{"  class Shop::Cart < Base", "Cart", "type"},
+		{"module Billing", "Billing", "namespace"},
+		{"module Billing::Invoices", "Invoices", "namespace"},
+		{"MAX_USERS = 100", "MAX_USERS", "const"},
+		{"  VERSION = \"1.0\".freeze", "VERSION", "const"},
+		{"Point = Struct.new(:x, :y)", "Point", "const"},
+		// Calls, comparisons, and deeper assignments define nothing
+		{"    User.find_by(name: name)", "find_by", ""},
+		{"    helper(x)", "helper", ""},
+		{"User.new(name)", "User", ""},
+		{"class << self", "self", ""},
+		{"  def helper_two(x)", "helper", ""},
+		{"MAX_USERS == count", "MAX_USERS", ""},
+		{"      LIMIT = 5", "LIMIT", ""},
+		{"require \"user\"", "user", ""},
+	})
+}
+
+func TestPHPPatterns(t *testing.T) {
+	checkDefinitions(t, PHP, []definitionCase{
+		// Procedural code
+		{"function render_page($title) {", "render_page", "function"},
+		{"function &get_registry(): array", "get_registry", "function"},
+		{"const MAX_USERS = 100;", "MAX_USERS", "const"},
+		// Classes and their members
+		{"class UserController extends Controller", "UserController", "type"},
+		{"final class User implements JsonSerializable {", "User", "type"},
+		{"abstract class Model", "Model", "type"},
+		{"readonly class Point", "Point", "type"},
+		{"trait HasTimestamps", "HasTimestamps", "type"},
+		{"enum Status: string", "Status", "type"},
+		{"interface Repository", "Repository", "interface"},
+		{"    public function __construct(private Db $db)", "__construct", "method"},
+		{"    public static function findById(int $id): ?User", "findById", "method"},
+		{"    protected function validate(): void {", "validate", "method"},
+		{"    private static function &instance()", "instance", "method"},
+		{"    abstract protected function table(): string;", "table", "method"},
+		{"    final public function save() {", "save", "method"},
+		{"    function legacy() {", "legacy", "method"},
+		{"    const TABLE = 'users';", "TABLE", "const"},
+		{"    private const int LIMIT = 10;", "LIMIT", "const"},
+		{"    final public const VERSION = '1.0';", "VERSION", "const"},
+		// Calls and references define nothing
+		{"        $user = self::findById($id);", "findById", ""},
+		{"render_page('Home');", "render_page", ""},
+		{"    $users = new User($db);", "User", ""},
+		{"echo MAX_USERS;", "MAX_USERS", ""},
+		{"use App\\Models\\User;", "User", ""},
+		{"    $callback = function () use ($x) {", "x", ""},
+	})
+}
+
+func TestKotlinPatterns(t *testing.T) {
+	checkDefinitions(t, Kotlin, []definitionCase{
+		{"fun main(args: Array<String>) {", "main", "function"},
+		{"private fun helper() = 42", "helper", "function"},
+		{"internal suspend fun fetchUser(id: Long): User {", "fetchUser", "function"},
+		{"fun <T> List<T>.second(): T = this[1]", "second", "function"},
+		{"fun String.slugify(): String {", "slugify", "function"},
+		{"    override fun onCreate(savedInstanceState: Bundle?) {", "onCreate", "method"},
+		{"    public suspend inline fun <reified T> load(key: String): T? {", "load", "method"},
+		{"class UserRepository(private val db: Database) {", "UserRepository", "type"},
+		{"data class User(val id: Long, val name: String)", "User", "type"},
+		{"sealed class Result<out T> {", "Result", "type"},
+		{"enum class Color { RED, GREEN }", "Color", "type"},
+		{"object Registry {", "Registry", "type"},
+		{"    private object Cache", "Cache", "type"},
+		{"interface Repository<T> {", "Repository", "interface"},
+		{"fun interface Listener {", "Listener", "interface"},
+		{"typealias UserMap = Map<Long, User>", "UserMap", "type"},
+		{"const val MAX_USERS = 100", "MAX_USERS", "const"},
+		{"val defaultTimeout: Duration = 30.seconds", "defaultTimeout", "var"},
+		{"private var counter = 0", "counter", "var"},
+		{"val String.isSlug: Boolean get() = all { it.isLetter() }", "isSlug", "var"},
+		// Calls, locals, and companion objects define nothing
+		{"    val user = fetchUser(id)", "fetchUser", ""},
+		{"    val user = fetchUser(id)", "user", ""},
+		{"        helper()", "helper", ""},
+		{"    companion object {", "object", ""},
+		{"import com.example.User", "User", ""},
+		{"    return User(id, name)", "User", ""},
+	})
+}
+
+func TestSwiftPatterns(t *testing.T) {
+	checkDefinitions(t, Swift, []definitionCase{
+		{"func greet(name: String) -> String {", "greet", "function"},
+		{"func map<T>(_ transform: (Element) -> T) -> [T] {", "map", "function"},
+		{"@MainActor public func reload() async throws {", "reload", "function"},
+		{"    private static func makeDefault() -> Self {", "makeDefault", "method"},
+		{"    override open func viewDidLoad() {", "viewDidLoad", "method"},
+		{"    mutating func append(_ item: Item)", "append", "method"},
+		{"    public init(name: String) {", "init", "method"},
+		{"    convenience init?(json: [String: Any]) {", "init", "method"},
+		{"class ViewController: UIViewController {", "ViewController", "type"},
+		{"public final class Cache<Key: Hashable, Value> {", "Cache", "type"},
+		{"struct Point {", "Point", "type"},
+		{"indirect enum Tree<T> {", "Tree", "type"},
+		{"actor Counter {", "Counter", "type"},
+		{"protocol Repository: AnyObject {", "Repository", "interface"},
+		{"extension String {", "String", "type"},
+		{"extension Foo.Bar: Codable {", "Bar", "type"},
+		{"public typealias Handler = (Result<Data, Error>) -> Void", "Handler", "type"},
+		{"let maxUsers = 100", "maxUsers", "const"},
+		{"public let defaultTimeout: TimeInterval = 30", "defaultTimeout", "const"},
+		{"private(set) var counter = 0", "counter", "var"},
+		{"var isEnabled: Bool {", "isEnabled", "var"},
+		// Calls, locals, and member properties define nothing
+		{"let names = users.map { $0.name }", "map", ""},
+		{"    greet(name: \"Ada\")", "greet", ""},
+		{"    let user = Point(x: 1, y: 2)", "user", ""},
+		{"    var total = 0", "total", ""},
+		{"    let p = Point()", "Point", ""},
+		{"import Foundation", "Foundation", ""},
+	})
+}
+
+func TestCSharpPatterns(t *testing.T) {
+	checkDefinitions(t, CSharp, []definitionCase{
+		{"public class UserService", "UserService", "type"},
+		{"    internal sealed partial class Cache<T> : ICache<T> where T : class", "Cache", "type"},
+		{"public record Point(int X, int Y);", "Point", "type"},
+		{"    public readonly record struct Money(decimal Amount);", "Money", "type"},
+		{"    struct Vector {", "Vector", "type"},
+		{"public enum Role : byte", "Role", "type"},
+		{"public interface IRepository<T>", "IRepository", "interface"},
+		{"        public async Task<User> GetUser(int id)", "GetUser", "method"},
+		{"        public static void Main(string[] args) {", "Main", "method"},
+		{"        protected override bool Equals(object? other) => other is User;", "Equals", "method"},
+		{"        private static IEnumerable<T> Filter<T>(IEnumerable<T> items, Func<T, bool> keep)", "Filter", "method"},
+		{"        int Count() { return items.Count; }", "Count", "method"},
+		{"        public UserService(IRepository<User> repo) : base(repo)", "UserService", "method"},
+		{"        static UserService()", "UserService", "method"},
+		{"        public string Name { get; set; }", "Name", "var"},
+		{"        public List<string> Tags { get; private set; } = new();", "Tags", "var"},
+		{"        public int Id { get => id; init => id = value; }", "Id", "var"},
+		{"        public const int MaxUsers = 100;", "MaxUsers", "const"},
+		// Calls, fields, and statements define nothing
+		{"            var user = await GetUser(id);", "GetUser", ""},
+		{"            return GetUser(id);", "GetUser", ""},
+		{"            throw new ArgumentException(nameof(id));", "ArgumentException", ""},
+		{"            Console.WriteLine(user);", "WriteLine", ""},
+		{"        private readonly IRepository<User> _repo;", "_repo", ""},
+		{"        private int _count = Compute(1);", "Compute", ""},
+		{"using System.Collections.Generic;", "Generic", ""},
+	})
+}
+
+func TestScalaPatterns(t *testing.T) {
+	checkDefinitions(t, Scala, []definitionCase{
+		{"def main(args: Array[String]): Unit =", "main", "function"},
+		{"class UserService(repo: Repository) extends Service {", "UserService", "type"},
+		{"final case class User(id: Long, name: String)", "User", "type"},
+		{"sealed abstract class Shape", "Shape", "type"},
+		{"case object Empty extends Shape", "Empty", "type"},
+		{"enum Color:", "Color", "type"},
+		{"trait Repository[F[_]] {", "Repository", "interface"},
+		{"sealed trait Event", "Event", "interface"},
+		{"type UserId = Long", "UserId", "type"},
+		{"val MaxUsers = 100", "MaxUsers", "var"},
+		// Members indented inside an object, the common layout
+		{"object UserService {", "UserService", "type"},
+		{"  def apply(name: String): User =", "apply", "method"},
+		{"  private[service] def validate(user: User): Boolean = {", "validate", "method"},
+		{"  implicit def ordering: Ordering[User] = Ordering.by(_.id)", "ordering", "method"},
+		{"  override def toString = s\"UserService\"", "toString", "method"},
+		{"  def find[A](id: Long)(implicit ec: ExecutionContext): Future[A]", "find", "method"},
+		{"  def size: Int", "size", "method"},
+		{"  private val cache = mutable.Map.empty[Long, User]", "cache", "var"},
+		{"  lazy val default: User = User(0, \"\")", "default", "var"},
+		{"  var counter: Int = 0", "counter", "var"},
+		{"  type Handler = User => Unit", "Handler", "type"},
+		{"  case class Config(url: String)", "Config", "type"},
+		// Calls, locals, and match cases define nothing
+		{"    val user = User.apply(name)", "apply", ""},
+		{"    val user = User.apply(name)", "user", ""},
+		{"      validate(user)", "validate", ""},
+		{"    case User(id, _) => id", "User", ""},
+		{"import scala.concurrent.Future", "Future", ""},
+	})
+}
+
+func TestElixirPatterns(t *testing.T) {
+	checkDefinitions(t, Elixir, []definitionCase{
+		{"defmodule MyApp.Accounts.User do", "User", "namespace"},
+		{"defmodule Accounts do", "Accounts", "namespace"},
+		{"defprotocol MyApp.Renderable do", "Renderable", "interface"},
+		{"  defstruct [:name, :email, age: 0]", "defstruct", "type"},
+		{"  defstruct name: nil, email: nil", "defstruct", "type"},
+		{"  def create_user(attrs \\\\ %{}) do", "create_user", "function"},
+		{"  def list_users do", "list_users", "function"},
+		{"  def valid?(user), do: user.name != nil", "valid?", "function"},
+		{"  def save!(user) when is_map(user) do", "save!", "function"},
+		{"  def fetch, do: :ok", "fetch", "function"},
+		{"  def render(data)", "render", "function"},
+		{"def main(args) do", "main", "function"},
+		{"  defp normalize(email) do", "normalize", "private"},
+		{"  defp default_age, do: 18", "default_age", "private"},
+		{"  defmacro unless(condition, do: block) do", "unless", "macro"},
+		{"  defmacrop debug(msg) do", "debug", "macro"},
+		// Calls, pipes, and attributes define nothing
+		{"    users = Accounts.list_users()", "list_users", ""},
+		{"    |> normalize()", "normalize", ""},
+		{"    %User{name: name}", "User", ""},
+		{"  @spec create_user(map()) :: {:ok, User.t()}", "create_user", ""},
+		{"  defdelegate fetch(id), to: Repo", "fetch", ""},
+		{"  alias MyApp.Accounts.User", "User", ""},
+		{"    definition = 1", "definition", ""},
+	})
+}
+
+func TestZigPatterns(t *testing.T) {
+	checkDefinitions(t, Zig, []definitionCase{
+		{"pub fn main() !void {", "main", "function"},
+		{"fn parseInt(comptime T: type, buf: []const u8) !T {", "parseInt", "function"},
+		{"export fn add(a: i32, b: i32) i32 {", "add", "function"},
+		{"pub inline fn max(a: u32, b: u32) u32 {", "max", "function"},
+		{`extern "c" fn write(fd: c_int, buf: [*]const u8, n: usize) isize;`, "write", "function"},
+		{"    pub fn init(allocator: std.mem.Allocator) Self {", "init", "method"},
+		{"    fn deinit(self: *Self) void {", "deinit", "method"},
+		{"pub const Point = struct {", "Point", "type"},
+		{"const Header = extern struct {", "Header", "type"},
+		{"const Flags = packed struct(u8) {", "Flags", "type"},
+		{"pub const Color = enum {", "Color", "type"},
+		{"const Op = enum(u8) {", "Op", "type"},
+		{"pub const Value = union(enum) {", "Value", "type"},
+		{"const Raw = union {", "Raw", "type"},
+		{"pub const Error = error{ OutOfMemory, Overflow };", "Error", "type"},
+		{"    const Node = struct {", "Node", "type"},
+		{"const std = @import(\"std\");", "std", "const"},
+		{"pub const max_users: usize = 100;", "max_users", "const"},
+		{"var counter: u32 = 0;", "counter", "var"},
+		{"pub var verbose = false;", "verbose", "var"},
+		{"threadlocal var scratch: [64]u8 = undefined;", "scratch", "var"},
+		// Locals, fields, calls, and tests define nothing
+		{"    const p = Point{ .x = 1, .y = 2 };", "p", ""},
+		{"    var list = std.ArrayList(u8).init(allocator);", "list", ""},
+		{"    x: f32,", "x", ""},
+		{"    try parseInt(u8, buf);", "parseInt", ""},
+		{`test "parseInt" {`, "parseInt", ""},
+	})
+}
+
+func TestLuaPatterns(t *testing.T) {
+	checkDefinitions(t, Lua, []definitionCase{
+		{"function greet(name)", "greet", "function"},
+		{"local function trim(s)", "trim", "function"},
+		{"  local function helper()", "helper", "function"},
+		{"local validate = function(input)", "validate", "function"},
+		{"function Stack.new(items)", "new", "method"},
+		{"function Stack:push(item)", "push", "method"},
+		{"function M.util.split (s, sep)", "split", "method"},
+		{"function M.util:join(parts)", "join", "method"},
+		// Calls, tables, and other assignments define nothing
+		{"  stack:push(item)", "push", ""},
+		{"local s = Stack.new({})", "new", ""},
+		{"local Stack = {}", "Stack", ""},
+		{"local max = 10", "max", ""},
+		{"  local cb = function(x) return x end", "cb", ""},
+		{"M.greet = greet", "greet", ""},
+	})
+}
+
+func TestIsTestSource(t *testing.T) {
+	tests := []struct {
+		name string
+		lang Language
+		src  string
+		want bool
+	}{
+		{"zig test block", Zig, "pub fn add(a: i32, b: i32) i32 {\n    return a + b;\n}\n\ntest \"add\" {\n    try expect(add(1, 2) == 3);\n}\n", true},
+		{"zig without tests", Zig, "pub fn add(a: i32, b: i32) i32 {\n    return a + b;\n}\n", false},
+		{"zig test in a string", Zig, "const usage = \"run the tests\";\n", false},
+		{"go", Go, "test \"add\" {\n", false},
+		{"unknown", Unknown, "test \"add\" {\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTestSource([]byte(tt.src), tt.lang); got != tt.want {
+				t.Errorf("IsTestSource() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestGoConstPatterns(t *testing.T) {
 	tests := []struct {
 		name        string
 		line        string
 		wantName    string
+		block       string // The kind of block the line is in, as Blocks reports
 		shouldMatch bool
 	}{
 		// Should match
@@ -460,15 +1325,31 @@ func TestGoConstPatterns(t *testing.T) {
 		{
 			name:        "tab-indented const block member",
 			line:        "\tMaxConnections = 100",
+			block:       "const",
 			shouldMatch: true,
 			wantName:    "MaxConnections",
 		},
 		{
 			name:        "tab-indented const with type",
 			line:        "\tStatusOK Status = 200",
+			block:       "const",
 			shouldMatch: true,
 			wantName:    "StatusOK",
 		},
+		{
+			name:        "unexported const block member",
+			line:        "\tmaxValue = 100",
+			block:       "const",
+			shouldMatch: true,
+			wantName:    "maxValue",
+		},
+		{
+			name:        "iota continuation",
+			line:        "\tStatusDone",
+			block:       "const",
+			shouldMatch: true,
+			wantName:    "StatusDone",
+		},
 		// Should NOT match (false positives)
 		{
 			name:        "space-indented var (not const block)",
@@ -477,8 +1358,27 @@ func TestGoConstPatterns(t *testing.T) {
 			wantName:    "",
 		},
 		{
-			name:        "lowercase identifier",
-			line:        "\tmaxValue = 100",
+			name:        "struct field",
+			line:        "\tName string",
+			shouldMatch: false,
+			wantName:    "",
+		},
+		{
+			name:        "interface method",
+			line:        "\tGetByID(ctx context.Context, id int64) (*User, error)",
+			shouldMatch: false,
+			wantName:    "",
+		},
+		{
+			name:        "assignment in a function body",
+			line:        "\tMaxConnections = 100",
+			shouldMatch: false,
+			wantName:    "",
+		},
+		{
+			name:        "var block member",
+			line:        "\tMaxConnections = 100",
+			block:       "var",
 			shouldMatch: false,
 			wantName:    "",
 		},
@@ -495,7 +1395,7 @@ func TestGoConstPatterns(t *testing.T) {
 			var matchedName string
 
 			for _, p := range lp.Definition {
-				if p.Kind != "const" {
+				if p.Kind != "const" || p.Block != "" && p.Block != tt.block {
 					continue
 				}
 				if matches := p.Regex.FindStringSubmatch(tt.line); len(matches) > 1 {
@@ -515,3 +1415,267 @@ func TestGoConstPatterns(t *testing.T) {
 		})
 	}
 }
+
+func TestDefinitionPatternForFold(t *testing.T) {
+	tests := []struct {
+		name       string
+		symbol     string
+		lang       Language
+		testLine   string
+		shouldFind bool
+	}{
+		{"Go different casing", "httpclient", Go, "type HTTPClient struct {", true},
+		{"Go same casing", "httpclient", Go, "func httpclient() {", true},
+		{"Go keyword still exact", "httpclient", Go, "FUNC HttpClient() {", false},
+		{"Go word boundary kept", "user", Go, "type UserService struct {", false},
+		{"Python", "getuser", Python, "def GetUser(self):", true},
+		{"TypeScript", "userservice", TypeScript, "export class UserService {", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var found bool
+			for _, p := range DefinitionPatternForFold(tt.symbol, tt.lang) {
+				if p.MatchString(tt.testLine) {
+					found = true
+					break
+				}
+			}
+			if found != tt.shouldFind {
+				t.Errorf("pattern match = %v, want %v for line %q", found, tt.shouldFind, tt.testLine)
+			}
+		})
+	}
+}
+
+func TestSmartCase(t *testing.T) {
+	tests := []struct {
+		symbol string
+		want   bool
+	}{
+		{"httpclient", true},
+		{"get_user", true},
+		{"HTTPClient", false},
+		{"getUser", false},
+		{"_", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.symbol, func(t *testing.T) {
+			if got := SmartCase(tt.symbol); got != tt.want {
+				t.Errorf("SmartCase(%q) = %v, want %v", tt.symbol, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsWholeWord(t *testing.T) {
+	tests := []struct {
+		lang Language
+		line string
+		word string
+		want bool
+	}{
+		{Go, "x := OrderItem{}", "OrderItem", true},
+		{Go, "x := OrderItems{}", "OrderItem", false},
+		{Go, "x := NewOrderItem()", "OrderItem", false},
+		{Go, "x := OrderItemé", "OrderItem", false},
+		{Go, "x := $OrderItem", "OrderItem", true},
+		{JavaScript, "const x = $OrderItem;", "OrderItem", false},
+		{JavaScript, "const x = OrderItem$;", "OrderItem", false},
+		{JavaScript, "const x = $scope;", "$scope", true},
+		{TypeScript, "let o: OrderItem | null", "OrderItem", true},
+		{TypeScript, "o?.OrderItem!", "OrderItem", true},
+		{Rust, "let o = OrderItem!", "OrderItem", true},
+		{Python, "OrderItem", "OrderItem", true},
+		{Go, `get("v1/api/users")`, "/api/users", true},
+		{Go, `emit("order.created.v2")`, "order.created", true},
+		{Go, `emit("suborder.created")`, "order.created", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.lang)+" "+tt.line, func(t *testing.T) {
+			start := strings.LastIndex(tt.line, tt.word)
+			if got := IsWholeWord(tt.lang, tt.line, start, start+len(tt.word)); got != tt.want {
+				t.Errorf("IsWholeWord(%q, %q) = %v, want %v", tt.line, tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefinitionsForUnicode(t *testing.T) {
+	tests := []struct {
+		symbol string
+		line   string
+		want   string
+		lang   Language
+		fold   bool
+	}{
+		{symbol: "Größe", lang: Go, line: "func Größe() int {", want: "function"},
+		{symbol: "Fläche", lang: Go, line: "func (g *Größe) Fläche() int {", want: "method"},
+		{symbol: "Größe", lang: Go, line: "const Größe Maß = 3", want: "const"},
+		{symbol: "größe", lang: Go, line: "type GRÖSSE int", fold: true},
+		{symbol: "größe", lang: Go, line: "type Größe int", want: "type", fold: true},
+		{symbol: "café", lang: Python, line: "def café():", want: "function"},
+		{symbol: "café", lang: Python, line: "    def café(self):", want: "method"},
+		{symbol: "数量", lang: JavaScript, line: "const 数量 = (n) => n;", want: "function"},
+		{symbol: "数量", lang: JavaScript, line: "const 数量 = ñ => ñ;", want: "function"},
+		{symbol: "数量", lang: TypeScript, line: "export class 数量 {", want: "type"},
+	}
+	for _, tt := range tests {
+		kind, _ := DefinitionsFor(tt.symbol, tt.lang, tt.fold).Match(tt.line)
+		if kind != tt.want {
+			t.Errorf("DefinitionsFor(%q, %s).Match(%q) = %q, want %q", tt.symbol, tt.lang, tt.line, kind, tt.want)
+		}
+	}
+}
+
+// sampleLines returns the lines of the sample project's files in lang.
+func sampleLines(tb testing.TB, lang Language) []string {
+	tb.Helper()
+	dir := filepath.Join("..", "..", "testdata", "sample-project")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var lines []string
+	for _, e := range entries {
+		if DetectLanguage(filepath.Ext(e.Name())) != lang {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		lines = append(lines, strings.Split(string(data), "\n")...)
+	}
+	return lines
+}
+
+func TestDefinitionsFor(t *testing.T) {
+	tests := []struct {
+		symbol string
+		lang   Language
+		fold   bool
+	}{
+		{symbol: "User", lang: Go},
+		{symbol: "NewUser", lang: Go},
+		{symbol: "MaxUsers", lang: Go},
+		{symbol: "user", lang: Go, fold: true},
+		{symbol: "UserHandler", lang: TypeScript},
+		{symbol: "get_user", lang: Python},
+		{symbol: "User", lang: Rust},
+	}
+	for _, tt := range tests {
+		defs := DefinitionsFor(tt.symbol, tt.lang, tt.fold)
+		if len(defs.Patterns) < 2 || len(defs.Kinds) != len(defs.Patterns) {
+			t.Fatalf("DefinitionsFor(%q, %s) = %d patterns, %d kinds", tt.symbol, tt.lang, len(defs.Patterns), len(defs.Kinds))
+		}
+		// The kind is that of the first pattern to match in the line's
+		// block, leaving out those that need the lines after; without the
+		// block, that of the first of Patterns, which Combined joins
+		blocks := NewBlocks(tt.lang)
+		for _, line := range sampleLines(t, tt.lang) {
+			block := blocks.Next(line)
+			wantKind, want := "", false
+			for _, p := range defs.all {
+				if !p.standIn && (p.block == "" || p.block == block) && !p.wrapped && p.re.MatchString(line) {
+					wantKind, want = p.kind, true
+					break
+				}
+			}
+			if kind, ok := defs.MatchIn(line, block, nil); ok != want || kind != wantKind {
+				t.Errorf("DefinitionsFor(%q, %s).MatchIn(%q, %q) = %q, %v, want %q, %v", tt.symbol, tt.lang, line, block, kind, ok, wantKind, want)
+			}
+			wantKind, want = "", false
+			for i, re := range defs.Patterns {
+				if !defs.Wrapped[i] && re.MatchString(line) {
+					wantKind, want = defs.Kinds[i], true
+					break
+				}
+			}
+			if kind, ok := defs.Match(line); ok != want || kind != wantKind {
+				t.Errorf("DefinitionsFor(%q, %s).Match(%q) = %q, %v, want %q, %v", tt.symbol, tt.lang, line, kind, ok, wantKind, want)
+			}
+		}
+	}
+
+	defs := DefinitionsFor("MaxUsers", Go, false)
+	for line, want := range map[string]string{
+		"func MaxUsers() int {":          "function",
+		"func (s *Store) MaxUsers() {":   "method",
+		"type MaxUsers int":              "type",
+		"const MaxUsers = 10":            "const",
+		"var MaxUsers = 10":              "var",
+		"\treturn MaxUsers":              "",
+		"// MaxUsers caps the user list": "",
+	} {
+		if kind, _ := defs.Match(line); kind != want {
+			t.Errorf("Match(%q) kind = %q, want %q", line, kind, want)
+		}
+	}
+
+	if defs := DefinitionsFor("x", Language("cobol"), false); defs.Combined != nil {
+		t.Errorf("DefinitionsFor() for an unknown language = %v, want no patterns", defs.Combined)
+	}
+}
+
+// TestDefinitions_StructField checks that the patterns a line-oriented
+// search uses, which don't know a line's block, don't take a struct field,
+// an interface method, or a literal's key for a block member, but do find
+// a member assigned a value.
+func TestDefinitions_StructField(t *testing.T) {
+	defs := DefinitionsFor("Timeout", Go, false)
+	for line, want := range map[string]string{
+		"\tTimeout int": "",
+		"\tTimeout time.Duration `json:\"timeout=30\"`": "",
+		"\tTimeout struct {":                            "",
+		"\tTimeout(ctx context.Context) error":          "",
+		"\tTimeout: 30,":                                "",
+		"\tTimeout *= 2":                                "",
+		"\tTimeout = 30":                                "const",
+		"\tTimeout time.Duration = 30 * time.Second":    "const",
+		"\tTimeout, Retries = 30, 3":                    "const",
+	} {
+		if kind, _ := defs.Match(line); kind != want {
+			t.Errorf("Match(%q) kind = %q, want %q", line, kind, want)
+		}
+		if got := defs.Combined.MatchString(line); got != (want != "") {
+			t.Errorf("Combined.MatchString(%q) = %v, want %v", line, got, want != "")
+		}
+	}
+	// The block still tells a member that only repeats the one before it
+	if kind, _ := defs.MatchIn("\tTimeout", "const", nil); kind != "const" {
+		t.Errorf("MatchIn(%q, const) kind = %q, want const", "\tTimeout", kind)
+	}
+}
+
+// BenchmarkDefinitions compares finding a Go symbol's definitions with a
+// pass over the lines per pattern against one pass with the combined
+// pattern, which costs the same however many kinds there are. Both skip
+// lines without the symbol, as Match does.
+func BenchmarkDefinitions(b *testing.B) {
+	var lines []string
+	for range 50 {
+		lines = append(lines, sampleLines(b, Go)...)
+	}
+	defs := DefinitionsFor("User", Go, false)
+	b.Run("pass-per-pattern", func(b *testing.B) {
+		for b.Loop() {
+			for _, re := range defs.Patterns {
+				for _, line := range lines {
+					if strings.Contains(line, "User") {
+						re.MatchString(line)
+					}
+				}
+			}
+		}
+	})
+	b.Run("combined", func(b *testing.B) {
+		for b.Loop() {
+			for _, line := range lines {
+				defs.Match(line)
+			}
+		}
+	})
+}
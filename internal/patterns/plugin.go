@@ -0,0 +1,88 @@
+package patterns
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DefinitionKinds are the kinds a plugin language's definition patterns can
+// report, the same vocabulary as the built-in languages'.
+var DefinitionKinds = []string{"function", "method", "type", "interface", "const", "var"}
+
+// Plugin languages are declared in files rather than code; see SetPlugins.
+var (
+	plugins     map[Language]*LanguagePatterns
+	pluginExts  map[string]Language // Lowercase extension to plugin language
+	pluginNames map[string]Language // File name to plugin language
+)
+
+// SetPlugins replaces the plugin languages, which join the built-in ones.
+// A plugin with a built-in language's name replaces it, and one claiming a
+// built-in language's extension takes it over; later plugins win over
+// earlier ones. Their definition patterns are used as given, each regex
+// with exactly one capture group around the name, so they're marked Custom.
+// SetPlugins(nil) leaves only the built-in languages.
+func SetPlugins(langs []*LanguagePatterns) {
+	plugins, pluginExts, pluginNames = nil, nil, nil
+	for _, lp := range langs {
+		if plugins == nil {
+			plugins = make(map[Language]*LanguagePatterns)
+			pluginExts = make(map[string]Language)
+			pluginNames = make(map[string]Language)
+		}
+		plugin := *lp
+		plugin.Definition = make([]Pattern, len(lp.Definition))
+		for i, p := range lp.Definition {
+			p.Custom = true
+			plugin.Definition[i] = p
+		}
+		plugins[lp.Language] = &plugin
+		for _, ext := range lp.Extensions {
+			pluginExts[strings.ToLower(ext)] = lp.Language
+		}
+		for _, name := range lp.Filenames {
+			pluginNames[name] = lp.Language
+		}
+	}
+	rebuild()
+}
+
+// Plugins returns the plugin languages SetPlugins registered, sorted by
+// name.
+func Plugins() []*LanguagePatterns {
+	langs := make([]*LanguagePatterns, 0, len(plugins))
+	for _, lp := range plugins {
+		langs = append(langs, lp)
+	}
+	slices.SortFunc(langs, func(a, b *LanguagePatterns) int {
+		return strings.Compare(string(a.Language), string(b.Language))
+	})
+	return langs
+}
+
+// declared returns lang's patterns before custom patterns and extension
+// overrides apply: a plugin's, or else the built-in ones.
+func declared(lang Language) *LanguagePatterns {
+	if p, ok := plugins[lang]; ok {
+		return p
+	}
+	return registry[lang]
+}
+
+// DetectFile determines the language of the file at path from its name,
+// for the file names plugin languages declare, such as Makefile, and
+// otherwise from its extension, as DetectLanguage does.
+func DetectFile(path string) Language {
+	if lang, ok := pluginNames[filepath.Base(path)]; ok {
+		return lang
+	}
+	return DetectLanguage(filepath.Ext(path))
+}
+
+// IsBuiltin reports whether lang is one of the languages cdx builds in,
+// whether or not a plugin replaces it.
+func IsBuiltin(lang Language) bool {
+	_, ok := registry[lang]
+	return ok
+}
@@ -0,0 +1,93 @@
+package patterns
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestSetPlugins(t *testing.T) {
+	t.Cleanup(func() { SetPlugins(nil) })
+	vhdl := &LanguagePatterns{
+		Language:   "vhdl",
+		Extensions: []string{".vhd", ".vhdl"},
+		Filenames:  []string{"Vhdlfile"},
+		TestFile:   regexp.MustCompile(`_tb\.vhdl?$`),
+		Definition: []Pattern{
+			{Regex: regexp.MustCompile(`(?i)^\s*entity\s+(\w+)\s+is\b`), Kind: "type"},
+			{Regex: regexp.MustCompile(`(?i)^\s*function\s+(\w+)`), Kind: "function"},
+		},
+	}
+	py := &LanguagePatterns{
+		Language:   Python,
+		Extensions: []string{".py", ".pyw"},
+		Definition: []Pattern{{Regex: regexp.MustCompile(`^def\s+(\w+)`), Kind: "function"}},
+	}
+	SetPlugins([]*LanguagePatterns{vhdl, py})
+
+	tests := map[string]Language{
+		"rtl/alu.vhd":   "vhdl",
+		"rtl/ALU.VHDL":  "vhdl",
+		"rtl/Vhdlfile":  "vhdl",
+		"app/main.pyw":  Python,
+		"app/main.py":   Python,
+		"cmd/main.go":   Go,
+		"docs/Makefile": Unknown,
+	}
+	for path, want := range tests {
+		if got := DetectFile(path); got != want {
+			t.Errorf("DetectFile(%q) = %q, want %q", path, got, want)
+		}
+	}
+
+	if !slices.Contains(AllLanguages(), "vhdl") {
+		t.Errorf("AllLanguages() = %v, want vhdl among them", AllLanguages())
+	}
+	if got := ForLanguage(Python); len(got.Definition) != 1 || !got.Definition[0].Custom {
+		t.Errorf("ForLanguage(py).Definition = %+v, want the plugin's one custom pattern", got.Definition)
+	}
+	if !IsTestFile("rtl/alu_tb.vhd", "vhdl") || IsTestFile("rtl/alu.vhd", "vhdl") {
+		t.Error("IsTestFile doesn't follow the plugin's test_file")
+	}
+	defs := DefinitionPatternFor("alu", "vhdl")
+	if len(defs) != 2 || !defs[0].MatchString("entity alu is") || defs[0].MatchString("entity alu2 is") {
+		t.Errorf("DefinitionPatternFor(alu, vhdl) = %v, want the entity pattern for alu", defs)
+	}
+	if got := Plugins(); len(got) != 2 || got[0].Language != Python || got[1].Language != "vhdl" {
+		t.Errorf("Plugins() = %v, want py and vhdl", got)
+	}
+	if vhdl.Definition[0].Custom {
+		t.Error("SetPlugins modified the patterns it was given")
+	}
+
+	SetPlugins(nil)
+	if ForLanguage("vhdl") != nil || DetectFile("alu.vhd") != Unknown {
+		t.Error("after SetPlugins(nil): vhdl is still registered")
+	}
+	if ForLanguage(Python) != registry[Python] {
+		t.Error("after SetPlugins(nil): py isn't the built-in language")
+	}
+}
+
+func TestSetPlugins_Custom(t *testing.T) {
+	t.Cleanup(func() {
+		SetPlugins(nil)
+		SetCustom(nil)
+		SetExtensions(nil)
+	})
+	SetPlugins([]*LanguagePatterns{{
+		Language:   "ada",
+		Extensions: []string{".adb"},
+		Definition: []Pattern{{Regex: regexp.MustCompile(`^procedure\s+(\w+)`), Kind: "function"}},
+	}})
+	SetExtensions(map[string]Language{".ads": "ada"})
+	SetCustom(map[Language][]Pattern{"ada": {{Regex: regexp.MustCompile(`^task\s+(\w+)`), Kind: "task"}}})
+
+	lp := ForLanguage("ada")
+	if !slices.Equal(lp.Extensions, []string{".adb", ".ads"}) || len(lp.Definition) != 2 {
+		t.Errorf("ForLanguage(ada) = %+v, want .ads mapped and the custom pattern added", lp)
+	}
+	if got := DetectLanguage(".ads"); got != "ada" {
+		t.Errorf("DetectLanguage(.ads) = %q, want ada", got)
+	}
+}
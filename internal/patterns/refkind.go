@@ -0,0 +1,69 @@
+package patterns
+
+import "regexp"
+
+// RefKind classifies a reference by how the code around it uses the symbol.
+type RefKind string
+
+// Reference kinds.
+const (
+	RefCall      RefKind = "call"      // Called: Symbol(
+	RefConstruct RefKind = "construct" // Instantiated: Symbol{ in Go and Rust, new Symbol( in TS and JS
+	RefType      RefKind = "type"      // In a type position: *Symbol, []Symbol, : Symbol
+	RefImport    RefKind = "import"    // On an import line
+	RefOther     RefKind = "other"     // Anything else, such as a value passed around
+	// RefDefinition marks the definition site itself, which refs lists
+	// apart from the references.
+	RefDefinition RefKind = "definition"
+)
+
+// RefKinds lists the kinds a reference can be classified as.
+var RefKinds = []RefKind{RefCall, RefConstruct, RefType, RefImport, RefOther}
+
+// RefRule classifies a reference whose surroundings match. Before is matched
+// against the line up to the symbol, with any package or module qualifier
+// such as "models." or "crate::models::" removed, and After against the rest
+// of the line; a nil regex matches anything.
+type RefRule struct {
+	Before *regexp.Regexp
+	After  *regexp.Regexp
+	Kind   RefKind
+}
+
+// qualifier matches the package, module, or receiver path just before a
+// symbol, as in models.User or crate::models::User.
+var qualifier = regexp.MustCompile(`(?:[\p{L}_$][\p{L}\p{Nd}_$]*(?:\.|::))+$`)
+
+// ClassifyRef returns the kind of the reference to the symbol at
+// line[start:end], from the first of lang's reference rules to match.
+// Languages without rules, and references no rule matches, are RefOther.
+func ClassifyRef(lang Language, line string, start, end int) RefKind {
+	lp := ForLanguage(lang)
+	if lp == nil {
+		return RefOther
+	}
+	before := line[:start]
+	if loc := qualifier.FindStringIndex(before); loc != nil {
+		before = before[:loc[0]]
+	}
+	after := line[end:]
+	for _, r := range lp.References {
+		if (r.Before == nil || r.Before.MatchString(before)) && (r.After == nil || r.After.MatchString(after)) {
+			return r.Kind
+		}
+	}
+	return RefOther
+}
+
+// refRule builds a RefRule from before and after expressions; "" matches
+// anything.
+func refRule(kind RefKind, before, after string) RefRule {
+	r := RefRule{Kind: kind}
+	if before != "" {
+		r.Before = regexp.MustCompile(before)
+	}
+	if after != "" {
+		r.After = regexp.MustCompile(after)
+	}
+	return r
+}
@@ -0,0 +1,96 @@
+package patterns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClassifyRef(t *testing.T) {
+	tests := []struct {
+		lang Language
+		line string
+		want RefKind
+	}{
+		{Go, `import user "example.com/app/User"`, RefImport},
+		{Go, `	u := User{Name: "x"}`, RefConstruct},
+		{Go, `	u := &models.User{}`, RefConstruct},
+		{Go, `	users := []User{}`, RefConstruct},
+		{Go, `	u := NewUser("x")`, RefCall},
+		{Go, `	u := User("x")`, RefCall},
+		{Go, `	u.Save(ctx)`, RefCall},
+		{Go, `func (u *User) Name() string {`, RefType},
+		{Go, `func load(id int, u User) error {`, RefType},
+		{Go, `func load() User {`, RefType},
+		{Go, `var cache map[string]User`, RefType},
+		{Go, `	var u User`, RefType},
+		{Go, `	u, ok := v.(User)`, RefType},
+		{Go, `	ch := make(chan User)`, RefType},
+		{Go, `	return User`, RefOther},
+
+		{TypeScript, `import { User } from "./user";`, RefImport},
+		{TypeScript, `export { User } from "./user";`, RefImport},
+		{TypeScript, `const u = new User("x");`, RefConstruct},
+		{TypeScript, `const u = new models.User();`, RefConstruct},
+		{TypeScript, `const u = User("x");`, RefCall},
+		{TypeScript, `const u = parse<T>User<T>("x");`, RefCall},
+		{TypeScript, `function save(u: User): void {`, RefType},
+		{TypeScript, `class Admin extends User {`, RefType},
+		{TypeScript, `const u = x as User;`, RefType},
+		{TypeScript, `const all: Array<User> = [];`, RefType},
+		{TypeScript, `register(User);`, RefOther},
+
+		{JavaScript, `const { User } = require(`, RefOther},
+		{JavaScript, `const u = new User();`, RefConstruct},
+		{JavaScript, `if (x instanceof User) {`, RefType},
+
+		{Python, `from app.models import User`, RefImport},
+		{Python, `    u = User("x")`, RefCall},
+		{Python, `def save(u: User) -> None:`, RefType},
+		{Python, `def load() -> User:`, RefType},
+		{Python, `class Admin(Base, User):`, RefType},
+		{Python, `except UserError:`, RefType},
+		{Python, `    users.append(user)`, RefOther},
+
+		{Rust, `use crate::models::User;`, RefImport},
+		{Rust, `pub(crate) use models::User;`, RefImport},
+		{Rust, `    let u = User { name };`, RefConstruct},
+		{Rust, `    let u = User::new("x");`, RefType},
+		{Rust, `impl Display for User {`, RefType},
+		{Rust, `fn load() -> User {`, RefType},
+		{Rust, `fn save(u: &User) {`, RefType},
+		{Rust, `    let all: Vec<User> = vec![];`, RefType},
+		{Rust, `    make_user!("x");`, RefCall},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.lang)+" "+tt.line, func(t *testing.T) {
+			symbol := "User"
+			switch {
+			case strings.Contains(tt.line, "UserError"):
+				symbol = "UserError"
+			case strings.Contains(tt.line, "NewUser"):
+				symbol = "NewUser"
+			case strings.Contains(tt.line, ".Save"):
+				symbol = "Save"
+			case strings.Contains(tt.line, "make_user"):
+				symbol = "make_user"
+			case strings.Contains(tt.line, "(user)"):
+				symbol = "user"
+			}
+			start := strings.LastIndex(tt.line, symbol)
+			if tt.lang == Go && strings.HasPrefix(tt.line, "import") {
+				start = strings.Index(tt.line, "user")
+				symbol = "user"
+			}
+			if got := ClassifyRef(tt.lang, tt.line, start, start+len(symbol)); got != tt.want {
+				t.Errorf("ClassifyRef(%q at %d) = %q, want %q", tt.line, start, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyRef_UnknownLanguage(t *testing.T) {
+	if got := ClassifyRef(Unknown, "User(x)", 0, 4); got != RefOther {
+		t.Errorf("ClassifyRef() = %q, want %q", got, RefOther)
+	}
+}
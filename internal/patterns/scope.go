@@ -0,0 +1,76 @@
+package patterns
+
+import (
+	"regexp"
+	"strings"
+)
+
+// TabWidth is the width a tab indents to the next multiple of when
+// IndentWidth measures indentation, as Python's tokenizer counts it.
+const TabWidth = 8
+
+// pyScope matches a Python def or class line at any indentation; group 1 is
+// the keyword and group 2 the name.
+var pyScope = regexp.MustCompile(`^\s*(?:async\s+)?(def|class)\s+([\p{L}_][\p{L}\p{Nd}_]*)`)
+
+// IndentWidth returns the width of line's indentation in columns: a space
+// counts one, and a tab moves on to the next multiple of TabWidth. Python
+// reads mixed tabs and spaces the same way, so "\t" and eight spaces are the
+// same depth, and "  \t" is too; a file that only works with some other tab
+// width is rejected by Python 3 anyway.
+func IndentWidth(line string) int {
+	width := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			width++
+		case '\t':
+			width += TabWidth - width%TabWidth
+		default:
+			return width
+		}
+	}
+	return width
+}
+
+// Scope returns the names of the definitions enclosing line n, 1-based, of
+// lines, outermost first, such as ["Outer", "method"] for a function inner
+// defined in the method, and whether the innermost of them is a function
+// rather than a class, which makes the definition on line n a nested
+// function rather than a method or a top-level one. A definition encloses
+// the lines below it that are indented more, as IndentWidth measures, up
+// to the first that isn't; blank and comment lines don't count. Only
+// Python's blocks are delimited by indentation, so other languages have no
+// scopes here.
+func Scope(lang Language, lines []string, n int) (chain []string, nested bool) {
+	if lang != Python || n < 1 || n > len(lines) {
+		return nil, false
+	}
+	depth := IndentWidth(lines[n-1])
+	innermost := true
+	for i := n - 1; i >= 1 && depth > 0; i-- {
+		line := lines[i-1]
+		if strings.TrimSpace(line) == "" || isCommentLine(lang, line) {
+			continue
+		}
+		width := IndentWidth(line)
+		if width >= depth {
+			continue
+		}
+		depth = width
+		// Lines such as if and with are indented less without being
+		// definitions; what they're in is still in scope
+		m := pyScope.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if innermost {
+			nested, innermost = m[1] == "def", false
+		}
+		chain = append(chain, m[2])
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nested
+}
@@ -0,0 +1,86 @@
+package patterns
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIndentWidth(t *testing.T) {
+	tests := []struct {
+		line string
+		want int
+	}{
+		{"def f():", 0},
+		{"    return 1", 4},
+		{"\treturn 1", 8},
+		{"  \treturn 1", 8},
+		{"\t  return 1", 10},
+		{"        \treturn 1", 16},
+		{"   ", 3},
+	}
+	for _, tt := range tests {
+		if got := IndentWidth(tt.line); got != tt.want {
+			t.Errorf("IndentWidth(%q) = %d, want %d", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestScope(t *testing.T) {
+	src := strings.Join([]string{
+		"def outer():",             // 1
+		"    x = 1",                // 2
+		"    def inner():",         // 3
+		"        # comment",        // 4
+		"",                         // 5
+		"        def innermost():", // 6
+		"            pass",         // 7
+		"    if x:",                // 8
+		"        def branch():",    // 9
+		"            pass",         // 10
+		"class Cart:",              // 11
+		"    def total(self):",     // 12
+		"        def add(a, b):",   // 13
+		"            pass",         // 14
+		"    class Item:",          // 15
+		"        def price(self):", // 16
+		"            pass",         // 17
+		"def tabbed():",            // 18
+		"        x = 1",            // 19
+		"\tdef helper():",          // 20
+		"\t\tpass",                 // 21
+		"def top():",               // 22
+	}, "\n")
+	lines := strings.Split(src, "\n")
+
+	tests := []struct {
+		name   string
+		chain  []string
+		line   int
+		nested bool
+	}{
+		{name: "top level", line: 1},
+		{name: "closure", line: 3, chain: []string{"outer"}, nested: true},
+		{name: "closure in a closure", line: 6, chain: []string{"outer", "inner"}, nested: true},
+		{name: "inside an if", line: 9, chain: []string{"outer"}, nested: true},
+		{name: "method", line: 12, chain: []string{"Cart"}},
+		{name: "function in a method", line: 13, chain: []string{"Cart", "total"}, nested: true},
+		{name: "method of a nested class", line: 16, chain: []string{"Cart", "Item"}},
+		// A tab is eight columns, as deep as the body's eight spaces, so
+		// the def is in tabbed, not after it
+		{name: "tab after spaces", line: 20, chain: []string{"tabbed"}, nested: true},
+		{name: "after the nesting ends", line: 22},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, nested := Scope(Python, lines, tt.line)
+			if !reflect.DeepEqual(chain, tt.chain) || nested != tt.nested {
+				t.Errorf("Scope(line %d) = %q, %v, want %q, %v", tt.line, chain, nested, tt.chain, tt.nested)
+			}
+		})
+	}
+
+	if chain, nested := Scope(Go, []string{"func f() {", "\tfunc() {}", "}"}, 2); chain != nil || nested {
+		t.Errorf("Scope() for Go = %q, %v, want none", chain, nested)
+	}
+}
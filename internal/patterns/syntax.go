@@ -0,0 +1,247 @@
+package patterns
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// Syntax describes a language's comments and string literals, which is all
+// Lexer needs to tell code from prose.
+type Syntax struct {
+	LineComment  []string    // Comment to end of line, e.g. "//"
+	BlockComment [][2]string // Open and close delimiters, e.g. {"/*", "*/"}
+	Strings      []string    // Delimiters of strings that end on the same line
+	LongStrings  []string    // Delimiters of strings that may span lines, e.g. "`"
+	// RawStrings are LongStrings without backslash escapes, like Go's
+	// `C:\dir\`
+	RawStrings []string
+}
+
+// Context classifies a position in a source line.
+type Context uint8
+
+const (
+	Code Context = iota
+	Comment
+	String
+)
+
+// span is a run of non-code bytes in a line.
+type span struct {
+	start, end int
+	ctx        Context
+}
+
+// LineContext classifies the positions of one line, as returned by
+// Lexer.Line.
+type LineContext struct {
+	spans []span
+	// unsure is set when the line's quoting doesn't balance, in which case
+	// every position is reported as code
+	unsure bool
+}
+
+// At returns the context of the byte at offset.
+func (c LineContext) At(offset int) Context {
+	_, _, ctx := c.Span(offset)
+	return ctx
+}
+
+// Span returns the comment or string literal containing the byte at offset,
+// delimiters included, as line[start:end]. A construct continuing from or
+// onto another line is cut off at the line's edge. For code, Span returns
+// ctx Code and empty bounds.
+func (c LineContext) Span(offset int) (start, end int, ctx Context) {
+	if c.unsure {
+		return 0, 0, Code
+	}
+	for _, s := range c.spans {
+		if offset >= s.start && offset < s.end {
+			return s.start, s.end, s.ctx
+		}
+	}
+	return 0, 0, Code
+}
+
+// Lexer heuristically tracks comments and strings through a file, one line at
+// a time. It only looks for delimiters, so it can be fooled, and it resolves
+// doubt toward code: a line whose string quotes don't balance is classified
+// entirely as code rather than risk hiding a real match.
+type Lexer struct {
+	syntax *Syntax
+	close  string // Delimiter ending a construct carried over from a previous line
+	// starts holds the first byte of every delimiter, so that the bytes
+	// between them can be skipped; empty when one isn't ASCII
+	starts string
+	// scratch holds the spans of the last line NextLine classified, whose
+	// memory the next call reuses
+	scratch []span
+	carry   Context // What the carried construct is
+	raw     bool    // The carried construct is a raw string, without escapes
+}
+
+// NewLexer returns a lexer for lang. Languages without syntax information
+// classify everything as code.
+func NewLexer(lang Language) *Lexer {
+	l := &Lexer{}
+	if lp := ForLanguage(lang); lp != nil && lp.Syntax != nil {
+		l.syntax = lp.Syntax
+		var starts []byte
+		ascii := true
+		add := func(delims ...string) {
+			for _, d := range delims {
+				switch {
+				case d == "":
+				case d[0] >= utf8.RuneSelf:
+					ascii = false
+				case !bytes.Contains(starts, []byte{d[0]}):
+					starts = append(starts, d[0])
+				}
+			}
+		}
+		add(l.syntax.LineComment...)
+		for _, bc := range l.syntax.BlockComment {
+			add(bc[0])
+		}
+		add(l.syntax.RawStrings...)
+		add(l.syntax.LongStrings...)
+		add(l.syntax.Strings...)
+		if ascii {
+			l.starts = string(starts)
+		}
+	}
+	return l
+}
+
+// Line classifies the next line of the file. Lines must be passed in order,
+// without their line terminators.
+func (l *Lexer) Line(line string) LineContext {
+	return l.classify(line, nil)
+}
+
+// NextLine is like Line, but the LineContext it returns is only valid until
+// the next call, which reuses its memory, so that classifying a file line by
+// line doesn't allocate for each line.
+func (l *Lexer) NextLine(line string) LineContext {
+	c := l.classify(line, l.scratch[:0])
+	l.scratch = c.spans
+	return c
+}
+
+// classify implements Line, appending the line's spans to spans.
+func (l *Lexer) classify(line string, spans []span) LineContext {
+	c := LineContext{spans: spans}
+	if l.syntax == nil {
+		return c
+	}
+
+	i := 0
+	if l.close != "" {
+		end := closeIndex(line, 0, l.close, l.carry == String && !l.raw)
+		if end < 0 {
+			c.spans = append(c.spans, span{0, len(line), l.carry})
+			return c
+		}
+		c.spans = append(c.spans, span{0, end, l.carry})
+		i = end
+		l.close = ""
+	}
+
+	for i < len(line) {
+		if l.starts != "" {
+			skip := strings.IndexAny(line[i:], l.starts)
+			if skip < 0 {
+				break
+			}
+			i += skip
+		}
+		rest := line[i:]
+		// A block comment comes first, as Lua's --[[ starts with its line
+		// comment's --
+		if open, close := l.blockComment(rest); open != "" {
+			if i = l.region(&c, line, i, open, close, Comment, false); i < 0 {
+				break
+			}
+			continue
+		}
+		if hasAnyPrefix(rest, l.syntax.LineComment) != "" {
+			c.spans = append(c.spans, span{i, len(line), Comment})
+			break
+		}
+		if d := hasAnyPrefix(rest, l.syntax.RawStrings); d != "" {
+			if i = l.region(&c, line, i, d, d, String, false); i < 0 {
+				break
+			}
+			continue
+		}
+		if d := hasAnyPrefix(rest, l.syntax.LongStrings); d != "" {
+			if i = l.region(&c, line, i, d, d, String, true); i < 0 {
+				break
+			}
+			continue
+		}
+		if d := hasAnyPrefix(rest, l.syntax.Strings); d != "" {
+			end := closeIndex(line, i+len(d), d, true)
+			if end < 0 {
+				c.unsure = true
+				break
+			}
+			c.spans = append(c.spans, span{i, end, String})
+			i = end
+			continue
+		}
+		i++
+	}
+	return c
+}
+
+// region records a comment or string opened at i by open, in which a
+// backslash escapes the next byte if escapes is set. It returns the offset
+// just past the closing delimiter, or -1 when the construct continues onto
+// the next line.
+func (l *Lexer) region(c *LineContext, line string, i int, open, close string, ctx Context, escapes bool) int {
+	end := closeIndex(line, i+len(open), close, escapes)
+	if end < 0 {
+		c.spans = append(c.spans, span{i, len(line), ctx})
+		l.close, l.carry, l.raw = close, ctx, ctx == String && !escapes
+		return -1
+	}
+	c.spans = append(c.spans, span{i, end, ctx})
+	return end
+}
+
+func (l *Lexer) blockComment(s string) (string, string) {
+	for _, bc := range l.syntax.BlockComment {
+		if strings.HasPrefix(s, bc[0]) {
+			return bc[0], bc[1]
+		}
+	}
+	return "", ""
+}
+
+// closeIndex returns the offset just past the first close delimiter at or
+// after from, skipping backslash escapes when escapes is set, or -1 if the
+// line doesn't contain one.
+func closeIndex(line string, from int, close string, escapes bool) int {
+	for j := from; j < len(line); j++ {
+		if escapes && line[j] == '\\' {
+			j++
+			continue
+		}
+		if strings.HasPrefix(line[j:], close) {
+			return j + len(close)
+		}
+	}
+	return -1
+}
+
+// hasAnyPrefix returns the first of prefixes that s starts with, or "".
+func hasAnyPrefix(s string, prefixes []string) string {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return p
+		}
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package patterns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLexer(t *testing.T) {
+	tests := []struct {
+		name string
+		lang Language
+		// Lines are scanned in order; the position checked is the first
+		// "Max" on the last line
+		lines []string
+		want  Context
+	}{
+		{"code", Go, []string{"n := MaxUsers"}, Code},
+		{"line comment", Go, []string{"// MaxUsers caps sign-ups"}, Comment},
+		{"trailing comment", Go, []string{"n := 1 // not MaxUsers"}, Comment},
+		{"string", Go, []string{`log.Print("MaxUsers reached")`}, String},
+		{"code after string", Go, []string{`log.Print("limit", MaxUsers)`}, Code},
+		{"escaped quote", Go, []string{`s := "say \"hi\" to MaxUsers"`}, String},
+		{"comment marker in string", Go, []string{`s := "http://x"; n := MaxUsers`}, Code},
+		{"block comment", Go, []string{"/*", " * MaxUsers caps sign-ups"}, Comment},
+		{"after block comment", Go, []string{"/* x", "*/ n := MaxUsers"}, Code},
+		{"inline block comment", TypeScript, []string{"f(/* MaxUsers */ 1)"}, Comment},
+		{"raw string", Go, []string{"s := `", "MaxUsers"}, String},
+		{"raw string ends at a backslash", Go, []string{"s := `C:\\`; n := MaxUsers"}, Code},
+		{"raw string spanning lines ends at a backslash", Go, []string{"s := `a", "b\\`; n := MaxUsers"}, Code},
+		{"struct tag", Go, []string{"ID int `json:\"MaxUsers\"`"}, String},
+		{"template literal keeps escapes", JavaScript, []string{"const s = `\\`MaxUsers`"}, String},
+		{"template literal", JavaScript, []string{"const s = `${MaxUsers}`"}, String},
+		{"python comment", Python, []string{"x = 1  # MaxUsers"}, Comment},
+		{"python docstring", Python, []string{`"""Limits.`, "", "MaxUsers caps sign-ups."}, String},
+		{"python after docstring", Python, []string{`"""Limits."""`, "n = MaxUsers"}, Code},
+		{"lua comment", Lua, []string{"local n = 1 -- MaxUsers"}, Comment},
+		{"lua block comment", Lua, []string{"--[[ Limits.", "MaxUsers caps sign-ups."}, Comment},
+		{"lua after block comment", Lua, []string{"--[[ Limits.", "]] local n = MaxUsers"}, Code},
+		{"rust lifetime", Rust, []string{"fn f<'a>(x: &'a str) -> usize { MaxUsers }"}, Code},
+		{"unbalanced quotes fail open", Go, []string{`s := "MaxUsers`}, Code},
+		{"unknown language", Unknown, []string{"// MaxUsers"}, Code},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lx := NewLexer(tt.lang)
+			var c LineContext
+			for _, line := range tt.lines {
+				c = lx.Line(line)
+			}
+			last := tt.lines[len(tt.lines)-1]
+			offset := strings.Index(last, "Max")
+			if got := c.At(offset); got != tt.want {
+				t.Errorf("At(%d) in %q = %v, want %v", offset, last, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineContextSpan(t *testing.T) {
+	tests := []struct {
+		name string
+		lang Language
+		line string
+		want string // The literal containing the first "Max", or "" for code
+		ctx  Context
+	}{
+		{"string", Go, `log.Print("MaxUsers reached", n)`, `"MaxUsers reached"`, String},
+		{"escaped quotes", Go, `s := "say \"MaxUsers\""`, `"say \"MaxUsers\""`, String},
+		{"struct tag", Go, "ID int `json:\"MaxUsers,omitempty\"`", "`json:\"MaxUsers,omitempty\"`", String},
+		{"comment", Go, "n := 1 // MaxUsers", "// MaxUsers", Comment},
+		{"code", Go, "n := MaxUsers", "", Code},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewLexer(tt.lang).Line(tt.line)
+			start, end, ctx := c.Span(strings.Index(tt.line, "Max"))
+			if got := tt.line[start:end]; got != tt.want || ctx != tt.ctx {
+				t.Errorf("Span() = %q, %v, want %q, %v", got, ctx, tt.want, tt.ctx)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package patterns
+
+import "bytes"
+
+// MaxWrappedLines is how many lines past the first a wrapped definition's
+// parameter list may run on for Unwraps to find its end.
+const MaxWrappedLines = 10
+
+// Unwraps reports whether a definition that a Wrapped pattern matched,
+// through the opening parenthesis of its parameters, is one: the parameter
+// list closes within MaxWrappedLines more lines, and the rest of the line it
+// closes on matches WrappedEnd. open is the text of the first line following
+// the parenthesis, and rest the source after that line. This tells
+//
+//	export const createOrder = async (
+//	  userId: string,
+//	): Promise<Order> => {
+//
+// from a parenthesized expression such as const pair = (a, b);.
+func (lp *LanguagePatterns) Unwraps(open string, rest []byte) bool {
+	if lp.WrappedEnd == nil {
+		return false
+	}
+	depth := 1
+	// The parenthesis's own line is rarely all there is, so copying its
+	// rest is cheap
+	line := []byte(open)
+	for n := 0; ; n++ {
+		for i, c := range line {
+			switch c {
+			case '(':
+				depth++
+			case ')':
+				if depth--; depth == 0 {
+					return lp.WrappedEnd.Match(line[i+1:])
+				}
+			}
+		}
+		if n == MaxWrappedLines || len(rest) == 0 {
+			return false
+		}
+		line, rest, _ = bytes.Cut(rest, []byte("\n"))
+	}
+}
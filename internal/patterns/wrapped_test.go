@@ -0,0 +1,56 @@
+package patterns
+
+import "testing"
+
+func TestDefinitionsWrapped(t *testing.T) {
+	tests := []struct {
+		symbol string
+		line   string
+		rest   string
+		want   string
+		lang   Language
+	}{
+		{
+			symbol: "createOrder",
+			line:   "export const createOrder = async (",
+			rest:   "  userId: string,\n): Promise<Order> => {\n",
+			want:   "function",
+			lang:   TypeScript,
+		},
+		{symbol: "pair", line: "const pair = (", rest: "  a,\n  b,\n);\n", lang: TypeScript},
+		// The start of a definition isn't one without the lines after it
+		{symbol: "createOrder", line: "export const createOrder = async (", lang: TypeScript},
+		{symbol: "createOrder", line: "const createOrder = (userId: string) => {", want: "function", lang: TypeScript},
+		{
+			symbol: "GetUser",
+			line:   "    public async Task<User> GetUser(",
+			rest:   "        int id,\n        CancellationToken ct)\n    {\n",
+			want:   "method",
+			lang:   CSharp,
+		},
+		{
+			symbol: "UserService",
+			line:   "    public UserService(",
+			rest:   "        IRepository<User> repo) : base(repo)\n    {\n",
+			want:   "method",
+			lang:   CSharp,
+		},
+		// A call whose arguments run on, after return
+		{symbol: "GetUser", line: "        return GetUser(", rest: "            id,\n            ct);\n", lang: CSharp},
+	}
+	for _, tt := range tests {
+		defs := DefinitionsFor(tt.symbol, tt.lang, false)
+		var rest []byte
+		if tt.rest != "" {
+			rest = []byte(tt.rest)
+		}
+		kind, ok := defs.MatchIn(tt.line, "", rest)
+		if kind != tt.want || ok != (tt.want != "") {
+			t.Errorf("MatchIn(%q) = %q, %v, want %q", tt.line, kind, ok, tt.want)
+		}
+		// The definition is found on its first line
+		if loc := defs.Find(tt.line, "", rest); ok && (loc == nil || loc[0] != 0) {
+			t.Errorf("Find(%q) = %v, want a match at its start", tt.line, loc)
+		}
+	}
+}
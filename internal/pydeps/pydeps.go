@@ -0,0 +1,188 @@
+// Package pydeps finds definitions in the packages installed in a Python
+// virtual environment, for symbols like BaseModel that are defined in its
+// site-packages rather than in the project itself.
+//
+// Only Python source and stub files are read: package metadata, bytecode
+// caches, and compiled extensions are skipped.
+package pydeps
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bashhack/cdx/internal/deps"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/symbols"
+)
+
+// FindEnv returns the virtual environment to search: env when it's set,
+// then the one $VIRTUAL_ENV names, then .venv in root.
+func FindEnv(env, root string) (string, bool) {
+	if env != "" {
+		return env, true
+	}
+	if env = os.Getenv("VIRTUAL_ENV"); env != "" {
+		return env, true
+	}
+	env = filepath.Join(root, ".venv")
+	if info, err := os.Stat(env); err == nil && info.IsDir() {
+		return env, true
+	}
+	return "", false
+}
+
+// SitePackages returns the site-packages directories of the environment in
+// env: lib/pythonX.Y/site-packages, or Lib/site-packages on Windows.
+func SitePackages(env string) ([]string, error) {
+	dirs, err := filepath.Glob(filepath.Join(env, "lib", "python*", "site-packages"))
+	if err != nil {
+		return nil, err
+	}
+	if win := filepath.Join(env, "Lib", "site-packages"); !slices.Contains(dirs, win) {
+		if info, statErr := os.Stat(win); statErr == nil && info.IsDir() {
+			dirs = append(dirs, win)
+		}
+	}
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("%s: no site-packages; is it a virtual environment?", env)
+	}
+	return dirs, nil
+}
+
+// distribution is an installed distribution, as its metadata names it.
+type distribution struct {
+	name    string
+	version string
+}
+
+// origin describes d as its name and version.
+func (d distribution) origin() string {
+	if d.version == "" {
+		return d.name
+	}
+	return d.name + "@" + d.version
+}
+
+// distributions maps the top-level names in site, the packages and modules
+// beside the metadata, to the distribution that installed each, read from
+// the RECORD file of each .dist-info directory.
+func distributions(site string) map[string]distribution {
+	dists := make(map[string]distribution)
+	infos, _ := filepath.Glob(filepath.Join(site, "*.dist-info"))
+	for _, info := range infos {
+		// The directory is name-version.dist-info, and neither part can
+		// contain a dash
+		name, version, _ := strings.Cut(strings.TrimSuffix(filepath.Base(info), ".dist-info"), "-")
+		f, err := os.Open(filepath.Join(info, "RECORD")) // #nosec G304 -- metadata in the environment's site-packages
+		if err != nil {
+			continue
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			file, _, _ := strings.Cut(sc.Text(), ",")
+			top, _, _ := strings.Cut(file, "/")
+			if top == "" || top == ".." || strings.HasSuffix(top, ".dist-info") || strings.HasSuffix(top, ".data") {
+				continue
+			}
+			if _, ok := dists[top]; !ok {
+				dists[top] = distribution{name: name, version: version}
+			}
+		}
+		_ = f.Close()
+	}
+	return dists
+}
+
+// skipped reports whether a directory in site-packages holds no source worth
+// searching: package metadata or a bytecode cache.
+func skipped(name string) bool {
+	return name == "__pycache__" || strings.HasSuffix(name, ".dist-info") || strings.HasSuffix(name, ".egg-info")
+}
+
+// Definitions returns the definitions of name in the Python source and stub
+// files under site, reading them with ex. With fold set, name matches
+// case-insensitively. Each is attributed to the distribution that installed
+// it, or, for a file no RECORD lists, to its top-level package.
+func Definitions(ctx context.Context, site, name string, ex symbols.Extractor, fold bool) ([]deps.Definition, error) {
+	dists := distributions(site)
+	needle := []byte(name)
+	if fold {
+		needle = bytes.ToLower(needle)
+	}
+	var defs []deps.Definition
+	err := filepath.WalkDir(site, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if d.IsDir() {
+			if path != site && skipped(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".py" && ext != ".pyi" {
+			return nil
+		}
+		src, err := os.ReadFile(path) // #nosec G304 -- a file in the environment's site-packages
+		if err != nil {
+			return err
+		}
+		// Most files don't mention the name at all, and reading is far
+		// cheaper than extracting
+		haystack := src
+		if fold {
+			haystack = bytes.ToLower(src)
+		}
+		if !bytes.Contains(haystack, needle) {
+			return nil
+		}
+		syms, err := ex.Extract(src, patterns.Python)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(site, path)
+		if err != nil {
+			return err
+		}
+		top, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		dist, ok := dists[top]
+		if !ok {
+			dist = distribution{name: strings.TrimSuffix(strings.TrimSuffix(top, ".pyi"), ".py")}
+		}
+		lines := strings.Split(string(src), "\n")
+		for _, s := range syms {
+			if s.Name != name && (!fold || !strings.EqualFold(s.Name, name)) {
+				continue
+			}
+			text := ""
+			if s.Line <= len(lines) {
+				text = strings.TrimSpace(lines[s.Line-1])
+			}
+			defs = append(defs, deps.Definition{
+				Path:         path,
+				Name:         s.Name,
+				Kind:         s.Kind,
+				Text:         text,
+				Distribution: dist.name,
+				Version:      dist.version,
+				Origin:       dist.origin(),
+				Line:         s.Line,
+				Column:       s.Column,
+				External:     true,
+			})
+		}
+		return nil
+	})
+	return defs, err
+}
@@ -0,0 +1,109 @@
+package pydeps
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/deps"
+	"github.com/bashhack/cdx/internal/symbols"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFindEnv(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("VIRTUAL_ENV", "")
+	if env, ok := FindEnv("", root); ok {
+		t.Errorf("FindEnv() = %q without an environment", env)
+	}
+	writeFiles(t, root, map[string]string{".venv/pyvenv.cfg": ""})
+	if env, ok := FindEnv("", root); !ok || env != filepath.Join(root, ".venv") {
+		t.Errorf("FindEnv() = %q, %v, want the repository's .venv", env, ok)
+	}
+	t.Setenv("VIRTUAL_ENV", "/active")
+	if env, _ := FindEnv("", root); env != "/active" {
+		t.Errorf("FindEnv() = %q, want $VIRTUAL_ENV", env)
+	}
+	if env, _ := FindEnv("/given", root); env != "/given" {
+		t.Errorf("FindEnv() = %q, want the given environment", env)
+	}
+}
+
+func TestSitePackages(t *testing.T) {
+	env := t.TempDir()
+	if _, err := SitePackages(env); err == nil {
+		t.Error("SitePackages() of a directory that isn't an environment succeeded")
+	}
+	writeFiles(t, env, map[string]string{"lib/python3.12/site-packages/x.py": ""})
+	got, err := SitePackages(env)
+	if want := []string{filepath.Join(env, "lib/python3.12/site-packages")}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("SitePackages() = %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	site := t.TempDir()
+	writeFiles(t, site, map[string]string{
+		"pydantic/__init__.py":                        "from .main import BaseModel\n",
+		"pydantic/main.py":                            "class BaseModel(metaclass=ModelMetaclass):\n    pass\n",
+		"pydantic/__pycache__/main.cpython-312.py":    "class BaseModel:\n    pass\n",
+		"pydantic-2.5.0.dist-info/RECORD":             "pydantic/__init__.py,sha256=x,1\npydantic/main.py,sha256=y,2\npydantic-2.5.0.dist-info/RECORD,,\n",
+		"pydantic-2.5.0.dist-info/base_model.py":      "class BaseModel:\n    pass\n",
+		"yaml/__init__.py":                            "def safe_load(stream):\n    pass\n",
+		"PyYAML-6.0.1.dist-info/RECORD":               "yaml/__init__.py,,\n_yaml/__init__.py,,\n",
+		"typing_extensions.pyi":                       "class BaseModelish: ...\ndef safe_load(s): ...\n",
+		"orphan/models.py":                            "class basemodel:\n    pass\n",
+		"pydantic_core/_pydantic_core.cpython-312.so": "class BaseModel:\n",
+	})
+	def := func(file, name, kind, text, dist, version string, line, column int) deps.Definition {
+		origin := dist
+		if version != "" {
+			origin += "@" + version
+		}
+		return deps.Definition{Path: filepath.Join(site, filepath.FromSlash(file)), Name: name, Kind: kind, Text: text,
+			Distribution: dist, Version: version, Origin: origin, Line: line, Column: column, External: true}
+	}
+
+	tests := []struct {
+		name string
+		want []deps.Definition
+		fold bool
+	}{
+		{name: "BaseModel", want: []deps.Definition{
+			def("pydantic/main.py", "BaseModel", "type", "class BaseModel(metaclass=ModelMetaclass):", "pydantic", "2.5.0", 1, 7),
+		}},
+		{name: "basemodel", fold: true, want: []deps.Definition{
+			def("orphan/models.py", "basemodel", "type", "class basemodel:", "orphan", "", 1, 7),
+			def("pydantic/main.py", "BaseModel", "type", "class BaseModel(metaclass=ModelMetaclass):", "pydantic", "2.5.0", 1, 7),
+		}},
+		// The distribution's name isn't the package's
+		{name: "safe_load", want: []deps.Definition{
+			def("typing_extensions.pyi", "safe_load", "function", "def safe_load(s): ...", "typing_extensions", "", 2, 5),
+			def("yaml/__init__.py", "safe_load", "function", "def safe_load(stream):", "PyYAML", "6.0.1", 1, 5),
+		}},
+		{name: "Missing"},
+	}
+	for _, tt := range tests {
+		got, err := Definitions(context.Background(), site, tt.name, symbols.Regex{}, tt.fold)
+		if err != nil {
+			t.Fatalf("Definitions(%q) error = %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Definitions(%q) =\n%+v\nwant\n%+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package refs
+
+// raceEnabled reports whether the race detector is on, whose
+// instrumentation allocates on its own and throws allocation counts off.
+const raceEnabled = true
@@ -0,0 +1,910 @@
+// Package refs finds references to a symbol by scanning source files for
+// whole-word occurrences of its name, with each file's language deciding
+// which characters can continue a word.
+//
+// An occurrence that the language's definition patterns match, such as the
+// name in "func GetUserByID(", is the symbol's definition rather than a
+// reference to it, and is marked so callers can list it separately.
+package refs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bashhack/cdx/internal/cache"
+	"github.com/bashhack/cdx/internal/generated"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/scan"
+	"github.com/bashhack/cdx/internal/symbols"
+	"github.com/bashhack/cdx/internal/testfiles"
+	"github.com/bashhack/cdx/internal/walk"
+)
+
+// Ref is one occurrence of a symbol.
+type Ref struct {
+	Path     string            `json:"path"` // Slash-separated, relative to the search root
+	Text     string            `json:"text"` // The whole line, without its terminator
+	Language patterns.Language `json:"language"`
+	// Archive is the archive searched, with Options.Archive; Path is then
+	// the entry's path prefixed with it, as in snapshot.tgz::main.go
+	Archive string `json:"archive,omitempty"`
+	// Rev is the git revision searched, with Options.Rev
+	Rev string `json:"rev,omitempty"`
+	// Encoding is the file's character encoding when it isn't UTF-8; Text
+	// and Column refer to the text decoded to UTF-8
+	Encoding string `json:"encoding,omitempty"`
+	// Literal is the string literal the reference is in, quotes included,
+	// when searching with Options.InStrings; only the part on Line if it
+	// spans lines
+	Literal string `json:"literal,omitempty"`
+	// Scope is what a definition is nested in, as patterns.Scope finds it,
+	// joined with dots, as in Outer.method
+	Scope string `json:"scope,omitempty"`
+	// Container is the type or class a definition belongs to, as
+	// patterns.Container finds it, and Receiver a Go method's receiver
+	// type as written, as in *GrepSearcher; see Qualified
+	Container string `json:"container,omitempty"`
+	Receiver  string `json:"receiver,omitempty"`
+	// Enclosing is the function, method, or class the reference is in, when
+	// Options.Outline is set and the reference isn't at the top level
+	Enclosing *Enclosing `json:"enclosing,omitempty"`
+	// Kind is how the code uses the symbol here; RefOther in comments and
+	// strings
+	Kind patterns.RefKind `json:"ref_kind"`
+	// Source holds the contents, decoded to UTF-8, of a file that isn't on
+	// disk, such as an archive entry or a file as of Options.Rev, so the
+	// lines around the reference can be read from them; nil otherwise
+	Source    []byte `json:"-"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"` // 1-based byte column
+	InComment bool   `json:"in_comment"`
+	InString  bool   `json:"in_string"`
+	// IsTest marks references in files Options.Tests recognizes as tests
+	IsTest bool `json:"is_test"`
+	// IsGenerated marks references in files Options.Generated recognizes as
+	// generated, when Options.SkipGenerated doesn't leave them out
+	IsGenerated bool `json:"is_generated,omitempty"`
+	// Nested marks the definition of a function inside another function
+	Nested bool `json:"nested,omitempty"`
+	// Definition marks the occurrence that defines the symbol; see Partition
+	Definition bool `json:"-"`
+	// Offset is where Line starts in the file, in bytes, so the lines
+	// around it can be read without reading the whole file; -1 when Text
+	// was decoded from another encoding or the file isn't on disk
+	Offset int64 `json:"-"`
+}
+
+// Enclosing identifies the definition a reference sits in.
+type Enclosing struct {
+	Name string `json:"name"` // Qualified by its parent, as in User.Save, when known
+	Kind string `json:"kind"`
+	Line int    `json:"line"`
+}
+
+// Code reports whether the reference looks like code rather than prose in a
+// comment or string literal.
+func (r Ref) Code() bool {
+	return !r.InComment && !r.InString
+}
+
+// leadingName matches the name at the start of a reference's text from its
+// column.
+var leadingName = regexp.MustCompile(`^` + identifier)
+
+// Qualified returns the name a definition defines, qualified by what it
+// belongs to as patterns.Qualify writes it, as in (*GrepSearcher).Close or
+// Cart.total.
+func (r Ref) Qualified() string {
+	name := leadingName.FindString(r.Text[min(r.Column-1, len(r.Text)):])
+	return patterns.Qualify(name, r.Container, r.Receiver)
+}
+
+// Partition splits found into the definition sites and the references
+// proper, keeping each in order.
+func Partition(found []Ref) (defs, refs []Ref) {
+	for _, r := range found {
+		if r.Definition {
+			defs = append(defs, r)
+		} else {
+			refs = append(refs, r)
+		}
+	}
+	return defs, refs
+}
+
+// Stats summarizes a reference search.
+type Stats struct {
+	// Unreadable lists the files that couldn't be read, in walk order, as
+	// when one vanished or lost its permissions after the walk found it.
+	// They're left out rather than failing the search.
+	Unreadable []ReadError
+	walk.Stats
+	// Truncated counts lines longer than Options.MaxLineLength, of which
+	// only the start was searched.
+	Truncated int
+	// Generated counts files Options.SkipGenerated left out.
+	Generated int
+	// Limited reports that the search stopped at Options.MaxResults
+	// before visiting every file.
+	Limited bool
+}
+
+// ErrPartial is returned along with the references found so far when a
+// search stops before visiting every file.
+type ErrPartial struct {
+	Err     error // Why the search stopped, such as context.DeadlineExceeded
+	Scanned int   // Files searched
+	Total   int   // Options.ExpectedFiles, or 0 if unknown
+}
+
+func (e *ErrPartial) Error() string {
+	return fmt.Sprintf("search stopped after %d files: %v", e.Scanned, e.Err)
+}
+
+// ReadError is a file a search couldn't read.
+type ReadError struct {
+	Err  error  // Why, such as fs.ErrNotExist, without the path
+	Path string // Where the file's references would have been reported
+}
+
+func (e ReadError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e ReadError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ErrPartial) Unwrap() error {
+	return e.Err
+}
+
+// Progress reports how many files were searched out of the expected total.
+func (e *ErrPartial) Progress() (scanned, total int) {
+	return e.Scanned, e.Total
+}
+
+// Options controls a reference search.
+type Options struct {
+	// Kinds keeps only references of these kinds; nil keeps every kind.
+	// Definition sites are kept regardless.
+	Kinds []patterns.RefKind
+	// Outline, when set, extracts each file's definitions so references
+	// can record their Enclosing definition. A file is outlined at most
+	// once, and only if it has references.
+	Outline symbols.Extractor
+	// Cache, when set, records the definitions Outline finds in each file
+	// on disk, so the symbol index learns them from reference searches too.
+	Cache *cache.Cache
+	// Names, when set, finds references to every name it matches instead of
+	// to the symbol passed to Find, as for a family of deprecated functions.
+	// It should be anchored at both ends to match whole names.
+	Names *regexp.Regexp
+	// Definitions, when set, supplies the patterns that find definition
+	// sites, so a long-lived process compiles each symbol's once.
+	Definitions *patterns.DefinitionCache
+	// Progress, when set, is called with how many files the search has
+	// reached as it reaches each one, from the goroutine walking them.
+	Progress func(files int)
+	// Files, when set, are searched instead of walking Walk.Root, in order,
+	// as a walk of it found them, so many searches can share one walk; of
+	// Walk's filters, only Languages applies to them.
+	Files []walk.File
+	// Generated recognizes generated files; see SkipGenerated.
+	Generated *generated.Detector
+	// Tests recognizes test files; see SkipTests. A nil Tests goes by each
+	// language's conventions alone.
+	Tests *testfiles.Classifier
+	// Archive, when set, searches the files inside this zip or tar archive
+	// instead of walking Walk.Root, with Walk's filters; see walk.Archive.
+	Archive string
+	// Rev, when set, searches the files under Walk.Root as of this git
+	// revision instead of the working tree, with Walk's filters; see
+	// walk.Rev.
+	Rev  string
+	Walk walk.Options
+	// Jobs is how many files are scanned concurrently; see scan.Workers.
+	Jobs int
+	// ExpectedFiles estimates how many files the search will visit, for
+	// progress reporting in ErrPartial; zero means unknown.
+	ExpectedFiles int
+	// MaxResults stops the search once it has found this many references,
+	// not counting definition sites: no more files are walked, though those
+	// already begun are finished. Since every file before the last one
+	// begun is searched, the first MaxResults references in walk order are
+	// the same as a full search's, but there may be more of them, and
+	// definition sites in the files left out aren't found. Zero means no
+	// limit.
+	MaxResults int
+	// MaxLineLength caps how many bytes of each line are searched; zero
+	// means scan.DefaultMaxLineLength and a negative value means no limit.
+	MaxLineLength int
+	// SkipComments and SkipStrings drop references the lexical heuristics
+	// place inside comments or string literals.
+	SkipComments bool
+	SkipStrings  bool
+	// InStrings turns the search around to find the symbol only inside
+	// string literals, Go struct tags included, as for a config key or an
+	// event name. Each reference records its Literal.
+	InStrings  bool
+	IgnoreCase bool
+	// SkipTests leaves out files Tests recognizes as tests,
+	// and OnlyTests all the others.
+	SkipTests bool
+	OnlyTests bool
+	// SkipGenerated leaves out files Generated recognizes as generated, by
+	// name or by their first lines; otherwise their references are marked
+	// IsGenerated. A nil Generated recognizes none.
+	SkipGenerated bool
+	// InOrder makes Stream pass the files in walk order, holding a file
+	// searched early back until those walked before it are passed.
+	InOrder bool
+}
+
+// identifier matches a run of characters that could be a name, in the
+// search for Options.Names.
+const identifier = `[\p{L}\p{N}_$]+`
+
+// errGenerated is what scanFile returns for a file that Options.Generated
+// recognizes as generated by its first lines, with Options.SkipGenerated.
+var errGenerated = errors.New("generated file")
+
+// errTestFilter is what scanFile returns for a file that Options.SkipTests
+// or OnlyTests leaves out once its contents show whether it's a test, as a
+// Zig file's test blocks do.
+var errTestFilter = errors.New("test file filtered")
+
+// beforeScan is called with each file as a worker takes it, before reading
+// it; tests replace it.
+var beforeScan = func(walk.File) {}
+
+// checkEvery is how many lines scanFile reads between context checks, so a
+// huge file doesn't delay cancellation.
+const checkEvery = 4096
+
+// Find returns the references to symbol in the files opts.Walk selects, in
+// walk order and then line order. If ctx is done before the search finishes,
+// Find returns the references found so far with an *ErrPartial wrapping
+// ctx's error.
+func Find(ctx context.Context, symbol string, opts Options) ([]Ref, Stats, error) {
+	queued, stats, err := search(ctx, symbol, opts, false, nil)
+	var found []Ref
+	for _, t := range queued {
+		found = append(found, t.refs...)
+	}
+	return found, stats, err
+}
+
+// Stream is like Find but passes each file's references to fn as soon as
+// the file is searched, rather than returning them once every file is, so a
+// caller can show the first before the slowest file is done. Each call
+// holds one file's references, in line order; files without references
+// aren't passed. Files come in the order their searches finish, which with
+// more than one job varies from run to run, rather than in walk order,
+// unless Options.InOrder is set. fn is called from the goroutines searching
+// the files, but never concurrently. If fn returns an error, no more files
+// are searched or passed to fn, and Stream returns the error.
+func Stream(ctx context.Context, symbol string, opts Options, fn func(found []Ref) error) (Stats, error) {
+	var mu sync.Mutex
+	var stopped bool
+	// With InOrder, each file's references wait here, by the file's place
+	// in the walk, for the files before it
+	held := make(map[int][]Ref)
+	var next int
+	_, stats, err := search(ctx, symbol, opts, false, func(t *task) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped {
+			return nil
+		}
+		ready := [][]Ref{t.refs}
+		if opts.InOrder {
+			held[t.seq] = t.refs
+			ready = ready[:0]
+			for found, ok := held[next]; ok; found, ok = held[next] {
+				ready = append(ready, found)
+				delete(held, next)
+				next++
+			}
+		}
+		for _, found := range ready {
+			if len(found) == 0 {
+				continue
+			}
+			if err := fn(found); err != nil {
+				stopped = true
+				return err
+			}
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// FileCount is how many references to a symbol one file holds.
+type FileCount struct {
+	File        string            `json:"file"` // Slash-separated, relative to the search root
+	Language    patterns.Language `json:"language"`
+	Count       int               `json:"count"`
+	IsTest      bool              `json:"is_test"`
+	IsGenerated bool              `json:"is_generated,omitempty"`
+}
+
+// CountByFile is like Find but only counts each file's references, keeping
+// neither their text nor their positions, so it stays cheap for symbols used
+// thousands of times. Definition sites aren't counted and files without
+// references are left out; the rest come in walk order.
+func CountByFile(ctx context.Context, symbol string, opts Options) ([]FileCount, Stats, error) {
+	opts.Outline = nil
+	queued, stats, err := search(ctx, symbol, opts, true, nil)
+	var counts []FileCount
+	for _, t := range queued {
+		if t.count > 0 {
+			counts = append(counts, FileCount{File: opts.path(t.file), Language: t.file.Language, Count: t.count, IsTest: t.isTest, IsGenerated: t.generated})
+		}
+	}
+	return counts, stats, err
+}
+
+// search runs the workers behind Find, Stream, and CountByFile, returning a
+// task for each file scanned. With count set, the tasks hold only how many
+// references each file has. done, when set, is called with each task as its
+// file is scanned; an error from it stops the search like a file's.
+func search(ctx context.Context, symbol string, opts Options, count bool, done func(*task) error) ([]*task, Stats, error) {
+	// Word boundaries depend on the language, so scanFile checks them
+	expr := regexp.QuoteMeta(symbol)
+	if opts.Names != nil {
+		expr = identifier
+	}
+	if opts.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, Stats{}, err
+	}
+	if opts.MaxLineLength == 0 {
+		opts.MaxLineLength = scan.DefaultMaxLineLength
+	}
+	defs := newDefinitions(symbol, opts)
+
+	// With MaxResults, the walk stops feeding the workers once enough
+	// references are found; the workers themselves keep ctx, so that every
+	// file queued is searched to the end
+	walkCtx, stopWalk := ctx, context.CancelFunc(func() {})
+	if opts.MaxResults > 0 {
+		walkCtx, stopWalk = context.WithCancel(ctx)
+	}
+	defer stopWalk()
+	var found atomic.Int64
+
+	// Workers scan files as the walk yields them. Each file's results land
+	// in its own task, so they're reassembled in walk order afterwards.
+	var (
+		queued   []*task
+		resolved = make(map[string]bool)
+		// Files left out by name; those left out by header are tasks
+		skippedGenerated int
+		tasks            = make(chan *task)
+		failed           firstError
+		wg               sync.WaitGroup
+	)
+	for range scan.Workers(opts.Jobs) {
+		wg.Go(func() {
+			for t := range tasks {
+				emit := func(r Ref) {
+					r.Path, r.Archive, r.Rev = opts.path(t.file), opts.Archive, opts.Rev
+					r.IsTest = r.IsTest || t.isTest
+					r.IsGenerated = r.IsGenerated || t.generated
+					t.refs = append(t.refs, r)
+				}
+				if count {
+					emit = func(r Ref) {
+						t.generated = t.generated || r.IsGenerated
+						t.isTest = t.isTest || r.IsTest
+						if !r.Definition {
+							t.count++
+						}
+					}
+				}
+				if opts.MaxResults > 0 {
+					emitRef := emit
+					emit = func(r Ref) {
+						emitRef(r)
+						if !r.Definition && found.Add(1) >= int64(opts.MaxResults) {
+							stopWalk()
+						}
+					}
+				}
+				lang := t.file.Language
+				defsOf := func(name string) patterns.Definitions { return defs.of(name, lang) }
+				beforeScan(t.file)
+				t.truncated, t.err = scanFile(ctx, t.file, re, defsOf, opts, emit)
+				var readErr ReadError
+				switch {
+				case errors.Is(t.err, errGenerated):
+					t.generated, t.err = true, nil
+				case errors.Is(t.err, errTestFilter):
+					t.err = nil
+				case errors.As(t.err, &readErr):
+					t.unreadable, t.err = &readErr, nil
+				}
+				if done != nil {
+					if err := done(t); err != nil && t.err == nil {
+						t.err = err
+					}
+					// Passed on, the references are the caller's to keep;
+					// the task stays queued only for the stats
+					t.refs, t.file.Data = nil, nil
+				}
+				if t.err != nil && ctx.Err() == nil {
+					failed.set(t.err)
+				}
+			}
+		})
+	}
+
+	files := walk.Walk
+	switch {
+	case opts.Archive != "":
+		files = func(ctx context.Context, wopts walk.Options, fn func(walk.File) error) (walk.Stats, error) {
+			return walk.Archive(ctx, opts.Archive, wopts, fn)
+		}
+	case opts.Rev != "":
+		files = func(ctx context.Context, wopts walk.Options, fn func(walk.File) error) (walk.Stats, error) {
+			return walk.Rev(ctx, opts.Rev, wopts, fn)
+		}
+	case opts.Files != nil:
+		files = func(ctx context.Context, wopts walk.Options, fn func(walk.File) error) (walk.Stats, error) {
+			return walkFiles(ctx, opts.Files, wopts.Languages, fn)
+		}
+	}
+	walkStats, err := files(walkCtx, opts.Walk, func(f walk.File) error {
+		if err := failed.get(); err != nil {
+			return err
+		}
+		// A walk only checks its context between directories
+		if opts.MaxResults > 0 && walkCtx.Err() != nil {
+			return walkCtx.Err()
+		}
+		// A path gives a test file away before it's read; a test block,
+		// in the languages that have them, only once scanFile reads it
+		isTest := opts.Tests.IsTest(f.Rel, f.Language)
+		if opts.SkipTests && isTest || opts.OnlyTests && !isTest && !testBlocks(f.Language) {
+			return nil
+		}
+		// A name gives a generated file away before it's read; a header
+		// only once scanFile reads it
+		isGenerated := opts.Generated.Name(f.Rel)
+		if opts.SkipGenerated && isGenerated {
+			skippedGenerated++
+			return nil
+		}
+		// The walk already yields each file once; this guards the results
+		// against any path that still reaches a file twice
+		if opts.Walk.FollowSymlinks && opts.Archive == "" && opts.Rev == "" {
+			if real, err := filepath.EvalSymlinks(f.Path); err == nil {
+				if resolved[real] {
+					return nil
+				}
+				resolved[real] = true
+			}
+		}
+		t := &task{file: f, seq: len(queued), isTest: isTest, generated: isGenerated}
+		queued = append(queued, t)
+		tasks <- t
+		if opts.Progress != nil {
+			opts.Progress(len(queued))
+		}
+		return nil
+	})
+	close(tasks)
+	wg.Wait()
+
+	stats := Stats{Stats: walkStats, Generated: skippedGenerated}
+	if errors.Is(err, context.Canceled) && walkCtx.Err() != nil && ctx.Err() == nil {
+		stats.Limited, err = true, nil
+	}
+	for _, t := range queued {
+		stats.Truncated += t.truncated
+		if opts.SkipGenerated && t.generated {
+			stats.Generated++
+		}
+		if t.unreadable != nil {
+			stats.Unreadable = append(stats.Unreadable, *t.unreadable)
+		}
+		// A file can fail, or see ctx expire, after the walk's last check
+		if err == nil {
+			err = t.err
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		err = &ErrPartial{Err: err, Scanned: stats.Files, Total: opts.ExpectedFiles}
+	}
+	return queued, stats, err
+}
+
+// testBlocks reports whether a file in lang can be a test by its contents,
+// which only reading it tells.
+func testBlocks(lang patterns.Language) bool {
+	lp := patterns.ForLanguage(lang)
+	return lp != nil && lp.TestBlock != nil
+}
+
+// walkFiles calls fn for each of files in langs, or all of them when langs
+// is empty, as a walk that found them would, stopping early when ctx is done
+// or fn returns an error.
+func walkFiles(ctx context.Context, files []walk.File, langs []patterns.Language, fn func(walk.File) error) (walk.Stats, error) {
+	var stats walk.Stats
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		if len(langs) > 0 && !slices.Contains(langs, f.Language) {
+			continue
+		}
+		stats.Files++
+		if err := fn(f); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// path is where f's references are reported to be: its path relative to
+// the root, or in the archive searched.
+func (opts *Options) path(f walk.File) string {
+	if opts.Archive != "" {
+		return f.Path
+	}
+	return f.Rel
+}
+
+// task is one file handed to a worker and, once scanned, its results.
+type task struct {
+	err error
+	// unreadable is why the file couldn't be read, if it couldn't
+	unreadable *ReadError
+	file       walk.File
+	refs       []Ref
+	seq        int // The file's place in the walk
+	count      int // References, when counting instead of collecting
+	truncated  int
+	isTest     bool
+	// generated reports that the file is generated, by name or header;
+	// with Options.SkipGenerated, only the header can have said so, and
+	// the file's references are dropped
+	generated bool
+}
+
+// firstError records the first error reported by any worker.
+type firstError struct {
+	err error
+	mu  sync.Mutex
+}
+
+func (e *firstError) set(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+func (e *firstError) get() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// definitions supplies the definition patterns of the names a search
+// finds, compiling each name's once.
+type definitions struct {
+	byName map[string]map[patterns.Language]patterns.Definitions
+	symbol string
+	opts   Options
+	mu     sync.Mutex
+}
+
+func newDefinitions(symbol string, opts Options) *definitions {
+	return &definitions{byName: make(map[string]map[patterns.Language]patterns.Definitions), symbol: symbol, opts: opts}
+}
+
+// of returns the patterns that match a definition of name, a match found in
+// a file in lang. Every match of a symbol shares the symbol's patterns.
+func (d *definitions) of(name string, lang patterns.Language) patterns.Definitions {
+	// Text in strings isn't defined anywhere, so InStrings needs no
+	// definition patterns
+	if d.opts.InStrings {
+		return patterns.Definitions{}
+	}
+	if d.opts.Names == nil {
+		name = d.symbol
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.byName[name] == nil {
+		d.byName[name] = make(map[patterns.Language]patterns.Definitions)
+	}
+	defs, ok := d.byName[name][lang]
+	if !ok {
+		if d.opts.Definitions != nil {
+			defs = d.opts.Definitions.Get(name, lang, d.opts.IgnoreCase)
+		} else {
+			defs = patterns.DefinitionsFor(name, lang, d.opts.IgnoreCase)
+		}
+		d.byName[name][lang] = defs
+	}
+	return defs
+}
+
+// scanFile passes each reference to re in f to emit and returns the number
+// of lines too long to search in full, stopping early if ctx is done. On a
+// line one of defs(name) matches, the first occurrence of name inside the
+// match is its definition; any others, such as a recursive call, are
+// references. A nil defs finds no definitions.
+func scanFile(ctx context.Context, f walk.File, re *regexp.Regexp, defs func(name string) patterns.Definitions, opts Options, emit func(Ref)) (int, error) {
+	data, enc, base, release, err := readFile(f)
+	if err != nil {
+		// The path is reported apart, as the file's is
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return 0, ReadError{Err: err, Path: opts.path(f)}
+	}
+	defer release()
+	// UTF-8 is the norm, so only other encodings are worth reporting
+	if enc == scan.UTF8 {
+		enc = ""
+	}
+	isGenerated := opts.Generated.Header(data)
+	if isGenerated && opts.SkipGenerated {
+		return 0, errGenerated
+	}
+	// The walk already left out the files a path shows to be tests, or
+	// not, except those a test block could still make one
+	isTest := false
+	if testBlocks(f.Language) {
+		isTest = opts.Tests.IsTestSource(f.Rel, f.Language, data)
+		if isTest && opts.SkipTests || !isTest && opts.OnlyTests {
+			return 0, errTestFilter
+		}
+	}
+
+	var (
+		truncated int
+		lexer     = patterns.NewLexer(f.Language)
+		blocks    = patterns.NewBlocks(f.Language)
+		outline   []symbols.Symbol
+		outlined  bool
+		indents   []int    // Of each line so far, for symbols.Enclosing
+		lines     []string // Of the whole file, once a definition needs its scope
+		// The matches on a line, and where each name matched is defined,
+		// reused from line to line so that only lines with references
+		// allocate
+		matches [][2]int
+		spans   map[string][]int
+	)
+	literal, _ := literalOf(re)
+	// Where the next line starts in data; Lines drops a byte order mark
+	next := 0
+	if scan.Sniff(data) == scan.UTF8 {
+		next = len("\uFEFF")
+	}
+	for n, line := range scan.Lines(data) {
+		if n%checkEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return truncated, err
+			}
+		}
+		lineStart := next
+		if next += len(line); next < len(data) && data[next] == '\r' {
+			next++
+		}
+		next++
+		line, clipped := scan.Clip(line, opts.MaxLineLength)
+		if clipped {
+			truncated++
+		}
+		if opts.Outline != nil {
+			indents = append(indents, len(line)-len(strings.TrimLeft(line, " \t")))
+		}
+		lc := lexer.NextLine(line)
+		block := blocks.Next(line)
+		matches = slices.DeleteFunc(findAll(re, literal, line, matches[:0]), func(loc [2]int) bool {
+			return !patterns.IsWholeWord(f.Language, line, loc[0], loc[1]) ||
+				opts.Names != nil && !opts.Names.MatchString(line[loc[0]:loc[1]])
+		})
+		if len(matches) == 0 {
+			continue
+		}
+		// A reference keeps a copy of its line, rather than a slice that
+		// would keep the whole file's text alive
+		text := strings.Clone(line)
+		// Where each name matched on the line is defined, if it is; all the
+		// matches of a symbol share one entry
+		clear(spans)
+		nameAt := func(loc [2]int) string {
+			if opts.Names == nil {
+				return ""
+			}
+			return line[loc[0]:loc[1]]
+		}
+		for _, loc := range matches {
+			if name := nameAt(loc); defs != nil {
+				if _, ok := spans[name]; !ok {
+					if spans == nil {
+						spans = make(map[string][]int)
+					}
+					spans[name] = defs(line[loc[0]:loc[1]]).Find(line, block, data[min(next, len(data)):])
+				}
+			}
+		}
+		for _, loc := range matches {
+			name := nameAt(loc)
+			def := spans[name]
+			start, end, where := lc.Span(loc[0])
+			if opts.InStrings && where != patterns.String {
+				continue
+			}
+			r := Ref{
+				Text:        text,
+				Language:    f.Language,
+				Line:        n,
+				Column:      loc[0] + 1,
+				Offset:      -1,
+				InComment:   where == patterns.Comment,
+				InString:    where == patterns.String,
+				IsTest:      isTest,
+				IsGenerated: isGenerated,
+				Encoding:    string(enc),
+			}
+			switch {
+			case def != nil && r.Code() && loc[0] >= def[0] && loc[1] <= def[1]:
+				r.Definition, r.Kind, spans[name] = true, patterns.RefDefinition, nil
+				// Only a file with a definition in it is split into lines,
+				// to find what the definition belongs to
+				if lines == nil {
+					lines = strings.Split(string(data), "\n")
+				}
+				r.Container, r.Receiver = patterns.Container(f.Language, lines, n)
+				if f.Language == patterns.Python {
+					chain, nested := patterns.Scope(f.Language, lines, n)
+					r.Scope, r.Nested = strings.Join(chain, "."), nested
+				}
+			case r.Code():
+				r.Kind = patterns.ClassifyRef(f.Language, line, loc[0], loc[1])
+			default:
+				r.Kind = patterns.RefOther
+			}
+			if base >= 0 {
+				r.Offset = base + int64(lineStart)
+			}
+			if f.Data != nil {
+				r.Source = data
+			}
+			if r.InComment && opts.SkipComments || r.InString && opts.SkipStrings {
+				continue
+			}
+			if opts.InStrings {
+				r.Literal = text[start:end]
+			}
+			if opts.Kinds != nil && !r.Definition && !slices.Contains(opts.Kinds, r.Kind) {
+				continue
+			}
+			if opts.Outline != nil && !r.Definition {
+				if !outlined {
+					// A file the extractor can't outline just has no
+					// enclosing definitions
+					var err error
+					outline, err = symbols.ExtractSource(opts.Outline, data, f.Language, filepath.Ext(f.Path))
+					outlined = true
+					if err == nil && opts.Cache != nil && f.Data == nil && f.Info != nil {
+						opts.Cache.Put(f.Path, f.Info, cache.FromSymbols(outline))
+					}
+				}
+				indent := func(line int) int { return indents[line-1] }
+				if s, ok := symbols.Enclosing(outline, n, indent); ok {
+					r.Enclosing = enclosingOf(s)
+				}
+			}
+			emit(r)
+		}
+	}
+	return truncated, nil
+}
+
+// literalOf returns the text re matches when that's all it matches, as for
+// a symbol without -i, so it can be found with strings.Index instead.
+func literalOf(re *regexp.Regexp) (string, bool) {
+	prefix, complete := re.LiteralPrefix()
+	return prefix, complete && prefix != ""
+}
+
+// findAll appends the offsets of re's matches in line to locs, as
+// FindAllStringIndex would find them; a non-empty literal is the text re
+// matches, and is searched for directly, which allocates nothing.
+func findAll(re *regexp.Regexp, literal, line string, locs [][2]int) [][2]int {
+	if literal == "" {
+		for _, loc := range re.FindAllStringIndex(line, -1) {
+			locs = append(locs, [2]int{loc[0], loc[1]})
+		}
+		return locs
+	}
+	for i := 0; ; {
+		j := strings.Index(line[i:], literal)
+		if j < 0 {
+			return locs
+		}
+		i += j
+		locs = append(locs, [2]int{i, i + len(literal)})
+		i += len(literal)
+	}
+}
+
+// maxPooledBuffer is the largest read buffer readBuffers keeps, so that one
+// huge file doesn't hold on to its memory for the rest of the search.
+const maxPooledBuffer = 1 << 20
+
+// readBuffers recycles the buffers files are read into. Nothing scanFile
+// passes on points into the file's contents, so the buffer is free again
+// once the file is scanned.
+var readBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// readFile returns f's contents decoded to UTF-8, and a function to call
+// once they're no longer needed. base is the offset in the file of the
+// contents' first byte, past any byte order mark, or -1 when they were
+// decoded from another encoding or didn't come from disk.
+func readFile(f walk.File) (data []byte, enc scan.Encoding, base int64, release func(), err error) {
+	if f.Data != nil {
+		data, enc := scan.Decode(f.Data)
+		return data, enc, -1, func() {}, nil
+	}
+	buf := readBuffers.Get().(*bytes.Buffer)
+	release = func() {
+		if buf.Cap() <= maxPooledBuffer {
+			buf.Reset()
+			readBuffers.Put(buf)
+		}
+	}
+	file, err := os.Open(f.Path) // #nosec G304 -- a path from the walk
+	if err != nil {
+		release()
+		return nil, "", 0, nil, err
+	}
+	_, err = buf.ReadFrom(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		release()
+		return nil, "", 0, nil, err
+	}
+	data, enc = scan.Decode(buf.Bytes())
+	// Only UTF-8 and undetected text keep the file's bytes as they are
+	base = -1
+	if enc == scan.UTF8 || enc == scan.Unknown {
+		base = int64(buf.Len() - len(data))
+	}
+	return data, enc, base, release, nil
+}
+
+// enclosingOf describes s as the definition enclosing a reference.
+func enclosingOf(s symbols.Symbol) *Enclosing {
+	name := s.Name
+	if s.Parent != "" {
+		name = s.Parent + "." + s.Name
+	}
+	return &Enclosing{Name: name, Kind: s.Kind, Line: s.Line}
+}
@@ -0,0 +1,1286 @@
+package refs
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bashhack/cdx/internal/cache"
+	"github.com/bashhack/cdx/internal/generated"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/symbols"
+	"github.com/bashhack/cdx/internal/walk"
+)
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	src := `package limits
+
+// MaxUsers caps sign-ups.
+const MaxUsers = 10
+
+/*
+MaxUsers was 5 before v2.
+*/
+func check(n int) error {
+	if n > MaxUsers {
+		return errors.New("MaxUsers exceeded")
+	}
+	return nil
+}
+
+var maxUsersSeen = MaxUsersLimit
+`
+	if err := os.WriteFile(filepath.Join(root, "limits.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		want  []int  // Lines with references
+		inCom []bool // Expected InComment for the first references
+		opts  Options
+	}{
+		{
+			name:  "all",
+			want:  []int{3, 4, 7, 10, 11},
+			inCom: []bool{true, false, true, false, false},
+		},
+		{
+			name: "code only",
+			opts: Options{SkipComments: true, SkipStrings: true},
+			want: []int{4, 10},
+		},
+		{
+			name: "ignore case",
+			opts: Options{IgnoreCase: true, SkipComments: true, SkipStrings: true},
+			want: []int{4, 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Walk = walk.Options{Root: root}
+			got, _, err := Find(context.Background(), "MaxUsers", tt.opts)
+			if err != nil {
+				t.Fatalf("Find: %v", err)
+			}
+			var lines []int
+			for _, r := range got {
+				lines = append(lines, r.Line)
+			}
+			if !reflect.DeepEqual(lines, tt.want) {
+				t.Errorf("Find() lines = %v, want %v", lines, tt.want)
+			}
+			for i, want := range tt.inCom {
+				if i < len(got) && got[i].InComment != want {
+					t.Errorf("ref on line %d InComment = %v, want %v", got[i].Line, got[i].InComment, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFindDefinitions(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"fact.go": "package m\n\n// Fact computes n!.\nfunc Fact(n int) int { if n < 2 { return 1 }; return n * Fact(n-1) }\n\nvar six = Fact(3)\n",
+		"fact.py": "def Fact(n):\n    return 1 if n < 2 else n * Fact(n - 1)\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, _, err := Find(context.Background(), "Fact", Options{Walk: walk.Options{Root: root}})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	defs, refs := Partition(found)
+
+	var gotDefs, gotRefs []string
+	for _, r := range defs {
+		gotDefs = append(gotDefs, fmt.Sprintf("%s:%d:%d", r.Path, r.Line, r.Column))
+	}
+	for _, r := range refs {
+		gotRefs = append(gotRefs, fmt.Sprintf("%s:%d:%d", r.Path, r.Line, r.Column))
+	}
+	slices.Sort(gotDefs)
+	slices.Sort(gotRefs)
+	// The recursive calls on the definition lines are references, and so is
+	// the mention in the doc comment
+	wantDefs := []string{"fact.go:4:6", "fact.py:1:5"}
+	wantRefs := []string{"fact.go:3:4", "fact.go:4:58", "fact.go:6:11", "fact.py:2:32"}
+	if !reflect.DeepEqual(gotDefs, wantDefs) {
+		t.Errorf("definitions = %v, want %v", gotDefs, wantDefs)
+	}
+	if !reflect.DeepEqual(gotRefs, wantRefs) {
+		t.Errorf("references = %v, want %v", gotRefs, wantRefs)
+	}
+}
+
+func TestFindLastLine(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"last.go":  "func Last() {}",
+		"crlf.go":  "package m\r\n\r\nfunc Last() {}\r",
+		"empty.go": "",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	found, _, err := Find(context.Background(), "Last", Options{Walk: walk.Options{Root: root}})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	var got []string
+	for _, r := range found {
+		got = append(got, fmt.Sprintf("%s:%d:%d %v %q", r.Path, r.Line, r.Column, r.Definition, r.Text))
+	}
+	want := []string{`crlf.go:3:6 true "func Last() {}"`, `last.go:1:6 true "func Last() {}"`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Find() = %q, want %q", got, want)
+	}
+}
+
+func TestFindUnreadable(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.go", "gone.go", "z.go"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("var x = Limit\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The file vanishes after the walk finds it, before it's read
+	beforeScan = func(f walk.File) {
+		if f.Rel == "gone.go" {
+			if err := os.Remove(f.Path); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	t.Cleanup(func() { beforeScan = func(walk.File) {} })
+
+	found, stats, err := Find(context.Background(), "Limit", Options{Walk: walk.Options{Root: root}})
+	if err != nil {
+		t.Fatalf("Find() error = %v, want the other files searched", err)
+	}
+	var paths []string
+	for _, r := range found {
+		paths = append(paths, r.Path)
+	}
+	if want := []string{"a.go", "z.go"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("Find() found refs in %q, want %q", paths, want)
+	}
+	if len(stats.Unreadable) != 1 || stats.Unreadable[0].Path != "gone.go" || !errors.Is(stats.Unreadable[0], fs.ErrNotExist) {
+		t.Fatalf("Unreadable = %v, want gone.go not existing", stats.Unreadable)
+	}
+	if got, want := stats.Unreadable[0].Error(), "gone.go: no such file or directory"; runtime.GOOS != "windows" && got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+// TestStream checks that Stream passes each file's references together, in
+// the order the files finish rather than walk order, and stops once fn
+// fails.
+func TestStream(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", "c.go"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("var x = Limit\nvar y = Limit\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	batch := func(found []Ref) string {
+		var lines []string
+		for _, r := range found {
+			lines = append(lines, fmt.Sprintf("%s:%d", r.Path, r.Line))
+		}
+		return strings.Join(lines, " ")
+	}
+
+	t.Run("completion order", func(t *testing.T) {
+		// a.go is searched only once b.go is passed to fn, so it finishes
+		// after, though the walk finds it first
+		bDone := make(chan struct{})
+		beforeScan = func(f walk.File) {
+			if f.Rel == "a.go" {
+				select {
+				case <-bDone:
+				case <-time.After(10 * time.Second):
+					t.Error("b.go never reached fn")
+				}
+			}
+		}
+		t.Cleanup(func() { beforeScan = func(walk.File) {} })
+
+		var got []string
+		var calls atomic.Int32
+		_, err := Stream(context.Background(), "Limit", Options{Walk: walk.Options{Root: root}, Jobs: 2}, func(found []Ref) error {
+			if calls.Add(1) > 1 {
+				t.Error("fn called concurrently")
+			}
+			defer calls.Add(-1)
+			got = append(got, batch(found))
+			if found[0].Path == "b.go" {
+				close(bDone)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// c.go can finish before or after a.go
+		if len(got) != 3 || got[0] != "b.go:1 b.go:2" || !slices.Contains(got, "a.go:1 a.go:2") || !slices.Contains(got, "c.go:1 c.go:2") {
+			t.Errorf("Stream() passed %q, want b.go first, then a.go and c.go, each whole", got)
+		}
+	})
+
+	t.Run("in order", func(t *testing.T) {
+		// a.go is searched only once c.go is begun, so it finishes after
+		// b.go, but is still passed first
+		cBegun := make(chan struct{})
+		beforeScan = func(f walk.File) {
+			switch f.Rel {
+			case "a.go":
+				select {
+				case <-cBegun:
+				case <-time.After(10 * time.Second):
+					t.Error("c.go never begun")
+				}
+			case "c.go":
+				close(cBegun)
+			}
+		}
+		t.Cleanup(func() { beforeScan = func(walk.File) {} })
+
+		var got []string
+		_, err := Stream(context.Background(), "Limit", Options{Walk: walk.Options{Root: root}, Jobs: 2, InOrder: true}, func(found []Ref) error {
+			got = append(got, batch(found))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"a.go:1 a.go:2", "b.go:1 b.go:2", "c.go:1 c.go:2"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Stream() passed %q, want %q", got, want)
+		}
+	})
+
+	t.Run("fn fails", func(t *testing.T) {
+		errStop := errors.New("stop")
+		var got []string
+		_, err := Stream(context.Background(), "Limit", Options{Walk: walk.Options{Root: root}, Jobs: 1}, func(found []Ref) error {
+			got = append(got, batch(found))
+			return errStop
+		})
+		if !errors.Is(err, errStop) {
+			t.Errorf("Stream() error = %v, want %v", err, errStop)
+		}
+		if want := []string{"a.go:1 a.go:2"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Stream() passed %q, want %q", got, want)
+		}
+	})
+
+	t.Run("references released", func(t *testing.T) {
+		// done runs on the searching goroutines
+		var passed atomic.Int32
+		queued, _, err := search(context.Background(), "Limit", Options{Walk: walk.Options{Root: root}, Jobs: 2}, false, func(t *task) error {
+			passed.Add(int32(len(t.refs)))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := passed.Load(); n != 6 {
+			t.Errorf("search() passed %d references, want 6", n)
+		}
+		for _, task := range queued {
+			if task.refs != nil {
+				t.Errorf("%s still holds %d references once passed", task.file.Rel, len(task.refs))
+			}
+		}
+	})
+}
+
+// TestFindDefinitionsInBlocks checks that a name is defined by a member of a
+// const block but not by a struct field or composite literal key indented
+// like one.
+func TestFindDefinitionsInBlocks(t *testing.T) {
+	root := t.TempDir()
+	src := "package m\n\ntype Config struct {\n\tTimeout int\n}\n\nconst (\n\tTimeout = 30\n)\n\nvar c = Config{\n\tTimeout: Timeout,\n}\n"
+	if err := os.WriteFile(filepath.Join(root, "config.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	found, _, err := Find(context.Background(), "Timeout", Options{Walk: walk.Options{Root: root}})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	defs, refs := Partition(found)
+	if len(defs) != 1 || defs[0].Line != 8 || defs[0].Kind != patterns.RefDefinition {
+		t.Errorf("definitions = %+v, want just line 8", defs)
+	}
+	if len(refs) != 3 {
+		t.Errorf("references = %+v, want the field and both uses in the literal", refs)
+	}
+}
+
+// TestFindWrappedDefinitions checks that an arrow function whose parameters
+// are on the lines after its name is a definition, on the line with the
+// name, and that a wrapped parenthesized expression isn't.
+func TestFindWrappedDefinitions(t *testing.T) {
+	root := t.TempDir()
+	src := "export const createOrder = async (\n  userId: string,\n): Promise<Order> => {\n  return save(userId);\n};\n\n" +
+		"const order = (\n  createOrder\n);\n"
+	if err := os.WriteFile(filepath.Join(root, "orders.ts"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	found, _, err := Find(context.Background(), "", Options{Walk: walk.Options{Root: root}, Names: regexp.MustCompile(`^(?:createOrder|order)$`)})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	defs, _ := Partition(found)
+	var got []string
+	for _, r := range defs {
+		got = append(got, fmt.Sprintf("%d:%d %s", r.Line, r.Column, r.Text))
+	}
+	if want := []string{"1:14 export const createOrder = async ("}; !reflect.DeepEqual(got, want) {
+		t.Errorf("definitions = %q, want %q", got, want)
+	}
+}
+
+func TestFindPythonScopes(t *testing.T) {
+	root := t.TempDir()
+	src := "def retry(fn):\n    def wrapper():\n        return fn()\n    return wrapper\n\n" +
+		"class Client:\n    def wrapper(self):\n        pass\n\ndef wrapper():\n    pass\n"
+	if err := os.WriteFile(filepath.Join(root, "retry.py"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	found, _, err := Find(context.Background(), "wrapper", Options{Walk: walk.Options{Root: root}})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	defs, _ := Partition(found)
+	var got []string
+	for _, r := range defs {
+		got = append(got, fmt.Sprintf("%d scope=%s nested=%v", r.Line, r.Scope, r.Nested))
+	}
+	want := []string{"2 scope=retry nested=true", "7 scope=Client nested=false", "10 scope= nested=false"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("definitions = %q, want %q", got, want)
+	}
+}
+
+func TestFindContainers(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"grep.go":  "package search\n\nfunc (g *GrepSearcher) Close() error { return nil }\n",
+		"tags.go":  "package search\n\nfunc (TagSearcher) Close() error { return nil }\n\nfunc Close() {}\n",
+		"cart.ts":  "export class Cart {\n  close(): void {}\n}\n",
+		"cart.rs":  "impl Drop for Cart {\n    fn close(&mut self) {}\n}\n",
+		"cart.py":  "class Cart:\n    def close(self):\n        pass\n",
+		"close.js": "function close() {}\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	found, _, err := Find(context.Background(), "close", Options{Walk: walk.Options{Root: root}, IgnoreCase: true})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	defs, _ := Partition(found)
+	var got []string
+	for _, r := range defs {
+		got = append(got, fmt.Sprintf("%s:%d %s", r.Path, r.Line, r.Qualified()))
+	}
+	slices.Sort(got)
+	want := []string{
+		"cart.py:2 Cart.close",
+		"cart.rs:2 Cart.close",
+		"cart.ts:2 Cart.close",
+		"close.js:1 close",
+		"grep.go:3 (*GrepSearcher).Close",
+		"tags.go:3 (TagSearcher).Close",
+		"tags.go:5 Close",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("definitions = %q, want %q", got, want)
+	}
+}
+
+func TestFindKinds(t *testing.T) {
+	root := t.TempDir()
+	src := "package m\n\ntype User struct{}\n\nfunc load(id int) *User {\n\tu := User{}\n\t// User is returned as is.\n\treturn &u\n}\n"
+	if err := os.WriteFile(filepath.Join(root, "user.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		kinds []patterns.RefKind
+		want  []string
+	}{
+		{
+			name: "every kind",
+			want: []string{"3:definition", "5:type", "6:construct", "7:other"},
+		},
+		{
+			name:  "filtered, definitions kept",
+			kinds: []patterns.RefKind{patterns.RefConstruct},
+			want:  []string{"3:definition", "6:construct"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, _, err := Find(context.Background(), "User", Options{Walk: walk.Options{Root: root}, Kinds: tt.kinds})
+			if err != nil {
+				t.Fatalf("Find: %v", err)
+			}
+			var got []string
+			for _, r := range found {
+				got = append(got, fmt.Sprintf("%d:%s", r.Line, r.Kind))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Find() kinds = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindTestFiles(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"src/user.ts":           "export const u = parse();\n",
+		"src/__tests__/user.ts": "test(() => parse());\n",
+		"src/user.spec.ts":      "it(() => parse());\n",
+		// A Zig test block makes its file a test wherever it lives
+		"src/main.zig":  "pub fn main() void {\n    parse();\n}\n",
+		"src/parse.zig": "pub fn run() void {\n    parse();\n}\n\ntest \"run\" {\n    parse();\n}\n",
+	}
+	for name, src := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		want []string // path:is_test
+		opts Options
+	}{
+		{
+			name: "both",
+			want: []string{"src/__tests__/user.ts:true", "src/main.zig:false", "src/parse.zig:true", "src/parse.zig:true", "src/user.spec.ts:true", "src/user.ts:false"},
+		},
+		{
+			name: "code only",
+			opts: Options{SkipTests: true},
+			want: []string{"src/main.zig:false", "src/user.ts:false"},
+		},
+		{
+			name: "tests only",
+			opts: Options{OnlyTests: true},
+			want: []string{"src/__tests__/user.ts:true", "src/parse.zig:true", "src/parse.zig:true", "src/user.spec.ts:true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Walk = walk.Options{Root: root}
+			found, _, err := Find(context.Background(), "parse", tt.opts)
+			if err != nil {
+				t.Fatalf("Find: %v", err)
+			}
+			var got []string
+			for _, r := range found {
+				got = append(got, fmt.Sprintf("%s:%v", r.Path, r.IsTest))
+			}
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Find() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindGenerated(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"user.go":    "package m\n\nfunc f() { Parse() }\n",
+		"user.pb.go": "package m\n\nfunc g() { Parse() }\n",
+		"mock.go":    "// Code generated by mockgen. DO NOT EDIT.\n\npackage m\n\nfunc h() { Parse() }\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		want      []string // path:is_generated
+		opts      Options
+		generated int
+	}{
+		{
+			name:      "skipped",
+			opts:      Options{Generated: generated.Default(), SkipGenerated: true},
+			want:      []string{"user.go:false"},
+			generated: 2,
+		},
+		{
+			name: "marked",
+			opts: Options{Generated: generated.Default()},
+			want: []string{"mock.go:true", "user.go:false", "user.pb.go:true"},
+		},
+		{
+			name: "no detector",
+			opts: Options{SkipGenerated: true},
+			want: []string{"mock.go:false", "user.go:false", "user.pb.go:false"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Walk = walk.Options{Root: root}
+			found, stats, err := Find(context.Background(), "Parse", tt.opts)
+			if err != nil {
+				t.Fatalf("Find: %v", err)
+			}
+			var got []string
+			for _, r := range found {
+				got = append(got, fmt.Sprintf("%s:%v", r.Path, r.IsGenerated))
+			}
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Find() = %v, want %v", got, tt.want)
+			}
+			if stats.Generated != tt.generated {
+				t.Errorf("stats.Generated = %d, want %d", stats.Generated, tt.generated)
+			}
+
+			counts, _, err := CountByFile(context.Background(), "Parse", tt.opts)
+			if err != nil {
+				t.Fatalf("CountByFile: %v", err)
+			}
+			got = got[:0]
+			for _, c := range counts {
+				got = append(got, fmt.Sprintf("%s:%v", c.File, c.IsGenerated))
+			}
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CountByFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAcrossLanguages(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"order.go":  "package api\n\nvar items []OrderItem\n",
+		"order.ts":  "const a = $OrderItem;\nconst b: OrderItem = load();\n",
+		"orders.py": "item = OrderItem_v2()\nitem = OrderItem()\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, _, err := Find(context.Background(), "OrderItem", Options{Walk: walk.Options{Root: root}})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	var got []string
+	for _, r := range found {
+		got = append(got, fmt.Sprintf("%s:%d:%d:%s", r.Path, r.Line, r.Column, r.Language))
+	}
+	slices.Sort(got)
+	// $OrderItem and OrderItem_v2 are other identifiers
+	want := []string{"order.go:3:13:go", "order.ts:2:10:ts", "orders.py:2:8:py"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Find() = %v, want %v", got, want)
+	}
+}
+
+// countingExtractor is the regex extractor, counting how many files it
+// outlines.
+type countingExtractor struct {
+	calls atomic.Int64
+}
+
+func (c *countingExtractor) Name() string {
+	return symbols.ParserRegex
+}
+
+func (c *countingExtractor) Extract(src []byte, lang patterns.Language) ([]symbols.Symbol, error) {
+	c.calls.Add(1)
+	return symbols.Regex{}.Extract(src, lang)
+}
+
+func TestFindEnclosing(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"user.go": "package m\n\nvar Default = Load(0)\n\nfunc (s *Store) Get(id int) *User {\n\treturn Load(id)\n}\n\nfunc warm() {\n\tLoad(1)\n\tLoad(2)\n}\n",
+		"none.go": "package m\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outline := new(countingExtractor)
+	c := cache.New(t.TempDir(), cache.DefaultMaxBytes)
+	found, _, err := Find(context.Background(), "Load", Options{Walk: walk.Options{Root: root}, Outline: outline, Cache: c})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	var got []string
+	for _, r := range found {
+		desc := fmt.Sprintf("%d:", r.Line)
+		if r.Enclosing != nil {
+			desc += fmt.Sprintf("%s/%s/%d", r.Enclosing.Name, r.Enclosing.Kind, r.Enclosing.Line)
+		}
+		got = append(got, desc)
+	}
+	want := []string{"3:", "6:Get/method/5", "10:warm/function/9", "11:warm/function/9"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Find() enclosing = %v, want %v", got, want)
+	}
+	// Once for user.go; none.go has no references to outline
+	if n := outline.calls.Load(); n != 1 {
+		t.Errorf("outlined %d times, want 1", n)
+	}
+	// What's outlined is cached, for the symbol index
+	if got, want := c.Complete("", 10), []cache.Name{{Name: "Default", Kind: "var"}, {Name: "Get", Kind: "method"}, {Name: "warm", Kind: "function"}}; c.Len() != 1 || !reflect.DeepEqual(got, want) {
+		t.Errorf("cached %d files naming %v, want 1 naming %v", c.Len(), got, want)
+	}
+}
+
+func TestFindInStrings(t *testing.T) {
+	root := t.TempDir()
+	src := "package m\n\ntype User struct {\n\tID int `json:\"user_id,omitempty\" db:\"user_id\"`\n}\n\n" +
+		"func key() string {\n\tuser_id := \"x\"\n\tlog(\"say \\\"user_id\\\"\", user_id)\n\treturn `C:\\` + \"user_ids\"\n}\n"
+	if err := os.WriteFile(filepath.Join(root, "user.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{Walk: walk.Options{Root: root}, InStrings: true, Outline: symbols.Regex{}}
+	found, _, err := Find(context.Background(), "user_id", opts)
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	var got []string
+	for _, r := range found {
+		desc := fmt.Sprintf("%d:%d %s", r.Line, r.Column, r.Literal)
+		if r.Enclosing != nil {
+			desc += " in " + r.Enclosing.Name
+		}
+		got = append(got, desc)
+	}
+	// The identifiers named user_id, and the longer user_ids, aren't matches
+	want := []string{
+		"4:16 `json:\"user_id,omitempty\" db:\"user_id\"` in User",
+		"4:39 `json:\"user_id,omitempty\" db:\"user_id\"` in User",
+		"9:13 \"say \\\"user_id\\\"\" in key",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Find() = %q, want %q", got, want)
+	}
+}
+
+func TestFindNames(t *testing.T) {
+	root := t.TempDir()
+	src := "package m\n\nfunc LegacyOpen() {}\n\nfunc run() {\n\tLegacyOpen()\n\tLegacyClose(NewLegacyReader())\n\tx.Legacy = 1\n}\n"
+	if err := os.WriteFile(filepath.Join(root, "m.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{Walk: walk.Options{Root: root}, Names: regexp.MustCompile(`^(?:Legacy\w+)$`)}
+	found, _, err := Find(context.Background(), "", opts)
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	var got []string
+	for _, r := range found {
+		got = append(got, fmt.Sprintf("%d:%d %s %s", r.Line, r.Column, r.Kind, r.Text[r.Column-1:]))
+	}
+	// NewLegacyReader and the bare Legacy don't match the whole name
+	want := []string{
+		"3:6 definition LegacyOpen() {}",
+		"6:2 call LegacyOpen()",
+		"7:2 call LegacyClose(NewLegacyReader())",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Find() = %q, want %q", got, want)
+	}
+}
+
+func TestFindProgress(t *testing.T) {
+	root := writeCorpus(t, 2, 3, 10)
+	var reported []int
+	opts := Options{Walk: walk.Options{Root: root}, Progress: func(files int) { reported = append(reported, files) }}
+	if _, _, err := Find(context.Background(), "MaxUsers", opts); err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if want := []int{1, 2, 3, 4, 5, 6}; !reflect.DeepEqual(reported, want) {
+		t.Errorf("Progress calls = %v, want %v", reported, want)
+	}
+}
+
+func TestFindFiles(t *testing.T) {
+	root := t.TempDir()
+	for name, src := range map[string]string{
+		"a.go": "package a\n\nvar x = MaxUsers\n",
+		"b.py": "x = MaxUsers\n",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var files []walk.File
+	if _, err := walk.Walk(context.Background(), walk.Options{Root: root}, func(f walk.File) error {
+		files = append(files, f)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// The files are all there is, so a file written since isn't searched
+	if err := os.WriteFile(filepath.Join(root, "c.go"), []byte("package a\n\nvar y = MaxUsers\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		langs []patterns.Language
+		want  []string
+	}{
+		{want: []string{"a.go:3", "b.py:1"}},
+		{langs: []patterns.Language{patterns.Python}, want: []string{"b.py:1"}},
+	}
+	for _, tt := range tests {
+		opts := Options{Files: files, Walk: walk.Options{Root: root, Languages: tt.langs}}
+		found, stats, err := Find(context.Background(), "MaxUsers", opts)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		var got []string
+		for _, r := range found {
+			got = append(got, fmt.Sprintf("%s:%d", r.Path, r.Line))
+		}
+		if !slices.Equal(got, tt.want) || stats.Files != len(tt.want) {
+			t.Errorf("Find(%v) = %v in %d files, want %v", tt.langs, got, stats.Files, tt.want)
+		}
+	}
+}
+
+func TestCountByFile(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"a.go":    "package m\n\nfunc Log() {}\n\nfunc f() { Log(); Log() }\n",
+		"b.go":    "package m\n\n// Log is called once here.\nfunc g() { Log() }\n",
+		"none.go": "package m\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		want []FileCount
+		opts Options
+	}{
+		{
+			name: "definitions not counted",
+			want: []FileCount{{File: "a.go", Language: patterns.Go, Count: 2}, {File: "b.go", Language: patterns.Go, Count: 2}},
+		},
+		{
+			name: "code only",
+			opts: Options{SkipComments: true},
+			want: []FileCount{{File: "a.go", Language: patterns.Go, Count: 2}, {File: "b.go", Language: patterns.Go, Count: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Walk = walk.Options{Root: root}
+			got, stats, err := CountByFile(context.Background(), "Log", tt.opts)
+			if err != nil {
+				t.Fatalf("CountByFile: %v", err)
+			}
+			slices.SortFunc(got, func(a, b FileCount) int { return strings.Compare(a.File, b.File) })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CountByFile() = %v, want %v", got, tt.want)
+			}
+			if stats.Files != 3 {
+				t.Errorf("stats.Files = %d, want 3", stats.Files)
+			}
+		})
+	}
+}
+
+func TestFindArchive(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, src := range map[string]string{
+		"v1/log.go":      "package m\n\nfunc Log() {}\n",
+		"v1/log_test.go": "package m\n\nfunc TestLog() { Log() }\n",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "v1.zip")
+	if err := os.WriteFile(archive, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	found, stats, err := Find(context.Background(), "Log", Options{Archive: archive, SkipTests: true})
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	want := []Ref{{
+		Path: archive + "::v1/log.go", Archive: archive, Text: "func Log() {}", Language: patterns.Go,
+		Kind: patterns.RefDefinition, Line: 3, Column: 6, Offset: -1, Definition: true,
+		Source: []byte("package m\n\nfunc Log() {}\n"),
+	}}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("Find() = %+v, want %+v", found, want)
+	}
+	if stats.Files != 2 {
+		t.Errorf("stats.Files = %d, want 2", stats.Files)
+	}
+}
+
+func TestFindTagsStrings(t *testing.T) {
+	root := t.TempDir()
+	src := "def check(n):\n    log(\"MaxUsers exceeded\", MaxUsers)\n"
+	if err := os.WriteFile(filepath.Join(root, "limits.py"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _, err := Find(context.Background(), "MaxUsers", Options{Walk: walk.Options{Root: root}})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	want := []Ref{
+		{Path: "limits.py", Language: patterns.Python, Text: `    log("MaxUsers exceeded", MaxUsers)`, Line: 2, Column: 10, Offset: 14, InString: true, Kind: patterns.RefOther},
+		{Path: "limits.py", Language: patterns.Python, Text: `    log("MaxUsers exceeded", MaxUsers)`, Line: 2, Column: 30, Offset: 14, Kind: patterns.RefOther},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Find() = %+v, want %+v", got, want)
+	}
+}
+
+func TestScanFileCanceled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.go")
+	if err := os.WriteFile(path, []byte(strings.Repeat("x := MaxUsers\n", 3*checkEvery)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	re := regexp.MustCompile(`\bMaxUsers\b`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var got []Ref
+	_, err := scanFile(ctx, walk.File{Path: path, Rel: "big.go", Language: "go"}, re, nil, Options{}, func(r Ref) { got = append(got, r) })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("scanFile() error = %v, want context.Canceled", err)
+	}
+	if len(got) != checkEvery-1 {
+		t.Errorf("scanFile() returned %d refs, want the %d found before the first check", len(got), checkEvery-1)
+	}
+}
+
+// expiringContext reports DeadlineExceeded once Err has been checked more
+// than budget times, simulating a deadline that fires mid-walk.
+type expiringContext struct {
+	context.Context
+	budget atomic.Int64
+}
+
+func (c *expiringContext) Err() error {
+	if c.budget.Add(-1) < 0 {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func TestFindDeadlineMidWalk(t *testing.T) {
+	root := t.TempDir()
+	for i := range 20 {
+		dir := filepath.Join(root, fmt.Sprintf("pkg%02d", i))
+		if err := os.Mkdir(dir, 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("var x = MaxUsers\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := &expiringContext{Context: context.Background()}
+	ctx.budget.Store(15)
+	got, stats, err := Find(ctx, "MaxUsers", Options{Walk: walk.Options{Root: root}, ExpectedFiles: 20})
+
+	var partial *ErrPartial
+	if !errors.As(err, &partial) {
+		t.Fatalf("Find() error = %v, want *ErrPartial", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Find() error = %v, want it to wrap context.DeadlineExceeded", err)
+	}
+	scanned, total := partial.Progress()
+	if scanned == 0 || scanned >= 20 || scanned != stats.Files {
+		t.Errorf("Progress() scanned = %d, want between 1 and 19 and equal to Stats.Files (%d)", scanned, stats.Files)
+	}
+	if total != 20 {
+		t.Errorf("Progress() total = %d, want 20", total)
+	}
+	// Files handed to a worker just as the deadline passed yield nothing
+	if len(got) == 0 || len(got) > scanned {
+		t.Errorf("Find() returned %d refs, want at most one from each of the %d scanned files", len(got), scanned)
+	}
+}
+
+func TestFindMaxResults(t *testing.T) {
+	root := t.TempDir()
+	for i := range 10000 {
+		src := "package p\n"
+		if i < 20 {
+			src += "var x = MaxUsers\n"
+		}
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("f%05d.go", i)), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var reached atomic.Int64
+	opts := Options{Walk: walk.Options{Root: root}, MaxResults: 10, Progress: func(files int) { reached.Store(int64(files)) }}
+	got, stats, err := Find(context.Background(), "MaxUsers", opts)
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if !stats.Limited {
+		t.Error("Stats.Limited = false, want true")
+	}
+	// The walk stops soon after the tenth match, give or take the files
+	// the workers already had
+	if n := reached.Load(); n >= 1000 {
+		t.Errorf("search reached %d of 10000 files, want it to stop near the first 10", n)
+	}
+	if len(got) < 10 {
+		t.Fatalf("Find() returned %d refs, want at least 10", len(got))
+	}
+	for i, r := range got[:10] {
+		if want := fmt.Sprintf("f%05d.go", i); r.Path != want {
+			t.Errorf("ref %d in %s, want %s, as a full search has it", i, r.Path, want)
+		}
+	}
+
+	// Without a limit every file is searched
+	opts.MaxResults = 0
+	got, stats, err = Find(context.Background(), "MaxUsers", opts)
+	if err != nil || stats.Limited || len(got) != 20 || reached.Load() != 10000 {
+		t.Errorf("Find() without a limit = %d refs, Limited %v, reached %d, error %v; want 20 refs from all 10000 files",
+			len(got), stats.Limited, reached.Load(), err)
+	}
+}
+
+func TestFindDecodesEncodings(t *testing.T) {
+	root := t.TempDir()
+	// "# café\nprix = MaxUsers\n" in Latin-1
+	latin1 := []byte("# caf\xe9\nprix = MaxUsers\n")
+	if err := os.WriteFile(filepath.Join(root, "legacy.py"), latin1, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// "MaxUsers = 1\n" in UTF-16LE with a BOM
+	utf16 := []byte{0xFF, 0xFE}
+	for _, r := range "MaxUsers = 1\n" {
+		utf16 = append(utf16, byte(r), 0)
+	}
+	if err := os.WriteFile(filepath.Join(root, "windows.py"), utf16, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _, err := Find(context.Background(), "MaxUsers", Options{Walk: walk.Options{Root: root}})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	want := []Ref{
+		{Path: "legacy.py", Language: patterns.Python, Text: "prix = MaxUsers", Line: 2, Column: 8, Offset: -1, Encoding: "latin-1", Kind: patterns.RefOther},
+		{Path: "windows.py", Language: patterns.Python, Text: "MaxUsers = 1", Line: 1, Column: 1, Offset: -1, Encoding: "utf-16le", Kind: patterns.RefOther},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Find() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFindOffsets(t *testing.T) {
+	files := map[string]string{
+		"bom.py":   "\uFEFFMaxUsers = 1\r\n\r\nprint(MaxUsers)\r\n",
+		"plain.py": "import os\n\nlimit = MaxUsers\n",
+	}
+	root := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, _, err := Find(context.Background(), "MaxUsers", Options{Walk: walk.Options{Root: root}})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Find() = %+v, want 3 references", got)
+	}
+	for _, r := range got {
+		if rest := files[r.Path][r.Offset:]; !strings.HasPrefix(rest, r.Text) {
+			t.Errorf("%s:%d: Offset %d starts at %q, want the line %q", r.Path, r.Line, r.Offset, rest, r.Text)
+		}
+	}
+}
+
+func TestFindLongLines(t *testing.T) {
+	root := t.TempDir()
+	filler := strings.Repeat("a", 100<<10)
+	src := "var x=MaxUsers;" + filler + ";MaxUsers;\nconst y = MaxUsers\n"
+	if err := os.WriteFile(filepath.Join(root, "bundle.min.js"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		wantLines     []int
+		maxLine       int
+		wantTruncated int
+	}{
+		// The second match on line 1 lies past the default 64K cap
+		{name: "default cap", wantLines: []int{1, 2}, wantTruncated: 1},
+		{name: "unlimited", maxLine: -1, wantLines: []int{1, 1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{Walk: walk.Options{Root: root}, MaxLineLength: tt.maxLine}
+			got, stats, err := Find(context.Background(), "MaxUsers", opts)
+			if err != nil {
+				t.Fatalf("Find: %v", err)
+			}
+			var lines []int
+			for _, r := range got {
+				lines = append(lines, r.Line)
+			}
+			if !reflect.DeepEqual(lines, tt.wantLines) {
+				t.Errorf("Find() lines = %v, want %v", lines, tt.wantLines)
+			}
+			if stats.Truncated != tt.wantTruncated {
+				t.Errorf("Truncated = %d, want %d", stats.Truncated, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+// writeCorpus generates a tree of Go files, each with a few references to
+// MaxUsers among filler lines, for benchmarks.
+func writeCorpus(tb testing.TB, dirs, filesPerDir, linesPerFile int) string {
+	tb.Helper()
+	root := tb.TempDir()
+	var body strings.Builder
+	body.WriteString("package corpus\n\n")
+	for i := range linesPerFile {
+		if i%50 == 0 {
+			body.WriteString("\tif n > MaxUsers { return errTooMany } // keep MaxUsers in sync\n")
+			continue
+		}
+		fmt.Fprintf(&body, "\tvalue%d := compute(%d, \"filler text that never matches\")\n", i, i)
+	}
+	for d := range dirs {
+		dir := filepath.Join(root, fmt.Sprintf("pkg%03d", d))
+		if err := os.Mkdir(dir, 0o750); err != nil {
+			tb.Fatal(err)
+		}
+		for f := range filesPerDir {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%03d.go", f)), []byte(body.String()), 0o600); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	return root
+}
+
+// BenchmarkFindJobs measures search throughput by worker count, to guide
+// the automatic default in scan.Workers.
+func BenchmarkFindJobs(b *testing.B) {
+	root := writeCorpus(b, 20, 25, 200)
+	counts := []int{1, 4, runtime.NumCPU()}
+	slices.Sort(counts)
+	for _, jobs := range slices.Compact(counts) {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			opts := Options{Walk: walk.Options{Root: root}, Jobs: jobs}
+			for b.Loop() {
+				if _, _, err := Find(context.Background(), "MaxUsers", opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// scanCorpus generates Go source of at least size bytes for scanFile to
+// search for MaxUsers: code, comments and strings on one line and across
+// several, with a reference, a definition, or a mention in prose every so
+// often.
+func scanCorpus(size int) []byte {
+	var b bytes.Buffer
+	b.WriteString("package corpus\n\n")
+	for i := 0; b.Len() < size; i++ {
+		switch i % 16 {
+		case 0:
+			fmt.Fprintf(&b, "// Handle%d serves the request and logs %q.\n", i, "done")
+		case 1:
+			fmt.Fprintf(&b, "func Handle%d(w http.ResponseWriter, r *http.Request) error {\n", i)
+		case 2:
+			fmt.Fprintf(&b, "\tlog.Printf(\"handling %%s in %%d\", r.URL.Path, %d) /* traced */\n", i)
+		case 3:
+			fmt.Fprintf(&b, "\tif err := store.Save(ctx, user%d); err != nil {\n", i)
+		case 4:
+			b.WriteString("\t\treturn fmt.Errorf(\"saving: %w\", err)\n\t}\n")
+		case 5:
+			switch i % 64 {
+			case 5:
+				b.WriteString("\tif n > MaxUsers { return errTooMany } // MaxUsers caps sign-ups\n")
+			case 21:
+				b.WriteString("\tmsg := \"over MaxUsers\"; _ = msg\n")
+			case 37:
+				b.WriteString("\t/* MaxUsers\n\t   spans lines */\n")
+			case 53:
+				// Longer than the golden test's MaxLineLength, which
+				// clips off the second MaxUsers
+				b.WriteString("\tlimit := clamp(requested, MaxUsers) + headroom(\"seats\") // MaxUsers again\n")
+			default:
+				b.WriteString("\tquery := `SELECT id\n\t\tFROM users`; _ = query\n")
+			}
+		case 6:
+			if i%256 == 6 {
+				fmt.Fprintf(&b, "\treturn nil\n}\n\nconst MaxUsers = %d\n", i)
+				continue
+			}
+			b.WriteString("\treturn nil\n}\n")
+		default:
+			fmt.Fprintf(&b, "\tvalue%d := compute(%d, \"filler text that never matches\")\n", i, i)
+		}
+	}
+	return b.Bytes()
+}
+
+// TestScanFileGolden pins down what scanFile finds in a corpus that mixes
+// its cases, so that work on its speed can't change its results.
+func TestScanFileGolden(t *testing.T) {
+	f := walk.File{Path: "corpus.go", Rel: "corpus.go", Language: patterns.Go, Data: scanCorpus(16 << 10)}
+	re := regexp.MustCompile("MaxUsers")
+	defs := func(name string) patterns.Definitions { return patterns.DefinitionsFor(name, patterns.Go, false) }
+	var got bytes.Buffer
+	_, err := scanFile(context.Background(), f, re, defs, Options{MaxLineLength: 64}, func(r Ref) {
+		fmt.Fprintf(&got, "%d:%d %s comment=%v string=%v definition=%v %s\n", r.Line, r.Column, r.Kind, r.InComment, r.InString, r.Definition, r.Text)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "scan.golden")
+	if *update {
+		if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("scanFile() results differ from %s (run go test -update to accept):\n%s", golden, got.Bytes())
+	}
+}
+
+// TestScanFileAllocs guards against scanFile allocating for each line it
+// reads: only a line with references should cost anything, a copy of its
+// text, beyond the file's own setup.
+func TestScanFileAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector's instrumentation allocates")
+	}
+	data := scanCorpus(256 << 10)
+	lines := bytes.Count(data, []byte("\n"))
+	f := walk.File{Path: "corpus.go", Rel: "corpus.go", Language: patterns.Go, Data: data}
+	re := regexp.MustCompile("MaxUsers")
+	cached := patterns.DefinitionsFor("MaxUsers", patterns.Go, false)
+	defs := func(string) patterns.Definitions { return cached }
+	refLines := make(map[int]bool)
+	if _, err := scanFile(context.Background(), f, re, defs, Options{}, func(r Ref) { refLines[r.Line] = true }); err != nil {
+		t.Fatal(err)
+	}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		if _, err := scanFile(context.Background(), f, re, defs, Options{}, func(Ref) {}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if perLine := (allocs - float64(len(refLines))) / float64(lines); perLine > 0.01 {
+		t.Errorf("scanFile() made %.0f allocations for %d lines, %d with references: %.3f a line besides those; want at most 0.01",
+			allocs, lines, len(refLines), perLine)
+	}
+}
+
+// scanBenchCorpus is BenchmarkScanFile's 100MB of source, generated once.
+var scanBenchCorpus = sync.OnceValue(func() []byte { return scanCorpus(100 << 20) })
+
+// BenchmarkScanFile measures scanFile's throughput and allocations over a
+// large file in memory, without the walk or the disk.
+func BenchmarkScanFile(b *testing.B) {
+	data := scanBenchCorpus()
+	f := walk.File{Path: "corpus.go", Rel: "corpus.go", Language: patterns.Go, Data: data}
+	re := regexp.MustCompile("MaxUsers")
+	cached := patterns.DefinitionsFor("MaxUsers", patterns.Go, false)
+	defs := func(string) patterns.Definitions { return cached }
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := scanFile(context.Background(), f, re, defs, Options{}, func(Ref) {}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
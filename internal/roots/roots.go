@@ -0,0 +1,54 @@
+// Package roots searches several roots at once for commands that merge the
+// results in root order, as searching the roots one after another would.
+package roots
+
+import (
+	"context"
+	"sync"
+)
+
+// Jobs splits workers between the searches of n roots: how many roots are
+// searched at once, and how many files each of those searches scans at a
+// time, so that together they stay within the workers.
+func Jobs(n, workers int) (parallel, jobs int) {
+	parallel = max(1, min(n, workers))
+	return parallel, max(1, workers/parallel)
+}
+
+// Search runs search for each of n roots, starting them in order and as
+// many at once as Jobs allows, passing each its index and its share of the
+// workers, and returns their errors by index. Callers merge the roots in
+// order up to the first error that ends reports true for, as searching them
+// in turn would, so when a root's search ends the merge, the roots after it
+// are canceled, and those not yet started are skipped with the context's
+// error.
+func Search(ctx context.Context, n, workers int, search func(ctx context.Context, i, jobs int) error, ends func(error) bool) []error {
+	parallel, jobs := Jobs(n, workers)
+	errs := make([]error, n)
+	ctxs := make([]context.Context, n)
+	cancels := make([]context.CancelFunc, n)
+	for i := range n {
+		ctxs[i], cancels[i] = context.WithCancel(ctx)
+		defer cancels[i]()
+	}
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i := range n {
+		slots <- struct{}{}
+		if errs[i] = ctxs[i].Err(); errs[i] != nil {
+			<-slots
+			continue
+		}
+		wg.Go(func() {
+			defer func() { <-slots }()
+			errs[i] = search(ctxs[i], i, jobs)
+			if ends(errs[i]) {
+				for _, cancel := range cancels[i+1:] {
+					cancel()
+				}
+			}
+		})
+	}
+	wg.Wait()
+	return errs
+}
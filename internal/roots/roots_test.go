@@ -0,0 +1,114 @@
+package roots
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJobs(t *testing.T) {
+	tests := []struct {
+		roots, workers         int
+		wantParallel, wantJobs int
+	}{
+		{roots: 1, workers: 8, wantParallel: 1, wantJobs: 8},
+		{roots: 3, workers: 8, wantParallel: 3, wantJobs: 2},
+		{roots: 4, workers: 2, wantParallel: 2, wantJobs: 1},
+		{roots: 0, workers: 4, wantParallel: 1, wantJobs: 4},
+	}
+	for _, tt := range tests {
+		parallel, jobs := Jobs(tt.roots, tt.workers)
+		if parallel != tt.wantParallel || jobs != tt.wantJobs {
+			t.Errorf("Jobs(%d, %d) = %d, %d, want %d, %d", tt.roots, tt.workers, parallel, jobs, tt.wantParallel, tt.wantJobs)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	failed := errors.New("failed")
+	notFound := errors.New("not found")
+	ends := func(err error) bool { return err != nil && !errors.Is(err, notFound) }
+	tests := []struct {
+		name    string
+		want    []error
+		fail    int // The root that fails, or -1
+		workers int
+	}{
+		{name: "none fail", fail: -1, workers: 3, want: []error{nil, nil, nil}},
+		// The roots after the failure are canceled, whether running or not
+		// yet started; the ones before it still finish
+		{name: "first fails", fail: 0, workers: 3, want: []error{failed, context.Canceled, context.Canceled}},
+		{name: "middle fails", fail: 1, workers: 3, want: []error{nil, failed, context.Canceled}},
+		{name: "in turn", fail: 0, workers: 1, want: []error{failed, context.Canceled, context.Canceled}},
+		// An error that doesn't end the merge cancels nothing
+		{name: "not found", fail: -1, workers: 3, want: []error{notFound, nil, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := Search(context.Background(), len(tt.want), tt.workers, func(ctx context.Context, i, _ int) error {
+				switch {
+				case i == tt.fail:
+					return failed
+				case tt.want[i] == nil:
+					return nil
+				case tt.want[i] == context.Canceled:
+					// Runs until canceled
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				return tt.want[i]
+			}, ends)
+			if !reflect.DeepEqual(errs, tt.want) {
+				t.Errorf("Search() = %v, want %v", errs, tt.want)
+			}
+		})
+	}
+}
+
+// TestSearch_Order checks that the roots searched at once stay within the
+// workers, each with its share, and that whatever order they finish in,
+// the results land by root, so merging them gives the same order every
+// run.
+func TestSearch_Order(t *testing.T) {
+	const n, workers = 6, 4
+	for range 5 {
+		var mu sync.Mutex
+		var running, most int
+		var finished []int
+		byRoot := make([][]string, n)
+		errs := Search(context.Background(), n, workers, func(ctx context.Context, i, jobs int) error {
+			if jobs != 1 {
+				t.Errorf("root %d got %d jobs, want 1", i, jobs)
+			}
+			mu.Lock()
+			running++
+			most = max(most, running)
+			mu.Unlock()
+			// The later roots finish first
+			time.Sleep(time.Duration(n-i) * time.Millisecond)
+			byRoot[i] = []string{string(rune('a' + i))}
+			mu.Lock()
+			running--
+			finished = append(finished, i)
+			mu.Unlock()
+			return nil
+		}, func(err error) bool { return err != nil })
+
+		var merged []string
+		for i := range byRoot {
+			if errs[i] != nil {
+				t.Fatalf("root %d: %v", i, errs[i])
+			}
+			merged = append(merged, byRoot[i]...)
+		}
+		if want := []string{"a", "b", "c", "d", "e", "f"}; !reflect.DeepEqual(merged, want) {
+			t.Errorf("merged = %q, want %q (finished in order %v)", merged, want, finished)
+		}
+		if most > workers {
+			t.Errorf("%d roots searched at once, want at most %d", most, workers)
+		}
+	}
+}
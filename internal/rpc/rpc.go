@@ -0,0 +1,291 @@
+// Package rpc serves JSON-RPC 2.0 over a stream, such as a process's standard
+// input and output, one message per line.
+//
+// Each request runs in its own goroutine under its own context, which the
+// client can cancel with a $/cancelRequest notification naming the request's
+// id. Handlers can send the client notifications while they run, such as
+// progress reports. Batches aren't supported.
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Version is the JSON-RPC version of every message.
+const Version = "2.0"
+
+// CancelMethod is the notification that cancels a request, with params
+// {"id": <the request's id>}.
+const CancelMethod = "$/cancelRequest"
+
+// Error codes, from the JSON-RPC 2.0 specification, and RequestCancelled,
+// from the Language Server Protocol.
+const (
+	CodeParseError       = -32700
+	CodeInvalidRequest   = -32600
+	CodeMethodNotFound   = -32601
+	CodeInvalidParams    = -32602
+	CodeInternalError    = -32603
+	CodeRequestCancelled = -32800
+)
+
+// Error is a JSON-RPC error. A handler's error that isn't one is reported
+// with CodeInternalError and its message.
+type Error struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf returns an Error with code and a formatted message.
+func Errorf(code int, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Handler answers one method's requests, returning the result to encode as
+// the response's.
+type Handler func(ctx context.Context, req *Request) (any, error)
+
+// Request is a request being handled.
+type Request struct {
+	conn   *conn
+	Method string
+	ID     json.RawMessage // As the client sent it
+	Params json.RawMessage
+}
+
+// Decode unmarshals the request's params into v; see DecodeParams.
+func (r *Request) Decode(v any) error {
+	return DecodeParams(r.Params, v)
+}
+
+// DecodeParams unmarshals params into v, rejecting fields v doesn't have, so
+// a misspelled parameter isn't silently ignored. Missing params leave v as
+// it is. The error is an Error with CodeInvalidParams.
+func DecodeParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return Errorf(CodeInvalidParams, "invalid params: %v", err)
+	}
+	return nil
+}
+
+// Notify sends the client a notification of method with params.
+func (r *Request) Notify(method string, params any) error {
+	return r.conn.write(message{Version: Version, Method: method, Params: params})
+}
+
+// message is any JSON-RPC message, as written.
+type message struct {
+	Params  any             `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// incoming is a message as read, before it's known to be valid.
+type incoming struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	ID      json.RawMessage `json:"id"`
+	Params  json.RawMessage `json:"params"`
+}
+
+// Server answers requests with its handlers.
+type Server struct {
+	// Handlers maps each method to its handler; a request for any other
+	// method gets CodeMethodNotFound. Notifications other than
+	// $/cancelRequest are ignored.
+	Handlers map[string]Handler
+}
+
+// Serve reads messages from r and writes responses and notifications to w
+// until r ends or ctx is done, then waits for the requests still running.
+// Requests are handled concurrently, so responses can come in any order.
+// ctx is the parent of every request's context.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	c := &conn{w: w, running: make(map[string]context.CancelCauseFunc)}
+	defer c.wg.Wait()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					readErr <- err
+				}
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case line, ok := <-lines:
+			if !ok {
+				select {
+				case err := <-readErr:
+					return err
+				default:
+					return nil
+				}
+			}
+			if err := s.dispatch(ctx, c, line); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// dispatch starts handling the message in line, returning only errors
+// writing to the client.
+func (s *Server) dispatch(ctx context.Context, c *conn, line []byte) error {
+	var in incoming
+	if err := json.Unmarshal(line, &in); err != nil {
+		if bytes.HasPrefix(bytes.TrimSpace(line), []byte("[")) {
+			return c.reply(nil, nil, Errorf(CodeInvalidRequest, "batches aren't supported"))
+		}
+		return c.reply(nil, nil, Errorf(CodeParseError, "parse error: %v", err))
+	}
+	if in.Version != Version || in.Method == "" {
+		return c.reply(in.ID, nil, Errorf(CodeInvalidRequest, `invalid request: want "jsonrpc": %q and a method`, Version))
+	}
+	if len(in.ID) == 0 || string(in.ID) == "null" {
+		if in.Method == CancelMethod {
+			var p struct {
+				ID json.RawMessage `json:"id"`
+			}
+			if err := json.Unmarshal(in.Params, &p); err == nil {
+				c.cancel(string(p.ID))
+			}
+		}
+		return nil
+	}
+	handler, ok := s.Handlers[in.Method]
+	if !ok {
+		return c.reply(in.ID, nil, Errorf(CodeMethodNotFound, "method not found: %s", in.Method))
+	}
+
+	reqCtx, cancel := context.WithCancelCause(ctx)
+	if !c.start(string(in.ID), cancel) {
+		cancel(nil)
+		return c.reply(in.ID, nil, Errorf(CodeInvalidRequest, "request id %s is already in use", in.ID))
+	}
+	req := &Request{conn: c, Method: in.Method, ID: in.ID, Params: in.Params}
+	c.wg.Go(func() {
+		result, err := handler(reqCtx, req)
+		c.finish(string(in.ID))
+		// Whatever the handler made of it, the client asked not to have it
+		canceled := errors.Is(context.Cause(reqCtx), errCanceled)
+		cancel(nil)
+		var rpcErr *Error
+		switch {
+		case canceled:
+			rpcErr = Errorf(CodeRequestCancelled, "request canceled")
+		case errors.As(err, &rpcErr):
+		case err != nil:
+			rpcErr = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		if rpcErr != nil {
+			result = nil
+		}
+		// A client that's gone can't be told
+		_ = c.reply(in.ID, result, rpcErr)
+	})
+	return nil
+}
+
+// errCanceled is the cause of a request's context canceled by the client.
+var errCanceled = errors.New("request canceled")
+
+// conn is the state shared by the requests of one Serve.
+type conn struct {
+	w       io.Writer
+	running map[string]context.CancelCauseFunc // By request id
+	wg      sync.WaitGroup
+	mu      sync.Mutex // Guards running
+	writeMu sync.Mutex // Serializes messages
+}
+
+// start records the cancel func of the request with id, reporting false if
+// a request with the same id is still running.
+func (c *conn) start(id string, cancel context.CancelCauseFunc) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.running[id]; ok {
+		return false
+	}
+	c.running[id] = cancel
+	return true
+}
+
+// finish forgets the request with id.
+func (c *conn) finish(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.running, id)
+}
+
+// cancel cancels the request with id, if it's still running.
+func (c *conn) cancel(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cancel, ok := c.running[id]; ok {
+		cancel(errCanceled)
+	}
+}
+
+// reply sends the response to the request with id; a missing id, for a
+// message that couldn't be read, is sent as null.
+func (c *conn) reply(id json.RawMessage, result any, err *Error) error {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	msg := message{Version: Version, ID: id, Error: err, Result: result}
+	if err == nil && result == nil {
+		// A response must have a result or an error
+		msg.Result = json.RawMessage("null")
+	}
+	return c.write(msg)
+}
+
+// write sends msg as one line.
+func (c *conn) write(msg message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,273 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// response is a response as the client reads it.
+type response struct {
+	Error  *Error          `json:"error"`
+	Result json.RawMessage `json:"result"`
+	ID     json.RawMessage `json:"id"`
+}
+
+// notification is a notification as the client reads it.
+type notification struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// client is a small JSON-RPC client over a pair of pipes to a Server, as
+// an editor plugin would write one.
+type client struct {
+	w       io.WriteCloser
+	pending map[string]chan response // By id
+	notes   chan notification
+	done    chan error // Serve's result
+	nextID  int
+	mu      sync.Mutex
+}
+
+// dial starts s on pipes and returns a client talking to it.
+func dial(t *testing.T, s *Server) *client {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{w: inW, pending: make(map[string]chan response), notes: make(chan notification, 100), done: make(chan error, 1)}
+	go func() {
+		c.done <- s.Serve(context.Background(), inR, outW)
+		_ = outW.Close()
+	}()
+	go func() {
+		sc := bufio.NewScanner(outR)
+		for sc.Scan() {
+			var msg struct {
+				response
+				notification
+			}
+			if err := json.Unmarshal(sc.Bytes(), &msg); err != nil {
+				t.Errorf("server wrote %q: %v", sc.Text(), err)
+				continue
+			}
+			if msg.Method != "" {
+				c.notes <- msg.notification
+				continue
+			}
+			c.mu.Lock()
+			ch, ok := c.pending[string(msg.ID)]
+			delete(c.pending, string(msg.ID))
+			c.mu.Unlock()
+			if !ok {
+				t.Errorf("response to unknown id %s", msg.ID)
+				continue
+			}
+			ch <- msg.response
+		}
+	}()
+	t.Cleanup(func() { _ = c.w.Close() })
+	return c
+}
+
+// send writes a raw message.
+func (c *client) send(t *testing.T, msg string) {
+	t.Helper()
+	if _, err := io.WriteString(c.w, msg+"\n"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expect registers for the response with id; the raw id as sent.
+func (c *client) expect(id string) chan response {
+	ch := make(chan response, 1)
+	c.mu.Lock()
+	c.pending[id] = ch
+	c.mu.Unlock()
+	return ch
+}
+
+// start sends a request for method with params and returns its id and the
+// channel its response arrives on.
+func (c *client) start(t *testing.T, method string, params any) (string, chan response) {
+	t.Helper()
+	c.mu.Lock()
+	c.nextID++
+	n := c.nextID
+	c.mu.Unlock()
+	data, err := json.Marshal(map[string]any{"jsonrpc": Version, "id": n, "method": method, "params": params})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := fmt.Sprint(n)
+	ch := c.expect(id)
+	c.send(t, string(data))
+	return id, ch
+}
+
+// call sends a request and waits for its response.
+func (c *client) call(t *testing.T, method string, params any) response {
+	t.Helper()
+	_, ch := c.start(t, method, params)
+	return wait(t, ch)
+}
+
+// cancel asks the server to cancel the request with id.
+func (c *client) cancel(t *testing.T, id string) {
+	t.Helper()
+	c.send(t, fmt.Sprintf(`{"jsonrpc":"2.0","method":%q,"params":{"id":%s}}`, CancelMethod, id))
+}
+
+// wait returns the response on ch, failing after a few seconds.
+func wait(t *testing.T, ch chan response) response {
+	t.Helper()
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("no response")
+		return response{}
+	}
+}
+
+func TestServe(t *testing.T) {
+	s := &Server{Handlers: map[string]Handler{
+		"echo": func(ctx context.Context, req *Request) (any, error) {
+			var p struct {
+				Text string `json:"text"`
+			}
+			if err := req.Decode(&p); err != nil {
+				return nil, err
+			}
+			if err := req.Notify("$/progress", map[string]any{"id": req.ID}); err != nil {
+				return nil, err
+			}
+			return p, nil
+		},
+		"fail": func(ctx context.Context, req *Request) (any, error) {
+			return nil, errors.New("disk on fire")
+		},
+		"none": func(ctx context.Context, req *Request) (any, error) {
+			return nil, nil
+		},
+	}}
+	c := dial(t, s)
+
+	tests := []struct {
+		params  any
+		method  string
+		result  string
+		message string
+		code    int
+	}{
+		{method: "echo", params: map[string]string{"text": "hi"}, result: `{"text":"hi"}`},
+		{method: "none", result: `null`},
+		{method: "echo", params: map[string]string{"txt": "hi"}, code: CodeInvalidParams, message: `invalid params: json: unknown field "txt"`},
+		{method: "fail", code: CodeInternalError, message: "disk on fire"},
+		{method: "nope", code: CodeMethodNotFound, message: "method not found: nope"},
+	}
+	for _, tt := range tests {
+		r := c.call(t, tt.method, tt.params)
+		switch {
+		case tt.code != 0 && (r.Error == nil || r.Error.Code != tt.code || r.Error.Message != tt.message):
+			t.Errorf("%s: error = %+v, want %d %q", tt.method, r.Error, tt.code, tt.message)
+		case tt.code == 0 && (r.Error != nil || string(r.Result) != tt.result):
+			t.Errorf("%s: result = %s, %+v, want %s", tt.method, r.Result, r.Error, tt.result)
+		}
+	}
+
+	// echo's notification names its request
+	select {
+	case n := <-c.notes:
+		if n.Method != "$/progress" || string(n.Params) != `{"id":1}` {
+			t.Errorf("notification = %s %s, want $/progress {\"id\":1}", n.Method, n.Params)
+		}
+	default:
+		t.Error("no notification from echo")
+	}
+
+	// Messages that aren't requests get errors with a null id
+	for msg, code := range map[string]int{
+		`{"jsonrpc": "2.0", "id": 1, "method": `:          CodeParseError,
+		`[{"jsonrpc": "2.0", "id": 1, "method": "echo"}]`: CodeInvalidRequest,
+		`{"id": 1, "method": "echo"}`:                     CodeInvalidRequest,
+	} {
+		id := "null"
+		if code == CodeInvalidRequest && msg[0] == '{' {
+			id = "1"
+		}
+		ch := c.expect(id)
+		c.send(t, msg)
+		if r := wait(t, ch); r.Error == nil || r.Error.Code != code {
+			t.Errorf("%s: error = %+v, want code %d", msg, r.Error, code)
+		}
+	}
+}
+
+func TestServe_Cancel(t *testing.T) {
+	started := make(chan struct{})
+	s := &Server{Handlers: map[string]Handler{
+		"block": func(ctx context.Context, req *Request) (any, error) {
+			close(started)
+			<-ctx.Done()
+			return "partial", nil
+		},
+		"echo": func(ctx context.Context, req *Request) (any, error) {
+			return "echo", nil
+		},
+	}}
+	c := dial(t, s)
+
+	id, blocked := c.start(t, "block", nil)
+	<-started
+	// Other requests are answered while one runs
+	if r := c.call(t, "echo", nil); string(r.Result) != `"echo"` {
+		t.Errorf("echo during block = %s, %+v", r.Result, r.Error)
+	}
+	// A request that isn't running can't be canceled
+	c.cancel(t, "99")
+	c.cancel(t, id)
+	r := wait(t, blocked)
+	if r.Error == nil || r.Error.Code != CodeRequestCancelled || r.Result != nil {
+		t.Errorf("canceled request = %s, %+v, want code %d and no result", r.Result, r.Error, CodeRequestCancelled)
+	}
+	// The id can be used again once the request is done
+	again := c.expect(id)
+	c.send(t, fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"method":"echo"}`, id))
+	if r := wait(t, again); r.Error != nil {
+		t.Errorf("echo with the canceled request's id: %+v", r.Error)
+	}
+}
+
+func TestServe_WaitsAtEOF(t *testing.T) {
+	release := make(chan struct{})
+	s := &Server{Handlers: map[string]Handler{
+		"slow": func(ctx context.Context, req *Request) (any, error) {
+			<-release
+			return "done", nil
+		},
+	}}
+	c := dial(t, s)
+	_, ch := c.start(t, "slow", nil)
+	if err := c.w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-c.done:
+		t.Fatalf("Serve returned %v with a request running", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if r := wait(t, ch); string(r.Result) != `"done"` {
+		t.Errorf("slow = %s, %+v, want \"done\"", r.Result, r.Error)
+	}
+	if err := <-c.done; err != nil {
+		t.Errorf("Serve() = %v, want nil at EOF", err)
+	}
+}
@@ -0,0 +1,193 @@
+package scan
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+)
+
+// How many bytes ReadContext reads at a time: a few kilobytes at first, which
+// usually hold the lines around a match, doubling while the lines run on
+// past them.
+const (
+	contextChunk    = 4 << 10
+	maxContextChunk = 1 << 20
+)
+
+// ReadContext returns up to before lines preceding, and up to after lines
+// following, a line of r, which holds size bytes of UTF-8 or undetected
+// text: the line starts at byte offset start, and its terminator is at or
+// past end, such as where the line's known text ends. Only the bytes around
+// the line are read, not the whole of r. Lines are returned as Lines yields
+// them, each clipped to maxLine bytes as Clip would, so a long line costs
+// reading it but not holding it.
+func ReadContext(r io.ReaderAt, size, start, end int64, before, after, maxLine int) (pre, post []string, err error) {
+	if before > 0 {
+		if pre, err = linesBefore(r, start, before, maxLine); err != nil {
+			return nil, nil, err
+		}
+	}
+	if after > 0 {
+		if post, err = linesAfter(r, size, end, after, maxLine); err != nil {
+			return nil, nil, err
+		}
+	}
+	return pre, post, nil
+}
+
+// partialLine collects the start of a line, up to one byte more than
+// maxLine, so Clip can tell it was longer.
+type partialLine struct {
+	text    []byte
+	size    int // The line's length so far, counting what text leaves out
+	maxLine int
+}
+
+// prepend adds b, which precedes what the line holds so far.
+func (l *partialLine) prepend(b []byte) {
+	l.size += len(b)
+	text := append(bytes.Clone(b), l.text...)
+	if keep := l.maxLine + 1; l.maxLine > 0 && len(text) > keep {
+		text = text[:keep]
+	}
+	l.text = text
+}
+
+// append adds b, which follows what the line holds so far.
+func (l *partialLine) append(b []byte) {
+	l.size += len(b)
+	if keep := l.maxLine + 1; l.maxLine > 0 && len(l.text)+len(b) > keep {
+		b = b[:max(0, keep-len(l.text))]
+	}
+	l.text = append(l.text, b...)
+}
+
+// take returns the line, clipped, and empties l for the next one.
+func (l *partialLine) take() string {
+	line := string(l.text)
+	if l.size == len(l.text) {
+		line = strings.TrimSuffix(line, "\r")
+	}
+	line, _ = Clip(line, l.maxLine)
+	l.text, l.size = l.text[:0], 0
+	return line
+}
+
+// readChunk reads the bytes of r from off to end into buf, growing it as
+// need be. If r ends first, as when the file shrank after its size was
+// taken, it returns the bytes there are with io.ErrUnexpectedEOF.
+func readChunk(r io.ReaderAt, buf []byte, off, end int64) ([]byte, error) {
+	n := int(end - off)
+	if cap(buf) < n {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	read, err := r.ReadAt(buf, off)
+	if read == n {
+		return buf, nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf[:read], err
+}
+
+// linesBefore returns up to n lines ending just before the line starting at
+// off, reading backwards from it.
+func linesBefore(r io.ReaderAt, off int64, n, maxLine int) ([]string, error) {
+	if off == 0 {
+		return nil, nil
+	}
+	// Nothing but a byte order mark precedes the first line
+	if off == int64(len(bomUTF8)) {
+		head, err := readChunk(r, nil, 0, off)
+		if err != nil || bytes.Equal(head, bomUTF8) {
+			return nil, err
+		}
+	}
+	var (
+		lines []string // Nearest first
+		line  = partialLine{maxLine: maxLine}
+		buf   []byte
+		chunk = int64(contextChunk)
+		// The lines end at the terminator of the one before off
+		pos = off - 1
+	)
+	for len(lines) < n {
+		if pos == 0 {
+			// The first line of r, without any byte order mark
+			if bytes.HasPrefix(line.text, bomUTF8) {
+				line.text, line.size = line.text[len(bomUTF8):], line.size-len(bomUTF8)
+			}
+			lines = append(lines, line.take())
+			break
+		}
+		from := max(0, pos-chunk)
+		rest, err := readChunk(r, buf, from, pos)
+		if err != nil {
+			return nil, err
+		}
+		buf = rest
+		for len(lines) < n {
+			i := bytes.LastIndexByte(rest, '\n')
+			line.prepend(rest[i+1:])
+			if i < 0 {
+				break
+			}
+			lines = append(lines, line.take())
+			rest = rest[:i]
+		}
+		pos, chunk = from, min(2*chunk, maxContextChunk)
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines, nil
+}
+
+// linesAfter returns up to n lines following the line whose terminator is at
+// or past off, reading forwards from it.
+func linesAfter(r io.ReaderAt, size, off int64, n, maxLine int) ([]string, error) {
+	var (
+		lines   []string
+		line    = partialLine{maxLine: maxLine}
+		buf     []byte
+		chunk   = int64(contextChunk)
+		pos     = off
+		started bool // Whether the matched line's terminator has been read
+	)
+	for pos < size && len(lines) < n {
+		to := min(size, pos+chunk)
+		rest, err := readChunk(r, buf, pos, to)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// r shrank since size was taken, so it ends with what's left,
+			// its last line now unterminated
+			to, size, err = pos+int64(len(rest)), pos+int64(len(rest)), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf = rest
+		for len(rest) > 0 && len(lines) < n {
+			i := bytes.IndexByte(rest, '\n')
+			if i < 0 {
+				if started {
+					line.append(rest)
+				}
+				break
+			}
+			if started {
+				line.append(rest[:i])
+				lines = append(lines, line.take())
+			}
+			started, rest = true, rest[i+1:]
+		}
+		pos, chunk = to, min(2*chunk, maxContextChunk)
+	}
+	// A last line without a terminator
+	if line.size > 0 && len(lines) < n {
+		lines = append(lines, line.take())
+	}
+	return lines, nil
+}
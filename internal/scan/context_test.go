@@ -0,0 +1,135 @@
+package scan
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	*bytes.Reader
+	read int64
+}
+
+func (r *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.Reader.ReadAt(p, off)
+	r.read += int64(n)
+	return n, err
+}
+
+// lineStarts returns the offset of each line Lines yields from data.
+func lineStarts(data string) []int64 {
+	var starts []int64
+	next := 0
+	if strings.HasPrefix(data, string(bomUTF8)) {
+		next = len(bomUTF8)
+	}
+	for next < len(data) {
+		starts = append(starts, int64(next))
+		end := strings.IndexByte(data[next:], '\n')
+		if end < 0 {
+			break
+		}
+		next += end + 1
+	}
+	return starts
+}
+
+func TestReadContext(t *testing.T) {
+	long := strings.Repeat("x", 3*contextChunk)
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"lf", "a\nb\nc\nd\ne\n"},
+		{"crlf", "a\r\nb\r\n\r\nd\r\n"},
+		{"no trailing newline", "a\nb\nc"},
+		{"bom", "\xef\xbb\xbfa\nb\nc\n"},
+		{"blank lines", "\n\na\n\n\nb\n\n"},
+		{"lines longer than a chunk", long + "\n" + long + "y\nmiddle\n" + long + "z\n" + long},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lines []string
+			for _, line := range Lines([]byte(tt.data)) {
+				lines = append(lines, line)
+			}
+			starts := lineStarts(tt.data)
+			if len(starts) != len(lines) {
+				t.Fatalf("%d line starts for %d lines", len(starts), len(lines))
+			}
+			r := bytes.NewReader([]byte(tt.data))
+			for k, start := range starts {
+				for _, n := range []int{1, 2, 5} {
+					pre, post, err := ReadContext(r, int64(len(tt.data)), start, start+int64(len(lines[k])), n, n, 0)
+					if err != nil {
+						t.Fatalf("ReadContext() error = %v", err)
+					}
+					wantPre, wantPost := lines[max(0, k-n):k], lines[k+1:min(len(lines), k+1+n)]
+					if len(pre) != len(wantPre) || len(pre) > 0 && !reflect.DeepEqual(pre, wantPre) {
+						t.Errorf("line %d: %d lines before = %.40q, want %.40q", k+1, n, pre, wantPre)
+					}
+					if len(post) != len(wantPost) || len(post) > 0 && !reflect.DeepEqual(post, wantPost) {
+						t.Errorf("line %d: %d lines after = %.40q, want %.40q", k+1, n, post, wantPost)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReadContextShrunk(t *testing.T) {
+	// The file held more when its size was taken, and now ends without a
+	// newline partway through a line
+	data := "a\nmatch\nb\nc"
+	pre, post, err := ReadContext(bytes.NewReader([]byte(data)), int64(len(data))+40, 2, 7, 1, 5, 0)
+	if err != nil {
+		t.Fatalf("ReadContext() error = %v", err)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(pre, want) {
+		t.Errorf("before = %q, want %q", pre, want)
+	}
+	if want := []string{"b", "c"}; !reflect.DeepEqual(post, want) {
+		t.Errorf("after = %q, want %q", post, want)
+	}
+}
+
+func TestReadContextClips(t *testing.T) {
+	data := "héllo world\nmatch\néé\n"
+	pre, post, err := ReadContext(bytes.NewReader([]byte(data)), int64(len(data)), 13, 18, 1, 1, 2)
+	if err != nil {
+		t.Fatalf("ReadContext() error = %v", err)
+	}
+	if want := []string{"h"}; !reflect.DeepEqual(pre, want) {
+		t.Errorf("before = %q, want %q", pre, want)
+	}
+	if want := []string{"é"}; !reflect.DeepEqual(post, want) {
+		t.Errorf("after = %q, want %q", post, want)
+	}
+}
+
+func TestReadContextReadsLittle(t *testing.T) {
+	// A 50MB log-like file with the match in the middle
+	var b strings.Builder
+	for i := range 500_000 {
+		fmt.Fprintf(&b, "2024-05-01T12:00:00Z INFO request %09d served in 12ms by worker 7\n", i)
+	}
+	data := b.String()
+	start := int64(strings.Index(data, "request 000250000"))
+	start = int64(strings.LastIndexByte(data[:start], '\n') + 1)
+	r := &countingReader{Reader: bytes.NewReader([]byte(data))}
+
+	pre, post, err := ReadContext(r, int64(len(data)), start, start, 3, 3, DefaultMaxLineLength)
+	if err != nil {
+		t.Fatalf("ReadContext() error = %v", err)
+	}
+	if len(pre) != 3 || !strings.Contains(pre[2], "request 000249999") || len(post) != 3 || !strings.Contains(post[0], "request 000250001") {
+		t.Errorf("ReadContext() = %q, %q, want the 3 lines on either side", pre, post)
+	}
+	if r.read > 4*contextChunk {
+		t.Errorf("read %d bytes of %d, want at most %d", r.read, len(data), 4*contextChunk)
+	}
+}
@@ -0,0 +1,131 @@
+// Package scan reads source files for matching: it detects and decodes
+// their character encoding and splits them into lines.
+package scan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding names a character encoding a file was decoded from.
+type Encoding string
+
+const (
+	UTF8        Encoding = "utf-8"
+	UTF16LE     Encoding = "utf-16le"
+	UTF16BE     Encoding = "utf-16be"
+	Latin1      Encoding = "latin-1"
+	Windows1252 Encoding = "windows-1252"
+	// Unknown means detection failed and the bytes were left as they are.
+	Unknown Encoding = "unknown"
+)
+
+// Byte order marks.
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// Sniff returns the encoding announced by a byte order mark at the start of
+// data, or "" if there isn't one.
+func Sniff(data []byte) Encoding {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return UTF8
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return UTF16LE
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return UTF16BE
+	}
+	return ""
+}
+
+// Decode converts data to UTF-8 and reports the encoding it came from. Byte
+// order marks are removed.
+//
+// UTF-16 is recognized by its byte order mark. Text that isn't valid UTF-8
+// is taken to be Latin-1, or Windows-1252 if it uses that encoding's extra
+// characters. Data that fits none of these is returned unchanged with
+// Unknown, so it's still scanned byte for byte.
+func Decode(data []byte) ([]byte, Encoding) {
+	switch Sniff(data) {
+	case UTF8:
+		return data[len(bomUTF8):], UTF8
+	case UTF16LE:
+		return decodeUTF16(data[len(bomUTF16LE):], binary.LittleEndian), UTF16LE
+	case UTF16BE:
+		return decodeUTF16(data[len(bomUTF16BE):], binary.BigEndian), UTF16BE
+	}
+	if utf8.Valid(data) {
+		return data, UTF8
+	}
+	if out, ok := decodeLatin(data); ok {
+		for _, b := range data {
+			if b >= 0x80 && b <= 0x9F {
+				return out, Windows1252
+			}
+		}
+		return out, Latin1
+	}
+	return data, Unknown
+}
+
+// ReadFile reads the file at path and decodes it to UTF-8.
+func ReadFile(path string) ([]byte, Encoding, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- callers pass paths from the walk or the user
+	if err != nil {
+		return nil, "", err
+	}
+	out, enc := Decode(data)
+	return out, enc, nil
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder) []byte {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(units))
+	for _, r := range utf16.Decode(units) {
+		buf.WriteRune(r)
+	}
+	return buf.Bytes()
+}
+
+// windows1252 maps the bytes 0x80-0x9F that Windows-1252 assigns to
+// printable characters; Latin-1 uses them for control codes. Zero entries
+// are unassigned in both.
+var windows1252 = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+// decodeLatin decodes data as Latin-1, reading 0x80-0x9F as Windows-1252.
+// It fails on bytes neither encoding assigns, and on NULs, which text files
+// don't contain.
+func decodeLatin(data []byte) ([]byte, bool) {
+	var buf bytes.Buffer
+	buf.Grow(len(data) + len(data)/8)
+	for _, b := range data {
+		switch {
+		case b == 0:
+			return nil, false
+		case b < 0x80:
+			buf.WriteByte(b)
+		case b <= 0x9F:
+			r := windows1252[b-0x80]
+			if r == 0 {
+				return nil, false
+			}
+			buf.WriteRune(r)
+		default:
+			buf.WriteRune(rune(b))
+		}
+	}
+	return buf.Bytes(), true
+}
@@ -0,0 +1,60 @@
+package scan
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		file     string
+		wantEnc  Encoding
+		wantText string
+	}{
+		{"latin1.py", Latin1, "# Café inventory, généré"},
+		{"cp1252.py", Windows1252, "# “Smart” quotes — from Windows"},
+		{"utf16le.py", UTF16LE, "def load_config():"},
+		{"utf16be.py", UTF16BE, "def load_config():"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, enc, err := ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			if enc != tt.wantEnc {
+				t.Errorf("encoding = %q, want %q", enc, tt.wantEnc)
+			}
+			if !strings.Contains(string(data), tt.wantText) {
+				t.Errorf("decoded text = %q, want it to contain %q", data, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantEnc Encoding
+		data    []byte
+		want    []byte
+	}{
+		{"utf-8", UTF8, []byte("naïve"), []byte("naïve")},
+		{"latin-1", Latin1, []byte{'n', 'a', 0xEF, 'v', 'e'}, []byte("naïve")},
+		// 0x81 is unassigned in Windows-1252, so the bytes are left alone
+		{"undetectable", Unknown, []byte{'a', 0x81, 'b'}, []byte{'a', 0x81, 'b'}},
+		{"nul", Unknown, []byte{'a', 0xFF, 0}, []byte{'a', 0xFF, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, enc := Decode(tt.data)
+			if !bytes.Equal(got, tt.want) || enc != tt.wantEnc {
+				t.Errorf("Decode(%q) = %q, %q; want %q, %q", tt.data, got, enc, tt.want, tt.wantEnc)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package scan
+
+import (
+	"bytes"
+	"iter"
+	"strings"
+	"unicode/utf8"
+)
+
+// Lines yields the lines of decoded text with their 1-based numbers. Line
+// terminators are removed, including the \r of a CRLF, and so is a UTF-8
+// byte order mark at the start of the text, so anchored patterns match line
+// one and byte columns count from its first real character. A final line
+// without a terminator is still yielded.
+func Lines(data []byte) iter.Seq2[int, string] {
+	return func(yield func(int, string) bool) {
+		rest := string(bytes.TrimPrefix(data, bomUTF8))
+		for n := 1; rest != ""; n++ {
+			var line string
+			line, rest, _ = strings.Cut(rest, "\n")
+			if !yield(n, strings.TrimSuffix(line, "\r")) {
+				return
+			}
+		}
+	}
+}
+
+// DefaultMaxLineLength is how much of a line takes part in matching by
+// default. Minified bundles can put hundreds of kilobytes on one line, and
+// definitions are never that far in.
+const DefaultMaxLineLength = 64 << 10
+
+// Clip shortens line to at most max bytes without splitting a UTF-8
+// character, reporting whether it was shortened. A max of zero or less
+// means no limit.
+func Clip(line string, max int) (string, bool) {
+	if max <= 0 || len(line) <= max {
+		return line, false
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut], true
+}
@@ -0,0 +1,59 @@
+package scan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"lf", "a\nb\n", []string{"a", "b"}},
+		{"crlf", "a\r\nb\r\n", []string{"a", "b"}},
+		{"no trailing newline", "a\nb", []string{"a", "b"}},
+		{"bom", "\xef\xbb\xbffunc main() {}\n", []string{"func main() {}"}},
+		{"blank lines", "a\n\nb\n", []string{"a", "", "b"}},
+		{"lone cr kept mid-line", "a\rb\n", []string{"a\rb"}},
+		{"empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for n, line := range Lines([]byte(tt.data)) {
+				if n != len(got)+1 {
+					t.Fatalf("line number %d, want %d", n, len(got)+1)
+				}
+				got = append(got, line)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines(%q) = %q, want %q", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClip(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    string
+		max     int
+		clipped bool
+	}{
+		{"short", "short", 10, false},
+		{"exactly", "exactly", 7, false},
+		{"longer line", "longer", 6, true},
+		{"héllo", "h", 2, true}, // don't split the two-byte é
+		{"unlimited", "unlimited", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, clipped := Clip(tt.line, tt.max)
+		if got != tt.want || clipped != tt.clipped {
+			t.Errorf("Clip(%q, %d) = %q, %v; want %q, %v", tt.line, tt.max, got, clipped, tt.want, tt.clipped)
+		}
+	}
+}
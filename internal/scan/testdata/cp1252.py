@@ -0,0 +1,3 @@
+# Smart quotes  from Windows
+def quote_style():
+    return "nave"
@@ -0,0 +1,3 @@
+# Caf inventory, gnr
+def prix_cafe(quantite):
+    return "crme"
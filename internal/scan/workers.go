@@ -0,0 +1,17 @@
+package scan
+
+import "runtime"
+
+// MaxAutoWorkers caps the automatic worker count. Scanning is mostly I/O
+// bound, so beyond this point extra workers only contend for the disk.
+const MaxAutoWorkers = 16
+
+// Workers returns how many files to scan concurrently for a requested job
+// count: jobs itself when positive, otherwise GOMAXPROCS capped at
+// MaxAutoWorkers.
+func Workers(jobs int) int {
+	if jobs > 0 {
+		return jobs
+	}
+	return min(runtime.GOMAXPROCS(0), MaxAutoWorkers)
+}
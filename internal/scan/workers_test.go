@@ -0,0 +1,23 @@
+package scan
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestWorkers(t *testing.T) {
+	auto := min(runtime.GOMAXPROCS(0), MaxAutoWorkers)
+	tests := []struct {
+		jobs, want int
+	}{
+		{jobs: 1, want: 1},
+		{jobs: 64, want: 64}, // explicit counts aren't capped
+		{jobs: 0, want: auto},
+		{jobs: -3, want: auto},
+	}
+	for _, tt := range tests {
+		if got := Workers(tt.jobs); got != tt.want {
+			t.Errorf("Workers(%d) = %d, want %d", tt.jobs, got, tt.want)
+		}
+	}
+}
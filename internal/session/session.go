@@ -0,0 +1,46 @@
+// Package session hands pkg/cdx searches the state a long-lived cdx process
+// keeps between them, such as a walk shared by many queries and symbol
+// caches held open, for which the public Query has no place. The process
+// attaches it to the context a search runs under.
+package session
+
+import (
+	"context"
+
+	"github.com/bashhack/cdx/internal/cache"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/walk"
+)
+
+// Root is what a search of one root can reuse. Its zero value reuses
+// nothing.
+type Root struct {
+	// Cache is the root's symbol cache, open for the search to read and
+	// fill; whoever opened it saves it.
+	Cache *cache.Cache
+	// Files are a walk of the root, searched instead of walking it again.
+	Files []walk.File
+}
+
+// State is the state of a process's searches.
+type State struct {
+	// Root returns what a search of root, as given in Query.Roots, can
+	// reuse; nil reuses nothing.
+	Root func(root string) Root
+	// Definitions holds the definition patterns of the symbols searched
+	// for, so every search for one doesn't compile them anew.
+	Definitions *patterns.DefinitionCache
+}
+
+type stateKey struct{}
+
+// With returns a copy of ctx carrying s.
+func With(ctx context.Context, s *State) context.Context {
+	return context.WithValue(ctx, stateKey{}, s)
+}
+
+// From returns the state ctx carries, or nil.
+func From(ctx context.Context) *State {
+	s, _ := ctx.Value(stateKey{}).(*State)
+	return s
+}
@@ -0,0 +1,108 @@
+// Package similar finds the names close to one that wasn't found, for "did
+// you mean" suggestions: the same name in another case or with its words
+// joined differently, as with getUserByID for GetUserByID or get_user for
+// getUser, or one a typo or two away.
+package similar
+
+import (
+	"slices"
+	"strings"
+)
+
+// Limit is how many names a suggestion offers.
+const Limit = 5
+
+// candidate is a name and how far it is from the one asked for.
+type candidate struct {
+	name string
+	// folded is the distance between the folded names, 0 when they differ
+	// only in case and separators; raw the distance as written, which
+	// breaks ties
+	folded, raw int
+}
+
+// Names returns up to limit of candidates close enough to name to be what
+// was meant, closest first. A candidate that differs from name only in case
+// or underscores is closest; otherwise it may be a few edits away, more for
+// a longer name, as Distance counts them after folding both. name itself,
+// and repeats, are left out.
+func Names(name string, candidates []string, limit int) []string {
+	key := fold(name)
+	maxDist := min(max(1, len(key)/4), 3)
+	seen := map[string]bool{name: true}
+	var close []candidate
+	for _, c := range candidates {
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		// Names of very different lengths can't be close, so most are
+		// ruled out without measuring
+		ck := fold(c)
+		if abs(len(ck)-len(key)) > maxDist {
+			continue
+		}
+		if d := Distance(key, ck); d <= maxDist && d < len(key) {
+			close = append(close, candidate{name: c, folded: d, raw: Distance(name, c)})
+		}
+	}
+	slices.SortFunc(close, func(a, b candidate) int {
+		if a.folded != b.folded {
+			return a.folded - b.folded
+		}
+		if a.raw != b.raw {
+			return a.raw - b.raw
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	names := make([]string, 0, min(len(close), limit))
+	for _, c := range close[:min(len(close), limit)] {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// fold lowercases name and drops the underscores and dashes separating its
+// words, so that GetUserByID, getUserById, and get_user_by_id agree.
+func fold(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Distance returns the optimal string alignment distance between a and b:
+// insertions, deletions, substitutions, and adjacent transpositions.
+func Distance(a, b string) int {
+	// prev2, prev, and cur are rows i-2, i-1, and i of the distance matrix
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,53 @@
+package similar
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNames(t *testing.T) {
+	candidates := []string{
+		"GetUserByID", "GetUsersByIDs", "getUser", "get_user", "GetUser", "SetUser",
+		"DeleteUser", "Parse", "parse", "ParseAll", "main", "Main", "x",
+	}
+	tests := []struct {
+		name  string
+		want  []string
+		limit int
+	}{
+		{name: "getUserByID", limit: 5, want: []string{"GetUserByID", "GetUsersByIDs"}},
+		{name: "get_user", limit: 5, want: []string{"getUser", "GetUser", "SetUser"}},
+		{name: "GetUsr", limit: 5, want: []string{"GetUser", "getUser", "get_user"}},
+		{name: "GetUsr", limit: 2, want: []string{"GetUser", "getUser"}},
+		{name: "Parze", limit: 5, want: []string{"Parse", "parse"}},
+		{name: "mian", limit: 5, want: []string{"main", "Main"}},
+		{name: "y", limit: 5, want: []string{}},
+		{name: "Unrelated", limit: 5, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Names(tt.name, candidates, tt.limit); !slices.Equal(got, tt.want) {
+				t.Errorf("Names(%q, %d) = %q, want %q", tt.name, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"parse", "parse", 0},
+		{"parse", "prase", 1}, // transposition
+		{"parse", "parsed", 1},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("Distance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package symbols
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/scan"
+)
+
+// FillExtents sets the EndLine of each of syms, the definitions extracted
+// from src in lang, in source order, that doesn't already have one.
+//
+// In Go, TypeScript, JavaScript, Rust, C, C++, PHP, Kotlin, Swift, C#, Zig,
+// and Scala, a definition runs to the line where the braces opened after it
+// balance again, counting only braces in code, or ends at its line when a
+// semicolon or, outside Rust, C, C++, PHP, and C#, the end of a line that
+// doesn't continue the header comes first. In Python, a definition runs to
+// the last line indented more than its own, after its header, as does a
+// Scala one whose line ends in = or :. A Ruby def, class, or module runs to
+// the end indented as it is, or ends at its line when it ends there too, as
+// in "def name = value". An Elixir definition whose header ends in do runs
+// to its end too, and any other to the end of its header, and a Lua function
+// to the end indented as it is. A C macro runs to the last line a backslash
+// continues it onto. Where none of these applies, as when the braces never
+// balance, a definition runs until the next definition indented no more than
+// it, less any blank lines and comments in between.
+func FillExtents(syms []Symbol, src []byte, lang patterns.Language) {
+	f := newSourceFile(src, lang)
+	for i := range syms {
+		s := &syms[i]
+		if s.EndLine != 0 || s.Line < 1 || s.Line > len(f.lines) {
+			continue
+		}
+		end := 0
+		switch lang {
+		case patterns.Python:
+			end = f.pythonEnd(s.Line)
+		case patterns.Scala:
+			end = f.scalaEnd(s.Line, nextLine(syms, i))
+		case patterns.Elixir:
+			end = f.elixirEnd(s.Line)
+		case patterns.Lua:
+			end = f.luaEnd(s.Line)
+		case patterns.Ruby:
+			if s.Kind == "const" {
+				end = f.braceEnd(s.Line, nextLine(syms, i), true)
+				break
+			}
+			end = f.rubyEnd(s.Line)
+		case patterns.Go, patterns.TypeScript, patterns.JavaScript, patterns.Rust, patterns.C, patterns.Cpp, patterns.PHP, patterns.Kotlin, patterns.Swift, patterns.CSharp, patterns.Zig:
+			if s.Kind == "macro" {
+				end = f.macroEnd(s.Line)
+				break
+			}
+			// Rust headers often continue onto a where clause, and C, C++,
+			// PHP, and C# bodies often open on the line after
+			end = f.braceEnd(s.Line, nextLine(syms, i), !allman(lang))
+		}
+		if end == 0 {
+			end = f.siblingEnd(syms, i)
+		}
+		s.EndLine = end
+	}
+}
+
+// allman reports whether lang's definitions may have a header that runs on
+// past its line, as a where clause does in Rust, or a brace that opens on
+// the line after, as is common in C, C++, PHP, and C#.
+func allman(lang patterns.Language) bool {
+	switch lang {
+	case patterns.Rust, patterns.C, patterns.Cpp, patterns.PHP, patterns.CSharp:
+		return true
+	}
+	return false
+}
+
+// sourceFile is a file's lines with the lexical context of each.
+type sourceFile struct {
+	lines    []string
+	contexts []patterns.LineContext
+}
+
+func newSourceFile(src []byte, lang patterns.Language) *sourceFile {
+	f := &sourceFile{}
+	lx := patterns.NewLexer(lang)
+	for _, line := range scan.Lines(src) {
+		f.lines = append(f.lines, line)
+		f.contexts = append(f.contexts, lx.Line(line))
+	}
+	return f
+}
+
+// line returns the text of line n, 1-based.
+func (f *sourceFile) line(n int) string {
+	return f.lines[n-1]
+}
+
+// code reports whether the byte at offset in line n is code rather than part
+// of a comment or string.
+func (f *sourceFile) code(n, offset int) bool {
+	return f.contexts[n-1].At(offset) == patterns.Code
+}
+
+// prose reports whether line n is blank, or has nothing but a comment or the
+// inside of a string.
+func (f *sourceFile) prose(n int) bool {
+	line := f.line(n)
+	first := len(line) - len(strings.TrimLeft(line, " \t"))
+	return first == len(line) || !f.code(n, first)
+}
+
+// braceEnd finds where the definition on line start closes its braces. A
+// header without braces may run on to later lines, but not past next, the
+// following definition's line. It returns 0 when the braces never balance
+// or the header never ends.
+func (f *sourceFile) braceEnd(start, next int, newlineEnds bool) int {
+	depth, opened := 0, false
+	for n := start; n <= len(f.lines); n++ {
+		if !opened && next > 0 && n >= next {
+			return 0
+		}
+		line := f.line(n)
+		for j := 0; j < len(line); j++ {
+			if !f.code(n, j) {
+				continue
+			}
+			switch line[j] {
+			case '{':
+				depth++
+				opened = true
+			case '}':
+				depth--
+			case ';':
+				if !opened {
+					return n
+				}
+			}
+		}
+		switch {
+		case opened && depth <= 0:
+			return n
+		case !opened && newlineEnds && !continues(line):
+			return n
+		}
+	}
+	return 0
+}
+
+// macroEnd finds the last line of the C macro defined on line start, which
+// a backslash at the end of a line continues onto the next.
+func (f *sourceFile) macroEnd(start int) int {
+	end := start
+	for end < len(f.lines) && strings.HasSuffix(strings.TrimRight(f.line(end), " \t"), `\`) {
+		end++
+	}
+	return end
+}
+
+// continues reports whether a line leaves its statement open, as a
+// parameter list split across lines does.
+func continues(line string) bool {
+	if i := strings.Index(line, "//"); i >= 0 {
+		line = line[:i]
+	}
+	line = strings.TrimRight(line, " \t")
+	return line == "" || strings.ContainsAny(line[len(line)-1:], "(,[=+-*/&|.:?<>")
+}
+
+// pythonEnd finds the last line of the body of the definition on line
+// start. A header that doesn't end in a colon holds the whole definition, as
+// in "def f(): pass". It returns 0 when the header never ends.
+func (f *sourceFile) pythonEnd(start int) int {
+	header := f.headerEnd(start)
+	if header == 0 {
+		return 0
+	}
+	if !strings.HasSuffix(strings.TrimRight(f.codeOnly(header), " \t"), ":") {
+		return header
+	}
+	return f.bodyEnd(start, header)
+}
+
+// headerEnd finds the line where the header of the definition on line start
+// ends, the first where its brackets balance, or 0 if they never do.
+func (f *sourceFile) headerEnd(start int) int {
+	depth := 0
+	for n := start; n <= len(f.lines); n++ {
+		line := f.line(n)
+		for j := 0; j < len(line); j++ {
+			if !f.code(n, j) {
+				continue
+			}
+			switch line[j] {
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				depth--
+			}
+		}
+		if depth <= 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// bodyEnd finds the last line of the indented body that follows the header
+// of the definition on line start, which ends on line header: the last line
+// indented more than start, or header itself if there's none.
+func (f *sourceFile) bodyEnd(start, header int) int {
+	indent := indentOf(f.line(start))
+	end := header
+	for n := header + 1; n <= len(f.lines); n++ {
+		if f.prose(n) {
+			continue
+		}
+		if indentOf(f.line(n)) <= indent {
+			break
+		}
+		end = n
+	}
+	return end
+}
+
+// scalaEnd finds the last line of the Scala definition on line start. One
+// whose line ends in = or :, as a Scala 3 definition without braces does,
+// runs to the end of its indented body; any other is found as in the brace
+// languages.
+func (f *sourceFile) scalaEnd(start, next int) int {
+	if code := strings.TrimRight(f.codeOnly(start), " \t"); strings.HasSuffix(code, "=") || strings.HasSuffix(code, ":") {
+		return f.bodyEnd(start, start)
+	}
+	return f.braceEnd(start, next, true)
+}
+
+var (
+	// rubyEndLine matches the end that closes a Ruby definition.
+	rubyEndLine = regexp.MustCompile(`^\s*end\b`)
+	// rubyOneLine matches a Ruby definition that ends on its own line, as
+	// in def name = value or def name; end.
+	rubyOneLine = regexp.MustCompile(`^\s*def\s+[^\s(;=]+(?:\s*\([^)]*\))?\s*=[^=]|\bend\s*$`)
+	// elixirDo matches the end of an Elixir definition's header that opens
+	// a do block.
+	elixirDo = regexp.MustCompile(`\bdo\s*$`)
+	// luaOneLine matches a Lua function's line that ends it too.
+	luaOneLine = regexp.MustCompile(`\bend\s*$`)
+)
+
+// rubyEnd finds the end that closes the Ruby definition on line start: the
+// first line after it that's indented no more than it, when that line is an
+// end. It returns 0 when there's no such end.
+func (f *sourceFile) rubyEnd(start int) int {
+	if rubyOneLine.MatchString(f.codeOnly(start)) {
+		return start
+	}
+	return f.closingEnd(start, start)
+}
+
+// elixirEnd finds the last line of the Elixir definition on line start. Its
+// header ends where its brackets balance on a line that doesn't end in a
+// comma. A header ending in do opens a block, which runs to the end
+// indented as the definition is, as in Ruby; any other header, as in
+// "def name, do: value" or a defstruct, holds the whole definition. It
+// returns 0 when the header or the block never ends.
+func (f *sourceFile) elixirEnd(start int) int {
+	header := f.headerEnd(start)
+	for header > 0 && header < len(f.lines) && strings.HasSuffix(strings.TrimRight(f.codeOnly(header), " \t"), ",") {
+		header = f.headerEnd(header + 1)
+	}
+	if header == 0 || !elixirDo.MatchString(f.codeOnly(header)) {
+		return header
+	}
+	return f.closingEnd(start, header)
+}
+
+// luaEnd finds the end that closes the Lua function on line start, indented
+// as it is, after its parameters. A function that ends on the line they
+// close, as in "local function id(x) return x end", ends there. It returns
+// 0 when the parameters or the function never end.
+func (f *sourceFile) luaEnd(start int) int {
+	header := f.headerEnd(start)
+	if header == 0 || luaOneLine.MatchString(f.codeOnly(header)) {
+		return header
+	}
+	return f.closingEnd(start, header)
+}
+
+// closingEnd finds the end that closes the definition on line start, whose
+// header ends on line header: the first line after that indented no more
+// than start, when that line is an end. It returns 0 when there's no such
+// end.
+func (f *sourceFile) closingEnd(start, header int) int {
+	indent := indentOf(f.line(start))
+	for n := header + 1; n <= len(f.lines); n++ {
+		if f.prose(n) || indentOf(f.line(n)) > indent {
+			continue
+		}
+		if rubyEndLine.MatchString(f.codeOnly(n)) {
+			return n
+		}
+		return 0
+	}
+	return 0
+}
+
+// codeOnly returns line n without its comments and strings' contents.
+func (f *sourceFile) codeOnly(n int) string {
+	var b strings.Builder
+	line := f.line(n)
+	for j := 0; j < len(line); j++ {
+		if f.code(n, j) {
+			b.WriteByte(line[j])
+		}
+	}
+	return b.String()
+}
+
+// siblingEnd is the fallback extent of syms[i]: up to the next definition
+// indented no more than it, or the end of the file, less any blank lines and
+// comments before that.
+func (f *sourceFile) siblingEnd(syms []Symbol, i int) int {
+	start := syms[i].Line
+	indent := indentOf(f.line(start))
+	end := len(f.lines)
+	for _, s := range syms[i+1:] {
+		if s.Line > start && s.Line <= len(f.lines) && indentOf(f.line(s.Line)) <= indent {
+			end = s.Line - 1
+			break
+		}
+	}
+	for end > start && f.prose(end) {
+		end--
+	}
+	return end
+}
+
+// nextLine returns the line of the first definition after syms[i] that's on
+// a later line, or 0 if there's none.
+func nextLine(syms []Symbol, i int) int {
+	for _, s := range syms[i+1:] {
+		if s.Line > syms[i].Line {
+			return s.Line
+		}
+	}
+	return 0
+}
+
+// indentOf returns the number of spaces and tabs line starts with.
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
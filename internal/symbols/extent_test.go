@@ -0,0 +1,156 @@
+package symbols
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+func TestFillExtents(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // Each definition as name:line-end_line
+		lang patterns.Language
+	}{
+		{
+			name: "go",
+			lang: patterns.Go,
+			src: "package p\n\ntype User struct {\n\tName string `json:\"}\"`\n}\n\n" +
+				"func Load(\n\tid int,\n) (*User, error) {\n\t// }\n\treturn nil, nil\n}\n\ntype ID int\n",
+			want: "User:3-5 Load:7-12 ID:14-14",
+		},
+		{
+			name: "typescript",
+			lang: patterns.TypeScript,
+			src: "export class Cart {\n  total(): number {\n    return `${'}'}`.length;\n  }\n}\n\n" +
+				"export type ID = number;\n\nexport const sum = (xs: { n: number }[]) => {\n  return 0;\n};\n",
+			want: "Cart:1-5 total:2-4 ID:7-7 sum:9-11",
+		},
+		{
+			name: "rust where clause",
+			lang: patterns.Rust,
+			src:  "pub fn find<T>(x: T) -> T\nwhere\n    T: Copy,\n{\n    x\n}\n\npub struct Unit;\n",
+			want: "find:1-6 Unit:8-8",
+		},
+		{
+			name: "c",
+			lang: patterns.C,
+			src: "#include \"user.h\"\n\n#define MAX_USERS 100\n\ntypedef struct {\n    int id;\n} user_t;\n\nstatic int count;\n\n" +
+				"static int next_id(void)\n{\n    return ++count;\n}\n\nuser_t *user_new(void) {\n    user_t *u = malloc(sizeof *u);\n" +
+				"    u->id = next_id();\n    return u;\n}\n\n#define SWAP(a, b) \\\n    do { int t = a; a = b; b = t; } while (0)\n",
+			want: "MAX_USERS:3-3 user_t:7-7 next_id:11-14 user_new:16-20 SWAP:22-23",
+		},
+		{
+			name: "cpp",
+			lang: patterns.Cpp,
+			src: "namespace shapes {\n\nclass Widget {\npublic:\n    void draw() const {\n        paint();\n    }\n    int size() const;\n};\n\n" +
+				"int Widget::size() const\n{\n    return 1;\n}\n\n#define MAX_WIDGETS 100\n\n}  // namespace shapes\n",
+			want: "shapes:1-18 Widget:3-9 draw:5-7 size:11-14 MAX_WIDGETS:16-16",
+		},
+		{
+			name: "ruby",
+			lang: patterns.Ruby,
+			src: "module Shop\n  LIMITS = {\n    items: 100,\n  }\n\n  class Cart\n    def total\n      items.each do |i|\n        puts i\n      end\n    end\n\n" +
+				"    def size = items.size\n\n    def reset; end\n  end\nend\n",
+			want: "Shop:1-17 LIMITS:2-4 Cart:6-16 total:7-11 size:13-13 reset:15-15",
+		},
+		{
+			name: "php",
+			lang: patterns.PHP,
+			src: "<?php\n\nconst LIMIT = 10;\n\nabstract class Cart\n{\n    public function total(): int\n    {\n        return 1;\n    }\n\n" +
+				"    abstract protected function table(): string;\n}\n\nfunction helper() { return 2; }\n",
+			want: "LIMIT:3-3 Cart:5-13 total:7-10 table:12-12 helper:15-15",
+		},
+		{
+			name: "kotlin",
+			lang: patterns.Kotlin,
+			src: "const val LIMIT = 10\n\nclass Cart(val items: List<Int>) {\n    fun total(): Int {\n        return items.sum()\n    }\n\n" +
+				"    fun size() = items.size\n}\n\nfun helper(\n    x: Int,\n) = x\n",
+			want: "LIMIT:1-1 Cart:3-9 total:4-6 size:8-8 helper:11-13",
+		},
+		{
+			name: "swift",
+			lang: patterns.Swift,
+			src: "let limit = 10\n\nprotocol Priced {\n    func price() -> Int\n}\n\nstruct Cart: Priced {\n    init() {}\n\n" +
+				"    func price() -> Int {\n        return 1\n    }\n}\n",
+			want: "limit:1-1 Priced:3-5 price:4-4 Cart:7-13 init:8-8 price:10-12",
+		},
+		{
+			name: "csharp",
+			lang: patterns.CSharp,
+			src: "namespace Shop\n{\n    public class Cart\n    {\n        public const int Limit = 10;\n\n        public string Name { get; set; }\n\n" +
+				"        public int Total(\n            int tax)\n        {\n            return tax;\n        }\n\n        public int Size() => 1;\n    }\n}\n",
+			want: "Cart:3-16 Limit:5-5 Name:7-7 Total:9-13 Size:15-15",
+		},
+		{
+			name: "scala",
+			lang: patterns.Scala,
+			src: "object Users {\n  val limit = 10\n\n  def apply(name: String): User = {\n    User(name)\n  }\n\n  def size: Int = 1\n}\n\n" +
+				"enum Color:\n  case Red, Green\n\ndef main(args: Array[String]): Unit =\n  println(args.length)\n  println(args.head)\n",
+			want: "Users:1-9 limit:2-2 apply:4-6 size:8-8 Color:11-12 main:14-16",
+		},
+		{
+			name: "elixir",
+			lang: patterns.Elixir,
+			src: "defmodule MyApp.Accounts do\n  defstruct name: nil,\n            email: nil\n\n  def list_users do\n    Repo.all(User)\n  end\n\n" +
+				"  def valid?(user), do: user.name != nil\n\n  defp normalize(\n         email\n       ) do\n    String.downcase(email)\n  end\nend\n",
+			want: "Accounts:1-16 defstruct:2-3 list_users:5-7 valid?:9-9 normalize:11-15",
+		},
+		{
+			name: "zig",
+			lang: patterns.Zig,
+			src: "const std = @import(\"std\");\n\npub const Point = struct {\n    x: f32,\n\n    pub fn init(\n        x: f32,\n    ) Point {\n        return .{ .x = x };\n    }\n};\n\n" +
+				"extern fn abs(x: c_int) c_int;\n",
+			want: "std:1-1 Point:3-11 init:6-10 abs:13-13",
+		},
+		{
+			name: "lua",
+			lang: patterns.Lua,
+			src: "local Stack = {}\n\nfunction Stack.new(\n  items\n)\n  return setmetatable({ items = items }, Stack)\nend\n\n" +
+				"function Stack:size() return #self.items end\n\nlocal function trim(s)\n  --[[ Leading and\n  trailing. ]]\n  return (s:gsub(\"^%s+\", \"\"))\nend\n",
+			want: "new:3-7 size:9-9 trim:11-15",
+		},
+		{
+			name: "python",
+			lang: patterns.Python,
+			src: "class Cart:\n    def total(\n        self,\n    ):\n        s = \"\"\"\nnot a dedent\n\"\"\"\n\n        return s\n\n" +
+				"# trailing comment\ndef one(): return 1\n",
+			want: "Cart:1-9 total:2-9 one:12-12",
+		},
+		{
+			name: "unbalanced braces fall back to the next sibling",
+			lang: patterns.Go,
+			src:  "package p\n\nfunc Broken() {\n\tif x {\n\n// Next follows.\nfunc Next() {}\n",
+			want: "Broken:3-4 Next:7-7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			syms, err := Regex{}.Extract([]byte(tt.src), tt.lang)
+			if err != nil {
+				t.Fatal(err)
+			}
+			FillExtents(syms, []byte(tt.src), tt.lang)
+			got := make([]string, 0, len(syms))
+			for _, s := range syms {
+				got = append(got, fmt.Sprintf("%s:%d-%d", s.Name, s.Line, s.EndLine))
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("FillExtents() = %s, want %s", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+}
+
+func TestFillExtentsKeepsKnownEnd(t *testing.T) {
+	// As from tree-sitter, which knows better than brace counting
+	syms := []Symbol{{Name: "f", Kind: "function", Line: 1, EndLine: 3}}
+	FillExtents(syms, []byte("func f() {\n}\n\n"), patterns.Go)
+	if syms[0].EndLine != 3 {
+		t.Errorf("EndLine = %d, want 3", syms[0].EndLine)
+	}
+}
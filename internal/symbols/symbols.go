@@ -0,0 +1,194 @@
+// Package symbols extracts definitions from source files.
+//
+// The default extractor applies the regex registry from internal/patterns one
+// line at a time. Builds with the treesitter tag add a tree-sitter extractor
+// that parses the bundled grammars and reports precise names, kinds, ranges,
+// and parent scopes, falling back to the regex extractor for languages it
+// doesn't bundle.
+package symbols
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/scan"
+)
+
+// Parser names accepted by the backend_parser setting.
+const (
+	ParserRegex      = "regex"
+	ParserTreeSitter = "tree-sitter"
+)
+
+// Symbol is a definition found in a source file.
+type Symbol struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Parent  string `json:"parent,omitempty"`   // Enclosing type or class, when known
+	Line    int    `json:"line"`               // 1-based line of the definition
+	Column  int    `json:"column"`             // 1-based byte column of the name
+	EndLine int    `json:"end_line,omitempty"` // Last line of the definition, when known
+}
+
+// Extractor finds the definitions in a source file.
+type Extractor interface {
+	// Name returns the parser name the extractor is registered under.
+	Name() string
+	// Extract returns the definitions in src, which is written in lang, in
+	// source order.
+	Extract(src []byte, lang patterns.Language) ([]Symbol, error)
+}
+
+// extractors holds the available extractors by parser name.
+var extractors = map[string]Extractor{
+	ParserRegex: Regex{},
+}
+
+// register makes an extractor available; build-tagged files call it from init.
+func register(e Extractor) {
+	extractors[e.Name()] = e
+}
+
+// ForParser returns the extractor for a backend_parser value. An empty name
+// selects the regex extractor.
+func ForParser(name string) (Extractor, error) {
+	if name == "" {
+		name = ParserRegex
+	}
+	if e, ok := extractors[name]; ok {
+		return e, nil
+	}
+	if name == ParserTreeSitter {
+		return nil, fmt.Errorf("backend_parser %q: this cdx was built without tree-sitter support (rebuild with -tags treesitter)", name)
+	}
+	return nil, fmt.Errorf("unknown backend_parser %q (want %s or %s)", name, ParserRegex, ParserTreeSitter)
+}
+
+// Parsers returns the names of the extractors compiled into this build.
+func Parsers() []string {
+	return slices.Sorted(maps.Keys(extractors))
+}
+
+// extExtractor is implemented by extractors whose patterns can depend on a
+// file's extension as well as its language, such as custom patterns limited
+// to certain extensions.
+type extExtractor interface {
+	extractExt(src []byte, lang patterns.Language, ext string) ([]Symbol, error)
+}
+
+// ExtractFile reads path, decoding it to UTF-8, and extracts its definitions
+// with e.
+func ExtractFile(e Extractor, path string, lang patterns.Language) ([]Symbol, error) {
+	src, _, err := scan.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ExtractSource(e, src, lang, filepath.Ext(path))
+}
+
+// ExtractSource extracts the definitions in src, a file already read and
+// decoded to UTF-8, with e. ext is the file's extension, which selects any
+// patterns limited to certain extensions.
+func ExtractSource(e Extractor, src []byte, lang patterns.Language, ext string) ([]Symbol, error) {
+	if x, ok := e.(extExtractor); ok {
+		return x.extractExt(src, lang, ext)
+	}
+	return e.Extract(src, lang)
+}
+
+// Enclosing returns the innermost function, method, or type in syms, which
+// must be in source order, that contains line. A definition with a known
+// EndLine contains the lines up to it. Without one, as from the regex
+// extractor, Enclosing takes a function, method, or type defined on line
+// itself, and otherwise scans upward for the nearest definition indented
+// less than line, going by indent, which returns a line's indentation. If
+// that's a const or var, line is part of it and has no enclosing scope.
+func Enclosing(syms []Symbol, line int, indent func(line int) int) (Symbol, bool) {
+	last, _ := slices.BinarySearchFunc(syms, line+1, func(s Symbol, line int) int {
+		return s.Line - line
+	})
+	depth := indent(line)
+	for i := last - 1; i >= 0; i-- {
+		s := syms[i]
+		scope := s.Kind != "const" && s.Kind != "var"
+		if s.EndLine == 0 {
+			switch {
+			case s.Line == line && scope:
+				return s, true
+			case s.Line == line || indent(s.Line) >= depth:
+				continue
+			case scope:
+				return s, true
+			}
+			return Symbol{}, false
+		}
+		if line <= s.EndLine && scope {
+			return s, true
+		}
+	}
+	return Symbol{}, false
+}
+
+// Regex extracts definitions by matching each line against the language's
+// definition patterns, reporting the first pattern that matches a name other
+// than a reserved word.
+type Regex struct{}
+
+// Name implements Extractor.
+func (Regex) Name() string {
+	return ParserRegex
+}
+
+// Extract implements Extractor. Patterns restricted to particular file
+// extensions are skipped, since src has none; ExtractFile applies them.
+func (r Regex) Extract(src []byte, lang patterns.Language) ([]Symbol, error) {
+	return r.extractExt(src, lang, "")
+}
+
+func (Regex) extractExt(src []byte, lang patterns.Language, ext string) ([]Symbol, error) {
+	lp := patterns.ForLanguage(lang)
+	if lp == nil {
+		return nil, fmt.Errorf("unsupported language %q", lang)
+	}
+	defs := lp.DefinitionsFor(ext)
+	blocks := patterns.NewBlocks(lang)
+
+	var found []Symbol
+	// Where the next line starts in src, for a definition that runs on past
+	// its first line; Lines drops a byte order mark
+	next := 0
+	if scan.Sniff(src) == scan.UTF8 {
+		next = len("\uFEFF")
+	}
+	for n, line := range scan.Lines(src) {
+		if next += len(line); next < len(src) && src[next] == '\r' {
+			next++
+		}
+		next++
+		line, _ = scan.Clip(line, scan.DefaultMaxLineLength)
+		block := blocks.Next(line)
+		for _, p := range defs {
+			if p.Block != "" && p.Block != block {
+				continue
+			}
+			loc := p.Regex.FindStringSubmatchIndex(line)
+			if len(loc) < 4 || loc[2] < 0 || slices.Contains(lp.Reserved, line[loc[2]:loc[3]]) {
+				continue
+			}
+			if p.Wrapped && !lp.Unwraps(line[loc[1]:], src[min(next, len(src)):]) {
+				continue
+			}
+			found = append(found, Symbol{
+				Name:   line[loc[2]:loc[3]],
+				Kind:   p.Kind,
+				Line:   n,
+				Column: loc[2] + 1,
+			})
+			break
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,291 @@
+package symbols
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+func TestRegexExtract(t *testing.T) {
+	src := "package user\r\n\r\ntype User struct {\r\n}\r\n\r\nfunc (u *User) Name() string {\r\n\treturn \"\"\r\n}\r\n\r\nfunc NewUser() *User {\r\n\treturn &User{}\r\n}\r\n"
+
+	got, err := Regex{}.Extract([]byte(src), patterns.Go)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	want := []Symbol{
+		{Name: "User", Kind: "type", Line: 3, Column: 6},
+		{Name: "Name", Kind: "method", Line: 6, Column: 16},
+		{Name: "NewUser", Kind: "function", Line: 10, Column: 6},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Extract() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRegexExtractMethods(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		lang patterns.Language
+		want []string // kind name
+	}{
+		{
+			name: "typescript class",
+			lang: patterns.TypeScript,
+			src:  "class Cart {\n  constructor(private items: Item[]) {}\n  async total(): Promise<number> {\n    if (this.items) {\n      return sum(this.items);\n    }\n  }\n}\n",
+			want: []string{"type Cart", "method constructor", "method total"},
+		},
+		{
+			name: "javascript class",
+			lang: patterns.JavaScript,
+			src:  "class Cart {\n  static empty() {\n    for (const x of y) {\n    }\n  }\n}\n",
+			want: []string{"type Cart", "method empty"},
+		},
+		{
+			name: "python class",
+			lang: patterns.Python,
+			src:  "class Cart:\n    @property\n    def total(self):\n        pass\n",
+			want: []string{"type Cart", "method total"},
+		},
+		{
+			name: "rust impl",
+			lang: patterns.Rust,
+			src:  "impl Cart {\n    pub(crate) fn total(&self) -> u32 {\n        0\n    }\n}\n",
+			want: []string{"type Cart", "method total"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := Regex{}.Extract([]byte(tt.src), tt.lang)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, s := range found {
+				got = append(got, s.Kind+" "+s.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Extract() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRegexExtractBlocks checks that the members of const, var, and type
+// blocks are found as such, and that struct fields, interface methods, and
+// composite literal keys, indented alike, aren't.
+func TestRegexExtractBlocks(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("testdata", "structs.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := Regex{}.Extract(src, patterns.Go)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range found {
+		got = append(got, fmt.Sprintf("%d %s %s", s.Line, s.Kind, s.Name))
+	}
+	want := []string{
+		"6 type Server", "19 interface Handler",
+		"25 type Request", "26 type Response", "27 type Options",
+		"33 const DefaultName", "34 const MaxConns", "36 const StatusIdle", "37 const StatusBusy", "38 const statusDone",
+		"42 var Defaults", "45 var Fallback", "46 var mu",
+		"50 type Status", "52 function New",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Extract() = %q, want %q", got, want)
+	}
+}
+
+func TestRegexExtractWrapped(t *testing.T) {
+	src := "export const createOrder = async (\r\n  userId: string,\r\n  items: Item[],\r\n): Promise<Order> => {\r\n  return save(userId, items);\r\n};\r\n\r\n" +
+		"const pair = (\r\n  first,\r\n  second\r\n);\r\n\r\n" +
+		"const total = (\r\n  price + tax\r\n) * 2;\r\n\r\n" +
+		"const last = (\r\n  xs: number[],\r\n) => xs[xs.length - 1]"
+	found, err := Regex{}.Extract([]byte("\uFEFF"+src), patterns.TypeScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Symbol{
+		{Name: "createOrder", Kind: "function", Line: 1, Column: 14},
+		{Name: "last", Kind: "function", Line: 17, Column: 7},
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("Extract() = %+v, want %+v", found, want)
+	}
+}
+
+func TestRegexExtractComponents(t *testing.T) {
+	src := "export const Card = memo(({ title }) => {\n  return <h2>{title}</h2>;\n});\n\nconst Button = styled.button`\n  color: red;\n`;\n"
+	for ext, kind := range map[string]string{".tsx": "component", ".ts": "function"} {
+		found, err := ExtractSource(Regex{}, []byte(src), patterns.TypeScript, ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Symbol{
+			{Name: "Card", Kind: kind, Line: 1, Column: 14},
+			{Name: "Button", Kind: kind, Line: 5, Column: 7},
+		}
+		if !reflect.DeepEqual(found, want) {
+			t.Errorf("ExtractSource(%q) = %+v, want %+v", ext, found, want)
+		}
+	}
+}
+
+func TestRegexExtractUnicode(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		lang patterns.Language
+		want []string // kind name
+	}{
+		{
+			name: "go",
+			lang: patterns.Go,
+			src:  "package maß\n\ntype Größe struct{}\n\nfunc (g Größe) Fläche() int { return 0 }\n\nfunc Größe2() {}\n\nconst Ωmax = 1\n\nvar 数量 = 1\n",
+			want: []string{"type Größe", "method Fläche", "function Größe2", "const Ωmax", "var 数量"},
+		},
+		{
+			name: "python",
+			lang: patterns.Python,
+			src:  "class Café:\n    def prix(self):\n        pass\n\ndef café():\n    pass\n",
+			want: []string{"type Café", "method prix", "function café"},
+		},
+		{
+			name: "javascript",
+			lang: patterns.JavaScript,
+			src:  "function größe() {}\nconst 数量 = () => 1;\nconst $ñ = x => x;\nclass Ärger {}\n",
+			want: []string{"function größe", "function 数量", "function $ñ", "type Ärger"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := Regex{}.Extract([]byte(tt.src), tt.lang)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, s := range found {
+				got = append(got, s.Kind+" "+s.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Extract() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegexExtractUnsupported(t *testing.T) {
+	if _, err := (Regex{}).Extract(nil, patterns.Language("cobol")); err == nil {
+		t.Error("Extract() with unsupported language succeeded")
+	}
+}
+
+func TestEnclosing(t *testing.T) {
+	// Indentation, by line, of the file the regex symbols came from
+	indents := []int{0, 0, 0, 0, 0, 0, 1, 1, 0, 0, 0, 0, 1, 1, 0, 0, 0, 0, 0, 1}
+	regex := []Symbol{
+		{Name: "User", Kind: "type", Line: 3},
+		{Name: "Name", Kind: "method", Parent: "User", Line: 6},
+		{Name: "local", Kind: "const", Line: 7},
+		{Name: "MaxUsers", Kind: "const", Line: 10},
+		{Name: "NewUser", Kind: "function", Line: 12},
+		{Name: "handlers", Kind: "var", Line: 19},
+	}
+	ranged := []Symbol{
+		{Name: "User", Kind: "type", Line: 1, EndLine: 9},
+		{Name: "save", Kind: "method", Parent: "User", Line: 2, EndLine: 4},
+		{Name: "load", Kind: "method", Parent: "User", Line: 6, EndLine: 8},
+		{Name: "LIMIT", Kind: "const", Line: 11, EndLine: 11},
+		{Name: "main", Kind: "function", Line: 13, EndLine: 15},
+	}
+
+	tests := []struct {
+		name string
+		want string // Name of the enclosing symbol, or "" for none
+		syms []Symbol
+		line int
+	}{
+		{name: "before any definition", syms: regex, line: 1},
+		{name: "on a type's line", syms: regex, line: 3, want: "User"},
+		{name: "on a method's line", syms: regex, line: 6, want: "Name"},
+		{name: "in a method, past a nested const", syms: regex, line: 8, want: "Name"},
+		{name: "top level after a method", syms: regex, line: 9},
+		{name: "on a const's line", syms: regex, line: 10},
+		{name: "after a const", syms: regex, line: 11},
+		{name: "in a function", syms: regex, line: 14, want: "NewUser"},
+		{name: "top level after a function", syms: regex, line: 16},
+		{name: "in a var", syms: regex, line: 20},
+		{name: "innermost range", syms: ranged, line: 3, want: "save"},
+		{name: "between methods", syms: ranged, line: 5, want: "User"},
+		{name: "const isn't a scope", syms: ranged, line: 11},
+		{name: "past every range", syms: ranged, line: 17},
+		{name: "in a function range", syms: ranged, line: 14, want: "main"},
+		{name: "no symbols", line: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Enclosing(tt.syms, tt.line, func(line int) int { return indents[line-1] })
+			if ok != (tt.want != "") || got.Name != tt.want {
+				t.Errorf("Enclosing(%d) = %q, %v, want %q", tt.line, got.Name, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestForParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		parser  string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", parser: "", want: ParserRegex},
+		{name: "regex", parser: ParserRegex, want: ParserRegex},
+		{name: "unknown", parser: "ctags", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := ForParser(tt.parser)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ForParser(%q) succeeded", tt.parser)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ForParser(%q): %v", tt.parser, err)
+			}
+			if e.Name() != tt.want {
+				t.Errorf("ForParser(%q).Name() = %q, want %q", tt.parser, e.Name(), tt.want)
+			}
+		})
+	}
+}
+
+func TestForParserTreeSitter(t *testing.T) {
+	e, err := ForParser(ParserTreeSitter)
+	if _, built := extractors[ParserTreeSitter]; !built {
+		if err == nil || !strings.Contains(err.Error(), "-tags treesitter") {
+			t.Errorf("ForParser(%q) error = %v, want rebuild hint", ParserTreeSitter, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("ForParser(%q): %v", ParserTreeSitter, err)
+	}
+	if e.Name() != ParserTreeSitter {
+		t.Errorf("Name() = %q, want %q", e.Name(), ParserTreeSitter)
+	}
+}
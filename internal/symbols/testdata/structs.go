@@ -0,0 +1,59 @@
+package config
+
+import "time"
+
+// Server is configured from a file.
+type Server struct {
+	Name    string
+	Addr    string `json:"addr"`
+	Timeout time.Duration
+	Limits  struct {
+		MaxConns int
+		MaxBody  int64
+	}
+	*Logger
+	Handler
+}
+
+// Handler serves requests.
+type Handler interface {
+	ServeRequest(req *Request) error
+	Name() string
+}
+
+type (
+	Request        struct{ Path string }
+	Response       = Request
+	Options[T any] struct {
+		Value T
+	}
+)
+
+const (
+	DefaultName     = "cdx"
+	MaxConns    int = 64
+
+	StatusIdle Status = iota
+	StatusBusy
+	statusDone
+)
+
+var (
+	Defaults = map[string]string{
+		"Name": DefaultName,
+	}
+	Fallback Server
+	mu       = make(chan struct{}, 1)
+)
+
+// Status is a server's state.
+type Status int
+
+func New(name string) *Server {
+	s := &Server{
+		Name: name,
+		Addr: ":8080",
+	}
+	Defaults = nil
+	return s
+}
@@ -0,0 +1,365 @@
+//go:build treesitter
+
+package symbols
+
+import (
+	"fmt"
+	"strings"
+
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+	tree_sitter_go "github.com/tree-sitter/tree-sitter-go/bindings/go"
+	tree_sitter_javascript "github.com/tree-sitter/tree-sitter-javascript/bindings/go"
+	tree_sitter_python "github.com/tree-sitter/tree-sitter-python/bindings/go"
+	tree_sitter_rust "github.com/tree-sitter/tree-sitter-rust/bindings/go"
+
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+func init() {
+	register(TreeSitter{})
+}
+
+// grammar pairs a tree-sitter language with the walker that turns its syntax
+// tree into symbols.
+type grammar struct {
+	language func() *tree_sitter.Language
+	collect  func(root *tree_sitter.Node, src []byte) []Symbol
+}
+
+// grammars lists the languages with a bundled tree-sitter grammar: Go,
+// Python, JavaScript, and Rust. TypeScript has none yet, so it's left to the
+// regex extractor like every other language.
+var grammars = map[patterns.Language]grammar{
+	patterns.Go: {
+		language: func() *tree_sitter.Language { return tree_sitter.NewLanguage(tree_sitter_go.Language()) },
+		collect:  collectGo,
+	},
+	patterns.Python: {
+		language: func() *tree_sitter.Language { return tree_sitter.NewLanguage(tree_sitter_python.Language()) },
+		collect:  collectPython,
+	},
+	patterns.JavaScript: {
+		language: func() *tree_sitter.Language { return tree_sitter.NewLanguage(tree_sitter_javascript.Language()) },
+		collect:  collectJavaScript,
+	},
+	patterns.Rust: {
+		language: func() *tree_sitter.Language { return tree_sitter.NewLanguage(tree_sitter_rust.Language()) },
+		collect:  collectRust,
+	},
+}
+
+// TreeSitter extracts definitions from a tree-sitter syntax tree. Languages
+// without a bundled grammar are handled by the regex extractor.
+type TreeSitter struct{}
+
+// Name implements Extractor.
+func (TreeSitter) Name() string {
+	return ParserTreeSitter
+}
+
+// Extract implements Extractor.
+func (t TreeSitter) Extract(src []byte, lang patterns.Language) ([]Symbol, error) {
+	return t.extractExt(src, lang, "")
+}
+
+func (TreeSitter) extractExt(src []byte, lang patterns.Language, ext string) ([]Symbol, error) {
+	g, ok := grammars[lang]
+	if !ok {
+		return Regex{}.extractExt(src, lang, ext)
+	}
+
+	parser := tree_sitter.NewParser()
+	defer parser.Close()
+	if err := parser.SetLanguage(g.language()); err != nil {
+		return nil, fmt.Errorf("tree-sitter %s: %w", lang, err)
+	}
+	tree := parser.Parse(src, nil)
+	if tree == nil {
+		return nil, fmt.Errorf("tree-sitter %s: parse failed", lang)
+	}
+	defer tree.Close()
+
+	return g.collect(tree.RootNode(), src), nil
+}
+
+// symbolAt builds a symbol named by name, spanning def.
+func symbolAt(def, name *tree_sitter.Node, src []byte, kind, parent string) Symbol {
+	start := name.StartPosition()
+	return Symbol{
+		Name:    name.Utf8Text(src),
+		Kind:    kind,
+		Parent:  parent,
+		Line:    int(start.Row) + 1,             // #nosec G115 -- rows fit in an int
+		Column:  int(start.Column) + 1,          // #nosec G115 -- columns fit in an int
+		EndLine: int(def.EndPosition().Row) + 1, // #nosec G115 -- rows fit in an int
+	}
+}
+
+// namedChildren returns n's named children.
+func namedChildren(n *tree_sitter.Node) []*tree_sitter.Node {
+	count := n.NamedChildCount()
+	children := make([]*tree_sitter.Node, 0, count)
+	for i := range count {
+		children = append(children, n.NamedChild(i))
+	}
+	return children
+}
+
+// collectGo reports Go's top-level declarations. Function literals and
+// declarations inside function bodies are local and are not reported.
+func collectGo(root *tree_sitter.Node, src []byte) []Symbol {
+	var found []Symbol
+	for _, decl := range namedChildren(root) {
+		switch decl.Kind() {
+		case "function_declaration":
+			if name := decl.ChildByFieldName("name"); name != nil {
+				found = append(found, symbolAt(decl, name, src, "function", ""))
+			}
+		case "method_declaration":
+			if name := decl.ChildByFieldName("name"); name != nil {
+				found = append(found, symbolAt(decl, name, src, "method", goReceiver(decl, src)))
+			}
+		case "type_declaration":
+			for _, spec := range namedChildren(decl) {
+				name := spec.ChildByFieldName("name")
+				if name == nil {
+					continue
+				}
+				kind := "type"
+				if t := spec.ChildByFieldName("type"); t != nil && t.Kind() == "interface_type" {
+					kind = "interface"
+				}
+				found = append(found, symbolAt(spec, name, src, kind, ""))
+			}
+		case "const_declaration":
+			found = append(found, goSpecs(decl, src, "const_spec", "const")...)
+		case "var_declaration":
+			found = append(found, goSpecs(decl, src, "var_spec", "var")...)
+		}
+	}
+	return found
+}
+
+// goSpecs reports every name declared by the specs of a const or var
+// declaration, including grouped and multi-name specs.
+func goSpecs(decl *tree_sitter.Node, src []byte, specKind, kind string) []Symbol {
+	var found []Symbol
+	for _, child := range namedChildren(decl) {
+		if child.Kind() != specKind {
+			// Grouped var declarations wrap their specs in a list node.
+			found = append(found, goSpecs(child, src, specKind, kind)...)
+			continue
+		}
+		cursor := child.Walk()
+		for _, name := range child.ChildrenByFieldName("name", cursor) {
+			if !name.IsNamed() {
+				continue // the commas between names share the field
+			}
+			found = append(found, symbolAt(child, &name, src, kind, ""))
+		}
+		cursor.Close()
+	}
+	return found
+}
+
+// goReceiver returns the base type name of a method's receiver, without
+// pointers or type parameters.
+func goReceiver(method *tree_sitter.Node, src []byte) string {
+	recv := method.ChildByFieldName("receiver")
+	if recv == nil {
+		return ""
+	}
+	for _, param := range namedChildren(recv) {
+		t := param.ChildByFieldName("type")
+		if t == nil {
+			continue
+		}
+		text := strings.TrimLeft(t.Utf8Text(src), "*")
+		if i := strings.IndexByte(text, '['); i >= 0 {
+			text = text[:i]
+		}
+		return text
+	}
+	return ""
+}
+
+// collectPython reports module-level functions and classes, and the methods
+// of those classes. Functions nested in function bodies are not reported.
+func collectPython(root *tree_sitter.Node, src []byte) []Symbol {
+	return pythonBlock(root, src, "")
+}
+
+// pythonBlock reports the definitions directly inside a module or class body.
+func pythonBlock(block *tree_sitter.Node, src []byte, class string) []Symbol {
+	var found []Symbol
+	for _, stmt := range namedChildren(block) {
+		def := stmt
+		if def.Kind() == "decorated_definition" {
+			if def = def.ChildByFieldName("definition"); def == nil {
+				continue
+			}
+		}
+		name := def.ChildByFieldName("name")
+		if name == nil {
+			continue
+		}
+		switch def.Kind() {
+		case "function_definition":
+			kind := "function"
+			if class != "" {
+				kind = "method"
+			}
+			found = append(found, symbolAt(def, name, src, kind, class))
+		case "class_definition":
+			found = append(found, symbolAt(def, name, src, "type", class))
+			if body := def.ChildByFieldName("body"); body != nil {
+				found = append(found, pythonBlock(body, src, name.Utf8Text(src))...)
+			}
+		}
+	}
+	return found
+}
+
+// collectJavaScript reports top-level functions and classes, exported or
+// not, the methods of those classes, and the functions and classes assigned
+// to top-level variables, as in const handler = async (req) => {}.
+// Definitions inside function bodies are not reported.
+func collectJavaScript(root *tree_sitter.Node, src []byte) []Symbol {
+	var found []Symbol
+	for _, stmt := range namedChildren(root) {
+		found = append(found, jsStatement(stmt, src)...)
+	}
+	return found
+}
+
+// jsStatement reports the definitions a top-level statement makes.
+func jsStatement(stmt *tree_sitter.Node, src []byte) []Symbol {
+	switch stmt.Kind() {
+	case "export_statement":
+		if decl := stmt.ChildByFieldName("declaration"); decl != nil {
+			return jsStatement(decl, src)
+		}
+	case "function_declaration", "generator_function_declaration":
+		if name := stmt.ChildByFieldName("name"); name != nil {
+			return []Symbol{symbolAt(stmt, name, src, "function", "")}
+		}
+	case "class_declaration":
+		if name := stmt.ChildByFieldName("name"); name != nil {
+			return jsClass(stmt, name, src)
+		}
+	case "lexical_declaration", "variable_declaration":
+		var found []Symbol
+		for _, decl := range namedChildren(stmt) {
+			name, value := decl.ChildByFieldName("name"), decl.ChildByFieldName("value")
+			if decl.Kind() != "variable_declarator" || name == nil || name.Kind() != "identifier" || value == nil {
+				continue
+			}
+			switch value.Kind() {
+			case "arrow_function", "function_expression", "generator_function":
+				found = append(found, symbolAt(decl, name, src, "function", ""))
+			case "class":
+				found = append(found, jsClass(value, name, src)...)
+			}
+		}
+		return found
+	}
+	return nil
+}
+
+// jsClass reports a class, named by name, and its methods.
+func jsClass(class, name *tree_sitter.Node, src []byte) []Symbol {
+	found := []Symbol{symbolAt(class, name, src, "type", "")}
+	body := class.ChildByFieldName("body")
+	if body == nil {
+		return found
+	}
+	className := name.Utf8Text(src)
+	for _, member := range namedChildren(body) {
+		if member.Kind() != "method_definition" {
+			continue
+		}
+		if method := member.ChildByFieldName("name"); method != nil {
+			found = append(found, symbolAt(member, method, src, "method", className))
+		}
+	}
+	return found
+}
+
+// collectRust reports the items at the top level of a crate or module,
+// including those of inline modules: functions; structs, enums, unions, and
+// type aliases as types; traits as interfaces; consts; and statics as vars.
+// The functions in an impl or trait block are methods of its type or trait.
+// Items inside function bodies are not reported.
+func collectRust(root *tree_sitter.Node, src []byte) []Symbol {
+	var found []Symbol
+	for _, item := range namedChildren(root) {
+		name := item.ChildByFieldName("name")
+		switch item.Kind() {
+		case "function_item":
+			if name != nil {
+				found = append(found, symbolAt(item, name, src, "function", ""))
+			}
+		case "struct_item", "enum_item", "union_item", "type_item":
+			if name != nil {
+				found = append(found, symbolAt(item, name, src, "type", ""))
+			}
+		case "const_item":
+			if name != nil {
+				found = append(found, symbolAt(item, name, src, "const", ""))
+			}
+		case "static_item":
+			if name != nil {
+				found = append(found, symbolAt(item, name, src, "var", ""))
+			}
+		case "trait_item":
+			if name != nil {
+				found = append(found, symbolAt(item, name, src, "interface", ""))
+				found = append(found, rustMethods(item, name.Utf8Text(src), src)...)
+			}
+		case "impl_item":
+			if t := item.ChildByFieldName("type"); t != nil {
+				found = append(found, rustMethods(item, rustTypeName(t, src), src)...)
+			}
+		case "mod_item":
+			if body := item.ChildByFieldName("body"); body != nil {
+				found = append(found, collectRust(body, src)...)
+			}
+		}
+	}
+	return found
+}
+
+// rustMethods reports the functions declared in the body of an impl or
+// trait block as methods of parent.
+func rustMethods(block *tree_sitter.Node, parent string, src []byte) []Symbol {
+	body := block.ChildByFieldName("body")
+	if body == nil {
+		return nil
+	}
+	var found []Symbol
+	for _, item := range namedChildren(body) {
+		if item.Kind() != "function_item" && item.Kind() != "function_signature_item" {
+			continue
+		}
+		if name := item.ChildByFieldName("name"); name != nil {
+			found = append(found, symbolAt(item, name, src, "method", parent))
+		}
+	}
+	return found
+}
+
+// rustTypeName returns the name of the type an impl block is for, without
+// its path or type arguments: Cart for impl<T> shop::Cart<T>.
+func rustTypeName(t *tree_sitter.Node, src []byte) string {
+	switch t.Kind() {
+	case "generic_type":
+		if base := t.ChildByFieldName("type"); base != nil {
+			return rustTypeName(base, src)
+		}
+	case "scoped_type_identifier":
+		if name := t.ChildByFieldName("name"); name != nil {
+			return name.Utf8Text(src)
+		}
+	}
+	return t.Utf8Text(src)
+}
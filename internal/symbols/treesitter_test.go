@@ -0,0 +1,192 @@
+//go:build treesitter
+
+package symbols
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+func TestTreeSitterGo(t *testing.T) {
+	src := `package user
+
+/*
+func Commented() {}
+*/
+
+const MaxUsers, MinUsers = 10, 1
+
+var (
+	ErrMissing = errNew("missing")
+)
+
+type Store interface {
+	Get(id string) *User
+}
+
+type User[T any] struct {
+	ID T
+}
+
+// Name returns the user's name.
+func (u *User[T]) Name() string {
+	helper := func() string {
+		return "nested"
+	}
+	return helper()
+}
+
+func NewUser() *User[string] {
+	return nil
+}
+`
+	got, err := TreeSitter{}.Extract([]byte(src), patterns.Go)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	want := []Symbol{
+		{Name: "MaxUsers", Kind: "const", Line: 7, Column: 7, EndLine: 7},
+		{Name: "MinUsers", Kind: "const", Line: 7, Column: 17, EndLine: 7},
+		{Name: "ErrMissing", Kind: "var", Line: 10, Column: 2, EndLine: 10},
+		{Name: "Store", Kind: "interface", Line: 13, Column: 6, EndLine: 15},
+		{Name: "User", Kind: "type", Line: 17, Column: 6, EndLine: 19},
+		{Name: "Name", Kind: "method", Parent: "User", Line: 22, Column: 19, EndLine: 27},
+		{Name: "NewUser", Kind: "function", Line: 29, Column: 6, EndLine: 31},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Extract() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestTreeSitterPython(t *testing.T) {
+	src := `"""
+def commented():
+    pass
+"""
+
+@dataclass
+class User:
+    def name(self):
+        def inner():
+            pass
+        return inner()
+
+async def fetch_user(user_id):
+    pass
+`
+	got, err := TreeSitter{}.Extract([]byte(src), patterns.Python)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	want := []Symbol{
+		{Name: "User", Kind: "type", Line: 7, Column: 7, EndLine: 11},
+		{Name: "name", Kind: "method", Parent: "User", Line: 8, Column: 9, EndLine: 11},
+		{Name: "fetch_user", Kind: "function", Line: 13, Column: 11, EndLine: 14},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Extract() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestTreeSitterJavaScript(t *testing.T) {
+	src := `/*
+function commented() {}
+*/
+
+export function handleRequest(req) {
+  function inner() {}
+  return inner();
+}
+
+const fetchUser = async (id) => {
+  return id;
+};
+
+let retries = 3;
+
+export default class Cart {
+  static empty() {
+    return new Cart();
+  }
+
+  get total() {
+    return 0;
+  }
+}
+
+function* ids() {}
+`
+	got, err := TreeSitter{}.Extract([]byte(src), patterns.JavaScript)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	want := []Symbol{
+		{Name: "handleRequest", Kind: "function", Line: 5, Column: 17, EndLine: 8},
+		{Name: "fetchUser", Kind: "function", Line: 10, Column: 7, EndLine: 12},
+		{Name: "Cart", Kind: "type", Line: 16, Column: 22, EndLine: 24},
+		{Name: "empty", Kind: "method", Parent: "Cart", Line: 17, Column: 10, EndLine: 19},
+		{Name: "total", Kind: "method", Parent: "Cart", Line: 21, Column: 7, EndLine: 23},
+		{Name: "ids", Kind: "function", Line: 26, Column: 11, EndLine: 26},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Extract() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestTreeSitterRust(t *testing.T) {
+	src := `// fn commented() {}
+
+pub const MAX_ITEMS: usize = 10;
+static mut COUNT: u32 = 0;
+
+pub struct Cart<T> {
+    items: Vec<T>,
+}
+
+pub trait Priced {
+    fn price(&self) -> u32;
+}
+
+impl<T> shop::Cart<T> {
+    pub(crate) fn total(&self) -> u32 {
+        fn helper() {}
+        0
+    }
+}
+
+mod util {
+    pub fn round(x: f64) -> f64 {
+        x
+    }
+}
+`
+	got, err := TreeSitter{}.Extract([]byte(src), patterns.Rust)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	want := []Symbol{
+		{Name: "MAX_ITEMS", Kind: "const", Line: 3, Column: 11, EndLine: 3},
+		{Name: "COUNT", Kind: "var", Line: 4, Column: 12, EndLine: 4},
+		{Name: "Cart", Kind: "type", Line: 6, Column: 12, EndLine: 8},
+		{Name: "Priced", Kind: "interface", Line: 10, Column: 11, EndLine: 12},
+		{Name: "price", Kind: "method", Parent: "Priced", Line: 11, Column: 8, EndLine: 11},
+		{Name: "total", Kind: "method", Parent: "Cart", Line: 15, Column: 19, EndLine: 18},
+		{Name: "round", Kind: "function", Line: 22, Column: 12, EndLine: 24},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Extract() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestTreeSitterFallback(t *testing.T) {
+	src := "export function handleRequest(req: Request) {}\n"
+	got, err := TreeSitter{}.Extract([]byte(src), patterns.TypeScript)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if len(got) != 1 || got[0].Name != "handleRequest" {
+		t.Errorf("Extract() = %+v, want regex fallback to find handleRequest", got)
+	}
+}
@@ -0,0 +1,167 @@
+package tags
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/scan"
+	"github.com/bashhack/cdx/internal/symbols"
+)
+
+// Match is a definition location confirmed against the file on disk.
+type Match struct {
+	Path string // Absolute path of the file
+	Name string
+	Kind string
+	Line int
+	// Verified reports that the file was re-extracted live because the tags
+	// entry was stale
+	Verified bool
+}
+
+// Locate returns the definitions of name recorded in the tags file, checked
+// against the files they point at. An entry whose file changed after the
+// tags file was written, or whose recorded line no longer matches, causes
+// that file to be re-extracted with e instead of returning a wrong location.
+// Stale entries in languages e can't extract are dropped.
+func (f *File) Locate(name string, ignoreCase bool, e symbols.Extractor) ([]Match, error) {
+	var (
+		matches  []Match
+		lines    = make(map[string][]string)
+		redone   = make(map[string]bool)
+		reverify []string
+	)
+	for _, entry := range f.Lookup(name, ignoreCase) {
+		path := f.abs(entry)
+		if redone[path] {
+			continue
+		}
+
+		stale, err := f.stale(path)
+		if err != nil {
+			return nil, err
+		}
+		if !stale {
+			content, ok := lines[path]
+			if !ok {
+				if content, err = readLines(path); err != nil {
+					return nil, err
+				}
+				lines[path] = content
+			}
+			if n := entry.find(content); n > 0 {
+				matches = append(matches, Match{Path: path, Name: entry.Name, Kind: entry.Kind, Line: n})
+				continue
+			}
+		}
+
+		// Trust nothing else the tags file says about this file
+		redone[path] = true
+		reverify = append(reverify, path)
+		kept := matches[:0]
+		for _, m := range matches {
+			if m.Path != path {
+				kept = append(kept, m)
+			}
+		}
+		matches = kept
+	}
+
+	for _, path := range reverify {
+		found, err := extract(path, name, ignoreCase, e)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, found...)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Path != matches[j].Path {
+			return matches[i].Path < matches[j].Path
+		}
+		return matches[i].Line < matches[j].Line
+	})
+	return dedupe(matches), nil
+}
+
+// find returns the line the entry currently describes, or 0 if the file no
+// longer matches it. A recorded line number is checked first; a search
+// pattern is then looked for anywhere in the file, as vi would.
+func (e Entry) find(content []string) int {
+	if e.Line > 0 && e.Line <= len(content) && e.matches(content[e.Line-1]) {
+		return e.Line
+	}
+	if e.Text == "" {
+		return 0
+	}
+	for i, line := range content {
+		if e.matches(line) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// matches reports whether line is the definition line the entry recorded.
+func (e Entry) matches(line string) bool {
+	switch {
+	case e.Text == "":
+		return strings.Contains(line, e.Name)
+	case e.Whole:
+		return line == e.Text
+	default:
+		return strings.HasPrefix(line, e.Text)
+	}
+}
+
+// extract re-extracts the definitions of name from path. Files in languages
+// without definition patterns yield nothing.
+func extract(path, name string, ignoreCase bool, e symbols.Extractor) ([]Match, error) {
+	lang := patterns.DetectFile(path)
+	if patterns.ForLanguage(lang) == nil {
+		return nil, nil
+	}
+	found, err := symbols.ExtractFile(e, path, lang)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Match
+	for _, s := range found {
+		if s.Name == name || ignoreCase && strings.EqualFold(s.Name, name) {
+			matches = append(matches, Match{Path: path, Name: s.Name, Kind: s.Kind, Line: s.Line, Verified: true})
+		}
+	}
+	return matches, nil
+}
+
+// dedupe drops repeated locations from sorted matches; tags files list a
+// definition once per kind it was tagged with.
+func dedupe(matches []Match) []Match {
+	out := matches[:0]
+	for i, m := range matches {
+		if i > 0 && m.Path == matches[i-1].Path && m.Line == matches[i-1].Line {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func readLines(path string) ([]string, error) {
+	data, _, err := scan.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var content []string
+	for _, line := range scan.Lines(data) {
+		content = append(content, line)
+	}
+	return content, nil
+}
@@ -0,0 +1,318 @@
+// Package tags reads ctags and etags tag files so definition lookups can be
+// answered without scanning the tree.
+//
+// Both universal-ctags `tags` files and Emacs `TAGS` files are understood.
+// Entries are never trusted blindly: Locate checks each one against the file
+// it points at and re-extracts definitions from files that changed since the
+// tags file was written.
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names lists the tag file names looked for, in order of preference.
+var Names = []string{"tags", ".tags", "TAGS"}
+
+// Entry is one definition recorded in a tags file.
+type Entry struct {
+	Name string
+	Path string // As written in the tags file, relative to its directory
+	Kind string
+	// Text is the start of the definition's line as recorded by the tags
+	// file's search pattern, or empty when only a line number was recorded
+	Text string
+	Line int // 1-based line number, or 0 when not recorded
+	// Whole reports whether Text is the entire line rather than a prefix
+	Whole bool
+}
+
+// File is a parsed tags file.
+type File struct {
+	ModTime time.Time
+	byName  map[string][]Entry
+	byFold  map[string][]Entry
+	Path    string
+	Dir     string // Directory entry paths are relative to
+}
+
+// Find looks for a tags file in dir and its parents, stopping at the first
+// directory that contains a .git entry. It returns nil and no error when
+// there's no tags file.
+func Find(dir string) (*File, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		for _, name := range Names {
+			path := filepath.Join(dir, name)
+			info, err := os.Stat(path)
+			if err == nil && info.Mode().IsRegular() {
+				return Load(path)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return nil, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// Load reads and parses the tags file at path.
+func Load(path string) (*File, error) {
+	f, err := os.Open(path) // #nosec G304 -- path is a tags file in the searched tree
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := Parse(f)
+	if err != nil {
+		return nil, err
+	}
+
+	tf := &File{
+		Path:    path,
+		Dir:     filepath.Dir(path),
+		ModTime: info.ModTime(),
+		byName:  make(map[string][]Entry),
+		byFold:  make(map[string][]Entry),
+	}
+	for _, e := range entries {
+		tf.byName[e.Name] = append(tf.byName[e.Name], e)
+		fold := strings.ToLower(e.Name)
+		tf.byFold[fold] = append(tf.byFold[fold], e)
+	}
+	return tf, nil
+}
+
+// Lookup returns the entries recorded for name.
+func (f *File) Lookup(name string, ignoreCase bool) []Entry {
+	if ignoreCase {
+		return f.byFold[strings.ToLower(name)]
+	}
+	return f.byName[name]
+}
+
+// Len returns the number of distinct names in the tags file.
+func (f *File) Len() int {
+	return len(f.byName)
+}
+
+// Parse reads tags entries, detecting etags format by its leading form feed.
+func Parse(r io.Reader) ([]Entry, error) {
+	br := bufio.NewReader(r)
+	first, err := br.Peek(1)
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if first[0] == '\f' {
+		return parseEtags(br)
+	}
+	return parseCtags(br)
+}
+
+// parseCtags reads the ctags format: name<TAB>file<TAB>address;"<TAB>fields.
+func parseCtags(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "!_TAG_") {
+			continue
+		}
+		if e, ok := parseCtagsLine(line); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries, sc.Err()
+}
+
+func parseCtagsLine(line string) (Entry, bool) {
+	name, rest, ok := strings.Cut(line, "\t")
+	if !ok {
+		return Entry{}, false
+	}
+	path, address, ok := strings.Cut(rest, "\t")
+	if !ok {
+		return Entry{}, false
+	}
+	e := Entry{Name: name, Path: path}
+
+	// The address is an ex command that may itself contain tabs, so the
+	// extension fields start at the last `;"` marker
+	var fields string
+	if i := strings.LastIndex(address, ";\""); i >= 0 {
+		address, fields = address[:i], address[i+2:]
+	}
+	switch {
+	case len(address) >= 2 && (address[0] == '/' || address[0] == '?'):
+		e.Text, e.Whole = parseSearch(address)
+	default:
+		n, err := strconv.Atoi(address)
+		if err != nil {
+			return Entry{}, false
+		}
+		e.Line = n
+	}
+
+	for f := range strings.SplitSeq(fields, "\t") {
+		switch key, value, hasKey := strings.Cut(f, ":"); {
+		case f == "":
+		case !hasKey:
+			e.Kind = kindName(f)
+		case key == "kind":
+			e.Kind = kindName(value)
+		case key == "line":
+			if n, err := strconv.Atoi(value); err == nil {
+				e.Line = n
+			}
+		}
+	}
+	return e, true
+}
+
+// parseSearch decodes a /^text$/ search command into the text it matches and
+// whether it's anchored at the end of the line.
+func parseSearch(address string) (string, bool) {
+	delim := address[0]
+	body := strings.TrimSuffix(address[1:], string(delim))
+	body = strings.TrimPrefix(body, "^")
+	whole := strings.HasSuffix(body, "$") && !strings.HasSuffix(body, `\$`)
+	if whole {
+		body = body[:len(body)-1]
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] == '\\' && i+1 < len(body) && (body[i+1] == '\\' || body[i+1] == delim) {
+			i++
+		}
+		b.WriteByte(body[i])
+	}
+	return b.String(), whole
+}
+
+// kinds maps the single-letter kinds universal-ctags writes by default to
+// cdx's kind names.
+var kinds = map[string]string{
+	"c": "class",
+	"d": "macro",
+	"e": "enum",
+	"f": "function",
+	"g": "enum",
+	"i": "interface",
+	"m": "method",
+	"s": "struct",
+	"t": "type",
+	"v": "var",
+}
+
+func kindName(k string) string {
+	if long, ok := kinds[k]; ok {
+		return long
+	}
+	return k
+}
+
+// parseEtags reads the Emacs TAGS format: sections introduced by a form feed
+// and a "file,size" header, then one "text\x7fname\x01line,offset" per tag.
+func parseEtags(r *bufio.Reader) ([]Entry, error) {
+	var (
+		entries []Entry
+		path    string
+		header  bool
+	)
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	for line := range bytes.SplitSeq(data, []byte("\n")) {
+		s := strings.TrimSuffix(string(line), "\r")
+		switch {
+		case s == "\f":
+			header = true
+		case header:
+			header = false
+			path, _, _ = strings.Cut(s, ",")
+		case path != "":
+			if e, ok := parseEtagsLine(s, path); ok {
+				entries = append(entries, e)
+			}
+		}
+	}
+	return entries, nil
+}
+
+func parseEtagsLine(s, path string) (Entry, bool) {
+	text, rest, ok := strings.Cut(s, "\x7f")
+	if !ok {
+		return Entry{}, false
+	}
+	name, pos, explicit := strings.Cut(rest, "\x01")
+	if !explicit {
+		name, pos = implicitName(text), rest
+	}
+	lineStr, _, _ := strings.Cut(pos, ",")
+	n, err := strconv.Atoi(lineStr)
+	if err != nil || name == "" {
+		return Entry{}, false
+	}
+	return Entry{Name: name, Path: path, Text: text, Line: n}, true
+}
+
+// implicitName recovers the tag name etags leaves out when it's the last
+// identifier in the recorded text.
+func implicitName(text string) string {
+	text = strings.TrimRightFunc(text, func(r rune) bool { return !isIdent(r) })
+	i := strings.LastIndexFunc(text, func(r rune) bool { return !isIdent(r) })
+	return text[i+1:]
+}
+
+func isIdent(r rune) bool {
+	return r == '_' || r == '$' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+// abs returns the absolute path of an entry's file.
+func (f *File) abs(e Entry) string {
+	p := filepath.FromSlash(e.Path)
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(f.Dir, p)
+}
+
+// stale reports whether the file at path changed after the tags file was
+// written or no longer exists.
+func (f *File) stale(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.ModTime().After(f.ModTime), nil
+}
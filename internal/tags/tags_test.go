@@ -0,0 +1,199 @@
+package tags
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bashhack/cdx/internal/symbols"
+)
+
+func TestParseCtags(t *testing.T) {
+	input := "!_TAG_FILE_FORMAT\t2\t/extended format/\n" +
+		"NewUser\tuser.go\t/^func NewUser() *User {$/;\"\tf\n" +
+		"Path\tpath.go\t/^var Path = \"a\\/b\"$/;\"\tkind:variable\tline:7\n" +
+		"MAX\tlimits.h\t12;\"\td\n" +
+		"broken line\n"
+
+	got, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := []Entry{
+		{Name: "NewUser", Path: "user.go", Kind: "function", Text: "func NewUser() *User {", Whole: true},
+		{Name: "Path", Path: "path.go", Kind: "variable", Text: `var Path = "a/b"`, Line: 7, Whole: true},
+		{Name: "MAX", Path: "limits.h", Kind: "macro", Line: 12},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseEtags(t *testing.T) {
+	input := "\f\nsrc/user.c,60\n" +
+		"struct user \x7fuser\x011,0\n" +
+		"int user_new(\x7f4,30\n" +
+		"\f\nsrc/util.c,20\n" +
+		"#define MAX \x7fMAX\x012,5\n"
+
+	got, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := []Entry{
+		{Name: "user", Path: "src/user.c", Text: "struct user ", Line: 1},
+		{Name: "user_new", Path: "src/user.c", Text: "int user_new(", Line: 4},
+		{Name: "MAX", Path: "src/util.c", Text: "#define MAX ", Line: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestFind(t *testing.T) {
+	repo := t.TempDir()
+	sub := filepath.Join(repo, "pkg", "api")
+	if err := os.MkdirAll(sub, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	tf, err := Find(sub)
+	if err != nil || tf != nil {
+		t.Fatalf("Find() with no tags file = %v, %v; want nil, nil", tf, err)
+	}
+
+	writeFile(t, filepath.Join(repo, "TAGS"), "\f\nmain.c,10\nint main(\x7f1,0\n")
+	tf, err = Find(sub)
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if tf == nil || tf.Dir != repo {
+		t.Fatalf("Find() = %+v, want tags file in %s", tf, repo)
+	}
+	if got := tf.Lookup("main", false); len(got) != 1 {
+		t.Errorf("Lookup(main) = %+v, want one entry", got)
+	}
+}
+
+func TestLookupIgnoreCase(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "tags"), "NewUser\tuser.go\t3;\"\tf\n")
+	tf, err := Load(filepath.Join(dir, "tags"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tf.Lookup("newuser", false); len(got) != 0 {
+		t.Errorf("Lookup(newuser) = %+v, want none", got)
+	}
+	if got := tf.Lookup("newuser", true); len(got) != 1 {
+		t.Errorf("Lookup(newuser, ignoreCase) = %+v, want one entry", got)
+	}
+}
+
+func TestLocate(t *testing.T) {
+	dir := t.TempDir()
+	user := filepath.Join(dir, "user.go")
+	writeFile(t, user, "package user\n\n// comment\nfunc NewUser() *User {\n\treturn nil\n}\n")
+	writeFile(t, filepath.Join(dir, "limits.h"), "#pragma once\n#define MAX 10\n")
+	writeFile(t, filepath.Join(dir, "tags"),
+		"MAX\tlimits.h\t2;\"\td\n"+
+			"NewUser\tuser.go\t/^func NewUser() *User {$/;\"\tf\tline:3\n"+
+			"Gone\tgone.go\t/^func Gone() {$/;\"\tf\n")
+
+	// Make the source files older than the tags file
+	past := time.Now().Add(-time.Hour)
+	for _, name := range []string{"user.go", "limits.h"} {
+		if err := os.Chtimes(filepath.Join(dir, name), past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tf, err := Load(filepath.Join(dir, "tags"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want []Match
+	}{
+		// No parser for C headers here, so only the tags file can answer
+		{"MAX", []Match{{Path: filepath.Join(dir, "limits.h"), Name: "MAX", Kind: "macro", Line: 2}}},
+		// The recorded line drifted, but the search pattern still finds it
+		{"NewUser", []Match{{Path: user, Name: "NewUser", Kind: "function", Line: 4}}},
+		// The file is gone, so nothing is returned
+		{"Gone", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tf.Locate(tt.name, false, symbols.Regex{})
+			if err != nil {
+				t.Fatalf("Locate: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Locate(%q) = %+v, want %+v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocateStale(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "tags"), "NewUser\tuser.go\t/^func NewUser() *User {$/;\"\tf\n")
+
+	tests := []struct {
+		modTime time.Time
+		name    string
+		content string
+		want    int
+	}{
+		{
+			name:    "edited after tags were generated",
+			content: "package user\n\nfunc NewUser() *User {\n}\n",
+			modTime: time.Now().Add(time.Hour),
+			want:    3,
+		},
+		{
+			name:    "definition line no longer matches",
+			content: "package user\n\nfunc NewUser(name string) *User {\n}\n",
+			modTime: time.Now().Add(-time.Hour),
+			want:    3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "user.go")
+			writeFile(t, path, tt.content)
+			if err := os.Chtimes(path, tt.modTime, tt.modTime); err != nil {
+				t.Fatal(err)
+			}
+			tf, err := Load(filepath.Join(dir, "tags"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := tf.Locate("NewUser", false, symbols.Regex{})
+			if err != nil {
+				t.Fatalf("Locate: %v", err)
+			}
+			if len(got) != 1 || got[0].Line != tt.want || !got[0].Verified {
+				t.Errorf("Locate() = %+v, want one re-verified match on line %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,98 @@
+// Package termcolor decides whether output is colored.
+//
+// Every renderer asks Enabled, so the precedence is defined once: a command
+// line flag, then the NO_COLOR and CLICOLOR_FORCE environment conventions,
+// then the color config setting, then whether the output is a terminal.
+package termcolor
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Mode is a color setting.
+type Mode string
+
+// Color modes.
+const (
+	Auto   Mode = "auto"   // Color when writing to a terminal
+	Always Mode = "always" // Color even when piped, e.g. into less -R
+	Never  Mode = "never"
+)
+
+// ParseMode parses a --color or color config value. Empty means Auto.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case "":
+		return Auto, nil
+	case Auto, Always, Never:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid color mode %q (want always, never, or auto)", s)
+	}
+}
+
+// String, Set, and Type make *Mode a pflag.Value, so an invalid --color is
+// rejected while flags are parsed.
+func (m *Mode) String() string { return string(*m) }
+
+// Set parses s into m.
+func (m *Mode) Set(s string) error {
+	mode, err := ParseMode(s)
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// Type names the flag's value in help output.
+func (m *Mode) Type() string { return "when" }
+
+// Enabled reports whether output written to w should be colored, given the
+// mode from the command line (empty when no flag was given) and from config.
+func Enabled(flag, config Mode, w io.Writer) bool {
+	on, _ := Decide(flag, config, os.Getenv, IsTerminal(w))
+	return on
+}
+
+// Decide applies the color precedence and also says which input decided it,
+// for diagnostics:
+//  1. flag, unless it's empty or auto
+//  2. NO_COLOR set to anything (https://no-color.org)
+//  3. CLICOLOR_FORCE set to anything but "0"
+//  4. config, unless it's empty or auto
+//  5. whether the output is a terminal
+func Decide(flag, config Mode, getenv func(string) string, terminal bool) (on bool, reason string) {
+	if flag == Always || flag == Never {
+		return flag == Always, "--color=" + string(flag)
+	}
+	if getenv("NO_COLOR") != "" {
+		return false, "NO_COLOR"
+	}
+	if v := getenv("CLICOLOR_FORCE"); v != "" && v != "0" {
+		return true, "CLICOLOR_FORCE"
+	}
+	if config == Always || config == Never {
+		return config == Always, "color: " + string(config)
+	}
+	if terminal {
+		return true, "terminal"
+	}
+	return false, "not a terminal"
+}
+
+// IsTerminal reports whether w is a terminal. A writer that stands in for
+// one, such as a pager, can say so with an IsTerminal method.
+func IsTerminal(w io.Writer) bool {
+	if t, ok := w.(interface{ IsTerminal() bool }); ok {
+		return t.IsTerminal()
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,78 @@
+package termcolor
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecide(t *testing.T) {
+	tests := []struct {
+		env        map[string]string
+		name       string
+		flag       Mode
+		config     Mode
+		wantReason string
+		terminal   bool
+		want       bool
+	}{
+		{name: "terminal", terminal: true, want: true, wantReason: "terminal"},
+		{name: "pipe", wantReason: "not a terminal"},
+		{name: "auto flag and config defer to terminal", flag: Auto, config: Auto, terminal: true, want: true, wantReason: "terminal"},
+		{name: "flag always beats pipe", flag: Always, want: true, wantReason: "--color=always"},
+		{name: "flag never beats terminal", flag: Never, terminal: true, wantReason: "--color=never"},
+		{name: "flag always beats NO_COLOR", flag: Always, env: map[string]string{"NO_COLOR": "1"}, want: true, wantReason: "--color=always"},
+		{name: "flag never beats CLICOLOR_FORCE", flag: Never, env: map[string]string{"CLICOLOR_FORCE": "1"}, wantReason: "--color=never"},
+		{name: "NO_COLOR beats terminal", env: map[string]string{"NO_COLOR": "1"}, terminal: true, wantReason: "NO_COLOR"},
+		{name: "NO_COLOR beats config", config: Always, env: map[string]string{"NO_COLOR": "1"}, wantReason: "NO_COLOR"},
+		{
+			name:       "NO_COLOR beats CLICOLOR_FORCE",
+			env:        map[string]string{"NO_COLOR": "1", "CLICOLOR_FORCE": "1"},
+			wantReason: "NO_COLOR",
+		},
+		{name: "CLICOLOR_FORCE beats pipe", env: map[string]string{"CLICOLOR_FORCE": "1"}, want: true, wantReason: "CLICOLOR_FORCE"},
+		{name: "CLICOLOR_FORCE beats config", config: Never, env: map[string]string{"CLICOLOR_FORCE": "1"}, want: true, wantReason: "CLICOLOR_FORCE"},
+		{name: "CLICOLOR_FORCE=0 is ignored", env: map[string]string{"CLICOLOR_FORCE": "0"}, wantReason: "not a terminal"},
+		{name: "config always beats pipe", config: Always, want: true, wantReason: "color: always"},
+		{name: "config never beats terminal", config: Never, terminal: true, wantReason: "color: never"},
+		{name: "auto flag defers to config", flag: Auto, config: Always, want: true, wantReason: "color: always"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := Decide(tt.flag, tt.config, func(k string) string { return tt.env[k] }, tt.terminal)
+			if got != tt.want || reason != tt.wantReason {
+				t.Errorf("Decide() = %v, %q, want %v, %q", got, reason, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Mode
+		wantErr bool
+	}{
+		{"", Auto, false},
+		{"auto", Auto, false},
+		{"always", Always, false},
+		{"never", Never, false},
+		{"sometimes", "", true},
+		{"Always", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseMode(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseMode(%q) = %q, %v, want %q (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	if IsTerminal(new(bytes.Buffer)) {
+		t.Error("IsTerminal(buffer) = true, want false")
+	}
+}
@@ -0,0 +1,81 @@
+// Package testfiles tells test files apart from the code they test, for the
+// searches that leave tests out by default or search nothing else.
+//
+// A file is a test by its language's conventions, as patterns.IsTestFile
+// recognizes them by path or, once the file is read, patterns.IsTestSource
+// by its contents, unless a gitignore-style pattern from the test_paths
+// setting says otherwise: a pattern marks the files it matches, and those
+// under the directories it matches, as tests, and a negated one, such as
+// "!src/features/", marks them as code whatever the conventions say.
+package testfiles
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bashhack/cdx/internal/ignore"
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+// Classifier tells test files from the rest.
+type Classifier struct {
+	paths *ignore.Matcher
+}
+
+// New returns a classifier that applies patterns, which follow gitignore
+// syntax relative to the search root, over the language conventions. Errors
+// name source, the setting the patterns came from.
+func New(patterns []string, source string) (*Classifier, error) {
+	rules := make([]ignore.Rule, 0, len(patterns))
+	for _, p := range patterns {
+		rule, err := ignore.CompileRule(p, "", source)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		rules = append(rules, rule)
+	}
+	return &Classifier{paths: ignore.New(rules...)}, nil
+}
+
+// IsTest reports whether rel, a path relative to the search root, is a test
+// file in lang. The pattern matching rel itself decides, or failing that the
+// one matching its nearest directory; with none, the conventions do. A nil
+// Classifier goes by the conventions alone.
+func (c *Classifier) IsTest(rel string, lang patterns.Language) bool {
+	if test, ok := c.match(rel); ok {
+		return test
+	}
+	return patterns.IsTestFile(rel, lang)
+}
+
+// IsTestSource is like IsTest, but the conventions also go by data, the
+// file's contents, which make a Zig file with test blocks a test wherever
+// it lives.
+func (c *Classifier) IsTestSource(rel string, lang patterns.Language, data []byte) bool {
+	if test, ok := c.match(rel); ok {
+		return test
+	}
+	return patterns.IsTestFile(rel, lang) || patterns.IsTestSource(data, lang)
+}
+
+// match reports whether the test_paths pattern that decides rel marks it a
+// test, and whether there is one.
+func (c *Classifier) match(rel string) (test, ok bool) {
+	if c == nil || c.paths.Len() == 0 {
+		return false, false
+	}
+	path := strings.ReplaceAll(rel, `\`, "/")
+	isDir := false
+	for path != "" {
+		// Every rule has a source, so an empty one means none matched
+		if test, source := c.paths.Match(path, isDir); source != "" {
+			return test, true
+		}
+		i := strings.LastIndex(path, "/")
+		if i < 0 {
+			break
+		}
+		path, isDir = path[:i], true
+	}
+	return false, false
+}
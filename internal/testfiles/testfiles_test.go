@@ -0,0 +1,68 @@
+package testfiles
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+func TestClassifier_IsTest(t *testing.T) {
+	c, err := New([]string{"e2e/", "*.fixture.go", "!src/features/", "!src/features/legacy/*_test.go"}, "test_paths")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	tests := []struct {
+		rel  string
+		lang patterns.Language
+		want bool
+	}{
+		{"pkg/user_test.go", patterns.Go, true},
+		{"pkg/user.go", patterns.Go, false},
+		{"e2e/checkout.ts", patterns.TypeScript, true},
+		{`web\e2e\checkout.ts`, patterns.TypeScript, true},
+		{"pkg/users.fixture.go", patterns.Go, true},
+		{"src/features/__tests__/cart.js", patterns.JavaScript, false}, // a pattern outranks the conventions
+		{"src/features/legacy/cart_test.go", patterns.Go, false},
+		{"src/__tests__/cart.js", patterns.JavaScript, true},
+	}
+	for _, tt := range tests {
+		if got := c.IsTest(tt.rel, tt.lang); got != tt.want {
+			t.Errorf("IsTest(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+
+	var none *Classifier
+	if !none.IsTest("src/__tests__/cart.js", patterns.JavaScript) || none.IsTest("src/cart.js", patterns.JavaScript) {
+		t.Error("nil Classifier doesn't follow the conventions")
+	}
+}
+
+func TestClassifier_IsTestSource(t *testing.T) {
+	c, err := New([]string{"!src/"}, "test_paths")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	tests := []struct {
+		rel  string
+		src  string
+		want bool
+	}{
+		{"lib/parse.zig", "pub fn run() void {}\n\ntest \"run\" {\n    run();\n}\n", true},
+		{"lib/parse.zig", "pub fn run() void {}\n", false},
+		{"lib/parse_test.zig", "const std = @import(\"std\");\n", true},
+		{"src/parse.zig", "test \"run\" {}\n", false}, // a pattern outranks the conventions
+	}
+	for _, tt := range tests {
+		if got := c.IsTestSource(tt.rel, patterns.Zig, []byte(tt.src)); got != tt.want {
+			t.Errorf("IsTestSource(%q, %q) = %v, want %v", tt.rel, tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestNew_BadPattern(t *testing.T) {
+	_, err := New([]string{"!"}, "test_paths")
+	if err == nil || !strings.Contains(err.Error(), "test_paths") {
+		t.Errorf("New() error = %v, want one naming test_paths", err)
+	}
+}
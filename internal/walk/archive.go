@@ -0,0 +1,189 @@
+package walk
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bashhack/cdx/internal/ignore"
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+// ArchiveSeparator joins an archive's path and the path of an entry inside
+// it, as in snapshot.tgz::src/main.go.
+const ArchiveSeparator = "::"
+
+// DefaultMaxArchiveSize is how many bytes Archive reads from an archive's
+// entries when Options.MaxArchiveSize is zero.
+const DefaultMaxArchiveSize = 1 << 30
+
+// ErrArchiveTooLarge is returned when the entries of an archive hold more
+// than Options.MaxArchiveSize bytes to search.
+var ErrArchiveTooLarge = errors.New("archive too large")
+
+// Archive is like Walk for the files inside the zip, tar, or gzipped tar
+// archive at path, which it reads without extracting them. It calls fn, in
+// the archive's order, for each entry that the skip list, opts.Exclude,
+// and the language, size, and binary filters let through; ignore files
+// inside the archive aren't read. Each File's Rel is the entry's path, its
+// Path is the archive's path and Rel joined by ArchiveSeparator, and its
+// Data holds the entry's contents. Archives inside the archive are skipped.
+func Archive(ctx context.Context, path string, opts Options, fn func(File) error) (Stats, error) {
+	w := newWalker(ctx, opts, fn)
+	f, err := os.Open(path) // #nosec G304 -- the user names the archive
+	if err != nil {
+		return w.stats, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return w.stats, err
+	}
+
+	a := &archiveWalker{walker: w, path: path, root: ignore.New(opts.Exclude...), skipped: make(map[string]bool)}
+	a.maxSize = opts.MaxArchiveSize
+	if a.maxSize <= 0 {
+		a.maxSize = DefaultMaxArchiveSize
+	}
+	a.left = a.maxSize
+	r := bufio.NewReader(f)
+	magic, _ := r.Peek(262)
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		err = a.zip(f, info.Size())
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(r); err == nil {
+			defer gz.Close()
+			err = a.tar(gz)
+		}
+	case len(magic) == 262 && string(magic[257:262]) == "ustar":
+		err = a.tar(r)
+	default:
+		return w.stats, fmt.Errorf("%s: not a zip, tar, or gzipped tar archive", path)
+	}
+	if err != nil && ctx.Err() == nil {
+		err = fmt.Errorf("%s: %w", path, err)
+	}
+	return w.stats, err
+}
+
+// archiveWalker holds the state of a walk through an archive.
+type archiveWalker struct {
+	*walker
+	root    *ignore.Matcher
+	skipped map[string]bool // Directories seen, and whether they're excluded
+	path    string
+	maxSize int64 // Options.MaxArchiveSize or its default
+	left    int64 // Bytes that can still be read
+}
+
+func (a *archiveWalker) zip(f io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return err
+	}
+	for _, entry := range zr.File {
+		err := a.visitEntry(entry.Name, entry.FileInfo(), func() (io.ReadCloser, error) { return entry.Open() })
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *archiveWalker) tar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = a.visitEntry(hdr.Name, hdr.FileInfo(), func() (io.ReadCloser, error) { return io.NopCloser(tr), nil })
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// visitEntry applies the per-file filters to the entry called name and
+// passes it to the callback if it survives them.
+func (a *archiveWalker) visitEntry(name string, info fs.FileInfo, open func() (io.ReadCloser, error)) error {
+	if err := a.ctx.Err(); err != nil {
+		return err
+	}
+	rel := path.Clean("/" + strings.ReplaceAll(name, `\`, "/"))[1:]
+	if !info.Mode().IsRegular() || rel == "" || a.skipDir(path.Dir(rel)) {
+		return nil
+	}
+	// Nested archives have no language, so they go here too
+	lang := patterns.DetectFile(rel)
+	if lang == patterns.Unknown || (a.langs != nil && !a.langs[lang]) {
+		return nil
+	}
+	if ignored, source := a.root.Match(rel, false); ignored {
+		a.stats.exclude(source)
+		return nil
+	}
+	if a.opts.MaxFileSize > 0 && info.Size() > a.opts.MaxFileSize {
+		a.stats.Oversized = append(a.stats.Oversized, rel)
+		return nil
+	}
+
+	rc, err := open()
+	if err != nil {
+		return fmt.Errorf("%s: %w", rel, err)
+	}
+	defer rc.Close()
+	// The size in the header isn't trusted, so the caps apply to what's read
+	limit := a.left
+	if a.opts.MaxFileSize > 0 {
+		limit = min(limit, a.opts.MaxFileSize)
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return fmt.Errorf("%s: %w", rel, err)
+	}
+	if a.opts.MaxFileSize > 0 && int64(len(data)) > a.opts.MaxFileSize {
+		a.stats.Oversized = append(a.stats.Oversized, rel)
+		return nil
+	}
+	if a.left -= int64(len(data)); a.left < 0 {
+		return fmt.Errorf("%w: more than %d bytes of files to search", ErrArchiveTooLarge, a.maxSize)
+	}
+	if !a.opts.IncludeBinary && IsBinaryData(data) {
+		a.stats.Binary++
+		return nil
+	}
+
+	a.stats.Files++
+	return a.fn(File{Path: a.path + ArchiveSeparator + rel, Rel: rel, Language: lang, Info: info, Data: data})
+}
+
+// skipDir reports whether the archive directory dir, or one above it, is
+// excluded, counting each directory once.
+func (a *archiveWalker) skipDir(dir string) bool {
+	if dir == "." {
+		return false
+	}
+	skip, ok := a.skipped[dir]
+	if !ok {
+		a.stats.Dirs++
+		skip = a.skipDir(path.Dir(dir)) || a.walker.skipDir(path.Base(dir), dir, a.root)
+		a.skipped[dir] = skip
+	}
+	return skip
+}
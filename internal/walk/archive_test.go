@@ -0,0 +1,160 @@
+package walk
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/ignore"
+)
+
+// entry is a file to put in a test archive.
+type entry struct {
+	name, body string
+}
+
+// makeZip writes entries to a zip archive and returns its path.
+func makeZip(t *testing.T, entries []entry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return writeArchive(t, "snapshot.zip", buf.Bytes())
+}
+
+// makeTar writes entries to a tar archive, gzipped if gz is set, and
+// returns its path.
+func makeTar(t *testing.T, entries []entry, gz bool) string {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !gz {
+		return writeArchive(t, "snapshot.tar", buf.Bytes())
+	}
+	var zipped bytes.Buffer
+	zw := gzip.NewWriter(&zipped)
+	if _, err := zw.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return writeArchive(t, "snapshot.tgz", zipped.Bytes())
+}
+
+func writeArchive(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestArchive(t *testing.T) {
+	inner := makeZip(t, []entry{{"lib/inner.go", "package lib\n"}})
+	nested, err := os.ReadFile(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []entry{
+		{"./app/main.go", "package main\n"},
+		{"app/web/app.ts", "export const x = 1\n"},
+		{"app/vendor/dep/dep.go", "package dep\n"},
+		{"app/gen/gen.go", "package gen\n"},
+		{"app/big.go", "package main\n\n" + strings.Repeat("// padding\n", 20)},
+		{"app/blob.go", "package main\x00"},
+		{"app/README.md", "# docs\n"},
+		{"app/lib.zip", string(nested)},
+	}
+	gen, err := ignore.CompileRule("gen/", "", "--exclude")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Exclude: []ignore.Rule{gen}, MaxFileSize: 100}
+
+	archives := map[string]string{
+		"zip":    makeZip(t, entries),
+		"tar":    makeTar(t, entries, false),
+		"tar.gz": makeTar(t, entries, true),
+	}
+	for name, path := range archives {
+		t.Run(name, func(t *testing.T) {
+			var got []string
+			stats, err := Archive(context.Background(), path, opts, func(f File) error {
+				got = append(got, f.Path+" "+string(f.Language)+" "+string(f.Data))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Archive() error = %v", err)
+			}
+			want := []string{
+				path + "::app/main.go go package main\n",
+				path + "::app/web/app.ts ts export const x = 1\n",
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Archive() yielded %q, want %q", got, want)
+			}
+			if stats.Files != 2 || stats.Binary != 1 || !reflect.DeepEqual(stats.Oversized, []string{"app/big.go"}) {
+				t.Errorf("stats = %+v, want 2 files, 1 binary, and app/big.go oversized", stats)
+			}
+			if stats.Excluded[SourceBuiltin] != 1 || stats.Excluded["--exclude"] != 1 {
+				t.Errorf("Excluded = %v, want vendor/ and gen/ excluded", stats.Excluded)
+			}
+		})
+	}
+}
+
+func TestArchive_Errors(t *testing.T) {
+	notArchive := writeArchive(t, "notes.zip", []byte("just text"))
+	if _, err := Archive(context.Background(), notArchive, Options{}, func(File) error { return nil }); err == nil ||
+		!strings.Contains(err.Error(), "not a zip, tar, or gzipped tar archive") {
+		t.Errorf("Archive(text file) error = %v, want it rejected", err)
+	}
+
+	big := makeTar(t, []entry{{"a.go", "package a\n"}, {"b.go", "package b\n"}, {"c.go", "package c\n"}}, true)
+	var files int
+	_, err := Archive(context.Background(), big, Options{MaxArchiveSize: 25}, func(File) error {
+		files++
+		return nil
+	})
+	if !errors.Is(err, ErrArchiveTooLarge) || !strings.Contains(err.Error(), big) || files != 2 {
+		t.Errorf("Archive() error = %v after %d files, want ErrArchiveTooLarge naming the archive after 2", err, files)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Archive(ctx, big, Options{}, func(File) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("Archive(canceled) error = %v, want context.Canceled", err)
+	}
+}
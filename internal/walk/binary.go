@@ -0,0 +1,41 @@
+package walk
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/bashhack/cdx/internal/scan"
+)
+
+// sniffLen is how much of a file is inspected for NUL bytes.
+const sniffLen = 8 << 10
+
+// IsBinary reports whether the file at path looks binary, going by a NUL
+// byte in its first 8KB. Files starting with a UTF-16 byte order mark are
+// text. There's no extension denylist: images, archives, and other files
+// with no language never get this far, as the walk skips them by name.
+func IsBinary(path string) (bool, error) {
+	f, err := os.Open(path) // #nosec G304 -- path comes from the directory walk
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return IsBinaryData(buf[:n]), nil
+}
+
+// IsBinaryData reports whether data, a file's contents, looks binary, going
+// by NUL bytes in its first 8KB as IsBinary does.
+func IsBinaryData(data []byte) bool {
+	data = data[:min(len(data), sniffLen)]
+	if enc := scan.Sniff(data); enc == scan.UTF16LE || enc == scan.UTF16BE {
+		return false
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package walk
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// identify falls back to the cleaned absolute path with every symlink
+// resolved, which catches links but not hard links or bind mounts.
+func identify(path string, _ fs.FileInfo) (fileID, bool) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fileID{}, false
+	}
+	abs, err := filepath.Abs(resolved)
+	if err != nil {
+		return fileID{}, false
+	}
+	return fileID{path: abs}, true
+}
@@ -0,0 +1,163 @@
+package walk
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// listingsVersion is bumped whenever the listings file's format changes, so
+// an older file is discarded rather than misread.
+const listingsVersion = 1
+
+// racyWindow is how recently a directory may have changed and still have
+// its listing recorded. A directory that changes again within its file
+// system's timestamp granularity keeps the same modification time, so a
+// listing taken that soon after a change could go stale unnoticed.
+const racyWindow = 2 * time.Second
+
+// Listings remembers the directories a walk read, so that later walks of the
+// same tree can skip reading any directory whose modification time hasn't
+// changed since: adding, removing, or renaming an entry updates its
+// directory's modification time on the file systems cdx runs on. Files are
+// still statted on every walk, since the symbol cache validates its entries
+// by their sizes and modification times, but checking whether a file looks
+// binary is skipped when neither has changed.
+//
+// Where directory modification times can't be trusted, the TTL bounds how
+// long a listing is relied on: once it has passed since a walk last read
+// every directory, the next walk reads them all again. Listings are safe for
+// concurrent use, so walks of different roots may share them.
+type Listings struct {
+	now   func() time.Time
+	old   map[string]*listing // Listings loaded from the file, by directory path
+	new   map[string]*listing // Listings recorded by walks since loading
+	start time.Time           // When the listings were loaded, for racyWindow
+	file  string
+	ttl   time.Duration
+	// validated is when a walk last read every directory, in Unix
+	// nanoseconds
+	validated int64
+	mu        sync.Mutex
+}
+
+// listing is what a walk read from one directory.
+type listing struct {
+	Entries []dirEntry `json:"entries"`
+	ModTime int64      `json:"mtime"` // The directory's, in Unix nanoseconds
+}
+
+// dirEntry is a directory entry in a listing. Size, ModTime, and Binary are
+// recorded for the files a walk checked for binary content.
+type dirEntry struct {
+	Binary  *bool       `json:"binary,omitempty"`
+	Name    string      `json:"name"`
+	Size    int64       `json:"size,omitempty"`
+	ModTime int64       `json:"mtime,omitempty"`
+	Type    fs.FileMode `json:"type"`
+}
+
+// listingsFile is the format of the file Listings are saved to.
+type listingsFile struct {
+	Dirs      map[string]*listing `json:"dirs"`
+	Version   int                 `json:"version"`
+	Validated int64               `json:"validated"`
+}
+
+// LoadListings returns the listings saved in file, relying on them for at
+// most ttl after a walk last read every directory. A missing, unreadable, or
+// outdated file yields empty listings rather than an error, since they only
+// ever save work.
+func LoadListings(file string, ttl time.Duration) *Listings {
+	l := &Listings{file: file, ttl: ttl, now: time.Now, new: make(map[string]*listing)}
+	l.load()
+	return l
+}
+
+// load reads the listings file, discarding it if it is corrupt or expired.
+func (l *Listings) load() {
+	l.start = l.now()
+	data, err := os.ReadFile(l.file) // #nosec G304 -- the file is in cdx's own cache directory
+	if err != nil {
+		return
+	}
+	var saved listingsFile
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Version != listingsVersion {
+		return
+	}
+	if l.start.Sub(time.Unix(0, saved.Validated)) >= l.ttl {
+		return
+	}
+	l.old, l.validated = saved.Dirs, saved.Validated
+}
+
+// lookup returns the listing recorded for dir, or nil when there's none or
+// dir has changed since.
+func (l *Listings) lookup(dir string, info fs.FileInfo) *listing {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ls, ok := l.old[dir]
+	if !ok || ls == nil || ls.ModTime != info.ModTime().UnixNano() {
+		return nil
+	}
+	return ls
+}
+
+// record keeps the listing of dir for the next walk, unless dir changed too
+// recently for its modification time to tell whether it changes again.
+func (l *Listings) record(dir string, ls *listing) {
+	if l.start.Sub(time.Unix(0, ls.ModTime)) < racyWindow {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.new[dir] = ls
+}
+
+// Save writes the listings to their file, keeping those loaded from it that
+// no walk has read since. Directories that were removed stay in the file
+// until the TTL passes, which costs only space.
+func (l *Listings) Save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.new) == 0 {
+		return nil
+	}
+	saved := listingsFile{Dirs: l.new, Version: listingsVersion, Validated: l.validated}
+	if l.old == nil {
+		// Nothing was relied on, so every directory walked was read
+		saved.Validated = l.start.UnixNano()
+	}
+	for dir, ls := range l.old {
+		if _, ok := saved.Dirs[dir]; !ok {
+			saved.Dirs[dir] = ls
+		}
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	// Written through a temporary file renamed into place, so a concurrent
+	// walk never loads a partial file
+	dir := filepath.Dir(l.file)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(l.file)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// Remove is a no-op once the rename has succeeded
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.file)
+}
@@ -0,0 +1,114 @@
+package walk
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// age sets the modification times of everything under root an hour back,
+// so the walk's listings of its directories can be recorded.
+func age(t *testing.T, root string) {
+	t.Helper()
+	past := time.Now().Add(-time.Hour)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, past, past)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWalk_Listings(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"main.go":        "package main\n",
+		"pkg/util.go":    "package pkg\n",
+		"pkg/blob.go":    "package pkg\x00\n",
+		"pkg/.gitignore": "",
+		"web/app.ts":     "export const x = 1\n",
+	})
+	age(t, root)
+	file := filepath.Join(t.TempDir(), "listings.json")
+
+	walkListed := func(t *testing.T, ttl time.Duration) ([]string, Stats) {
+		t.Helper()
+		l := LoadListings(file, ttl)
+		files, stats, err := Files(context.Background(), Options{Root: root, Listings: l})
+		if err != nil {
+			t.Fatalf("Files() error = %v", err)
+		}
+		if err := l.Save(); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		return relPaths(files), stats
+	}
+
+	want := []string{"main.go", "pkg/util.go", "web/app.ts"}
+	got, stats := walkListed(t, time.Hour)
+	if !reflect.DeepEqual(got, want) || stats.Listed != 0 || stats.Binary != 1 {
+		t.Fatalf("first walk = %v with %d listed and %d binary, want %v with none listed and 1 binary", got, stats.Listed, stats.Binary, want)
+	}
+	got, stats = walkListed(t, time.Hour)
+	if !reflect.DeepEqual(got, want) || stats.Listed != 3 || stats.Binary != 1 {
+		t.Fatalf("second walk = %v with %d listed and %d binary, want %v with all 3 directories listed and 1 binary", got, stats.Listed, stats.Binary, want)
+	}
+
+	// A new file changes its directory, which is read again; editing an
+	// ignore file or a file's contents in place doesn't, but both are still
+	// seen
+	writeFiles := map[string]string{
+		"web/extra.ts":   "export const y = 2\n",
+		"pkg/.gitignore": "util.go\n",
+		"pkg/blob.go":    "package pkg\n",
+	}
+	for name, content := range writeFiles {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want = []string{"main.go", "pkg/blob.go", "web/app.ts", "web/extra.ts"}
+	got, stats = walkListed(t, time.Hour)
+	if !reflect.DeepEqual(got, want) || stats.Listed != 2 {
+		t.Errorf("walk after changes = %v with %d listed, want %v with 2 directories listed", got, stats.Listed, want)
+	}
+
+	// Once the TTL has passed, every directory is read again
+	if _, stats = walkListed(t, time.Nanosecond); stats.Listed != 0 {
+		t.Errorf("walk after the TTL listed %d directories, want 0", stats.Listed)
+	}
+
+	// A corrupt file is ignored
+	if err := os.WriteFile(file, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, stats = walkListed(t, time.Hour); !reflect.DeepEqual(got, want) || stats.Listed != 0 {
+		t.Errorf("walk with a corrupt file = %v with %d listed, want %v with none listed", got, stats.Listed, want)
+	}
+}
+
+func TestWalk_ListingsSkipRecentChanges(t *testing.T) {
+	// Directories changed just now could change again without their
+	// modification time moving, so they're never recorded
+	root := makeTree(t, map[string]string{"main.go": "package main\n"})
+	file := filepath.Join(t.TempDir(), "listings.json")
+	for range 2 {
+		l := LoadListings(file, time.Hour)
+		_, stats, err := Files(context.Background(), Options{Root: root, Listings: l})
+		if err != nil {
+			t.Fatalf("Files() error = %v", err)
+		}
+		if stats.Listed != 0 {
+			t.Errorf("Listed = %d for a directory changed just now, want 0", stats.Listed)
+		}
+		if err := l.Save(); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+}
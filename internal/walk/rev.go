@@ -0,0 +1,72 @@
+package walk
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+
+	"github.com/bashhack/cdx/internal/git"
+	"github.com/bashhack/cdx/internal/ignore"
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+// Rev is like Walk for the files under opts.Root as of the git revision
+// rev, which it reads from git's object store without checking anything out.
+// A revision holds only what was committed, so, as with Paths, opts.Exclude
+// is all that leaves files out by path: neither the skip list nor ignore
+// files apply. The language, size, and binary filters do, and files they
+// reject by name are never read. Each File's Path is where the file is in
+// the working tree and its Data holds its contents as of rev.
+func Rev(ctx context.Context, rev string, opts Options, fn func(File) error) (Stats, error) {
+	w := newWalker(ctx, opts, fn)
+	root := ignore.New(opts.Exclude...)
+	excluded := make(map[string]bool) // Directories seen, and whether they're excluded
+	var excludedDir func(dir string) bool
+	excludedDir = func(dir string) bool {
+		if dir == "." {
+			return false
+		}
+		skip, ok := excluded[dir]
+		if !ok {
+			w.stats.Dirs++
+			skip = excludedDir(path.Dir(dir))
+			if !skip {
+				var source string
+				if skip, source = root.Match(dir, true); skip {
+					w.stats.exclude(source)
+				}
+			}
+			excluded[dir] = skip
+		}
+		return skip
+	}
+
+	keep := func(rel string) bool {
+		lang := patterns.DetectFile(rel)
+		if lang == patterns.Unknown || (w.langs != nil && !w.langs[lang]) || excludedDir(path.Dir(rel)) {
+			return false
+		}
+		if ignored, source := root.Match(rel, false); ignored {
+			w.stats.exclude(source)
+			return false
+		}
+		return true
+	}
+	err := git.ReadTree(ctx, opts.Root, rev, keep, func(rel string, data []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if opts.MaxFileSize > 0 && int64(len(data)) > opts.MaxFileSize {
+			w.stats.Oversized = append(w.stats.Oversized, rel)
+			return nil
+		}
+		if !opts.IncludeBinary && IsBinaryData(data) {
+			w.stats.Binary++
+			return nil
+		}
+		w.stats.Files++
+		full := filepath.Join(opts.Root, filepath.FromSlash(rel))
+		return w.fn(File{Path: full, Rel: rel, Language: patterns.DetectFile(rel), Data: data})
+	})
+	return w.stats, err
+}
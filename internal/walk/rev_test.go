@@ -0,0 +1,83 @@
+package walk
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/ignore"
+)
+
+// commitTree commits the files under root, a tree from makeTree, tagging
+// the commit tag.
+func commitTree(t *testing.T, root, tag string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=cdx", "-c", "user.email=cdx@example.com", "commit", "-q", "-m", tag},
+		{"tag", tag},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", root}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+}
+
+func TestRev(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"main.go":           "package main\n\nfunc Old() {}\n",
+		"vendor/dep/dep.go": "package dep\n",
+		"generated/gen.go":  "package generated\n",
+		"blob.go":           "\x00\x01",
+		"README.md":         "# docs\n",
+	})
+	commitTree(t, root, "v1.0.0")
+	// The working tree has moved on since
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n\nfunc New() {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "new.go"), []byte("package main\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	gen, err := ignore.CompileRule("generated/", "", "--exclude")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	stats, err := Rev(context.Background(), "v1.0.0", Options{Root: root, Exclude: []ignore.Rule{gen}}, func(f File) error {
+		if f.Path != filepath.Join(root, filepath.FromSlash(f.Rel)) {
+			t.Errorf("Path = %q for %q, want it in the working tree", f.Path, f.Rel)
+		}
+		got[f.Rel] = string(f.Data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Rev() error = %v", err)
+	}
+
+	// Committed files under the skip list are searched; excluded ones
+	// aren't
+	want := map[string]string{
+		"main.go":           "package main\n\nfunc Old() {}\n",
+		"vendor/dep/dep.go": "package dep\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Rev() = %q, want %q", got, want)
+	}
+	if stats.Files != 2 || stats.Binary != 1 || stats.Excluded["--exclude"] != 1 {
+		t.Errorf("stats = %+v, want 2 files, 1 binary, and generated/ excluded", stats)
+	}
+
+	if _, err := Rev(context.Background(), "v9.9.9", Options{Root: root}, func(File) error { return nil }); err == nil {
+		t.Error("Rev(v9.9.9) error = nil, want an error for an unknown revision")
+	}
+}
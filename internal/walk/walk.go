@@ -0,0 +1,483 @@
+// Package walk enumerates the source files cdx searches.
+//
+// A walk starts at a root directory and yields every file in a supported
+// language, skipping the built-in list of dependency and VCS directories and
+// anything excluded by configured rules or by .gitignore or .cdxignore files.
+// Ignore files are read from every directory the walk enters and apply to
+// that directory's subtree, with .cdxignore rules layered on top of
+// .gitignore rules.
+package walk
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/bashhack/cdx/internal/ignore"
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+// SourceBuiltin identifies exclusions made by the built-in skip list.
+const SourceBuiltin = "built-in"
+
+// ignoreFiles are read from each directory in precedence order; later files
+// override earlier ones.
+var ignoreFiles = []string{".gitignore", ".cdxignore"}
+
+// skipDirs lists directory names that are never searched.
+var skipDirs = map[string]bool{
+	".git":         true,
+	".hg":          true,
+	".svn":         true,
+	".idea":        true,
+	".vscode":      true,
+	"node_modules": true,
+	"vendor":       true,
+	"__pycache__":  true,
+	".venv":        true, // A Python virtual environment; def --deps searches it
+	"dist":         true,
+	"build":        true,
+	"target":       true,
+}
+
+// SkipDirs returns the built-in list of skipped directory names, sorted.
+func SkipDirs() []string {
+	names := make([]string, 0, len(skipDirs))
+	for name := range skipDirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Options controls which files a walk yields.
+type Options struct {
+	// Listings, when set, supplies the listings of directories unchanged
+	// since an earlier walk, and records those this walk reads. It isn't
+	// used with Paths.
+	Listings *Listings
+	// Root is the directory to walk.
+	Root string
+	// Languages restricts the walk to these languages; empty means all
+	// supported languages.
+	Languages []patterns.Language
+	// Paths, when non-nil, replaces the directory walk with this explicit
+	// list of root-relative paths, such as the output of git ls-files. Only
+	// the user's exclusions apply to them, Exclude and .cdxignore files:
+	// whoever made the list already chose the files, so a tracked file under
+	// vendor/ or one matching .gitignore is still visited.
+	Paths []string
+	// Exclude holds extra rules, such as configured exclusions, applied from
+	// the root beneath any .gitignore and .cdxignore rules.
+	Exclude []ignore.Rule
+	// MaxFileSize skips files larger than this many bytes; zero means unlimited.
+	MaxFileSize int64
+	// MaxArchiveSize caps how many bytes Archive reads from the entries of
+	// an archive altogether; zero means DefaultMaxArchiveSize.
+	MaxArchiveSize int64
+	// IncludeBinary disables binary detection, yielding binary files too.
+	IncludeBinary bool
+	// FollowSymlinks descends into symlinked directories and yields
+	// symlinked files. Each physical file is yielded once, however many
+	// paths reach it.
+	FollowSymlinks bool
+}
+
+// File is a searchable file found by a walk.
+type File struct {
+	Info     fs.FileInfo
+	Path     string // Path joined onto the walk root
+	Rel      string // Slash-separated path relative to the walk root
+	Language patterns.Language
+	// Data holds the contents of a file that isn't on disk, such as an
+	// archive entry; nil means read Path
+	Data []byte
+}
+
+// Stats summarizes a walk.
+type Stats struct {
+	// Excluded counts the paths each ignore source excluded, keyed by
+	// SourceBuiltin or the root-relative path of the ignore file.
+	Excluded map[string]int
+	// Oversized lists the root-relative paths skipped for exceeding MaxFileSize.
+	Oversized []string
+	Files     int
+	Dirs      int
+	Binary    int // Files skipped because they look binary
+	// Duplicates counts files skipped because another path already reached
+	// them through a symlink.
+	Duplicates int
+	// Listed counts the directories whose entries came from
+	// Options.Listings rather than being read.
+	Listed int
+	// Elapsed is how long the walk took, not counting the time spent in
+	// its callback.
+	Elapsed time.Duration
+}
+
+// fileID identifies a physical file: by device and inode where the platform
+// has them, otherwise by resolved path.
+type fileID struct {
+	path     string
+	dev, ino uint64
+}
+
+// exclude records a path excluded by source.
+func (s *Stats) exclude(source string) {
+	if s.Excluded == nil {
+		s.Excluded = make(map[string]int)
+	}
+	s.Excluded[source]++
+}
+
+// walker holds the state of a single walk.
+type walker struct {
+	ctx      context.Context
+	fn       func(File) error
+	langs    map[patterns.Language]bool
+	matchers map[string]*ignore.Matcher // Per-directory matchers for explicit path lists
+	seen     map[fileID]bool            // Files and directories visited, when following symlinks
+	opts     Options
+	stats    Stats
+}
+
+// Walk calls fn for every searchable file under opts.Root in lexical order,
+// or for every searchable entry of opts.Paths in list order. It stops early
+// when ctx is done or fn returns an error, returning the statistics gathered
+// so far along with that error.
+func Walk(ctx context.Context, opts Options, fn func(File) error) (Stats, error) {
+	start := time.Now()
+	var inFn time.Duration
+	w := newWalker(ctx, opts, func(f File) error {
+		called := time.Now()
+		defer func() { inFn += time.Since(called) }()
+		return fn(f)
+	})
+	if opts.FollowSymlinks {
+		w.seen = make(map[fileID]bool)
+	}
+
+	if _, err := os.Stat(opts.Root); err != nil {
+		return w.stats, err
+	}
+	var err error
+	if opts.Paths != nil {
+		err = w.walkList()
+	} else {
+		err = w.walkDir(opts.Root, "", ignore.New(opts.Exclude...))
+	}
+	w.stats.Elapsed = time.Since(start) - inFn
+	return w.stats, err
+}
+
+func newWalker(ctx context.Context, opts Options, fn func(File) error) *walker {
+	w := &walker{
+		ctx:  ctx,
+		fn:   fn,
+		opts: opts,
+	}
+	if len(opts.Languages) > 0 {
+		w.langs = make(map[patterns.Language]bool, len(opts.Languages))
+		for _, lang := range opts.Languages {
+			w.langs[lang] = true
+		}
+	}
+	return w
+}
+
+// walkDir visits the directory dir, whose root-relative path is rel.
+func (w *walker) walkDir(dir, rel string, m *ignore.Matcher) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	// A directory reached twice through symlinks is walked once, which also
+	// stops symlink cycles
+	if w.seen != nil {
+		if info, err := os.Stat(dir); err == nil && w.visited(dir, info) {
+			return nil
+		}
+	}
+	w.stats.Dirs++
+
+	// The directory's modification time, taken before reading it, tells
+	// whether a recorded listing still holds and lets this one be recorded
+	var ls *listing
+	var dirInfo fs.FileInfo
+	if w.opts.Listings != nil {
+		var err error
+		if dirInfo, err = os.Stat(dir); err == nil {
+			if ls = w.opts.Listings.lookup(dir, dirInfo); ls != nil {
+				w.stats.Listed++
+				ls = &listing{Entries: slices.Clone(ls.Entries), ModTime: ls.ModTime}
+			}
+		}
+	}
+
+	m, err := w.loadIgnores(dir, rel, m, ls)
+	if err != nil {
+		return err
+	}
+
+	if ls == nil {
+		dirEntries, err := os.ReadDir(dir)
+		if err != nil {
+			// Unreadable subdirectories are skipped rather than failing the walk
+			if rel != "" {
+				return nil
+			}
+			return err
+		}
+		ls = &listing{Entries: make([]dirEntry, len(dirEntries))}
+		for i, e := range dirEntries {
+			ls.Entries[i] = dirEntry{Name: e.Name(), Type: e.Type()}
+		}
+	}
+	if dirInfo != nil {
+		ls.ModTime = dirInfo.ModTime().UnixNano()
+	}
+
+	for i := range ls.Entries {
+		e := &ls.Entries[i]
+		name := e.Name
+		entryRel := path.Join(rel, name)
+		entryPath := filepath.Join(dir, name)
+
+		isDir, isFile := e.Type.IsDir(), e.Type.IsRegular()
+		info := func() (fs.FileInfo, error) { return os.Lstat(entryPath) }
+		if e.Type&fs.ModeSymlink != 0 {
+			if !w.opts.FollowSymlinks {
+				continue
+			}
+			target, err := os.Stat(entryPath)
+			if err != nil {
+				// Broken links are skipped
+				continue
+			}
+			isDir, isFile = target.IsDir(), target.Mode().IsRegular()
+			info = func() (fs.FileInfo, error) { return target, nil }
+		}
+
+		if isDir {
+			if w.skipDir(name, entryRel, m) {
+				continue
+			}
+			if err := w.walkDir(entryPath, entryRel, m); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !isFile {
+			continue
+		}
+		if err := w.visitFile(entryPath, entryRel, m, info, e); err != nil {
+			return err
+		}
+	}
+	if dirInfo != nil {
+		w.opts.Listings.record(dir, ls)
+	}
+	return nil
+}
+
+// walkList visits the explicit list of root-relative paths in opts.Paths,
+// applying the exclusions and .cdxignore files a directory walk would but
+// not the built-in skip list or .gitignore files.
+func (w *walker) walkList() error {
+	w.matchers = make(map[string]*ignore.Matcher)
+
+	for _, rel := range w.opts.Paths {
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		rel = path.Clean(filepath.ToSlash(rel))
+
+		m, skipped, err := w.matcherFor(path.Dir(rel))
+		if err != nil {
+			return err
+		}
+		if skipped {
+			continue
+		}
+
+		full := filepath.Join(w.opts.Root, filepath.FromSlash(rel))
+		if err := w.visitFile(full, rel, m, func() (fs.FileInfo, error) {
+			stat := os.Lstat
+			if w.opts.FollowSymlinks {
+				stat = os.Stat
+			}
+			info, err := stat(full)
+			if err == nil && !info.Mode().IsRegular() {
+				return nil, fs.ErrInvalid
+			}
+			return info, err
+		}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matcherFor returns the ignore matcher in effect inside the root-relative
+// directory dir, loading ignore files along the way. It reports skipped when
+// dir or one of its ancestors is excluded by a rule; the built-in skip list
+// doesn't apply to listed paths.
+func (w *walker) matcherFor(dir string) (m *ignore.Matcher, skipped bool, err error) {
+	if m, ok := w.matchers[dir]; ok {
+		return m, m == nil, nil
+	}
+
+	var parent *ignore.Matcher
+	if dir == "." {
+		dir = ""
+	}
+	if dir == "" {
+		parent = ignore.New(w.opts.Exclude...)
+	} else {
+		parent, skipped, err = w.matcherFor(path.Dir(dir))
+		if err != nil {
+			return nil, false, err
+		}
+		if !skipped {
+			if ignored, source := parent.Match(dir, true); ignored {
+				w.stats.exclude(source)
+				skipped = true
+			}
+		}
+		if skipped {
+			// A nil matcher marks the directory as excluded
+			w.matchers[dir] = nil
+			return nil, true, nil
+		}
+	}
+
+	w.stats.Dirs++
+	m, err = w.loadIgnores(filepath.Join(w.opts.Root, filepath.FromSlash(dir)), dir, parent, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	w.matchers[dir] = m
+	if dir == "" {
+		w.matchers["."] = m
+	}
+	return m, false, nil
+}
+
+// skipDir reports whether the directory name at root-relative path rel is
+// excluded, recording the exclusion.
+func (w *walker) skipDir(name, rel string, m *ignore.Matcher) bool {
+	if skipDirs[name] {
+		w.stats.exclude(SourceBuiltin)
+		return true
+	}
+	if ignored, source := m.Match(rel, true); ignored {
+		w.stats.exclude(source)
+		return true
+	}
+	return false
+}
+
+// visitFile applies the per-file filters and passes surviving files to the
+// callback. info is called lazily, after the cheap name-based checks. e, when
+// not nil, is the file's entry in its directory's listing, which remembers
+// whether it looks binary.
+func (w *walker) visitFile(full, rel string, m *ignore.Matcher, info func() (fs.FileInfo, error), e *dirEntry) error {
+	lang := patterns.DetectFile(rel)
+	if lang == patterns.Unknown || (w.langs != nil && !w.langs[lang]) {
+		return nil
+	}
+	if ignored, source := m.Match(rel, false); ignored {
+		w.stats.exclude(source)
+		return nil
+	}
+
+	fi, err := info()
+	if err != nil {
+		// The file vanished, or isn't a regular file
+		return nil
+	}
+	if w.seen != nil && w.visited(full, fi) {
+		w.stats.Duplicates++
+		return nil
+	}
+	if w.opts.MaxFileSize > 0 && fi.Size() > w.opts.MaxFileSize {
+		w.stats.Oversized = append(w.stats.Oversized, rel)
+		return nil
+	}
+	if !w.opts.IncludeBinary && w.isBinary(full, fi, e) {
+		w.stats.Binary++
+		return nil
+	}
+
+	w.stats.Files++
+	return w.fn(File{Path: full, Rel: rel, Language: lang, Info: fi})
+}
+
+// isBinary reports whether the file at full, described by fi, looks binary,
+// trusting e's answer when the file hasn't changed since e recorded it and
+// recording the answer in e otherwise. Unreadable files are left for the
+// scanner to report.
+func (w *walker) isBinary(full string, fi fs.FileInfo, e *dirEntry) bool {
+	size, modTime := fi.Size(), fi.ModTime().UnixNano()
+	if e != nil && e.Binary != nil && e.Size == size && e.ModTime == modTime {
+		return *e.Binary
+	}
+	binary, err := IsBinary(full)
+	if err != nil {
+		return false
+	}
+	if e != nil {
+		e.Binary, e.Size, e.ModTime = &binary, size, modTime
+	}
+	return binary
+}
+
+// visited records the file or directory at path and reports whether it had
+// already been visited. Paths that can't be identified are never duplicates.
+func (w *walker) visited(path string, info fs.FileInfo) bool {
+	id, ok := identify(path, info)
+	if !ok {
+		return false
+	}
+	if w.seen[id] {
+		return true
+	}
+	w.seen[id] = true
+	return false
+}
+
+// loadIgnores extends m with the ignore files found in dir. When dir's
+// listing is known, only the ignore files it lists are read.
+func (w *walker) loadIgnores(dir, rel string, m *ignore.Matcher, ls *listing) (*ignore.Matcher, error) {
+	for _, name := range ignoreFiles {
+		// A listed path was already chosen with .gitignore in mind: git
+		// ls-files lists tracked files whether or not they match it
+		if name == ".gitignore" && w.opts.Paths != nil {
+			continue
+		}
+		if ls != nil && !slices.ContainsFunc(ls.Entries, func(e dirEntry) bool { return e.Name == name }) {
+			continue
+		}
+		rules, err := ignore.ParseFile(filepath.Join(dir, name), rel, path.Join(rel, name))
+		if err != nil {
+			return nil, err
+		}
+		m = m.With(rules...)
+	}
+	return m, nil
+}
+
+// Files returns every searchable file under opts.Root.
+func Files(ctx context.Context, opts Options) ([]File, Stats, error) {
+	var files []File
+	stats, err := Walk(ctx, opts, func(f File) error {
+		files = append(files, f)
+		return nil
+	})
+	return files, stats, err
+}
@@ -0,0 +1,329 @@
+package walk
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/patterns"
+)
+
+// makeTree creates files (slash-separated paths mapped to contents) under a temp dir.
+func makeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func relPaths(files []File) []string {
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.Rel)
+	}
+	return paths
+}
+
+func TestWalk_IgnoreSources(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		".gitignore":                   "*.log.go\nscratch/\n",
+		".cdxignore":                   "clients/\nfixtures/**\n!fixtures/keep.go\n",
+		"main.go":                      "package main\n",
+		"debug.log.go":                 "package main\n",
+		"scratch/tmp.go":               "package scratch\n",
+		"clients/api.go":               "package clients\n",
+		"fixtures/big.go":              "package fixtures\n",
+		"fixtures/keep.go":             "package fixtures\n",
+		"node_modules/lib/index.js":    "module.exports = {}\n",
+		".venv/lib/site.py":            "x = 1\n",
+		"web/app.ts":                   "export const x = 1\n",
+		"web/.cdxignore":               "legacy.ts\n",
+		"web/legacy.ts":                "export const y = 2\n",
+		"README.md":                    "# not source\n",
+		"pkg/internal/clients/ok.go":   "package clients\n",
+		"pkg/internal/scratch.go/x.py": "x = 1\n",
+	})
+
+	files, stats, err := Files(context.Background(), Options{Root: root})
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+
+	want := []string{
+		"fixtures/keep.go",
+		"main.go",
+		"pkg/internal/scratch.go/x.py",
+		"web/app.ts",
+	}
+	if got := relPaths(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+
+	wantExcluded := map[string]int{
+		SourceBuiltin:    2, // node_modules, .venv
+		".gitignore":     2, // debug.log.go, scratch/
+		".cdxignore":     3, // clients/ (twice), fixtures/big.go
+		"web/.cdxignore": 1, // legacy.ts
+	}
+	if !reflect.DeepEqual(stats.Excluded, wantExcluded) {
+		t.Errorf("Excluded = %v, want %v", stats.Excluded, wantExcluded)
+	}
+	if stats.Files != len(want) {
+		t.Errorf("Files = %d, want %d", stats.Files, len(want))
+	}
+}
+
+func TestWalk_LanguageFilter(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"main.go":   "package main\n",
+		"app.ts":    "export {}\n",
+		"script.py": "pass\n",
+	})
+
+	files, _, err := Files(context.Background(), Options{
+		Root:      root,
+		Languages: []patterns.Language{patterns.Go, patterns.Python},
+	})
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+
+	want := []string{"main.go", "script.py"}
+	if got := relPaths(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+}
+
+func TestWalk_StopsOnCallbackError(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.go": "package a\n",
+		"b.go": "package b\n",
+	})
+
+	errStop := errors.New("stop")
+	calls := 0
+	_, err := Walk(context.Background(), Options{Root: root}, func(File) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("Walk() error = %v, want %v", err, errStop)
+	}
+	if calls != 1 {
+		t.Errorf("callback called %d times, want 1", calls)
+	}
+}
+
+func TestWalk_CanceledContext(t *testing.T) {
+	root := makeTree(t, map[string]string{"a.go": "package a\n"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := Walk(ctx, Options{Root: root}, func(File) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("Walk() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestWalk_MissingRoot(t *testing.T) {
+	_, err := Walk(context.Background(), Options{Root: filepath.Join(t.TempDir(), "missing")}, func(File) error { return nil })
+	if err == nil {
+		t.Error("Walk() error = nil, want error for missing root")
+	}
+}
+
+func TestWalk_SkipsBinaryFiles(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"main.go":   "package main\n",
+		"blob.js":   "var x = 1;\x00\x01\x02",
+		"bundle.js": "var y = 2;\n",
+	})
+
+	files, stats, err := Files(context.Background(), Options{Root: root})
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	if got, want := relPaths(files), []string{"bundle.js", "main.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	if stats.Binary != 1 {
+		t.Errorf("Binary = %d, want 1", stats.Binary)
+	}
+
+	files, stats, err = Files(context.Background(), Options{Root: root, IncludeBinary: true})
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	if len(files) != 3 || stats.Binary != 0 {
+		t.Errorf("with IncludeBinary: files = %v, Binary = %d, want all 3 files and 0", relPaths(files), stats.Binary)
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	nulAfterSniff := make([]byte, sniffLen+10)
+	for i := range nulAfterSniff {
+		nulAfterSniff[i] = 'a'
+	}
+	nulAfterSniff[sniffLen+5] = 0
+
+	root := makeTree(t, map[string]string{
+		"text.go":     "package main\n",
+		"empty.go":    "",
+		"nul.js":      "abc\x00def",
+		"image.go":    "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		"late-nul.js": string(nulAfterSniff),
+		"utf16.py":    "\xff\xfed\x00e\x00f\x00",
+	})
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"text.go", false},
+		{"empty.go", false},
+		{"nul.js", true},
+		{"image.go", true},
+		{"late-nul.js", false}, // only the first 8KB are inspected
+		{"utf16.py", false},    // NULs are expected in UTF-16 text
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := IsBinary(filepath.Join(root, tt.name))
+			if err != nil {
+				t.Fatalf("IsBinary() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("IsBinary(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalk_MaxFileSize(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"small.go":      "package main\n",
+		"gen/bundle.js": "var data = \"" + string(make([]byte, 2048)) + "\";\n",
+	})
+
+	files, stats, err := Files(context.Background(), Options{Root: root, MaxFileSize: 1024})
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	if got, want := relPaths(files), []string{"small.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	if want := []string{"gen/bundle.js"}; !reflect.DeepEqual(stats.Oversized, want) {
+		t.Errorf("Oversized = %v, want %v", stats.Oversized, want)
+	}
+	if stats.Binary != 0 {
+		t.Errorf("Binary = %d, want 0 (size is checked before sniffing)", stats.Binary)
+	}
+
+	// Zero means unlimited; the NUL-filled file is then caught as binary
+	files, stats, err = Files(context.Background(), Options{Root: root})
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	if len(stats.Oversized) != 0 || stats.Binary != 1 || len(files) != 1 {
+		t.Errorf("unlimited: files = %v, Oversized = %v, Binary = %d", relPaths(files), stats.Oversized, stats.Binary)
+	}
+}
+
+func TestWalk_ExplicitPaths(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		".cdxignore":          "generated/\n",
+		".gitignore":          "*.gen.go\n",
+		"main.go":             "package main\n",
+		"schema.gen.go":       "package main\n",
+		"pkg/util.go":         "package pkg\n",
+		"pkg/.cdxignore":      "local.go\n",
+		"pkg/local.go":        "package pkg\n",
+		"generated/client.go": "package generated\n",
+		"vendor/dep/dep.go":   "package dep\n",
+		"README.md":           "# docs\n",
+		"untracked.go":        "package main\n",
+	})
+
+	files, stats, err := Files(context.Background(), Options{
+		Root: root,
+		Paths: []string{
+			".cdxignore", ".gitignore", "README.md", "generated/client.go", "main.go",
+			"missing.go", "pkg/local.go", "pkg/util.go", "schema.gen.go", "vendor/dep/dep.go",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+
+	// untracked.go isn't listed, so it's never visited. Tracked files are
+	// listed whatever .gitignore and the built-in skip list say, so only the
+	// user's .cdxignore rules leave any out.
+	want := []string{"main.go", "pkg/util.go", "schema.gen.go", "vendor/dep/dep.go"}
+	if got := relPaths(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	wantExcluded := map[string]int{
+		".cdxignore":     1,
+		"pkg/.cdxignore": 1,
+	}
+	if !reflect.DeepEqual(stats.Excluded, wantExcluded) {
+		t.Errorf("Excluded = %v, want %v", stats.Excluded, wantExcluded)
+	}
+}
+
+func TestWalk_Symlinks(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"pkg/util.go": "package pkg\n",
+		"main.go":     "package main\n",
+	})
+	links := map[string]string{
+		"alias":       "pkg",                // Symlinked directory
+		"main2.go":    "main.go",            // Symlinked file
+		"pkg/loop":    "..",                 // Cycle back to the root
+		"dangling.go": "missing/nowhere.go", // Broken link
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(link))); err != nil {
+			t.Skipf("symlinks unsupported: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		want           []string
+		follow         bool
+		wantDuplicates int
+	}{
+		{name: "not followed", want: []string{"main.go", "pkg/util.go"}},
+		// alias sorts first, so pkg is then skipped as an already-walked
+		// directory; main2.go is main.go again
+		{name: "followed once", follow: true, want: []string{"alias/util.go", "main.go"}, wantDuplicates: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, stats, err := Files(context.Background(), Options{Root: root, FollowSymlinks: tt.follow})
+			if err != nil {
+				t.Fatalf("Files() error = %v", err)
+			}
+			if got := relPaths(files); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+			if stats.Duplicates != tt.wantDuplicates {
+				t.Errorf("Duplicates = %d, want %d", stats.Duplicates, tt.wantDuplicates)
+			}
+		})
+	}
+}
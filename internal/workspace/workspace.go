@@ -0,0 +1,103 @@
+// Package workspace locates the repository or project a command runs in,
+// so searches can cover the whole project regardless of the working
+// directory.
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Markers lists the files that identify a project root when there's no
+// enclosing git repository, in order of preference within a directory.
+var Markers = []string{"go.mod", "package.json", "pyproject.toml"}
+
+// Root is the top of the project containing some directory.
+type Root struct {
+	// Dir is the absolute path of the root.
+	Dir string
+	// Marker names what identified Dir: ".git", one of Markers, or "" when
+	// nothing did and Dir is just the starting directory.
+	Marker string
+}
+
+// Find returns the root of the project containing dir. The nearest ancestor
+// with a .git entry wins (a directory, or a file for worktrees and
+// submodules); failing that, the nearest ancestor holding one of Markers.
+// If neither exists, Find returns dir itself with an empty Marker.
+func Find(dir string) (Root, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return Root{}, err
+	}
+
+	var fallback Root
+	for d := dir; ; {
+		if exists(filepath.Join(d, ".git")) {
+			return Root{Dir: d, Marker: ".git"}, nil
+		}
+		if fallback.Dir == "" {
+			for _, m := range Markers {
+				if exists(filepath.Join(d, m)) {
+					fallback = Root{Dir: d, Marker: m}
+					break
+				}
+			}
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+
+	if fallback.Dir != "" {
+		return fallback, nil
+	}
+	return Root{Dir: dir}, nil
+}
+
+// RelTo converts the slash-separated path, relative to the root, into a
+// path relative to dir in the platform's separators, so results found from
+// the root stay usable from where the user is. It returns path in the
+// platform's separators if dir can't be related to the root.
+func (r Root) RelTo(dir, path string) string {
+	rel, err := filepath.Rel(dir, filepath.Join(r.Dir, filepath.FromSlash(path)))
+	if err != nil {
+		return filepath.FromSlash(path)
+	}
+	return rel
+}
+
+// CommonDir returns the deepest directory containing every one of dirs,
+// which must be absolute and clean, or "" when there's none, as for
+// directories on different Windows volumes.
+func CommonDir(dirs []string) string {
+	if len(dirs) == 0 {
+		return ""
+	}
+	common := dirs[0]
+	for _, dir := range dirs[1:] {
+		for !Within(common, dir) {
+			parent := filepath.Dir(common)
+			if parent == common {
+				return ""
+			}
+			common = parent
+		}
+	}
+	return common
+}
+
+// Within reports whether path is dir or lies under it. Both must be
+// absolute and clean.
+func Within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
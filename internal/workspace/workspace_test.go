@@ -0,0 +1,138 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makeTree creates the named files and directories (trailing slash) under a
+// temp dir and returns its path.
+func makeTree(t *testing.T, paths ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, p := range paths {
+		full := filepath.Join(root, filepath.FromSlash(p))
+		if p[len(p)-1] == '/' {
+			if err := os.MkdirAll(full, 0o750); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(full), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		name       string
+		start      string
+		wantDir    string
+		wantMarker string
+		tree       []string
+	}{
+		{
+			name:       "git directory",
+			tree:       []string{"repo/.git/", "repo/services/auth/internal/"},
+			start:      "repo/services/auth/internal",
+			wantDir:    "repo",
+			wantMarker: ".git",
+		},
+		{
+			name:       "git file in a worktree",
+			tree:       []string{"wt/.git", "wt/pkg/"},
+			start:      "wt/pkg",
+			wantDir:    "wt",
+			wantMarker: ".git",
+		},
+		{
+			name:       "git beats a nearer go.mod",
+			tree:       []string{"repo/.git/", "repo/tools/go.mod", "repo/tools/cmd/"},
+			start:      "repo/tools/cmd",
+			wantDir:    "repo",
+			wantMarker: ".git",
+		},
+		{
+			name:       "nearest marker without git",
+			tree:       []string{"mono/package.json", "mono/api/pyproject.toml", "mono/api/src/"},
+			start:      "mono/api/src",
+			wantDir:    "mono/api",
+			wantMarker: "pyproject.toml",
+		},
+		{
+			name:       "go.mod preferred within a directory",
+			tree:       []string{"svc/go.mod", "svc/package.json", "svc/web/"},
+			start:      "svc/web",
+			wantDir:    "svc",
+			wantMarker: "go.mod",
+		},
+		{
+			name:    "nothing found",
+			tree:    []string{"loose/dir/"},
+			start:   "loose/dir",
+			wantDir: "loose/dir",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := makeTree(t, tt.tree...)
+			got, err := Find(filepath.Join(tmp, filepath.FromSlash(tt.start)))
+			if err != nil {
+				t.Fatalf("Find() error = %v", err)
+			}
+			if tt.wantMarker == "" && got.Marker != "" {
+				t.Skipf("temp dir is itself inside a project (%s at %s)", got.Marker, got.Dir)
+			}
+			want := Root{Dir: filepath.Join(tmp, filepath.FromSlash(tt.wantDir)), Marker: tt.wantMarker}
+			if got != want {
+				t.Errorf("Find() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestRoot_RelTo(t *testing.T) {
+	r := Root{Dir: filepath.FromSlash("/src/repo")}
+	tests := []struct {
+		dir, path, want string
+	}{
+		{"/src/repo", "pkg/user.go", "pkg/user.go"},
+		{"/src/repo/pkg", "pkg/user.go", "user.go"},
+		{"/src/repo/services/auth", "pkg/user.go", "../../pkg/user.go"},
+	}
+	for _, tt := range tests {
+		if got := r.RelTo(filepath.FromSlash(tt.dir), tt.path); got != filepath.FromSlash(tt.want) {
+			t.Errorf("RelTo(%q, %q) = %q, want %q", tt.dir, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCommonDir(t *testing.T) {
+	tests := []struct {
+		want string
+		dirs []string
+	}{
+		{"/work/api", []string{"/work/api"}},
+		{"/work", []string{"/work/api", "/work/web", "/work/proto"}},
+		{"/work", []string{"/work/api/v2", "/work/web"}},
+		{"/work/api", []string{"/work/api", "/work/api/internal"}},
+		{"/", []string{"/work/api", "/srv/web"}},
+		{"/work", []string{"/work/api", "/work/apiary"}},
+	}
+	for _, tt := range tests {
+		dirs := make([]string, len(tt.dirs))
+		for i, d := range tt.dirs {
+			dirs[i] = filepath.FromSlash(d)
+		}
+		if got := CommonDir(dirs); got != filepath.FromSlash(tt.want) {
+			t.Errorf("CommonDir(%q) = %q, want %q", tt.dirs, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,740 @@
+// Package cdx is the Go API to cdx's code search, for tools that embed it
+// instead of running the cdx command.
+//
+// Search finds the definitions of and references to a symbol, or to every
+// name a regular expression matches, across directory trees, archives, or
+// git revisions; cdx refs, callers, and check run on it too, as do the
+// reference queries of cdx serve. Stream passes the same results file by
+// file as the search finds them. Languages, DetectLanguage, and Describe
+// report the languages it understands.
+//
+// # Stability
+//
+// The package follows semantic versioning along with the cdx module: within
+// a major version, exported functions keep their signatures and meaning,
+// and exported types keep their fields. New fields, functions, languages,
+// and reference kinds can appear in any minor version, so build Query and
+// other structs with field names, and treat unknown Kind and Language
+// values as possible. Results are heuristic, read from the source text as
+// cdx reads it; a minor version can find more or fewer matches as the
+// language rules improve.
+package cdx
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/bashhack/cdx/internal/cache"
+	"github.com/bashhack/cdx/internal/generated"
+	"github.com/bashhack/cdx/internal/ignore"
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/refs"
+	"github.com/bashhack/cdx/internal/scan"
+	"github.com/bashhack/cdx/internal/session"
+	"github.com/bashhack/cdx/internal/symbols"
+	"github.com/bashhack/cdx/internal/testfiles"
+	"github.com/bashhack/cdx/internal/walk"
+)
+
+// Language identifies a programming language, such as "go" or "ts".
+type Language string
+
+// Mode selects which occurrences Search returns.
+type Mode int
+
+const (
+	// All returns definitions and references.
+	All Mode = iota
+	// Definitions returns only the sites that define the names.
+	Definitions
+	// References returns only the uses of the names.
+	References
+)
+
+// Query describes a search. Exactly one of Symbol and Regex is set.
+type Query struct {
+	// Progress, when set, is called with how many files the search of a
+	// root has reached as it reaches each one.
+	Progress func(files int)
+	// Symbol is the name to find, matched as a whole word by each file's
+	// language's rules for what can be part of an identifier.
+	Symbol string
+	// Regex finds every name it matches in full instead, e.g. `Legacy\w+`.
+	Regex string
+	// Rev, when set, searches each root as of this git revision, such as a
+	// tag or commit, reading the files from git's object store without
+	// checking it out. Only Exclude leaves files out by path, as the
+	// ignore files in the working tree may not match the revision.
+	Rev string
+	// Parser, when set, outlines each file with references using the
+	// parser of that name, "regex" or "tree-sitter", to give them their
+	// Enclosing definition.
+	Parser string
+	// Languages limits the search to these languages; nil searches every
+	// supported language.
+	Languages []Language
+	// Roots are the directories searched, in turn; nil searches the
+	// working directory. .gitignore and .cdxignore files are honored.
+	Roots []string
+	// Kinds keeps only the references of these kinds: call, construct,
+	// type, import, or other. Definitions are kept regardless; nil keeps
+	// every kind.
+	Kinds []string
+	// Exclude leaves out the files and directories these patterns match,
+	// on top of the ignore files.
+	Exclude []Exclusion
+	// TestPaths are gitignore-style patterns for more test files than each
+	// language's conventions identify, such as e2e/, or, with a leading !,
+	// as in !src/features/, for files that are code instead.
+	TestPaths []string
+	// GeneratedPatterns replaces the names that mark generated files, such
+	// as *.pb.go; nil keeps the defaults. Files whose first lines say they
+	// were generated are always recognized.
+	GeneratedPatterns []string
+	// Mode selects definitions, references, or both.
+	Mode Mode
+	// Context is how many lines before and after each result to include.
+	Context int
+	// MaxResults caps the results, keeping the first in search order; zero
+	// means no limit.
+	MaxResults int
+	// StopAfter stops searching a root once it has found this many
+	// references, not counting definitions: no more files are read, though
+	// those already begun are finished, so the first StopAfter references
+	// are the same as a full search's, but there may be more, and the
+	// definitions in the files left out aren't found. Zero means no limit.
+	StopAfter int
+	// MaxFileSize skips files larger than this many bytes; zero means no
+	// limit.
+	MaxFileSize int64
+	// MaxLineLength caps how many bytes of each line are searched; zero
+	// means the default of 64KB and a negative value means no limit.
+	MaxLineLength int
+	// Jobs is how many files are searched at once; zero means one for each
+	// CPU.
+	Jobs int
+	// ListingsLifetime is how long, with Cache, the directory listings a
+	// search read stay usable by later ones without being read again; zero
+	// reads every directory.
+	ListingsLifetime time.Duration
+	// IncludeTests searches test files, as each language's conventions
+	// identify them, too.
+	IncludeTests bool
+	// OnlyTests searches test files alone.
+	OnlyTests bool
+	// IncludeGenerated searches generated files too: those named like
+	// *.pb.go or zz_generated*.go, and those whose first lines say "Code
+	// generated ... DO NOT EDIT" or "@generated".
+	IncludeGenerated bool
+	// IgnoreCase matches names case-insensitively.
+	IgnoreCase bool
+	// SkipComments and SkipStrings leave out occurrences in comments and
+	// string literals, which are otherwise returned and marked.
+	SkipComments bool
+	SkipStrings  bool
+	// InStrings turns the search around to find the text only inside
+	// string literals, Go struct tags included, as for a config key or an
+	// event name. Each result records its Literal.
+	InStrings bool
+	// Nested includes, in Definitions mode, the definitions of functions
+	// nested in other functions, such as Python closures, which are left
+	// out by default as helpers rarely worth finding on their own.
+	Nested bool
+	// FollowSymlinks follows symbolic links, searching each file once.
+	FollowSymlinks bool
+	// InOrder makes Stream pass the files in Search's order, holding a
+	// file searched early back until those before it are passed.
+	InOrder bool
+	// Archive searches inside the zip, tar, or gzipped tar archives Roots
+	// names instead of directories, reading them in memory.
+	Archive bool
+	// CountByFile counts each file's references into Results.Counts
+	// instead of returning them, keeping neither their text nor their
+	// positions, so it stays cheap for names used thousands of times.
+	CountByFile bool
+	// Cache uses the caches the cdx command keeps under the user's config
+	// directory: the symbol index, which learns the definitions Parser
+	// finds, and the directory listings of ListingsLifetime. A cache that
+	// can't be read or written only costs time.
+	Cache bool
+}
+
+// Exclusion is a gitignore-style pattern that leaves paths out of a search,
+// such as vendor/ or *.min.js, relative to each root.
+type Exclusion struct {
+	Pattern string
+	// Source names where the pattern came from, such as a config setting,
+	// to count what it leaves out under in Stats.Excluded; "" is
+	// "Query.Exclude".
+	Source string
+}
+
+// Result is one occurrence of a name.
+type Result struct {
+	// Enclosing is the function, method, or class the result is in, with
+	// Query.Parser, unless it's at the top level.
+	Enclosing *Enclosing
+	Root      string // The root the result was found under, as given in Query.Roots
+	// Path is slash-separated and relative to Root; with Query.Archive, it's
+	// the entry's path prefixed with the archive, as in snapshot.tgz::main.go
+	Path  string
+	Name  string // The name as it occurs
+	Text  string // The whole line, without its terminator
+	Kind  string // How the code uses the name: definition, call, construct, type, import, or other
+	Scope string // What a Python definition is nested in, as in Outer.method
+	// Container is the type or class a definition belongs to, such as a Go
+	// method's receiver type or a Rust method's impl type, and Receiver a
+	// Go method's receiver type as written, as in *GrepSearcher
+	Container string
+	Receiver  string
+	// source is the contents of a file that isn't on disk, as of Query.Rev
+	// or in an archive, to read context from
+	source []byte
+	// Literal is the string literal the result is in, quotes included,
+	// with Query.InStrings; only the part on Line if it spans lines
+	Literal string
+	// Encoding is the file's character encoding when it isn't UTF-8; Text
+	// and Column refer to the text decoded to UTF-8
+	Encoding string
+	Language Language // The file's language
+	Archive  string   // The archive searched, with Query.Archive
+	Rev      string   // Query.Rev
+	Before   []string // Up to Query.Context lines before Line
+	After    []string // Up to Query.Context lines after Line
+	Line     int      // 1-based
+	Column   int      // 1-based byte column
+	// InComment and InString mark occurrences in a comment or string
+	// literal, as far as the lexical heuristics can tell.
+	InComment bool
+	InString  bool
+	IsTest    bool // In a test file
+	// IsGenerated marks results in generated files, which only
+	// Query.IncludeGenerated returns.
+	IsGenerated bool
+	// Nested marks the definition of a function inside another function.
+	Nested bool
+	// offset is where Line starts in the file, or -1 when its text was
+	// decoded from another encoding
+	offset int64
+}
+
+// Enclosing identifies the definition a result sits in.
+type Enclosing struct {
+	Name string // Qualified by its parent, as in User.Save, when known
+	Kind string
+	Line int
+}
+
+// FileCount is how many references a file has, with Query.CountByFile.
+type FileCount struct {
+	Root        string
+	Path        string // Slash-separated, relative to Root
+	Language    Language
+	Count       int
+	IsTest      bool
+	IsGenerated bool
+}
+
+// Stats summarizes the files a search visited.
+type Stats struct {
+	// Excluded counts the paths each source of exclusions left out, keyed
+	// by Exclusion.Source, the root-relative path of an ignore file, or
+	// "built-in" for the directories, such as node_modules, that are
+	// never searched.
+	Excluded map[string]int
+	// Oversized lists the files skipped for exceeding Query.MaxFileSize,
+	// relative to their root.
+	Oversized []string
+	Files     int // Files searched
+	Dirs      int // Directories walked
+	Binary    int // Files skipped because they look binary
+	// Duplicates counts the files skipped because another path already
+	// reached them through a symbolic link.
+	Duplicates int
+	// Listed counts the directories whose entries came from the listings
+	// Query.Cache keeps rather than being read.
+	Listed int
+	// Generated counts the generated files skipped, unless
+	// Query.IncludeGenerated.
+	Generated int
+	// Unreadable counts the files skipped because they couldn't be read,
+	// as when one was deleted while the search ran.
+	Unreadable int
+	// Truncated counts the lines longer than Query.MaxLineLength, of which
+	// only the start was searched.
+	Truncated int
+	// Walk is how long finding the files took, apart from searching them.
+	Walk time.Duration
+}
+
+// Results are what Search found.
+type Results struct {
+	Results []Result    // In search order: by root, then file, then line
+	Counts  []FileCount // With Query.CountByFile, in search order
+	// Unreadable lists the files that couldn't be read, in search order.
+	Unreadable []ReadError
+	Stats      Stats
+	Truncated  bool // Whether Query.MaxResults left results out
+	// Stopped reports that Query.StopAfter ended a root's search before it
+	// visited every file.
+	Stopped bool
+}
+
+// ReadError is a file a search couldn't read.
+type ReadError struct {
+	Err  error // Why, such as fs.ErrNotExist, without the path
+	Root string
+	Path string // Where the file's results would have been reported
+}
+
+func (e ReadError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e ReadError) Unwrap() error {
+	return e.Err
+}
+
+// leadingName matches the name starting a result's text.
+var leadingName = regexp.MustCompile(`^[\p{L}\p{N}_$]+`)
+
+// Search runs q. When ctx is done before the search finishes, Search returns
+// the results found so far with an error wrapping ctx's.
+func Search(ctx context.Context, q Query) (Results, error) {
+	opts, roots, err := q.start()
+	if err != nil {
+		return Results{}, err
+	}
+
+	var res Results
+	for _, root := range roots {
+		found, counts, stats, err := q.searchRoot(ctx, root, opts, nil)
+		res.add(root, stats)
+		for _, c := range counts {
+			res.Counts = append(res.Counts, FileCount{
+				Root:        root,
+				Path:        c.File,
+				Language:    Language(c.Language),
+				Count:       c.Count,
+				IsTest:      c.IsTest,
+				IsGenerated: c.IsGenerated,
+			})
+		}
+		for _, r := range found {
+			if q.keep(&r) {
+				res.Results = append(res.Results, resultOf(root, &r))
+			}
+		}
+		if q.MaxResults > 0 && len(res.Results) > q.MaxResults {
+			res.Results, res.Truncated = res.Results[:q.MaxResults], true
+		}
+		if err != nil {
+			addContext(res.Results, q.Context)
+			return res, fmt.Errorf("cdx: %w", err)
+		}
+		if res.Truncated {
+			break
+		}
+	}
+	addContext(res.Results, q.Context)
+	return res, nil
+}
+
+// errFull is what Stream's callback stops a search with once it has passed
+// Query.MaxResults results.
+var errFull = errors.New("enough results")
+
+// Stream is like Search but passes each file's results to fn as soon as the
+// file is searched, rather than returning them once every file is, so a
+// caller can show the first results before the slowest file is done. Each
+// call holds one file's results, in line order and with their context
+// lines; files without results aren't passed. Roots are searched in turn,
+// but within one the files come in the order their searches finish, which
+// with more than one job varies from run to run, rather than in Search's
+// order, unless Query.InOrder is set. fn is never called concurrently. Query.MaxResults caps the results
+// passed in all, in the order they're passed.
+//
+// The Results Stream returns hold only the Stats and Unreadable files, and
+// whether MaxResults or StopAfter cut the search short. If fn returns an
+// error, no more files are searched and Stream returns the error as is.
+// Query.CountByFile isn't supported, as there are no results to pass.
+func Stream(ctx context.Context, q Query, fn func(results []Result) error) (Results, error) {
+	if q.CountByFile {
+		return Results{}, errors.New("cdx: Stream doesn't support CountByFile")
+	}
+	opts, roots, err := q.start()
+	if err != nil {
+		return Results{}, err
+	}
+
+	var res Results
+	var passed int
+	for _, root := range roots {
+		// fn's error, or errFull; refs.Stream never calls the callback
+		// concurrently, so it's safe to set there
+		var stop error
+		_, _, stats, err := q.searchRoot(ctx, root, opts, func(found []refs.Ref) error {
+			var batch []Result
+			for _, r := range found {
+				if q.keep(&r) {
+					batch = append(batch, resultOf(root, &r))
+				}
+			}
+			if q.MaxResults > 0 && passed+len(batch) > q.MaxResults {
+				batch, res.Truncated = batch[:q.MaxResults-passed], true
+			}
+			passed += len(batch)
+			if len(batch) > 0 {
+				addContext(batch, q.Context)
+				if stop = fn(batch); stop != nil {
+					return stop
+				}
+			}
+			if res.Truncated {
+				stop = errFull
+			}
+			return stop
+		})
+		res.add(root, stats)
+		switch {
+		case stop == errFull:
+			return res, nil
+		case stop != nil:
+			return res, stop
+		case err != nil:
+			return res, fmt.Errorf("cdx: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// start checks q and returns the options and roots its search starts from.
+func (q *Query) start() (refs.Options, []string, error) {
+	if (q.Symbol == "") == (q.Regex == "") {
+		return refs.Options{}, nil, errors.New("cdx: a query needs one of Symbol and Regex")
+	}
+	opts, err := q.options()
+	if err != nil {
+		return refs.Options{}, nil, fmt.Errorf("cdx: %w", err)
+	}
+	roots := q.Roots
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	return opts, roots, nil
+}
+
+// keep reports whether r is a result in q's Mode.
+func (q *Query) keep(r *refs.Ref) bool {
+	switch q.Mode {
+	case Definitions:
+		return r.Definition && (!r.Nested || q.Nested)
+	case References:
+		return !r.Definition
+	}
+	return true
+}
+
+// options returns the reference search options q asks for, but for the
+// root searched.
+func (q *Query) options() (refs.Options, error) {
+	opts := refs.Options{
+		Progress:      q.Progress,
+		Rev:           q.Rev,
+		Walk:          walk.Options{MaxFileSize: q.MaxFileSize, FollowSymlinks: q.FollowSymlinks},
+		Jobs:          q.Jobs,
+		MaxResults:    q.StopAfter,
+		MaxLineLength: q.MaxLineLength,
+		SkipComments:  q.SkipComments,
+		SkipStrings:   q.SkipStrings,
+		InStrings:     q.InStrings,
+		IgnoreCase:    q.IgnoreCase,
+		SkipTests:     !q.IncludeTests && !q.OnlyTests,
+		OnlyTests:     q.OnlyTests,
+		SkipGenerated: !q.IncludeGenerated,
+		InOrder:       q.InOrder,
+	}
+	if q.Regex != "" {
+		expr := `^(?:` + q.Regex + `)$`
+		if q.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		names, err := regexp.Compile(expr)
+		if err != nil {
+			return refs.Options{}, fmt.Errorf("regex: %w", err)
+		}
+		opts.Names = names
+	}
+	for _, lang := range q.Languages {
+		if patterns.ForLanguage(patterns.Language(lang)) == nil {
+			return refs.Options{}, fmt.Errorf("unknown language %q", lang)
+		}
+		opts.Walk.Languages = append(opts.Walk.Languages, patterns.Language(lang))
+	}
+	for _, kind := range q.Kinds {
+		if !slices.Contains(patterns.RefKinds, patterns.RefKind(kind)) {
+			return refs.Options{}, fmt.Errorf("unknown reference kind %q", kind)
+		}
+		opts.Kinds = append(opts.Kinds, patterns.RefKind(kind))
+	}
+	for _, e := range q.Exclude {
+		rule, err := ignore.CompileRule(e.Pattern, "", cmp.Or(e.Source, "Query.Exclude"))
+		if err != nil {
+			return refs.Options{}, fmt.Errorf("exclude: %w", err)
+		}
+		opts.Walk.Exclude = append(opts.Walk.Exclude, rule)
+	}
+	var err error
+	if opts.Generated, err = generated.New(q.GeneratedPatterns, "GeneratedPatterns"); err != nil {
+		return refs.Options{}, err
+	}
+	if q.GeneratedPatterns == nil {
+		opts.Generated = generated.Default()
+	}
+	if opts.Tests, err = testfiles.New(q.TestPaths, "TestPaths"); err != nil {
+		return refs.Options{}, err
+	}
+	if q.Parser != "" {
+		if opts.Outline, err = symbols.ForParser(q.Parser); err != nil {
+			return refs.Options{}, fmt.Errorf("parser: %w", err)
+		}
+	}
+	return opts, nil
+}
+
+// searchRoot runs the search opts describes in root, returning what
+// refs.Find or, with CountByFile, refs.CountByFile does; with each set, it
+// streams the references to it with refs.Stream instead.
+func (q *Query) searchRoot(ctx context.Context, root string, opts refs.Options, each func([]refs.Ref) error) ([]refs.Ref, []refs.FileCount, refs.Stats, error) {
+	if q.Archive {
+		opts.Archive = root
+	} else {
+		opts.Walk.Root = root
+	}
+	// A revision or an archive isn't the working tree that a session's
+	// walk and the caches describe
+	working := !q.Archive && q.Rev == ""
+	var reuse session.Root
+	if s := session.From(ctx); s != nil {
+		opts.Definitions = s.Definitions
+		if s.Root != nil && working {
+			reuse = s.Root(root)
+		}
+	}
+	opts.Files = reuse.Files
+	if q.Cache && working {
+		opts.Cache = reuse.Cache
+		if opts.Cache == nil {
+			if c, err := cache.Open(root); err == nil {
+				opts.Cache = c
+				defer c.Save()
+			}
+		}
+		if file, err := cache.ListingsFile(root); err == nil && q.ListingsLifetime > 0 && opts.Files == nil {
+			opts.Walk.Listings = walk.LoadListings(file, q.ListingsLifetime)
+			defer opts.Walk.Listings.Save()
+		}
+	}
+	// Failing a walk, the files the cache saw last time estimate how many
+	// there are
+	switch {
+	case opts.Files != nil:
+		opts.ExpectedFiles = len(opts.Files)
+	case opts.Cache != nil:
+		opts.ExpectedFiles = opts.Cache.Len()
+	}
+	switch {
+	case each != nil:
+		stats, err := refs.Stream(ctx, q.Symbol, opts, each)
+		return nil, nil, stats, err
+	case q.CountByFile:
+		counts, stats, err := refs.CountByFile(ctx, q.Symbol, opts)
+		return nil, counts, stats, err
+	}
+	found, stats, err := refs.Find(ctx, q.Symbol, opts)
+	return found, nil, stats, err
+}
+
+// add counts a root's stats into res.
+func (res *Results) add(root string, stats refs.Stats) {
+	s := &res.Stats
+	for source, n := range stats.Excluded {
+		if s.Excluded == nil {
+			s.Excluded = make(map[string]int)
+		}
+		s.Excluded[source] += n
+	}
+	s.Oversized = append(s.Oversized, stats.Oversized...)
+	s.Files += stats.Files
+	s.Dirs += stats.Dirs
+	s.Binary += stats.Binary
+	s.Duplicates += stats.Duplicates
+	s.Listed += stats.Listed
+	s.Generated += stats.Generated
+	s.Unreadable += len(stats.Unreadable)
+	s.Truncated += stats.Truncated
+	s.Walk += stats.Elapsed
+	for _, e := range stats.Unreadable {
+		res.Unreadable = append(res.Unreadable, ReadError{Err: e.Err, Root: root, Path: e.Path})
+	}
+	res.Stopped = res.Stopped || stats.Limited
+}
+
+// resultOf returns the Result for r, found under root.
+func resultOf(root string, r *refs.Ref) Result {
+	res := Result{
+		Root:        root,
+		Path:        r.Path,
+		Name:        leadingName.FindString(r.Text[r.Column-1:]),
+		Text:        r.Text,
+		Kind:        string(r.Kind),
+		Scope:       r.Scope,
+		Container:   r.Container,
+		Receiver:    r.Receiver,
+		Literal:     r.Literal,
+		Encoding:    r.Encoding,
+		Language:    Language(r.Language),
+		Archive:     r.Archive,
+		Rev:         r.Rev,
+		Line:        r.Line,
+		Column:      r.Column,
+		source:      r.Source,
+		offset:      r.Offset,
+		InComment:   r.InComment,
+		InString:    r.InString,
+		IsTest:      r.IsTest,
+		IsGenerated: r.IsGenerated,
+		Nested:      r.Nested,
+	}
+	if r.Enclosing != nil {
+		res.Enclosing = &Enclosing{Name: r.Enclosing.Name, Kind: r.Enclosing.Kind, Line: r.Enclosing.Line}
+	}
+	return res
+}
+
+// addContext fills in up to lines lines of context around each result. Only
+// the bytes around a result are read when its line is still where the search
+// found it, so results in large files don't cost reading them whole; other
+// files are read once in full, as decoding them takes. A file as of
+// Query.Rev or in an archive is sliced from the contents the search read,
+// which are then let go. A file that can no longer be read gets none.
+func addContext(results []Result, lines int) {
+	defer func() {
+		for i := range results {
+			results[i].source = nil
+		}
+	}()
+	if lines <= 0 {
+		return
+	}
+	var (
+		path string
+		file *os.File
+		size int64
+		text []string // The file's lines, once a result needs them
+	)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+	for i := range results {
+		r := &results[i]
+		if p := filepath.Join(r.Root, filepath.FromSlash(r.Path)); p != path {
+			if file != nil {
+				file.Close()
+			}
+			path, file, text = p, nil, nil
+			switch {
+			case r.source != nil:
+				// A file as of a revision or in an archive has its lines
+				// sliced from the contents the search read, not the
+				// working tree's
+				for _, line := range scan.Lines(r.source) {
+					text = append(text, line)
+				}
+			default:
+				if f, err := os.Open(p); err == nil { // #nosec G304 -- a path the search found
+					if info, err := f.Stat(); err == nil {
+						file, size = f, info.Size()
+					} else {
+						f.Close()
+					}
+				}
+			}
+		}
+		if file != nil && r.offset >= 0 && lineAt(file, r.offset, r.Text) {
+			end := r.offset + int64(len(r.Text))
+			r.Before, r.After, _ = scan.ReadContext(file, size, r.offset, end, lines, lines, scan.DefaultMaxLineLength)
+			continue
+		}
+		if text == nil && file != nil {
+			if data, _, err := scan.ReadFile(path); err == nil {
+				for _, line := range scan.Lines(data) {
+					text = append(text, line)
+				}
+			}
+		}
+		if r.Line > len(text) {
+			continue
+		}
+		r.Before = slices.Clone(text[max(r.Line-1-lines, 0) : r.Line-1])
+		r.After = slices.Clone(text[r.Line:min(r.Line+lines, len(text))])
+	}
+}
+
+// lineAt reports whether the line starting at byte offset off of f still
+// begins with text, as it did when the search read it.
+func lineAt(f *os.File, off int64, text string) bool {
+	buf := make([]byte, len(text))
+	n, _ := f.ReadAt(buf, off)
+	return n == len(buf) && string(buf) == text
+}
+
+// Languages returns the languages cdx supports, sorted by name.
+func Languages() []Language {
+	var langs []Language
+	for _, lang := range patterns.AllLanguages() {
+		langs = append(langs, Language(lang))
+	}
+	slices.Sort(langs)
+	return langs
+}
+
+// DetectLanguage returns the language of the file at path, by its name or
+// extension, or "" if cdx doesn't support it.
+func DetectLanguage(path string) Language {
+	return Language(patterns.DetectFile(path))
+}
+
+// LanguageInfo describes a supported language.
+type LanguageInfo struct {
+	Name       Language
+	Extensions []string // With leading dots, e.g. ".ts"
+	// DefinitionKinds are the kinds of definition cdx recognizes, such as
+	// function and type
+	DefinitionKinds []string
+}
+
+// Describe returns what cdx knows about lang, or false if it doesn't
+// support it.
+func Describe(lang Language) (LanguageInfo, bool) {
+	lp := patterns.ForLanguage(patterns.Language(lang))
+	if lp == nil {
+		return LanguageInfo{}, false
+	}
+	info := LanguageInfo{Name: lang, Extensions: slices.Clone(lp.Extensions)}
+	for _, p := range lp.Definition {
+		if !slices.Contains(info.DefinitionKinds, p.Kind) {
+			info.DefinitionKinds = append(info.DefinitionKinds, p.Kind)
+		}
+	}
+	return info, true
+}
@@ -0,0 +1,459 @@
+package cdx
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bashhack/cdx/internal/patterns"
+	"github.com/bashhack/cdx/internal/session"
+	"github.com/bashhack/cdx/internal/walk"
+)
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name  string
+		want  []string // path:line name kind
+		query Query
+		trunc bool
+	}{
+		{
+			name:  "symbol",
+			query: Query{Symbol: "Total"},
+			want: []string{
+				"cart.go:8 Total other", "cart.go:9 Total definition", "cart.go:17 Total other",
+				"cart.go:19 Total call", "item.go:10 Total call",
+			},
+		},
+		{
+			name:  "references only",
+			query: Query{Symbol: "Total", Mode: References, SkipComments: true},
+			want:  []string{"cart.go:19 Total call", "item.go:10 Total call"},
+		},
+		{
+			name:  "tests included",
+			query: Query{Symbol: "Total", Mode: References, SkipComments: true, IncludeTests: true},
+			want:  []string{"cart.go:19 Total call", "cart_test.go:4 Total call", "item.go:10 Total call"},
+		},
+		{
+			name:  "regex",
+			query: Query{Regex: `\w*total`, IgnoreCase: true, Mode: Definitions},
+			want:  []string{"cart.go:9 Total definition", "cart.go:18 LegacyTotal definition"},
+		},
+		{
+			name:  "max results",
+			query: Query{Symbol: "Total", MaxResults: 2},
+			want:  []string{"cart.go:8 Total other", "cart.go:9 Total definition"},
+			trunc: true,
+		},
+		{
+			name:  "tests only",
+			query: Query{Symbol: "Total", Mode: References, OnlyTests: true},
+			want:  []string{"cart_test.go:4 Total call"},
+		},
+		{
+			name:  "kinds",
+			query: Query{Symbol: "Total", Kinds: []string{"call"}},
+			want:  []string{"cart.go:9 Total definition", "cart.go:19 Total call", "item.go:10 Total call"},
+		},
+		{
+			name:  "excluded",
+			query: Query{Symbol: "Total", Mode: References, SkipComments: true, Exclude: []Exclusion{{Pattern: "item.go"}}},
+			want:  []string{"cart.go:19 Total call"},
+		},
+		{
+			name:  "other language",
+			query: Query{Symbol: "Total", Languages: []Language{"py"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Roots = []string{"testdata/shop"}
+			res, err := Search(context.Background(), tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range res.Results {
+				got = append(got, fmt.Sprintf("%s:%d %s %s", r.Path, r.Line, r.Name, r.Kind))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() = %q, want %q", got, tt.want)
+			}
+			if res.Truncated != tt.trunc {
+				t.Errorf("Truncated = %v, want %v", res.Truncated, tt.trunc)
+			}
+		})
+	}
+}
+
+func TestSearch_Context(t *testing.T) {
+	res, err := Search(context.Background(), Query{Symbol: "LegacyTotal", Roots: []string{"testdata/shop"}, Context: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != 2 {
+		t.Fatalf("Search() = %+v, want 2 results", res.Results)
+	}
+	r := res.Results[1]
+	if want := []string{"", "// LegacyTotal is the old name of Total."}; !reflect.DeepEqual(r.Before, want) {
+		t.Errorf("Before = %q, want %q", r.Before, want)
+	}
+	if want := []string{"\treturn c.Total()", "}"}; !reflect.DeepEqual(r.After, want) {
+		t.Errorf("After = %q, want %q", r.After, want)
+	}
+	// The walk counts the test file before the search skips it
+	if res.Stats.Files != 3 {
+		t.Errorf("Stats.Files = %d, want 3", res.Stats.Files)
+	}
+}
+
+// TestSearch_ContextNotOnDisk checks that results as of a revision or in an
+// archive take their context from the contents searched, not the working
+// tree.
+func TestSearch_ContextNotOnDisk(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	const committed = "package shop\n\n// Total sums the cart.\nfunc Total() int {\n\treturn 0\n}\n"
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "cart.go"), []byte(committed), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=cdx", "-c", "user.email=cdx@example.com", "commit", "-q", "-m", "cart"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", root}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	// The working tree has moved on since, with the line before the
+	// definition edited
+	edited := strings.Replace(committed, "sums the cart", "is edited", 1)
+	if err := os.WriteFile(filepath.Join(root, "cart.go"), []byte(edited), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("shop/cart.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(committed)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "shop.zip")
+	if err := os.WriteFile(archive, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]Query{
+		"rev":     {Rev: "HEAD", Roots: []string{root}},
+		"archive": {Archive: true, Roots: []string{archive}},
+	}
+	for name, q := range tests {
+		t.Run(name, func(t *testing.T) {
+			q.Symbol, q.Mode, q.Context = "Total", Definitions, 1
+			res, err := Search(context.Background(), q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Results) != 1 {
+				t.Fatalf("Search() = %+v, want one result", res.Results)
+			}
+			r := res.Results[0]
+			if want := []string{"// Total sums the cart."}; !reflect.DeepEqual(r.Before, want) {
+				t.Errorf("Before = %q, want %q", r.Before, want)
+			}
+			if want := []string{"\treturn 0"}; !reflect.DeepEqual(r.After, want) {
+				t.Errorf("After = %q, want %q", r.After, want)
+			}
+		})
+	}
+}
+
+func TestAddContext(t *testing.T) {
+	root := t.TempDir()
+	src := "package p\r\n\r\n// Limit caps users.\r\nvar Limit = 10\r\n\r\nfunc f() {}\r\n"
+	if err := os.WriteFile(filepath.Join(root, "limit.go"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	res, err := Search(context.Background(), Query{Symbol: "Limit", Roots: []string{root}, Mode: Definitions})
+	if err != nil || len(res.Results) != 1 {
+		t.Fatalf("Search() = %+v, %v, want 1 result", res.Results, err)
+	}
+	wantBefore, wantAfter := []string{"", "// Limit caps users."}, []string{"", "func f() {}"}
+
+	// Read from the result's offset, and by line number when the line has
+	// moved from there
+	for _, offset := range []int64{res.Results[0].offset, 0} {
+		results := slices.Clone(res.Results)
+		results[0].offset = offset
+		addContext(results, 2)
+		if r := results[0]; !reflect.DeepEqual(r.Before, wantBefore) || !reflect.DeepEqual(r.After, wantAfter) {
+			t.Errorf("offset %d: context = %q, %q, want %q, %q", offset, r.Before, r.After, wantBefore, wantAfter)
+		}
+	}
+}
+
+func TestSearch_Nested(t *testing.T) {
+	root := t.TempDir()
+	src := "def retry(fn):\n    def wrapper():\n        return fn()\n    return wrapper\n\n" +
+		"class Client:\n    def wrapper(self):\n        pass\n"
+	if err := os.WriteFile(filepath.Join(root, "retry.py"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, nested := range []bool{false, true} {
+		res, err := Search(context.Background(), Query{Symbol: "wrapper", Roots: []string{root}, Mode: Definitions, Nested: nested})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range res.Results {
+			got = append(got, fmt.Sprintf("%d %s", r.Line, r.Scope))
+		}
+		// The method is always a definition; the closure only with Nested
+		want := []string{"7 Client"}
+		if nested {
+			want = []string{"2 retry", "7 Client"}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Search(Nested: %v) = %q, want %q", nested, got, want)
+		}
+	}
+}
+
+func TestSearch_Enclosing(t *testing.T) {
+	res, err := Search(context.Background(), Query{
+		Symbol: "Total", Mode: References, SkipComments: true, Parser: "regex", Roots: []string{"testdata/shop"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range res.Results {
+		if r.Enclosing == nil {
+			t.Fatalf("%s:%d has no enclosing definition", r.Path, r.Line)
+		}
+		got = append(got, fmt.Sprintf("%s:%d in %s", r.Path, r.Line, r.Enclosing.Name))
+	}
+	want := []string{"cart.go:19 in LegacyTotal", "item.go:10 in receipt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() = %q, want %q", got, want)
+	}
+}
+
+func TestSearch_Session(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.go", "b.go"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("package m\n\nfunc Log() {}\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The session's walk of the root lists a.go alone, so b.go goes unsearched
+	files := []walk.File{{Path: filepath.Join(root, "a.go"), Rel: "a.go", Language: patterns.Go}}
+	ctx := session.With(context.Background(), &session.State{
+		Root: func(string) session.Root { return session.Root{Files: files} },
+	})
+	res, err := Search(ctx, Query{Symbol: "Log", Roots: []string{root}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range res.Results {
+		got = append(got, r.Path)
+	}
+	if want := []string{"a.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() = %q, want %q", got, want)
+	}
+}
+
+func TestSearch_CountByFile(t *testing.T) {
+	res, err := Search(context.Background(), Query{
+		Symbol:       "Total",
+		SkipComments: true,
+		IncludeTests: true,
+		CountByFile:  true,
+		Exclude:      []Exclusion{{Pattern: "item.go", Source: "receipts"}},
+		Roots:        []string{"testdata/shop"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileCount{
+		{Root: "testdata/shop", Path: "cart.go", Language: "go", Count: 1},
+		{Root: "testdata/shop", Path: "cart_test.go", Language: "go", Count: 1, IsTest: true},
+	}
+	if !reflect.DeepEqual(res.Counts, want) {
+		t.Errorf("Counts = %+v, want %+v", res.Counts, want)
+	}
+	if len(res.Results) != 0 {
+		t.Errorf("Results = %+v, want none", res.Results)
+	}
+	if got := res.Stats.Excluded["receipts"]; got != 1 {
+		t.Errorf("Stats.Excluded[receipts] = %d, want 1", got)
+	}
+}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name  string
+		want  []string // Each call's path:line, space-separated
+		query Query
+		trunc bool
+	}{
+		{
+			name:  "by file",
+			query: Query{Symbol: "Total", IncludeTests: true, Jobs: 1},
+			want:  []string{"cart.go:8 cart.go:9 cart.go:17 cart.go:19", "cart_test.go:4", "item.go:10"},
+		},
+		{
+			name:  "mode",
+			query: Query{Symbol: "Total", Mode: Definitions, Jobs: 1},
+			want:  []string{"cart.go:9"},
+		},
+		{
+			name:  "max results",
+			query: Query{Symbol: "Total", SkipComments: true, MaxResults: 2, Jobs: 1},
+			want:  []string{"cart.go:9 cart.go:19"},
+			trunc: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Roots = []string{"testdata/shop"}
+			var got []string
+			res, err := Stream(context.Background(), tt.query, func(results []Result) error {
+				var lines []string
+				for _, r := range results {
+					lines = append(lines, fmt.Sprintf("%s:%d", r.Path, r.Line))
+				}
+				got = append(got, strings.Join(lines, " "))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Stream() passed %q, want %q", got, tt.want)
+			}
+			if res.Truncated != tt.trunc {
+				t.Errorf("Truncated = %v, want %v", res.Truncated, tt.trunc)
+			}
+			if res.Stats.Files == 0 || res.Results != nil {
+				t.Errorf("Stream() = %+v, want stats and no results", res)
+			}
+		})
+	}
+}
+
+// TestStream_Concurrent checks that with several jobs, Stream passes the
+// same results as Search, each file's together, one call at a time.
+func TestStream_Concurrent(t *testing.T) {
+	q := Query{Symbol: "Total", IncludeTests: true, Context: 1, Roots: []string{"testdata/shop"}, Jobs: 4}
+	want, err := Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Result
+	var calls int
+	_, err = Stream(context.Background(), q, func(results []Result) error {
+		calls++
+		for _, r := range results[1:] {
+			if r.Path != results[0].Path {
+				t.Errorf("Stream() passed %s and %s together", results[0].Path, r.Path)
+			}
+		}
+		got = append(got, results...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("Stream() called fn %d times, want once per file", calls)
+	}
+	byPlace := func(a, b Result) int {
+		return cmp.Or(strings.Compare(a.Path, b.Path), a.Line-b.Line, a.Column-b.Column)
+	}
+	slices.SortFunc(got, byPlace)
+	if !reflect.DeepEqual(got, want.Results) {
+		t.Errorf("Stream() passed %+v, want %+v", got, want.Results)
+	}
+}
+
+func TestStream_Stop(t *testing.T) {
+	errStop := errors.New("stop")
+	var calls int
+	_, err := Stream(context.Background(), Query{Symbol: "Total", IncludeTests: true, Roots: []string{"testdata/shop"}}, func([]Result) error {
+		calls++
+		return errStop
+	})
+	if err != errStop {
+		t.Errorf("Stream() error = %v, want fn's", err)
+	}
+	if calls != 1 {
+		t.Errorf("Stream() called fn %d times after it failed, want 1", calls)
+	}
+
+	if _, err := Stream(context.Background(), Query{Symbol: "Total", CountByFile: true}, func([]Result) error { return nil }); err == nil {
+		t.Error("Stream() with CountByFile succeeded, want an error")
+	}
+}
+
+func TestSearch_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		want  string
+		query Query
+	}{
+		"neither":          {"one of Symbol and Regex", Query{}},
+		"both":             {"one of Symbol and Regex", Query{Symbol: "a", Regex: "b"}},
+		"bad regex":        {"regex", Query{Regex: "("}},
+		"unknown language": {`unknown language "cobol"`, Query{Symbol: "a", Languages: []Language{"cobol"}}},
+		"unknown kind":     {`unknown reference kind "use"`, Query{Symbol: "a", Kinds: []string{"use"}}},
+		"unknown parser":   {"parser", Query{Symbol: "a", Parser: "lexer"}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Search(context.Background(), tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Search() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	langs := Languages()
+	for _, lang := range langs {
+		info, ok := Describe(lang)
+		if !ok || info.Name != lang || len(info.Extensions) == 0 {
+			t.Errorf("Describe(%q) = %+v, %v", lang, info, ok)
+		}
+		if got := DetectLanguage("file" + info.Extensions[0]); got != lang {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", "file"+info.Extensions[0], got, lang)
+		}
+	}
+	if _, ok := Describe("cobol"); ok {
+		t.Error(`Describe("cobol") = true, want false`)
+	}
+	if got := DetectLanguage("README"); got != "" {
+		t.Errorf(`DetectLanguage("README") = %q, want ""`, got)
+	}
+}
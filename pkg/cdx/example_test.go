@@ -0,0 +1,52 @@
+package cdx_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/bashhack/cdx/pkg/cdx"
+)
+
+func ExampleSearch() {
+	res, err := cdx.Search(context.Background(), cdx.Query{
+		Symbol:       "Total",
+		Roots:        []string{"testdata/shop"},
+		SkipComments: true,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, r := range res.Results {
+		fmt.Printf("%s:%d:%d %s\n", r.Path, r.Line, r.Column, r.Kind)
+	}
+	// Output:
+	// cart.go:9:16 definition
+	// cart.go:19:11 call
+	// item.go:10:36 call
+}
+
+func ExampleSearch_definitions() {
+	res, err := cdx.Search(context.Background(), cdx.Query{
+		Regex:   `\w*Total`,
+		Roots:   []string{"testdata/shop"},
+		Mode:    cdx.Definitions,
+		Context: 1,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, r := range res.Results {
+		fmt.Printf("%s %s:%d, after %q\n", r.Name, r.Path, r.Line, r.Before)
+	}
+	// Output:
+	// Total cart.go:9, after ["// Total returns the price of everything in the cart."]
+	// LegacyTotal cart.go:18, after ["// LegacyTotal is the old name of Total."]
+}
+
+func ExampleDescribe() {
+	info, ok := cdx.Describe(cdx.DetectLanguage("main.go"))
+	fmt.Println(ok, info.Name, info.Extensions)
+	// Output:
+	// true go [.go]
+}
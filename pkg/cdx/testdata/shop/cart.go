@@ -0,0 +1,20 @@
+package shop
+
+// Cart holds the items a customer is buying.
+type Cart struct {
+	Items []Item
+}
+
+// Total returns the price of everything in the cart.
+func (c *Cart) Total() int {
+	total := 0
+	for _, item := range c.Items {
+		total += item.Price
+	}
+	return total
+}
+
+// LegacyTotal is the old name of Total.
+func LegacyTotal(c *Cart) int {
+	return c.Total()
+}
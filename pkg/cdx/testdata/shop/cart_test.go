@@ -0,0 +1,7 @@
+package shop
+
+func TestTotal(t *testing.T) {
+	if (&Cart{}).Total() != 0 {
+		t.Fail()
+	}
+}
@@ -0,0 +1,11 @@
+package shop
+
+// Item is something for sale.
+type Item struct {
+	Name  string
+	Price int
+}
+
+func receipt(c *Cart) string {
+	return fmt.Sprintf("total: %d", c.Total())
+}
@@ -0,0 +1,3 @@
+﻿def load_settings(path):
+    """Read settings saved by the Windows installer."""
+    return open(path).read()
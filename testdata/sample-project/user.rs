@@ -38,3 +38,9 @@ pub enum UserRole {
     Member,
     Guest,
 }
+
+impl std::fmt::Display for User {
+    fn fmt(&self, f: &mut std::fmt::Formatter) -> std::fmt::Result {
+        write!(f, "{}", self.name)
+    }
+}
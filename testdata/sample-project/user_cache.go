@@ -0,0 +1,11 @@
+package sample
+
+import "fmt"
+
+// CacheKey identifies the user in the cache; User is declared in user.go.
+func (u *User) CacheKey() string {
+	return fmt.Sprintf("user:%d", u.ID)
+}
+
+// cacheTTL is how long a cached user stays fresh, in seconds.
+const cacheTTL = 300